@@ -6,6 +6,7 @@ import (
 	"context"
 	"crypto/md5"
 	"crypto/sha1"
+	"encoding"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -30,6 +31,7 @@ import (
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/lib/encoder"
+	"github.com/rclone/rclone/lib/readers"
 )
 
 // Chunker's composite files have one or more chunks
@@ -126,6 +128,9 @@ const maxSafeChunkNumber = 10000000
 // Number of attempts to find unique transaction identifier
 const maxTransactionProbes = 100
 
+// Size of the blocks read in parallel from composite files
+const readBlockSize = 8 * 1024 * 1024
+
 // standard chunker errors
 var (
 	ErrChunkOverflow = errors.New("chunk number overflow")
@@ -267,6 +272,26 @@ If meta format is set to "none", rename transactions will always be used.
 This method is EXPERIMENTAL, don't use on production systems.`,
 				},
 			},
+		}, {
+			Name:     "upload_concurrency",
+			Advanced: true,
+			Default:  4,
+			Help: `Number of chunks to upload at once in multi-thread copies.
+
+When a large file is copied to chunker with multi-thread copies (see
+--multi-thread-cutoff) its chunks are uploaded in parallel, this
+many at once, unless --multi-thread-streams is set higher.`,
+		}, {
+			Name:     "download_concurrency",
+			Advanced: true,
+			Default:  1,
+			Help: fmt.Sprintf(`Number of blocks to read at once from composite files.
+
+By default the chunks of composite files are read sequentially.
+
+If this is set higher then composite files are read in blocks of %s,
+fetching up to this many blocks ahead in parallel, possibly from
+different chunks. Each block being read uses its size in memory.`, fs.SizeSuffix(readBlockSize)),
 		}},
 	})
 }
@@ -358,6 +383,12 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 
 	f.features.Disable("ListR") // Recursive listing may cause chunker skip files
 
+	// Chunks are uploaded with the wrapped remote's Put so
+	// OpenChunkWriter doesn't need support from the wrapped remote.
+	f.features.OpenChunkWriter = f.OpenChunkWriter
+	f.features.ChunkWriterDoesntSeek = true
+	f.features.DisableList(fs.GetConfig(ctx).DisableFeatures)
+
 	return f, err
 }
 
@@ -371,6 +402,8 @@ type Options struct {
 	HashType     string        `config:"hash_type"`
 	FailHard     bool          `config:"fail_hard"`
 	Transactions string        `config:"transactions"`
+	UploadConc   int           `config:"upload_concurrency"`
+	DownloadConc int           `config:"download_concurrency"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -1146,33 +1179,17 @@ func (f *Fs) put(
 	basePut putFn, action string, target fs.Object,
 ) (obj fs.Object, err error) {
 	// Perform consistency checks
-	if err := f.forbidChunk(src, remote); err != nil {
-		return nil, fmt.Errorf("%s refused: %w", action, err)
-	}
-	if target == nil {
-		// Get target object with a quick directory scan
-		// skip metadata check if target object does not exist.
-		// ignore not-chunked objects, skip chunk size checks.
-		if obj, err := f.scanObject(ctx, remote, true); err == nil {
-			target = obj
-		}
-	}
-	if target != nil {
-		obj := target.(*Object)
-		if err := obj.readMetadata(ctx); err == ErrMetaUnknown {
-			// refuse to update a file of unsupported format
-			return nil, fmt.Errorf("refusing to %s: %w", action, err)
-		}
+	if err := f.checkPut(ctx, src, remote, action, target); err != nil {
+		return nil, err
 	}
 
 	// Prepare to upload
 	c := f.newChunkingReader(src)
 	wrapIn := c.wrapStream(ctx, in, src)
 
-	var metaObject fs.Object
 	defer func() {
 		if err != nil {
-			c.rollback(ctx, metaObject)
+			c.rollback(ctx, nil)
 		}
 	}()
 
@@ -1252,6 +1269,38 @@ func (f *Fs) put(
 		return nil, fmt.Errorf("incorrect upload size %d != %d", c.readCount, c.sizeTotal)
 	}
 
+	return f.finishPut(ctx, src, baseRemote, xactID, c, basePut)
+}
+
+// checkPut checks that src can be put to remote, refusing chunk names
+// and updates of files in an unknown format
+func (f *Fs) checkPut(ctx context.Context, src fs.ObjectInfo, remote, action string, target fs.Object) error {
+	if err := f.forbidChunk(src, remote); err != nil {
+		return fmt.Errorf("%s refused: %w", action, err)
+	}
+	if target == nil {
+		// Get target object with a quick directory scan
+		// skip metadata check if target object does not exist.
+		// ignore not-chunked objects, skip chunk size checks.
+		if obj, err := f.scanObject(ctx, remote, true); err == nil {
+			target = obj
+		}
+	}
+	if target != nil {
+		obj := target.(*Object)
+		if err := obj.readMetadata(ctx); err == ErrMetaUnknown {
+			// refuse to update a file of unsupported format
+			return fmt.Errorf("refusing to %s: %w", action, err)
+		}
+	}
+	return nil
+}
+
+// finishPut makes the object from the data chunks uploaded to c
+//
+// It renames the chunks in place and writes the metadata object as
+// needed by the transaction mode and metadata format.
+func (f *Fs) finishPut(ctx context.Context, src fs.ObjectInfo, baseRemote, xactID string, c *chunkingReader, basePut putFn) (obj fs.Object, err error) {
 	// Check for input that looks like valid metadata
 	needMeta := len(c.chunks) > 1
 	if c.readCount <= maxMetadataSize && len(c.chunks) == 1 {
@@ -1324,6 +1373,7 @@ func (f *Fs) put(
 		c.updateHashes()
 		metadata, err = marshalSimpleJSON(ctx, sizeTotal, len(c.chunks), c.md5, c.sha1, xactID)
 	}
+	var metaObject fs.Object
 	if err == nil {
 		metaInfo := f.wrapInfo(src, baseRemote, int64(len(metadata)))
 		metaObject, err = basePut(ctx, bytes.NewReader(metadata), metaInfo)
@@ -1374,6 +1424,17 @@ func (f *Fs) newChunkingReader(src fs.ObjectInfo) *chunkingReader {
 func (c *chunkingReader) wrapStream(ctx context.Context, in io.Reader, src fs.ObjectInfo) io.Reader {
 	baseIn, wrapBack := accounting.UnWrap(in)
 
+	c.setupHashes(ctx, src)
+	if c.hasher != nil {
+		baseIn = io.TeeReader(baseIn, c.hasher)
+	}
+	c.baseReader = baseIn
+	return wrapBack(c)
+}
+
+// setupHashes reads the hash needed from src, making a hasher to
+// calculate it in transit if src can't supply it
+func (c *chunkingReader) setupHashes(ctx context.Context, src fs.ObjectInfo) {
 	switch {
 	case c.fs.useMD5:
 		srcObj := fs.UnWrapObjectInfo(src)
@@ -1404,12 +1465,6 @@ func (c *chunkingReader) wrapStream(ctx context.Context, in io.Reader, src fs.Ob
 			}
 		}
 	}
-
-	if c.hasher != nil {
-		baseIn = io.TeeReader(baseIn, c.hasher)
-	}
-	c.baseReader = baseIn
-	return wrapBack(c)
 }
 
 func (c *chunkingReader) updateHashes() {
@@ -1560,6 +1615,216 @@ func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 	return f.newObject("", o, nil), nil
 }
 
+// OpenChunkWriter returns the chunk size and a ChunkWriter
+//
+// Each chunk written becomes a data chunk of the composite file so
+// the chunks can be uploaded in parallel. The chunks are uploaded
+// under temporary names and the file is finalized on Close in the
+// same way as Put does according to the transactions mode.
+func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectInfo, options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, err error) {
+	if err := f.checkPut(ctx, src, remote, "upload", nil); err != nil {
+		return info, nil, err
+	}
+	xactID, err := f.newXactID(ctx, remote)
+	if err != nil {
+		return info, nil, err
+	}
+	w := &chunkWriter{
+		f:       f,
+		src:     src,
+		remote:  remote,
+		xactID:  xactID,
+		options: options,
+		c:       f.newChunkingReader(src),
+		chunks:  make(map[int]fs.Object),
+	}
+	w.c.setupHashes(ctx, src)
+	info = fs.ChunkWriterInfo{
+		ChunkSize:   int64(f.opt.ChunkSize),
+		Concurrency: f.opt.UploadConc,
+	}
+	fs.Debugf(src, "open chunk writer: started upload with transaction %q", xactID)
+	return info, w, nil
+}
+
+// chunkWriter uploads the data chunks of a composite file in parallel
+type chunkWriter struct {
+	f        *Fs
+	src      fs.ObjectInfo
+	remote   string
+	xactID   string
+	options  []fs.OpenOption
+	c        *chunkingReader   // hash state and the chunks when finishing
+	mu       sync.Mutex        // protects the fields below
+	chunks   map[int]fs.Object // chunks uploaded by number
+	hashNext int               // next chunk to hash in transit or -1 if the hash can't be made
+	hashBusy bool              // set if a chunk is being hashed
+	head     []byte            // start of chunk 0 if it is small
+	closed   bool              // set when the file is complete
+}
+
+// chunkSize returns the size of chunkNumber or -1 if unknown
+func (w *chunkWriter) chunkSize(chunkNumber int) int64 {
+	if w.c.sizeTotal < 0 {
+		return -1
+	}
+	size := w.c.sizeTotal - int64(chunkNumber)*w.c.chunkSize
+	if size > w.c.chunkSize {
+		size = w.c.chunkSize
+	}
+	return size
+}
+
+// WriteChunk will write chunk number with reader bytes, where chunk number >= 0
+func (w *chunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader io.ReadSeeker) (bytesWritten int64, err error) {
+	if chunkNumber < 0 || chunkNumber > maxSafeChunkNumber {
+		return -1, ErrChunkOverflow
+	}
+	size := w.chunkSize(chunkNumber)
+	if size < 0 {
+		// Find the size of the chunk if the file size is unknown
+		size, err = reader.Seek(0, io.SeekEnd)
+		if err == nil {
+			_, err = reader.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			return -1, fmt.Errorf("failed to find chunk size: %w", err)
+		}
+	}
+	if size <= 0 {
+		return -1, fmt.Errorf("chunk %d is beyond the end of the file", chunkNumber)
+	}
+
+	// Hash the chunk in transit if it is the next one needed,
+	// saving the state of the hasher to go back to if it fails
+	in := io.Reader(reader)
+	var hashState []byte
+	w.mu.Lock()
+	hashing := w.c.hasher != nil && chunkNumber == w.hashNext && !w.hashBusy
+	if hashing {
+		if m, ok := w.c.hasher.(encoding.BinaryMarshaler); ok {
+			hashState, _ = m.MarshalBinary()
+		}
+		w.hashBusy = true
+		in = io.TeeReader(in, w.c.hasher)
+	}
+	w.mu.Unlock()
+	if chunkNumber == 0 && size <= maxMetadataSize {
+		head, err := io.ReadAll(io.LimitReader(in, size))
+		if err != nil {
+			return -1, err
+		}
+		w.mu.Lock()
+		w.head = head
+		w.mu.Unlock()
+		in = bytes.NewReader(head)
+	}
+	counter := readers.NewCountingReader(in)
+
+	chunkRemote := w.f.makeChunkName(w.remote, chunkNumber, "", w.xactID)
+	info := w.f.wrapInfo(w.src, chunkRemote, size)
+	chunk, err := w.f.base.Put(ctx, counter, info, w.options...)
+	bytesWritten = int64(counter.BytesRead())
+	if err == nil && bytesWritten != size {
+		silentlyRemove(ctx, chunk)
+		err = fmt.Errorf("chunk %d: wrote %d bytes but expected %d", chunkNumber, bytesWritten, size)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if hashing {
+		w.hashBusy = false
+		if err == nil {
+			w.hashNext++
+		} else if u, ok := w.c.hasher.(encoding.BinaryUnmarshaler); !ok || hashState == nil || u.UnmarshalBinary(hashState) != nil {
+			// The hasher has seen part of the chunk
+			w.hashNext = -1
+		}
+	}
+	if err != nil {
+		return -1, err
+	}
+	w.chunks[chunkNumber] = chunk
+	return bytesWritten, nil
+}
+
+// Close complete chunked writer finalising the file.
+func (w *chunkWriter) Close(ctx context.Context) (err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	if len(w.chunks) == 0 {
+		return errors.New("no chunks written")
+	}
+	chunks := make([]fs.Object, len(w.chunks))
+	var readCount int64
+	for chunkNo := range chunks {
+		chunk, found := w.chunks[chunkNo]
+		if !found {
+			return fmt.Errorf("chunk %d missing", chunkNo)
+		}
+		chunks[chunkNo] = chunk
+		readCount += chunk.Size()
+	}
+	c := w.c
+	if c.sizeTotal >= 0 && readCount != c.sizeTotal {
+		return fmt.Errorf("incorrect upload size %d != %d", readCount, c.sizeTotal)
+	}
+	// finishPut renames the chunks in c.chunks so Abort uses
+	// them from now on
+	c.chunks, c.readCount = chunks, readCount
+	if c.readCount <= maxMetadataSize {
+		c.smallHead = w.head
+	}
+
+	// If the chunks couldn't all be hashed in transit use the
+	// hash of the source if it has one, which may be slow, rather
+	// than reading the chunks back, otherwise store no hash.
+	if c.hasher != nil && w.hashNext != len(chunks) {
+		ht := hash.SHA1
+		if w.f.useMD5 {
+			ht = hash.MD5
+		}
+		c.hasher = nil
+		sum, err := w.src.Hash(ctx, ht)
+		switch {
+		case err != nil || sum == "":
+			fs.Debugf(w.src, "open chunk writer: not storing %v as the chunks weren't uploaded in order", ht)
+		case ht == hash.MD5:
+			c.md5 = sum
+		default:
+			c.sha1 = sum
+		}
+	}
+
+	_, err = w.f.finishPut(ctx, w.src, w.remote, w.xactID, c, w.f.base.Put)
+	if err != nil {
+		return err
+	}
+	w.closed = true
+	return nil
+}
+
+// Abort chunk write
+func (w *chunkWriter) Abort(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	if w.c.chunks == nil {
+		for _, chunk := range w.chunks {
+			w.c.chunks = append(w.c.chunks, chunk)
+		}
+	}
+	w.c.rollback(ctx, nil)
+	w.c.chunks = nil
+	w.chunks = make(map[int]fs.Object)
+	return nil
+}
+
 // Hashes returns the supported hash sets.
 // Chunker advertises a hash type if and only if it can be calculated
 // for files of any size, non-chunked or composite.
@@ -2219,6 +2484,9 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 		limit = o.size - offset
 	}
 
+	if o.f.opt.DownloadConc > 1 && limit > readBlockSize {
+		return o.newParallelReader(ctx, offset, limit, openOptions), nil
+	}
 	return o.newLinearReader(ctx, offset, limit, openOptions)
 }
 
@@ -2327,6 +2595,168 @@ func (r *linearReader) Close() (err error) {
 	return
 }
 
+// readBlock is a block of a composite file being read by parallelReader
+type readBlock struct {
+	chunk fs.Object     // chunk to read from
+	start int64         // offset in chunk
+	size  int64         // number of bytes to read
+	buf   []byte        // data read
+	err   error         // error reading the block
+	done  chan struct{} // closed when the block has been read
+}
+
+// parallelReader reads a range of a composite file in blocks, reading
+// up to DownloadConc blocks ahead in parallel
+type parallelReader struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	options []fs.OpenOption
+	blocks  chan *readBlock // blocks in the order they should be read
+	free    chan []byte     // buffers which can be reused
+	cur     *readBlock      // block being read
+	pos     int             // position in cur
+	err     error
+	wg      sync.WaitGroup
+}
+
+func (o *Object) newParallelReader(ctx context.Context, offset, limit int64, options []fs.OpenOption) io.ReadCloser {
+	concurrency := o.f.opt.DownloadConc
+	ctx, cancel := context.WithCancel(ctx)
+	r := &parallelReader{
+		ctx:     ctx,
+		cancel:  cancel,
+		options: options,
+		blocks:  make(chan *readBlock, concurrency),
+		free:    make(chan []byte, concurrency),
+	}
+	r.wg.Add(1)
+	go r.fetch(o.chunks, offset, limit, concurrency)
+	return r
+}
+
+// fetch starts reading the blocks of the range in order, each in its
+// own goroutine, limited by the number of buffers
+func (r *parallelReader) fetch(chunks []fs.Object, offset, limit int64, concurrency int) {
+	defer r.wg.Done()
+	defer close(r.blocks)
+	bufSize := int64(readBlockSize)
+	if limit < bufSize {
+		bufSize = limit
+	}
+	allocated := 0
+	for _, chunk := range chunks {
+		chunkSize := chunk.Size()
+		if offset >= chunkSize {
+			offset -= chunkSize
+			continue
+		}
+		for ; offset < chunkSize && limit > 0; offset += bufSize {
+			size := chunkSize - offset
+			if size > bufSize {
+				size = bufSize
+			}
+			if size > limit {
+				size = limit
+			}
+			// Wait for a buffer
+			var buf []byte
+			if allocated < concurrency {
+				buf = make([]byte, bufSize)
+				allocated++
+			} else {
+				select {
+				case buf = <-r.free:
+				case <-r.ctx.Done():
+					return
+				}
+			}
+			b := &readBlock{
+				chunk: chunk,
+				start: offset,
+				size:  size,
+				buf:   buf[:size],
+				done:  make(chan struct{}),
+			}
+			r.wg.Add(1)
+			go r.read(b)
+			select {
+			case r.blocks <- b:
+			case <-r.ctx.Done():
+				return
+			}
+			limit -= size
+		}
+		if limit <= 0 {
+			return
+		}
+		offset = 0
+	}
+}
+
+// read reads the block b from its chunk
+func (r *parallelReader) read(b *readBlock) {
+	defer r.wg.Done()
+	defer close(b.done)
+	options := append(append([]fs.OpenOption(nil), r.options...), &fs.RangeOption{Start: b.start, End: b.start + b.size - 1})
+	in, err := b.chunk.Open(r.ctx, options...)
+	if err != nil {
+		b.err = err
+		return
+	}
+	_, err = io.ReadFull(in, b.buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("chunk %s truncated: %w", b.chunk.Remote(), io.ErrUnexpectedEOF)
+	}
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	b.err = err
+}
+
+func (r *parallelReader) Read(p []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	for r.cur == nil || r.pos >= len(r.cur.buf) {
+		if r.cur != nil {
+			r.free <- r.cur.buf[:cap(r.cur.buf)]
+			r.cur = nil
+		}
+		b, ok := <-r.blocks
+		if !ok {
+			r.err = r.ctx.Err()
+			if r.err == nil {
+				r.err = io.EOF
+			}
+			return 0, r.err
+		}
+		<-b.done
+		if b.err != nil {
+			r.err = b.err
+			return 0, r.err
+		}
+		r.cur, r.pos = b, 0
+	}
+	n = copy(p, r.cur.buf[r.pos:])
+	r.pos += n
+	return n, nil
+}
+
+func (r *parallelReader) Close() error {
+	r.cancel()
+	// Drain the blocks so fetch can finish
+	go func() {
+		for range r.blocks {
+		}
+	}()
+	r.wg.Wait()
+	if r.err == nil {
+		r.err = errors.New("read on closed file")
+	}
+	return nil
+}
+
 // ObjectInfo describes a wrapped fs.ObjectInfo for being the source
 type ObjectInfo struct {
 	src     fs.ObjectInfo
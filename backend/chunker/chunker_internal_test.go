@@ -861,6 +861,127 @@ func testChunkerServerSideMove(t *testing.T, f *Fs) {
 	_ = operations.Purge(ctx, f.base, dir)
 }
 
+// Test that chunks are uploaded in parallel by multi-thread copies
+// and read back in parallel
+func testParallelChunks(t *testing.T, f *Fs) {
+	if !f.useMeta {
+		t.Skip("Can't test hashes without metadata")
+	}
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.MultiThreadCutoff = fs.SizeSuffix(fs.Mebi)
+	ci.MultiThreadStreams = 4
+	ci.MultiThreadSet = true
+
+	const size = 2*readBlockSize + 12345
+	contents := random.String(size)
+	srcFs, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+	item := fstest.Item{Path: "parallelfile", ModTime: mtime1}
+	src := fstests.PutTestContents(ctx, t, srcFs, &item, contents, true)
+	md5sum, err := src.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+
+	checkFile := func(t *testing.T, chunkFs *Fs, remote string, wantChunks int, wantSum string) {
+		obj, err := chunkFs.NewObject(ctx, remote)
+		require.NoError(t, err)
+		o := obj.(*Object)
+		assert.Equal(t, wantChunks, len(o.chunks))
+		assert.Equal(t, int64(size), o.Size())
+		sum, err := o.Hash(ctx, hash.MD5)
+		require.NoError(t, err)
+		assert.Equal(t, wantSum, sum)
+		assert.Equal(t, contents, fstests.ReadObject(ctx, t, o, -1))
+		// Ranges across the chunk boundaries
+		for _, r := range []fs.RangeOption{
+			{Start: 0, End: readBlockSize + 10},
+			{Start: 3<<20 - 5, End: 3<<20 + readBlockSize},
+			{Start: size - readBlockSize - 100, End: -1},
+			{Start: 10, End: 20},
+		} {
+			end := r.End + 1
+			if r.End < 0 {
+				end = size
+			}
+			assert.Equal(t, contents[r.Start:end], fstests.ReadObject(ctx, t, o, -1, &r))
+		}
+		// Close part way through
+		in, err := o.Open(ctx)
+		require.NoError(t, err)
+		buf := make([]byte, 100)
+		_, err = io.ReadFull(in, buf)
+		require.NoError(t, err)
+		assert.Equal(t, contents[:100], string(buf))
+		require.NoError(t, in.Close())
+	}
+
+	for _, transactions := range []string{"rename", "norename"} {
+		t.Run(transactions, func(t *testing.T) {
+			chunkFs := deriveFs(ctx, t, f, "parallel-"+transactions, settings{
+				"chunk_size":           "3M",
+				"hash_type":            "md5",
+				"transactions":         transactions,
+				"meta_format":          "simplejson",
+				"download_concurrency": "4",
+			}).(*Fs)
+			assert.Equal(t, 4, chunkFs.opt.DownloadConc)
+			require.NotNil(t, chunkFs.Features().OpenChunkWriter)
+			assert.True(t, chunkFs.Features().ChunkWriterDoesntSeek)
+
+			// Multi-thread copy
+			dst, err := operations.Copy(ctx, chunkFs, nil, item.Path, src)
+			require.NoError(t, err)
+			assert.Equal(t, int64(size), dst.Size())
+			checkFile(t, chunkFs, item.Path, 6, md5sum)
+
+			// Chunks written to chunker from a source with or
+			// without a hash, in order and out of order. The hash
+			// is only calculated by chunker if they are in order.
+			writeChunks := func(remote string, hashes map[hash.Type]string, order []int) fs.ChunkWriterInfo {
+				info := object.NewStaticObjectInfo(remote, mtime1, size, true, hashes, nil)
+				cwInfo, w, err := chunkFs.OpenChunkWriter(ctx, remote, info)
+				require.NoError(t, err)
+				chunkSize := int(cwInfo.ChunkSize)
+				for _, chunkNo := range order {
+					end := (chunkNo + 1) * chunkSize
+					if end > size {
+						end = size
+					}
+					n, err := w.WriteChunk(ctx, chunkNo, strings.NewReader(contents[chunkNo*chunkSize:end]))
+					require.NoError(t, err)
+					assert.Equal(t, int64(end-chunkNo*chunkSize), n)
+				}
+				require.NoError(t, w.Close(ctx))
+				return cwInfo
+			}
+			cwInfo := writeChunks("ordered", nil, []int{0, 1, 2, 3, 4, 5})
+			chunkSize := int(cwInfo.ChunkSize)
+			assert.Equal(t, 3<<20, chunkSize)
+			checkFile(t, chunkFs, "ordered", 6, md5sum)
+			writeChunks("unordered", nil, []int{0, 1, 3, 2, 5, 4})
+			checkFile(t, chunkFs, "unordered", 6, "")
+			writeChunks("unordered-hash", map[hash.Type]string{hash.MD5: md5sum}, []int{0, 1, 3, 2, 5, 4})
+			checkFile(t, chunkFs, "unordered-hash", 6, md5sum)
+
+			// Aborted upload leaves nothing behind
+			info := object.NewStaticObjectInfo("aborted", mtime1, size, true, nil, nil)
+			_, w, err := chunkFs.OpenChunkWriter(ctx, "aborted", info)
+			require.NoError(t, err)
+			_, err = w.WriteChunk(ctx, 1, strings.NewReader(contents[chunkSize:2*chunkSize]))
+			require.NoError(t, err)
+			assert.Error(t, w.Close(ctx), "chunk 0 missing")
+			require.NoError(t, w.Abort(ctx))
+			entries, err := chunkFs.base.List(ctx, "")
+			require.NoError(t, err)
+			for _, entry := range entries {
+				assert.NotContains(t, entry.Remote(), "aborted")
+			}
+
+			require.NoError(t, operations.Purge(ctx, chunkFs.base, ""))
+		})
+	}
+}
+
 // Test that md5all creates metadata even for small files
 func testMD5AllSlow(t *testing.T, f *Fs) {
 	ctx := context.Background()
@@ -934,6 +1055,9 @@ func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("MD5AllSlow", func(t *testing.T) {
 		testMD5AllSlow(t, f)
 	})
+	t.Run("ParallelChunks", func(t *testing.T) {
+		testParallelChunks(t, f)
+	})
 }
 
 var _ fstests.InternalTester = (*Fs)(nil)
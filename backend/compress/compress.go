@@ -53,6 +53,9 @@ const (
 const (
 	Uncompressed = 0
 	Gzip         = 2
+	Zstd         = 3
+	Brotli       = 4
+	LZ4          = 5
 )
 
 var nameRegexp = regexp.MustCompile(`^(.+?)\.([A-Za-z0-9-_]{11})$`)
@@ -60,11 +63,12 @@ var nameRegexp = regexp.MustCompile(`^(.+?)\.([A-Za-z0-9-_]{11})$`)
 // Register with Fs
 func init() {
 	// Build compression mode options.
-	compressionModeOptions := []fs.OptionExample{
-		{ // Default compression mode options {
-			Value: "gzip",
-			Help:  "Standard gzip compression with fastest parameters.",
-		},
+	compressionModeOptions := make([]fs.OptionExample, 0, len(compressionModes))
+	for _, mode := range compressionModes {
+		compressionModeOptions = append(compressionModeOptions, fs.OptionExample{
+			Value: mode.name,
+			Help:  mode.help,
+		})
 	}
 
 	// Register our remote
@@ -97,6 +101,47 @@ are doing.
 Level 0 turns off compression.`,
 			Default:  sgzip.DefaultCompression,
 			Advanced: true,
+		}, {
+			Name: "zstd_level",
+			Help: `Zstandard compression level (1 to 22).
+
+Levels up to 4 are fast, higher levels compress a little better but
+are much slower to compress. Decompression speed is the same at all
+levels.`,
+			Default:  3,
+			Advanced: true,
+		}, {
+			Name: "brotli_level",
+			Help: `Brotli compression level (0 to 11).
+
+Higher levels compress better but are slower. Levels above 9 are very
+slow.`,
+			Default:  5,
+			Advanced: true,
+		}, {
+			Name: "lz4_level",
+			Help: `LZ4 compression level (0 to 9).
+
+Level 0 is the fastest. Levels 1 to 9 compress better but are slower
+to compress. Decompression speed is the same at all levels.`,
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name: "skip_mime_types",
+			Help: `Comma separated list of MIME types not to compress.
+
+Files whose content is detected as one of these types are stored
+uncompressed without trying to compress them. Use "type/*" to match
+all subtypes, for example "video/*".
+
+Other files are compressed if a test compression of the start of
+the file shows it is worth it.
+
+For example to skip already compressed media and archives use
+
+    image/jpeg,image/png,video/*,audio/*,application/zip,application/gzip`,
+			Default:  fs.CommaSepList{},
+			Advanced: true,
 		}, {
 			Name: "ram_cache_limit",
 			Help: `Some remotes don't allow the upload of files with unknown size.
@@ -113,10 +158,14 @@ this limit will be cached on disk.`,
 
 // Options defines the configuration for this backend
 type Options struct {
-	Remote           string        `config:"remote"`
-	CompressionMode  string        `config:"mode"`
-	CompressionLevel int           `config:"level"`
-	RAMCacheLimit    fs.SizeSuffix `config:"ram_cache_limit"`
+	Remote           string          `config:"remote"`
+	CompressionMode  string          `config:"mode"`
+	CompressionLevel int             `config:"level"`
+	ZstdLevel        int             `config:"zstd_level"`
+	BrotliLevel      int             `config:"brotli_level"`
+	LZ4Level         int             `config:"lz4_level"`
+	SkipMimeTypes    fs.CommaSepList `config:"skip_mime_types"`
+	RAMCacheLimit    fs.SizeSuffix   `config:"ram_cache_limit"`
 }
 
 /*** FILESYSTEM FUNCTIONS ***/
@@ -145,6 +194,14 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 	if strings.HasPrefix(remote, name+":") {
 		return nil, errors.New("can't point press remote at itself - check the value of the remote setting")
 	}
+	mode := compressionModeFromName(opt.CompressionMode)
+	if mode == Uncompressed {
+		return nil, fmt.Errorf("unknown compression mode %q", opt.CompressionMode)
+	}
+	err = checkLevels(opt)
+	if err != nil {
+		return nil, err
+	}
 
 	wInfo, wName, wPath, wConfig, err := fs.ConfigFs(remote)
 	if err != nil {
@@ -172,7 +229,7 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 		name: name,
 		root: rpath,
 		opt:  *opt,
-		mode: compressionModeFromName(opt.CompressionMode),
+		mode: mode,
 	}
 	// Correct root if definitely pointing to a file
 	if err == fs.ErrorIsFile {
@@ -213,12 +270,12 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 }
 
 func compressionModeFromName(name string) int {
-	switch name {
-	case "gzip":
-		return Gzip
-	default:
-		return Uncompressed
+	for _, mode := range compressionModes {
+		if mode.name == name {
+			return mode.id
+		}
 	}
+	return Uncompressed
 }
 
 // Converts an int64 to base64
@@ -254,11 +311,14 @@ func processFileName(compressedFileName string) (origFileName string, extension
 	if match == nil || len(match) != 3 {
 		return "", "", 0, errors.New("invalid filename")
 	}
+	if !isCompressedFileExt(extension) {
+		return "", "", 0, errors.New("unknown compressed file extension")
+	}
 	size, err := base64ToInt64(match[2])
 	if err != nil {
 		return "", "", 0, errors.New("could not decode size")
 	}
-	return match[1], gzFileExt, size, nil
+	return match[1], extension, size, nil
 }
 
 // Generates the file name for a metadata file
@@ -283,8 +343,8 @@ func unwrapMetadataFile(filename string) (string, bool) {
 
 // makeDataName generates the file name for a data file with specified compression mode
 func makeDataName(remote string, size int64, mode int) (newRemote string) {
-	if mode != Uncompressed {
-		newRemote = remote + "." + int64ToBase64(size) + gzFileExt
+	if m := findMode(mode); m != nil {
+		newRemote = remote + "." + int64ToBase64(size) + m.ext
 	} else {
 		newRemote = remote + uncompressedFileExt
 	}
@@ -397,7 +457,7 @@ func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 		return nil, fmt.Errorf("error decoding metadata: %w", err)
 	}
 	// Create our Object
-	o, err := f.Fs.NewObject(ctx, makeDataName(remote, meta.CompressionMetadata.Size, meta.Mode))
+	o, err := f.Fs.NewObject(ctx, makeDataName(remote, meta.Size, meta.Mode))
 	if err != nil {
 		return nil, err
 	}
@@ -406,7 +466,9 @@ func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 
 // checkCompressAndType checks if an object is compressible and determines it's mime type
 // returns a multireader with the bytes that were read to determine mime type
-func checkCompressAndType(in io.Reader) (newReader io.Reader, compressible bool, mimeType string, err error) {
+//
+// Objects with a MIME type in the skip list aren't compressible.
+func (f *Fs) checkCompressAndType(in io.Reader) (newReader io.Reader, compressible bool, mimeType string, err error) {
 	in, wrap := accounting.UnWrap(in)
 	buf := make([]byte, heuristicBytes)
 	n, err := in.Read(buf)
@@ -415,9 +477,11 @@ func checkCompressAndType(in io.Reader) (newReader io.Reader, compressible bool,
 		return nil, false, "", err
 	}
 	mime := mimetype.Detect(buf)
-	compressible, err = isCompressible(bytes.NewReader(buf))
-	if err != nil {
-		return nil, false, "", err
+	if !f.skipMimeType(mime.String()) {
+		compressible, err = isCompressible(bytes.NewReader(buf))
+		if err != nil {
+			return nil, false, "", err
+		}
 	}
 	in = io.MultiReader(bytes.NewReader(buf), in)
 	return wrap(in), compressible, mime.String(), nil
@@ -465,7 +529,7 @@ type putFn func(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ..
 
 type compressionResult struct {
 	err  error
-	meta sgzip.GzipMetadata
+	comp compressor
 }
 
 // replicating some of operations.Rcat functionality because we want to support remotes without streaming
@@ -528,17 +592,18 @@ func (f *Fs) putCompress(ctx context.Context, in io.Reader, src fs.ObjectInfo, o
 	pipeReader, pipeWriter := io.Pipe()
 	results := make(chan compressionResult)
 	go func() {
-		gz, err := sgzip.NewWriterLevel(pipeWriter, f.opt.CompressionLevel)
+		comp, err := f.newCompressor(pipeWriter)
 		if err != nil {
-			results <- compressionResult{err: err, meta: sgzip.GzipMetadata{}}
+			_ = pipeWriter.CloseWithError(err)
+			results <- compressionResult{err: err}
 			return
 		}
-		_, err = io.Copy(gz, in)
-		gzErr := gz.Close()
-		if gzErr != nil {
-			fs.Errorf(nil, "Failed to close compress: %v", gzErr)
+		_, err = io.Copy(comp, in)
+		compErr := comp.Close()
+		if compErr != nil {
+			fs.Errorf(nil, "Failed to close compress: %v", compErr)
 			if err == nil {
-				err = gzErr
+				err = compErr
 			}
 		}
 		closeErr := pipeWriter.Close()
@@ -548,7 +613,7 @@ func (f *Fs) putCompress(ctx context.Context, in io.Reader, src fs.ObjectInfo, o
 				err = closeErr
 			}
 		}
-		results <- compressionResult{err: err, meta: gz.MetaData()}
+		results <- compressionResult{err: err, comp: comp}
 	}()
 	wrappedIn := wrap(bufio.NewReaderSize(pipeReader, bufferSize)) // Probably no longer needed as sgzip has it's own buffering
 
@@ -595,7 +660,8 @@ func (f *Fs) putCompress(ctx context.Context, in io.Reader, src fs.ObjectInfo, o
 	}
 
 	// Generate metadata
-	meta := newMetadata(result.meta.Size, f.mode, result.meta, hex.EncodeToString(metaHasher.Sum(nil)), mimeType)
+	meta := newMetadata(0, f.mode, sgzip.GzipMetadata{}, hex.EncodeToString(metaHasher.Sum(nil)), mimeType)
+	result.comp.setMetadata(meta)
 
 	// Check the hashes of the compressed data if we were comparing them
 	if ht != hash.None && hasher != nil {
@@ -720,7 +786,7 @@ func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options .
 	o, err := f.NewObject(ctx, src.Remote())
 	if err == fs.ErrorObjectNotFound {
 		// Get our file compressibility
-		in, compressible, mimeType, err := checkCompressAndType(in)
+		in, compressible, mimeType, err := f.checkCompressAndType(in)
 		if err != nil {
 			return nil, err
 		}
@@ -740,7 +806,7 @@ func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, opt
 	}
 	found := err == nil
 
-	in, compressible, mimeType, err := checkCompressAndType(in)
+	in, compressible, mimeType, err := f.checkCompressAndType(in)
 	if err != nil {
 		return nil, err
 	}
@@ -1134,7 +1200,7 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 		return o.mo, o.mo.Update(ctx, in, src, options...)
 	}
 
-	in, compressible, mimeType, err := checkCompressAndType(in)
+	in, compressible, mimeType, err := o.f.checkCompressAndType(in)
 	if err != nil {
 		return err
 	}
@@ -1365,13 +1431,9 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 	// Get a chunkedreader for the wrapped object
 	chunkedReader := chunkedreader.New(ctx, o.Object, initialChunkSize, maxChunkSize, chunkStreams)
 	// Get file handle
-	var file io.Reader
-	if offset != 0 {
-		file, err = sgzip.NewReaderAt(chunkedReader, &o.meta.CompressionMetadata, offset)
-	} else {
-		file, err = sgzip.NewReader(chunkedReader)
-	}
+	file, done, err := o.newDecompressor(chunkedReader, offset)
 	if err != nil {
+		_ = chunkedReader.Close()
 		return nil, err
 	}
 
@@ -1382,7 +1444,10 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 		fileReader = file
 	}
 	// Return a ReadCloser
-	return ReadCloserWrapper{Reader: fileReader, Closer: chunkedReader}, nil
+	return ReadCloserWrapper{Reader: fileReader, Closer: closerFn(func() error {
+		_ = done.Close()
+		return chunkedReader.Close()
+	})}, nil
 }
 
 // ObjectInfo describes a wrapped fs.ObjectInfo for being the source
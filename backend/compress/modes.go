@@ -0,0 +1,408 @@
+package compress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/buengese/sgzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+
+	"github.com/rclone/rclone/fs"
+)
+
+const (
+	zstdFileExt   = ".zst"
+	brotliFileExt = ".br"
+	lz4FileExt    = ".lz4"
+
+	// Size of the uncompressed data in each zstd frame
+	zstdFrameSize = 1024 * 1024
+
+	// Magic numbers for the zstd seekable format seek table
+	zstdSkippableMagic = 0x184D2A5E
+	zstdSeekableMagic  = 0x8F92EAB1
+)
+
+// compressionMode describes one of the compression modes
+type compressionMode struct {
+	id   int    // Id stored in the metadata
+	name string // Name in the config
+	ext  string // Extension of data files
+	help string // Help for the config
+}
+
+// compressionModes are the compression modes in the order shown to the user
+var compressionModes = []compressionMode{
+	{id: Gzip, name: "gzip", ext: gzFileExt, help: "Standard gzip compression with fastest parameters."},
+	{id: Zstd, name: "zstd", ext: zstdFileExt, help: "Zstandard compression in the seekable format.\nGood compression and fast, with fast seeking."},
+	{id: Brotli, name: "brotli", ext: brotliFileExt, help: "Brotli compression.\nBest compression for text but slower, and slow to seek."},
+	{id: LZ4, name: "lz4", ext: lz4FileExt, help: "LZ4 compression.\nFastest, but least compression, and slow to seek."},
+}
+
+// findMode returns the compression mode with id or nil if not found
+func findMode(id int) *compressionMode {
+	for i := range compressionModes {
+		if compressionModes[i].id == id {
+			return &compressionModes[i]
+		}
+	}
+	return nil
+}
+
+// isCompressedFileExt returns true if ext is the extension of a
+// compressed data file
+func isCompressedFileExt(ext string) bool {
+	for i := range compressionModes {
+		if compressionModes[i].ext == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLevels checks the compression levels in opt are valid
+func checkLevels(opt *Options) error {
+	if opt.ZstdLevel < 1 || opt.ZstdLevel > 22 {
+		return fmt.Errorf("zstd_level must be between 1 and 22, got %d", opt.ZstdLevel)
+	}
+	if opt.BrotliLevel < brotli.BestSpeed || opt.BrotliLevel > brotli.BestCompression {
+		return fmt.Errorf("brotli_level must be between %d and %d, got %d", brotli.BestSpeed, brotli.BestCompression, opt.BrotliLevel)
+	}
+	if opt.LZ4Level < 0 || opt.LZ4Level > 9 {
+		return fmt.Errorf("lz4_level must be between 0 and 9, got %d", opt.LZ4Level)
+	}
+	return nil
+}
+
+// skipMimeType returns true if files of mimeType shouldn't be compressed
+func (f *Fs) skipMimeType(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	for _, skip := range f.opt.SkipMimeTypes {
+		skip = strings.ToLower(strings.TrimSpace(skip))
+		if prefix, ok := strings.CutSuffix(skip, "/*"); ok {
+			if strings.HasPrefix(mimeType, prefix+"/") {
+				return true
+			}
+		} else if mimeType == skip {
+			return true
+		}
+	}
+	return false
+}
+
+// compressor compresses data and records how it was compressed in
+// the metadata
+type compressor interface {
+	io.WriteCloser
+	// setMetadata records the compression in meta after Close
+	setMetadata(meta *ObjectMetadata)
+}
+
+// newCompressor makes a compressor writing to w for the mode of f
+func (f *Fs) newCompressor(w io.Writer) (compressor, error) {
+	switch f.mode {
+	case Gzip:
+		gz, err := sgzip.NewWriterLevel(w, f.opt.CompressionLevel)
+		if err != nil {
+			return nil, err
+		}
+		return gzipCompressor{gz}, nil
+	case Zstd:
+		return newZstdCompressor(w, f.opt.ZstdLevel)
+	case Brotli:
+		return &streamCompressor{WriteCloser: brotli.NewWriterLevel(w, f.opt.BrotliLevel)}, nil
+	case LZ4:
+		lw := lz4.NewWriter(w)
+		level := lz4.Fast
+		if f.opt.LZ4Level > 0 {
+			level = lz4.CompressionLevel(1 << (8 + f.opt.LZ4Level))
+		}
+		err := lw.Apply(lz4.CompressionLevelOption(level), lz4.ConcurrencyOption(1))
+		if err != nil {
+			return nil, err
+		}
+		return &streamCompressor{WriteCloser: lw}, nil
+	}
+	return nil, fmt.Errorf("unknown compression mode %d", f.mode)
+}
+
+// gzipCompressor compresses with sgzip which records an index to
+// seek with
+type gzipCompressor struct {
+	*sgzip.Writer
+}
+
+// setMetadata records the compression in meta after Close
+func (c gzipCompressor) setMetadata(meta *ObjectMetadata) {
+	meta.CompressionMetadata = c.MetaData()
+	meta.Size = meta.CompressionMetadata.Size
+}
+
+// streamCompressor compresses with a stream which can't seek
+type streamCompressor struct {
+	io.WriteCloser
+	size int64
+}
+
+// Write compresses p
+func (c *streamCompressor) Write(p []byte) (n int, err error) {
+	n, err = c.WriteCloser.Write(p)
+	c.size += int64(n)
+	return n, err
+}
+
+// setMetadata records the compression in meta after Close
+func (c *streamCompressor) setMetadata(meta *ObjectMetadata) {
+	meta.Size = c.size
+}
+
+// zstdCompressor compresses into independent zstd frames of
+// zstdFrameSize uncompressed bytes followed by a seek table in the
+// zstd seekable format.
+//
+// The frames make a normal zstd stream so can be read by any zstd
+// decoder, but reads can start at any frame.
+type zstdCompressor struct {
+	w      io.Writer
+	enc    *zstd.Encoder
+	buf    []byte      // uncompressed data for the current frame
+	out    []byte      // compressed data buffer
+	frames []zstdFrame // sizes of the frames
+	size   int64       // uncompressed size
+}
+
+// zstdFrame is an entry in the seek table of a seekable zstd file
+type zstdFrame struct {
+	compressed   int64
+	uncompressed int64
+}
+
+// newZstdCompressor makes a zstdCompressor at level writing to w
+func newZstdCompressor(w io.Writer, level int) (*zstdCompressor, error) {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdCompressor{
+		w:   w,
+		enc: enc,
+		buf: make([]byte, 0, zstdFrameSize),
+	}, nil
+}
+
+// flush writes the buffered data as a frame
+func (c *zstdCompressor) flush() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	c.out = c.enc.EncodeAll(c.buf, c.out[:0])
+	_, err := c.w.Write(c.out)
+	if err != nil {
+		return err
+	}
+	c.frames = append(c.frames, zstdFrame{compressed: int64(len(c.out)), uncompressed: int64(len(c.buf))})
+	c.buf = c.buf[:0]
+	return nil
+}
+
+// Write compresses p
+func (c *zstdCompressor) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := p
+		if space := zstdFrameSize - len(c.buf); len(chunk) > space {
+			chunk = chunk[:space]
+		}
+		c.buf = append(c.buf, chunk...)
+		n += len(chunk)
+		c.size += int64(len(chunk))
+		p = p[len(chunk):]
+		if len(c.buf) == zstdFrameSize {
+			if err = c.flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close writes the last frame and the seek table
+func (c *zstdCompressor) Close() error {
+	defer func() {
+		_ = c.enc.Close()
+	}()
+	err := c.flush()
+	if err != nil {
+		return err
+	}
+	_, err = c.w.Write(c.seekTable())
+	return err
+}
+
+// The footer of the seek table is the number of frames, the
+// descriptor and the seekable magic number
+const zstdSeekFooterSize = 9
+
+// seekTable returns the seek table in the zstd seekable format
+//
+// This is a skippable frame which zstd decoders ignore.
+func (c *zstdCompressor) seekTable() []byte {
+	n := len(c.frames)
+	table := make([]byte, 8, 8+8*n+zstdSeekFooterSize)
+	binary.LittleEndian.PutUint32(table[0:], zstdSkippableMagic)
+	binary.LittleEndian.PutUint32(table[4:], uint32(8*n+zstdSeekFooterSize))
+	for _, frame := range c.frames {
+		table = binary.LittleEndian.AppendUint32(table, uint32(frame.compressed))
+		table = binary.LittleEndian.AppendUint32(table, uint32(frame.uncompressed))
+	}
+	table = binary.LittleEndian.AppendUint32(table, uint32(n))
+	table = append(table, 0) // descriptor - no checksums
+	table = binary.LittleEndian.AppendUint32(table, zstdSeekableMagic)
+	return table
+}
+
+// setMetadata records the compression in meta after Close
+func (c *zstdCompressor) setMetadata(meta *ObjectMetadata) {
+	meta.Size = c.size
+}
+
+// errNoZstdSeekTable is returned if a zstd file doesn't end with a seek table
+var errNoZstdSeekTable = errors.New("no zstd seek table")
+
+// readZstdSeekTable reads the seek table from the end of the zstd
+// seekable file in
+func readZstdSeekTable(in io.ReadSeeker) ([]zstdFrame, error) {
+	end, err := in.Seek(-zstdSeekFooterSize, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	var footer [zstdSeekFooterSize]byte
+	_, err = io.ReadFull(in, footer[:])
+	if err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != zstdSeekableMagic {
+		return nil, errNoZstdSeekTable
+	}
+	n := int64(binary.LittleEndian.Uint32(footer[0:]))
+	entrySize := int64(8)
+	if footer[4]&0x80 != 0 {
+		entrySize += 4 // entries have a checksum
+	}
+	if n*entrySize > end {
+		return nil, errNoZstdSeekTable
+	}
+	_, err = in.Seek(end-n*entrySize, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]byte, n*entrySize)
+	_, err = io.ReadFull(in, entries)
+	if err != nil {
+		return nil, err
+	}
+	frames := make([]zstdFrame, n)
+	for i := range frames {
+		entry := entries[int64(i)*entrySize:]
+		frames[i].compressed = int64(binary.LittleEndian.Uint32(entry[0:]))
+		frames[i].uncompressed = int64(binary.LittleEndian.Uint32(entry[4:]))
+	}
+	return frames, nil
+}
+
+// seekZstd seeks in to the start of the frame containing offset using
+// the seek table returning the offset remaining from there
+func seekZstd(in io.ReadSeeker, offset int64) (int64, error) {
+	frames, err := readZstdSeekTable(in)
+	if err != nil {
+		return 0, err
+	}
+	var start int64
+	for _, frame := range frames {
+		if offset < frame.uncompressed {
+			break
+		}
+		offset -= frame.uncompressed
+		start += frame.compressed
+	}
+	_, err = in.Seek(start, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+// closerFn is a function which implements io.Closer
+type closerFn func() error
+
+// Close calls the function
+func (fn closerFn) Close() error {
+	return fn()
+}
+
+// newDecompressor returns a reader decompressing in from offset
+//
+// in is the compressed data positioned at the start and the
+// returned closer should be called when finished with the reader.
+func (o *Object) newDecompressor(in io.ReadSeeker, offset int64) (io.Reader, io.Closer, error) {
+	noClose := closerFn(func() error { return nil })
+	var (
+		r    io.Reader
+		done = noClose
+	)
+	switch o.meta.Mode {
+	case Gzip:
+		var err error
+		if offset != 0 {
+			r, err = sgzip.NewReaderAt(in, &o.meta.CompressionMetadata, offset)
+		} else {
+			r, err = sgzip.NewReader(in)
+		}
+		return r, noClose, err
+	case Zstd:
+		// Start from the frame containing offset if we can
+		if offset > 0 {
+			frameOffset, err := seekZstd(in, offset)
+			if err == nil {
+				offset = frameOffset
+			} else {
+				fs.Debugf(o, "Can't use zstd seek table: %v", err)
+				if _, err := in.Seek(0, io.SeekStart); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+		dec, err := zstd.NewReader(in, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, err
+		}
+		r = dec
+		done = closerFn(func() error {
+			dec.Close()
+			return nil
+		})
+	case Brotli:
+		r = brotli.NewReader(in)
+	case LZ4:
+		r = lz4.NewReader(in)
+	default:
+		return nil, nil, fmt.Errorf("unknown compression mode %d", o.meta.Mode)
+	}
+	// Skip to the offset if we couldn't seek there
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, r, offset); err != nil {
+			_ = done.Close()
+			if err == io.EOF {
+				err = fmt.Errorf("seek beyond end of %s compressed file", findMode(o.meta.Mode).name)
+			}
+			return nil, nil, err
+		}
+		fs.Debugf(o, "Skipped %d bytes to seek in compressed stream", offset)
+	}
+	return r, done, nil
+}
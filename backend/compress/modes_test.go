@@ -0,0 +1,132 @@
+package compress
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipMimeType(t *testing.T) {
+	f := &Fs{opt: Options{SkipMimeTypes: fs.CommaSepList{"image/jpeg", "video/*", " Application/PDF "}}}
+	for _, test := range []struct {
+		mimeType string
+		want     bool
+	}{
+		{"image/jpeg", true},
+		{"image/png", false},
+		{"video/mp4", true},
+		{"video", false},
+		{"application/pdf", true},
+		{"text/plain; charset=utf-8", false},
+		{"IMAGE/JPEG; q=1", true},
+	} {
+		assert.Equal(t, test.want, f.skipMimeType(test.mimeType), test.mimeType)
+	}
+}
+
+func TestCompressionModes(t *testing.T) {
+	for _, mode := range compressionModes {
+		assert.Equal(t, mode.id, compressionModeFromName(mode.name))
+		assert.True(t, isCompressedFileExt(mode.ext))
+		name, ext, size, err := processFileName(makeDataName("potato", 12345, mode.id))
+		require.NoError(t, err)
+		assert.Equal(t, "potato", name)
+		assert.Equal(t, mode.ext, ext)
+		assert.Equal(t, int64(12345), size)
+	}
+	assert.Equal(t, Uncompressed, compressionModeFromName("potato"))
+	assert.Nil(t, findMode(Uncompressed))
+}
+
+// compress compresses data with the mode of f returning the
+// compressed data and the metadata
+func compress(t *testing.T, f *Fs, data []byte) ([]byte, *ObjectMetadata) {
+	var buf bytes.Buffer
+	comp, err := f.newCompressor(&buf)
+	require.NoError(t, err)
+	_, err = comp.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, comp.Close())
+	meta := &ObjectMetadata{Mode: f.mode}
+	comp.setMetadata(meta)
+	assert.Equal(t, int64(len(data)), meta.Size)
+	return buf.Bytes(), meta
+}
+
+func TestCompressorsSeek(t *testing.T) {
+	data := make([]byte, 3*zstdFrameSize+12345)
+	r := rand.New(rand.NewSource(1))
+	for i := range data {
+		data[i] = byte('a' + r.Intn(4))
+	}
+	for _, mode := range compressionModes {
+		t.Run(mode.name, func(t *testing.T) {
+			f := &Fs{mode: mode.id, opt: Options{CompressionLevel: -1, ZstdLevel: 3, BrotliLevel: 1, LZ4Level: 0}}
+			compressed, meta := compress(t, f, data)
+			o := &Object{meta: meta}
+			for _, offset := range []int64{0, 1, zstdFrameSize - 1, zstdFrameSize, 2*zstdFrameSize + 17, int64(len(data))} {
+				rd, done, err := o.newDecompressor(bytes.NewReader(compressed), offset)
+				require.NoError(t, err)
+				got, err := io.ReadAll(io.LimitReader(rd, 1000))
+				require.NoError(t, err)
+				end := min(offset+1000, int64(len(data)))
+				assert.Equal(t, data[offset:end], got, "offset %d", offset)
+				require.NoError(t, done.Close())
+			}
+		})
+	}
+}
+
+func TestZstdSeekable(t *testing.T) {
+	data := bytes.Repeat([]byte("potato"), zstdFrameSize/3)
+	f := &Fs{mode: Zstd, opt: Options{ZstdLevel: 3}}
+	compressed, _ := compress(t, f, data)
+
+	// Any zstd decoder can read the whole stream
+	dec, err := zstd.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	got, err := io.ReadAll(dec)
+	dec.Close()
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	// Check the seek table at the end
+	footer := compressed[len(compressed)-9:]
+	assert.Equal(t, uint32(zstdSeekableMagic), binary.LittleEndian.Uint32(footer[5:]))
+	assert.Equal(t, uint32(2), binary.LittleEndian.Uint32(footer))
+	table := compressed[len(compressed)-9-16-8:]
+	assert.Equal(t, uint32(zstdSkippableMagic), binary.LittleEndian.Uint32(table))
+	assert.Equal(t, uint32(16+9), binary.LittleEndian.Uint32(table[4:]))
+	frames, err := readZstdSeekTable(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	require.Len(t, frames, 2)
+	var compressedTotal, total int64
+	for i, frame := range frames {
+		entry := table[8+8*i:]
+		assert.Equal(t, uint32(frame.compressed), binary.LittleEndian.Uint32(entry))
+		assert.Equal(t, uint32(frame.uncompressed), binary.LittleEndian.Uint32(entry[4:]))
+		compressedTotal += frame.compressed
+		total += frame.uncompressed
+	}
+	assert.Equal(t, int64(len(compressed)-len(table)), compressedTotal)
+	assert.Equal(t, int64(len(data)), total)
+
+	// Seeking still works without the seek table
+	_, err = readZstdSeekTable(bytes.NewReader(compressed[:len(table)]))
+	assert.Equal(t, errNoZstdSeekTable, err)
+	noTable := compressed[:len(compressed)-len(table)]
+	o := &Object{meta: &ObjectMetadata{Mode: Zstd}}
+	rd, done, err := o.newDecompressor(bytes.NewReader(noTable), zstdFrameSize+1)
+	require.NoError(t, err)
+	got, err = io.ReadAll(rd)
+	require.NoError(t, err)
+	require.NoError(t, done.Close())
+	assert.Equal(t, data[zstdFrameSize+1:], got)
+}
@@ -5,7 +5,9 @@ import (
 	"context"
 	"crypto/aes"
 	gocipher "crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base32"
 	"encoding/base64"
 	"errors"
@@ -84,6 +86,7 @@ const (
 	NameEncryptionOff NameEncryptionMode = iota
 	NameEncryptionStandard
 	NameEncryptionObfuscated
+	NameEncryptionSIV
 )
 
 // NewNameEncryptionMode turns a string into a NameEncryptionMode
@@ -96,6 +99,8 @@ func NewNameEncryptionMode(s string) (mode NameEncryptionMode, err error) {
 		mode = NameEncryptionStandard
 	case "obfuscate":
 		mode = NameEncryptionObfuscated
+	case "siv":
+		mode = NameEncryptionSIV
 	default:
 		err = fmt.Errorf("unknown file name encryption mode %q", s)
 	}
@@ -111,6 +116,8 @@ func (mode NameEncryptionMode) String() (out string) {
 		out = "standard"
 	case NameEncryptionObfuscated:
 		out = "obfuscate"
+	case NameEncryptionSIV:
+		out = "siv"
 	default:
 		out = fmt.Sprintf("Unknown mode #%d", mode)
 	}
@@ -174,6 +181,8 @@ type Cipher struct {
 	nameKey         [32]byte                  // 16,24 or 32 bytes
 	nameTweak       [nameCipherBlockSize]byte // used to tweak the name crypto
 	block           gocipher.Block
+	siv             *siv // name cipher for NameEncryptionSIV
+	namePadding     int  // pad names to a multiple of this for NameEncryptionSIV
 	mode            NameEncryptionMode
 	fileNameEnc     fileNameEncoding
 	buffers         sync.Pool // encrypt/decrypt buffers
@@ -181,6 +190,8 @@ type Cipher struct {
 	dirNameEncrypt  bool
 	passBadBlocks   bool // if set passed bad blocks as zeroed blocks
 	encryptedSuffix string
+	envelope        bool       // if set write files in the envelope format
+	keys            masterKeys // master keys for the envelope format
 }
 
 // newCipher initialises the cipher.  If salt is "" then it uses a built in salt val
@@ -248,9 +259,31 @@ func (c *Cipher) Key(password, salt string) (err error) {
 	copy(c.nameTweak[:], key[len(c.dataKey)+len(c.nameKey):])
 	// Key the name cipher
 	c.block, err = aes.NewCipher(c.nameKey[:])
+	if err != nil {
+		return err
+	}
+	// Key the SIV name cipher with keys derived from the name key
+	c.siv, err = newSIV(deriveKey(&c.nameKey, "rclone crypt siv mac"), deriveKey(&c.nameKey, "rclone crypt siv ctr"))
 	return err
 }
 
+// deriveKey derives a 32 byte key for purpose from key
+func deriveKey(key *[32]byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key[:])
+	_, _ = mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// setNamePadding sets the multiple the names are padded to in
+// NameEncryptionSIV mode
+func (c *Cipher) setNamePadding(padding int) error {
+	if padding < 0 {
+		return fmt.Errorf("filename_padding must be positive, got %d", padding)
+	}
+	c.namePadding = padding
+	return nil
+}
+
 // getBlock gets a block from the pool of size blockSize
 func (c *Cipher) getBlock() *[blockSize]byte {
 	return c.buffers.Get().(*[blockSize]byte)
@@ -311,6 +344,58 @@ func (c *Cipher) decryptSegment(ciphertext string) (string, error) {
 	return string(plaintext), err
 }
 
+// encryptSegmentSIV encrypts a path segment with AES-SIV
+//
+// The plaintext is padded with 0x80 then 0x00 bytes up to a multiple
+// of namePadding so the length of the encrypted name only shows the
+// length of the name to within namePadding bytes.
+//
+// The result is the 16 byte synthetic IV followed by the encrypted
+// padded name. Decrypting will fail if this is changed in any way.
+func (c *Cipher) encryptSegmentSIV(plaintext string) string {
+	if plaintext == "" {
+		return ""
+	}
+	padded := append([]byte(plaintext), 0x80)
+	if c.namePadding > 1 {
+		if rem := len(padded) % c.namePadding; rem != 0 {
+			padded = append(padded, make([]byte, c.namePadding-rem)...)
+		}
+	}
+	return c.fileNameEnc.EncodeToString(c.siv.seal(nil, padded))
+}
+
+// decryptSegmentSIV decrypts a path segment encrypted with encryptSegmentSIV
+//
+// This works whatever namePadding was used to encrypt it.
+func (c *Cipher) decryptSegmentSIV(ciphertext string) (string, error) {
+	if ciphertext == "" {
+		return "", nil
+	}
+	rawCiphertext, err := c.fileNameEnc.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(rawCiphertext) <= sivSize {
+		return "", ErrorTooShortAfterDecode
+	}
+	if len(rawCiphertext) > 2048+sivSize {
+		return "", ErrorTooLongAfterDecode
+	}
+	padded, err := c.siv.open(nil, rawCiphertext)
+	if err != nil {
+		return "", err
+	}
+	end := len(padded) - 1
+	for end >= 0 && padded[end] == 0 {
+		end--
+	}
+	if end < 0 || padded[end] != 0x80 {
+		return "", ErrorSIVBadPadding
+	}
+	return string(padded[:end]), nil
+}
+
 // Simple obfuscation routines
 func (c *Cipher) obfuscateSegment(plaintext string) string {
 	if plaintext == "" {
@@ -509,9 +594,12 @@ func (c *Cipher) encryptFileName(in string) string {
 			}
 		}
 
-		if c.mode == NameEncryptionStandard {
+		switch c.mode {
+		case NameEncryptionStandard:
 			segments[i] = c.encryptSegment(segments[i])
-		} else {
+		case NameEncryptionSIV:
+			segments[i] = c.encryptSegmentSIV(segments[i])
+		default:
 			segments[i] = c.obfuscateSegment(segments[i])
 		}
 
@@ -565,9 +653,12 @@ func (c *Cipher) decryptFileName(in string) (string, error) {
 			}
 		}
 
-		if c.mode == NameEncryptionStandard {
+		switch c.mode {
+		case NameEncryptionStandard:
 			segments[i], err = c.decryptSegment(segments[i])
-		} else {
+		case NameEncryptionSIV:
+			segments[i], err = c.decryptSegmentSIV(segments[i])
+		default:
 			segments[i], err = c.deobfuscateSegment(segments[i])
 		}
 
@@ -683,6 +774,8 @@ type encrypter struct {
 	in       io.Reader
 	c        *Cipher
 	nonce    nonce
+	key      *[32]byte // key to encrypt the data with
+	env      *envelope // envelope if using the envelope format
 	buf      *[blockSize]byte
 	readBuf  *[blockSize]byte
 	bufIndex int
@@ -691,14 +784,40 @@ type encrypter struct {
 }
 
 // newEncrypter creates a new file handle encrypting on the fly
+//
+// If the cipher is using the envelope format then a new data key is
+// made for the file.
 func (c *Cipher) newEncrypter(in io.Reader, nonce *nonce) (*encrypter, error) {
+	var env *envelope
+	if c.envelope {
+		var err error
+		env, err = c.newEnvelope()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.newEncrypterEnvelope(in, nonce, env)
+}
+
+// newEncrypterEnvelope creates a new file handle encrypting on the fly
+//
+// If env is nil the file is written in the original format
+// encrypted with the data key, otherwise it is written in the
+// envelope format encrypted with the key in env.
+func (c *Cipher) newEncrypterEnvelope(in io.Reader, nonce *nonce, env *envelope) (*encrypter, error) {
 	fh := &encrypter{
 		in:      in,
 		c:       c,
+		key:     &c.dataKey,
+		env:     env,
 		buf:     c.getBlock(),
 		readBuf: c.getBlock(),
 		bufSize: fileHeaderSize,
 	}
+	if env != nil {
+		fh.key = &env.key
+		fh.bufSize = envelopeHeaderSize
+	}
 	// Initialise nonce
 	if nonce != nil {
 		fh.nonce = *nonce
@@ -709,7 +828,13 @@ func (c *Cipher) newEncrypter(in io.Reader, nonce *nonce) (*encrypter, error) {
 		}
 	}
 	// Copy magic into buffer
-	copy((*fh.buf)[:], fileMagicBytes)
+	if env != nil {
+		copy((*fh.buf)[:], envelopeMagicBytes)
+		// Copy wrapped keys into buffer
+		copy((*fh.buf)[fileHeaderSize:], env.slots[:])
+	} else {
+		copy((*fh.buf)[:], fileMagicBytes)
+	}
 	// Copy nonce into buffer
 	copy((*fh.buf)[fileMagicSize:], fh.nonce[:])
 	return fh, nil
@@ -734,7 +859,7 @@ func (fh *encrypter) Read(p []byte) (n int, err error) {
 		// possibly err != nil here, but we will process the
 		// data and the next call to ReadFill will return 0, err
 		// Encrypt the block using the nonce
-		secretbox.Seal((*fh.buf)[:0], readBuf[:n], fh.nonce.pointer(), &fh.c.dataKey)
+		secretbox.Seal((*fh.buf)[:0], readBuf[:n], fh.nonce.pointer(), fh.key)
 		fh.bufIndex = 0
 		fh.bufSize = blockHeaderSize + n
 		fh.nonce.increment()
@@ -779,6 +904,9 @@ type decrypter struct {
 	rc           io.ReadCloser
 	nonce        nonce
 	initialNonce nonce
+	key          *[32]byte // key to decrypt the data with
+	env          *envelope // envelope if using the envelope format
+	headerSize   int64     // size of the file header
 	c            *Cipher
 	buf          *[blockSize]byte
 	readBuf      *[blockSize]byte
@@ -792,11 +920,13 @@ type decrypter struct {
 // newDecrypter creates a new file handle decrypting on the fly
 func (c *Cipher) newDecrypter(rc io.ReadCloser) (*decrypter, error) {
 	fh := &decrypter{
-		rc:      rc,
-		c:       c,
-		buf:     c.getBlock(),
-		readBuf: c.getBlock(),
-		limit:   -1,
+		rc:         rc,
+		c:          c,
+		buf:        c.getBlock(),
+		readBuf:    c.getBlock(),
+		limit:      -1,
+		key:        &c.dataKey,
+		headerSize: int64(fileHeaderSize),
 	}
 	// Read file header (magic + nonce)
 	readBuf := (*fh.readBuf)[:fileHeaderSize]
@@ -808,7 +938,22 @@ func (c *Cipher) newDecrypter(rc io.ReadCloser) (*decrypter, error) {
 		return nil, fh.finishAndClose(err)
 	}
 	// check the magic
-	if !bytes.Equal(readBuf[:fileMagicSize], fileMagicBytes) {
+	if bytes.Equal(readBuf[:fileMagicSize], envelopeMagicBytes) {
+		// read the wrapped keys and unwrap the data key
+		fh.env = new(envelope)
+		n, err = readers.ReadFill(fh.rc, fh.env.slots[:])
+		if n < envelopeSlotsSize && err == io.EOF {
+			return nil, fh.finishAndClose(ErrorEncryptedFileTooShort)
+		} else if err != io.EOF && err != nil {
+			return nil, fh.finishAndClose(err)
+		}
+		fh.env.key, err = c.keys.unwrap(fh.env.slots[:])
+		if err != nil {
+			return nil, fh.finishAndClose(err)
+		}
+		fh.key = &fh.env.key
+		fh.headerSize = int64(envelopeHeaderSize)
+	} else if !bytes.Equal(readBuf[:fileMagicSize], fileMagicBytes) {
 		return nil, fh.finishAndClose(ErrorEncryptedBadMagic)
 	}
 	// retrieve the nonce
@@ -822,18 +967,21 @@ func (c *Cipher) newDecrypterSeek(ctx context.Context, open OpenRangeSeek, offse
 	var rc io.ReadCloser
 	doRangeSeek := false
 	setLimit := false
+	headerSize := c.headerSize()
 	// Open initially with no seek
 	if offset == 0 && limit < 0 {
 		// If no offset or limit then open whole file
 		rc, err = open(ctx, 0, -1)
 	} else if offset == 0 {
 		// If no offset open the header + limit worth of the file
-		_, underlyingLimit, _, _ := calculateUnderlying(offset, limit)
-		rc, err = open(ctx, 0, int64(fileHeaderSize)+underlyingLimit)
+		// assuming the header is the format we write
+		_, underlyingLimit, _, _ := calculateUnderlyingHeader(headerSize, offset, limit)
+		rc, err = open(ctx, 0, headerSize+underlyingLimit)
 		setLimit = true
 	} else {
-		// Otherwise just read the header to start with
-		rc, err = open(ctx, 0, int64(fileHeaderSize))
+		// Otherwise just read the header to start with, which
+		// may be in the envelope format
+		rc, err = open(ctx, 0, int64(envelopeHeaderSize))
 		doRangeSeek = true
 	}
 	if err != nil {
@@ -845,6 +993,11 @@ func (c *Cipher) newDecrypterSeek(ctx context.Context, open OpenRangeSeek, offse
 		return nil, err
 	}
 	fh.open = open // will be called by fh.RangeSeek
+	if setLimit && fh.headerSize != headerSize {
+		// The header wasn't the format we write so the limit
+		// was wrong - seek to reopen with the right one
+		setLimit, doRangeSeek = false, true
+	}
 	if doRangeSeek {
 		_, err = fh.RangeSeek(ctx, offset, io.SeekStart, limit)
 		if err != nil {
@@ -877,7 +1030,7 @@ func (fh *decrypter) fillBuffer() (err error) {
 		return ErrorEncryptedFileBadHeader
 	}
 	// Decrypt the block using the nonce
-	_, ok := secretbox.Open((*fh.buf)[:0], (*readBuf)[:n], fh.nonce.pointer(), &fh.c.dataKey)
+	_, ok := secretbox.Open((*fh.buf)[:0], (*readBuf)[:n], fh.nonce.pointer(), fh.key)
 	if !ok {
 		if err != nil && err != io.EOF {
 			return err // return pending error as it is likely more accurate
@@ -933,11 +1086,17 @@ func (fh *decrypter) Read(p []byte) (n int, err error) {
 // block and number of blocks this is from the start so the nonce can
 // be incremented.
 func calculateUnderlying(offset, limit int64) (underlyingOffset, underlyingLimit, discard, blocks int64) {
+	return calculateUnderlyingHeader(int64(fileHeaderSize), offset, limit)
+}
+
+// calculateUnderlyingHeader is as calculateUnderlying for a file with
+// a header of headerSize bytes
+func calculateUnderlyingHeader(headerSize, offset, limit int64) (underlyingOffset, underlyingLimit, discard, blocks int64) {
 	// blocks we need to seek, plus bytes we need to discard
 	blocks, discard = offset/blockDataSize, offset%blockDataSize
 
 	// Offset in underlying stream we need to seek
-	underlyingOffset = int64(fileHeaderSize) + blocks*(blockHeaderSize+blockDataSize)
+	underlyingOffset = headerSize + blocks*(blockHeaderSize+blockDataSize)
 
 	// work out how many blocks we need to read
 	underlyingLimit = int64(-1)
@@ -987,7 +1146,7 @@ func (fh *decrypter) RangeSeek(ctx context.Context, offset int64, whence int, li
 		return 0, fh.err
 	}
 
-	underlyingOffset, underlyingLimit, discard, blocks := calculateUnderlying(offset, limit)
+	underlyingOffset, underlyingLimit, discard, blocks := calculateUnderlyingHeader(fh.headerSize, offset, limit)
 
 	// Move the nonce on the correct number of blocks from the start
 	fh.nonce = fh.initialNonce
@@ -1120,7 +1279,7 @@ func (c *Cipher) DecryptDataSeek(ctx context.Context, open OpenRangeSeek, offset
 // EncryptedSize calculates the size of the data when encrypted
 func (c *Cipher) EncryptedSize(size int64) int64 {
 	blocks, residue := size/blockDataSize, size%blockDataSize
-	encryptedSize := int64(fileHeaderSize) + blocks*(blockHeaderSize+blockDataSize)
+	encryptedSize := c.headerSize() + blocks*(blockHeaderSize+blockDataSize)
 	if residue != 0 {
 		encryptedSize += blockHeaderSize + residue
 	}
@@ -1129,7 +1288,13 @@ func (c *Cipher) EncryptedSize(size int64) int64 {
 
 // DecryptedSize calculates the size of the data when decrypted
 func (c *Cipher) DecryptedSize(size int64) (int64, error) {
-	size -= int64(fileHeaderSize)
+	return decryptedSize(c.headerSize(), size)
+}
+
+// decryptedSize calculates the size of the data of a file with a
+// header of headerSize bytes when decrypted
+func decryptedSize(headerSize, size int64) (int64, error) {
+	size -= headerSize
 	if size < 0 {
 		return 0, ErrorEncryptedFileTooShort
 	}
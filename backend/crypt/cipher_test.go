@@ -27,6 +27,7 @@ func TestNewNameEncryptionMode(t *testing.T) {
 		{"off", NameEncryptionOff, ""},
 		{"standard", NameEncryptionStandard, ""},
 		{"obfuscate", NameEncryptionObfuscated, ""},
+		{"siv", NameEncryptionSIV, ""},
 		{"potato", NameEncryptionOff, "unknown file name encryption mode \"potato\""},
 	} {
 		actual, actualErr := NewNameEncryptionMode(test.in)
@@ -43,7 +44,8 @@ func TestNewNameEncryptionModeString(t *testing.T) {
 	assert.Equal(t, NameEncryptionOff.String(), "off")
 	assert.Equal(t, NameEncryptionStandard.String(), "standard")
 	assert.Equal(t, NameEncryptionObfuscated.String(), "obfuscate")
-	assert.Equal(t, NameEncryptionMode(3).String(), "Unknown mode #3")
+	assert.Equal(t, NameEncryptionSIV.String(), "siv")
+	assert.Equal(t, NameEncryptionMode(4).String(), "Unknown mode #4")
 }
 
 type EncodingTestCase struct {
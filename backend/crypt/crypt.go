@@ -2,12 +2,14 @@
 package crypt
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rclone/rclone/fs"
@@ -18,6 +20,7 @@ import (
 	"github.com/rclone/rclone/fs/config/obscure"
 	"github.com/rclone/rclone/fs/fspath"
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/readers"
 )
 
 // Globals
@@ -29,7 +32,13 @@ func init() {
 		NewFs:       NewFs,
 		CommandHelp: commandHelp,
 		MetadataInfo: &fs.MetadataInfo{
-			Help: `Any metadata supported by the underlying remote is read and written.`,
+			Help: `Any metadata supported by the underlying remote is read and written.
+
+If metadata_encryption is set then the metadata and the modification
+time are stored encrypted, either in a single ` + "`crypt`" + ` metadata key
+of the underlying object or in a sidecar object next to it, so any
+metadata can be read and written even if the underlying remote doesn't
+support metadata.`,
 		},
 		Options: []fs.Option{{
 			Name:     "remote",
@@ -46,6 +55,9 @@ func init() {
 				}, {
 					Value: "obfuscate",
 					Help:  "Very simple filename obfuscation.",
+				}, {
+					Value: "siv",
+					Help:  "Encrypt and authenticate the filenames with AES-SIV.\nSee the docs for the details.",
 				}, {
 					Value: "off",
 					Help:  "Don't encrypt the file names.\nAdds a \".bin\", or \"suffix\" extension only.",
@@ -163,6 +175,22 @@ length and if it's case sensitive.`,
 				},
 			},
 			Advanced: true,
+		}, {
+			Name: "filename_padding",
+			Help: `Pad file names to a multiple of this many bytes before encryption.
+
+This is only used when filename_encryption is "siv". The length of
+the encrypted name only reveals the length of the name to within this
+many bytes. Larger values hide more but make longer encrypted names
+which may hit the name length limit of the remote.
+
+Use 0 to only add the single byte of padding needed.
+
+Changing this after files have been uploaded changes their encrypted
+names, so new uploads won't overwrite existing files, but files can
+still be read whatever it was set to.`,
+			Default:  16,
+			Advanced: true,
 		}, {
 			Name: "suffix",
 			Help: `If this is set it will override the default suffix of ".bin".
@@ -171,6 +199,113 @@ Setting suffix to "none" will result in an empty suffix. This may be useful
 when the path length is critical.`,
 			Default:  ".bin",
 			Advanced: true,
+		}, {
+			Name: "metadata_encryption",
+			Help: `Encrypt the metadata and modification time of files.
+
+Normally the metadata of a file, its modification time and its size
+(to within a few bytes) can be read from the underlying remote.
+
+If this is set then the metadata and modification time are encrypted
+with the data key. The modification time of the underlying object will
+be the time it was uploaded.
+
+If the underlying remote can store user metadata then the encrypted
+metadata is stored in its ` + "`crypt`" + ` metadata key, otherwise it is stored
+in an extra object next to each file with a ".cmeta" suffix on its
+encrypted name. These objects aren't shown in listings and are
+copied, moved and deleted with the file.
+
+Reading the modification time of a file needs an extra metadata read,
+or an extra download with sidecars, so listings with modification
+times will be slower.
+
+Files uploaded without this set can still be read and fall back to
+the unencrypted modification time and metadata.`,
+			Default: "off",
+			Examples: []fs.OptionExample{
+				{
+					Value: "off",
+					Help:  "Don't encrypt the metadata.",
+				}, {
+					Value: "on",
+					Help:  "Encrypt the metadata into a metadata key if possible, otherwise a sidecar.",
+				}, {
+					Value: "sidecar",
+					Help:  "Encrypt the metadata into a sidecar object.",
+				},
+			},
+			Advanced: true,
+		}, {
+			Name: "size_padding",
+			Help: `Pad the size of files up to a multiple of this.
+
+If this is set then the data of files is padded with zeros before
+encryption so the size of the underlying object only reveals the size
+of the file to within this many bytes. Empty files are padded too.
+The real size is stored in the encrypted metadata so this needs
+metadata_encryption to be set.
+
+Reading the size of a file needs the encrypted metadata so listings
+will be slower.
+
+Use 0 to disable padding.`,
+			Default:  fs.SizeSuffix(0),
+			Advanced: true,
+		}, {
+			Name: "envelope",
+			Help: `Write files in the envelope format.
+
+Normally the data of every file is encrypted with the same key derived
+from the password.
+
+If this is set then the data of each file is encrypted with its own
+random key, and that key is stored in the header of the file wrapped
+by each master key - the password (see envelope_password) and/or
+the X25519 public keys in envelope_recipients.
+
+This makes it possible to change the master keys with the "rekey"
+backend command which only rewrites the headers of files.
+
+Files in either format are read whatever this is set to, and files in
+the original format can be converted with "rekey". As files in either
+format may be present, the start of each file is read when it is
+listed to find its size which costs a transaction per file.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "envelope_password",
+			Help: `Wrap the file keys of the envelope format with the password.
+
+If this is turned off the file keys are only wrapped with the public
+keys in envelope_recipients, so this remote can write files but it
+can't read them back unless it has a matching envelope_identities key.
+This is useful for backup servers which shouldn't be able to decrypt
+the backups they make.
+
+Note that file and directory names and encrypted metadata are still
+encrypted with the password.`,
+			Default:  true,
+			Advanced: true,
+		}, {
+			Name: "envelope_recipients",
+			Help: `Public keys to wrap the file keys of the envelope format with.
+
+A comma separated list of X25519 public keys in age format, for
+example "age1...". Use "rclone backend keygen crypt:" to make a key.
+
+There can be up to 8 master keys including the password.`,
+			Default:  fs.CommaSepList{},
+			Advanced: true,
+		}, {
+			Name: "envelope_identities",
+			Help: `Private keys to unwrap the file keys of the envelope format with.
+
+A comma separated list of X25519 private keys in age format, for
+example "AGE-SECRET-KEY-1...", matching keys in envelope_recipients.`,
+			Default:   fs.CommaSepList{},
+			Advanced:  true,
+			Sensitive: true,
 		}},
 	})
 }
@@ -205,6 +340,14 @@ func newCipherForConfig(opt *Options) (*Cipher, error) {
 	}
 	cipher.setEncryptedSuffix(opt.Suffix)
 	cipher.setPassBadBlocks(opt.PassBadBlocks)
+	err = cipher.setNamePadding(opt.FilenamePadding)
+	if err != nil {
+		return nil, err
+	}
+	err = cipher.setEnvelope(opt.Envelope, opt.EnvelopePassword, opt.EnvelopeRecipients, opt.EnvelopeIdentities)
+	if err != nil {
+		return nil, err
+	}
 	return cipher, nil
 }
 
@@ -255,12 +398,28 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 	if err != fs.ErrorIsFile && err != nil {
 		return nil, fmt.Errorf("failed to make remote %q to wrap: %w", remote, err)
 	}
+	metaMode, metaErr := newMetadataMode(opt.MetadataEncryption, wrappedFs.Features())
+	if metaErr != nil {
+		return nil, metaErr
+	}
+	if opt.SizePadding > 0 {
+		if metaMode == metadataModeOff {
+			return nil, errors.New("size_padding needs metadata_encryption to be set")
+		}
+		if opt.NoDataEncryption {
+			return nil, errors.New("size_padding can't be used with no_data_encryption")
+		}
+	}
+	if metaMode == metadataModeSidecar && cipher.NameEncryptionMode() == NameEncryptionOff && cipher.encryptedSuffix == "" {
+		return nil, errors.New("metadata_encryption sidecars need encrypted file names or a suffix")
+	}
 	f := &Fs{
-		Fs:     wrappedFs,
-		name:   name,
-		root:   rpath,
-		opt:    *opt,
-		cipher: cipher,
+		Fs:       wrappedFs,
+		name:     name,
+		root:     rpath,
+		opt:      *opt,
+		cipher:   cipher,
+		metaMode: metaMode,
 	}
 	cache.PinUntilFinalized(f.Fs, f)
 	// Correct root if definitely pointing to a file
@@ -292,24 +451,38 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 		DirModTimeUpdatesOnWrite: true,
 		PartialUploads:           true,
 	}).Fill(ctx, f).Mask(ctx, wrappedFs).WrapsFs(f, wrappedFs)
+	if metaMode == metadataModeSidecar {
+		// metadata is stored in the sidecars so the underlying
+		// remote doesn't need to support it
+		f.features.ReadMetadata = true
+		f.features.WriteMetadata = true
+		f.features.UserMetadata = true
+	}
 
 	return f, err
 }
 
 // Options defines the configuration for this backend
 type Options struct {
-	Remote                  string `config:"remote"`
-	FilenameEncryption      string `config:"filename_encryption"`
-	DirectoryNameEncryption bool   `config:"directory_name_encryption"`
-	NoDataEncryption        bool   `config:"no_data_encryption"`
-	Password                string `config:"password"`
-	Password2               string `config:"password2"`
-	ServerSideAcrossConfigs bool   `config:"server_side_across_configs"`
-	ShowMapping             bool   `config:"show_mapping"`
-	PassBadBlocks           bool   `config:"pass_bad_blocks"`
-	FilenameEncoding        string `config:"filename_encoding"`
-	Suffix                  string `config:"suffix"`
-	StrictNames             bool   `config:"strict_names"`
+	Remote                  string          `config:"remote"`
+	FilenameEncryption      string          `config:"filename_encryption"`
+	DirectoryNameEncryption bool            `config:"directory_name_encryption"`
+	NoDataEncryption        bool            `config:"no_data_encryption"`
+	Password                string          `config:"password"`
+	Password2               string          `config:"password2"`
+	ServerSideAcrossConfigs bool            `config:"server_side_across_configs"`
+	ShowMapping             bool            `config:"show_mapping"`
+	PassBadBlocks           bool            `config:"pass_bad_blocks"`
+	FilenameEncoding        string          `config:"filename_encoding"`
+	FilenamePadding         int             `config:"filename_padding"`
+	Suffix                  string          `config:"suffix"`
+	StrictNames             bool            `config:"strict_names"`
+	MetadataEncryption      string          `config:"metadata_encryption"`
+	SizePadding             fs.SizeSuffix   `config:"size_padding"`
+	Envelope                bool            `config:"envelope"`
+	EnvelopePassword        bool            `config:"envelope_password"`
+	EnvelopeRecipients      fs.CommaSepList `config:"envelope_recipients"`
+	EnvelopeIdentities      fs.CommaSepList `config:"envelope_identities"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -321,6 +494,7 @@ type Fs struct {
 	opt      Options
 	features *fs.Features // optional features
 	cipher   *Cipher
+	metaMode metadataMode // where the encrypted metadata is stored
 }
 
 // Name of the remote (as passed into NewFs)
@@ -344,8 +518,11 @@ func (f *Fs) String() string {
 }
 
 // Encrypt an object file name to entries.
-func (f *Fs) add(entries *fs.DirEntries, obj fs.Object) error {
+func (f *Fs) add(ctx context.Context, entries *fs.DirEntries, obj fs.Object) error {
 	remote := obj.Remote()
+	if f.isSidecar(remote) {
+		return nil
+	}
 	decryptedRemote, err := f.cipher.DecryptFileName(remote)
 	if err != nil {
 		if f.opt.StrictNames {
@@ -357,7 +534,7 @@ func (f *Fs) add(entries *fs.DirEntries, obj fs.Object) error {
 	if f.opt.ShowMapping {
 		fs.Logf(decryptedRemote, "Encrypts to %q", remote)
 	}
-	*entries = append(*entries, f.newObject(obj))
+	*entries = append(*entries, f.newObjectMeta(ctx, obj))
 	return nil
 }
 
@@ -387,7 +564,7 @@ func (f *Fs) encryptEntries(ctx context.Context, entries fs.DirEntries) (newEntr
 	for _, entry := range entries {
 		switch x := entry.(type) {
 		case fs.Object:
-			err = f.add(&newEntries, x)
+			err = f.add(ctx, &newEntries, x)
 		case fs.Directory:
 			err = f.addDir(ctx, &newEntries, x)
 		default:
@@ -455,7 +632,7 @@ func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(o), nil
+	return f.newObjectMeta(ctx, o), nil
 }
 
 type putFn func(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error)
@@ -464,12 +641,40 @@ type putFn func(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ..
 func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options []fs.OpenOption, put putFn) (fs.Object, error) {
 	ci := fs.GetConfig(ctx)
 
+	// Read the metadata to encrypt and stop it being written
+	// to the underlying remote
+	var meta *cryptMetadata
+	if f.metaMode != metadataModeOff {
+		var err error
+		meta, err = f.newCryptMetadata(ctx, src, options)
+		if err != nil {
+			return nil, err
+		}
+		ctx, options = f.metadataPutContext(ctx, options)
+	}
+
 	if f.opt.NoDataEncryption {
-		o, err := put(ctx, in, f.newObjectInfo(src, nonce{}), options...)
-		if err == nil && o != nil {
-			o = f.newObject(o)
+		srcInfo, err := f.newObjectInfoMetadata(src, nonce{}, meta)
+		if err != nil {
+			return nil, err
+		}
+		o, err := put(ctx, in, srcInfo, options...)
+		if err != nil {
+			return o, err
 		}
-		return o, err
+		if o == nil {
+			return nil, nil
+		}
+		return f.finishPut(ctx, o, meta, nil)
+	}
+
+	// Pad the data before encrypting it
+	var padder *padReader
+	if f.opt.SizePadding > 0 {
+		var wrap accounting.WrapFn
+		in, wrap = accounting.UnWrap(in)
+		padder = f.newPadReader(in)
+		in = wrap(padder)
 	}
 
 	// Encrypt the data into wrappedIn
@@ -477,6 +682,9 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options [
 	if err != nil {
 		return nil, err
 	}
+	if meta != nil {
+		meta.setNonce(&encrypter.nonce)
+	}
 
 	// Find a hash the destination supports to compute a hash of
 	// the encrypted data
@@ -500,7 +708,12 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options [
 	}
 
 	// Transfer the data
-	o, err := put(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce), options...)
+	srcInfo, err := f.newObjectInfoMetadata(src, encrypter.nonce, meta)
+	if err != nil {
+		return nil, err
+	}
+	srcInfo.env = encrypter.env
+	o, err := put(ctx, wrappedIn, srcInfo, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -526,7 +739,34 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options [
 		}
 	}
 
-	return f.newObject(o), nil
+	return f.finishPut(ctx, o, meta, padder)
+}
+
+// finishPut wraps the uploaded underlying object o and writes its
+// encrypted metadata if it wasn't written with the upload.
+func (f *Fs) finishPut(ctx context.Context, o fs.Object, meta *cryptMetadata, padder *padReader) (fs.Object, error) {
+	obj := f.newObject(o)
+	if meta == nil {
+		return obj, nil
+	}
+	if meta.Size >= 0 || padder == nil {
+		if f.metaMode == metadataModeKey {
+			obj.setMetadataCache(meta)
+			return obj, nil
+		}
+	} else {
+		// Size wasn't known until the data was read
+		meta.Size = padder.n
+	}
+	err := obj.writeMetadata(ctx, meta)
+	if err != nil {
+		removeErr := o.Remove(ctx)
+		if removeErr != nil {
+			fs.Errorf(o, "Failed to remove object after metadata write failed: %v", removeErr)
+		}
+		return nil, err
+	}
+	return obj, nil
 }
 
 // Put in to the remote path with the modTime given of the given size
@@ -625,11 +865,23 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if !ok {
 		return nil, fs.ErrorCantCopy
 	}
+	meta, ctx, err := f.serverSideMetadata(ctx, o)
+	if err != nil {
+		return nil, err
+	}
 	oResult, err := do(ctx, o.Object, f.cipher.EncryptFileName(remote))
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(oResult), nil
+	err = f.transferSidecar(ctx, o, oResult.Remote(), do)
+	if err != nil {
+		removeErr := oResult.Remove(ctx)
+		if removeErr != nil {
+			fs.Errorf(oResult, "Failed to remove copy after metadata copy failed: %v", removeErr)
+		}
+		return nil, err
+	}
+	return f.finishServerSide(ctx, oResult, meta)
 }
 
 // Move src to this remote using server-side move operations.
@@ -650,11 +902,24 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if !ok {
 		return nil, fs.ErrorCantMove
 	}
+	meta, ctx, err := f.serverSideMetadata(ctx, o)
+	if err != nil {
+		return nil, err
+	}
 	oResult, err := do(ctx, o.Object, f.cipher.EncryptFileName(remote))
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(oResult), nil
+	err = f.transferSidecar(ctx, o, oResult.Remote(), do)
+	if err != nil {
+		// Try to put the object back with its sidecar
+		_, moveBackErr := do(ctx, oResult, o.Object.Remote())
+		if moveBackErr != nil {
+			fs.Errorf(oResult, "Failed to move object back after metadata move failed: %v", moveBackErr)
+		}
+		return nil, err
+	}
+	return f.finishServerSide(ctx, oResult, meta)
 }
 
 // DirMove moves src, srcRemote to this remote at dstRemote
@@ -687,15 +952,7 @@ func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 	if do == nil {
 		return nil, errors.New("can't PutUnchecked")
 	}
-	wrappedIn, encrypter, err := f.cipher.encryptData(in)
-	if err != nil {
-		return nil, err
-	}
-	o, err := do(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce))
-	if err != nil {
-		return nil, err
-	}
-	return f.newObject(o), nil
+	return f.put(ctx, in, src, options, do)
 }
 
 // CleanUp the trash in the Fs
@@ -747,8 +1004,11 @@ func (f *Fs) DecryptFileName(encryptedFileName string) (string, error) {
 // computeHashWithNonce takes the nonce and encrypts the contents of
 // src with it, and calculates the hash given by HashType on the fly
 //
+// If env is set then the data is encrypted in the envelope format
+// with it.
+//
 // Note that we break lots of encapsulation in this function.
-func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, src fs.Object, hashType hash.Type) (hashStr string, err error) {
+func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, env *envelope, src fs.Object, hashType hash.Type) (hashStr string, err error) {
 	// Open the src for input
 	in, err := src.Open(ctx)
 	if err != nil {
@@ -756,8 +1016,14 @@ func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, src fs.Objec
 	}
 	defer fs.CheckClose(in, &err)
 
+	// Pad the src as it was when uploaded
+	var padded io.Reader = in
+	if f.opt.SizePadding > 0 {
+		padded = f.newPadReader(in)
+	}
+
 	// Now encrypt the src with the nonce
-	out, err := f.cipher.newEncrypter(in, &nonce)
+	out, err := f.cipher.newEncrypterEnvelope(padded, &nonce, env)
 	if err != nil {
 		return "", fmt.Errorf("failed to make encrypter: %w", err)
 	}
@@ -785,8 +1051,9 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 	}
 
 	// Read the nonce - opening the file is sufficient to read the nonce in
-	// use a limited read so we only read the header
-	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: 0, End: int64(fileHeaderSize) - 1})
+	// use a limited read so we only read the header, which may be
+	// in the envelope format
+	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: 0, End: int64(envelopeHeaderSize) - 1})
 	if err != nil {
 		return "", fmt.Errorf("failed to open object to read nonce: %w", err)
 	}
@@ -795,7 +1062,7 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 		_ = in.Close()
 		return "", fmt.Errorf("failed to open object to read nonce: %w", err)
 	}
-	nonce := d.nonce
+	nonce, env := d.nonce, d.env
 	// fs.Debugf(o, "Read nonce % 2x", nonce)
 
 	// Check nonce isn't all zeros
@@ -815,7 +1082,7 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 		return "", fmt.Errorf("failed to close nonce read: %w", err)
 	}
 
-	return f.computeHashWithNonce(ctx, nonce, src, hashType)
+	return f.computeHashWithNonce(ctx, nonce, env, src, hashType)
 }
 
 // MergeDirs merges the contents of all the directories passed
@@ -873,6 +1140,10 @@ func (f *Fs) ChangeNotify(ctx context.Context, notifyFunc func(string, fs.EntryT
 		case fs.EntryDirectory:
 			decrypted, err = f.cipher.DecryptDirName(path)
 		case fs.EntryObject:
+			// Changes to sidecars are changes to their objects
+			if f.isSidecar(path) {
+				path = strings.TrimSuffix(path, metadataSidecarSuffix)
+			}
 			decrypted, err = f.cipher.DecryptFileName(path)
 		default:
 			fs.Errorf(path, "crypt ChangeNotify: ignoring unknown EntryType %d", entryType)
@@ -913,6 +1184,55 @@ Usage Example:
     rclone rc backend/command command=decode fs=crypt: encryptedfile1 [encryptedfile2...]
 `,
 	},
+	{
+		Name:  "keygen",
+		Short: "Make a new key pair for the envelope format",
+		Long: `This makes a new X25519 key pair in age format for use with the
+envelope format. Put the recipient in envelope_recipients and keep the
+identity safe - it is needed to decrypt files if the password isn't
+used.
+
+Usage Example:
+
+    rclone backend keygen crypt:
+`,
+	},
+	{
+		Name:  "rekey",
+		Short: "Rewrap the file keys with the current master keys",
+		Long: `This rewrites the headers of the files in the envelope format so
+their file keys are wrapped with the master keys currently configured,
+for example after adding or removing a key from envelope_recipients.
+
+Only the header of each file changes - the data isn't decrypted or
+re-encrypted, although it is uploaded again. Files already wrapped
+with the current master keys are left alone. The envelope option must
+be set.
+
+Files in the original format are skipped unless the -o convert option
+is given. Converting a file decrypts it and encrypts it again with a
+new random file key so the data key derived from the password can't
+decrypt it any more.
+
+The file keys are unwrapped with the password and envelope_identities
+and any old identities given with the -o old_identity option.
+
+Note that this can't change the password as it is also used to
+encrypt the file names.
+
+Usage Example:
+
+    rclone backend rekey crypt:path
+    rclone backend rekey crypt:path -o convert=true
+    rclone backend rekey crypt:path -o old_identity=AGE-SECRET-KEY-1...
+
+It returns the number of files rekeyed, unchanged, skipped and in error.
+`,
+		Opts: map[string]string{
+			"convert":      "Convert files in the original format to the envelope format",
+			"old_identity": "Extra comma separated age identities to unwrap the file keys with",
+		},
+	},
 }
 
 // Command the backend to run a named command
@@ -943,6 +1263,17 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 			out = append(out, encryptedFileName)
 		}
 		return out, nil
+	case "keygen":
+		identity, recipient, err := keygen(f.cipher.cryptoRand)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make key: %w", err)
+		}
+		return map[string]string{
+			"identity":  identity,
+			"recipient": recipient,
+		}, nil
+	case "rekey":
+		return f.rekey(ctx, opt)
 	default:
 		return nil, fs.ErrorCommandNotFound
 	}
@@ -953,7 +1284,11 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 // This decrypts the remote name and decrypts the data
 type Object struct {
 	fs.Object
-	f *Fs
+	f          *Fs
+	headerSize int64          // size of the file header or 0 for the format the cipher writes
+	metaMu     sync.Mutex     // protects the fields below
+	meta       *cryptMetadata // encrypted metadata or nil if none
+	metaRead   bool           // set if meta has been read
 }
 
 func (f *Fs) newObject(o fs.Object) *Object {
@@ -963,6 +1298,56 @@ func (f *Fs) newObject(o fs.Object) *Object {
 	}
 }
 
+// newObjectMeta wraps o reading its header and encrypted metadata now
+// if they are needed for the size so Size doesn't need to read them.
+func (f *Fs) newObjectMeta(ctx context.Context, o fs.Object) *Object {
+	obj := f.newObject(o)
+	err := obj.readHeaderSize(ctx)
+	if err != nil {
+		fs.Errorf(obj, "Failed to read header: %v", err)
+	}
+	if f.opt.SizePadding > 0 {
+		_, err := obj.readMetadata(ctx)
+		if err != nil {
+			fs.Errorf(obj, "Failed to read size from metadata: %v", err)
+		}
+	}
+	return obj
+}
+
+// readHeaderSize finds the size of the header of the file from its
+// magic.
+//
+// This is done whether the envelope format is being written or not
+// as files in either format may be about.
+func (o *Object) readHeaderSize(ctx context.Context) error {
+	if o.f.opt.NoDataEncryption {
+		return nil
+	}
+	// Files shorter than the envelope header must be in the
+	// original format
+	if size := o.Object.Size(); size >= 0 && size < int64(envelopeHeaderSize) {
+		o.headerSize = int64(fileHeaderSize)
+		return nil
+	}
+	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: 0, End: int64(fileMagicSize) - 1})
+	if err != nil {
+		return err
+	}
+	magic := make([]byte, fileMagicSize)
+	_, err = readers.ReadFill(in, magic)
+	_ = in.Close()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if bytes.Equal(magic, envelopeMagicBytes) {
+		o.headerSize = int64(envelopeHeaderSize)
+	} else {
+		o.headerSize = int64(fileHeaderSize)
+	}
+	return nil
+}
+
 // Fs returns read only access to the Fs that this object is part of
 func (o *Object) Fs() fs.Info {
 	return o.f
@@ -988,11 +1373,23 @@ func (o *Object) Remote() string {
 }
 
 // Size returns the size of the file
+//
+// If size padding is in use the size comes from the encrypted
+// metadata read when the object was found.
 func (o *Object) Size() int64 {
+	if o.f.opt.SizePadding > 0 {
+		if m := o.cachedMetadata(); m != nil && m.Size >= 0 {
+			return m.Size
+		}
+	}
 	size := o.Object.Size()
 	if !o.f.opt.NoDataEncryption {
+		headerSize := o.headerSize
+		if headerSize == 0 {
+			headerSize = o.f.cipher.headerSize()
+		}
 		var err error
-		size, err = o.f.cipher.DecryptedSize(size)
+		size, err = decryptedSize(headerSize, size)
 		if err != nil {
 			fs.Debugf(o, "Bad size for decrypt: %v", err)
 		}
@@ -1011,12 +1408,55 @@ func (o *Object) UnWrap() fs.Object {
 	return o.Object
 }
 
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	m, err := o.readMetadata(ctx)
+	if err != nil {
+		fs.Debugf(o, "Failed to read modification time from metadata: %v", err)
+	} else if m != nil {
+		return m.ModTime
+	}
+	return o.Object.ModTime(ctx)
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	if o.f.metaMode == metadataModeOff {
+		return o.Object.SetModTime(ctx, modTime)
+	}
+	m, err := o.metadataOrNew(ctx)
+	if err != nil {
+		return err
+	}
+	m.ModTime = modTime
+	return o.writeMetadata(ctx, m)
+}
+
+// Remove the file and its metadata sidecar if it has one
+func (o *Object) Remove(ctx context.Context) error {
+	err := o.Object.Remove(ctx)
+	if err != nil {
+		return err
+	}
+	if o.f.metaMode == metadataModeSidecar {
+		return o.f.removeSidecar(ctx, o.Object.Remote())
+	}
+	return nil
+}
+
 // Open opens the file for read.  Call Close() on the returned io.ReadCloser
 func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.ReadCloser, err error) {
 	if o.f.opt.NoDataEncryption {
 		return o.Object.Open(ctx, options...)
 	}
 
+	// Read the metadata now to check it against the file and so
+	// Size can find the unpadded size
+	meta, err := o.readMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	var openOptions []fs.OpenOption
 	var offset, limit int64 = 0, -1
 	for _, option := range options {
@@ -1030,7 +1470,13 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 			openOptions = append(openOptions, option)
 		}
 	}
-	rc, err = o.f.cipher.DecryptDataSeek(ctx, func(ctx context.Context, underlyingOffset, underlyingLimit int64) (io.ReadCloser, error) {
+	if o.f.opt.SizePadding > 0 {
+		// Don't read the padding
+		if size := o.Size(); limit < 0 || offset+limit > size {
+			limit = max(size-offset, 0)
+		}
+	}
+	fh, err := o.f.cipher.newDecrypterSeek(ctx, func(ctx context.Context, underlyingOffset, underlyingLimit int64) (io.ReadCloser, error) {
 		if underlyingOffset == 0 && underlyingLimit < 0 {
 			// Open with no seek
 			return o.Object.Open(ctx, openOptions...)
@@ -1049,7 +1495,13 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 	if err != nil {
 		return nil, err
 	}
-	return rc, nil
+	if meta != nil {
+		if err = meta.checkNonce(&fh.initialNonce); err != nil {
+			_ = fh.Close()
+			return nil, err
+		}
+	}
+	return fh, nil
 }
 
 // Update in to the object with the modTime given of the given size
@@ -1057,8 +1509,19 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	update := func(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
 		return o.Object, o.Object.Update(ctx, in, src, options...)
 	}
-	_, err := o.f.put(ctx, in, src, options, update)
-	return err
+	newO, err := o.f.put(ctx, in, src, options, update)
+	if err != nil {
+		return err
+	}
+	if newObj, ok := newO.(*Object); ok {
+		newObj.metaMu.Lock()
+		meta, metaRead := newObj.meta, newObj.metaRead
+		newObj.metaMu.Unlock()
+		o.metaMu.Lock()
+		o.meta, o.metaRead = meta, metaRead
+		o.metaMu.Unlock()
+	}
+	return nil
 }
 
 // newDir returns a dir with the Name decrypted
@@ -1107,8 +1570,11 @@ func (f *Fs) Shutdown(ctx context.Context) error {
 // This encrypts the remote name and adjusts the size
 type ObjectInfo struct {
 	fs.ObjectInfo
-	f     *Fs
-	nonce nonce
+	f        *Fs
+	nonce    nonce
+	env      *envelope   // envelope the data is encrypted with if set
+	modTime  time.Time   // modification time to upload with if encrypting metadata
+	metadata fs.Metadata // metadata to upload if encrypting metadata
 }
 
 func (f *Fs) newObjectInfo(src fs.ObjectInfo, nonce nonce) *ObjectInfo {
@@ -1119,6 +1585,25 @@ func (f *Fs) newObjectInfo(src fs.ObjectInfo, nonce nonce) *ObjectInfo {
 	}
 }
 
+// newObjectInfoMetadata makes an ObjectInfo which hides the
+// modification time and metadata of src and uploads meta encrypted
+// instead if meta is set.
+func (f *Fs) newObjectInfoMetadata(src fs.ObjectInfo, nonce nonce, meta *cryptMetadata) (*ObjectInfo, error) {
+	o := f.newObjectInfo(src, nonce)
+	if meta == nil {
+		return o, nil
+	}
+	o.modTime = time.Now()
+	if f.metaMode == metadataModeKey {
+		s, err := f.cipher.encryptMetadataString(meta)
+		if err != nil {
+			return nil, err
+		}
+		o.metadata = fs.Metadata{metadataKey: s}
+	}
+	return o, nil
+}
+
 // Fs returns read only access to the Fs that this object is part of
 func (o *ObjectInfo) Fs() fs.Info {
 	return o.f
@@ -1138,7 +1623,17 @@ func (o *ObjectInfo) Size() int64 {
 	if o.f.opt.NoDataEncryption {
 		return size
 	}
-	return o.f.cipher.EncryptedSize(size)
+	return o.f.cipher.EncryptedSize(o.f.paddedSize(size))
+}
+
+// ModTime returns the modification time of the file
+//
+// This is the upload time if the metadata is being encrypted.
+func (o *ObjectInfo) ModTime(ctx context.Context) time.Time {
+	if o.f.metaMode != metadataModeOff {
+		return o.modTime
+	}
+	return o.ObjectInfo.ModTime(ctx)
 }
 
 // Hash returns the selected checksum of the file
@@ -1160,7 +1655,7 @@ func (o *ObjectInfo) Hash(ctx context.Context, hash hash.Type) (string, error) {
 	if srcObj.Fs().Features().IsLocal {
 		// Read the data and encrypt it to calculate the hash
 		fs.Debugf(o, "Computing %v hash of encrypted source", hash)
-		return o.f.computeHashWithNonce(ctx, o.nonce, srcObj, hash)
+		return o.f.computeHashWithNonce(ctx, o.nonce, o.env, srcObj, hash)
 	}
 	return "", nil
 }
@@ -1187,6 +1682,9 @@ func (o *ObjectInfo) ID() string {
 //
 // It should return nil if there is no Metadata
 func (o *ObjectInfo) Metadata(ctx context.Context) (fs.Metadata, error) {
+	if o.f.metaMode != metadataModeOff {
+		return o.metadata, nil
+	}
 	do, ok := o.ObjectInfo.(fs.Metadataer)
 	if !ok {
 		return nil, nil
@@ -1241,6 +1739,13 @@ func (o *Object) GetTier() string {
 //
 // It should return nil if there is no Metadata
 func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	m, err := o.readMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		return m.get(), nil
+	}
 	do, ok := o.Object.(fs.Metadataer)
 	if !ok {
 		return nil, nil
@@ -1252,6 +1757,17 @@ func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
 //
 // It should return fs.ErrorNotImplemented if it can't set metadata
 func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	if o.f.metaMode != metadataModeOff {
+		m, err := o.metadataOrNew(ctx)
+		if err != nil {
+			return err
+		}
+		err = m.set(metadata)
+		if err != nil {
+			return err
+		}
+		return o.writeMetadata(ctx, m)
+	}
 	do, ok := o.Object.(fs.SetMetadataer)
 	if !ok {
 		return fs.ErrorNotImplemented
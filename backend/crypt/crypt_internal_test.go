@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,6 +17,7 @@ import (
 	"github.com/rclone/rclone/lib/random"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/nacl/secretbox"
 )
 
 // Create a temporary local fs to upload things from
@@ -56,12 +59,15 @@ func testObjectInfo(t *testing.T, f *Fs, wrap bool) {
 
 	obj := uploadFile(t, localFs, path, contents)
 
-	// encrypt the data
-	inBuf := bytes.NewBufferString(contents)
+	// encrypt the data padding it if required
+	var inBuf io.Reader = bytes.NewBufferString(contents)
+	if f.opt.SizePadding > 0 {
+		inBuf = f.newPadReader(inBuf)
+	}
 	var outBuf bytes.Buffer
 	enc, err := f.cipher.newEncrypter(inBuf, nil)
 	require.NoError(t, err)
-	nonce := enc.nonce // read the nonce at the start
+	nonce, env := enc.nonce, enc.env // read the nonce at the start
 	_, err = io.Copy(&outBuf, enc)
 	require.NoError(t, err)
 
@@ -74,6 +80,7 @@ func testObjectInfo(t *testing.T, f *Fs, wrap bool) {
 	// wrap the object in a crypt for upload using the nonce we
 	// saved from the encrypter
 	src := f.newObjectInfo(oi, nonce)
+	src.env = env
 
 	// Test ObjectInfo methods
 	if !f.opt.NoDataEncryption {
@@ -119,9 +126,319 @@ func testComputeHash(t *testing.T, f *Fs) {
 	assert.Equal(t, remoteObjHash, computedHash)
 }
 
+// Test the metadata and modification time don't leak to the
+// underlying remote
+func testMetadataEncryption(t *testing.T, f *Fs) {
+	if f.metaMode == metadataModeOff {
+		t.Skip("metadata_encryption not set")
+	}
+	var (
+		ctx      = context.Background()
+		contents = random.String(100)
+		path     = "metadata_test"
+		t1       = time.Date(2012, time.December, 17, 18, 32, 31, 0, time.UTC)
+	)
+	ctx, ci := fs.AddConfig(ctx)
+	ci.Metadata = true
+	upSrc := object.NewStaticObjectInfo(path, t1, int64(len(contents)), true, nil, nil).WithMetadata(fs.Metadata{"potato": "jersey"})
+	obj, err := f.Put(ctx, bytes.NewBufferString(contents), upSrc)
+	require.NoError(t, err)
+	o := obj.(*Object)
+
+	// Check the crypt object from scratch
+	newObj, err := f.NewObject(ctx, path)
+	require.NoError(t, err)
+	assert.True(t, t1.Equal(newObj.ModTime(ctx)))
+	assert.Equal(t, int64(len(contents)), newObj.Size())
+	metadata, err := newObj.(fs.Metadataer).Metadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "jersey", metadata["potato"])
+
+	// Check the underlying object
+	assert.False(t, t1.Equal(o.Object.ModTime(ctx)), "modification time leaked")
+	if f.opt.SizePadding > 0 {
+		assert.Equal(t, f.cipher.EncryptedSize(int64(f.opt.SizePadding)), o.Object.Size())
+	}
+	if do, ok := o.Object.(fs.Metadataer); ok {
+		metadata, err := do.Metadata(ctx)
+		require.NoError(t, err)
+		for k, v := range metadata {
+			assert.NotEqual(t, "jersey", v, "metadata leaked in key %q", k)
+		}
+		if f.metaMode == metadataModeKey {
+			assert.NotEmpty(t, metadata[metadataKey])
+		}
+	}
+
+	// Check the sidecar exists but isn't listed
+	sidecar := sidecarRemote(o.Object.Remote())
+	_, err = f.Fs.NewObject(ctx, sidecar)
+	if f.metaMode == metadataModeSidecar {
+		require.NoError(t, err)
+		entries, err := f.List(ctx, "")
+		require.NoError(t, err)
+		for _, entry := range entries {
+			assert.NotContains(t, entry.Remote(), metadataSidecarSuffix)
+		}
+	} else {
+		assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+	}
+
+	// Check metadata swapped from another file is detected
+	if !f.opt.NoDataEncryption {
+		upSrc2 := object.NewStaticObjectInfo(path+"2", t1, 10, true, nil, nil)
+		obj2, err := f.Put(ctx, bytes.NewBufferString(contents[:10]), upSrc2)
+		require.NoError(t, err)
+		meta, err := o.readMetadata(ctx)
+		require.NoError(t, err)
+		require.NoError(t, obj2.(*Object).writeMetadata(ctx, meta))
+		newObj2, err := f.NewObject(ctx, path+"2")
+		require.NoError(t, err)
+		_, err = newObj2.Open(ctx)
+		assert.Equal(t, ErrorMetadataWrongFile, err)
+		require.NoError(t, obj2.Remove(ctx))
+	}
+
+	// Check the sidecar is removed with the object
+	require.NoError(t, obj.Remove(ctx))
+	_, err = f.Fs.NewObject(ctx, sidecar)
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+}
+
 // InternalTest is called by fstests.Run to extra tests
 func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("ObjectInfo", func(t *testing.T) { testObjectInfo(t, f, false) })
 	t.Run("ObjectInfoWrap", func(t *testing.T) { testObjectInfo(t, f, true) })
 	t.Run("ComputeHash", func(t *testing.T) { testComputeHash(t, f) })
+	t.Run("MetadataEncryption", func(t *testing.T) { testMetadataEncryption(t, f) })
+	t.Run("Rekey", func(t *testing.T) { testRekey(t, f) })
+	t.Run("RekeyConvert", func(t *testing.T) { testRekeyConvert(t, f) })
+	t.Run("RekeyConvertMetadata", func(t *testing.T) { testRekeyConvertMetadata(t, f) })
+}
+
+// Test rekey rewraps the file keys without changing the data
+func testRekey(t *testing.T, f *Fs) {
+	if !f.cipher.envelope {
+		t.Skip("envelope not set")
+	}
+	var (
+		ctx      = context.Background()
+		contents = random.String(100)
+		path     = "rekey_test"
+	)
+	_ = uploadFile(t, f, path, contents)
+
+	// Nothing to do with the same keys
+	out, err := f.Command(ctx, "rekey", nil, nil)
+	require.NoError(t, err)
+	stats := out.(rekeyStats)
+	assert.Equal(t, 0, stats.Rekeyed)
+	assert.NotEqual(t, 0, stats.Unchanged)
+
+	// Add a recipient and rekey
+	identity, recipient, err := keygen(f.cipher.cryptoRand)
+	require.NoError(t, err)
+	oldKeys := f.cipher.keys
+	defer func() {
+		f.cipher.keys = oldKeys
+	}()
+	f.cipher.keys.recipients = append([][32]byte(nil), oldKeys.recipients...)
+	require.NoError(t, f.cipher.keys.addRecipient(recipient))
+	out, err = f.Command(ctx, "rekey", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, rekeyStats{Rekeyed: stats.Unchanged}, out)
+
+	// Check the new key can read the file on its own
+	f.cipher.keys = masterKeys{}
+	require.NoError(t, f.cipher.keys.addIdentity(identity))
+	f.cipher.keys.recipients = oldKeys.recipients
+	newObj, err := f.NewObject(ctx, path)
+	require.NoError(t, err)
+	in, err := newObj.Open(ctx)
+	require.NoError(t, err)
+	got, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, contents, string(got))
+}
+
+// Test files in the original format have the right size and that
+// converting them encrypts them with a new file key
+func testRekeyConvert(t *testing.T, f *Fs) {
+	if !f.cipher.envelope {
+		t.Skip("envelope not set")
+	}
+	ctx := context.Background()
+	files := map[string]string{
+		"convert_small": random.String(100),
+		"convert_large": random.String(3000),
+	}
+	f.cipher.envelope = false
+	for path, contents := range files {
+		_ = uploadFile(t, f, path, contents)
+	}
+	f.cipher.envelope = true
+
+	check := func(wantMagic []byte) {
+		for path, contents := range files {
+			obj, err := f.NewObject(ctx, path)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(contents)), obj.Size(), path)
+			in, err := obj.Open(ctx)
+			require.NoError(t, err)
+			got, err := io.ReadAll(in)
+			require.NoError(t, err)
+			require.NoError(t, in.Close())
+			assert.Equal(t, contents, string(got), path)
+
+			in, err = obj.(*Object).Object.Open(ctx)
+			require.NoError(t, err)
+			data, err := io.ReadAll(in)
+			require.NoError(t, err)
+			require.NoError(t, in.Close())
+			assert.Equal(t, wantMagic, data[:fileMagicSize], path)
+		}
+	}
+	check(fileMagicBytes)
+
+	// Files in the original format are skipped without convert
+	out, err := f.Command(ctx, "rekey", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, len(files), out.(rekeyStats).Skipped)
+	check(fileMagicBytes)
+
+	out, err = f.Command(ctx, "rekey", nil, map[string]string{"convert": "true"})
+	require.NoError(t, err)
+	assert.Equal(t, rekeyStats{Rekeyed: len(files), Unchanged: out.(rekeyStats).Unchanged}, out)
+	check(envelopeMagicBytes)
+
+	// Files in the envelope format can be read when not writing it
+	f.cipher.envelope = false
+	check(envelopeMagicBytes)
+	f.cipher.envelope = true
+
+	// The data key derived from the password can't decrypt them
+	for path := range files {
+		obj, err := f.NewObject(ctx, path)
+		require.NoError(t, err)
+		in, err := obj.(*Object).Object.Open(ctx)
+		require.NoError(t, err)
+		data, err := io.ReadAll(in)
+		require.NoError(t, err)
+		require.NoError(t, in.Close())
+		var n nonce
+		n.fromBuf(data[fileMagicSize:fileHeaderSize])
+		_, ok := secretbox.Open(nil, data[envelopeHeaderSize:], n.pointer(), &f.cipher.dataKey)
+		assert.False(t, ok, path)
+	}
+}
+
+// failSidecarFs wraps an Fs making writes to sidecars fail when fail
+// returns true
+type failSidecarFs struct {
+	fs.Fs
+	fail func() bool
+}
+
+var errInjected = errors.New("injected failure")
+
+// NewObject wraps the sidecars returned
+func (f *failSidecarFs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	o, err := f.Fs.NewObject(ctx, remote)
+	if err != nil || !strings.HasSuffix(remote, metadataSidecarSuffix) {
+		return o, err
+	}
+	return &failSidecarObject{Object: o, fail: f.fail}, nil
+}
+
+// Put fails for sidecars if set
+func (f *failSidecarFs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	if strings.HasSuffix(src.Remote(), metadataSidecarSuffix) && f.fail() {
+		return nil, errInjected
+	}
+	return f.Fs.Put(ctx, in, src, options...)
+}
+
+// failSidecarObject is a sidecar whose updates fail when fail
+// returns true
+type failSidecarObject struct {
+	fs.Object
+	fail func() bool
+}
+
+// Update fails if set
+func (o *failSidecarObject) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	if o.fail() {
+		return errInjected
+	}
+	return o.Object.Update(ctx, in, src, options...)
+}
+
+// Test converting a file leaves it readable if writing its encrypted
+// metadata fails
+func testRekeyConvertMetadata(t *testing.T, f *Fs) {
+	if !f.cipher.envelope {
+		t.Skip("envelope not set")
+	}
+	var (
+		ctx      = context.Background()
+		contents = random.String(3000)
+		path     = "convert_metadata"
+		t1       = time.Date(2012, time.December, 17, 18, 32, 31, 0, time.UTC)
+	)
+	oldMetaMode, oldFs := f.metaMode, f.Fs
+	defer func() {
+		f.metaMode, f.Fs = oldMetaMode, oldFs
+	}()
+	f.metaMode = metadataModeSidecar
+
+	// Upload a file in the original format
+	f.cipher.envelope = false
+	obj, err := f.Put(ctx, bytes.NewBufferString(contents), object.NewStaticObjectInfo(path, t1, int64(len(contents)), true, nil, nil))
+	f.cipher.envelope = true
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, obj.Remove(ctx))
+	}()
+
+	// Fail the nth sidecar write from now
+	var writes, failAt int
+	f.Fs = &failSidecarFs{Fs: oldFs, fail: func() bool {
+		writes++
+		return writes == failAt
+	}}
+	check := func(wantMagic []byte) {
+		newObj, err := f.NewObject(ctx, path)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(contents)), newObj.Size())
+		assert.True(t, t1.Equal(newObj.ModTime(ctx)))
+		in, err := newObj.Open(ctx)
+		require.NoError(t, err)
+		got, err := io.ReadAll(in)
+		require.NoError(t, err)
+		require.NoError(t, in.Close())
+		assert.Equal(t, contents, string(got))
+
+		in, err = newObj.(*Object).Object.Open(ctx)
+		require.NoError(t, err)
+		data, err := io.ReadAll(in)
+		require.NoError(t, err)
+		require.NoError(t, in.Close())
+		assert.Equal(t, wantMagic, data[:fileMagicSize])
+	}
+	convert := func() error {
+		newObj, err := f.NewObject(ctx, path)
+		require.NoError(t, err)
+		return f.convertObject(ctx, newObj.(*Object))
+	}
+
+	// Failing to stage the metadata leaves the file alone
+	writes, failAt = 0, 1
+	assert.ErrorIs(t, convert(), errInjected)
+	check(fileMagicBytes)
+
+	// Failing to commit the metadata leaves it readable
+	writes, failAt = 0, 2
+	assert.ErrorIs(t, convert(), errInjected)
+	check(envelopeMagicBytes)
 }
@@ -0,0 +1,333 @@
+package crypt
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rclone/rclone/lib/readers"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// The envelope format is the same as the original format except
+// that the magic is different and the nonce is followed by slots
+// holding the data key of the file wrapped with each master key.
+//
+// Each slot is
+//
+//	1 byte slot type
+//	8 bytes key ID of the master key
+//	password: 24 bytes nonce + 48 bytes secretbox of the data key
+//	X25519:   32 bytes ephemeral public key + 48 bytes box of the data key
+//
+// with the rest of the slot filled with random bytes.
+const (
+	envelopeMagic      = "RCLONE\x00\x02"
+	envelopeSlots      = 8
+	envelopeSlotSize   = 128
+	envelopeSlotsSize  = envelopeSlots * envelopeSlotSize
+	envelopeHeaderSize = fileHeaderSize + envelopeSlotsSize
+	envelopeKeyIDSize  = 8
+	envelopeWrapSize   = 32 + secretbox.Overhead // size of a wrapped data key
+
+	slotEmpty    = 0
+	slotPassword = 1
+	slotX25519   = 2
+
+	ageRecipientHRP = "age"
+	ageIdentityHRP  = "age-secret-key-"
+)
+
+// Errors returned by the envelope format
+var (
+	ErrorEnvelopeNoKey       = errors.New("no master key can decrypt the data key of this file")
+	ErrorEnvelopeNoRecipient = errors.New("envelope needs envelope_password or envelope_recipients to be set")
+	ErrorEnvelopeTooManyKeys = fmt.Errorf("envelope can't have more than %d master keys", envelopeSlots)
+)
+
+var envelopeMagicBytes = []byte(envelopeMagic)
+
+// envelope is the data key of a file in the envelope format and the
+// slots it is wrapped in
+type envelope struct {
+	key   [32]byte
+	slots [envelopeSlotsSize]byte
+}
+
+// keyID is the ID of a master key stored in the slots
+type keyID [envelopeKeyIDSize]byte
+
+// newKeyID makes the ID of a master key from its public part
+func newKeyID(kind string, public []byte) (id keyID) {
+	h := sha256.New()
+	_, _ = h.Write([]byte("rclone crypt " + kind + "\x00"))
+	_, _ = h.Write(public)
+	copy(id[:], h.Sum(nil))
+	return id
+}
+
+// x25519Identity is an X25519 private key and its public key
+type x25519Identity struct {
+	private [32]byte
+	public  [32]byte
+	id      keyID
+}
+
+// masterKeys are the keys the data keys of files are wrapped with
+type masterKeys struct {
+	usePassword bool       // wrap and unwrap with the password
+	kek         [32]byte   // key encryption key from the password
+	kekID       keyID      // ID of kek
+	recipients  [][32]byte // X25519 public keys to wrap with
+	identities  []*x25519Identity
+}
+
+// setPassword derives the key encryption key from the data key
+// derived from the password
+func (k *masterKeys) setPassword(dataKey *[32]byte) {
+	copy(k.kek[:], deriveKey(dataKey, "rclone crypt envelope key encryption key"))
+	k.kekID = newKeyID("password", k.kek[:])
+}
+
+// parseAgeKey decodes an age key with the human readable part hrp
+func parseAgeKey(s, hrp string) (key [32]byte, err error) {
+	gotHRP, data, err := bech32Decode(strings.TrimSpace(s))
+	if err != nil {
+		return key, err
+	}
+	if gotHRP != hrp {
+		return key, fmt.Errorf("expecting key to start with %q", strings.ToUpper(hrp)+"1")
+	}
+	if len(data) != len(key) {
+		return key, fmt.Errorf("expecting %d byte key but got %d", len(key), len(data))
+	}
+	copy(key[:], data)
+	return key, nil
+}
+
+// newX25519Identity makes an identity from the private key
+func newX25519Identity(private [32]byte) (*x25519Identity, error) {
+	id := &x25519Identity{private: private}
+	public, err := curve25519.X25519(private[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	copy(id.public[:], public)
+	id.id = newKeyID("x25519", id.public[:])
+	return id, nil
+}
+
+// addRecipient adds an age public key ("age1...") to wrap data keys with
+func (k *masterKeys) addRecipient(s string) error {
+	public, err := parseAgeKey(s, ageRecipientHRP)
+	if err != nil {
+		return fmt.Errorf("bad envelope recipient %q: %w", s, err)
+	}
+	k.recipients = append(k.recipients, public)
+	return nil
+}
+
+// addIdentity adds an age private key ("AGE-SECRET-KEY-1...") to
+// unwrap data keys with
+func (k *masterKeys) addIdentity(s string) error {
+	private, err := parseAgeKey(s, ageIdentityHRP)
+	if err != nil {
+		return fmt.Errorf("bad envelope identity: %w", err)
+	}
+	id, err := newX25519Identity(private)
+	if err != nil {
+		return fmt.Errorf("bad envelope identity: %w", err)
+	}
+	k.identities = append(k.identities, id)
+	return nil
+}
+
+// recipientIDs returns the IDs of the master keys data keys are
+// wrapped with
+func (k *masterKeys) recipientIDs() []keyID {
+	var ids []keyID
+	if k.usePassword {
+		ids = append(ids, k.kekID)
+	}
+	for i := range k.recipients {
+		ids = append(ids, newKeyID("x25519", k.recipients[i][:]))
+	}
+	return ids
+}
+
+// check returns an error if data keys can't be wrapped
+func (k *masterKeys) check() error {
+	n := len(k.recipients)
+	if k.usePassword {
+		n++
+	}
+	if n == 0 {
+		return ErrorEnvelopeNoRecipient
+	}
+	if n > envelopeSlots {
+		return ErrorEnvelopeTooManyKeys
+	}
+	return nil
+}
+
+// wrap wraps key for each of the master keys into slots
+func (k *masterKeys) wrap(rand io.Reader, key *[32]byte, slots *[envelopeSlotsSize]byte) error {
+	err := k.check()
+	if err != nil {
+		return err
+	}
+	// Fill the slots with random so the unused parts don't leak
+	_, err = readers.ReadFill(rand, slots[:])
+	if err != nil {
+		return fmt.Errorf("failed to read random slots: %w", err)
+	}
+	i := 0
+	nextSlot := func() []byte {
+		slot := slots[i*envelopeSlotSize : (i+1)*envelopeSlotSize]
+		i++
+		return slot
+	}
+	if k.usePassword {
+		slot := nextSlot()
+		slot[0] = slotPassword
+		copy(slot[1:], k.kekID[:])
+		var n nonce
+		n.fromBuf(slot[1+envelopeKeyIDSize:])
+		secretbox.Seal(slot[1+envelopeKeyIDSize+fileNonceSize:][:0], key[:], n.pointer(), &k.kek)
+	}
+	for _, recipient := range k.recipients {
+		slot := nextSlot()
+		slot[0] = slotX25519
+		id := newKeyID("x25519", recipient[:])
+		copy(slot[1:], id[:])
+		ephemeralPublic, ephemeralPrivate, err := box.GenerateKey(rand)
+		if err != nil {
+			return fmt.Errorf("failed to make ephemeral key: %w", err)
+		}
+		copy(slot[1+envelopeKeyIDSize:], ephemeralPublic[:])
+		// The ephemeral key is never reused so the nonce can be zero
+		var zeroNonce [fileNonceSize]byte
+		box.Seal(slot[1+envelopeKeyIDSize+32:][:0], key[:], &zeroNonce, &recipient, ephemeralPrivate)
+	}
+	for i < envelopeSlots {
+		nextSlot()[0] = slotEmpty
+	}
+	return nil
+}
+
+// slotIDs returns the IDs of the master keys used in slots
+func slotIDs(slots []byte) []keyID {
+	var ids []keyID
+	for i := 0; i < envelopeSlots; i++ {
+		slot := slots[i*envelopeSlotSize : (i+1)*envelopeSlotSize]
+		if slot[0] == slotEmpty {
+			continue
+		}
+		var id keyID
+		copy(id[:], slot[1:])
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// unwrap finds the data key from the slots using the master keys
+func (k *masterKeys) unwrap(slots []byte) (key [32]byte, err error) {
+	for i := 0; i < envelopeSlots; i++ {
+		slot := slots[i*envelopeSlotSize : (i+1)*envelopeSlotSize]
+		var id keyID
+		copy(id[:], slot[1:])
+		body := slot[1+envelopeKeyIDSize:]
+		switch slot[0] {
+		case slotPassword:
+			if !k.usePassword || id != k.kekID {
+				continue
+			}
+			var n nonce
+			n.fromBuf(body)
+			wrapped := body[fileNonceSize : fileNonceSize+envelopeWrapSize]
+			if _, ok := secretbox.Open(key[:0], wrapped, n.pointer(), &k.kek); ok {
+				return key, nil
+			}
+		case slotX25519:
+			var ephemeralPublic [32]byte
+			copy(ephemeralPublic[:], body)
+			wrapped := body[32 : 32+envelopeWrapSize]
+			for _, identity := range k.identities {
+				if id != identity.id {
+					continue
+				}
+				var zeroNonce [fileNonceSize]byte
+				if _, ok := box.Open(key[:0], wrapped, &zeroNonce, &ephemeralPublic, &identity.private); ok {
+					return key, nil
+				}
+			}
+		}
+	}
+	return key, ErrorEnvelopeNoKey
+}
+
+// setEnvelope configures the envelope format
+//
+// If write is set then files are written in the envelope format.
+func (c *Cipher) setEnvelope(write, usePassword bool, recipients, identities []string) error {
+	c.envelope = write
+	c.keys.usePassword = usePassword
+	c.keys.setPassword(&c.dataKey)
+	for _, recipient := range recipients {
+		if err := c.keys.addRecipient(recipient); err != nil {
+			return err
+		}
+	}
+	for _, identity := range identities {
+		if err := c.keys.addIdentity(identity); err != nil {
+			return err
+		}
+	}
+	if write {
+		return c.keys.check()
+	}
+	return nil
+}
+
+// newEnvelope makes a new random data key wrapped with the master keys
+func (c *Cipher) newEnvelope() (*envelope, error) {
+	env := new(envelope)
+	_, err := readers.ReadFill(c.cryptoRand, env.key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read random data key: %w", err)
+	}
+	err = c.keys.wrap(c.cryptoRand, &env.key, &env.slots)
+	if err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// headerSize returns the size of the header of files this cipher writes
+func (c *Cipher) headerSize() int64 {
+	if c.envelope {
+		return int64(envelopeHeaderSize)
+	}
+	return int64(fileHeaderSize)
+}
+
+// keygen makes a new X25519 key pair in age format
+func keygen(rand io.Reader) (identity, recipient string, err error) {
+	public, private, err := box.GenerateKey(rand)
+	if err != nil {
+		return "", "", err
+	}
+	identity, err = bech32Encode(ageIdentityHRP, private[:])
+	if err != nil {
+		return "", "", err
+	}
+	recipient, err = bech32Encode(ageRecipientHRP, public[:])
+	if err != nil {
+		return "", "", err
+	}
+	return strings.ToUpper(identity), recipient, nil
+}
@@ -0,0 +1,174 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBech32(t *testing.T) {
+	data := []byte("potato\x00\x01\xff")
+	s, err := bech32Encode("test", data)
+	require.NoError(t, err)
+	assert.Equal(t, strings.ToLower(s), s)
+
+	hrp, got, err := bech32Decode(s)
+	require.NoError(t, err)
+	assert.Equal(t, "test", hrp)
+	assert.Equal(t, data, got)
+
+	// Upper case decodes too
+	hrp, got, err = bech32Decode(strings.ToUpper(s))
+	require.NoError(t, err)
+	assert.Equal(t, "test", hrp)
+	assert.Equal(t, data, got)
+
+	// Errors
+	for _, bad := range []string{
+		s[:len(s)-1] + "q",               // bad checksum
+		strings.ToUpper(s[:5]) + s[5:],   // mixed case
+		"test1" + strings.Repeat("b", 8), // invalid character
+		"1qqqqqqqq",                      // empty hrp
+		"test1qqqqq",                     // too short
+	} {
+		_, _, err = bech32Decode(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestKeygen(t *testing.T) {
+	identity, recipient, err := keygen(rand.Reader)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(identity, "AGE-SECRET-KEY-1"))
+	assert.True(t, strings.HasPrefix(recipient, "age1"))
+
+	var k masterKeys
+	require.NoError(t, k.addIdentity(identity))
+	require.NoError(t, k.addRecipient(recipient))
+	assert.Equal(t, k.recipients[0], k.identities[0].public)
+
+	// Keys the wrong way round
+	assert.Error(t, k.addIdentity(recipient))
+	assert.Error(t, k.addRecipient(identity))
+	assert.Error(t, k.addRecipient("age1potato"))
+}
+
+// newTestEnvelopeCipher makes a cipher writing in the envelope format
+func newTestEnvelopeCipher(t *testing.T, password string, usePassword bool, recipients, identities []string) *Cipher {
+	c, err := newCipher(NameEncryptionStandard, password, "", true, nil)
+	require.NoError(t, err)
+	require.NoError(t, c.setEnvelope(true, usePassword, recipients, identities))
+	return c
+}
+
+// encryptDecrypt encrypts plaintext with enc then decrypts it with dec
+func encryptDecrypt(t *testing.T, enc, dec *Cipher, plaintext []byte) ([]byte, error) {
+	in, err := enc.EncryptData(bytes.NewReader(plaintext))
+	require.NoError(t, err)
+	ciphertext, err := io.ReadAll(in)
+	require.NoError(t, err)
+	assert.Equal(t, enc.EncryptedSize(int64(len(plaintext))), int64(len(ciphertext)))
+	out, err := dec.DecryptData(io.NopCloser(bytes.NewReader(ciphertext)))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(out)
+}
+
+func TestEnvelopeEncryptDecrypt(t *testing.T) {
+	identity, recipient, err := keygen(rand.Reader)
+	require.NoError(t, err)
+	identity2, recipient2, err := keygen(rand.Reader)
+	require.NoError(t, err)
+	plaintext := bytes.Repeat([]byte("potato"), 50000)
+
+	// Password only
+	c := newTestEnvelopeCipher(t, "pass", true, nil, nil)
+	got, err := encryptDecrypt(t, c, c, plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, got)
+
+	// Wrong password
+	wrong := newTestEnvelopeCipher(t, "wrong", true, nil, nil)
+	_, err = encryptDecrypt(t, c, wrong, plaintext)
+	assert.Equal(t, ErrorEnvelopeNoKey, err)
+
+	// Public key only writer can't read its own files
+	writer := newTestEnvelopeCipher(t, "pass", false, []string{recipient, recipient2}, nil)
+	_, err = encryptDecrypt(t, writer, writer, plaintext)
+	assert.Equal(t, ErrorEnvelopeNoKey, err)
+	_, err = encryptDecrypt(t, writer, c, plaintext)
+	assert.Equal(t, ErrorEnvelopeNoKey, err)
+
+	// But either identity can
+	for _, id := range []string{identity, identity2} {
+		reader := newTestEnvelopeCipher(t, "pass", false, []string{recipient}, []string{id})
+		got, err = encryptDecrypt(t, writer, reader, plaintext)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, got)
+	}
+
+	// Files in the original format can still be read
+	legacy, err := newCipher(NameEncryptionStandard, "pass", "", true, nil)
+	require.NoError(t, err)
+	got, err = encryptDecrypt(t, legacy, c, plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, got)
+}
+
+func TestEnvelopeKeyErrors(t *testing.T) {
+	c, err := newCipher(NameEncryptionStandard, "pass", "", true, nil)
+	require.NoError(t, err)
+	assert.Equal(t, ErrorEnvelopeNoRecipient, c.setEnvelope(true, false, nil, nil))
+
+	var recipients []string
+	for i := 0; i < envelopeSlots; i++ {
+		_, recipient, err := keygen(rand.Reader)
+		require.NoError(t, err)
+		recipients = append(recipients, recipient)
+	}
+	c, err = newCipher(NameEncryptionStandard, "pass", "", true, nil)
+	require.NoError(t, err)
+	assert.Equal(t, ErrorEnvelopeTooManyKeys, c.setEnvelope(true, true, recipients, nil))
+	c, err = newCipher(NameEncryptionStandard, "pass", "", true, nil)
+	require.NoError(t, err)
+	assert.NoError(t, c.setEnvelope(true, false, recipients, nil))
+}
+
+func TestEnvelopeSeek(t *testing.T) {
+	c := newTestEnvelopeCipher(t, "pass", true, nil, nil)
+	plaintext, err := io.ReadAll(newRandomSource(150000))
+	require.NoError(t, err)
+	in, err := c.EncryptData(bytes.NewReader(plaintext))
+	require.NoError(t, err)
+	ciphertext, err := io.ReadAll(in)
+	require.NoError(t, err)
+
+	open := func(ctx context.Context, underlyingOffset, underlyingLimit int64) (io.ReadCloser, error) {
+		end := int64(len(ciphertext))
+		if underlyingLimit >= 0 && underlyingOffset+underlyingLimit < end {
+			end = underlyingOffset + underlyingLimit
+		}
+		return io.NopCloser(bytes.NewReader(ciphertext[underlyingOffset:end])), nil
+	}
+	for _, offset := range []int64{0, 1, 65535, 65536, 65537, 149999} {
+		for _, limit := range []int64{-1, 1, 65536, 100000} {
+			rc, err := c.DecryptDataSeek(context.Background(), open, offset, limit)
+			require.NoError(t, err)
+			got, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			end := int64(len(plaintext))
+			if limit >= 0 && offset+limit < end {
+				end = offset + limit
+			}
+			assert.Equal(t, plaintext[offset:end], got, "offset=%d limit=%d", offset, limit)
+			require.NoError(t, rc.Close())
+		}
+	}
+}
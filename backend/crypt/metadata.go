@@ -0,0 +1,532 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Where the encrypted metadata is stored
+type metadataMode int
+
+const (
+	metadataModeOff     metadataMode = iota // metadata is passed through unencrypted
+	metadataModeKey                         // in the metadataKey of the underlying object
+	metadataModeSidecar                     // in an object next to the underlying object
+)
+
+const (
+	metadataKey             = "crypt"  // the metadata key holding the encrypted metadata
+	metadataSidecarSuffix   = ".cmeta" // the suffix of sidecar objects
+	maxEncryptedMetadataLen = 1 << 20  // refuse to read sidecars larger than this
+)
+
+// Errors returned by the metadata encryption
+var (
+	ErrorBadMetadataEncryption = errors.New("unknown metadata_encryption mode")
+	ErrorEncryptedMetadataBad  = errors.New("failed to authenticate encrypted metadata - bad password?")
+	ErrorMetadataWrongFile     = errors.New("encrypted metadata belongs to a different file")
+)
+
+// cryptMetadata is the plaintext of the encrypted metadata
+//
+// It holds the things which would otherwise leak through the
+// underlying object.
+//
+// Nonce ties it to the file data so it can't be swapped with the
+// metadata of another file without this being noticed when the file
+// is read. NewNonce is set while the file data is being replaced so
+// the metadata matches the file whether the new data was written or
+// not.
+type cryptMetadata struct {
+	Size     int64       `json:"size"`               // size of the file, -1 if not known
+	ModTime  time.Time   `json:"mtime"`              // modification time of the file
+	Metadata fs.Metadata `json:"meta,omitempty"`     // the metadata of the file apart from mtime
+	Nonce    []byte      `json:"nonce,omitempty"`    // the nonce in the header of the file data
+	NewNonce []byte      `json:"newNonce,omitempty"` // the nonce of the file data being written
+}
+
+// newMetadataMode works out where the metadata should be stored from
+// the config and the features of the wrapped remote
+func newMetadataMode(s string, wrapped *fs.Features) (metadataMode, error) {
+	switch s {
+	case "", "off":
+		return metadataModeOff, nil
+	case "on":
+		if wrapped.ReadMetadata && wrapped.WriteMetadata && wrapped.UserMetadata {
+			return metadataModeKey, nil
+		}
+		return metadataModeSidecar, nil
+	case "sidecar":
+		return metadataModeSidecar, nil
+	}
+	return metadataModeOff, fmt.Errorf("%w %q", ErrorBadMetadataEncryption, s)
+}
+
+// encryptMetadata seals m with the data key and a random nonce
+func (c *Cipher) encryptMetadata(m *cryptMetadata) ([]byte, error) {
+	plaintext, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var n nonce
+	err = n.fromReader(c.cryptoRand)
+	if err != nil {
+		return nil, err
+	}
+	return secretbox.Seal(n[:], plaintext, n.pointer(), &c.dataKey), nil
+}
+
+// decryptMetadata opens the output of encryptMetadata
+func (c *Cipher) decryptMetadata(ciphertext []byte) (*cryptMetadata, error) {
+	if len(ciphertext) < fileNonceSize+secretbox.Overhead {
+		return nil, ErrorEncryptedMetadataBad
+	}
+	var n nonce
+	n.fromBuf(ciphertext)
+	plaintext, ok := secretbox.Open(nil, ciphertext[fileNonceSize:], n.pointer(), &c.dataKey)
+	if !ok {
+		return nil, ErrorEncryptedMetadataBad
+	}
+	m := new(cryptMetadata)
+	err := json.Unmarshal(plaintext, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode encrypted metadata: %w", err)
+	}
+	return m, nil
+}
+
+// encryptMetadataString is encryptMetadata encoded to be stored as
+// a metadata value
+func (c *Cipher) encryptMetadataString(m *cryptMetadata) (string, error) {
+	ciphertext, err := c.encryptMetadata(m)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+// decryptMetadataString decodes the output of encryptMetadataString
+func (c *Cipher) decryptMetadataString(s string) (*cryptMetadata, error) {
+	ciphertext, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode encrypted metadata: %w", err)
+	}
+	return c.decryptMetadata(ciphertext)
+}
+
+// set sets the metadata keys in metadata, taking the modification
+// time from mtime if set.
+func (m *cryptMetadata) set(metadata fs.Metadata) error {
+	for k, v := range metadata {
+		if k == "mtime" {
+			modTime, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return fmt.Errorf("failed to parse metadata mtime %q: %w", v, err)
+			}
+			m.ModTime = modTime
+			continue
+		}
+		m.Metadata.Set(k, v)
+	}
+	return nil
+}
+
+// setNonce records the nonce of the file data the metadata belongs to
+func (m *cryptMetadata) setNonce(n *nonce) {
+	m.Nonce = append([]byte(nil), n[:]...)
+	m.NewNonce = nil
+}
+
+// setNewNonce records the nonce of the file data about to replace the
+// file data the metadata belongs to
+func (m *cryptMetadata) setNewNonce(n *nonce) {
+	m.NewNonce = append([]byte(nil), n[:]...)
+}
+
+// checkNonce checks the metadata belongs to the file data with nonce
+// n. Metadata with no nonce, for files uploaded with
+// no_data_encryption, isn't checked.
+func (m *cryptMetadata) checkNonce(n *nonce) error {
+	if len(m.Nonce) == 0 || bytes.Equal(m.Nonce, n[:]) {
+		return nil
+	}
+	if len(m.NewNonce) != 0 && bytes.Equal(m.NewNonce, n[:]) {
+		return nil
+	}
+	return ErrorMetadataWrongFile
+}
+
+// get returns the metadata for the user including the mtime
+func (m *cryptMetadata) get() fs.Metadata {
+	metadata := make(fs.Metadata, len(m.Metadata)+1)
+	for k, v := range m.Metadata {
+		metadata[k] = v
+	}
+	metadata["mtime"] = m.ModTime.Format(time.RFC3339Nano)
+	return metadata
+}
+
+// newCryptMetadata makes the metadata to encrypt for uploading src
+func (f *Fs) newCryptMetadata(ctx context.Context, src fs.ObjectInfo, options []fs.OpenOption) (*cryptMetadata, error) {
+	m := &cryptMetadata{
+		Size:    src.Size(),
+		ModTime: src.ModTime(ctx),
+	}
+	metadata, err := fs.GetMetadataOptions(ctx, f, src, options)
+	if err != nil {
+		return nil, err
+	}
+	err = m.set(metadata)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// metadataPutContext returns a ctx and options for uploading to the
+// underlying remote so only the encrypted metadata is written
+func (f *Fs) metadataPutContext(ctx context.Context, options []fs.OpenOption) (context.Context, []fs.OpenOption) {
+	ctx, ci := fs.AddConfig(ctx)
+	ci.Metadata = f.metaMode == metadataModeKey
+	ci.MetadataSet = nil
+	ci.MetadataMapper = nil
+	newOptions := make([]fs.OpenOption, 0, len(options))
+	for _, option := range options {
+		if _, ok := option.(fs.MetadataOption); !ok {
+			newOptions = append(newOptions, option)
+		}
+	}
+	return ctx, newOptions
+}
+
+// serverSideMetadata works out the encrypted metadata for a server-side
+// copy or move of src if it needs to be changed, for example by
+// --metadata-set, and returns a ctx for the underlying operation.
+//
+// It returns nil metadata if the encrypted metadata should be copied
+// unchanged.
+func (f *Fs) serverSideMetadata(ctx context.Context, src *Object) (*cryptMetadata, context.Context, error) {
+	if f.metaMode == metadataModeOff {
+		return nil, ctx, nil
+	}
+	ci := fs.GetConfig(ctx)
+	var meta *cryptMetadata
+	if ci.Metadata && (len(ci.MetadataSet) > 0 || len(ci.MetadataMapper) > 0) {
+		metadata, err := fs.GetMetadataOptions(ctx, f, src, fs.MetadataAsOpenOptions(ctx))
+		if err != nil {
+			return nil, ctx, err
+		}
+		meta, err = src.metadataOrNew(ctx)
+		if err != nil {
+			return nil, ctx, err
+		}
+		err = meta.set(metadata)
+		if err != nil {
+			return nil, ctx, err
+		}
+	}
+	ctx, _ = f.metadataPutContext(ctx, nil)
+	return meta, ctx, nil
+}
+
+// finishServerSide wraps the underlying object o made by a server-side
+// copy or move and writes meta to it if set.
+func (f *Fs) finishServerSide(ctx context.Context, o fs.Object, meta *cryptMetadata) (fs.Object, error) {
+	if meta == nil {
+		return f.newObjectMeta(ctx, o), nil
+	}
+	obj := f.newObject(o)
+	err := obj.readHeaderSize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = obj.writeMetadata(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// paddedSize returns size rounded up to the size padding
+//
+// Empty files are padded too so they can't be told apart from small
+// ones.
+func (f *Fs) paddedSize(size int64) int64 {
+	padding := int64(f.opt.SizePadding)
+	if padding <= 0 || size < 0 {
+		return size
+	}
+	if size == 0 {
+		return padding
+	}
+	return (size + padding - 1) / padding * padding
+}
+
+// padReader pads the data read from in with zeros to a multiple of
+// the size padding counting the bytes read.
+type padReader struct {
+	f       *Fs
+	in      io.Reader
+	n       int64 // bytes read from in
+	padding int64 // bytes of padding left, -1 until in is finished
+}
+
+func (f *Fs) newPadReader(in io.Reader) *padReader {
+	return &padReader{
+		f:       f,
+		in:      in,
+		padding: -1,
+	}
+}
+
+// Read as per io.Reader
+func (p *padReader) Read(buf []byte) (n int, err error) {
+	if p.padding < 0 {
+		n, err = p.in.Read(buf)
+		p.n += int64(n)
+		if err != io.EOF {
+			return n, err
+		}
+		p.padding = p.f.paddedSize(p.n) - p.n
+		if n > 0 {
+			return n, nil
+		}
+	}
+	if p.padding == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(buf)) > p.padding {
+		buf = buf[:p.padding]
+	}
+	clear(buf)
+	p.padding -= int64(len(buf))
+	return len(buf), nil
+}
+
+// sidecarRemote returns the name of the sidecar of the underlying object
+func sidecarRemote(encryptedRemote string) string {
+	return encryptedRemote + metadataSidecarSuffix
+}
+
+// isSidecar returns true if remote is the name of a sidecar object
+func (f *Fs) isSidecar(remote string) bool {
+	return f.metaMode != metadataModeOff && strings.HasSuffix(remote, metadataSidecarSuffix)
+}
+
+// readSidecar reads the sidecar of the underlying object remote
+//
+// It returns nil, nil if there isn't one
+func (f *Fs) readSidecar(ctx context.Context, encryptedRemote string) (*cryptMetadata, error) {
+	o, err := f.Fs.NewObject(ctx, sidecarRemote(encryptedRemote))
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	in, err := o.Open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metadata sidecar: %w", err)
+	}
+	ciphertext, err := io.ReadAll(io.LimitReader(in, maxEncryptedMetadataLen))
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata sidecar: %w", err)
+	}
+	return f.cipher.decryptMetadata(ciphertext)
+}
+
+// writeSidecar writes m to the sidecar of the underlying object remote
+func (f *Fs) writeSidecar(ctx context.Context, encryptedRemote string, m *cryptMetadata) error {
+	ciphertext, err := f.cipher.encryptMetadata(m)
+	if err != nil {
+		return err
+	}
+	remote := sidecarRemote(encryptedRemote)
+	src := object.NewStaticObjectInfo(remote, time.Now(), int64(len(ciphertext)), true, nil, f.Fs)
+	o, err := f.Fs.NewObject(ctx, remote)
+	if err == nil {
+		err = o.Update(ctx, bytes.NewReader(ciphertext), src)
+	} else if errors.Is(err, fs.ErrorObjectNotFound) {
+		_, err = f.Fs.Put(ctx, bytes.NewReader(ciphertext), src)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write metadata sidecar: %w", err)
+	}
+	return nil
+}
+
+// removeSidecar removes the sidecar of the underlying object remote
+// if it exists
+func (f *Fs) removeSidecar(ctx context.Context, encryptedRemote string) error {
+	o, err := f.Fs.NewObject(ctx, sidecarRemote(encryptedRemote))
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err = o.Remove(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to remove metadata sidecar: %w", err)
+	}
+	return nil
+}
+
+// transferSidecar copies or moves the sidecar of src to go with the
+// underlying object dstRemote using do.
+func (f *Fs) transferSidecar(ctx context.Context, src *Object, dstRemote string, do func(context.Context, fs.Object, string) (fs.Object, error)) error {
+	if f.metaMode != metadataModeSidecar {
+		return nil
+	}
+	srcSidecar, err := src.f.Fs.NewObject(ctx, sidecarRemote(src.Object.Remote()))
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		// Remove any stale sidecar at the destination
+		return f.removeSidecar(ctx, dstRemote)
+	} else if err != nil {
+		return err
+	}
+	_, err = do(ctx, srcSidecar, sidecarRemote(dstRemote))
+	if err != nil {
+		return fmt.Errorf("failed to transfer metadata sidecar: %w", err)
+	}
+	return nil
+}
+
+// readMetadata reads and caches the encrypted metadata of the object
+//
+// It returns nil, nil if the object doesn't have any, for example if
+// it was uploaded before metadata encryption was turned on.
+func (o *Object) readMetadata(ctx context.Context) (m *cryptMetadata, err error) {
+	if o.f.metaMode == metadataModeOff {
+		return nil, nil
+	}
+	o.metaMu.Lock()
+	defer o.metaMu.Unlock()
+	if o.metaRead {
+		return o.meta, nil
+	}
+	switch o.f.metaMode {
+	case metadataModeKey:
+		do, ok := o.Object.(fs.Metadataer)
+		if !ok {
+			break
+		}
+		var metadata fs.Metadata
+		metadata, err = do.Metadata(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if s, found := metadata[metadataKey]; found {
+			m, err = o.f.cipher.decryptMetadataString(s)
+		}
+	case metadataModeSidecar:
+		m, err = o.f.readSidecar(ctx, o.Object.Remote())
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.meta, o.metaRead = m, true
+	return m, nil
+}
+
+// writeMetadata encrypts m and writes it to the object
+func (o *Object) writeMetadata(ctx context.Context, m *cryptMetadata) (err error) {
+	switch o.f.metaMode {
+	case metadataModeKey:
+		do, ok := o.Object.(fs.SetMetadataer)
+		if !ok {
+			return fs.ErrorNotImplemented
+		}
+		s, err := o.f.cipher.encryptMetadataString(m)
+		if err != nil {
+			return err
+		}
+		err = do.SetMetadata(ctx, fs.Metadata{metadataKey: s})
+		if err != nil {
+			return err
+		}
+	case metadataModeSidecar:
+		err = o.f.writeSidecar(ctx, o.Object.Remote(), m)
+		if err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	o.setMetadataCache(m)
+	return nil
+}
+
+// cachedMetadata returns the encrypted metadata if it has been read
+func (o *Object) cachedMetadata() *cryptMetadata {
+	o.metaMu.Lock()
+	defer o.metaMu.Unlock()
+	return o.meta
+}
+
+// setMetadataCache sets the cached encrypted metadata
+func (o *Object) setMetadataCache(m *cryptMetadata) {
+	o.metaMu.Lock()
+	o.meta, o.metaRead = m, true
+	o.metaMu.Unlock()
+}
+
+// metadataOrNew returns the encrypted metadata of the object or new
+// metadata made from the underlying object if it doesn't have any.
+func (o *Object) metadataOrNew(ctx context.Context) (*cryptMetadata, error) {
+	m, err := o.readMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = &cryptMetadata{
+			Size:    o.Size(),
+			ModTime: o.Object.ModTime(ctx),
+		}
+		if !o.f.opt.NoDataEncryption {
+			n, err := o.readNonce(ctx)
+			if err != nil {
+				return nil, err
+			}
+			m.setNonce(n)
+		}
+		return m, nil
+	}
+	// copy so the cached value isn't modified
+	newM := *m
+	newM.Nonce = append([]byte(nil), m.Nonce...)
+	newM.Metadata = nil
+	newM.Metadata.Merge(m.Metadata)
+	return &newM, nil
+}
+
+// readNonce reads the nonce from the header of the file data
+func (o *Object) readNonce(ctx context.Context) (*nonce, error) {
+	in, err := o.Object.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fh, err := o.f.cipher.newDecrypter(in)
+	if err != nil {
+		return nil, err
+	}
+	n := fh.initialNonce
+	err = fh.Close()
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
@@ -0,0 +1,142 @@
+package crypt
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMetadataMode(t *testing.T) {
+	withMetadata := &fs.Features{ReadMetadata: true, WriteMetadata: true, UserMetadata: true}
+	withoutMetadata := &fs.Features{ReadMetadata: true, WriteMetadata: true}
+	for _, test := range []struct {
+		in       string
+		features *fs.Features
+		want     metadataMode
+		wantErr  bool
+	}{
+		{"", withMetadata, metadataModeOff, false},
+		{"off", withMetadata, metadataModeOff, false},
+		{"on", withMetadata, metadataModeKey, false},
+		{"on", withoutMetadata, metadataModeSidecar, false},
+		{"sidecar", withMetadata, metadataModeSidecar, false},
+		{"potato", withMetadata, metadataModeOff, true},
+	} {
+		got, err := newMetadataMode(test.in, test.features)
+		if test.wantErr {
+			assert.ErrorIs(t, err, ErrorBadMetadataEncryption, test.in)
+		} else {
+			assert.NoError(t, err, test.in)
+		}
+		assert.Equal(t, test.want, got, test.in)
+	}
+}
+
+func TestEncryptMetadata(t *testing.T) {
+	c, err := newCipher(NameEncryptionStandard, "potato", "", true, nil)
+	require.NoError(t, err)
+	m := &cryptMetadata{
+		Size:     12345,
+		ModTime:  time.Date(2001, 2, 3, 4, 5, 6, 123456789, time.UTC),
+		Metadata: fs.Metadata{"potato": "jersey"},
+	}
+	s, err := c.encryptMetadataString(m)
+	require.NoError(t, err)
+	assert.NotContains(t, s, "jersey")
+
+	// Each encryption uses a new nonce
+	s2, err := c.encryptMetadataString(m)
+	require.NoError(t, err)
+	assert.NotEqual(t, s, s2)
+
+	got, err := c.decryptMetadataString(s)
+	require.NoError(t, err)
+	assert.Equal(t, m.Size, got.Size)
+	assert.True(t, m.ModTime.Equal(got.ModTime))
+	assert.Equal(t, m.Metadata, got.Metadata)
+
+	// Tampering or the wrong key is detected
+	ciphertext, err := c.encryptMetadata(m)
+	require.NoError(t, err)
+	ciphertext[len(ciphertext)-1] ^= 1
+	_, err = c.decryptMetadata(ciphertext)
+	assert.Equal(t, ErrorEncryptedMetadataBad, err)
+	_, err = c.decryptMetadata(ciphertext[:10])
+	assert.Equal(t, ErrorEncryptedMetadataBad, err)
+	c2, err := newCipher(NameEncryptionStandard, "potato2", "", true, nil)
+	require.NoError(t, err)
+	_, err = c2.decryptMetadataString(s)
+	assert.Equal(t, ErrorEncryptedMetadataBad, err)
+	_, err = c.decryptMetadataString("!!!")
+	assert.Error(t, err)
+}
+
+func TestCryptMetadataSetGet(t *testing.T) {
+	m := &cryptMetadata{}
+	require.NoError(t, m.set(fs.Metadata{
+		"mtime":  "2001-02-03T04:05:06.5Z",
+		"potato": "jersey",
+	}))
+	assert.Equal(t, time.Date(2001, 2, 3, 4, 5, 6, 500000000, time.UTC), m.ModTime)
+	assert.Equal(t, fs.Metadata{"potato": "jersey"}, m.Metadata)
+	assert.Equal(t, fs.Metadata{
+		"mtime":  "2001-02-03T04:05:06.5Z",
+		"potato": "jersey",
+	}, m.get())
+	assert.Error(t, m.set(fs.Metadata{"mtime": "potato"}))
+}
+
+func TestCryptMetadataNonce(t *testing.T) {
+	var n1, n2 nonce
+	n1[0], n2[0] = 1, 2
+
+	// Metadata without a nonce isn't checked
+	m := &cryptMetadata{}
+	assert.NoError(t, m.checkNonce(&n1))
+
+	m.setNonce(&n1)
+	assert.NoError(t, m.checkNonce(&n1))
+	assert.Equal(t, ErrorMetadataWrongFile, m.checkNonce(&n2))
+
+	// setNonce takes a copy
+	n1[1] = 1
+	assert.Equal(t, ErrorMetadataWrongFile, m.checkNonce(&n1))
+}
+
+func TestPadReader(t *testing.T) {
+	f := &Fs{opt: Options{SizePadding: 100}}
+	for _, test := range []struct {
+		in   int
+		want int64
+	}{
+		{0, 100},
+		{1, 100},
+		{99, 100},
+		{100, 100},
+		{101, 200},
+		{1000, 1000},
+	} {
+		assert.Equal(t, test.want, f.paddedSize(int64(test.in)))
+		in := bytes.Repeat([]byte{'x'}, test.in)
+		p := f.newPadReader(bytes.NewReader(in))
+		out, err := io.ReadAll(p)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, int64(len(out)))
+		assert.Equal(t, in, out[:test.in])
+		assert.Equal(t, make([]byte, len(out)-test.in), out[test.in:])
+		assert.Equal(t, int64(test.in), p.n)
+	}
+
+	// Unknown sizes aren't padded
+	assert.Equal(t, int64(-1), f.paddedSize(-1))
+
+	// No padding
+	f.opt.SizePadding = 0
+	assert.Equal(t, int64(0), f.paddedSize(0))
+	assert.Equal(t, int64(101), f.paddedSize(101))
+}
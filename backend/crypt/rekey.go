@@ -0,0 +1,347 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/readers"
+)
+
+// errRekeySkip is returned when a file doesn't need rekeying
+var errRekeySkip = errors.New("file doesn't need rekeying")
+
+// rekeyStats is the result of the rekey command
+type rekeyStats struct {
+	Rekeyed   int `json:"rekeyed"`
+	Unchanged int `json:"unchanged"`
+	Skipped   int `json:"skipped"`
+	Errors    int `json:"errors"`
+}
+
+// rekey rewraps the file keys of all the files with the current
+// master keys
+func (f *Fs) rekey(ctx context.Context, opt map[string]string) (out interface{}, err error) {
+	if !f.cipher.envelope {
+		return nil, errors.New("rekey needs the envelope option to be set")
+	}
+	if f.opt.NoDataEncryption {
+		return nil, errors.New("rekey can't be used with no_data_encryption")
+	}
+	convert := false
+	if s, ok := opt["convert"]; ok {
+		convert = s == "" || s == "true"
+	}
+	// Unwrap with the current keys and any old identities
+	keys := f.cipher.keys
+	keys.identities = append([]*x25519Identity(nil), keys.identities...)
+	if s, ok := opt["old_identity"]; ok {
+		var identities fs.CommaSepList
+		err = identities.Set(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad old_identity: %w", err)
+		}
+		for _, identity := range identities {
+			err = keys.addIdentity(identity)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	var (
+		mu    sync.Mutex
+		stats rekeyStats
+	)
+	// fs/operations imports this backend so walk the objects directly
+	err = walk.ListR(ctx, f, "", false, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		entries.ForObject(func(obj fs.Object) {
+			o, ok := obj.(*Object)
+			if !ok {
+				return
+			}
+			f.rekeyOne(ctx, o, &keys, convert, &mu, &stats)
+		})
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	fs.Infof(f, "Rekeyed %d files, %d unchanged, %d skipped, %d errors", stats.Rekeyed, stats.Unchanged, stats.Skipped, stats.Errors)
+	if stats.Errors != 0 {
+		return stats, fmt.Errorf("failed to rekey %d files", stats.Errors)
+	}
+	return stats, nil
+}
+
+// rekeyOne rekeys o recording the result in stats
+func (f *Fs) rekeyOne(ctx context.Context, o *Object, keys *masterKeys, convert bool, mu *sync.Mutex, stats *rekeyStats) {
+	tr := accounting.Stats(ctx).NewCheckingTransfer(o, "rekeying")
+	err := f.rekeyObject(ctx, o, keys, convert)
+	mu.Lock()
+	switch {
+	case err == nil:
+		stats.Rekeyed++
+	case err == errRekeySkip:
+		stats.Unchanged++
+		err = nil
+	case errors.Is(err, ErrorEncryptedBadMagic) || err == errRekeyLegacy:
+		stats.Skipped++
+		fs.Infof(o, "Skipping: %v", err)
+		err = nil
+	default:
+		stats.Errors++
+		fs.Errorf(o, "Failed to rekey: %v", err)
+	}
+	mu.Unlock()
+	tr.Done(ctx, err)
+}
+
+// errRekeyLegacy is returned for files in the original format if not converting
+var errRekeyLegacy = errors.New("file is in the original format - use -o convert=true to convert it")
+
+// sameKeyIDs returns true if a and b have the same IDs in any order
+func sameKeyIDs(a, b []keyID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[keyID]int, len(a))
+	for _, id := range a {
+		set[id]++
+	}
+	for _, id := range b {
+		if set[id] == 0 {
+			return false
+		}
+		set[id]--
+	}
+	return true
+}
+
+// rekeyObject rewrites the header of o wrapping its file key with the
+// current master keys
+//
+// Files in the original format are converted to the envelope format
+// if convert is set.
+//
+// It returns errRekeySkip if o doesn't need rewriting.
+func (f *Fs) rekeyObject(ctx context.Context, o *Object, keys *masterKeys, convert bool) (err error) {
+	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: 0, End: int64(envelopeHeaderSize) - 1})
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	buf := make([]byte, envelopeHeaderSize)
+	n, err := readers.ReadFill(in, buf)
+	_ = in.Close()
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	buf = buf[:n]
+	if len(buf) < fileHeaderSize {
+		return ErrorEncryptedFileTooShort
+	}
+	switch {
+	case bytes.Equal(buf[:fileMagicSize], envelopeMagicBytes):
+	case bytes.Equal(buf[:fileMagicSize], fileMagicBytes):
+		if !convert {
+			return errRekeyLegacy
+		}
+		if fs.GetConfig(ctx).DryRun {
+			fs.Logf(o, "Not converting as --dry-run is set")
+			return nil
+		}
+		return f.convertObject(ctx, o)
+	default:
+		return ErrorEncryptedBadMagic
+	}
+	if len(buf) < envelopeHeaderSize {
+		return ErrorEncryptedFileTooShort
+	}
+	var (
+		env        envelope
+		nonceBytes = buf[fileMagicSize:fileHeaderSize]
+		slots      = buf[fileHeaderSize:envelopeHeaderSize]
+	)
+	if sameKeyIDs(slotIDs(slots), f.cipher.keys.recipientIDs()) {
+		return errRekeySkip
+	}
+	env.key, err = keys.unwrap(slots)
+	if err != nil {
+		return err
+	}
+	if fs.GetConfig(ctx).DryRun {
+		fs.Logf(o, "Not rekeying as --dry-run is set")
+		return nil
+	}
+	err = f.cipher.keys.wrap(f.cipher.cryptoRand, &env.key, &env.slots)
+	if err != nil {
+		return err
+	}
+
+	// Spool the new header and the old data to a temporary file
+	// as the object can't be read while it is being updated
+	tmp, err := newRekeyTemp()
+	if err != nil {
+		return err
+	}
+	defer removeRekeyTemp(tmp)
+	header := make([]byte, 0, envelopeHeaderSize)
+	header = append(header, envelopeMagicBytes...)
+	header = append(header, nonceBytes...)
+	header = append(header, env.slots[:]...)
+	_, err = tmp.Write(header)
+	if err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if int64(envelopeHeaderSize) < o.Object.Size() || o.Object.Size() < 0 {
+		in, err = o.Object.Open(ctx, &fs.SeekOption{Offset: int64(envelopeHeaderSize)})
+		if err != nil {
+			return fmt.Errorf("failed to read data: %w", err)
+		}
+		_, err = io.Copy(tmp, in)
+		_ = in.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read data: %w", err)
+		}
+	}
+	return f.rekeyUpload(ctx, o, tmp, nil)
+}
+
+// convertObject re-encrypts o, which is in the original format, in
+// the envelope format
+//
+// The data is encrypted again with a new random file key and nonce
+// rather than the data key derived from the password so the password
+// alone can't decrypt it afterwards.
+func (f *Fs) convertObject(ctx context.Context, o *Object) (err error) {
+	meta, err := o.readMetadata(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read encrypted metadata: %w", err)
+	}
+	in, err := o.Object.Open(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read data: %w", err)
+	}
+	fh, err := f.cipher.newDecrypter(in)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(fh, &err)
+	encrypter, err := f.cipher.newEncrypter(fh, nil)
+	if err != nil {
+		return err
+	}
+	dataNonce := encrypter.nonce
+
+	// Spool the re-encrypted data to a temporary file as the
+	// object can't be read while it is being updated
+	tmp, err := newRekeyTemp()
+	if err != nil {
+		return err
+	}
+	defer removeRekeyTemp(tmp)
+	_, err = io.Copy(tmp, encrypter)
+	if err != nil {
+		return fmt.Errorf("failed to convert data: %w", err)
+	}
+	if meta == nil {
+		return f.rekeyUpload(ctx, o, tmp, nil)
+	}
+
+	// Bind the encrypted metadata to the new data
+	newMeta := *meta
+	newMeta.setNonce(&dataNonce)
+	if f.metaMode == metadataModeKey {
+		// The metadata is uploaded with the data
+		return f.rekeyUpload(ctx, o, tmp, &newMeta)
+	}
+
+	// Otherwise stage the new nonce in the metadata first so it
+	// matches the data whether the upload works or not, then
+	// commit it when the upload has finished.
+	stagedMeta := *meta
+	stagedMeta.setNewNonce(&dataNonce)
+	err = o.writeMetadata(ctx, &stagedMeta)
+	if err != nil {
+		return fmt.Errorf("failed to write encrypted metadata: %w", err)
+	}
+	err = f.rekeyUpload(ctx, o, tmp, nil)
+	if err != nil {
+		return err
+	}
+	err = o.writeMetadata(ctx, &newMeta)
+	if err != nil {
+		return fmt.Errorf("failed to write encrypted metadata: %w", err)
+	}
+	return nil
+}
+
+// newRekeyTemp makes a temporary file to spool the new contents of
+// an object to
+func newRekeyTemp() (*os.File, error) {
+	tmp, err := os.CreateTemp("", "rclone-crypt-rekey-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to make temporary file: %w", err)
+	}
+	return tmp, nil
+}
+
+// removeRekeyTemp closes and removes the temporary file
+func removeRekeyTemp(tmp *os.File) {
+	_ = tmp.Close()
+	_ = os.Remove(tmp.Name())
+}
+
+// rekeyUpload replaces the contents of o with what has been written
+// to tmp keeping its modification time and metadata.
+//
+// If meta is set it replaces the encrypted metadata, which must be
+// stored in the metadataKey.
+func (f *Fs) rekeyUpload(ctx context.Context, o *Object, tmp *os.File, meta *cryptMetadata) error {
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	src := object.NewStaticObjectInfo(o.Object.Remote(), o.Object.ModTime(ctx), size, true, nil, o.Object.Fs())
+	if f.Fs.Features().WriteMetadata {
+		metadata, err := fs.GetMetadata(ctx, o.Object)
+		if err != nil {
+			return fmt.Errorf("failed to read metadata: %w", err)
+		}
+		if meta != nil {
+			s, err := f.cipher.encryptMetadataString(meta)
+			if err != nil {
+				return err
+			}
+			if metadata == nil {
+				metadata = fs.Metadata{}
+			}
+			metadata[metadataKey] = s
+		}
+		if metadata != nil {
+			var ci *fs.ConfigInfo
+			ctx, ci = fs.AddConfig(ctx)
+			ci.Metadata = true
+			src = src.WithMetadata(metadata)
+		}
+	}
+	err = o.Object.Update(ctx, tmp, src)
+	if err != nil {
+		return err
+	}
+	if meta != nil {
+		o.setMetadataCache(meta)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package crypt
+
+// This is an implementation of AES-SIV from RFC 5297 used for the
+// "siv" file name encryption mode.
+//
+// AES-SIV is a deterministic authenticated encryption mode - the
+// same plaintext always encrypts to the same ciphertext, which file
+// names need, but any change to the ciphertext is detected.
+
+import (
+	"crypto/aes"
+	gocipher "crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+const sivSize = aes.BlockSize // size of the synthetic IV
+
+// Errors returned by siv
+var (
+	ErrorSIVTooShort   = errors.New("file name too short for siv decryption")
+	ErrorSIVAuthFailed = errors.New("file name failed authentication - bad password or tampered?")
+	ErrorSIVBadPadding = errors.New("bad file name padding after siv decryption")
+)
+
+// siv encrypts with AES-SIV
+type siv struct {
+	mac gocipher.Block // key for S2V
+	ctr gocipher.Block // key for CTR
+	k1  [aes.BlockSize]byte
+	k2  [aes.BlockSize]byte
+}
+
+// newSIV makes an AES-SIV cipher from the two keys which should be
+// 16, 24 or 32 bytes long
+func newSIV(macKey, ctrKey []byte) (*siv, error) {
+	mac, err := aes.NewCipher(macKey)
+	if err != nil {
+		return nil, err
+	}
+	ctr, err := aes.NewCipher(ctrKey)
+	if err != nil {
+		return nil, err
+	}
+	s := &siv{mac: mac, ctr: ctr}
+	// CMAC subkeys from RFC 4493
+	var l [aes.BlockSize]byte
+	mac.Encrypt(l[:], l[:])
+	s.k1 = dbl(l)
+	s.k2 = dbl(s.k1)
+	return s, nil
+}
+
+// dbl doubles x in GF(2^128)
+func dbl(x [aes.BlockSize]byte) (out [aes.BlockSize]byte) {
+	var carry byte
+	for i := aes.BlockSize - 1; i >= 0; i-- {
+		out[i] = x[i]<<1 | carry
+		carry = x[i] >> 7
+	}
+	if carry != 0 {
+		out[aes.BlockSize-1] ^= 0x87
+	}
+	return out
+}
+
+// xorBlock sets dst to dst xor src
+func xorBlock(dst *[aes.BlockSize]byte, src []byte) {
+	for i := range src {
+		dst[i] ^= src[i]
+	}
+}
+
+// cmac computes the AES-CMAC of msg from RFC 4493
+func (s *siv) cmac(msg []byte) (out [aes.BlockSize]byte) {
+	n := (len(msg) + aes.BlockSize - 1) / aes.BlockSize
+	complete := n > 0 && len(msg)%aes.BlockSize == 0
+	if n == 0 {
+		n = 1
+	}
+	for i := 0; i < n-1; i++ {
+		xorBlock(&out, msg[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		s.mac.Encrypt(out[:], out[:])
+	}
+	last := msg[(n-1)*aes.BlockSize:]
+	if complete {
+		xorBlock(&out, last)
+		xorBlock(&out, s.k1[:])
+	} else {
+		var padded [aes.BlockSize]byte
+		copy(padded[:], last)
+		padded[len(last)] = 0x80
+		xorBlock(&out, padded[:])
+		xorBlock(&out, s.k2[:])
+	}
+	s.mac.Encrypt(out[:], out[:])
+	return out
+}
+
+// s2v computes the synthetic IV of the associated data and plaintext
+func (s *siv) s2v(ad [][]byte, plaintext []byte) [aes.BlockSize]byte {
+	var zero [aes.BlockSize]byte
+	d := s.cmac(zero[:])
+	for _, a := range ad {
+		d = dbl(d)
+		mac := s.cmac(a)
+		xorBlock(&d, mac[:])
+	}
+	if len(plaintext) >= aes.BlockSize {
+		t := make([]byte, len(plaintext))
+		copy(t, plaintext)
+		end := t[len(t)-aes.BlockSize:]
+		for i := range end {
+			end[i] ^= d[i]
+		}
+		return s.cmac(t)
+	}
+	d = dbl(d)
+	var padded [aes.BlockSize]byte
+	copy(padded[:], plaintext)
+	padded[len(plaintext)] = 0x80
+	xorBlock(&d, padded[:])
+	return s.cmac(d[:])
+}
+
+// ctrStream makes the CTR stream for the synthetic IV v
+func (s *siv) ctrStream(v [aes.BlockSize]byte) gocipher.Stream {
+	// Clear the 31st and 63rd bits as per the RFC
+	v[8] &= 0x7f
+	v[12] &= 0x7f
+	return gocipher.NewCTR(s.ctr, v[:])
+}
+
+// seal encrypts plaintext returning the synthetic IV followed by
+// the ciphertext
+func (s *siv) seal(ad [][]byte, plaintext []byte) []byte {
+	v := s.s2v(ad, plaintext)
+	out := make([]byte, sivSize+len(plaintext))
+	copy(out, v[:])
+	s.ctrStream(v).XORKeyStream(out[sivSize:], plaintext)
+	return out
+}
+
+// open decrypts and authenticates ciphertext made by seal
+func (s *siv) open(ad [][]byte, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < sivSize {
+		return nil, ErrorSIVTooShort
+	}
+	var v [aes.BlockSize]byte
+	copy(v[:], ciphertext)
+	plaintext := make([]byte, len(ciphertext)-sivSize)
+	s.ctrStream(v).XORKeyStream(plaintext, ciphertext[sivSize:])
+	want := s.s2v(ad, plaintext)
+	if subtle.ConstantTimeCompare(want[:], v[:]) != 1 {
+		return nil, ErrorSIVAuthFailed
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,117 @@
+package crypt
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	require.NoError(t, err)
+	return b
+}
+
+// Test vectors from RFC 4493
+func TestSIVCMAC(t *testing.T) {
+	key := mustHex(t, "2b7e1516 28aed2a6 abf71588 09cf4f3c")
+	s, err := newSIV(key, key)
+	require.NoError(t, err)
+	msg := mustHex(t, "6bc1bee2 2e409f96 e93d7e11 7393172a ae2d8a57 1e03ac9c 9eb76fac 45af8e51 30c81c46 a35ce411")
+	for _, test := range []struct {
+		n    int
+		want string
+	}{
+		{0, "bb1d6929 e9593728 7fa37d12 9b756746"},
+		{16, "070a16b4 6b4d4144 f79bdd9d d04a287c"},
+		{40, "dfa66747 de9ae630 30ca3261 1497c827"},
+	} {
+		got := s.cmac(msg[:test.n])
+		assert.Equal(t, mustHex(t, test.want), got[:], test.n)
+	}
+}
+
+// Test vector from RFC 5297 A.1
+func TestSIVSealOpen(t *testing.T) {
+	key := mustHex(t, "fffefdfc fbfaf9f8 f7f6f5f4 f3f2f1f0 f0f1f2f3 f4f5f6f7 f8f9fafb fcfdfeff")
+	s, err := newSIV(key[:16], key[16:])
+	require.NoError(t, err)
+	ad := [][]byte{mustHex(t, "10111213 14151617 18191a1b 1c1d1e1f 20212223 24252627")}
+	plaintext := mustHex(t, "11223344 55667788 99aabbcc ddee")
+	want := mustHex(t, "85632d07 c6e8f37f 950acd32 0a2ecc93 40c02b96 90c4dc04 daef7f6a fe5c")
+	got := s.seal(ad, plaintext)
+	assert.Equal(t, want, got)
+
+	decrypted, err := s.open(ad, got)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	// Tampering is detected
+	for i := range got {
+		got[i] ^= 1
+		_, err = s.open(ad, got)
+		assert.Equal(t, ErrorSIVAuthFailed, err, i)
+		got[i] ^= 1
+	}
+	_, err = s.open(ad, got[:sivSize-1])
+	assert.Equal(t, ErrorSIVTooShort, err)
+}
+
+func TestEncryptDecryptSegmentSIV(t *testing.T) {
+	enc, err := NewNameEncoding("base32")
+	require.NoError(t, err)
+	c, err := newCipher(NameEncryptionSIV, "", "", true, enc)
+	require.NoError(t, err)
+
+	for _, in := range []string{"1", "12345678901234", "123456789012345", "1234567890123456", "potato", "Hello, 世界"} {
+		for _, padding := range []int{0, 1, 16, 64} {
+			require.NoError(t, c.setNamePadding(padding))
+			encrypted := c.encryptSegmentSIV(in)
+			assert.NotEqual(t, in, encrypted)
+			assert.Equal(t, encrypted, c.encryptSegmentSIV(in), "deterministic")
+			raw, err := enc.DecodeString(encrypted)
+			require.NoError(t, err)
+			if padding > 1 {
+				assert.Equal(t, 0, (len(raw)-sivSize)%padding)
+			} else {
+				assert.Equal(t, sivSize+len(in)+1, len(raw))
+			}
+
+			// Decrypts whatever the padding is set to
+			require.NoError(t, c.setNamePadding(16))
+			decrypted, err := c.decryptSegmentSIV(encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, in, decrypted)
+		}
+	}
+	assert.Error(t, c.setNamePadding(-1))
+
+	// Tampering and rubbish is detected
+	encrypted := c.encryptSegmentSIV("potato")
+	raw, err := enc.DecodeString(encrypted)
+	require.NoError(t, err)
+	raw[len(raw)-1] ^= 1
+	_, err = c.decryptSegmentSIV(enc.EncodeToString(raw))
+	assert.Equal(t, ErrorSIVAuthFailed, err)
+	_, err = c.decryptSegmentSIV(enc.EncodeToString(raw[:sivSize]))
+	assert.Equal(t, ErrorTooShortAfterDecode, err)
+	_, err = c.decryptSegmentSIV("!!")
+	assert.Error(t, err)
+
+	// A different key doesn't decrypt it
+	c2, err := newCipher(NameEncryptionSIV, "potato", "", true, enc)
+	require.NoError(t, err)
+	_, err = c2.decryptSegmentSIV(encrypted)
+	assert.Equal(t, ErrorSIVAuthFailed, err)
+
+	// Full paths
+	for _, in := range []string{"a/b/c", "dir/file.txt", "file-v2001-02-03-040506-123.txt"} {
+		encrypted := c.EncryptFileName(in)
+		decrypted, err := c.DecryptFileName(encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, in, decrypted)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"strconv"
+	"strings"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
@@ -36,6 +38,18 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 			return nil, errors.New("please provide checksum type and path to sum file")
 		}
 		return nil, f.dbImport(ctx, arg[0], arg[1], sticky)
+	case "scrub":
+		verify := f.opt.ScrubVerify
+		if s, ok := opt["verify"]; ok {
+			if verify, err = strconv.Atoi(strings.TrimSuffix(s, "%")); err != nil {
+				return nil, fmt.Errorf("invalid verify percentage %q: %w", s, err)
+			}
+		}
+		if f.db == nil {
+			fs.Errorf(f, "scrub needs checksum cache (disabled with max_age = 0)")
+			return nil, kv.ErrInactive
+		}
+		return f.scrub(ctx, verify)
 	default:
 		return nil, fs.ErrorCommandNotFound
 	}
@@ -70,6 +84,29 @@ Usage Example:
 Usage Example:
     rclone backend stickyimport hasher:subdir md5 remote:path/to/sum.md5
 `,
+}, {
+	Name:  "scrub",
+	Short: "Populate missing checksums and verify stored ones",
+	Long: `Walk the underlying remote, calculate checksums for files which
+have none cached (or whose cached ones are stale) and re-read some of
+the files with cached checksums to verify them.
+
+Files verified longest ago are picked first. A file whose data no
+longer matches its cached checksums, although its size and modification
+time are unchanged, is reported as an error (bit-rot or silent change)
+and its cached checksums are kept for later comparison.
+
+Usage Example:
+    rclone backend scrub hasher:subdir
+    rclone backend scrub hasher:subdir -o verify=100
+
+The result is a JSON summary with counts of checked, populated,
+verified and changed files, the list of corrupted files and the
+number of errors.
+`,
+	Opts: map[string]string{
+		"verify": "Percentage of cached checksums to verify (default from scrub_verify)",
+	},
 }}
 
 func (f *Fs) dbDump(ctx context.Context, full bool, root string) error {
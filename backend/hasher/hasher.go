@@ -50,6 +50,26 @@ func init() {
 			Advanced: true,
 			Default:  fs.SizeSuffix(0),
 			Help:     "Auto-update checksum for files smaller than this size (disabled by default).",
+		}, {
+			Name:     "scrub_interval",
+			Advanced: true,
+			Default:  fs.Duration(0),
+			Help: `Interval between background scrub passes (0 = disabled).
+
+When set, hasher periodically walks the underlying remote, calculates
+missing checksums and re-verifies some of the stored ones, reporting
+any object whose data no longer matches as an error.
+
+This only makes sense for long running commands like mount or serve
+and requires the checksum cache (max_age must not be 0).`,
+		}, {
+			Name:     "scrub_verify",
+			Advanced: true,
+			Default:  10,
+			Help: `Percentage of stored checksums to re-verify on each scrub pass.
+
+Objects verified longest ago are checked first, so with the default
+of 10 every object is re-read at least once in 10 passes.`,
 		}},
 	})
 }
@@ -60,6 +80,9 @@ type Options struct {
 	Hashes   fs.CommaSepList `config:"hashes"`
 	AutoSize fs.SizeSuffix   `config:"auto_size"`
 	MaxAge   fs.Duration     `config:"max_age"`
+	// scrubbing
+	ScrubInterval fs.Duration `config:"scrub_interval"`
+	ScrubVerify   int         `config:"scrub_verify"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -80,6 +103,9 @@ type Fs struct {
 	slowHashes hash.Set // passed to the base and then cached
 	autoHashes hash.Set // calculated in-house and cached
 	keepHashes hash.Set // checksums to keep in cache (slow + auto)
+	// background scrubbing
+	scrubCancel context.CancelFunc
+	scrubDone   chan struct{}
 }
 
 var warnExperimental sync.Once
@@ -99,6 +125,9 @@ func NewFs(ctx context.Context, fsname, rpath string, cmap configmap.Mapper) (fs
 		return nil, err
 	}
 
+	if opt.ScrubVerify < 0 || opt.ScrubVerify > 100 {
+		return nil, fmt.Errorf("scrub_verify must be between 0 and 100, got %d", opt.ScrubVerify)
+	}
 	if strings.HasPrefix(opt.Remote, fsname+":") {
 		return nil, errors.New("can't point remote at itself")
 	}
@@ -182,6 +211,17 @@ func NewFs(ctx context.Context, fsname, rpath string, cmap configmap.Mapper) (fs
 	}
 	f.features = stubFeatures.Fill(ctx, f).Mask(ctx, f.Fs).WrapsFs(f, f.Fs)
 
+	if interval := time.Duration(f.opt.ScrubInterval); interval > 0 {
+		if f.db == nil {
+			fs.Errorf(f, "background scrub needs checksum cache (disabled with max_age = 0)")
+		} else {
+			scrubCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+			f.scrubCancel = cancel
+			f.scrubDone = make(chan struct{})
+			go f.scrubLoop(scrubCtx, interval)
+		}
+	}
+
 	cache.PinUntilFinalized(f.Fs, f)
 	return f, err
 }
@@ -439,6 +479,11 @@ func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string
 
 // Shutdown the backend, closing any background tasks and any cached connections.
 func (f *Fs) Shutdown(ctx context.Context) (err error) {
+	if f.scrubCancel != nil {
+		f.scrubCancel()
+		<-f.scrubDone
+		f.scrubCancel = nil
+	}
 	if f.db != nil && !f.db.IsStopped() {
 		err = f.db.Stop(false)
 	}
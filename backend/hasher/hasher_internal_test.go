@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
@@ -69,12 +72,58 @@ func (f *Fs) testUploadFromCrypt(t *testing.T) {
 	_ = operations.Purge(ctx, f, dirName)
 }
 
+func (f *Fs) testScrub(t *testing.T) {
+	if f.db == nil {
+		t.Skip("checksum cache is disabled")
+	}
+	ctx := context.Background()
+	const dirName = "scrub_1"
+	good := putFile(ctx, t, f, dirName+"/good", "good data")
+	bad := putFile(ctx, t, f, dirName+"/bad", "good data")
+	defer func() {
+		_ = operations.Purge(ctx, f, dirName)
+		accounting.GlobalStats().ResetErrors()
+	}()
+
+	// Forget checksums of one file, scrub should bring them back
+	require.NoError(t, f.pruneHash(good.Remote()))
+	hashType := f.keepHashes.GetOne()
+	_, err := good.(*Object).getHash(ctx, hashType)
+	assert.Error(t, err)
+
+	res, err := f.scrub(ctx, 0)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, res.Populated, 1)
+	assert.Empty(t, res.Corrupted)
+	sum, err := good.(*Object).getHash(ctx, hashType)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, sum)
+
+	// Change data under the hasher keeping size and modification time
+	baseObj, err := f.Fs.NewObject(ctx, bad.Remote())
+	require.NoError(t, err)
+	const newData = "evil data"
+	src := object.NewStaticObjectInfo(bad.Remote(), baseObj.ModTime(ctx), int64(len(newData)), true, nil, nil)
+	require.NoError(t, baseObj.Update(ctx, strings.NewReader(newData), src))
+
+	res, err = f.scrub(ctx, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []string{bad.Remote()}, res.Corrupted)
+	assert.GreaterOrEqual(t, res.Verified, 1)
+
+	// Corrupted files stay reported until their checksums are refreshed
+	res, err = f.scrub(ctx, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []string{bad.Remote()}, res.Corrupted)
+}
+
 // InternalTest dispatches all internal tests
 func (f *Fs) InternalTest(t *testing.T) {
 	if !kv.Supported() {
 		t.Skip("hasher is not supported on this OS")
 	}
 	t.Run("UploadFromCrypt", f.testUploadFromCrypt)
+	t.Run("Scrub", f.testScrub)
 }
 
 var _ fstests.InternalTester = (*Fs)(nil)
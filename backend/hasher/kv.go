@@ -23,9 +23,10 @@ const (
 type hashMap map[hash.Type]string
 
 type hashRecord struct {
-	Fp      string // fingerprint
-	Hashes  operations.HashSums
-	Created time.Time
+	Fp       string // fingerprint
+	Hashes   operations.HashSums
+	Created  time.Time
+	Verified time.Time // last time hashes were checked against data
 }
 
 func (r *hashRecord) encode(key string) ([]byte, error) {
@@ -207,6 +208,60 @@ func (op *kvPut) Do(ctx context.Context, b kv.Bucket) (err error) {
 	return err
 }
 
+// kvRecord: get the whole record for an object by key
+type kvRecord struct {
+	key   string
+	rec   hashRecord
+	found bool
+}
+
+func (op *kvRecord) Do(ctx context.Context, b kv.Bucket) error {
+	data := b.Get([]byte(op.key))
+	if len(data) == 0 {
+		return nil
+	}
+	if err := op.rec.decode(op.key, data); err != nil {
+		return nil
+	}
+	op.found = true
+	return nil
+}
+
+// kvVerified: replace hashes for an object calculated from its data
+type kvVerified struct {
+	key    string
+	fp     string
+	hashes operations.HashSums
+	renew  bool
+}
+
+func (op *kvVerified) Do(ctx context.Context, b kv.Bucket) (err error) {
+	var r hashRecord
+	if data := b.Get([]byte(op.key)); len(data) > 0 {
+		if err = r.decode(op.key, data); err != nil || r.Fp != op.fp {
+			r.Hashes = nil
+		}
+	}
+	now := time.Now()
+	if len(r.Hashes) == 0 || op.renew {
+		r.Created = now
+		r.Hashes = operations.HashSums{}
+	}
+	r.Fp = op.fp
+	r.Verified = now
+	for hashType, hashVal := range op.hashes {
+		r.Hashes[hashType] = hashVal
+	}
+	data, err := r.encode(op.key)
+	if err != nil {
+		return fmt.Errorf("marshal failed: %w", err)
+	}
+	if err = b.Put([]byte(op.key), data); err != nil {
+		return fmt.Errorf("put failed: %w", err)
+	}
+	return nil
+}
+
 // kvDump: dump the database.
 // Note: long dump can cause concurrent operations to fail.
 type kvDump struct {
@@ -0,0 +1,282 @@
+package hasher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// ScrubResult summarizes a scrub pass
+type ScrubResult struct {
+	Checked   int      `json:"checked"`   // objects looked at
+	Populated int      `json:"populated"` // objects with missing or stale checksums filled in
+	Verified  int      `json:"verified"`  // objects re-read and found matching their checksums
+	Changed   int      `json:"changed"`   // objects modified since their checksums were taken
+	Corrupted []string `json:"corrupted"` // objects whose data no longer matches their checksums
+	Errors    int      `json:"errors"`    // objects which could not be read or updated
+}
+
+// scrub job kinds
+const (
+	scrubPopulate = iota // calculate and store checksums
+	scrubVerify          // compare data with stored checksums
+)
+
+type scrubJob struct {
+	o    *Object
+	key  string
+	fp   string
+	kind int
+	rec  hashRecord
+}
+
+// scrub walks the base remote, populates missing checksums and
+// re-verifies verifyPercent percent of the stored ones, oldest first.
+func (f *Fs) scrub(ctx context.Context, verifyPercent int) (*ScrubResult, error) {
+	if f.db == nil {
+		return nil, kv.ErrInactive
+	}
+	if verifyPercent < 0 || verifyPercent > 100 {
+		return nil, fmt.Errorf("verify percentage must be between 0 and 100, got %d", verifyPercent)
+	}
+	maxAge := time.Duration(f.opt.MaxAge)
+	res := &ScrubResult{Corrupted: []string{}}
+	var (
+		jobs       []*scrubJob
+		candidates []*scrubJob
+		mu         sync.Mutex
+	)
+
+	err := operations.ListFn(ctx, f, func(obj fs.Object) {
+		o, ok := obj.(*Object)
+		if !ok {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		res.Checked++
+		job := &scrubJob{
+			o:   o,
+			key: path.Join(f.Fs.Root(), o.Remote()),
+			fp:  o.fingerprint(ctx),
+		}
+		if job.fp == "" {
+			fs.Errorf(o, "scrub: fingerprint failed")
+			res.Errors++
+			return
+		}
+		op := &kvRecord{key: job.key}
+		if err := f.db.Do(false, op); err != nil {
+			fs.Errorf(o, "scrub: failed to read checksums: %v", err)
+			res.Errors++
+			return
+		}
+		job.rec = op.rec
+		switch {
+		case !op.found || time.Since(op.rec.Created) > maxAge || !f.hasKeepHashes(&op.rec):
+			job.kind = scrubPopulate
+			jobs = append(jobs, job)
+		case op.rec.Fp == anyFingerprint:
+			// imported without fingerprint - always bind to the data
+			job.kind = scrubVerify
+			jobs = append(jobs, job)
+		case op.rec.Fp != job.fp:
+			if f.silentChange(op.rec.Fp, job.fp) {
+				err := fmt.Errorf("content changed without size or modification time change (fingerprint %q, was %q)", job.fp, op.rec.Fp)
+				fs.Errorf(o, "scrub: %v", err)
+				_ = fs.CountError(ctx, err)
+				res.Corrupted = append(res.Corrupted, o.Remote())
+				return
+			}
+			fs.Debugf(o, "scrub: modified since checksums were taken")
+			res.Changed++
+			job.kind = scrubPopulate
+			jobs = append(jobs, job)
+		default:
+			job.kind = scrubVerify
+			candidates = append(candidates, job)
+		}
+	})
+	if err != nil {
+		return res, err
+	}
+
+	// Verify the objects checked longest ago first so that
+	// repeated passes cycle through the whole remote.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].rec.Verified.Before(candidates[j].rec.Verified)
+	})
+	numVerify := (len(candidates)*verifyPercent + 99) / 100
+	jobs = append(jobs, candidates[:numVerify]...)
+	fs.Debugf(f, "scrub: %d objects, %d to hash, %d of %d to verify",
+		res.Checked, len(jobs)-numVerify, numVerify, len(candidates))
+
+	in := make(chan *scrubJob)
+	var wg sync.WaitGroup
+	checkers := fs.GetConfig(ctx).Checkers
+	if checkers < 1 {
+		checkers = 1
+	}
+	for i := 0; i < checkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range in {
+				kind, err := f.scrubObject(ctx, job)
+				mu.Lock()
+				switch {
+				case errors.Is(err, errScrubMismatch):
+					res.Corrupted = append(res.Corrupted, job.o.Remote())
+				case err != nil:
+					res.Errors++
+				case kind == scrubPopulate:
+					res.Populated++
+				default:
+					res.Verified++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			break
+		}
+		in <- job
+	}
+	close(in)
+	wg.Wait()
+	sort.Strings(res.Corrupted)
+	return res, ctx.Err()
+}
+
+var errScrubMismatch = errors.New("checksum mismatch")
+
+// scrubObject reads a single object and either stores its checksums
+// or compares them with the recorded ones.
+func (f *Fs) scrubObject(ctx context.Context, job *scrubJob) (kind int, err error) {
+	o := job.o
+	kind = job.kind
+	tr := accounting.Stats(ctx).NewCheckingTransfer(o, "scrubbing")
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+
+	sums, err := f.readHashes(ctx, tr, o)
+	if err != nil {
+		fs.Errorf(o, "scrub: failed to read: %v", err)
+		return kind, err
+	}
+
+	if kind == scrubVerify {
+		for hashName, stored := range job.rec.Hashes {
+			actual, found := sums[hashName]
+			if !found || stored == "" || actual == stored {
+				continue
+			}
+			err = fmt.Errorf("%w: %s is %s, expected %s (bit-rot or silent change)", errScrubMismatch, hashName, actual, stored)
+			fs.Errorf(o, "scrub: %v", err)
+			return kind, err
+		}
+	}
+
+	err = f.db.Do(true, &kvVerified{
+		key:    job.key,
+		fp:     job.fp,
+		hashes: sums,
+		renew:  kind == scrubPopulate,
+	})
+	if err != nil {
+		fs.Errorf(o, "scrub: failed to update checksums: %v", err)
+	}
+	return kind, err
+}
+
+// readHashes calculates checksums of the object data
+func (f *Fs) readHashes(ctx context.Context, tr *accounting.Transfer, o *Object) (operations.HashSums, error) {
+	hasher, err := hash.NewMultiHasherTypes(f.keepHashes)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := o.Object.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	in := tr.Account(ctx, rc)
+	_, err = io.Copy(hasher, in)
+	if closeErr := in.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	sums := operations.HashSums{}
+	for hashType, hashVal := range hasher.Sums() {
+		sums[hashType.String()] = hashVal
+	}
+	return sums, nil
+}
+
+// hasKeepHashes returns true if the record holds all cached hash types
+func (f *Fs) hasKeepHashes(r *hashRecord) bool {
+	for _, hashType := range f.keepHashes.Array() {
+		if r.Hashes[hashType.String()] == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// silentChange returns true if fingerprints differ only in the hash
+// part, ie. the data changed behind our back keeping size and time.
+func (f *Fs) silentChange(oldFp, newFp string) bool {
+	if !f.fpTime || f.fpHash == hash.None {
+		return false
+	}
+	oldParts := strings.SplitN(oldFp, ",", 3)
+	newParts := strings.SplitN(newFp, ",", 3)
+	if len(oldParts) != 3 || len(newParts) != 3 {
+		return false
+	}
+	return oldParts[0] == newParts[0] && oldParts[1] == newParts[1] && oldParts[2] != newParts[2]
+}
+
+// scrubLoop runs scrub passes in background until the context is cancelled
+func (f *Fs) scrubLoop(ctx context.Context, interval time.Duration) {
+	defer close(f.scrubDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fs.Debugf(f, "scrub: starting background pass")
+		res, err := f.scrub(ctx, f.opt.ScrubVerify)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			fs.Errorf(f, "scrub: background pass failed: %v", err)
+		case len(res.Corrupted) > 0:
+			fs.Errorf(f, "scrub: %d corrupted object(s): %s", len(res.Corrupted), strings.Join(res.Corrupted, ", "))
+		}
+		if res != nil {
+			fs.Infof(f, "scrub: %d checked, %d populated, %d verified, %d changed, %d corrupted, %d errors",
+				res.Checked, res.Populated, res.Verified, res.Changed, len(res.Corrupted), res.Errors)
+		}
+	}
+}
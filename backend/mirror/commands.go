@@ -0,0 +1,249 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/fspath"
+)
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "status",
+	Short: "Show health and replication queue of the remotes",
+	Long: `This shows for each remote whether it is currently used for reads,
+the last read error and how many changes are queued for replication to
+it, together with the number being retried after errors.
+
+    rclone backend status mirror:
+
+The check option probes each remote by listing the root first, the
+pending option adds up to the given number of queued changes to the
+output.
+
+    rclone backend status mirror: -o check -o pending=20
+`,
+	Opts: map[string]string{
+		"check":   "Probe each remote before reporting",
+		"pending": "Show up to this many queued changes (default 100)",
+	},
+}, {
+	Name:  "resync",
+	Short: "Make the secondaries identical to the primary",
+	Long: `This syncs the primary to each secondary remote, or to those given
+as arguments, below the path of the mirror remote. Queued changes under
+that path made redundant by the sync are dropped.
+
+    rclone backend resync mirror:path
+    rclone backend resync mirror:path remote2:bucket
+
+Use it after adding a secondary or when the queue was lost. With the
+async option the sync is queued to run in the background instead.
+
+    rclone backend resync mirror: -o async
+`,
+	Opts: map[string]string{
+		"async": "Queue the resync instead of running it now",
+	},
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "status":
+		return f.status(ctx, opt)
+	case "resync":
+		return f.resync(ctx, arg, opt)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// RemoteStatus describes a mirrored remote
+type RemoteStatus struct {
+	Remote    string     `json:"remote"`
+	Primary   bool       `json:"primary"`
+	Healthy   bool       `json:"healthy"`
+	LastError string     `json:"lastError,omitempty"`
+	FailedAt  *time.Time `json:"failedAt,omitempty"`
+	Queued    int        `json:"queued"`
+	Retrying  int        `json:"retrying"`
+}
+
+// PendingChange describes a queued replication
+type PendingChange struct {
+	Remote    string    `json:"remote"`
+	Kind      string    `json:"kind"`
+	Path      string    `json:"path"`
+	Added     time.Time `json:"added"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// Status is the output of the status command
+type Status struct {
+	Remotes []RemoteStatus  `json:"remotes"`
+	Pending []PendingChange `json:"pending,omitempty"`
+}
+
+func (f *Fs) status(ctx context.Context, opt map[string]string) (*Status, error) {
+	if _, ok := opt["check"]; ok {
+		for _, u := range f.upstreams {
+			_, err := u.f.List(ctx, "")
+			if isFailure(ctx, err) {
+				u.fail(err)
+			} else {
+				u.succeed()
+			}
+		}
+	}
+	showPending := 0
+	if s, ok := opt["pending"]; ok {
+		showPending = 100
+		if s != "" && s != "true" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pending count %q: %w", s, err)
+			}
+			showPending = n
+		}
+	}
+
+	items, err := f.repl.pending(false, 0)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(f.opt.FailTimeout)
+	status := &Status{}
+	for i, u := range f.upstreams {
+		rs := RemoteStatus{
+			Remote:  u.remote,
+			Primary: i == 0,
+			Healthy: u.healthy(timeout),
+		}
+		u.mu.Lock()
+		if u.lastErr != nil {
+			rs.LastError = u.lastErr.Error()
+			failedAt := u.failedAt
+			rs.FailedAt = &failedAt
+		}
+		u.mu.Unlock()
+		for _, it := range items {
+			if it.Secondary != u.remote {
+				continue
+			}
+			rs.Queued++
+			if it.Attempts > 0 {
+				rs.Retrying++
+			}
+		}
+		status.Remotes = append(status.Remotes, rs)
+	}
+	for _, it := range items {
+		if len(status.Pending) >= showPending {
+			break
+		}
+		status.Pending = append(status.Pending, PendingChange{
+			Remote:    it.Secondary,
+			Kind:      it.Kind,
+			Path:      it.Path,
+			Added:     it.Added,
+			Attempts:  it.Attempts,
+			LastError: it.LastError,
+		})
+	}
+	return status, nil
+}
+
+// ResyncResult is the outcome of resyncing a secondary
+type ResyncResult struct {
+	Remote  string `json:"remote"`
+	Dropped int    `json:"dropped"` // queued changes made redundant
+	Queued  bool   `json:"queued"`  // resync queued instead of run
+	Error   string `json:"error,omitempty"`
+}
+
+func (f *Fs) resync(ctx context.Context, arg []string, opt map[string]string) ([]ResyncResult, error) {
+	var targets []*upstream
+	for _, remote := range arg {
+		var found *upstream
+		for _, u := range f.upstreams[1:] {
+			if u.remote == remote {
+				found = u
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("%q is not a secondary remote of this mirror", remote)
+		}
+		targets = append(targets, found)
+	}
+	if len(targets) == 0 {
+		targets = f.upstreams[1:]
+	}
+
+	_, async := opt["async"]
+	results := make([]ResyncResult, 0, len(targets))
+	failed := 0
+	for _, u := range targets {
+		res := ResyncResult{Remote: u.remote}
+		if async {
+			err := f.repl.db.Do(true, &kvEnqueue{items: []*queueItem{{
+				Primary:   f.repl.remotes[0],
+				Secondary: u.remote,
+				Kind:      kindTree,
+				Path:      f.root,
+				Added:     time.Now(),
+			}}})
+			if err != nil {
+				return nil, err
+			}
+			res.Queued = true
+			results = append(results, res)
+			continue
+		}
+		start := time.Now()
+		err := f.resyncUpstream(ctx, u)
+		if err == nil {
+			op := &kvForget{
+				primary:   f.repl.remotes[0],
+				secondary: u.remote,
+				dir:       f.root,
+				before:    start,
+			}
+			err = f.repl.db.Do(true, op)
+			res.Dropped = op.num
+		}
+		if err != nil {
+			fs.Errorf(u.f, "mirror: resync failed: %v", err)
+			res.Error = err.Error()
+			failed++
+		}
+		results = append(results, res)
+	}
+	f.repl.kick()
+	if failed > 0 {
+		return results, fmt.Errorf("resync of %d remote(s) failed", failed)
+	}
+	return results, nil
+}
+
+// resyncUpstream syncs the primary to u at the root of the mirror
+func (f *Fs) resyncUpstream(ctx context.Context, u *upstream) error {
+	dst, err := cache.Get(ctx, fspath.JoinRootPath(u.remote, f.root))
+	if err != nil && !errors.Is(err, fs.ErrorIsFile) {
+		return err
+	}
+	return syncTree(ctx, dst, f.primary().f)
+}
@@ -0,0 +1,770 @@
+// Package mirror implements a backend which keeps the same data on
+// several remotes, writing to the primary and replicating to the others
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "mirror",
+		Description: "Mirror a remote onto others with failover reads",
+		NewFs:       NewFs,
+		MetadataInfo: &fs.MetadataInfo{
+			Help: `Any metadata supported by the primary remote is read and written.`,
+		},
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name: "remotes",
+			Help: `List of space separated remotes to mirror.
+
+The first remote is the primary. All writes go to it synchronously and
+are then queued for replication to the others. Reads are served by the
+first healthy remote in this order.
+
+Embedded spaces can be added using quotes
+
+    "remote:path with space" remote2:path`,
+			Required: true,
+			Default:  fs.SpaceSepList(nil),
+		}, {
+			Name:    "fail_timeout",
+			Default: fs.Duration(time.Minute),
+			Help: `How long to avoid reading from a remote after it failed.
+
+A remote returning an error on a read is skipped in favour of the next
+one in the list until this time has passed.`,
+		}, {
+			Name:     "flush_timeout",
+			Default:  fs.Duration(5 * time.Minute),
+			Advanced: true,
+			Help: `How long to keep replicating queued changes when rclone exits.
+
+At the end of a command like copy the changes made are usually still
+queued. Rclone carries on replicating them for up to this long before
+exiting, leaving the rest queued for the next time the remote is used.
+Set to 0 to exit straight away.`,
+		}, {
+			Name:     "transfers",
+			Default:  4,
+			Advanced: true,
+			Help:     "Number of parallel replications to the secondary remotes.",
+		}, {
+			Name:     "retry_delay",
+			Default:  fs.Duration(30 * time.Second),
+			Advanced: true,
+			Help: `Delay before retrying a failed replication.
+
+The delay doubles with each failed attempt up to a maximum of an hour.`,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remotes      fs.SpaceSepList `config:"remotes"`
+	FailTimeout  fs.Duration     `config:"fail_timeout"`
+	FlushTimeout fs.Duration     `config:"flush_timeout"`
+	Transfers    int             `config:"transfers"`
+	RetryDelay   fs.Duration     `config:"retry_delay"`
+}
+
+// Fs represents a mirror of remotes
+type Fs struct {
+	name      string       // name of this remote
+	root      string       // the path we are working on
+	opt       Options      // options for this Fs
+	features  *fs.Features // optional features
+	hashSet   hash.Set     // common hashes
+	upstreams []*upstream  // primary first, then secondaries
+	repl      *replicator  // replication queue shared by all instances
+}
+
+// upstream is a mirrored remote and its health
+type upstream struct {
+	*health
+	f      fs.Fs  // remote at the root of the mirror
+	remote string // remote as configured
+}
+
+// fail marks the upstream as unhealthy
+func (u *upstream) fail(err error) {
+	u.mu.Lock()
+	u.failedAt = time.Now()
+	u.lastErr = err
+	u.mu.Unlock()
+	fs.Errorf(u.f, "Marking remote unhealthy: %v", err)
+}
+
+// succeed marks the upstream as healthy again
+func (u *upstream) succeed() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.failedAt.IsZero() {
+		fs.Infof(u.f, "Remote is healthy again")
+		u.failedAt = time.Time{}
+		u.lastErr = nil
+	}
+}
+
+// healthy returns true if the upstream hasn't failed in the last timeout
+func (u *upstream) healthy(timeout time.Duration) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.failedAt.IsZero() || time.Since(u.failedAt) > timeout
+}
+
+// NewFs constructs an Fs from the path.
+//
+// The returned Fs is the actual Fs, referenced by remote in the config
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (outFs fs.Fs, err error) {
+	if !kv.Supported() {
+		return nil, errors.New("mirror is not supported on this OS")
+	}
+	opt := new(Options)
+	err = configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(opt.Remotes) < 2 {
+		return nil, errors.New("mirror needs at least two remotes - check the value of the remotes setting")
+	}
+	for _, remote := range opt.Remotes {
+		if strings.HasPrefix(remote, name+":") {
+			return nil, errors.New("can't point mirror remote at itself - check the value of the remotes setting")
+		}
+	}
+	if opt.Transfers < 1 {
+		opt.Transfers = 1
+	}
+	root = strings.Trim(root, "/")
+
+	f := &Fs{
+		name: name,
+		root: root,
+		opt:  *opt,
+	}
+	f.repl, err = getReplicator(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	var fileErr error
+	for i, remote := range opt.Remotes {
+		uFs, err := cache.Get(ctx, fspath.JoinRootPath(remote, root))
+		if err == fs.ErrorIsFile {
+			if i == 0 {
+				fileErr = err
+			}
+		} else if err != nil {
+			f.repl.release()
+			return nil, fmt.Errorf("failed to create upstream %q: %w", remote, err)
+		}
+		f.upstreams = append(f.upstreams, &upstream{health: f.repl.health[i], f: uFs, remote: remote})
+	}
+	// The primary decides whether the root is a file
+	if fileErr != nil {
+		f.root = path.Dir(f.root)
+		if f.root == "." {
+			f.root = ""
+		}
+		for _, u := range f.upstreams {
+			u.f, err = cache.Get(ctx, fspath.JoinRootPath(u.remote, f.root))
+			if err != nil {
+				f.repl.release()
+				return nil, fmt.Errorf("failed to create upstream %q: %w", u.remote, err)
+			}
+		}
+	}
+
+	f.hashSet = f.upstreams[0].f.Hashes()
+	for _, u := range f.upstreams[1:] {
+		f.hashSet = f.hashSet.Overlap(u.f.Hashes())
+	}
+
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            true,
+		WriteMimeType:           true,
+		CanHaveEmptyDirectories: true,
+		BucketBased:             true,
+		ReadMetadata:            true,
+		WriteMetadata:           true,
+		UserMetadata:            true,
+	}).Fill(ctx, f).Mask(ctx, f.upstreams[0].f)
+	// Reads may come from any remote
+	for _, u := range f.upstreams[1:] {
+		uFeatures := u.f.Features()
+		f.features.CaseInsensitive = f.features.CaseInsensitive || uFeatures.CaseInsensitive
+		f.features.CanHaveEmptyDirectories = f.features.CanHaveEmptyDirectories && uFeatures.CanHaveEmptyDirectories
+	}
+	// Always needed to release the replication queue
+	f.features.Shutdown = f.Shutdown
+	f.features.Overlay = true
+	f.features.DisableList(fs.GetConfig(ctx).DisableFeatures)
+	return f, fileErr
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("mirror root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Hashes returns the hashes supported by all the remotes
+func (f *Fs) Hashes() hash.Set {
+	return f.hashSet
+}
+
+// Precision is the greatest Precision of all upstreams
+func (f *Fs) Precision() time.Duration {
+	var greatestPrecision time.Duration
+	for _, u := range f.upstreams {
+		uPrecision := u.f.Precision()
+		if uPrecision > greatestPrecision {
+			greatestPrecision = uPrecision
+		}
+	}
+	return greatestPrecision
+}
+
+// primary returns the remote all writes go to
+func (f *Fs) primary() *upstream {
+	return f.upstreams[0]
+}
+
+// readOrder returns the upstreams in the order to read from, healthy
+// ones first, keeping the unhealthy ones as a last resort
+func (f *Fs) readOrder() []*upstream {
+	timeout := time.Duration(f.opt.FailTimeout)
+	order := make([]*upstream, 0, len(f.upstreams))
+	var unhealthy []*upstream
+	for _, u := range f.upstreams {
+		if u.healthy(timeout) {
+			order = append(order, u)
+		} else {
+			unhealthy = append(unhealthy, u)
+		}
+	}
+	return append(order, unhealthy...)
+}
+
+// isFailure returns true if err means the remote is unusable rather
+// than it giving a definite answer
+func isFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	for _, answer := range []error{fs.ErrorObjectNotFound, fs.ErrorDirNotFound, fs.ErrorIsFile, fs.ErrorIsDir, fs.ErrorNotAFile} {
+		if errors.Is(err, answer) {
+			return false
+		}
+	}
+	return true
+}
+
+// read runs fn on the upstreams in read order until one of them
+// doesn't fail
+func (f *Fs) read(ctx context.Context, fn func(u *upstream) error) (err error) {
+	for _, u := range f.readOrder() {
+		err = fn(u)
+		if !isFailure(ctx, err) {
+			if err == nil {
+				u.succeed()
+			}
+			return err
+		}
+		u.fail(err)
+	}
+	return err
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	err = f.read(ctx, func(u *upstream) (err error) {
+		entries, err = u.f.List(ctx, dir)
+		if err == nil {
+			f.wrapEntries(entries, u)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// wrapEntries wraps the objects listed from u
+func (f *Fs) wrapEntries(entries fs.DirEntries, u *upstream) {
+	for i, entry := range entries {
+		if o, ok := entry.(fs.Object); ok {
+			entries[i] = f.newObject(o, u)
+		}
+	}
+}
+
+// NewObject finds the Object at remote on the first healthy upstream.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	var o *Object
+	err := f.read(ctx, func(u *upstream) error {
+		uo, err := u.f.NewObject(ctx, remote)
+		if err == nil {
+			o = f.newObject(uo, u)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	u := f.primary()
+	o, err := u.f.Put(ctx, in, src, options...)
+	f.replicate(ctx, kindFile, src.Remote())
+	if o == nil {
+		return nil, err
+	}
+	return f.newObject(o, u), err
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	u := f.primary()
+	do := u.f.Features().PutStream
+	if do == nil {
+		return nil, fs.ErrorNotImplemented
+	}
+	o, err := do(ctx, in, src, options...)
+	f.replicate(ctx, kindFile, src.Remote())
+	if o == nil {
+		return nil, err
+	}
+	return f.newObject(o, u), err
+}
+
+// Mkdir makes the directory on the primary
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	err := f.primary().f.Mkdir(ctx, dir)
+	if err == nil {
+		f.replicate(ctx, kindDir, dir)
+	}
+	return err
+}
+
+// Rmdir removes the directory on the primary
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	err := f.primary().f.Rmdir(ctx, dir)
+	if err == nil {
+		f.replicate(ctx, kindDir, dir)
+	}
+	return err
+}
+
+// Purge all files in the directory
+//
+// Implement this if you have a way of deleting all the files
+// quicker than just running Remove() on the result of List()
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	do := f.primary().f.Features().Purge
+	if do == nil {
+		return fs.ErrorCantPurge
+	}
+	err := do(ctx, dir)
+	if err == nil {
+		f.replicate(ctx, kindTree, dir)
+	}
+	return err
+}
+
+// primaryObject returns the object on the primary src is a copy of
+func (o *Object) primaryObject(ctx context.Context) (fs.Object, error) {
+	if o.u == o.f.primary() {
+		return o.Object, nil
+	}
+	return o.f.primary().f.NewObject(ctx, o.Remote())
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't copy - not same remote type")
+		return nil, fs.ErrorCantCopy
+	}
+	u := f.primary()
+	do := u.f.Features().Copy
+	if do == nil {
+		return nil, fs.ErrorCantCopy
+	}
+	srcPrimary, err := srcObj.primaryObject(ctx)
+	if err != nil {
+		return nil, fs.ErrorCantCopy
+	}
+	o, err := do(ctx, srcPrimary, remote)
+	if err != nil {
+		return nil, err
+	}
+	f.replicate(ctx, kindFile, remote)
+	return f.newObject(o, u), nil
+}
+
+// Move src to this remote using server-side move operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't move - not same remote type")
+		return nil, fs.ErrorCantMove
+	}
+	u := f.primary()
+	do := u.f.Features().Move
+	if do == nil {
+		return nil, fs.ErrorCantMove
+	}
+	srcPrimary, err := srcObj.primaryObject(ctx)
+	if err != nil {
+		return nil, fs.ErrorCantMove
+	}
+	o, err := do(ctx, srcPrimary, remote)
+	if err != nil {
+		return nil, err
+	}
+	srcObj.f.replicate(ctx, kindFile, srcObj.Remote())
+	f.replicate(ctx, kindFile, remote)
+	return f.newObject(o, u), nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		fs.Debugf(src, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	do := f.primary().f.Features().DirMove
+	if do == nil {
+		return fs.ErrorCantDirMove
+	}
+	err := do(ctx, srcFs.primary().f, srcRemote, dstRemote)
+	if err != nil {
+		return err
+	}
+	srcFs.replicate(ctx, kindTree, srcRemote)
+	f.replicate(ctx, kindTree, dstRemote)
+	return nil
+}
+
+// About gets quota information from the primary
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	do := f.primary().f.Features().About
+	if do == nil {
+		return nil, errors.New("not supported by the primary remote")
+	}
+	return do(ctx)
+}
+
+// DirCacheFlush resets the directory cache - used in testing
+// as an optional interface
+func (f *Fs) DirCacheFlush() {
+	for _, u := range f.upstreams {
+		if do := u.f.Features().DirCacheFlush; do != nil {
+			do()
+		}
+	}
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	if f.repl != nil {
+		f.repl.release()
+		f.repl = nil
+	}
+	return nil
+}
+
+// Object describes a mirrored Object read from one of the upstreams
+type Object struct {
+	fs.Object
+	f *Fs
+	u *upstream
+}
+
+func (f *Fs) newObject(o fs.Object, u *upstream) *Object {
+	return &Object{
+		Object: o,
+		f:      f,
+		u:      u,
+	}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// String returns the remote path
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.Remote()
+}
+
+// UnWrap returns the Object that this Object is wrapping or
+// nil if it isn't wrapping anything
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if !o.f.hashSet.Contains(ht) {
+		return "", hash.ErrUnsupported
+	}
+	return o.Object.Hash(ctx, ht)
+}
+
+// Open opens the file for read, failing over to the other remotes
+// if the one the object came from doesn't respond.
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	in, err := o.Object.Open(ctx, options...)
+	if !isFailure(ctx, err) {
+		return in, err
+	}
+	o.u.fail(err)
+	firstErr := err
+	for _, u := range o.f.readOrder() {
+		if u == o.u {
+			continue
+		}
+		var uo fs.Object
+		uo, err = u.f.NewObject(ctx, o.Remote())
+		if err == nil {
+			in, err = uo.Open(ctx, options...)
+		}
+		if err == nil {
+			fs.Infof(o, "Reading from %v instead", u.f)
+			u.succeed()
+			return in, nil
+		}
+		if isFailure(ctx, err) {
+			u.fail(err)
+		}
+	}
+	return nil, firstErr
+}
+
+// Update the object on the primary with the given data, time and size.
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	defer o.f.replicate(ctx, kindFile, o.Remote())
+	u := o.f.primary()
+	po, err := o.primaryObject(ctx)
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		po, err = u.f.Put(ctx, in, src, options...)
+		if po != nil {
+			o.Object, o.u = po, u
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	err = po.Update(ctx, in, src, options...)
+	o.Object, o.u = po, u
+	return err
+}
+
+// Remove the object from the primary
+func (o *Object) Remove(ctx context.Context) error {
+	po, err := o.primaryObject(ctx)
+	if err == nil {
+		err = po.Remove(ctx)
+	}
+	o.f.replicate(ctx, kindFile, o.Remote())
+	return err
+}
+
+// SetModTime sets the modification time of the object on the primary
+func (o *Object) SetModTime(ctx context.Context, t time.Time) error {
+	po, err := o.primaryObject(ctx)
+	if err != nil {
+		return err
+	}
+	err = po.SetModTime(ctx, t)
+	if err == nil {
+		o.f.replicate(ctx, kindFile, o.Remote())
+	}
+	return err
+}
+
+// MimeType returns the content type of the Object if known
+func (o *Object) MimeType(ctx context.Context) (mimeType string) {
+	if do, ok := o.Object.(fs.MimeTyper); ok {
+		mimeType = do.MimeType(ctx)
+	}
+	return mimeType
+}
+
+// ID returns the ID of the Object if known, or "" if not
+func (o *Object) ID() string {
+	do, ok := o.Object.(fs.IDer)
+	if !ok {
+		return ""
+	}
+	return do.ID()
+}
+
+// Metadata returns metadata for an object
+//
+// It should return nil if there is no Metadata
+func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	do, ok := o.Object.(fs.Metadataer)
+	if !ok {
+		return nil, nil
+	}
+	return do.Metadata(ctx)
+}
+
+// SetMetadata sets metadata for the object on the primary
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	po, err := o.primaryObject(ctx)
+	if err != nil {
+		return err
+	}
+	do, ok := po.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	err = do.SetMetadata(ctx, metadata)
+	if err == nil {
+		o.f.replicate(ctx, kindFile, o.Remote())
+	}
+	return err
+}
+
+// GetTier returns storage tier or class of the Object
+func (o *Object) GetTier() string {
+	do, ok := o.Object.(fs.GetTierer)
+	if !ok {
+		return ""
+	}
+	return do.GetTier()
+}
+
+// SetTier performs changing storage tier of the Object on the primary
+func (o *Object) SetTier(tier string) error {
+	po, err := o.primaryObject(context.Background())
+	if err != nil {
+		return err
+	}
+	do, ok := po.(fs.SetTierer)
+	if !ok {
+		return errors.New("primary remote does not support SetTier")
+	}
+	err = do.SetTier(tier)
+	if err == nil {
+		o.f.replicate(context.Background(), kindFile, o.Remote())
+	}
+	return err
+}
+
+// purge the directory on f or fallback to a slow way
+func purge(ctx context.Context, f fs.Fs, dir string) error {
+	if do := f.Features().Purge; do != nil {
+		return do(ctx, dir)
+	}
+	return operations.Purge(ctx, f, dir)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.Purger          = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Mover           = (*Fs)(nil)
+	_ fs.DirMover        = (*Fs)(nil)
+	_ fs.DirCacheFlusher = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
+	_ fs.FullObject      = (*Object)(nil)
+)
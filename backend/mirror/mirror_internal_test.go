@@ -0,0 +1,117 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flush replicates everything queued
+func (f *Fs) flush(ctx context.Context, t *testing.T) {
+	for {
+		n, err := f.repl.process(ctx, false)
+		require.NoError(t, err)
+		if n == 0 {
+			return
+		}
+	}
+}
+
+// read returns the contents of o
+func read(ctx context.Context, t *testing.T, o fs.Object) string {
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+func (f *Fs) testReplication(t *testing.T) {
+	ctx := context.Background()
+	const dir = "replication"
+	primary, secondary := f.upstreams[0], f.upstreams[1]
+
+	item := fstest.NewItem(dir+"/file.txt", "mirrored contents", time.Now())
+	_ = fstests.PutTestContents(ctx, t, f, &item, "mirrored contents", true)
+	f.flush(ctx, t)
+	o, err := secondary.f.NewObject(ctx, item.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "mirrored contents", read(ctx, t, o))
+
+	// Only look at the queue below dir as earlier tests may leave
+	// changes being retried
+	status, err := f.status(ctx, map[string]string{"pending": "1000000"})
+	require.NoError(t, err)
+	require.Len(t, status.Remotes, 2)
+	assert.True(t, status.Remotes[0].Primary)
+	for _, change := range status.Pending {
+		it := queueItem{Path: change.Path}
+		assert.False(t, it.under(path.Join(f.root, dir)), "still queued: %+v", change)
+	}
+
+	// Reads fail over to the secondary while the primary is unhealthy
+	primary.fail(errors.New("test failure"))
+	o, err = f.NewObject(ctx, item.Path)
+	require.NoError(t, err)
+	assert.Equal(t, secondary, o.(*Object).u)
+	status, err = f.status(ctx, map[string]string{})
+	require.NoError(t, err)
+	assert.False(t, status.Remotes[0].Healthy)
+	assert.Equal(t, "test failure", status.Remotes[0].LastError)
+	primary.succeed()
+
+	// Open fails over when the object vanished from under the primary
+	o, err = f.NewObject(ctx, item.Path)
+	require.NoError(t, err)
+	assert.Equal(t, primary, o.(*Object).u)
+	po, err := primary.f.NewObject(ctx, item.Path)
+	require.NoError(t, err)
+	require.NoError(t, po.Remove(ctx))
+	assert.Equal(t, "mirrored contents", read(ctx, t, o))
+	primary.succeed()
+
+	// Resync puts it back on the primary's terms
+	results, err := f.resync(ctx, nil, map[string]string{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	_, err = secondary.f.NewObject(ctx, item.Path)
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+
+	// Deletes are replicated
+	item2 := fstest.NewItem(dir+"/file2.txt", "more contents", time.Now())
+	o = fstests.PutTestContents(ctx, t, f, &item2, "more contents", true)
+	f.flush(ctx, t)
+	_, err = secondary.f.NewObject(ctx, item2.Path)
+	require.NoError(t, err)
+	require.NoError(t, o.Remove(ctx))
+	f.flush(ctx, t)
+	_, err = secondary.f.NewObject(ctx, item2.Path)
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+
+	require.NoError(t, operations.Purge(ctx, f, dir))
+	f.flush(ctx, t)
+	entries, err := secondary.f.List(ctx, dir)
+	if !errors.Is(err, fs.ErrorDirNotFound) {
+		// bucket based remotes may list a missing directory as empty
+		require.NoError(t, err)
+		assert.Len(t, entries, 0)
+	}
+}
+
+// InternalTest dispatches all internal tests
+func (f *Fs) InternalTest(t *testing.T) {
+	t.Run("Replication", f.testReplication)
+}
+
+var _ fstests.InternalTester = (*Fs)(nil)
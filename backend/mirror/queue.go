@@ -0,0 +1,665 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/march"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/kv"
+	"golang.org/x/sync/errgroup"
+)
+
+// Kinds of replication
+const (
+	kindFile = "file" // copy or delete a single file
+	kindDir  = "dir"  // make or remove a single directory
+	kindTree = "tree" // sync or purge a directory tree
+)
+
+// maxRetryDelay limits the backoff of failed replications
+const maxRetryDelay = time.Hour
+
+// queueItem is a persisted replication of a path to a secondary
+type queueItem struct {
+	Primary   string    // primary remote as configured
+	Secondary string    // secondary remote as configured
+	Kind      string    // one of the kind constants
+	Path      string    // path relative to the configured remotes
+	Added     time.Time // when queued, identifies this version of the item
+	Attempts  int       // number of failed attempts
+	NextTry   time.Time // don't retry before this time
+	LastError string    // error of the last attempt
+}
+
+func (it *queueItem) key() []byte {
+	return []byte(strings.Join([]string{it.Primary, it.Secondary, it.Kind, it.Path}, "\x00"))
+}
+
+func (it *queueItem) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(it); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (it *queueItem) decode(data []byte) error {
+	return gob.NewDecoder(bytes.NewBuffer(data)).Decode(it)
+}
+
+// under returns true if the item path is dir or inside it
+func (it *queueItem) under(dir string) bool {
+	return dir == "" || it.Path == dir || strings.HasPrefix(it.Path, dir+"/")
+}
+
+// kvEnqueue: add items replacing older versions
+type kvEnqueue struct {
+	items []*queueItem
+}
+
+func (op *kvEnqueue) Do(ctx context.Context, b kv.Bucket) error {
+	for _, it := range op.items {
+		data, err := it.encode()
+		if err != nil {
+			return fmt.Errorf("marshal failed: %w", err)
+		}
+		if err = b.Put(it.key(), data); err != nil {
+			return fmt.Errorf("put failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// kvPending: list the items for the given remotes
+type kvPending struct {
+	primary     string
+	secondaries []string
+	dueBy       time.Time // only items due by this time unless zero
+	limit       int
+	items       []*queueItem
+}
+
+func (op *kvPending) Do(ctx context.Context, b kv.Bucket) error {
+	return b.ForEach(func(bkey, data []byte) error {
+		if op.limit > 0 && len(op.items) >= op.limit {
+			return nil
+		}
+		var it queueItem
+		if err := it.decode(data); err != nil {
+			fs.Debugf(nil, "mirror: invalid queue record %q: %v", bkey, err)
+			return nil
+		}
+		if it.Primary != op.primary || !contains(op.secondaries, it.Secondary) {
+			return nil
+		}
+		if !op.dueBy.IsZero() && it.NextTry.After(op.dueBy) {
+			return nil
+		}
+		op.items = append(op.items, &it)
+		return nil
+	})
+}
+
+// kvDone: remove an item unless it was queued again meanwhile
+type kvDone struct {
+	item *queueItem
+	err  error // error to record or nil if done
+	wait time.Duration
+}
+
+func (op *kvDone) Do(ctx context.Context, b kv.Bucket) error {
+	key := op.item.key()
+	var it queueItem
+	if data := b.Get(key); len(data) == 0 || it.decode(data) != nil || !it.Added.Equal(op.item.Added) {
+		return nil
+	}
+	if op.err == nil {
+		return b.Delete(key)
+	}
+	it.Attempts++
+	it.NextTry = time.Now().Add(op.wait)
+	it.LastError = op.err.Error()
+	data, err := it.encode()
+	if err != nil {
+		return fmt.Errorf("marshal failed: %w", err)
+	}
+	return b.Put(key, data)
+}
+
+// kvForget: drop items under dir queued before the given time
+type kvForget struct {
+	primary   string
+	secondary string
+	dir       string
+	before    time.Time
+	num       int
+}
+
+func (op *kvForget) Do(ctx context.Context, b kv.Bucket) error {
+	var keys [][]byte
+	_ = b.ForEach(func(bkey, data []byte) error {
+		var it queueItem
+		if it.decode(data) != nil {
+			return nil
+		}
+		if it.Primary == op.primary && it.Secondary == op.secondary && it.under(op.dir) && it.Added.Before(op.before) {
+			keys = append(keys, append([]byte(nil), bkey...))
+		}
+		return nil
+	})
+	for _, key := range keys {
+		if err := b.Delete(key); err != nil {
+			return err
+		}
+	}
+	op.num = len(keys)
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// health tracks read failures of a remote, shared by all instances
+type health struct {
+	mu       sync.Mutex
+	failedAt time.Time // when the last read failed
+	lastErr  error     // error of the last failed read
+}
+
+// replicator owns the persisted queue and replicates changes from the
+// primary to the secondaries in the background. It is shared by all
+// the Fs instances of the same remote whatever their root.
+type replicator struct {
+	key        string
+	ctx        context.Context // for replication outside of calls
+	db         *kv.DB
+	remotes    []string // as configured, primary first
+	bases      []fs.Fs  // at the configured roots
+	health     []*health
+	transfers  int
+	retryDelay time.Duration
+	flushTime  time.Duration
+	refs       int // protected by replicatorsMu
+	processMu  sync.Mutex
+	wake       chan struct{}
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+var (
+	replicatorsMu sync.Mutex
+	replicators   = map[string]*replicator{}
+)
+
+// getReplicator finds or starts the replicator for f
+func getReplicator(ctx context.Context, f *Fs) (*replicator, error) {
+	key := f.name + ":" + strings.Join(f.opt.Remotes, " ")
+	replicatorsMu.Lock()
+	defer replicatorsMu.Unlock()
+	if r := replicators[key]; r != nil {
+		r.refs++
+		return r, nil
+	}
+
+	r := &replicator{
+		key:        key,
+		remotes:    f.opt.Remotes,
+		transfers:  f.opt.Transfers,
+		retryDelay: time.Duration(f.opt.RetryDelay),
+		flushTime:  time.Duration(f.opt.FlushTimeout),
+		refs:       1,
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	if r.retryDelay < time.Second {
+		r.retryDelay = time.Second
+	}
+	for _, remote := range r.remotes {
+		base, err := cache.Get(ctx, remote)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create upstream %q: %w", remote, err)
+		}
+		r.bases = append(r.bases, base)
+		r.health = append(r.health, &health{})
+	}
+
+	gob.Register(queueItem{})
+	db, err := kv.Start(ctx, "mirror", f)
+	if err != nil {
+		return nil, err
+	}
+	r.db = db
+
+	r.ctx = context.WithoutCancel(ctx)
+	bgCtx, cancel := context.WithCancel(r.ctx)
+	r.cancel = cancel
+	go r.run(bgCtx)
+	replicators[key] = r
+	return r, nil
+}
+
+// release drops a reference, replicating what it can in the flush
+// time and stopping the replicator when the last reference is gone
+func (r *replicator) release() {
+	replicatorsMu.Lock()
+	r.refs--
+	last := r.refs <= 0
+	if last {
+		delete(replicators, r.key)
+	}
+	replicatorsMu.Unlock()
+	if !last {
+		return
+	}
+	r.cancel()
+	<-r.done
+	if r.flushTime > 0 {
+		ctx, cancel := context.WithTimeout(r.ctx, r.flushTime)
+		for {
+			n, err := r.process(ctx, false)
+			if err != nil {
+				fs.Errorf(r.bases[0], "mirror: replications left queued: %v", err)
+			}
+			if n == 0 || err != nil {
+				break
+			}
+		}
+		cancel()
+	}
+	_ = r.db.Stop(false)
+}
+
+// enqueue schedules replication of path to all the secondaries
+func (r *replicator) enqueue(kind, path string) error {
+	now := time.Now()
+	items := make([]*queueItem, 0, len(r.remotes)-1)
+	for _, secondary := range r.remotes[1:] {
+		items = append(items, &queueItem{
+			Primary:   r.remotes[0],
+			Secondary: secondary,
+			Kind:      kind,
+			Path:      path,
+			Added:     now,
+		})
+	}
+	if err := r.db.Do(true, &kvEnqueue{items: items}); err != nil {
+		return err
+	}
+	r.kick()
+	return nil
+}
+
+// kick wakes up the background replication
+func (r *replicator) kick() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pending lists up to limit queued items, only those due if due is set
+func (r *replicator) pending(due bool, limit int) ([]*queueItem, error) {
+	op := &kvPending{
+		primary:     r.remotes[0],
+		secondaries: r.remotes[1:],
+		limit:       limit,
+	}
+	if due {
+		op.dueBy = time.Now()
+	}
+	err := r.db.Do(false, op)
+	if err == kv.ErrEmpty {
+		err = nil
+	}
+	return op.items, err
+}
+
+// run processes the queue when woken up and retries periodically
+func (r *replicator) run(ctx context.Context) {
+	defer close(r.done)
+	ticker := time.NewTicker(r.retryDelay)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := r.process(ctx, false)
+			if err != nil && ctx.Err() == nil {
+				fs.Errorf(r.bases[0], "mirror: replication failed: %v", err)
+			}
+			if n == 0 || err != nil {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// process replicates one batch of queued items, only those due
+// unless all is set, returning the number of items processed
+func (r *replicator) process(ctx context.Context, all bool) (n int, err error) {
+	r.processMu.Lock()
+	defer r.processMu.Unlock()
+	const batchSize = 1000
+	items, err := r.pending(!all, batchSize)
+	if err != nil || len(items) == 0 {
+		return 0, err
+	}
+
+	// Trees first, then files, then directories deepest first
+	// so that directories are empty when they are removed.
+	order := map[string]int{kindTree: 0, kindFile: 1, kindDir: 2}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if order[a.Kind] != order[b.Kind] {
+			return order[a.Kind] < order[b.Kind]
+		}
+		if a.Kind == kindDir {
+			return strings.Count(a.Path, "/") > strings.Count(b.Path, "/")
+		}
+		return false
+	})
+	for start := 0; start < len(items); {
+		end := start
+		for end < len(items) && items[end].Kind == items[start].Kind {
+			end++
+		}
+		transfers := r.transfers
+		if items[start].Kind == kindDir {
+			transfers = 1
+		}
+		g, gCtx := errgroup.WithContext(ctx)
+		g.SetLimit(transfers)
+		for _, it := range items[start:end] {
+			it := it
+			g.Go(func() error {
+				r.replicate(gCtx, it)
+				return gCtx.Err()
+			})
+		}
+		if err = g.Wait(); err != nil {
+			return n, err
+		}
+		n += end - start
+		start = end
+	}
+	return n, nil
+}
+
+// replicate a single item recording the outcome in the queue
+func (r *replicator) replicate(ctx context.Context, it *queueItem) {
+	err := r.apply(ctx, it)
+	if ctx.Err() != nil {
+		return
+	}
+	op := &kvDone{item: it, err: err}
+	if err != nil {
+		op.wait = r.retryDelay << it.Attempts
+		if op.wait > maxRetryDelay || op.wait <= 0 {
+			op.wait = maxRetryDelay
+		}
+		fs.Errorf(it.Path, "mirror: failed to replicate to %s (attempt %d, retrying in %v): %v",
+			it.Secondary, it.Attempts+1, op.wait, err)
+	} else {
+		fs.Debugf(it.Path, "mirror: replicated %s to %s", it.Kind, it.Secondary)
+	}
+	if err := r.db.Do(true, op); err != nil {
+		fs.Errorf(it.Path, "mirror: failed to update queue: %v", err)
+	}
+}
+
+// apply makes path on the secondary match the primary
+func (r *replicator) apply(ctx context.Context, it *queueItem) error {
+	src := r.bases[0]
+	dst := r.base(it.Secondary)
+	if dst == nil {
+		return fmt.Errorf("unknown secondary %q", it.Secondary)
+	}
+	switch it.Kind {
+	case kindFile:
+		srcObj, err := src.NewObject(ctx, it.Path)
+		if err != nil && !errors.Is(err, fs.ErrorObjectNotFound) {
+			return err
+		}
+		dstObj, dstErr := dst.NewObject(ctx, it.Path)
+		if dstErr != nil && !errors.Is(dstErr, fs.ErrorObjectNotFound) {
+			return dstErr
+		}
+		if srcObj == nil {
+			if dstObj == nil {
+				return nil
+			}
+			return operations.DeleteFile(ctx, dstObj)
+		}
+		_, err = operations.Copy(ctx, dst, dstObj, it.Path, srcObj)
+		if err != nil {
+			// The source may have gone while copying it
+			if _, srcErr := src.NewObject(ctx, it.Path); errors.Is(srcErr, fs.ErrorObjectNotFound) {
+				fs.Debugf(it.Path, "mirror: source removed while replicating")
+				return r.remove(ctx, dst, it.Path)
+			}
+		}
+		return err
+	case kindDir:
+		exists, err := dirExists(ctx, src, it.Path)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return dst.Mkdir(ctx, it.Path)
+		}
+		if it.Path == "" {
+			return nil
+		}
+		if exists, err = dirExists(ctx, dst, it.Path); !exists || err != nil {
+			return err
+		}
+		return dst.Rmdir(ctx, it.Path)
+	case kindTree:
+		exists, err := dirExists(ctx, src, it.Path)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if exists, err = dirExists(ctx, dst, it.Path); !exists || err != nil {
+				return err
+			}
+			return purge(ctx, dst, it.Path)
+		}
+		return r.syncDir(ctx, it.Secondary, it.Path)
+	}
+	return fmt.Errorf("unknown replication kind %q", it.Kind)
+}
+
+// remove deletes remote from f if present
+func (r *replicator) remove(ctx context.Context, f fs.Fs, remote string) error {
+	o, err := f.NewObject(ctx, remote)
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return operations.DeleteFile(ctx, o)
+}
+
+// syncDir makes dir on the secondary identical to the primary
+func (r *replicator) syncDir(ctx context.Context, secondary, dir string) error {
+	srcFs, err := cache.Get(ctx, fspath.JoinRootPath(r.remotes[0], dir))
+	if err != nil {
+		return err
+	}
+	dstFs, err := cache.Get(ctx, fspath.JoinRootPath(secondary, dir))
+	if err != nil && err != fs.ErrorIsFile {
+		return err
+	}
+	return syncTree(ctx, dstFs, srcFs)
+}
+
+// syncSeq numbers the stats groups of syncTree
+var syncSeq atomic.Int64
+
+// syncTree makes dst identical to src
+//
+// This marches the two trees copying the files which differ and
+// deleting the ones only on dst. It doesn't use fs/sync as that
+// would make an import cycle in the fs/sync tests which use all the
+// backends. Each sync gets a stats group of its own.
+func syncTree(ctx context.Context, dst, src fs.Fs) error {
+	group := fmt.Sprintf("mirror/sync/%d", syncSeq.Add(1))
+	ctx = accounting.WithStatsGroup(ctx, group)
+	if err := operations.Mkdir(ctx, dst, ""); err != nil {
+		return err
+	}
+	t := &treeSyncer{ctx: ctx, dst: dst}
+	m := &march.March{
+		Ctx:                    ctx,
+		Fdst:                   dst,
+		Fsrc:                   src,
+		SrcIncludeAll:          true,
+		DstIncludeAll:          true,
+		Callback:               t,
+		NoUnicodeNormalization: fs.GetConfig(ctx).NoUnicodeNormalization,
+	}
+	if err := m.Run(ctx); err != nil {
+		t.setErr(err)
+	}
+	// Only delete once everything has been copied so a failed sync
+	// leaves the secondary with more files rather than fewer
+	if t.err != nil {
+		return t.err
+	}
+	for _, o := range t.deleteObjects {
+		t.setErr(operations.DeleteFile(ctx, o))
+	}
+	for _, dir := range t.purgeDirs {
+		t.setErr(operations.Purge(ctx, dst, dir))
+	}
+	return t.err
+}
+
+// treeSyncer is the march.Marcher used by syncTree
+type treeSyncer struct {
+	ctx           context.Context
+	dst           fs.Fs
+	mu            sync.Mutex
+	err           error       // first error
+	deleteObjects []fs.Object // objects only on dst
+	purgeDirs     []string    // directories only on dst
+}
+
+// setErr records err if it is the first error
+func (t *treeSyncer) setErr(err error) {
+	if err == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+// SrcOnly copies objects and makes directories only on the source
+func (t *treeSyncer) SrcOnly(src fs.DirEntry) (recurse bool) {
+	switch x := src.(type) {
+	case fs.Object:
+		_, err := operations.Copy(t.ctx, t.dst, nil, x.Remote(), x)
+		t.setErr(err)
+	case fs.Directory:
+		t.setErr(operations.Mkdir(t.ctx, t.dst, x.Remote()))
+		return true
+	}
+	return false
+}
+
+// DstOnly notes objects and directories to be removed from the destination
+func (t *treeSyncer) DstOnly(dst fs.DirEntry) (recurse bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch x := dst.(type) {
+	case fs.Object:
+		t.deleteObjects = append(t.deleteObjects, x)
+	case fs.Directory:
+		t.purgeDirs = append(t.purgeDirs, x.Remote())
+	}
+	return false
+}
+
+// Match copies objects which differ
+func (t *treeSyncer) Match(ctx context.Context, dst, src fs.DirEntry) (recurse bool) {
+	srcObj, srcIsObj := src.(fs.Object)
+	dstObj, dstIsObj := dst.(fs.Object)
+	switch {
+	case srcIsObj && dstIsObj:
+		if !operations.Equal(ctx, srcObj, dstObj) {
+			_, err := operations.Copy(ctx, t.dst, dstObj, srcObj.Remote(), srcObj)
+			t.setErr(err)
+		}
+	case srcIsObj:
+		// A directory on dst where the source has a file
+		t.setErr(operations.Purge(ctx, t.dst, dst.Remote()))
+		_, err := operations.Copy(ctx, t.dst, nil, srcObj.Remote(), srcObj)
+		t.setErr(err)
+	case dstIsObj:
+		// A file on dst where the source has a directory
+		t.setErr(operations.DeleteFile(ctx, dstObj))
+		t.setErr(operations.Mkdir(ctx, t.dst, src.Remote()))
+		return true
+	default:
+		return true
+	}
+	return false
+}
+
+// base returns the Fs at the configured root of remote
+func (r *replicator) base(remote string) fs.Fs {
+	for i, configured := range r.remotes {
+		if configured == remote {
+			return r.bases[i]
+		}
+	}
+	return nil
+}
+
+// dirExists checks whether dir is present on f
+func dirExists(ctx context.Context, f fs.Fs, dir string) (bool, error) {
+	_, err := f.List(ctx, dir)
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// replicate queues replication of remote to the secondaries
+func (f *Fs) replicate(ctx context.Context, kind, remote string) {
+	p := path.Join(f.root, remote)
+	if err := f.repl.enqueue(kind, p); err != nil {
+		err = fmt.Errorf("failed to queue replication: %w", err)
+		fs.Errorf(p, "mirror: %v", err)
+		_ = fs.CountError(ctx, err)
+	}
+}
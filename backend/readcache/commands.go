@@ -0,0 +1,35 @@
+package readcache
+
+import (
+	"context"
+
+	"github.com/rclone/rclone/fs"
+)
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "stats",
+	Short: "Show statistics about the cache",
+	Long: `This shows the size of the cached data and the number of files in
+the cache along with the directories holding it.
+
+    rclone backend stats readcache:
+`,
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "stats":
+		return f.cache.Stats(), nil
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
@@ -0,0 +1,191 @@
+package readcache
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs/vfscache"
+)
+
+// Object represents an object read through the cache
+type Object struct {
+	fs.Object
+	f *Fs
+}
+
+// Wrap base object into readcache object
+func (f *Fs) wrapObject(o fs.Object, err error) (obj fs.Object, outErr error) {
+	if err != nil {
+		return nil, err
+	}
+	if o == nil {
+		return nil, fs.ErrorObjectNotFound
+	}
+	return &Object{Object: o, f: f}, nil
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info { return o.f }
+
+// UnWrap returns the wrapped Object
+func (o *Object) UnWrap() fs.Object { return o.Object }
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.Object.String()
+}
+
+// ID returns the ID of the Object if possible
+func (o *Object) ID() string {
+	if doer, ok := o.Object.(fs.IDer); ok {
+		return doer.ID()
+	}
+	return ""
+}
+
+// GetTier returns the Tier of the Object if possible
+func (o *Object) GetTier() string {
+	if doer, ok := o.Object.(fs.GetTierer); ok {
+		return doer.GetTier()
+	}
+	return ""
+}
+
+// SetTier set the Tier of the Object if possible
+func (o *Object) SetTier(tier string) error {
+	if doer, ok := o.Object.(fs.SetTierer); ok {
+		return doer.SetTier(tier)
+	}
+	return errors.New("SetTier not supported")
+}
+
+// MimeType of an Object if known, "" otherwise
+func (o *Object) MimeType(ctx context.Context) string {
+	if doer, ok := o.Object.(fs.MimeTyper); ok {
+		return doer.MimeType(ctx)
+	}
+	return ""
+}
+
+// Metadata returns metadata for an object
+//
+// It should return nil if there is no Metadata
+func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	do, ok := o.Object.(fs.Metadataer)
+	if !ok {
+		return nil, nil
+	}
+	return do.Metadata(ctx)
+}
+
+// SetMetadata sets metadata for an Object
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	do, ok := o.Object.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	return do.SetMetadata(ctx, metadata)
+}
+
+// Update the object with the given data, time and size.
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	o.f.invalidate(o.Remote())
+	return o.Object.Update(ctx, in, src, options...)
+}
+
+// Remove an object.
+func (o *Object) Remove(ctx context.Context) error {
+	err := o.Object.Remove(ctx)
+	if err == nil {
+		o.f.invalidate(o.Remote())
+	}
+	return err
+}
+
+// Open opens the file for read through the cache.
+//
+// Only the ranges read are fetched from the underlying object and
+// stored. Objects of unknown size bypass the cache.
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	size := o.Size()
+	if size < 0 {
+		return o.Object.Open(ctx, options...)
+	}
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	if offset < 0 {
+		return nil, errors.New("invalid offset")
+	}
+	if limit < 0 || offset+limit > size {
+		limit = size - offset
+	}
+	item := o.f.cache.Item(o.f.cacheName(o.Remote()))
+	if err := item.Open(o.Object); err != nil {
+		return nil, err
+	}
+	return &cacheReader{
+		item: item,
+		pos:  offset,
+		end:  offset + limit,
+	}, nil
+}
+
+// cacheReader reads a range of an object from the cache
+type cacheReader struct {
+	item   *vfscache.Item
+	pos    int64 // next byte to read
+	end    int64 // end of the range read
+	closed bool
+}
+
+// Read data from the cache, fetching it if necessary
+func (r *cacheReader) Read(p []byte) (n int, err error) {
+	if r.closed {
+		return 0, errors.New("read on closed file")
+	}
+	if r.pos >= r.end {
+		return 0, io.EOF
+	}
+	if left := r.end - r.pos; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err = r.item.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	if err == io.EOF {
+		if r.pos < r.end {
+			// The object shrank under us
+			return n, io.ErrUnexpectedEOF
+		}
+		if n > 0 {
+			err = nil
+		}
+	}
+	return n, err
+}
+
+// Close the reader
+func (r *cacheReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	return r.item.Close(nil)
+}
@@ -0,0 +1,554 @@
+// Package readcache implements a persistent read cache overlay backend
+package readcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/vfs/vfscache"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "readcache",
+		Description: "Cache file data read from another remote on local disk",
+		NewFs:       NewFs,
+		MetadataInfo: &fs.MetadataInfo{
+			Help: `Any metadata supported by the underlying remote is read and written.`,
+		},
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name:     "remote",
+			Required: true,
+			Help:     "Remote to cache reads from (e.g. myRemote:path).",
+		}, {
+			Name:    "max_size",
+			Default: fs.SizeSuffix(-1),
+			Help: `Max total size of the cached data.
+
+When the cache grows bigger than this the files accessed longest ago
+are removed from it, apart from those being read. The size is that
+used on disk so partially cached files only count the parts read.`,
+		}, {
+			Name:    "max_age",
+			Default: fs.Duration(24 * time.Hour),
+			Help: `Max time since last access of cached files.
+
+Cached files not read for longer than this are removed from the cache.`,
+		}, {
+			Name:     "min_free_space",
+			Default:  fs.SizeSuffix(-1),
+			Advanced: true,
+			Help: `Target minimum free space on the disk containing the cache.
+
+If free space falls below this, files are removed from the cache
+like when it grows over max_size.`,
+		}, {
+			Name:     "poll_interval",
+			Default:  fs.Duration(time.Minute),
+			Advanced: true,
+			Help:     "Interval to check the cache for files to remove.",
+		}, {
+			Name:     "chunk_size",
+			Default:  128 * fs.Mebi,
+			Advanced: true,
+			Help: `Size of the requests made to the underlying remote.
+
+Data missing from the cache is fetched in requests of this size, which
+double up to chunk_size_limit while reading sequentially.`,
+		}, {
+			Name:     "chunk_size_limit",
+			Default:  fs.SizeSuffix(-1),
+			Advanced: true,
+			Help:     "Max size of the requests made to the underlying remote ('off' is unlimited).",
+		}, {
+			Name:     "read_ahead",
+			Default:  fs.SizeSuffix(0),
+			Advanced: true,
+			Help:     "Extra data to fetch ahead of the position being read.",
+		}, {
+			Name:     "fast_fingerprint",
+			Default:  false,
+			Advanced: true,
+			Help: `Use fast (less accurate) fingerprints for invalidation.
+
+Cached data is discarded when the fingerprint of the file, made from
+its size, modification time and hash, changes. This leaves out the
+modification time or hash on remotes where reading them is slow, like
+the hash on local and sftp or the modification time on s3.`,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote          string        `config:"remote"`
+	MaxSize         fs.SizeSuffix `config:"max_size"`
+	MaxAge          fs.Duration   `config:"max_age"`
+	MinFreeSpace    fs.SizeSuffix `config:"min_free_space"`
+	PollInterval    fs.Duration   `config:"poll_interval"`
+	ChunkSize       fs.SizeSuffix `config:"chunk_size"`
+	ChunkSizeLimit  fs.SizeSuffix `config:"chunk_size_limit"`
+	ReadAhead       fs.SizeSuffix `config:"read_ahead"`
+	FastFingerprint bool          `config:"fast_fingerprint"`
+}
+
+// Fs represents a wrapped fs.Fs
+type Fs struct {
+	fs.Fs
+	name     string
+	root     string
+	wrapper  fs.Fs
+	features *fs.Features
+	opt      *Options
+	cache    *sharedCache
+}
+
+// sharedCache is the data cache used by all the Fs with the same
+// configuration, whatever their root
+type sharedCache struct {
+	*vfscache.Cache
+	key    string
+	cancel context.CancelFunc
+	refs   int
+}
+
+var (
+	sharedCachesMu sync.Mutex
+	sharedCaches   = map[string]*sharedCache{}
+)
+
+// cacheRoot is the underlying remote at its configured root as seen
+// by the cache, named so its cache directory doesn't clash with that
+// of a VFS on the readcache remote.
+type cacheRoot struct {
+	fs.Fs
+	name string
+}
+
+// Name of the remote
+func (r *cacheRoot) Name() string { return r.name }
+
+// Root of the remote
+func (r *cacheRoot) Root() string { return "" }
+
+// getCache returns the cache for the Fs, creating it if necessary
+func getCache(ctx context.Context, fsname string, opt *Options) (*sharedCache, error) {
+	key := fsname + ":" + opt.Remote
+	sharedCachesMu.Lock()
+	defer sharedCachesMu.Unlock()
+	if c := sharedCaches[key]; c != nil {
+		c.refs++
+		return c, nil
+	}
+	rootFs, err := cache.Get(ctx, opt.Remote)
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to derive base remote %q: %w", opt.Remote, err)
+	}
+
+	vfsOpt := vfscommon.Opt
+	vfsOpt.CacheMode = vfscommon.CacheModeFull
+	vfsOpt.CacheMaxSize = opt.MaxSize
+	vfsOpt.CacheMaxAge = opt.MaxAge
+	vfsOpt.CacheMinFreeSpace = opt.MinFreeSpace
+	vfsOpt.CachePollInterval = opt.PollInterval
+	vfsOpt.ChunkSize = opt.ChunkSize
+	vfsOpt.ChunkSizeLimit = opt.ChunkSizeLimit
+	vfsOpt.ChunkStreams = 0
+	vfsOpt.ReadAhead = opt.ReadAhead
+	vfsOpt.FastFingerprint = opt.FastFingerprint
+
+	cacheCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	root := &cacheRoot{Fs: rootFs, name: fsname + "~readcache"}
+	vc, err := vfscache.New(cacheCtx, root, &vfsOpt, nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start read cache: %w", err)
+	}
+	c := &sharedCache{
+		Cache:  vc,
+		key:    key,
+		cancel: cancel,
+		refs:   1,
+	}
+	sharedCaches[key] = c
+	return c, nil
+}
+
+// release drops a reference to the cache, stopping it on the last
+func (c *sharedCache) release() {
+	sharedCachesMu.Lock()
+	defer sharedCachesMu.Unlock()
+	c.refs--
+	if c.refs > 0 {
+		return
+	}
+	delete(sharedCaches, c.key)
+	c.cancel()
+}
+
+// NewFs constructs an Fs from the remote:path string
+func NewFs(ctx context.Context, fsname, rpath string, cmap configmap.Mapper) (fs.Fs, error) {
+	opt := &Options{}
+	err := configstruct.Set(cmap, opt)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(opt.Remote, fsname+":") {
+		return nil, errors.New("can't point remote at itself")
+	}
+	remotePath := fspath.JoinRootPath(opt.Remote, rpath)
+	baseFs, err := cache.Get(ctx, remotePath)
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to derive base remote %q: %w", opt.Remote, err)
+	}
+
+	f := &Fs{
+		Fs:   baseFs,
+		name: fsname,
+		root: rpath,
+		opt:  opt,
+	}
+	// Correct root if definitely pointing to a file
+	if err == fs.ErrorIsFile {
+		f.root = path.Dir(f.root)
+		if f.root == "." || f.root == "/" {
+			f.root = ""
+		}
+	}
+	c, cacheErr := getCache(ctx, fsname, opt)
+	if cacheErr != nil {
+		return nil, cacheErr
+	}
+	f.cache = c
+
+	stubFeatures := &fs.Features{
+		CanHaveEmptyDirectories:  true,
+		IsLocal:                  true,
+		ReadMimeType:             true,
+		WriteMimeType:            true,
+		SetTier:                  true,
+		GetTier:                  true,
+		ReadMetadata:             true,
+		WriteMetadata:            true,
+		UserMetadata:             true,
+		ReadDirMetadata:          true,
+		WriteDirMetadata:         true,
+		WriteDirSetModTime:       true,
+		UserDirMetadata:          true,
+		DirModTimeUpdatesOnWrite: true,
+		PartialUploads:           true,
+	}
+	f.features = stubFeatures.Fill(ctx, f).Mask(ctx, f.Fs).WrapsFs(f, f.Fs)
+	// Always release the cache even if the base has no Shutdown
+	f.features.Shutdown = f.Shutdown
+	f.features.DisableList(fs.GetConfig(ctx).DisableFeatures)
+
+	cache.PinUntilFinalized(f.Fs, f)
+	return f, err
+}
+
+//
+// Filesystem
+//
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string { return f.name }
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string { return f.root }
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features { return f.features }
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("readcache::%s:%s", f.name, f.root)
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs { return f.Fs }
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs { return f.wrapper }
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) { f.wrapper = wrapper }
+
+// cacheName returns the name of remote in the cache
+func (f *Fs) cacheName(remote string) string {
+	return path.Join(f.root, remote)
+}
+
+// invalidate drops the cached data of remote
+//
+// Data still being read is left alone, the change of fingerprint
+// discards it when the file is next opened.
+func (f *Fs) invalidate(remote string) {
+	name := f.cacheName(remote)
+	if !f.cache.InUse(name) {
+		f.cache.Remove(name)
+	}
+}
+
+// Wrap base entries into readcache entries.
+func (f *Fs) wrapEntries(baseEntries fs.DirEntries) (entries fs.DirEntries, err error) {
+	entries = baseEntries[:0] // work inplace
+	for _, entry := range baseEntries {
+		switch x := entry.(type) {
+		case fs.Object:
+			obj, err := f.wrapObject(x, nil)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, obj)
+		default:
+			entries = append(entries, entry) // trash in - trash out
+		}
+	}
+	return entries, nil
+}
+
+// List the objects and directories in dir into entries.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	if entries, err = f.Fs.List(ctx, dir); err != nil {
+		return nil, err
+	}
+	return f.wrapEntries(entries)
+}
+
+// ListR lists the objects and directories recursively into out.
+func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
+	return f.Fs.Features().ListR(ctx, dir, func(baseEntries fs.DirEntries) error {
+		entries, err := f.wrapEntries(baseEntries)
+		if err != nil {
+			return err
+		}
+		return callback(entries)
+	})
+}
+
+// NewObject finds the Object at remote.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	o, err := f.Fs.NewObject(ctx, remote)
+	return f.wrapObject(o, err)
+}
+
+// Put in to the remote path with the modTime given of the given size
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	f.invalidate(src.Remote())
+	o, err := f.Fs.Put(ctx, in, src, options...)
+	return f.wrapObject(o, err)
+}
+
+// PutStream uploads to the remote path with undeterminate size.
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	if do := f.Fs.Features().PutStream; do != nil {
+		f.invalidate(src.Remote())
+		o, err := do(ctx, in, src, options...)
+		return f.wrapObject(o, err)
+	}
+	return nil, errors.New("PutStream not supported")
+}
+
+// PutUnchecked uploads the object, allowing duplicates.
+func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	if do := f.Fs.Features().PutUnchecked; do != nil {
+		f.invalidate(src.Remote())
+		o, err := do(ctx, in, src, options...)
+		return f.wrapObject(o, err)
+	}
+	return nil, errors.New("PutUnchecked not supported")
+}
+
+// Purge a directory
+//
+// The cached data of the files is left for the cache cleaner to
+// remove as it will never be read again.
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	if do := f.Fs.Features().Purge; do != nil {
+		return do(ctx, dir)
+	}
+	return fs.ErrorCantPurge
+}
+
+// CleanUp the trash in the Fs
+func (f *Fs) CleanUp(ctx context.Context) error {
+	if do := f.Fs.Features().CleanUp; do != nil {
+		return do(ctx)
+	}
+	return errors.New("not supported by underlying remote")
+}
+
+// About gets quota information from the Fs
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	if do := f.Fs.Features().About; do != nil {
+		return do(ctx)
+	}
+	return nil, errors.New("not supported by underlying remote")
+}
+
+// ChangeNotify calls the passed function with a path that has had changes.
+func (f *Fs) ChangeNotify(ctx context.Context, notifyFunc func(string, fs.EntryType), pollIntervalChan <-chan time.Duration) {
+	if do := f.Fs.Features().ChangeNotify; do != nil {
+		do(ctx, notifyFunc, pollIntervalChan)
+	}
+}
+
+// UserInfo returns info about the connected user
+func (f *Fs) UserInfo(ctx context.Context) (map[string]string, error) {
+	if do := f.Fs.Features().UserInfo; do != nil {
+		return do(ctx)
+	}
+	return nil, fs.ErrorNotImplemented
+}
+
+// Disconnect the current user
+func (f *Fs) Disconnect(ctx context.Context) error {
+	if do := f.Fs.Features().Disconnect; do != nil {
+		return do(ctx)
+	}
+	return fs.ErrorNotImplemented
+}
+
+// MergeDirs merges the contents of all the directories passed
+// in into the first one and rmdirs the other directories.
+func (f *Fs) MergeDirs(ctx context.Context, dirs []fs.Directory) error {
+	if do := f.Fs.Features().MergeDirs; do != nil {
+		return do(ctx, dirs)
+	}
+	return errors.New("MergeDirs not supported")
+}
+
+// DirSetModTime sets the directory modtime for dir
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	if do := f.Fs.Features().DirSetModTime; do != nil {
+		return do(ctx, dir, modTime)
+	}
+	return fs.ErrorNotImplemented
+}
+
+// MkdirMetadata makes the root directory of the Fs object
+func (f *Fs) MkdirMetadata(ctx context.Context, dir string, metadata fs.Metadata) (fs.Directory, error) {
+	if do := f.Fs.Features().MkdirMetadata; do != nil {
+		return do(ctx, dir, metadata)
+	}
+	return nil, fs.ErrorNotImplemented
+}
+
+// DirCacheFlush resets the directory cache - used in testing
+// as an optional interface
+func (f *Fs) DirCacheFlush() {
+	if do := f.Fs.Features().DirCacheFlush; do != nil {
+		do()
+	}
+}
+
+// PublicLink generates a public link to the remote path (usually readable by anyone)
+func (f *Fs) PublicLink(ctx context.Context, remote string, expire fs.Duration, unlink bool) (string, error) {
+	if do := f.Fs.Features().PublicLink; do != nil {
+		return do(ctx, remote, expire, unlink)
+	}
+	return "", errors.New("PublicLink not supported")
+}
+
+// Copy src to this remote using server-side copy operations.
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Copy
+	if do == nil {
+		return nil, fs.ErrorCantCopy
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantCopy
+	}
+	f.invalidate(remote)
+	oResult, err := do(ctx, o.Object, remote)
+	return f.wrapObject(oResult, err)
+}
+
+// Move src to this remote using server-side move operations.
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Move
+	if do == nil {
+		return nil, fs.ErrorCantMove
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantMove
+	}
+	f.invalidate(remote)
+	oResult, err := do(ctx, o.Object, remote)
+	if err != nil {
+		return nil, err
+	}
+	o.f.invalidate(src.Remote())
+	return f.wrapObject(oResult, nil)
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote using server-side move operations.
+//
+// The cached data of the moved files is left for the cache cleaner.
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	do := f.Fs.Features().DirMove
+	if do == nil {
+		return fs.ErrorCantDirMove
+	}
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		return fs.ErrorCantDirMove
+	}
+	return do(ctx, srcFs.Fs, srcRemote, dstRemote)
+}
+
+// Shutdown the backend, closing any background tasks and any cached connections.
+func (f *Fs) Shutdown(ctx context.Context) (err error) {
+	if f.cache != nil {
+		f.cache.release()
+		f.cache = nil
+	}
+	if do := f.Fs.Features().Shutdown; do != nil {
+		err = do(ctx)
+	}
+	return err
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.Purger          = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Mover           = (*Fs)(nil)
+	_ fs.DirMover        = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
+	_ fs.PutUncheckeder  = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.CleanUpper      = (*Fs)(nil)
+	_ fs.UnWrapper       = (*Fs)(nil)
+	_ fs.ListRer         = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.Wrapper         = (*Fs)(nil)
+	_ fs.MergeDirser     = (*Fs)(nil)
+	_ fs.DirSetModTimer  = (*Fs)(nil)
+	_ fs.MkdirMetadataer = (*Fs)(nil)
+	_ fs.DirCacheFlusher = (*Fs)(nil)
+	_ fs.ChangeNotifier  = (*Fs)(nil)
+	_ fs.PublicLinker    = (*Fs)(nil)
+	_ fs.UserInfoer      = (*Fs)(nil)
+	_ fs.Disconnecter    = (*Fs)(nil)
+	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.FullObject      = (*Object)(nil)
+)
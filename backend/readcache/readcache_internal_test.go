@@ -0,0 +1,95 @@
+package readcache
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/rclone/rclone/lib/ranges"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// read the range of o given by options
+func read(ctx context.Context, t *testing.T, o fs.Object, options ...fs.OpenOption) string {
+	in, err := o.Open(ctx, options...)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+func (f *Fs) testCaching(t *testing.T) {
+	ctx := context.Background()
+	const (
+		remote = "cached/file.bin"
+		size   = 64 * 1024
+	)
+	contents := random.String(size)
+	item := fstest.NewItem(remote, contents, fstest.Time("2001-02-03T04:05:06.499999999Z"))
+	o := fstests.PutTestContents(ctx, t, f, &item, contents, true)
+	defer func() {
+		_ = o.Remove(ctx)
+	}()
+	cacheItem := f.cache.Item(f.cacheName(remote))
+
+	// Only the range read is fetched
+	got := read(ctx, t, o, &fs.RangeOption{Start: size / 2, End: size/2 + 999})
+	assert.Equal(t, contents[size/2:size/2+1000], got)
+	assert.True(t, cacheItem.HasRange(ranges.Range{Pos: size / 2, Size: 1000}))
+	assert.False(t, cacheItem.HasRange(ranges.Range{Pos: 0, Size: 1000}))
+
+	// Seeks and full reads are served with the missing parts filled in
+	assert.Equal(t, contents[size-10:], read(ctx, t, o, &fs.SeekOption{Offset: size - 10}))
+	assert.Equal(t, contents, read(ctx, t, o))
+	assert.True(t, cacheItem.HasRange(ranges.Range{Pos: 0, Size: size}))
+
+	// Changing the file behind the cache's back invalidates it
+	newContents := strings.Repeat("x", size/2)
+	newItem := fstest.NewItem(remote, newContents, fstest.Time("2002-02-03T04:05:06.499999999Z"))
+	_ = fstests.PutTestContents(ctx, t, f.Fs, &newItem, newContents, true)
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	assert.Equal(t, newContents, read(ctx, t, o))
+
+	// Removing the file drops the cached data
+	require.NoError(t, o.Remove(ctx))
+	assert.False(t, f.cache.Exists(f.cacheName(remote)))
+}
+
+func (f *Fs) testShrink(t *testing.T) {
+	ctx := context.Background()
+	const remote = "cached/shrink.txt"
+	contents := "a file which will shrink"
+	item := fstest.NewItem(remote, contents, time.Now())
+	o := fstests.PutTestContents(ctx, t, f, &item, contents, true)
+	defer func() {
+		_ = o.Remove(ctx)
+	}()
+	assert.Equal(t, contents, read(ctx, t, o))
+
+	// A stale object gets the new data but can't read past its end
+	newItem := fstest.NewItem(remote, "shrunk", time.Now())
+	_ = fstests.PutTestContents(ctx, t, f.Fs, &newItem, "shrunk", true)
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "shrunk", string(data))
+	require.NoError(t, in.Close())
+}
+
+// InternalTest dispatches all internal tests
+func (f *Fs) InternalTest(t *testing.T) {
+	t.Run("Caching", f.testCaching)
+	t.Run("Shrink", f.testShrink)
+}
+
+var _ fstests.InternalTester = (*Fs)(nil)
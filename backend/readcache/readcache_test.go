@@ -0,0 +1,33 @@
+package readcache_test
+
+import (
+	"testing"
+
+	"github.com/rclone/rclone/backend/readcache"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+
+	_ "github.com/rclone/rclone/backend/all" // for integration tests
+)
+
+// TestIntegration runs integration tests against the remote
+func TestIntegration(t *testing.T) {
+	opt := fstests.Opt{
+		RemoteName: *fstest.RemoteName,
+		NilObject:  (*readcache.Object)(nil),
+		UnimplementableFsMethods: []string{
+			"OpenWriterAt",
+			"OpenChunkWriter",
+		},
+		UnimplementableObjectMethods: []string{},
+	}
+	if *fstest.RemoteName == "" {
+		opt.ExtraConfig = []fstests.ExtraConfigItem{
+			{Name: "TestReadCache", Key: "type", Value: "readcache"},
+			{Name: "TestReadCache", Key: "remote", Value: t.TempDir()},
+		}
+		opt.RemoteName = "TestReadCache:"
+		opt.QuickTestOK = true
+	}
+	fstests.Run(t, &opt)
+}
@@ -14,4 +14,8 @@ type Options struct {
 	SearchPolicy string          `config:"search_policy"`
 	CacheTime    int             `config:"cache_time"`
 	MinFreeSpace fs.SizeSuffix   `config:"min_free_space"`
+	Replicas     int             `config:"replicas"`
+	DataShards   int             `config:"erasure_data_shards"`
+	ParityShards int             `config:"erasure_parity_shards"`
+	Repair       bool            `config:"repair"`
 }
@@ -103,7 +103,31 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 		}
 	})
 	errs[len(entries)] = <-errChan
-	return errs.Err()
+	err = errs.Err()
+	if err != nil && o.fs.replicas > 0 && errs[len(entries)] == nil {
+		// When replicating the update succeeds if any copy was
+		// updated and the others are repaired in the background
+		var failed []*upstream.Object
+		for i, e := range entries {
+			if errs[i] != nil {
+				if obj, ok := e.(*upstream.Object); ok {
+					failed = append(failed, obj)
+				}
+			}
+		}
+		if len(failed) < len(entries) {
+			fs.Errorf(o, "Failed to update some copies - will repair: %v", err)
+			// Remove the failed copies so they can't be read instead
+			for _, obj := range failed {
+				if removeErr := obj.Remove(ctx); removeErr != nil {
+					fs.Debugf(obj, "Failed to remove out of date copy: %v", removeErr)
+				}
+			}
+			o.fs.repair.add(o.Remote())
+			return nil
+		}
+	}
+	return err
 }
 
 // Remove candidate objects selected by ACTION policy
@@ -200,7 +224,24 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadClo
 		o.Object = newObj
 		o.co = append(o.co, newObj) // FIXME should this append or overwrite or update?
 	}
-	return o.Object.Object.Open(ctx, options...)
+	in, err := o.Object.Object.Open(ctx, options...)
+	if err == nil || o.fs.replicas == 0 {
+		return in, err
+	}
+	// Read from another copy if this one failed
+	for _, e := range o.co {
+		c, ok := e.(*upstream.Object)
+		if !ok || c == o.Object || c.Size() != o.Size() {
+			continue
+		}
+		fs.Debugf(o, "Failed to open copy on %s - trying %s: %v", o.Object.UpstreamFs().Name(), c.UpstreamFs().Name(), err)
+		in, cErr := c.Object.Open(ctx, options...)
+		if cErr == nil {
+			o.fs.repair.add(o.Remote())
+			return in, nil
+		}
+	}
+	return nil, err
 }
 
 // ModTime returns the modification date of the directory
@@ -219,6 +260,31 @@ func (d *Directory) ModTime(ctx context.Context) (t time.Time) {
 	return t
 }
 
+// Metadata returns metadata for a DirEntry
+//
+// This is the metadata of the most recently modified candidate so it
+// matches the modification time returned by ModTime.
+func (d *Directory) Metadata(ctx context.Context) (fs.Metadata, error) {
+	entries := d.candidates()
+	times := make([]time.Time, len(entries))
+	multithread(len(entries), func(i int) {
+		times[i] = entries[i].ModTime(ctx)
+	})
+	var (
+		newest = d.Directory
+		t      time.Time
+	)
+	for i, ti := range times {
+		if dir, ok := entries[i].(*upstream.Directory); ok && t.Before(ti) {
+			newest, t = dir, ti
+		}
+	}
+	if newest == nil {
+		return nil, nil
+	}
+	return newest.Metadata(ctx)
+}
+
 // Size returns the size of the directory
 // It returns the sum of all candidates
 func (d *Directory) Size() (s int64) {
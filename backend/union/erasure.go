@@ -0,0 +1,1050 @@
+package union
+
+// Erasure coding stores each file as data and parity shards on
+// different upstreams using Reed-Solomon coding so the file can be
+// read even if some of the upstreams are unavailable.
+//
+// Each shard is stored as a file called "name.rclone_ec.N" where N is
+// the index of the shard. Names like this are reserved so files with
+// them can't be uploaded. The shard starts with a header, which has
+// the size of the original file, followed by the blocks of the shard,
+// each followed by its CRC-32C so damaged blocks can be found and
+// reconstructed from the other shards.
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/reedsolomon"
+	"github.com/rclone/rclone/backend/union/common"
+	"github.com/rclone/rclone/backend/union/upstream"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/readers"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	ecMagic      = "RCLONEEC"
+	ecVersion    = 1
+	ecHeaderSize = 32         // size of the header at the start of each shard
+	ecBlockSize  = 256 * 1024 // size of a shard block in a full stripe
+	ecCRCSize    = 4          // size of the CRC after each block
+)
+
+var (
+	ecNameRegexp = regexp.MustCompile(`^(.+)\.rclone_ec\.(\d{1,3})$`)
+	ecCRCTable   = crc32.MakeTable(crc32.Castagnoli)
+
+	errECTooFewShards = errors.New("not enough erasure coded shards available to read file")
+	errECBadHeader    = errors.New("bad erasure coded shard header")
+	errECBadBlock     = errors.New("erasure coded shard block failed CRC check")
+	errECReservedName = errors.New("file names ending in .rclone_ec.N are reserved for erasure coded shards")
+)
+
+// erasure is the erasure coding configuration
+type erasure struct {
+	dataShards   int
+	parityShards int
+}
+
+// newErasure checks the erasure coding options against the upstreams
+func newErasure(opt *common.Options, upstreams []*upstream.Fs) (*erasure, error) {
+	e := &erasure{
+		dataShards:   opt.DataShards,
+		parityShards: opt.ParityShards,
+	}
+	_, err := reedsolomon.New(e.dataShards, e.parityShards)
+	if err != nil {
+		return nil, fmt.Errorf("bad erasure coding shards: %w", err)
+	}
+	creatable := 0
+	for _, u := range upstreams {
+		if u.IsCreatable() {
+			creatable++
+		}
+	}
+	if e.shards() > creatable {
+		return nil, fmt.Errorf("erasure coding with %d+%d shards needs %d upstreams which can be created on but only have %d", e.dataShards, e.parityShards, e.shards(), creatable)
+	}
+	return e, nil
+}
+
+// shards returns the total number of shards
+func (e *erasure) shards() int {
+	return e.dataShards + e.parityShards
+}
+
+// ecShardName returns the name of shard index of remote
+func ecShardName(remote string, index int) string {
+	return remote + ".rclone_ec." + strconv.Itoa(index)
+}
+
+// parseECShardName parses a shard name made by ecShardName
+func parseECShardName(name string) (remote string, index int, ok bool) {
+	match := ecNameRegexp.FindStringSubmatch(name)
+	if match == nil {
+		return "", 0, false
+	}
+	index, err := strconv.Atoi(match[2])
+	if err != nil || index > 255 {
+		return "", 0, false
+	}
+	return match[1], index, true
+}
+
+// ecHeader is the header at the start of each shard
+type ecHeader struct {
+	dataShards   int
+	parityShards int
+	index        int   // index of this shard
+	blockSize    int   // size of the blocks in a full stripe
+	size         int64 // size of the original file
+}
+
+// shards returns the total number of shards
+func (h *ecHeader) shards() int {
+	return h.dataShards + h.parityShards
+}
+
+// marshal returns the header as bytes
+func (h *ecHeader) marshal() []byte {
+	buf := make([]byte, ecHeaderSize)
+	copy(buf, ecMagic)
+	buf[8] = ecVersion
+	buf[9] = byte(h.dataShards)
+	buf[10] = byte(h.parityShards)
+	buf[11] = byte(h.index)
+	binary.LittleEndian.PutUint32(buf[12:], uint32(h.blockSize))
+	binary.LittleEndian.PutUint64(buf[16:], uint64(h.size))
+	binary.LittleEndian.PutUint32(buf[24:], crc32.Checksum(buf[:24], ecCRCTable))
+	return buf
+}
+
+// unmarshal reads the header from buf
+func (h *ecHeader) unmarshal(buf []byte) error {
+	if len(buf) < ecHeaderSize || !bytes.Equal(buf[:8], []byte(ecMagic)) {
+		return errECBadHeader
+	}
+	if buf[8] != ecVersion {
+		return fmt.Errorf("unknown erasure coded shard version %d", buf[8])
+	}
+	if binary.LittleEndian.Uint32(buf[24:]) != crc32.Checksum(buf[:24], ecCRCTable) {
+		return errECBadHeader
+	}
+	h.dataShards = int(buf[9])
+	h.parityShards = int(buf[10])
+	h.index = int(buf[11])
+	h.blockSize = int(binary.LittleEndian.Uint32(buf[12:]))
+	h.size = int64(binary.LittleEndian.Uint64(buf[16:]))
+	if h.dataShards == 0 || h.index >= h.shards() || h.blockSize == 0 || h.size < 0 {
+		return errECBadHeader
+	}
+	return nil
+}
+
+// stripeSize returns the amount of file data in a full stripe
+func (h *ecHeader) stripeSize() int64 {
+	return int64(h.dataShards) * int64(h.blockSize)
+}
+
+// stripes returns the number of stripes in the file
+func (h *ecHeader) stripes() int64 {
+	return (h.size + h.stripeSize() - 1) / h.stripeSize()
+}
+
+// stripeLen returns the amount of file data in stripe s
+func (h *ecHeader) stripeLen(s int64) int64 {
+	return min(h.stripeSize(), h.size-s*h.stripeSize())
+}
+
+// blockLen returns the length of each shard block in stripe s
+//
+// Only the last stripe can be shorter than blockSize.
+func (h *ecHeader) blockLen(s int64) int {
+	return int((h.stripeLen(s) + int64(h.dataShards) - 1) / int64(h.dataShards))
+}
+
+// blockOffset returns the offset of the block for stripe s in a shard
+func (h *ecHeader) blockOffset(s int64) int64 {
+	return ecHeaderSize + s*int64(h.blockSize+ecCRCSize)
+}
+
+// shardSize returns the size of each shard file
+func (h *ecHeader) shardSize() int64 {
+	n := h.stripes()
+	if n == 0 {
+		return ecHeaderSize
+	}
+	return h.blockOffset(n-1) + int64(h.blockLen(n-1)+ecCRCSize)
+}
+
+// ecObject is an erasure coded file stored as shards on the upstreams
+type ecObject struct {
+	fs     *Fs
+	remote string
+	size   int64
+	shards []*upstream.Object // indexed by shard, nil if missing
+}
+
+// newECObject makes an ecObject from the upstream objects which
+// must be shards of the same file
+func (f *Fs) newECObject(remote string, size int64, shards []*upstream.Object) *ecObject {
+	o := &ecObject{
+		fs:     f,
+		remote: remote,
+		size:   size,
+		shards: make([]*upstream.Object, f.erasure.shards()),
+	}
+	for _, shard := range shards {
+		_, index, _ := parseECShardName(shard.Remote())
+		if index >= len(o.shards) {
+			o.shards = append(o.shards, make([]*upstream.Object, index+1-len(o.shards))...)
+		}
+		o.shards[index] = shard
+	}
+	return o
+}
+
+// ecObjectFromShards makes an ecObject from the shards of remote
+// reading the size of the file from the shard headers
+func (f *Fs) ecObjectFromShards(ctx context.Context, remote string, shards []*upstream.Object) (*ecObject, error) {
+	err := errECTooFewShards
+	for _, shard := range shards {
+		var h ecHeader
+		h, err = readECHeader(ctx, shard)
+		if err != nil {
+			fs.Debugf(shard, "Failed to read erasure coded shard header: %v", err)
+			continue
+		}
+		o := f.newECObject(remote, h.size, shards)
+		if o.count() < len(o.shards) {
+			f.repair.add(remote)
+		}
+		return o, nil
+	}
+	return nil, fmt.Errorf("failed to read erasure coded shard headers: %w", err)
+}
+
+// mergeShards adds the ecObjects made from the shards to entries
+func (f *Fs) mergeShards(ctx context.Context, entries fs.DirEntries, shards []*upstream.Object) fs.DirEntries {
+	groups := make(map[string][]*upstream.Object)
+	var order []string
+	for _, shard := range shards {
+		key, _, _ := parseECShardName(shard.Remote())
+		if f.Features().CaseInsensitive {
+			key = strings.ToLower(key)
+		}
+		if _, found := groups[key]; !found {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], shard)
+	}
+	// Read the headers for the sizes --checkers at a time
+	objs := make([]*ecObject, len(order))
+	var g errgroup.Group
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	for i, key := range order {
+		i, group := i, groups[key]
+		g.Go(func() error {
+			remote, _, _ := parseECShardName(group[0].Remote())
+			o, err := f.ecObjectFromShards(ctx, remote, group)
+			if err != nil {
+				fs.Errorf(remote, "Ignoring erasure coded file: %v", err)
+				return nil
+			}
+			objs[i] = o
+			return nil
+		})
+	}
+	_ = g.Wait()
+	for _, o := range objs {
+		if o != nil {
+			entries = append(entries, o)
+		}
+	}
+	return entries
+}
+
+// ecNewObject finds the erasure coded or ordinary object at remote
+func (f *Fs) ecNewObject(ctx context.Context, remote string) (fs.Object, error) {
+	if _, _, isShard := parseECShardName(remote); isShard {
+		return nil, fs.ErrorObjectNotFound
+	}
+	o, err := f.newObject(ctx, remote)
+	if err != fs.ErrorObjectNotFound {
+		return o, err
+	}
+	shards, err := f.findShards(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	if len(shards) == 0 {
+		return nil, fs.ErrorObjectNotFound
+	}
+	return f.ecObjectFromShards(ctx, remote, shards)
+}
+
+// findShards looks up the shards of remote by name
+//
+// Each shard is looked for on the upstream ecUpstreams puts it on
+// first, then on the others as repairs may have put it elsewhere.
+func (f *Fs) findShards(ctx context.Context, remote string) ([]*upstream.Object, error) {
+	n := f.erasure.shards()
+	found := make([]*upstream.Object, n)
+	errs := Errors(make([]error, n))
+	find := func(i int, u *upstream.Fs) {
+		o, err := u.NewObject(ctx, ecShardName(remote, i))
+		if err == nil {
+			found[i] = u.WrapObject(o)
+		} else if err != fs.ErrorObjectNotFound {
+			errs[i] = fmt.Errorf("%s: %w", u.Name(), err)
+		}
+	}
+	preferred, err := f.ecUpstreams(remote, n)
+	if err == nil {
+		multithread(n, func(i int) {
+			find(i, preferred[i])
+		})
+	}
+	multithread(n, func(i int) {
+		for _, u := range f.upstreams {
+			if found[i] != nil {
+				return
+			}
+			if preferred == nil || u != preferred[i] {
+				find(i, u)
+			}
+		}
+	})
+	var shards []*upstream.Object
+	for _, shard := range found {
+		if shard != nil {
+			shards = append(shards, shard)
+		}
+	}
+	return shards, errs.Err()
+}
+
+// ecUpstreams returns the upstreams to store the shards of remote on
+//
+// The first upstream is chosen from the name so the shards of
+// different files are spread over the upstreams.
+func (f *Fs) ecUpstreams(remote string, n int) ([]*upstream.Fs, error) {
+	var creatable []*upstream.Fs
+	for _, u := range f.upstreams {
+		if u.IsCreatable() {
+			creatable = append(creatable, u)
+		}
+	}
+	if len(creatable) < n {
+		return nil, fmt.Errorf("need %d upstreams for erasure coded shards but only have %d: %w", n, len(creatable), fs.ErrorPermissionDenied)
+	}
+	start := int(crc32.ChecksumIEEE([]byte(remote)) % uint32(len(creatable)))
+	upstreams := make([]*upstream.Fs, n)
+	for i := range upstreams {
+		upstreams[i] = creatable[(start+i)%len(creatable)]
+	}
+	return upstreams, nil
+}
+
+// shardInfo returns the ObjectInfo for uploading shard index of src
+func (f *Fs) shardInfo(ctx context.Context, src fs.ObjectInfo, h *ecHeader, index int) *object.StaticObjectInfo {
+	return object.NewStaticObjectInfo(ecShardName(src.Remote(), index), src.ModTime(ctx), h.shardSize(), true, nil, f)
+}
+
+// shardWriters writes to the shards being uploaded
+type shardWriters struct {
+	writers []*io.PipeWriter // nil if not writing this shard
+	failed  []bool           // set if the upload failed
+	crc     [ecCRCSize]byte
+}
+
+// newShardWriters makes n shardWriters
+func newShardWriters(n int) *shardWriters {
+	return &shardWriters{
+		writers: make([]*io.PipeWriter, n),
+		failed:  make([]bool, n),
+	}
+}
+
+// pipe makes a pipe for shard i returning the reader for the upload
+func (w *shardWriters) pipe(i int) *io.PipeReader {
+	pr, pw := io.Pipe()
+	w.writers[i] = pw
+	return pr
+}
+
+// write writes p to shard i ignoring shards which have failed
+func (w *shardWriters) write(i int, p []byte) {
+	if w.writers[i] == nil || w.failed[i] {
+		return
+	}
+	if _, err := w.writers[i].Write(p); err != nil {
+		w.failed[i] = true
+	}
+}
+
+// writeBlock writes block and its CRC to shard i
+func (w *shardWriters) writeBlock(i int, block []byte) {
+	binary.LittleEndian.PutUint32(w.crc[:], crc32.Checksum(block, ecCRCTable))
+	w.write(i, block)
+	w.write(i, w.crc[:])
+}
+
+// writeHeaders writes the header for each shard
+func (w *shardWriters) writeHeaders(h ecHeader) {
+	for i := range w.writers {
+		h.index = i
+		w.write(i, h.marshal())
+	}
+}
+
+// close closes the writers with err
+func (w *shardWriters) close(err error) {
+	for _, pw := range w.writers {
+		if pw != nil {
+			_ = pw.CloseWithError(err)
+		}
+	}
+}
+
+// ecEncode reads the file from in and writes the shards to w
+func ecEncode(in io.Reader, h *ecHeader, enc reedsolomon.Encoder, w *shardWriters) (err error) {
+	defer func() {
+		w.close(err)
+	}()
+	w.writeHeaders(*h)
+	n := h.shards()
+	data := make([]byte, h.stripeSize())
+	parity := make([]byte, h.parityShards*h.blockSize)
+	shards := make([][]byte, n)
+	for s := int64(0); s < h.stripes(); s++ {
+		length, bl := h.stripeLen(s), h.blockLen(s)
+		_, err = io.ReadFull(in, data[:length])
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read source: %w", err)
+		}
+		clear(data[length : h.dataShards*bl])
+		for i := range shards {
+			if i < h.dataShards {
+				shards[i] = data[i*bl : (i+1)*bl]
+			} else {
+				j := i - h.dataShards
+				shards[i] = parity[j*bl : (j+1)*bl]
+			}
+		}
+		err = enc.Encode(shards)
+		if err != nil {
+			return err
+		}
+		for i, shard := range shards {
+			w.writeBlock(i, shard)
+		}
+	}
+	// Check the source was the size it claimed to be
+	var extra [1]byte
+	if n, _ := readers.ReadFill(in, extra[:]); n != 0 {
+		return fmt.Errorf("source is bigger than its size %d", h.size)
+	}
+	return nil
+}
+
+// ecPut uploads src as erasure coded shards
+//
+// If old is set its shards which weren't overwritten are removed
+// after the upload.
+func (f *Fs) ecPut(ctx context.Context, in io.Reader, src fs.ObjectInfo, old *ecObject, options ...fs.OpenOption) (*ecObject, error) {
+	if src.Size() < 0 {
+		return nil, errors.New("can't upload files of unknown size with erasure coding")
+	}
+	if _, _, isShard := parseECShardName(src.Remote()); isShard {
+		return nil, errECReservedName
+	}
+	h := &ecHeader{
+		dataShards:   f.erasure.dataShards,
+		parityShards: f.erasure.parityShards,
+		blockSize:    ecBlockSize,
+		size:         src.Size(),
+	}
+	enc, err := reedsolomon.New(h.dataShards, h.parityShards)
+	if err != nil {
+		return nil, err
+	}
+	n := h.shards()
+	upstreams, err := f.ecUpstreams(src.Remote(), n)
+	if err != nil {
+		return nil, err
+	}
+
+	// Upload the shards in parallel
+	w := newShardWriters(n)
+	pipes := make([]*io.PipeReader, n)
+	for i := range pipes {
+		pipes[i] = w.pipe(i)
+	}
+	objs := make([]*upstream.Object, n)
+	errs := Errors(make([]error, n+1))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		multithread(n, func(i int) {
+			pr := pipes[i]
+			u := upstreams[i]
+			o, err := u.Put(ctx, pr, f.shardInfo(ctx, src, h, i), options...)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", u.Name(), err)
+				_ = pr.CloseWithError(err)
+				return
+			}
+			objs[i] = u.WrapObject(o)
+		})
+	}()
+	errs[n] = ecEncode(in, h, enc, w)
+	<-done
+
+	var written []*upstream.Object
+	for _, o := range objs {
+		if o != nil {
+			written = append(written, o)
+		}
+	}
+	err = errs.Err()
+	if err != nil && (errs[n] != nil || len(written) < h.dataShards) {
+		// Remove any shards which were written as the file can't be read
+		for _, o := range written {
+			if removeErr := o.Remove(ctx); removeErr != nil {
+				fs.Errorf(o, "Failed to remove partially written shard: %v", removeErr)
+			}
+		}
+		return nil, err
+	}
+	if err != nil {
+		fs.Errorf(src, "Failed to write some erasure coded shards - will repair: %v", err)
+	}
+	o := f.newECObject(src.Remote(), h.size, written)
+	if o.count() < n {
+		f.repair.add(o.remote)
+	}
+
+	// Remove the shards of the old object which weren't overwritten
+	if old != nil {
+		for _, oldShard := range old.shards {
+			if oldShard == nil {
+				continue
+			}
+			overwritten := false
+			for _, shard := range written {
+				if shard.UpstreamFs() == oldShard.UpstreamFs() && shard.Remote() == oldShard.Remote() {
+					overwritten = true
+					break
+				}
+			}
+			if !overwritten {
+				if removeErr := oldShard.Remove(ctx); removeErr != nil {
+					fs.Errorf(oldShard, "Failed to remove old shard: %v", removeErr)
+				}
+			}
+		}
+	}
+	return o, nil
+}
+
+// Fs returns the union Fs as the parent
+func (o *ecObject) Fs() fs.Info {
+	return o.fs
+}
+
+// String returns a description of the Object
+func (o *ecObject) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *ecObject) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the file
+func (o *ecObject) Size() int64 {
+	return o.size
+}
+
+// ModTime returns the modification time of the file
+func (o *ecObject) ModTime(ctx context.Context) time.Time {
+	for _, shard := range o.shards {
+		if shard != nil {
+			return shard.ModTime(ctx)
+		}
+	}
+	return time.Time{}
+}
+
+// Hash returns the selected checksum of the file
+//
+// Erasure coded files don't have hashes.
+func (o *ecObject) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	return "", hash.ErrUnsupported
+}
+
+// Storable says whether this object can be stored
+func (o *ecObject) Storable() bool {
+	return true
+}
+
+// count returns the number of shards present
+func (o *ecObject) count() (n int) {
+	for _, shard := range o.shards {
+		if shard != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// SetModTime sets the modification time of all the shards
+func (o *ecObject) SetModTime(ctx context.Context, t time.Time) error {
+	errs := Errors(make([]error, len(o.shards)))
+	multithread(len(o.shards), func(i int) {
+		if shard := o.shards[i]; shard != nil {
+			err := shard.SetModTime(ctx, t)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", shard.UpstreamFs().Name(), err)
+			}
+		}
+	})
+	return errs.Err()
+}
+
+// Update the file with the contents of in
+func (o *ecObject) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	src = fs.NewOverrideRemote(src, o.remote)
+	newO, err := o.fs.ecPut(ctx, in, src, o, options...)
+	if err != nil {
+		return err
+	}
+	*o = *newO
+	return nil
+}
+
+// Remove all the shards
+func (o *ecObject) Remove(ctx context.Context) error {
+	errs := Errors(make([]error, len(o.shards)))
+	multithread(len(o.shards), func(i int) {
+		if shard := o.shards[i]; shard != nil {
+			err := shard.Remove(ctx)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", shard.UpstreamFs().Name(), err)
+			}
+		}
+	})
+	return errs.Err()
+}
+
+// readECHeader reads the header of shard
+func readECHeader(ctx context.Context, shard *upstream.Object) (h ecHeader, err error) {
+	in, err := shard.Open(ctx, &fs.RangeOption{Start: 0, End: ecHeaderSize - 1})
+	if err != nil {
+		return h, err
+	}
+	buf := make([]byte, ecHeaderSize)
+	_, err = io.ReadFull(in, buf)
+	_ = in.Close()
+	if err != nil {
+		return h, err
+	}
+	err = h.unmarshal(buf)
+	return h, err
+}
+
+// shardReader reads the shards of an ecObject a stripe at a time
+type shardReader struct {
+	ctx     context.Context
+	o       *ecObject
+	h       ecHeader
+	enc     reedsolomon.Encoder
+	all     bool            // read all the shards not just enough to decode
+	readers []io.ReadCloser // open shards or nil
+	at      []int64         // the stripe each open shard is at
+	bad     []bool          // set if shard is missing or damaged
+	damaged bool            // set if a shard failed while reading
+	stripe  int64           // the next stripe to read
+	blocks  [][]byte        // buffers for the blocks
+	shards  [][]byte        // the blocks of the stripe, empty if missing
+}
+
+// newShardReader makes a shardReader for o starting at stripe 0
+//
+// If all is set then it reads all the shards, otherwise it only reads
+// enough to decode the data. Shards marked in bad aren't read.
+func (o *ecObject) newShardReader(ctx context.Context, all bool, bad []bool) (*shardReader, error) {
+	r := &shardReader{
+		ctx: ctx,
+		o:   o,
+		all: all,
+	}
+	found := false
+	for i, shard := range o.shards {
+		if shard == nil || (i < len(bad) && bad[i]) {
+			continue
+		}
+		h, err := readECHeader(ctx, shard)
+		if err == nil && (h.index != i || h.size != o.size) {
+			err = errECBadHeader
+		}
+		if err != nil {
+			fs.Debugf(shard, "Failed to read erasure coded shard header: %v", err)
+			r.damaged = true
+			continue
+		}
+		r.h, found = h, true
+		break
+	}
+	if !found {
+		return nil, errECTooFewShards
+	}
+	n := r.h.shards()
+	if len(o.shards) < n {
+		o.shards = append(o.shards, make([]*upstream.Object, n-len(o.shards))...)
+	}
+	var err error
+	r.enc, err = reedsolomon.New(r.h.dataShards, r.h.parityShards)
+	if err != nil {
+		return nil, err
+	}
+	r.readers = make([]io.ReadCloser, n)
+	r.at = make([]int64, n)
+	r.bad = make([]bool, n)
+	r.blocks = make([][]byte, n)
+	r.shards = make([][]byte, n)
+	present := 0
+	for i := range r.bad {
+		r.bad[i] = o.shards[i] == nil || (i < len(bad) && bad[i])
+		if !r.bad[i] {
+			present++
+		}
+	}
+	if present < r.h.dataShards {
+		return nil, errECTooFewShards
+	}
+	return r, nil
+}
+
+// fail marks shard i as bad
+func (r *shardReader) fail(i int, err error) {
+	fs.Debugf(r.o.shards[i], "Erasure coded shard failed: %v", err)
+	if r.readers[i] != nil {
+		_ = r.readers[i].Close()
+		r.readers[i] = nil
+	}
+	r.bad[i] = true
+	r.damaged = true
+}
+
+// readBlock reads the block of shard i for the current stripe
+func (r *shardReader) readBlock(i int, bl int) ([]byte, error) {
+	if r.readers[i] != nil && r.at[i] != r.stripe {
+		_ = r.readers[i].Close()
+		r.readers[i] = nil
+	}
+	if r.readers[i] == nil {
+		in, err := r.o.shards[i].Open(r.ctx, &fs.SeekOption{Offset: r.h.blockOffset(r.stripe)})
+		if err != nil {
+			return nil, err
+		}
+		r.readers[i] = in
+		r.at[i] = r.stripe
+	}
+	if cap(r.blocks[i]) < bl+ecCRCSize {
+		r.blocks[i] = make([]byte, r.h.blockSize+ecCRCSize)
+	}
+	block := r.blocks[i][:bl+ecCRCSize]
+	_, err := io.ReadFull(r.readers[i], block)
+	if err != nil {
+		return nil, err
+	}
+	r.at[i]++
+	if binary.LittleEndian.Uint32(block[bl:]) != crc32.Checksum(block[:bl], ecCRCTable) {
+		return nil, errECBadBlock
+	}
+	return block[:bl], nil
+}
+
+// next reads the next stripe into r.shards
+//
+// Missing shards are left empty. It returns errECTooFewShards if
+// there aren't enough shards to decode the stripe.
+func (r *shardReader) next() error {
+	bl := r.h.blockLen(r.stripe)
+	need := r.h.dataShards
+	if r.all {
+		need = r.h.shards()
+	}
+	got := 0
+	for i := range r.shards {
+		r.shards[i] = r.blocks[i][:0]
+		if got >= need || r.bad[i] {
+			continue
+		}
+		block, err := r.readBlock(i, bl)
+		if err != nil {
+			r.fail(i, err)
+			continue
+		}
+		r.shards[i] = block
+		got++
+	}
+	if got < r.h.dataShards {
+		return errECTooFewShards
+	}
+	r.stripe++
+	return nil
+}
+
+// close closes the open shards
+func (r *shardReader) close() {
+	for i, in := range r.readers {
+		if in != nil {
+			_ = in.Close()
+			r.readers[i] = nil
+		}
+	}
+}
+
+// ecReader reads the data of an ecObject
+type ecReader struct {
+	r         *shardReader
+	skip      int64  // bytes to skip at the start of the next stripe
+	remaining int64  // bytes left to read or -1 for all
+	buf       []byte // buffer for the stripe
+	data      []byte // data from the stripe not yet read
+}
+
+// Read reads the file data into p
+func (e *ecReader) Read(p []byte) (n int, err error) {
+	r := e.r
+	for len(e.data) == 0 {
+		if e.remaining == 0 || r.stripe >= r.h.stripes() {
+			return 0, io.EOF
+		}
+		s := r.stripe
+		err = r.next()
+		if err != nil {
+			return 0, err
+		}
+		err = r.enc.ReconstructData(r.shards)
+		if err != nil {
+			return 0, err
+		}
+		e.buf = e.buf[:0]
+		for _, shard := range r.shards[:r.h.dataShards] {
+			e.buf = append(e.buf, shard...)
+		}
+		e.data = e.buf[e.skip:r.h.stripeLen(s)]
+		e.skip = 0
+	}
+	if e.remaining >= 0 && int64(len(e.data)) > e.remaining {
+		e.data = e.data[:e.remaining]
+	}
+	n = copy(p, e.data)
+	e.data = e.data[n:]
+	if e.remaining >= 0 {
+		e.remaining -= int64(n)
+	}
+	return n, nil
+}
+
+// Close the reader queueing the file for repair if any shards failed
+func (e *ecReader) Close() error {
+	e.r.close()
+	if e.r.damaged {
+		e.r.o.fs.repair.add(e.r.o.remote)
+	}
+	return nil
+}
+
+// Open the file for reading, reconstructing it from the shards
+func (o *ecObject) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	r, err := o.newShardReader(ctx, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > o.size {
+		offset = o.size
+	}
+	r.stripe = offset / r.h.stripeSize()
+	return &ecReader{
+		r:         r,
+		skip:      offset % r.h.stripeSize(),
+		remaining: limit,
+	}, nil
+}
+
+// repairShards rewrites the missing and damaged shards of remote
+func (f *Fs) repairShards(ctx context.Context, remote string) error {
+	obj, err := f.NewObject(ctx, remote)
+	if err != nil {
+		return err
+	}
+	o, ok := obj.(*ecObject)
+	if !ok {
+		// Not erasure coded
+		return nil
+	}
+
+	// Read all the shards to find the damaged ones
+	r, err := o.newShardReader(ctx, true, nil)
+	if err != nil {
+		return err
+	}
+	for r.stripe < r.h.stripes() && err == nil {
+		err = r.next()
+	}
+	r.close()
+	if err != nil {
+		return err
+	}
+	bad := r.bad
+	h := r.h
+	n := h.shards()
+	var toWrite []int
+	for i := range bad {
+		if bad[i] {
+			toWrite = append(toWrite, i)
+		}
+	}
+	if len(toWrite) == 0 {
+		return nil
+	}
+
+	// Work out where to write the shards - damaged shards are
+	// overwritten and missing ones made on an upstream without
+	// any shards of this file
+	used := make(map[*upstream.Fs]bool)
+	for _, shard := range o.shards {
+		if shard != nil {
+			used[shard.UpstreamFs()] = true
+		}
+	}
+	preferred, err := f.ecUpstreams(remote, n)
+	if err != nil {
+		return err
+	}
+	targets := make([]*upstream.Fs, n)
+	for _, i := range toWrite {
+		if o.shards[i] != nil {
+			targets[i] = o.shards[i].UpstreamFs()
+			continue
+		}
+		candidates := append([]*upstream.Fs{preferred[i]}, f.upstreams...)
+		for _, u := range candidates {
+			if u.IsCreatable() && !used[u] {
+				targets[i] = u
+				used[u] = true
+				break
+			}
+		}
+		if targets[i] == nil {
+			fs.Errorf(o, "No upstream available to repair erasure coded shard %d", i)
+		}
+	}
+
+	// Reconstruct the shards and write them
+	r, err = o.newShardReader(ctx, true, bad)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	w := newShardWriters(n)
+	errs := Errors(make([]error, n+1))
+	src := object.NewStaticObjectInfo(remote, o.ModTime(ctx), h.size, true, nil, f)
+	var writing []int
+	for _, i := range toWrite {
+		if targets[i] != nil {
+			writing = append(writing, i)
+		}
+	}
+	pipes := make([]*io.PipeReader, n)
+	for _, i := range writing {
+		pipes[i] = w.pipe(i)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		multithread(len(writing), func(j int) {
+			i := writing[j]
+			info := f.shardInfo(ctx, src, &h, i)
+			var err error
+			if o.shards[i] != nil {
+				err = o.shards[i].Update(ctx, pipes[i], info)
+			} else {
+				_, err = targets[i].Put(ctx, pipes[i], info)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", targets[i].Name(), err)
+				_ = pipes[i].CloseWithError(err)
+			}
+		})
+	}()
+	errs[n] = func() (err error) {
+		defer func() {
+			w.close(err)
+		}()
+		w.writeHeaders(h)
+		for r.stripe < h.stripes() {
+			err = r.next()
+			if err != nil {
+				return err
+			}
+			err = r.enc.Reconstruct(r.shards)
+			if err != nil {
+				return err
+			}
+			for _, i := range writing {
+				w.writeBlock(i, r.shards[i])
+			}
+		}
+		return nil
+	}()
+	<-done
+	err = errs.Err()
+	if err != nil {
+		return err
+	}
+	fs.Infof(o, "Repaired %d erasure coded shards", len(writing))
+	return nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object = (*ecObject)(nil)
+)
@@ -0,0 +1,81 @@
+package policy
+
+import (
+	"context"
+	"sort"
+
+	"github.com/rclone/rclone/backend/union/upstream"
+	"github.com/rclone/rclone/fs"
+)
+
+func init() {
+	registerPolicy("replicate", &Replicate{})
+}
+
+// Replicate stands for replicate to N upstreams
+// Action category: same as epall.
+// Create category: Pick the replicas upstreams with the most free space.
+// Search category: same as epff.
+type Replicate struct {
+	EpAll
+}
+
+// Replicas returns the number of copies wanted of each file out of
+// the upstreams
+func (p *Replicate) Replicas(upstreams []*upstream.Fs) int {
+	upstreams = filterNC(upstreams)
+	if len(upstreams) == 0 {
+		return 0
+	}
+	n := upstreams[0].Opt.Replicas
+	if n < 1 {
+		n = 1
+	}
+	if n > len(upstreams) {
+		n = len(upstreams)
+	}
+	return n
+}
+
+// mostFree returns the upstreams sorted by free space, most first
+func mostFree(upstreams []*upstream.Fs) []*upstream.Fs {
+	space := make(map[*upstream.Fs]int64, len(upstreams))
+	for _, u := range upstreams {
+		free, err := u.GetFreeSpace()
+		if err != nil {
+			fs.LogPrintf(fs.LogLevelNotice, nil,
+				"Free Space is not supported for upstream %s, treating as infinite", u.Name())
+		}
+		space[u] = free
+	}
+	sorted := append([]*upstream.Fs(nil), upstreams...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return space[sorted[i]] > space[sorted[j]]
+	})
+	return sorted
+}
+
+// Create category policy, governing the creation of files and directories
+func (p *Replicate) Create(ctx context.Context, upstreams []*upstream.Fs, path string) ([]*upstream.Fs, error) {
+	if len(upstreams) == 0 {
+		return nil, fs.ErrorObjectNotFound
+	}
+	n := p.Replicas(upstreams)
+	upstreams = filterNC(upstreams)
+	if len(upstreams) == 0 {
+		return nil, fs.ErrorPermissionDenied
+	}
+	return mostFree(upstreams)[:n], nil
+}
+
+// CreateEntries is CREATE category policy but receiving a set of candidate entries
+func (p *Replicate) CreateEntries(entries ...upstream.Entry) ([]upstream.Entry, error) {
+	if len(entries) == 0 {
+		return nil, fs.ErrorObjectNotFound
+	}
+	entries = filterNCEntries(entries)
+	if len(entries) == 0 {
+		return nil, fs.ErrorPermissionDenied
+	}
+	return entries, nil
+}
@@ -0,0 +1,554 @@
+package union
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/backend/union/upstream"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/time/rate"
+)
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "rebalance":
+		return f.rebalance(ctx, opt)
+	case "drain":
+		if len(arg) != 1 {
+			return nil, errors.New("please provide the upstream to drain")
+		}
+		return f.drain(ctx, arg[0], opt)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "rebalance",
+	Short: "Move files between upstreams to even out their usage",
+	Long: `This moves files from the upstreams which are fuller than average
+to the ones which are emptier than average, using the create policy to
+choose between the emptier upstreams. Files are moved with server-side
+Move where the upstreams support it, otherwise they are copied and
+then deleted.
+
+    rclone backend rebalance union:
+
+By default the upstreams are balanced on the fraction of their space
+which is used, as reported by "rclone about". If any upstream can't
+report its usage, or with "-o by=size", they are balanced on the total
+size of the union files stored on each instead.
+
+The rebalance can be stopped and run again at any time - it works out
+what to move from the files as they are.
+
+Use --transfers to control how many files are moved at once and
+--bwlimit to limit the bandwidth of the files which can't be moved
+server-side.
+
+It returns a summary of the files moved and the usage of the upstreams
+afterwards.
+`,
+	Opts: map[string]string{
+		"by":        "Balance on \"usage\" (default) or \"size\"",
+		"threshold": "Percentage an upstream can be over the average before files are moved off it (default 5)",
+		"tps":       "Maximum number of files to move per second (default unlimited)",
+		"max-size":  "Stop after this much data has been moved, eg 100G",
+		"dry-run":   "Show what would be moved without moving it",
+	},
+}, {
+	Name:  "drain",
+	Short: "Move all the files off an upstream",
+	Long: `This moves all the files off the upstream given on to the other
+upstreams so it can be removed from the union. The create policy is
+used to choose where each file goes, skipping upstreams which don't
+have room for it. Files are moved with server-side Move where the
+upstreams support it, otherwise they are copied and then deleted.
+
+The upstream is given as it appears in the upstreams setting, without
+any :ro, :nc or :writeback tag.
+
+    rclone backend drain union: remote2:data
+
+Files which already have an identical copy on another upstream are
+just deleted from the upstream being drained. Empty directories are
+removed from it when it is done.
+
+The drain can be stopped and run again at any time - files already
+moved are skipped. Make sure to remove the upstream from the union, or
+mark it :ro, once the drain is finished otherwise new files may be
+created on it.
+
+Use --transfers to control how many files are moved at once and
+--bwlimit to limit the bandwidth of the files which can't be moved
+server-side.
+`,
+	Opts: map[string]string{
+		"tps":      "Maximum number of files to move per second (default unlimited)",
+		"max-size": "Stop after this much data has been moved, eg 100G",
+		"dry-run":  "Show what would be moved without moving it",
+	},
+}}
+
+// balanceUpstream is the state of an upstream while balancing
+type balanceUpstream struct {
+	u       *upstream.Fs
+	used    int64                // bytes used
+	total   int64                // total bytes or 0 if unknown
+	target  int64                // bytes used wanted
+	objects []fs.Object          // the union files on the upstream
+	remotes map[string]fs.Object // the objects indexed by remote
+}
+
+// room returns how many bytes can be added to bu before it reaches
+// limit
+func (bu *balanceUpstream) room(limit int64) int64 {
+	return limit - bu.used
+}
+
+// balanceMove is a file to be moved by a rebalance or drain
+type balanceMove struct {
+	src  fs.Object
+	from *balanceUpstream // where src is
+	dst  *balanceUpstream // nil to just delete src
+	done bool             // set if the move succeeded
+}
+
+// BalanceUsage is the usage of an upstream after a rebalance or drain
+type BalanceUsage struct {
+	Upstream string `json:"upstream"`
+	Used     int64  `json:"used"`
+	Total    int64  `json:"total,omitempty"`
+}
+
+// BalanceResult is returned from the rebalance and drain commands
+type BalanceResult struct {
+	Moved     int64          `json:"moved"`
+	Deleted   int64          `json:"deleted"`
+	Bytes     int64          `json:"bytes"`
+	Errors    int64          `json:"errors"`
+	Remaining int64          `json:"remaining"`
+	Upstreams []BalanceUsage `json:"upstreams"`
+}
+
+// balanceOptions are the options common to rebalance and drain
+type balanceOptions struct {
+	tps     float64
+	maxSize fs.SizeSuffix
+	dryRun  bool
+}
+
+// parseBalanceOptions reads the options common to rebalance and drain
+func parseBalanceOptions(opt map[string]string) (bo balanceOptions, err error) {
+	bo.maxSize = -1
+	if s, ok := opt["tps"]; ok {
+		bo.tps, err = strconv.ParseFloat(s, 64)
+		if err != nil || bo.tps < 0 {
+			return bo, fmt.Errorf("bad tps %q", s)
+		}
+	}
+	if s, ok := opt["max-size"]; ok {
+		err = bo.maxSize.Set(s)
+		if err != nil {
+			return bo, fmt.Errorf("bad max-size %q: %w", s, err)
+		}
+	}
+	if s, ok := opt["dry-run"]; ok {
+		bo.dryRun = true
+		if s != "" {
+			bo.dryRun, err = strconv.ParseBool(s)
+			if err != nil {
+				return bo, fmt.Errorf("bad dry-run %q: %w", s, err)
+			}
+		}
+	}
+	return bo, nil
+}
+
+// balanceUpstreams lists the files on the upstreams which can be
+// balanced and reads their usage
+func (f *Fs) balanceUpstreams(ctx context.Context, byUsage bool) ([]*balanceUpstream, error) {
+	if f.erasure != nil {
+		return nil, errors.New("can't move files between upstreams when erasure coding")
+	}
+	var bus []*balanceUpstream
+	for _, u := range f.upstreams {
+		if u.IsWritable() {
+			bus = append(bus, &balanceUpstream{u: u, remotes: make(map[string]fs.Object)})
+		}
+	}
+	errs := Errors(make([]error, len(bus)))
+	multithread(len(bus), func(i int) {
+		bu := bus[i]
+		errs[i] = walk.ListR(ctx, bu.u, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+			entries.ForObject(func(o fs.Object) {
+				bu.objects = append(bu.objects, o)
+				bu.remotes[o.Remote()] = o
+				bu.used += o.Size()
+			})
+			return nil
+		})
+		if errors.Is(errs[i], fs.ErrorDirNotFound) {
+			errs[i] = nil
+		}
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("%s: %w", bu.u.Remote, errs[i])
+			return
+		}
+		if !byUsage {
+			return
+		}
+		usage, err := bu.u.About(ctx)
+		if err != nil || usage == nil {
+			return
+		}
+		switch {
+		case usage.Used != nil && usage.Total != nil:
+			bu.used, bu.total = *usage.Used, *usage.Total
+		case usage.Used != nil && usage.Free != nil:
+			bu.used, bu.total = *usage.Used, *usage.Used+*usage.Free
+		case usage.Total != nil && usage.Free != nil:
+			bu.used, bu.total = *usage.Total-*usage.Free, *usage.Total
+		}
+	})
+	return bus, errs.Err()
+}
+
+// pickUpstream uses the create policy to choose where to put remote
+// out of candidates
+func (f *Fs) pickUpstream(ctx context.Context, candidates []*balanceUpstream, remote string) *balanceUpstream {
+	if len(candidates) == 0 {
+		return nil
+	}
+	us := make([]*upstream.Fs, len(candidates))
+	for i, bu := range candidates {
+		us[i] = bu.u
+	}
+	picked, err := f.createPolicy.Create(ctx, us, remote)
+	if err == nil && len(picked) > 0 {
+		for _, bu := range candidates {
+			if bu.u == picked[0] {
+				return bu
+			}
+		}
+	}
+	// Path preserving policies fail if the directory doesn't
+	// exist so fall back to the emptiest candidate
+	best := candidates[0]
+	for _, bu := range candidates[1:] {
+		if bu.used < best.used {
+			best = bu
+		}
+	}
+	return best
+}
+
+// rebalance moves files from the fuller upstreams to the emptier ones
+func (f *Fs) rebalance(ctx context.Context, opt map[string]string) (*BalanceResult, error) {
+	bo, err := parseBalanceOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	byUsage := true
+	switch by := opt["by"]; by {
+	case "", "usage":
+	case "size":
+		byUsage = false
+	default:
+		return nil, fmt.Errorf("unknown by %q - expecting \"usage\" or \"size\"", by)
+	}
+	threshold := 5.0
+	if s, ok := opt["threshold"]; ok {
+		threshold, err = strconv.ParseFloat(s, 64)
+		if err != nil || threshold < 0 {
+			return nil, fmt.Errorf("bad threshold %q", s)
+		}
+	}
+	bus, err := f.balanceUpstreams(ctx, byUsage)
+	if err != nil {
+		return nil, err
+	}
+	if byUsage {
+		for _, bu := range bus {
+			if bu.total <= 0 {
+				fs.Logf(f, "Upstream %s can't report its usage - balancing on size instead", bu.u.Remote)
+				byUsage = false
+				break
+			}
+		}
+		if !byUsage {
+			for _, bu := range bus {
+				bu.used, bu.total = 0, 0
+				for _, o := range bu.objects {
+					bu.used += o.Size()
+				}
+			}
+		}
+	}
+
+	// Work out the target usage of each upstream
+	var sumUsed, sumTotal int64
+	for _, bu := range bus {
+		sumUsed += bu.used
+		sumTotal += bu.total
+	}
+	for _, bu := range bus {
+		if byUsage {
+			bu.target = int64(float64(bu.total) * float64(sumUsed) / float64(sumTotal))
+		} else if len(bus) > 0 {
+			bu.target = sumUsed / int64(len(bus))
+		}
+	}
+	tolerance := func(bu *balanceUpstream) int64 {
+		if byUsage {
+			return int64(float64(bu.total) * threshold / 100)
+		}
+		return int64(float64(bu.target) * threshold / 100)
+	}
+
+	// Plan the moves from the upstreams over the threshold,
+	// biggest files first, until they are down to the target
+	var moves []balanceMove
+	for _, src := range bus {
+		if src.used-src.target <= tolerance(src) {
+			continue
+		}
+		objects := append([]fs.Object(nil), src.objects...)
+		sort.SliceStable(objects, func(i, j int) bool {
+			return objects[i].Size() > objects[j].Size()
+		})
+		for _, o := range objects {
+			if src.used <= src.target {
+				break
+			}
+			size := o.Size()
+			if size <= 0 {
+				continue
+			}
+			var candidates []*balanceUpstream
+			for _, dst := range bus {
+				if dst == src || !dst.u.IsCreatable() || dst.room(dst.target) < size {
+					continue
+				}
+				if _, found := dst.remotes[o.Remote()]; found {
+					continue
+				}
+				candidates = append(candidates, dst)
+			}
+			dst := f.pickUpstream(ctx, candidates, o.Remote())
+			if dst == nil {
+				continue
+			}
+			moves = append(moves, balanceMove{src: o, from: src, dst: dst})
+			src.used -= size
+			dst.used += size
+			dst.remotes[o.Remote()] = o
+		}
+	}
+	fs.Infof(f, "Rebalance: %d files to move", len(moves))
+	return f.runMoves(ctx, bus, moves, bo), nil
+}
+
+// findUpstream finds the upstream called name
+func (f *Fs) findUpstream(name string) (*upstream.Fs, error) {
+	for _, tag := range []string{":ro", ":nc", ":writeback"} {
+		name = strings.TrimSuffix(name, tag)
+	}
+	for _, u := range f.upstreams {
+		if u.Remote == name || strings.TrimRight(u.Remote, "/") == strings.TrimRight(name, "/") {
+			return u, nil
+		}
+	}
+	var names []string
+	for _, u := range f.upstreams {
+		names = append(names, u.Remote)
+	}
+	return nil, fmt.Errorf("upstream %q not found - expecting one of %q", name, names)
+}
+
+// drain moves all the files off the upstream called name
+func (f *Fs) drain(ctx context.Context, name string, opt map[string]string) (*BalanceResult, error) {
+	bo, err := parseBalanceOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	u, err := f.findUpstream(name)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsWritable() {
+		return nil, fmt.Errorf("can't drain read only upstream %q", u.Remote)
+	}
+	bus, err := f.balanceUpstreams(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	var src *balanceUpstream
+	var others []*balanceUpstream
+	for _, bu := range bus {
+		if bu.u == u {
+			src = bu
+		} else if bu.u.IsCreatable() {
+			others = append(others, bu)
+		}
+	}
+	if len(others) == 0 {
+		return nil, errors.New("no other upstreams to move the files to")
+	}
+	ht := f.hashSet.GetOne()
+	var moves []balanceMove
+	for _, o := range src.objects {
+		remote := o.Remote()
+		size := o.Size()
+		var candidates []*balanceUpstream
+		copied := false
+		for _, dst := range others {
+			if existing, found := dst.remotes[remote]; found {
+				if sameReplica(ctx, o, existing, ht) {
+					copied = true
+				}
+				continue
+			}
+			if dst.total <= 0 || dst.room(dst.total) >= size {
+				candidates = append(candidates, dst)
+			}
+		}
+		if copied {
+			moves = append(moves, balanceMove{src: o, from: src})
+			src.used -= size
+			continue
+		}
+		dst := f.pickUpstream(ctx, candidates, remote)
+		if dst == nil {
+			fs.Errorf(o, "Drain: no upstream with room to move to")
+			continue
+		}
+		moves = append(moves, balanceMove{src: o, from: src, dst: dst})
+		src.used -= size
+		dst.used += size
+		dst.remotes[remote] = o
+	}
+	fs.Infof(f, "Drain %s: %d files to move", u.Remote, len(moves))
+	result := f.runMoves(ctx, bus, moves, bo)
+	if result.Errors == 0 && result.Remaining == 0 && !bo.dryRun {
+		err = operations.Rmdirs(ctx, u, "", true)
+		if err != nil {
+			fs.Errorf(u, "Drain: failed to remove empty directories: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// runMoves does the moves planned, --transfers at once
+func (f *Fs) runMoves(ctx context.Context, bus []*balanceUpstream, moves []balanceMove, bo balanceOptions) *BalanceResult {
+	ci := fs.GetConfig(ctx)
+	if bo.dryRun {
+		ctx, ci = fs.AddConfig(ctx)
+		ci.DryRun = true
+	}
+	var limiter *rate.Limiter
+	if bo.tps > 0 {
+		limiter = rate.NewLimiter(rate.Limit(bo.tps), 1)
+	}
+	var (
+		mu     sync.Mutex
+		result BalanceResult
+		wg     sync.WaitGroup
+		next   int
+	)
+	// take returns the next move to do or nil if finished
+	take := func() (m *balanceMove) {
+		mu.Lock()
+		defer mu.Unlock()
+		if next >= len(moves) || ctx.Err() != nil {
+			return nil
+		}
+		if bo.maxSize >= 0 && result.Bytes >= int64(bo.maxSize) {
+			return nil
+		}
+		m = &moves[next]
+		next++
+		if m.dst != nil {
+			result.Bytes += m.src.Size()
+		}
+		return m
+	}
+	transfers := ci.Transfers
+	if transfers < 1 {
+		transfers = 1
+	}
+	for i := 0; i < transfers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if limiter != nil && limiter.Wait(ctx) != nil {
+					return
+				}
+				m := take()
+				if m == nil {
+					return
+				}
+				var err error
+				if m.dst == nil {
+					err = operations.DeleteFile(ctx, m.src)
+				} else {
+					_, err = operations.Move(ctx, m.dst.u, nil, m.src.Remote(), m.src)
+				}
+				mu.Lock()
+				switch {
+				case err != nil:
+					fs.Errorf(m.src, "Failed to move: %v", err)
+					result.Errors++
+					if m.dst != nil {
+						result.Bytes -= m.src.Size()
+					}
+				case m.dst == nil:
+					m.done = true
+					result.Deleted++
+				default:
+					m.done = true
+					result.Moved++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	result.Remaining = int64(len(moves)) - result.Moved - result.Deleted - result.Errors
+	// Undo the planned usage of the moves which weren't done
+	for _, m := range moves {
+		if m.done {
+			continue
+		}
+		size := m.src.Size()
+		m.from.used += size
+		if m.dst != nil {
+			m.dst.used -= size
+		}
+	}
+	for _, bu := range bus {
+		result.Upstreams = append(result.Upstreams, BalanceUsage{
+			Upstream: bu.u.Remote,
+			Used:     bu.used,
+			Total:    bu.total,
+		})
+	}
+	return &result
+}
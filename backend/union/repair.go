@@ -0,0 +1,196 @@
+package union
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+// repairQueueLength is the number of files which can be waiting to
+// be repaired
+const repairQueueLength = 1024
+
+// repairer repairs files in the background
+type repairer struct {
+	f       *Fs
+	ctx     context.Context    // context for the repairs
+	cancel  context.CancelFunc // cancel the repairs
+	mu      sync.Mutex
+	queued  map[string]struct{} // files in the queue or being repaired
+	queue   chan string
+	started bool
+	wg      sync.WaitGroup
+}
+
+// newRepairer makes a repairer for f
+func newRepairer(ctx context.Context, f *Fs) *repairer {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	return &repairer{
+		f:      f,
+		ctx:    ctx,
+		cancel: cancel,
+		queued: make(map[string]struct{}),
+		queue:  make(chan string, repairQueueLength),
+	}
+}
+
+// add queues remote to be repaired
+//
+// It does nothing if r is nil so can be called when repairs are
+// turned off.
+func (r *repairer) add(remote string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, found := r.queued[remote]; found || r.ctx.Err() != nil {
+		return
+	}
+	if !r.started {
+		r.started = true
+		r.wg.Add(1)
+		go r.run()
+	}
+	select {
+	case r.queue <- remote:
+		r.queued[remote] = struct{}{}
+		fs.Debugf(r.f, "%s: queued for repair", remote)
+	default:
+		fs.Debugf(r.f, "%s: not repairing as repair queue is full", remote)
+	}
+}
+
+// run repairs the files in the queue until shutdown
+func (r *repairer) run() {
+	defer r.wg.Done()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case remote := <-r.queue:
+			err := r.f.repairFile(r.ctx, remote)
+			if err != nil && r.ctx.Err() == nil {
+				fs.Errorf(r.f, "%s: failed to repair: %v", remote, err)
+			}
+			r.mu.Lock()
+			delete(r.queued, remote)
+			r.mu.Unlock()
+		}
+	}
+}
+
+// shutdown stops the repairs, waiting for any in progress to finish
+func (r *repairer) shutdown() {
+	if r == nil {
+		return
+	}
+	r.cancel()
+	r.wg.Wait()
+}
+
+// repairFile repairs the copies or shards of remote
+func (f *Fs) repairFile(ctx context.Context, remote string) error {
+	if f.erasure != nil {
+		return f.repairShards(ctx, remote)
+	}
+	return f.repairReplicas(ctx, remote)
+}
+
+// sameReplica returns true if o is the same as src
+func sameReplica(ctx context.Context, src, o fs.Object, ht hash.Type) bool {
+	if src.Size() != o.Size() {
+		return false
+	}
+	dt := src.ModTime(ctx).Sub(o.ModTime(ctx))
+	if dt < 0 {
+		dt = -dt
+	}
+	if dt > fs.GetModifyWindow(ctx, src.Fs(), o.Fs()) {
+		return false
+	}
+	if ht != hash.None {
+		srcHash, _ := src.Hash(ctx, ht)
+		oHash, _ := o.Hash(ctx, ht)
+		if !hash.Equals(srcHash, oHash) {
+			return false
+		}
+	}
+	return true
+}
+
+// repairReplicas makes sure remote has the number of copies set by
+// the replicas option, replacing any out of date copies with the
+// newest one
+func (f *Fs) repairReplicas(ctx context.Context, remote string) error {
+	objs := make([]fs.Object, len(f.upstreams))
+	multithread(len(f.upstreams), func(i int) {
+		o, err := f.upstreams[i].NewObject(ctx, remote)
+		if err == nil {
+			objs[i] = o
+		}
+	})
+	var src fs.Object
+	for _, o := range objs {
+		if o != nil && (src == nil || o.ModTime(ctx).After(src.ModTime(ctx))) {
+			src = o
+		}
+	}
+	if src == nil {
+		return fs.ErrorObjectNotFound
+	}
+	ht := f.hashSet.GetOne()
+	var (
+		good     int
+		outdated []int
+		missing  []int
+	)
+	for i, o := range objs {
+		u := f.upstreams[i]
+		switch {
+		case o == nil:
+			if u.IsCreatable() {
+				missing = append(missing, i)
+			}
+		case sameReplica(ctx, src, o, ht):
+			good++
+		case u.IsWritable():
+			outdated = append(outdated, i)
+		}
+	}
+	var errs Errors
+	repaired := 0
+	// Replace the copies which differ from the newest
+	for _, i := range outdated {
+		u := f.upstreams[i]
+		_, err := operations.Copy(ctx, u.Fs, objs[i], remote, src)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", u.Name(), err))
+			continue
+		}
+		repaired++
+		good++
+	}
+	// Make new copies if there aren't enough
+	for _, i := range missing {
+		if good >= f.replicas {
+			break
+		}
+		u := f.upstreams[i]
+		_, err := operations.Copy(ctx, u.Fs, nil, remote, src)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", u.Name(), err))
+			continue
+		}
+		repaired++
+		good++
+	}
+	if repaired > 0 {
+		fs.Infof(src, "Repaired %d copies", repaired)
+	}
+	return errs.Err()
+}
@@ -30,6 +30,7 @@ func init() {
 		Name:        "union",
 		Description: "Union merges the contents of several upstream fs",
 		NewFs:       NewFs,
+		CommandHelp: commandHelp,
 		MetadataInfo: &fs.MetadataInfo{
 			Help: `Any metadata supported by the underlying remote is read and written.`,
 		},
@@ -61,6 +62,43 @@ If a remote has less than this much free space then it won't be
 considered for use in lfs or eplfs policies.`,
 			Advanced: true,
 			Default:  fs.Gibi,
+		}, {
+			Name: "replicas",
+			Help: `Number of copies of each file for the replicate create policy.
+
+Each new file is written to this many upstreams. If some of the
+writes fail the file is still written as long as one copy succeeds
+and the missing copies are made in the background.`,
+			Default: 2,
+		}, {
+			Name: "erasure_data_shards",
+			Help: `Number of data shards for erasure coding.
+
+If this is set above 0 then files are erasure coded using
+Reed-Solomon instead of being placed with the create policy. Each
+file is split into this many data shards plus
+erasure_parity_shards parity shards, each stored on a different
+upstream. The file can be read as long as any erasure_data_shards of
+the shards are available.
+
+The total number of shards can't be more than the number of
+upstreams.`,
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name:     "erasure_parity_shards",
+			Help:     "Number of parity shards for erasure coding.\n\nThis many shards can be lost without losing the file.",
+			Default:  1,
+			Advanced: true,
+		}, {
+			Name: "repair",
+			Help: `Repair missing or damaged copies and shards in the background.
+
+When the replicate create policy or erasure coding is in use, files
+found with missing or damaged copies or shards are queued to be
+repaired from the good ones.`,
+			Default:  true,
+			Advanced: true,
 		}},
 	}
 	fs.Register(fsi)
@@ -77,6 +115,9 @@ type Fs struct {
 	actionPolicy policy.Policy  // policy for ACTION
 	createPolicy policy.Policy  // policy for CREATE
 	searchPolicy policy.Policy  // policy for SEARCH
+	replicas     int            // number of copies wanted if replicating
+	erasure      *erasure       // erasure coding config if set
+	repair       *repairer      // background repairs if set
 }
 
 // Wrap candidate objects in to a union Object
@@ -87,6 +128,9 @@ func (f *Fs) wrapEntries(entries ...upstream.Entry) (entry, error) {
 	}
 	switch e := e.(type) {
 	case *upstream.Object:
+		if f.replicas > 0 && len(entries) < f.replicas {
+			f.repair.add(e.Remote())
+		}
 		return &Object{
 			Object: e,
 			fs:     f,
@@ -579,6 +623,20 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, stream bo
 	})
 	errs[len(upstreams)] = <-errChan
 	err = errs.Err()
+	if err != nil && f.replicas > 0 && errs[len(upstreams)] == nil {
+		// When replicating the upload succeeds if any copy was
+		// written and the missing copies are made in the background
+		var written []upstream.Entry
+		for _, o := range objs {
+			if o != nil {
+				written = append(written, o)
+			}
+		}
+		if len(written) > 0 {
+			fs.Errorf(src, "Failed to write some copies - will repair: %v", err)
+			objs, err = written, nil
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -597,6 +655,13 @@ func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options .
 	case nil:
 		return o, o.Update(ctx, in, src, options...)
 	case fs.ErrorObjectNotFound:
+		if f.erasure != nil {
+			o, err := f.ecPut(ctx, in, src, nil, options...)
+			if err != nil {
+				return nil, err
+			}
+			return o, nil
+		}
 		return f.put(ctx, in, src, false, options...)
 	default:
 		return nil, err
@@ -614,6 +679,9 @@ func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, opt
 	case nil:
 		return o, o.Update(ctx, in, src, options...)
 	case fs.ErrorObjectNotFound:
+		if f.erasure != nil {
+			return nil, errors.New("can't upload files of unknown size with erasure coding")
+		}
 		return f.put(ctx, in, src, true, options...)
 	default:
 		return nil, err
@@ -709,7 +777,7 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 		}
 		return nil, errs.Err()
 	}
-	return f.mergeDirEntries(entriesList)
+	return f.mergeDirEntries(ctx, entriesList)
 }
 
 // ListR lists the objects and directories of the Fs starting
@@ -768,7 +836,7 @@ func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (
 		}
 		return errs.Err()
 	}
-	entries, err := f.mergeDirEntries(entriesList)
+	entries, err := f.mergeDirEntries(ctx, entriesList)
 	if err != nil {
 		return err
 	}
@@ -777,6 +845,14 @@ func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (
 
 // NewObject creates a new remote union file object
 func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	if f.erasure != nil {
+		return f.ecNewObject(ctx, remote)
+	}
+	return f.newObject(ctx, remote)
+}
+
+// newObject finds the ordinary union file object at remote
+func (f *Fs) newObject(ctx context.Context, remote string) (fs.Object, error) {
 	objs := make([]*upstream.Object, len(f.upstreams))
 	errs := Errors(make([]error, len(f.upstreams)))
 	multithread(len(f.upstreams), func(i int) {
@@ -831,13 +907,20 @@ func (f *Fs) searchEntries(entries ...upstream.Entry) (upstream.Entry, error) {
 	return f.searchPolicy.SearchEntries(entries...)
 }
 
-func (f *Fs) mergeDirEntries(entriesList [][]upstream.Entry) (fs.DirEntries, error) {
+func (f *Fs) mergeDirEntries(ctx context.Context, entriesList [][]upstream.Entry) (fs.DirEntries, error) {
 	entryMap := make(map[string]([]upstream.Entry))
+	var shards []*upstream.Object
 	for _, en := range entriesList {
 		if en == nil {
 			continue
 		}
 		for _, entry := range en {
+			if o, ok := entry.(*upstream.Object); ok && f.erasure != nil {
+				if _, _, isShard := parseECShardName(o.Remote()); isShard {
+					shards = append(shards, o)
+					continue
+				}
+			}
 			remote := entry.Remote()
 			if f.Features().CaseInsensitive {
 				remote = strings.ToLower(remote)
@@ -853,12 +936,16 @@ func (f *Fs) mergeDirEntries(entriesList [][]upstream.Entry) (fs.DirEntries, err
 		}
 		entries = append(entries, e)
 	}
+	if len(shards) > 0 {
+		entries = f.mergeShards(ctx, entries, shards)
+	}
 	return entries, nil
 }
 
 // Shutdown the backend, closing any background tasks and any
 // cached connections.
 func (f *Fs) Shutdown(ctx context.Context) error {
+	f.repair.shutdown()
 	errs := Errors(make([]error, len(f.upstreams)))
 	multithread(len(f.upstreams), func(i int) {
 		u := f.upstreams[i]
@@ -894,6 +981,30 @@ func (f *Fs) CleanUp(ctx context.Context) error {
 //
 // The returned Fs is the actual Fs, referenced by remote in the config
 func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	f, err := newFs(ctx, name, root, m)
+	if f == nil {
+		return nil, err
+	}
+	if err != nil || f.erasure == nil || f.root == "" {
+		return f, err
+	}
+	// Erasure coded files are stored as shards so the upstreams
+	// can't tell if the root is a file - check in the parent
+	parent, err := newFs(ctx, name, parentDir(f.root), m)
+	if err != nil {
+		return nil, err
+	}
+	o, err := parent.NewObject(ctx, path.Base(f.root))
+	if err == nil {
+		if _, ok := o.(*ecObject); ok {
+			return parent, fs.ErrorIsFile
+		}
+	}
+	return f, nil
+}
+
+// newFs constructs an Fs from the path
+func newFs(ctx context.Context, name, root string, m configmap.Mapper) (*Fs, error) {
 	// Parse config into Options struct
 	opt := new(common.Options)
 	err := configstruct.Set(m, opt)
@@ -971,6 +1082,21 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 	if err != nil {
 		return nil, err
 	}
+	if p, ok := f.createPolicy.(*policy.Replicate); ok {
+		f.replicas = p.Replicas(f.upstreams)
+	}
+	if opt.DataShards > 0 {
+		if f.replicas > 0 {
+			return nil, errors.New("can't use the replicate create policy with erasure coding")
+		}
+		f.erasure, err = newErasure(opt, f.upstreams)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opt.Repair && (f.replicas > 0 || f.erasure != nil) {
+		f.repair = newRepairer(ctx, f)
+	}
 	fs.Debugf(f, "actionPolicy = %T, createPolicy = %T, searchPolicy = %T", f.actionPolicy, f.createPolicy, f.searchPolicy)
 	var features = (&fs.Features{
 		CaseInsensitive:          true,
@@ -1023,6 +1149,19 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 	// show that we wrap other backends
 	features.Overlay = true
 
+	// Erasure coded files are made from the shards so don't have
+	// the features of the upstream objects
+	if f.erasure != nil {
+		features.PutStream = nil
+		features.ReadMimeType = false
+		features.WriteMimeType = false
+		features.ReadMetadata = false
+		features.WriteMetadata = false
+		features.UserMetadata = false
+		features.GetTier = false
+		features.SetTier = false
+	}
+
 	f.features = features
 
 	// Get common intersection of hashes
@@ -1031,6 +1170,9 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 		hashSet = hashSet.Overlap(u.Hashes())
 	}
 	f.hashSet = hashSet
+	if f.erasure != nil {
+		f.hashSet = hash.Set(hash.None)
+	}
 
 	return f, fserr
 }
@@ -1072,4 +1214,5 @@ var (
 	_ fs.ListRer         = (*Fs)(nil)
 	_ fs.Shutdowner      = (*Fs)(nil)
 	_ fs.CleanUpper      = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
 )
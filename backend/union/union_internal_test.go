@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"runtime"
 	"testing"
 	"time"
@@ -163,3 +164,297 @@ func TestMoveCopy(t *testing.T) {
 		})
 	})
 }
+
+// This tests that a file replicated to 2 of 3 upstreams can still be
+// read with a copy missing and that the copy is repaired
+func TestReplicateRepair(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	dirs := MakeTestDirs(t, 3)
+	fsString := fmt.Sprintf(":union,upstreams='%s %s %s',create_policy=replicate,replicas=2,repair=false:", dirs[0], dirs[1], dirs[2])
+	f, err := fs.NewFs(ctx, fsString)
+	require.NoError(t, err)
+	unionFs := f.(*Fs)
+	assert.Equal(t, 2, unionFs.replicas)
+
+	contents := random.String(1000)
+	file := fstest.NewItem("dir/file.txt", contents, time.Now())
+	_ = fstests.PutTestContents(ctx, t, f, &file, contents, true)
+
+	// Find the copies
+	countCopies := func() (n int, found []fs.Object) {
+		for _, u := range unionFs.upstreams {
+			o, err := u.NewObject(ctx, file.Path)
+			if err == nil {
+				n++
+				found = append(found, o)
+			}
+		}
+		return n, found
+	}
+	n, copies := countCopies()
+	require.Equal(t, 2, n)
+
+	// Remove one and check the file can still be read
+	require.NoError(t, copies[0].Remove(ctx))
+	o, err := f.NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	assert.Equal(t, contents, fstests.ReadObject(ctx, t, o, -1))
+
+	// Repair and check the copy is back
+	require.NoError(t, unionFs.repairFile(ctx, file.Path))
+	n, _ = countCopies()
+	assert.Equal(t, 2, n)
+
+	// Make one copy out of date and check it is replaced
+	_, copies = countCopies()
+	old := fstest.NewItem(file.Path, "old", file.ModTime.Add(-time.Hour))
+	require.NoError(t, copies[1].Update(ctx, bytes.NewBufferString("old"), object.NewStaticObjectInfo(old.Path, old.ModTime, old.Size, true, nil, nil)))
+	require.NoError(t, unionFs.repairFile(ctx, file.Path))
+	for _, u := range unionFs.upstreams {
+		o, err := u.NewObject(ctx, file.Path)
+		if err == nil {
+			assert.Equal(t, contents, fstests.ReadObject(ctx, t, o, -1))
+		}
+	}
+}
+
+func TestErasureHeader(t *testing.T) {
+	h := ecHeader{dataShards: 3, parityShards: 2, index: 4, blockSize: 100, size: 1001}
+	var got ecHeader
+	require.NoError(t, got.unmarshal(h.marshal()))
+	assert.Equal(t, h, got)
+
+	buf := h.marshal()
+	buf[20] ^= 1
+	assert.Equal(t, errECBadHeader, got.unmarshal(buf))
+
+	assert.Equal(t, int64(300), h.stripeSize())
+	assert.Equal(t, int64(4), h.stripes())
+	assert.Equal(t, int64(101), h.stripeLen(3))
+	assert.Equal(t, 34, h.blockLen(3))
+	assert.Equal(t, int64(ecHeaderSize+3*(100+ecCRCSize)+34+ecCRCSize), h.shardSize())
+
+	h.size = 0
+	assert.Equal(t, int64(0), h.stripes())
+	assert.Equal(t, int64(ecHeaderSize), h.shardSize())
+
+	name := ecShardName("dir/file.txt", 4)
+	assert.Equal(t, "dir/file.txt.rclone_ec.4", name)
+	remote, index, ok := parseECShardName(name)
+	assert.True(t, ok)
+	assert.Equal(t, "dir/file.txt", remote)
+	assert.Equal(t, 4, index)
+	for _, bad := range []string{"file.txt", "file.txt.ec1", "file.txt.12.ec4", "file.txt.rclone_ec.", "file.txt.rclone_ec.256", "file.txt.rclone_ec.1000"} {
+		_, _, ok = parseECShardName(bad)
+		assert.False(t, ok, bad)
+	}
+}
+
+// This tests that erasure coded files can be read with a shard
+// missing or damaged and that the shards are repaired
+func TestErasureRepair(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	dirs := MakeTestDirs(t, 4)
+	fsString := fmt.Sprintf(":union,upstreams='%s %s %s %s',erasure_data_shards=2,erasure_parity_shards=1,repair=false:", dirs[0], dirs[1], dirs[2], dirs[3])
+	f, err := fs.NewFs(ctx, fsString)
+	require.NoError(t, err)
+	unionFs := f.(*Fs)
+
+	// A file with a few stripes and a short last one
+	contents := random.String(5*ecBlockSize + 12345)
+	file := fstest.NewItem("dir/file.bin", contents, time.Now())
+	_ = fstests.PutTestContents(ctx, t, f, &file, contents, true)
+	fstest.CheckListing(t, f, []fstest.Item{file})
+
+	getObject := func() *ecObject {
+		o, err := f.NewObject(ctx, file.Path)
+		require.NoError(t, err)
+		eo, ok := o.(*ecObject)
+		require.True(t, ok)
+		return eo
+	}
+	checkRead := func() {
+		o := getObject()
+		assert.Equal(t, contents, fstests.ReadObject(ctx, t, o, -1))
+		// Read a range crossing a stripe boundary
+		start := int64(2*ecBlockSize - 10)
+		in, err := o.Open(ctx, &fs.RangeOption{Start: start, End: start + 99})
+		require.NoError(t, err)
+		got, err := io.ReadAll(in)
+		require.NoError(t, err)
+		require.NoError(t, in.Close())
+		assert.Equal(t, contents[start:start+100], string(got))
+	}
+	o := getObject()
+	require.Equal(t, 3, o.count())
+	checkRead()
+
+	// Remove a data shard
+	require.NoError(t, o.shards[0].Remove(ctx))
+	checkRead()
+	require.NoError(t, unionFs.repairFile(ctx, file.Path))
+	o = getObject()
+	assert.Equal(t, 3, o.count())
+	checkRead()
+
+	// Damage a block in a shard
+	shard := o.shards[1]
+	in, err := shard.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	data[ecHeaderSize+ecBlockSize+ecCRCSize+10] ^= 0xFF
+	require.NoError(t, shard.Update(ctx, bytes.NewReader(data), object.NewStaticObjectInfo(shard.Remote(), shard.ModTime(ctx), int64(len(data)), true, nil, nil)))
+	checkRead()
+	require.NoError(t, unionFs.repairFile(ctx, file.Path))
+	in, err = getObject().shards[1].Open(ctx)
+	require.NoError(t, err)
+	repaired, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	data[ecHeaderSize+ecBlockSize+ecCRCSize+10] ^= 0xFF
+	assert.Equal(t, data, repaired)
+
+	// Too many shards missing
+	o = getObject()
+	require.NoError(t, o.shards[0].Remove(ctx))
+	require.NoError(t, o.shards[2].Remove(ctx))
+	_, err = getObject().Open(ctx)
+	assert.Equal(t, errECTooFewShards, err)
+}
+
+// This tests names which looked like shards are ordinary files and
+// shard names can't be uploaded
+func TestErasureNames(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	dirs := MakeTestDirs(t, 3)
+	fsString := fmt.Sprintf(":union,upstreams='%s %s %s',erasure_data_shards=2,erasure_parity_shards=1:", dirs[0], dirs[1], dirs[2])
+	f, err := fs.NewFs(ctx, fsString)
+	require.NoError(t, err)
+
+	contents := random.String(100)
+	file := fstest.NewItem("dir/backup.2024.ec1", contents, time.Now())
+	_ = fstests.PutTestContents(ctx, t, f, &file, contents, true)
+	fstest.CheckListing(t, f, []fstest.Item{file})
+	o, err := f.NewObject(ctx, file.Path)
+	require.NoError(t, err)
+	assert.Equal(t, file.Size, o.Size())
+	assert.Equal(t, contents, fstests.ReadObject(ctx, t, o, -1))
+
+	_, err = f.NewObject(ctx, ecShardName(file.Path, 0))
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	src := object.NewStaticObjectInfo(ecShardName(file.Path, 0), time.Now(), 3, true, nil, nil)
+	_, err = f.Put(ctx, bytes.NewBufferString("foo"), src)
+	assert.Equal(t, errECReservedName, err)
+}
+
+// This tests rebalancing files from a full upstream to empty ones and
+// draining an upstream
+func TestRebalanceDrain(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	ctx := context.Background()
+	dirs := MakeTestDirs(t, 3)
+	fsString := fmt.Sprintf(":union,upstreams='%s %s %s',create_policy=lus:", dirs[0], dirs[1], dirs[2])
+	f, err := fs.NewFs(ctx, fsString)
+	require.NoError(t, err)
+	unionFs := f.(*Fs)
+
+	// Put all the files on the first upstream
+	var items []fstest.Item
+	for i := 0; i < 12; i++ {
+		contents := random.String(1000)
+		item := fstest.NewItem(fmt.Sprintf("dir%d/file%d.txt", i%2, i), contents, time.Now())
+		_ = fstests.PutTestContents(ctx, t, unionFs.upstreams[0], &item, contents, true)
+		items = append(items, item)
+	}
+	fstest.CheckListing(t, f, items)
+	countFiles := func() (counts []int) {
+		for _, u := range unionFs.upstreams {
+			n := 0
+			err := operations.ListFn(ctx, u, func(fs.Object) { n++ })
+			if err != nil && err != fs.ErrorDirNotFound {
+				require.NoError(t, err)
+			}
+			counts = append(counts, n)
+		}
+		return counts
+	}
+
+	// Bad commands
+	_, err = f.Features().Command(ctx, "rebalance", nil, map[string]string{"by": "potato"})
+	assert.Error(t, err)
+	_, err = f.Features().Command(ctx, "drain", nil, nil)
+	assert.Error(t, err)
+	_, err = f.Features().Command(ctx, "drain", []string{"/not/an/upstream"}, nil)
+	assert.Error(t, err)
+
+	// Dry run
+	_, err = f.Features().Command(ctx, "rebalance", nil, map[string]string{"by": "size", "dry-run": ""})
+	require.NoError(t, err)
+	assert.Equal(t, []int{12, 0, 0}, countFiles())
+
+	// Limited size
+	out, err := f.Features().Command(ctx, "rebalance", nil, map[string]string{"by": "size", "max-size": "2000B"})
+	require.NoError(t, err)
+	result := out.(*BalanceResult)
+	assert.Equal(t, int64(2), result.Moved)
+	assert.Equal(t, int64(6), result.Remaining)
+	counts := countFiles()
+	assert.Equal(t, 10, counts[0])
+	assert.Equal(t, 2, counts[1]+counts[2])
+
+	// Resume
+	out, err = f.Features().Command(ctx, "rebalance", nil, map[string]string{"by": "size", "tps": "1000"})
+	require.NoError(t, err)
+	result = out.(*BalanceResult)
+	assert.Equal(t, int64(6), result.Moved)
+	assert.Equal(t, int64(0), result.Errors)
+	assert.Equal(t, []int{4, 4, 4}, countFiles())
+	for _, usage := range result.Upstreams {
+		assert.Equal(t, int64(4000), usage.Used)
+	}
+	fstest.CheckListing(t, f, items)
+
+	// Nothing more to do
+	out, err = f.Features().Command(ctx, "rebalance", nil, map[string]string{"by": "size"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), out.(*BalanceResult).Moved)
+
+	// Make an identical copy of a file on the first upstream
+	// on the second to check it is deleted not moved
+	var dup fs.Object
+	require.NoError(t, operations.ListFn(ctx, unionFs.upstreams[0], func(o fs.Object) {
+		if dup == nil {
+			dup = o
+		}
+	}))
+	_, err = operations.Copy(ctx, unionFs.upstreams[1], nil, dup.Remote(), dup)
+	require.NoError(t, err)
+
+	// Drain the first upstream
+	out, err = f.Features().Command(ctx, "drain", []string{dirs[0] + ":nc"}, nil)
+	require.NoError(t, err)
+	result = out.(*BalanceResult)
+	assert.Equal(t, int64(3), result.Moved)
+	assert.Equal(t, int64(1), result.Deleted)
+	assert.Equal(t, int64(0), result.Errors)
+	counts = countFiles()
+	assert.Equal(t, 0, counts[0])
+	assert.Equal(t, 12, counts[1]+counts[2])
+	fstest.CheckListing(t, f, items)
+	entries, err := unionFs.upstreams[0].List(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(entries))
+}
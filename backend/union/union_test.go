@@ -159,3 +159,50 @@ func TestPolicy3(t *testing.T) {
 		QuickTestOK:                  true,
 	})
 }
+
+func TestReplicate(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	dirs := union.MakeTestDirs(t, 3)
+	upstreams := dirs[0] + " " + dirs[1] + " " + dirs[2]
+	name := "TestUnionReplicate"
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: name + ":",
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "union"},
+			{Name: name, Key: "upstreams", Value: upstreams},
+			{Name: name, Key: "action_policy", Value: "epall"},
+			{Name: name, Key: "create_policy", Value: "replicate"},
+			{Name: name, Key: "search_policy", Value: "ff"},
+			{Name: name, Key: "replicas", Value: "2"},
+		},
+		UnimplementableFsMethods:     unimplementableFsMethods,
+		UnimplementableObjectMethods: unimplementableObjectMethods,
+		QuickTestOK:                  true,
+	})
+}
+
+func TestErasure(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	dirs := union.MakeTestDirs(t, 3)
+	upstreams := dirs[0] + " " + dirs[1] + " " + dirs[2]
+	name := "TestUnionErasure"
+	fstests.Run(t, &fstests.Opt{
+		RemoteName: name + ":",
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "union"},
+			{Name: name, Key: "upstreams", Value: upstreams},
+			{Name: name, Key: "action_policy", Value: "epall"},
+			{Name: name, Key: "create_policy", Value: "epmfs"},
+			{Name: name, Key: "search_policy", Value: "ff"},
+			{Name: name, Key: "erasure_data_shards", Value: "2"},
+			{Name: name, Key: "erasure_parity_shards", Value: "1"},
+		},
+		UnimplementableFsMethods:     unimplementableFsMethods,
+		UnimplementableObjectMethods: []string{"MimeType", "GetTier", "SetTier", "ID", "Metadata", "UnWrap"},
+		QuickTestOK:                  true,
+	})
+}
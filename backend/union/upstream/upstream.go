@@ -29,6 +29,7 @@ type Fs struct {
 	fs.Fs
 	RootFs      fs.Fs
 	RootPath    string
+	Remote      string // the upstream as configured without any tag
 	Opt         *common.Options
 	writable    bool
 	creatable   bool
@@ -94,6 +95,7 @@ func New(ctx context.Context, remote, root string, opt *common.Options) (*Fs, er
 		fsPath = fsPath[0 : len(fsPath)-len(":writeback")]
 	}
 	remote = configName + fsPath
+	f.Remote = remote
 	rFs, err := cache.Get(ctx, remote)
 	if err != nil && err != fs.ErrorIsFile {
 		return nil, err
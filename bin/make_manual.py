@@ -60,6 +60,7 @@ docs = [
     "mailru.md",
     "mega.md",
     "memory.md",
+    "mirror.md",
     "netstorage.md",
     "azureblob.md",
     "azurefiles.md",
@@ -68,6 +69,7 @@ docs = [
     "oracleobjectstorage/_index.md",
     "qingstor.md",
     "quatrix.md",
+    "readcache.md",
     "sia.md",
     "swift.md",
     "pcloud.md",
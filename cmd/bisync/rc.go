@@ -17,6 +17,29 @@ func init() {
 		Fn:           rcBisync,
 		Title:        shortHelp,
 		Help:         rcHelp,
+		Params: []rc.Param{
+			{Name: "path1", Type: rc.TypeFs, Required: true, Help: "a remote directory string e.g. drive:path1"},
+			{Name: "path2", Type: rc.TypeFs, Required: true, Help: "a remote directory string e.g. drive:path2"},
+			{Name: "dryRun", Type: rc.TypeBoolean, Help: "dry-run mode"},
+			{Name: "resync", Type: rc.TypeBoolean, Help: "performs the resync run"},
+			{Name: "checkAccess", Type: rc.TypeBoolean, Help: "abort if check files are not found on both filesystems"},
+			{Name: "checkFilename", Type: rc.TypeString, Help: "file name for checkAccess"},
+			{Name: "maxDelete", Type: rc.TypeInteger, Help: "abort sync if percentage of deleted files is above this threshold"},
+			{Name: "force", Type: rc.TypeBoolean, Help: "bypass maxDelete safety check and run the sync"},
+			{Name: "checkSync", Type: rc.TypeString, Help: `"true" by default, "false" disables comparison of final listings, "only" will only compare listings`},
+			{Name: "createEmptySrcDirs", Type: rc.TypeBoolean, Help: "sync creation and deletion of empty directories"},
+			{Name: "removeEmptyDirs", Type: rc.TypeBoolean, Help: "remove empty directories at the final cleanup step"},
+			{Name: "filtersFile", Type: rc.TypeString, Help: "read filtering patterns from a file"},
+			{Name: "ignoreListingChecksum", Type: rc.TypeBoolean, Help: "do not use checksums for listings"},
+			{Name: "resilient", Type: rc.TypeBoolean, Help: "allow future runs to retry after certain less-serious errors"},
+			{Name: "workdir", Type: rc.TypeString, Help: "server directory for history files"},
+			{Name: "backupdir1", Type: rc.TypeString, Help: "--backup-dir for Path1"},
+			{Name: "backupdir2", Type: rc.TypeString, Help: "--backup-dir for Path2"},
+			{Name: "noCleanup", Type: rc.TypeBoolean, Help: "retain working files"},
+		},
+		Result: []rc.Param{
+			{Name: "output", Type: rc.TypeString, Help: "the output of bisync"},
+		},
 	})
 }
 
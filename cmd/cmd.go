@@ -30,6 +30,7 @@ import (
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/fspath"
 	fslog "github.com/rclone/rclone/fs/log"
+	"github.com/rclone/rclone/fs/notify"
 	"github.com/rclone/rclone/fs/rc"
 	"github.com/rclone/rclone/fs/rc/rcserver"
 	fssync "github.com/rclone/rclone/fs/sync"
@@ -241,6 +242,8 @@ func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 	ctx := context.Background()
 	ci := fs.GetConfig(ctx)
 	var cmdErr error
+	startTime := time.Now()
+	sendNotification(ctx, cmd, notify.Start, startTime, nil)
 	stopStats := func() {}
 	if !showStats && ShowStats() {
 		showStats = true
@@ -336,9 +339,48 @@ func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 			fs.Logf(nil, "Failed to %s with %d errors: last error was: %v", cmd.Name(), nerrs, cmdErr)
 		}
 	}
+	sendNotification(ctx, cmd, "", startTime, cmdErr)
 	resolveExitCode(cmdErr)
 }
 
+// sendNotification sends a notification about the command to the
+// webhooks and commands configured with the --notify flags
+//
+// If event is empty then the command has finished and the event is
+// worked out from the exit code cmdErr will cause.
+func sendNotification(ctx context.Context, cmd *cobra.Command, event string, startTime time.Time, cmdErr error) {
+	if !notify.Opt.Enabled() {
+		return
+	}
+	p := &notify.Payload{
+		Event:     event,
+		Source:    "command",
+		Command:   cmd.Name(),
+		StartTime: startTime,
+	}
+	if event == "" {
+		code := exitCode(cmdErr)
+		p.Event = notify.Success
+		if code != exitcode.Success {
+			p.Event = notify.Failure
+		}
+		p.EndTime = time.Now()
+		p.Duration = p.EndTime.Sub(startTime).Seconds()
+		p.ExitCode = &code
+		if cmdErr != nil {
+			p.Error = cmdErr.Error()
+		}
+		stats, err := accounting.GlobalStats().RemoteStats()
+		if err == nil {
+			p.Stats = stats
+		}
+	}
+	err := notify.Send(ctx, &notify.Opt, p)
+	if err != nil {
+		fs.Errorf(nil, "%v", err)
+	}
+}
+
 // CheckArgs checks there are enough arguments and prints a message if not
 func CheckArgs(MinArgs, MaxArgs int, cmd *cobra.Command, args []string) {
 	if len(args) < MinArgs {
@@ -483,37 +525,42 @@ func initConfig() {
 }
 
 func resolveExitCode(err error) {
+	atexit.Run()
+	os.Exit(exitCode(err))
+}
+
+// exitCode returns the code rclone should exit with after err
+func exitCode(err error) int {
 	ctx := context.Background()
 	ci := fs.GetConfig(ctx)
-	atexit.Run()
 	if err == nil {
 		if ci.ErrorOnNoTransfer {
 			if accounting.GlobalStats().GetTransfers() == 0 {
-				os.Exit(exitcode.NoFilesTransferred)
+				return exitcode.NoFilesTransferred
 			}
 		}
-		os.Exit(exitcode.Success)
+		return exitcode.Success
 	}
 
 	switch {
 	case errors.Is(err, fs.ErrorDirNotFound):
-		os.Exit(exitcode.DirNotFound)
+		return exitcode.DirNotFound
 	case errors.Is(err, fs.ErrorObjectNotFound):
-		os.Exit(exitcode.FileNotFound)
+		return exitcode.FileNotFound
 	case errors.Is(err, accounting.ErrorMaxTransferLimitReached):
-		os.Exit(exitcode.TransferExceeded)
+		return exitcode.TransferExceeded
 	case errors.Is(err, fssync.ErrorMaxDurationReached):
-		os.Exit(exitcode.DurationExceeded)
+		return exitcode.DurationExceeded
 	case fserrors.ShouldRetry(err):
-		os.Exit(exitcode.RetryError)
+		return exitcode.RetryError
 	case fserrors.IsNoRetryError(err), fserrors.IsNoLowLevelRetryError(err):
-		os.Exit(exitcode.NoRetryError)
+		return exitcode.NoRetryError
 	case fserrors.IsFatalError(err):
-		os.Exit(exitcode.FatalError)
+		return exitcode.FatalError
 	case errors.Is(err, errorCommandNotFound), errors.Is(err, errorNotEnoughArguments), errors.Is(err, errorTooManyArguments):
-		os.Exit(exitcode.UsageError)
+		return exitcode.UsageError
 	default:
-		os.Exit(exitcode.UncategorizedError)
+		return exitcode.UncategorizedError
 	}
 }
 
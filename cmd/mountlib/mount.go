@@ -15,6 +15,8 @@ import (
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/events"
 	"github.com/rclone/rclone/lib/atexit"
 	"github.com/rclone/rclone/lib/daemonize"
 	"github.com/rclone/rclone/lib/systemd"
@@ -376,9 +378,24 @@ func (m *MountPoint) Mount() (mountDaemon *os.Process, err error) {
 		return nil, fmt.Errorf("failed to mount FUSE fs: %w", err)
 	}
 	m.MountedOn = time.Now()
+	m.publish(events.Mount)
 	return nil, nil
 }
 
+// publish an event about the mount
+func (m *MountPoint) publish(eventType string) {
+	if !events.Active() {
+		return
+	}
+	events.Publish(&events.Event{
+		Type: eventType,
+		Data: rc.Params{
+			"fs":         fs.ConfigString(m.Fs),
+			"mountPoint": m.MountPoint,
+		},
+	})
+}
+
 // Wait for mount end
 func (m *MountPoint) Wait() error {
 	// Unmount on exit
@@ -432,5 +449,9 @@ func (m *MountPoint) Wait() error {
 
 // Unmount the specified mountpoint
 func (m *MountPoint) Unmount() (err error) {
-	return m.UnmountFn()
+	err = m.UnmountFn()
+	if err == nil {
+		m.publish(events.Unmount)
+	}
+	return err
 }
@@ -50,6 +50,14 @@ func init() {
 		AuthRequired: true,
 		Fn:           mountRc,
 		Title:        "Create a new mount point",
+		Params: []rc.Param{
+			{Name: "fs", Type: rc.TypeFs, Required: true, Help: "a remote path to be mounted"},
+			{Name: "mountPoint", Type: rc.TypeString, Required: true, Help: "valid path on the local machine"},
+			{Name: "mountType", Type: rc.TypeString, Help: "the mount implementation to use: mount, cmount or mount2"},
+			{Name: "mountOpt", Type: rc.TypeObject, Help: "the mount options"},
+			{Name: "vfsOpt", Type: rc.TypeObject, Help: "the VFS options"},
+		},
+		Result: []rc.Param{},
 		Help: `rclone allows Linux, FreeBSD, macOS and Windows to mount any of
 Rclone's cloud storage systems as a file system with FUSE.
 
@@ -147,6 +155,10 @@ func init() {
 		AuthRequired: true,
 		Fn:           unMountRc,
 		Title:        "Unmount selected active mount",
+		Params: []rc.Param{
+			{Name: "mountPoint", Type: rc.TypeString, Required: true, Help: "valid path on the local machine where the mount was created"},
+		},
+		Result: []rc.Param{},
 		Help: `
 rclone allows Linux, FreeBSD, macOS and Windows to
 mount any of Rclone's cloud storage systems as a file system with
@@ -188,6 +200,10 @@ func init() {
 		AuthRequired: true,
 		Fn:           mountTypesRc,
 		Title:        "Show all possible mount types",
+		Params:       []rc.Param{},
+		Result: []rc.Param{
+			{Name: "mountTypes", Type: rc.TypeArray, Items: rc.TypeString, Help: "the mount types"},
+		},
 		Help: `This shows all possible mount types and returns them as a list.
 
 This takes no parameters and returns
@@ -224,6 +240,10 @@ func init() {
 		AuthRequired: true,
 		Fn:           listMountsRc,
 		Title:        "Show current mount points",
+		Params:       []rc.Param{},
+		Result: []rc.Param{
+			{Name: "mountPoints", Type: rc.TypeArray, Items: rc.TypeObject, Help: "the mounts with their Fs, MountPoint and MountedOn"},
+		},
 		Help: `This shows currently mounted points, which can be used for performing an unmount.
 
 This takes no parameters and returns
@@ -274,6 +294,8 @@ func init() {
 		AuthRequired: true,
 		Fn:           unmountAll,
 		Title:        "Unmount all active mounts",
+		Params:       []rc.Param{},
+		Result:       []rc.Param{},
 		Help: `
 rclone allows Linux, FreeBSD, macOS and Windows to
 mount any of Rclone's cloud storage systems as a file system with
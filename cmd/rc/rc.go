@@ -195,7 +195,10 @@ func doCall(ctx context.Context, path string, in rc.Params) (out rc.Params, err
 		if call == nil {
 			return errorf(http.StatusBadRequest, path, "loopback: method %q not found", path)
 		}
-		_, out, err := jobs.NewJob(ctx, call.Fn, in)
+		if err := call.Validate(in); err != nil {
+			return errorf(http.StatusBadRequest, path, "loopback: %w", err)
+		}
+		_, out, err := jobs.NewJob(jobs.WithCommand(ctx, path), call.Fn, in)
 		if err != nil {
 			return errorf(http.StatusInternalServerError, path, "loopback: call failed: %w", err)
 		}
@@ -7,6 +7,7 @@ import (
 	"github.com/rclone/rclone/cmd"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
 	"github.com/rclone/rclone/fs/rc/rcflags"
 	"github.com/rclone/rclone/fs/rc/rcserver"
 	libhttp "github.com/rclone/rclone/lib/http"
@@ -56,6 +57,16 @@ See the [rc documentation](/rc/) for more info on the rc flags.
 			fs.Fatal(nil, "rc server not configured")
 		}
 
+		// Keep the history of background jobs
+		if err := jobs.StartHistory(); err != nil {
+			fs.Errorf(nil, "Failed to start job history: %v", err)
+		}
+
+		// Run any jobs scheduled with job/schedule
+		if err := jobs.StartScheduler(); err != nil {
+			fs.Errorf(nil, "Failed to start job scheduler: %v", err)
+		}
+
 		// Notify stopping on exit
 		defer systemd.Notify()()
 
@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/anacrolix/dms/dlna"
 	"github.com/anacrolix/dms/upnp"
@@ -26,122 +27,151 @@ type contentDirectoryService struct {
 }
 
 func (cds *contentDirectoryService) updateIDString() string {
+	if cds.index != nil {
+		return fmt.Sprintf("%d", cds.index.updateID.Load())
+	}
 	return fmt.Sprintf("%d", uint32(os.Getpid()))
 }
 
 var mediaMimeTypeRegexp = regexp.MustCompile("^(video|audio|image)/")
 
-// Turns the given entry and DMS host into a UPnP object. A nil object is
-// returned if the entry is not of interest.
-func (cds *contentDirectoryService) cdsObjectToUpnpavObject(cdsObject object, fileInfo vfs.Node, resources vfs.Nodes, host string) (ret interface{}, err error) {
-	obj := upnpav.Object{
-		ID:         cdsObject.ID(),
-		Restricted: 1,
-		ParentID:   cdsObject.ParentID(),
-	}
-
-	if fileInfo.IsDir() {
-		defaultChildCount := 1
-		obj.Class = "object.container.storageFolder"
-		obj.Title = fileInfo.Name()
-		return upnpav.Container{
-			Object:     obj,
-			ChildCount: &defaultChildCount,
-		}, nil
-	}
-
-	if !fileInfo.Mode().IsRegular() {
-		return
-	}
-
-	// Read the mime type from the fs.Object if possible,
-	// otherwise fall back to working out what it is from the file path.
-	var mimeType string
-	if o, ok := fileInfo.DirEntry().(fs.Object); ok {
+// Returns the mime type of the node.
+//
+// Read the mime type from the fs.Object if possible, otherwise fall
+// back to working out what it is from the file path.
+func nodeMimeType(node vfs.Node) (mimeType string) {
+	if o, ok := node.DirEntry().(fs.Object); ok {
 		mimeType = fs.MimeType(context.TODO(), o)
 		// If backend doesn't know what the mime type is then
 		// try getting it from the file name
 		if mimeType == "application/octet-stream" {
-			mimeType = fs.MimeTypeFromName(fileInfo.Name())
+			mimeType = fs.MimeTypeFromName(node.Name())
 		}
 	} else {
-		mimeType = fs.MimeTypeFromName(fileInfo.Name())
+		mimeType = fs.MimeTypeFromName(node.Name())
 	}
+	return mimeType
+}
 
-	mediaType := mediaMimeTypeRegexp.FindStringSubmatch(mimeType)
+// Makes the index entry for the node at nodePath with the resources
+// associated with it. A nil entry is returned if the node is not of
+// interest.
+func newIndexEntry(nodePath string, node vfs.Node, resources vfs.Nodes) *indexEntry {
+	e := &indexEntry{
+		Path:    nodePath,
+		Name:    node.Name(),
+		ModTime: node.ModTime(),
+	}
+	if node.IsDir() {
+		e.IsDir = true
+		e.Class = "object.container.storageFolder"
+		e.Children = 1
+		return e
+	}
+	if !node.Mode().IsRegular() {
+		return nil
+	}
+	e.MimeType = nodeMimeType(node)
+	mediaType := mediaMimeTypeRegexp.FindStringSubmatch(e.MimeType)
 	if mediaType == nil {
-		return
+		return nil
+	}
+	e.Class = "object.item." + mediaType[1] + "Item"
+	e.Size = node.Size()
+	e.Fp = fmt.Sprintf("%d,%d", e.Size, e.ModTime.UnixNano())
+	for _, resource := range resources {
+		e.Resources = append(e.Resources, indexResource{
+			Path:     path.Join("/", resource.Path()),
+			MimeType: nodeMimeType(resource),
+		})
 	}
+	return e
+}
+
+// Returns the URL on host to fetch the resource at resourcePath.
+func resourceURL(host, resourcePath string) string {
+	return (&url.URL{
+		Scheme: "http",
+		Host:   host,
+		Path:   path.Join(resPath, resourcePath),
+	}).String()
+}
+
+// Formats d as a DIDL-Lite duration H+:MM:SS.F+
+func formatDuration(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
 
-	obj.Class = "object.item." + mediaType[1] + "Item"
-	obj.Title = fileInfo.Name()
-	obj.Date = upnpav.Timestamp{Time: fileInfo.ModTime()}
+// Turns the entry and DMS host into a UPnP object.
+func (e *indexEntry) upnpavObject(host string) interface{} {
+	o := object{e.Path}
+	obj := upnpav.Object{
+		ID:         o.ID(),
+		Restricted: 1,
+		ParentID:   o.ParentID(),
+		Class:      e.Class,
+		Title:      e.Name,
+	}
+
+	if e.IsDir {
+		childCount := e.Children
+		return upnpav.Container{
+			Object:     obj,
+			ChildCount: &childCount,
+		}
+	}
+
+	obj.Date = upnpav.Timestamp{Time: e.ModTime}
+	if e.Cover != "" {
+		obj.AlbumArtURI = resourceURL(host, e.Cover)
+	}
 
 	item := upnpav.Item{
 		Object: obj,
-		Res:    make([]upnpav.Resource, 0, 1),
+		Res:    make([]upnpav.Resource, 0, 1+len(e.Resources)),
 	}
 
-	item.Res = append(item.Res, upnpav.Resource{
-		URL: (&url.URL{
-			Scheme: "http",
-			Host:   host,
-			Path:   path.Join(resPath, cdsObject.Path),
-		}).String(),
-		ProtocolInfo: fmt.Sprintf("http-get:*:%s:%s", mimeType, dlna.ContentFeatures{
+	res := upnpav.Resource{
+		URL: resourceURL(host, e.Path),
+		ProtocolInfo: fmt.Sprintf("http-get:*:%s:%s", e.MimeType, dlna.ContentFeatures{
 			SupportRange: true,
 		}.String()),
-		Size: uint64(fileInfo.Size()),
-	})
-
-	for _, resource := range resources {
-		subtitleURL := (&url.URL{
-			Scheme: "http",
-			Host:   host,
-			Path:   path.Join(resPath, resource.Path()),
-		}).String()
-
-		// Read the mime type from the fs.Object if possible,
-		// otherwise fall back to working out what it is from the file path.
-		var mimeType string
-		if o, ok := resource.DirEntry().(fs.Object); ok {
-			mimeType = fs.MimeType(context.TODO(), o)
-			// If backend doesn't know what the mime type is then
-			// try getting it from the file name
-			if mimeType == "application/octet-stream" {
-				mimeType = fs.MimeTypeFromName(resource.Name())
-			}
-		} else {
-			mimeType = fs.MimeTypeFromName(resource.Name())
-		}
+		Size: uint64(e.Size),
+	}
+	if e.Info.Duration > 0 {
+		res.Duration = formatDuration(e.Info.Duration)
+	}
+	if e.Info.Width > 0 && e.Info.Height > 0 {
+		res.Resolution = fmt.Sprintf("%dx%d", e.Info.Width, e.Info.Height)
+	}
+	item.Res = append(item.Res, res)
 
+	for _, resource := range e.Resources {
 		item.Res = append(item.Res, upnpav.Resource{
-			URL:          subtitleURL,
-			ProtocolInfo: fmt.Sprintf("http-get:*:%s:*", mimeType),
+			URL:          resourceURL(host, resource.Path),
+			ProtocolInfo: fmt.Sprintf("http-get:*:%s:*", resource.MimeType),
 		})
 	}
 
-	ret = item
-	return
+	return item
 }
 
-// Returns all the upnpav objects in a directory.
-func (cds *contentDirectoryService) readContainer(o object, host string) (ret []interface{}, err error) {
-	node, err := cds.vfs.Stat(o.Path)
-	if err != nil {
-		return
-	}
-
-	if !node.IsDir() {
-		err = errors.New("not a directory")
-		return
+// Turns the given entry and DMS host into a UPnP object. A nil object is
+// returned if the entry is not of interest.
+func (cds *contentDirectoryService) cdsObjectToUpnpavObject(cdsObject object, fileInfo vfs.Node, resources vfs.Nodes, host string) (ret interface{}, err error) {
+	e := newIndexEntry(cdsObject.Path, fileInfo, resources)
+	if e == nil {
+		return nil, nil
 	}
+	return e.upnpavObject(host), nil
+}
 
-	dir := node.(*vfs.Dir)
+// Lists the media in a directory and their associated resources.
+func listMedia(dir *vfs.Dir) (vfs.Nodes, map[vfs.Node]vfs.Nodes, error) {
 	dirEntries, err := dir.ReadDirAll()
 	if err != nil {
-		err = errors.New("failed to list directory")
-		return
+		return nil, nil, errors.New("failed to list directory")
 	}
 
 	// if there's a "Subs" child directory, add its children to the list as well,
@@ -151,28 +181,54 @@ func (cds *contentDirectoryService) readContainer(o object, host string) (ret []
 			subtitleDir := node.(*vfs.Dir)
 			subtitleEntries, err := subtitleDir.ReadDirAll()
 			if err != nil {
-				err = errors.New("failed to list subtitle directory")
-				return nil, err
+				return nil, nil, errors.New("failed to list subtitle directory")
 			}
 			dirEntries = append(dirEntries, subtitleEntries...)
 		}
 	}
 
 	dirEntries, mediaResources := mediaWithResources(dirEntries)
+	return dirEntries, mediaResources, nil
+}
+
+// Returns the entries for all the media in a directory, from the
+// index if it is ready.
+func (cds *contentDirectoryService) readContainer(o object) (ret []*indexEntry, err error) {
+	if cds.index != nil && cds.index.ready.Load() {
+		if e := cds.index.get(o.Path); o.IsRoot() || (e != nil && e.IsDir) {
+			return cds.index.children(o.Path)
+		}
+	}
+
+	node, err := cds.vfs.Stat(o.Path)
+	if err != nil {
+		return
+	}
+
+	if !node.IsDir() {
+		err = errors.New("not a directory")
+		return
+	}
+
+	dirEntries, mediaResources, err := listMedia(node.(*vfs.Dir))
+	if err != nil {
+		return nil, err
+	}
+
+	covers := findCovers(dirEntries)
 	for _, de := range dirEntries {
 		child := object{
 			path.Join(o.Path, de.Name()),
 		}
-		obj, err := cds.cdsObjectToUpnpavObject(child, de, mediaResources[de], host)
-		if err != nil {
-			fs.Errorf(cds, "error with %s: %s", child.FilePath(), err)
-			continue
-		}
-		if obj == nil {
+		e := newIndexEntry(child.Path, de, mediaResources[de])
+		if e == nil {
 			fs.Debugf(cds, "unrecognized file type: %s", de)
 			continue
 		}
-		ret = append(ret, obj)
+		if !e.IsDir {
+			e.Cover = covers.lookup(e)
+		}
+		ret = append(ret, e)
 	}
 
 	return
@@ -234,6 +290,57 @@ type browse struct {
 	Filter         string
 	StartingIndex  int
 	RequestedCount int
+	SortCriteria   string
+}
+
+type search struct {
+	ContainerID    string
+	SearchCriteria string
+	Filter         string
+	StartingIndex  int
+	RequestedCount int
+	SortCriteria   string
+}
+
+// Sorts the entries and returns the requested page of them as a
+// Browse or Search response.
+func (cds *contentDirectoryService) entriesResponse(entries []*indexEntry, sortCriteria string, startingIndex, requestedCount int, host string) (map[string]string, error) {
+	if err := sortEntries(entries, sortCriteria); err != nil {
+		return nil, upnp.Errorf(invalidSortCriteriaErrorCode, "%s", err.Error())
+	}
+	totalMatches := len(entries)
+	if startingIndex > len(entries) {
+		startingIndex = len(entries)
+	}
+	if startingIndex > 0 {
+		entries = entries[startingIndex:]
+	}
+	if requestedCount != 0 && requestedCount < len(entries) {
+		entries = entries[:requestedCount]
+	}
+	objs := make([]interface{}, 0, len(entries))
+	for _, e := range entries {
+		objs = append(objs, e.upnpavObject(host))
+	}
+	result, err := xml.Marshal(objs)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"TotalMatches":   fmt.Sprint(totalMatches),
+		"NumberReturned": fmt.Sprint(len(objs)),
+		"Result":         didlLite(string(result)),
+		"UpdateID":       cds.updateIDString(),
+	}, nil
+}
+
+// Returns the index entry for the object or nil if there is no index
+// or it isn't in it.
+func (cds *contentDirectoryService) indexEntry(o object) *indexEntry {
+	if cds.index == nil || !cds.index.ready.Load() || o.IsRoot() {
+		return nil
+	}
+	return cds.index.get(o.Path)
 }
 
 // ContentDirectory object from ObjectID.
@@ -263,7 +370,7 @@ func (cds *contentDirectoryService) Handle(action string, argsXML []byte, r *htt
 		}, nil
 	case "GetSortCapabilities":
 		return map[string]string{
-			"SortCaps": "dc:title",
+			"SortCaps": sortCaps,
 		}, nil
 	case "Browse":
 		var browse browse
@@ -276,40 +383,25 @@ func (cds *contentDirectoryService) Handle(action string, argsXML []byte, r *htt
 		}
 		switch browse.BrowseFlag {
 		case "BrowseDirectChildren":
-			objs, err := cds.readContainer(obj, host)
+			entries, err := cds.readContainer(obj)
 			if err != nil {
 				return nil, upnp.Errorf(upnpav.NoSuchObjectErrorCode, "%s", err.Error())
 			}
-			totalMatches := len(objs)
-			objs = objs[func() (low int) {
-				low = browse.StartingIndex
-				if low > len(objs) {
-					low = len(objs)
-				}
-				return
-			}():]
-			if browse.RequestedCount != 0 && browse.RequestedCount < len(objs) {
-				objs = objs[:browse.RequestedCount]
-			}
-			result, err := xml.Marshal(objs)
-			if err != nil {
-				return nil, err
-			}
-			return map[string]string{
-				"TotalMatches":   fmt.Sprint(totalMatches),
-				"NumberReturned": fmt.Sprint(len(objs)),
-				"Result":         didlLite(string(result)),
-				"UpdateID":       cds.updateIDString(),
-			}, nil
+			return cds.entriesResponse(entries, browse.SortCriteria, browse.StartingIndex, browse.RequestedCount, host)
 		case "BrowseMetadata":
-			node, err := cds.vfs.Stat(obj.Path)
-			if err != nil {
-				return nil, err
-			}
-			// TODO: External subtitles won't appear in the metadata here, but probably should.
-			upnpObject, err := cds.cdsObjectToUpnpavObject(obj, node, vfs.Nodes{}, host)
-			if err != nil {
-				return nil, err
+			var upnpObject interface{}
+			if e := cds.indexEntry(obj); e != nil {
+				upnpObject = e.upnpavObject(host)
+			} else {
+				node, err := cds.vfs.Stat(obj.Path)
+				if err != nil {
+					return nil, err
+				}
+				// TODO: External subtitles won't appear in the metadata here, but probably should.
+				upnpObject, err = cds.cdsObjectToUpnpavObject(obj, node, vfs.Nodes{}, host)
+				if err != nil {
+					return nil, err
+				}
 			}
 			result, err := xml.Marshal(upnpObject)
 			if err != nil {
@@ -325,9 +417,34 @@ func (cds *contentDirectoryService) Handle(action string, argsXML []byte, r *htt
 			return nil, upnp.Errorf(upnp.ArgumentValueInvalidErrorCode, "unhandled browse flag: %v", browse.BrowseFlag)
 		}
 	case "GetSearchCapabilities":
+		caps := ""
+		if cds.index != nil {
+			caps = searchCaps
+		}
 		return map[string]string{
-			"SearchCaps": "",
+			"SearchCaps": caps,
 		}, nil
+	case "Search":
+		if cds.index == nil {
+			return nil, upnp.InvalidActionError
+		}
+		var search search
+		if err := xml.Unmarshal(argsXML, &search); err != nil {
+			return nil, err
+		}
+		obj, err := cds.objectFromID(search.ContainerID)
+		if err != nil {
+			return nil, upnp.Errorf(upnpav.NoSuchObjectErrorCode, "%s", err.Error())
+		}
+		match, err := parseSearchCriteria(search.SearchCriteria)
+		if err != nil {
+			return nil, upnp.Errorf(invalidSearchCriteriaErrorCode, "%s", err.Error())
+		}
+		entries, err := cds.index.search(obj.Path, match)
+		if err != nil {
+			return nil, err
+		}
+		return cds.entriesResponse(entries, search.SortCriteria, search.StartingIndex, search.RequestedCount, host)
 	// Samsung Extensions
 	case "X_GetFeatureList":
 		return map[string]string{
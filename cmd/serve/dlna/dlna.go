@@ -3,7 +3,9 @@ package dlna
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -21,7 +23,11 @@ import (
 	"github.com/rclone/rclone/cmd"
 	"github.com/rclone/rclone/cmd/serve/dlna/data"
 	"github.com/rclone/rclone/cmd/serve/dlna/dlnaflags"
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/cmd/serve/servelib"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/rclone/rclone/lib/systemd"
 	"github.com/rclone/rclone/vfs"
 	"github.com/rclone/rclone/vfs/vfscommon"
@@ -32,6 +38,47 @@ import (
 func init() {
 	dlnaflags.AddFlags(Command.Flags())
 	vfsflags.AddFlags(Command.Flags())
+	servelib.Register("dlna", func(ctx context.Context, f fs.Fs, in configmap.Getter, vfsOpt *vfscommon.Options, p *proxy.Proxy) (servelib.Handle, error) {
+		if p != nil {
+			return nil, errors.New("auth proxy not supported by dlna")
+		}
+		opt := dlnaflags.Opt
+		err := configstruct.Set(in, &opt)
+		if err != nil {
+			return nil, err
+		}
+		s, err := newServer(f, &opt, vfsOpt)
+		if err != nil {
+			return nil, err
+		}
+		err = s.Serve()
+		if err != nil {
+			return nil, err
+		}
+		return handle{s}, nil
+	}, dlnaflags.OptionsInfo)
+}
+
+// handle adapts a listening server to servelib.Handle
+type handle struct {
+	*server
+}
+
+// Addr returns the address the server is serving on
+func (h handle) Addr() string {
+	return h.HTTPConn.Addr().String()
+}
+
+// Serve blocks until the server is shut down
+func (h handle) Serve() error {
+	h.Wait()
+	return nil
+}
+
+// Shutdown stops the server
+func (h handle) Shutdown() error {
+	h.Close()
+	return nil
 }
 
 // Command definition for cobra.
@@ -63,7 +110,7 @@ directory as the video, or in a "Subs" subdirectory.
 		f := cmd.NewFsSrc(args)
 
 		cmd.Run(false, false, command, func() error {
-			s, err := newServer(f, &dlnaflags.Opt)
+			s, err := newServer(f, &dlnaflags.Opt, &vfscommon.Opt)
 			if err != nil {
 				return err
 			}
@@ -104,11 +151,12 @@ type server struct {
 	// Time interval between SSPD announces
 	AnnounceInterval time.Duration
 
-	f   fs.Fs
-	vfs *vfs.VFS
+	f     fs.Fs
+	vfs   *vfs.VFS
+	index *mediaIndex // nil unless --index is set
 }
 
-func newServer(f fs.Fs, opt *dlnaflags.Options) (*server, error) {
+func newServer(f fs.Fs, opt *dlnaflags.Options, vfsOpt *vfscommon.Options) (*server, error) {
 	friendlyName := opt.FriendlyName
 	if friendlyName == "" {
 		friendlyName = makeDefaultFriendlyName()
@@ -137,7 +185,15 @@ func newServer(f fs.Fs, opt *dlnaflags.Options) (*server, error) {
 		waitChan:         make(chan struct{}),
 		httpListenAddr:   opt.ListenAddr,
 		f:                f,
-		vfs:              vfs.New(f, &vfscommon.Opt),
+		vfs:              vfs.New(f, vfsOpt),
+	}
+
+	if opt.Index {
+		var err error
+		s.index, err = newMediaIndex(s.vfs, time.Duration(opt.IndexRefresh))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	s.services = map[string]UPnPService{
@@ -306,6 +362,10 @@ func (s *server) Serve() (err error) {
 		}
 	}
 
+	if s.index != nil {
+		s.index.start()
+	}
+
 	go func() {
 		s.startSSDP()
 	}()
@@ -333,6 +393,9 @@ func (s *server) Close() {
 		fs.Errorf(s.f, "Error closing HTTP server: %v", err)
 		return
 	}
+	if s.index != nil {
+		s.index.stop()
+	}
 	close(s.waitChan)
 }
 
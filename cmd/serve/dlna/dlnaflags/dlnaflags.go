@@ -22,6 +22,27 @@ default "rclone (hostname)".
 Use ` + "`--log-trace` in conjunction with `-vv`" + ` to enable additional debug
 logging of all UPNP traffic.
 
+### Media index
+
+By default each browse request lists the directory in the remote
+which can be slow for large libraries. Use ` + "`--index`" + ` to build a
+database of the media in the background, stored in the rclone cache
+directory, and serve browse and search requests from it.
+
+The indexer reads the headers of MP4, MOV and Matroska files to find
+their duration, resolution and embedded subtitle languages. Nothing is
+transcoded. Images next to the media called ` + "`cover`, `folder`, `poster`" + `
+or ` + "`front`" + ` with a ` + "`.jpg`" + ` or ` + "`.png`" + ` extension, or with the same name
+as a media file, are sent as its cover art.
+
+The index is updated when the remote reports changes if it supports
+polling for changes, see ` + "`--poll-interval`" + `, and rebuilt every
+` + "`--index-refresh`" + `. Files which haven't changed size or modification
+time aren't read again.
+
+Clients may search the index by ` + "`dc:title`, `upnp:class`" + ` and
+` + "`dc:date`" + ` and sort by ` + "`dc:title`" + ` and ` + "`dc:date`" + `.
+
 `
 
 // OptionsInfo descripts the Options in use
@@ -45,6 +66,14 @@ var OptionsInfo = fs.Options{{
 	Name:    "announce_interval",
 	Default: fs.Duration(12 * time.Minute),
 	Help:    "The interval between SSDP announcements",
+}, {
+	Name:    "index",
+	Default: false,
+	Help:    "Index the media in the background and serve browse and search from the index",
+}, {
+	Name:    "index_refresh",
+	Default: fs.Duration(time.Hour),
+	Help:    "The interval between full rescans of the index, 0 to disable",
 }}
 
 func init() {
@@ -58,6 +87,8 @@ type Options struct {
 	LogTrace         bool        `config:"log_trace"`
 	InterfaceNames   []string    `config:"interface"`
 	AnnounceInterval fs.Duration `config:"announce_interval"`
+	Index            bool        `config:"index"`
+	IndexRefresh     fs.Duration `config:"index_refresh"`
 }
 
 // Opt contains the options for DLNA serving.
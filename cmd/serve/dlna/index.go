@@ -0,0 +1,539 @@
+package dlna
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/kv"
+	"github.com/rclone/rclone/vfs"
+)
+
+// How long to wait for more changes before updating the index
+const indexChangeDelay = 2 * time.Second
+
+// mediaIndex keeps a database of the media in the VFS which is
+// updated in the background.
+//
+// Records are keyed by the path of their directory, a NUL and their
+// name so that the children of a directory sort together.
+type mediaIndex struct {
+	vfs      *vfs.VFS
+	db       *kv.DB
+	refresh  time.Duration
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	ready    atomic.Bool   // set when the first full scan is done
+	updateID atomic.Uint32 // bumped every time the index changes
+	unNotify func()
+
+	mu      sync.Mutex // protects the following
+	pending map[string]bool
+	kick    chan struct{}
+}
+
+// newMediaIndex opens the database for the index of VFS
+func newMediaIndex(VFS *vfs.VFS, refresh time.Duration) (*mediaIndex, error) {
+	if !kv.Supported() {
+		return nil, fmt.Errorf("media index: %w", kv.ErrUnsupported)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	db, err := kv.Start(ctx, "dlna", VFS.Fs())
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to open media index: %w", err)
+	}
+	idx := &mediaIndex{
+		vfs:     VFS,
+		db:      db,
+		refresh: refresh,
+		ctx:     ctx,
+		cancel:  cancel,
+		pending: make(map[string]bool),
+		kick:    make(chan struct{}, 1),
+	}
+	idx.updateID.Store(uint32(os.Getpid()))
+	return idx, nil
+}
+
+// String returns a description of the index for logging
+func (idx *mediaIndex) String() string {
+	return "DLNA media index"
+}
+
+// start the background indexer
+func (idx *mediaIndex) start() {
+	idx.unNotify = idx.vfs.AddChangeNotify(idx.changeNotify)
+	if idx.unNotify == nil {
+		fs.Infof(idx, "remote can't report changes so updating only every --index-refresh")
+	}
+	idx.wg.Add(1)
+	go idx.run()
+}
+
+// stop the background indexer and close the database
+func (idx *mediaIndex) stop() {
+	if idx.unNotify != nil {
+		idx.unNotify()
+	}
+	idx.cancel()
+	idx.wg.Wait()
+	if err := idx.db.Stop(false); err != nil {
+		fs.Errorf(idx, "failed to close: %v", err)
+	}
+}
+
+// run scans the VFS then keeps the index up to date until stopped
+func (idx *mediaIndex) run() {
+	defer idx.wg.Done()
+	idx.scanAll()
+	var tick <-chan time.Time
+	if idx.refresh > 0 {
+		ticker := time.NewTicker(idx.refresh)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-idx.ctx.Done():
+			return
+		case <-tick:
+			idx.scanAll()
+		case <-idx.kick:
+			// Wait for the changes to settle
+			select {
+			case <-idx.ctx.Done():
+				return
+			case <-time.After(indexChangeDelay):
+			}
+			idx.scanPending()
+		}
+	}
+}
+
+// scanAll indexes the whole VFS
+func (idx *mediaIndex) scanAll() {
+	start := time.Now()
+	n, err := idx.scanDir("/", true)
+	if err != nil {
+		if idx.ctx.Err() == nil {
+			fs.Errorf(idx, "scan failed: %v", err)
+		}
+		return
+	}
+	idx.ready.Store(true)
+	fs.Infof(idx, "indexed %d items in the root in %v", n, time.Since(start).Round(time.Millisecond))
+}
+
+// changeNotify queues the directory containing the change for
+// rescanning
+func (idx *mediaIndex) changeNotify(relativePath string, entryType fs.EntryType) {
+	dirPath := path.Join("/", relativePath)
+	idx.mu.Lock()
+	idx.pending[path.Dir(dirPath)] = false
+	if entryType == fs.EntryDirectory {
+		idx.pending[dirPath] = true
+	}
+	idx.mu.Unlock()
+	select {
+	case idx.kick <- struct{}{}:
+	default:
+	}
+}
+
+// scanPending rescans the directories queued by changeNotify. Changed
+// directories are scanned recursively, their parents only need their
+// listing refreshed.
+func (idx *mediaIndex) scanPending() {
+	idx.mu.Lock()
+	pending := idx.pending
+	idx.pending = make(map[string]bool)
+	idx.mu.Unlock()
+	for dirPath, recursive := range pending {
+		if idx.ctx.Err() != nil {
+			return
+		}
+		fs.Debugf(idx, "rescanning %q", dirPath)
+		if _, err := idx.scanDir(dirPath, recursive); err != nil {
+			fs.Errorf(idx, "failed to rescan %q: %v", dirPath, err)
+		}
+	}
+}
+
+// scanDir lists dirPath, probing any new or changed media, and
+// replaces its children in the index returning how many there are.
+func (idx *mediaIndex) scanDir(dirPath string, recursive bool) (n int, err error) {
+	if err := idx.ctx.Err(); err != nil {
+		return 0, err
+	}
+	node, err := idx.vfs.Stat(dirPath)
+	if errors.Is(err, vfs.ENOENT) || (err == nil && !node.IsDir()) {
+		// The directory has gone so remove it from the index
+		return 0, idx.db.Do(true, &indexPutDir{dir: dirPath})
+	} else if err != nil {
+		return 0, err
+	}
+	nodes, mediaResources, err := listMedia(node.(*vfs.Dir))
+	if err != nil {
+		return 0, err
+	}
+
+	old := map[string]*indexEntry{}
+	if children, err := idx.children(dirPath); err == nil {
+		for _, e := range children {
+			old[e.Name] = e
+		}
+	}
+
+	covers := findCovers(nodes)
+	entries := make([]*indexEntry, 0, len(nodes))
+	for _, node := range nodes {
+		e := newIndexEntry(path.Join(dirPath, node.Name()), node, mediaResources[node])
+		if e == nil {
+			continue
+		}
+		prev := old[e.Name]
+		switch {
+		case e.IsDir && recursive:
+			e.Children, err = idx.scanDir(e.Path, true)
+			if err != nil {
+				return 0, err
+			}
+		case e.IsDir:
+			if prev != nil && prev.IsDir {
+				e.Children = prev.Children
+			}
+		default:
+			e.Cover = covers.lookup(e)
+			if prev != nil && prev.Fp == e.Fp && prev.Probed {
+				e.setMediaInfo(&prev.Info)
+			} else {
+				idx.probe(node, e)
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	op := &indexPutDir{dir: dirPath, entries: entries}
+	if err := idx.db.Do(true, op); err != nil {
+		return 0, err
+	}
+	if op.changed {
+		idx.updateID.Add(1)
+	}
+	return len(entries), nil
+}
+
+// probe reads the media info for e from the headers of node
+func (idx *mediaIndex) probe(node vfs.Node, e *indexEntry) {
+	if !strings.HasPrefix(e.Class, "object.item.videoItem") && !strings.HasPrefix(e.Class, "object.item.audioItem") {
+		return
+	}
+	e.Probed = true
+	file, ok := node.(*vfs.File)
+	if !ok {
+		return
+	}
+	in, err := file.Open(os.O_RDONLY)
+	if err != nil {
+		fs.Debugf(e.Path, "failed to open for probing: %v", err)
+		return
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	info, err := probeMedia(in, node.Size())
+	if err != nil {
+		if err != errProbeUnknown {
+			fs.Debugf(e.Path, "failed to probe: %v", err)
+		}
+		return
+	}
+	e.setMediaInfo(info)
+}
+
+// children returns the entries in dirPath in name order
+func (idx *mediaIndex) children(dirPath string) ([]*indexEntry, error) {
+	op := &indexChildren{dir: dirPath}
+	if err := idx.db.Do(false, op); err != nil {
+		return nil, err
+	}
+	return op.entries, nil
+}
+
+// get returns the entry for filePath or nil if not found
+func (idx *mediaIndex) get(filePath string) *indexEntry {
+	op := &indexGet{key: indexKey(path.Dir(filePath), path.Base(filePath))}
+	if err := idx.db.Do(false, op); err != nil {
+		return nil
+	}
+	return op.entry
+}
+
+// search returns the entries under dirPath for which match is true
+func (idx *mediaIndex) search(dirPath string, match func(*indexEntry) bool) ([]*indexEntry, error) {
+	op := &indexSearch{dir: dirPath, match: match}
+	if err := idx.db.Do(false, op); err != nil {
+		return nil, err
+	}
+	return op.entries, nil
+}
+
+// indexKey returns the database key for name in dir
+func indexKey(dir, name string) string {
+	return dir + "\x00" + name
+}
+
+// subtreePrefixes returns the key prefixes of everything under dir
+func subtreePrefixes(dir string) []string {
+	if dir == "/" {
+		return []string{"/"}
+	}
+	return []string{dir + "\x00", dir + "/"}
+}
+
+// forEachPrefix calls fn for each record in b whose key starts with
+// prefix
+func forEachPrefix(b kv.Bucket, prefix string, fn func(key string, data []byte) error) error {
+	cur := b.Cursor()
+	for bkey, data := cur.Seek([]byte(prefix)); bkey != nil; bkey, data = cur.Next() {
+		key := string(bkey)
+		if !strings.HasPrefix(key, prefix) {
+			break
+		}
+		if err := fn(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexChildren: read the children of a directory
+type indexChildren struct {
+	dir     string
+	entries []*indexEntry
+}
+
+func (op *indexChildren) Do(ctx context.Context, b kv.Bucket) error {
+	return forEachPrefix(b, indexKey(op.dir, ""), func(key string, data []byte) error {
+		e := new(indexEntry)
+		if err := e.decode(key, data); err != nil {
+			return nil
+		}
+		op.entries = append(op.entries, e)
+		return nil
+	})
+}
+
+// indexGet: read a single entry
+type indexGet struct {
+	key   string
+	entry *indexEntry
+}
+
+func (op *indexGet) Do(ctx context.Context, b kv.Bucket) error {
+	data := b.Get([]byte(op.key))
+	if data == nil {
+		return nil
+	}
+	e := new(indexEntry)
+	if err := e.decode(op.key, data); err != nil {
+		return err
+	}
+	op.entry = e
+	return nil
+}
+
+// indexSearch: find the matching entries in a subtree
+type indexSearch struct {
+	dir     string
+	match   func(*indexEntry) bool
+	entries []*indexEntry
+}
+
+func (op *indexSearch) Do(ctx context.Context, b kv.Bucket) error {
+	for _, prefix := range subtreePrefixes(op.dir) {
+		err := forEachPrefix(b, prefix, func(key string, data []byte) error {
+			e := new(indexEntry)
+			if err := e.decode(key, data); err != nil {
+				return nil
+			}
+			if op.match(e) {
+				op.entries = append(op.entries, e)
+			}
+			return ctx.Err()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexPutDir: replace the children of a directory, removing the
+// subtrees of directories which have gone
+type indexPutDir struct {
+	dir     string
+	entries []*indexEntry
+	changed bool
+}
+
+func (op *indexPutDir) Do(ctx context.Context, b kv.Bucket) error {
+	keep := make(map[string][]byte, len(op.entries))
+	for _, e := range op.entries {
+		key := indexKey(op.dir, e.Name)
+		data, err := e.encode(key)
+		if err != nil {
+			return err
+		}
+		keep[key] = data
+	}
+	var remove []string
+	err := forEachPrefix(b, indexKey(op.dir, ""), func(key string, data []byte) error {
+		if _, found := keep[key]; !found {
+			remove = append(remove, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range remove {
+		// Remove the subtree too in case it was a directory
+		dirPath := path.Join(op.dir, key[len(op.dir)+1:])
+		for _, prefix := range subtreePrefixes(dirPath) {
+			err = forEachPrefix(b, prefix, func(key string, data []byte) error {
+				remove = append(remove, key)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range remove {
+		if err := b.Delete([]byte(key)); err != nil {
+			return err
+		}
+		op.changed = true
+	}
+	for key, data := range keep {
+		if bytes.Equal(b.Get([]byte(key)), data) {
+			continue
+		}
+		if err := b.Put([]byte(key), data); err != nil {
+			return err
+		}
+		op.changed = true
+	}
+	return nil
+}
+
+// indexResource is a file served alongside a media item, e.g. an
+// external subtitle
+type indexResource struct {
+	Path     string
+	MimeType string
+}
+
+// indexEntry is the record for a directory or media item
+type indexEntry struct {
+	Path      string // absolute path in the VFS
+	Name      string
+	IsDir     bool
+	Class     string // UPnP class
+	MimeType  string
+	Size      int64
+	ModTime   time.Time
+	Fp        string // fingerprint of the file when it was probed
+	Probed    bool
+	Resources []indexResource
+	Cover     string // path of the cover art, if any
+	Children  int    // number of children of a directory
+	Info      mediaInfo
+}
+
+// setMediaInfo copies the probed media info into e
+func (e *indexEntry) setMediaInfo(info *mediaInfo) {
+	e.Probed = true
+	e.Info = *info
+}
+
+func (e *indexEntry) encode(key string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		fs.Debugf(key, "dlna index encoding %v: %v", e, err)
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (e *indexEntry) decode(key string, data []byte) error {
+	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(e); err != nil {
+		fs.Debugf(key, "dlna index decoding %q failed: %v", data, err)
+		return err
+	}
+	return nil
+}
+
+// coverArt is the cover art found in a directory
+type coverArt struct {
+	dir    string            // cover for the whole directory
+	byBase map[string]string // covers by lower case base name of the media
+}
+
+// Names of images which are the cover art for a directory in order of
+// preference
+var dirCoverNames = []string{"cover", "folder", "poster", "front"}
+
+// findCovers finds the cover art in nodes
+func findCovers(nodes vfs.Nodes) (c coverArt) {
+	c.byBase = make(map[string]string)
+	dirCovers := map[string]string{}
+	for _, node := range nodes {
+		baseName, ext := splitExt(strings.ToLower(node.Name()))
+		switch ext {
+		case ".jpg", ".jpeg", ".png":
+		default:
+			continue
+		}
+		if node.IsDir() {
+			continue
+		}
+		nodePath := path.Join("/", node.Path())
+		dirCovers[baseName] = nodePath
+		for _, suffix := range []string{"-poster", "-cover", "-thumb"} {
+			baseName = strings.TrimSuffix(baseName, suffix)
+		}
+		c.byBase[baseName] = nodePath
+	}
+	for _, name := range dirCoverNames {
+		if cover, ok := dirCovers[name]; ok {
+			c.dir = cover
+			break
+		}
+	}
+	return c
+}
+
+// lookup returns the cover art for e or "" if none found
+func (c *coverArt) lookup(e *indexEntry) string {
+	if strings.HasPrefix(e.Class, "object.item.imageItem") {
+		return ""
+	}
+	baseName, _ := splitExt(strings.ToLower(e.Name))
+	if cover, ok := c.byBase[baseName]; ok {
+		return cover
+	}
+	return c.dir
+}
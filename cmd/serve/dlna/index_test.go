@@ -0,0 +1,174 @@
+package dlna
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/cmd/serve/dlna/dlnaflags"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startIndexServer makes a server with an index of a directory of test
+// media and waits for the first scan
+func startIndexServer(t *testing.T) (s *server, cds *contentDirectoryService, dir string) {
+	dir = t.TempDir()
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, file := range []struct {
+		name string
+		data []byte
+	}{
+		{"Movies/Zebra.mp4", makeMP4(83500 * time.Millisecond)},
+		{"Movies/Zebra.srt", []byte("1\n00:00:01,000 --> 00:00:02,000\nHello\n")},
+		{"Movies/Aardvark.mkv", makeMKV(time.Hour)},
+		{"Movies/cover.jpg", []byte("not really a jpeg")},
+		{"Movies/Aardvark.jpg", []byte("not really a jpeg")},
+		{"Music/song.mp3", []byte("not really an mp3")},
+		{"notes.txt", []byte("not media")},
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(file.name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0777))
+		require.NoError(t, os.WriteFile(p, file.data, 0666))
+		mt := modTime.Add(time.Duration(i) * 24 * time.Hour)
+		require.NoError(t, os.Chtimes(p, mt, mt))
+	}
+
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+	opt := dlnaflags.Opt
+	opt.ListenAddr = testBindAddress
+	opt.Index = true
+	s, err = newServer(f, &opt, &vfscommon.Opt)
+	require.NoError(t, err)
+	require.NoError(t, s.Serve())
+	t.Cleanup(s.Close)
+	require.Eventually(t, s.index.ready.Load, 10*time.Second, 10*time.Millisecond)
+	return s, s.services["ContentDirectory"].(*contentDirectoryService), dir
+}
+
+// callCDS calls action on cds with the XML args returning the response
+func callCDS(t *testing.T, cds *contentDirectoryService, action, args string) (map[string]string, error) {
+	r, err := http.NewRequest("POST", "http://example.com/ctl", nil)
+	require.NoError(t, err)
+	return cds.Handle(action, []byte("<u:"+action+">"+args+"</u:"+action+">"), r)
+}
+
+func TestIndex(t *testing.T) {
+	s, cds, dir := startIndexServer(t)
+
+	resp, err := callCDS(t, cds, "GetSearchCapabilities", "")
+	require.NoError(t, err)
+	assert.Equal(t, searchCaps, resp["SearchCaps"])
+
+	t.Run("Browse", func(t *testing.T) {
+		resp, err := callCDS(t, cds, "Browse", `<ObjectID>0</ObjectID><BrowseFlag>BrowseDirectChildren</BrowseFlag>`)
+		require.NoError(t, err)
+		assert.Equal(t, "2", resp["TotalMatches"])
+		assert.Contains(t, resp["Result"], `childCount="4"`)
+
+		resp, err = callCDS(t, cds, "Browse", `<ObjectID>%2FMovies</ObjectID><BrowseFlag>BrowseDirectChildren</BrowseFlag>`)
+		require.NoError(t, err)
+		assert.Equal(t, "4", resp["TotalMatches"])
+		result := resp["Result"]
+		assert.Contains(t, result, `duration="0:01:23.500"`)
+		assert.Contains(t, result, `resolution="1920x1080"`)
+		assert.Contains(t, result, `duration="1:00:00.000"`)
+		assert.Contains(t, result, `resolution="1280x720"`)
+		assert.Contains(t, result, "/r/Movies/Zebra.srt")
+		assert.Contains(t, result, "<upnp:albumArtURI>http://example.com/r/Movies/Aardvark.jpg")
+		assert.Contains(t, result, "<upnp:albumArtURI>http://example.com/r/Movies/cover.jpg")
+
+		e := s.index.get("/Movies/Aardvark.mkv")
+		require.NotNil(t, e)
+		assert.Equal(t, []string{"ger", "ja"}, e.Info.Subtitles)
+
+		resp, err = callCDS(t, cds, "Browse", `<ObjectID>%2FMovies%2FZebra.mp4</ObjectID><BrowseFlag>BrowseMetadata</BrowseFlag>`)
+		require.NoError(t, err)
+		assert.Contains(t, resp["Result"], `resolution="1920x1080"`)
+	})
+
+	t.Run("Sort", func(t *testing.T) {
+		for _, test := range []struct {
+			sort  string
+			first string
+		}{
+			{"", "Aardvark.jpg"},
+			{"-dc:title", "Zebra.mp4"},
+			{"+dc:date", "Zebra.mp4"},
+			{"-dc:date", "Aardvark.jpg"},
+		} {
+			resp, err := callCDS(t, cds, "Browse", `<ObjectID>%2FMovies</ObjectID><BrowseFlag>BrowseDirectChildren</BrowseFlag><RequestedCount>1</RequestedCount><SortCriteria>`+test.sort+`</SortCriteria>`)
+			require.NoError(t, err, test.sort)
+			assert.Equal(t, "1", resp["NumberReturned"])
+			assert.Contains(t, resp["Result"], "<dc:title>"+test.first+"<", test.sort)
+		}
+		_, err := callCDS(t, cds, "Browse", `<ObjectID>0</ObjectID><BrowseFlag>BrowseDirectChildren</BrowseFlag><SortCriteria>+upnp:artist</SortCriteria>`)
+		assert.ErrorContains(t, err, "can't sort")
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		for _, test := range []struct {
+			container string
+			criteria  string
+			want      int
+		}{
+			{"0", `*`, 7},
+			{"0", `upnp:class derivedfrom "object.item.videoItem"`, 2},
+			{"0", `upnp:class derivedfrom "object.item"`, 5},
+			{"0", `upnp:class = "object.container.storageFolder"`, 2},
+			{"0", `dc:title contains "ZEB"`, 1},
+			{"0", `(dc:title startsWith "a" or dc:title startsWith "z") and upnp:class derivedfrom "object.item.videoItem"`, 2},
+			{"0", `dc:date >= "2020-01-04"`, 3},
+			{"0", `upnp:artist exists true`, 0},
+			{"0", `upnp:artist exists false and dc:title = "song.mp3"`, 1},
+			{"%2FMusic", `*`, 1},
+			{"%2FMovies", `upnp:class derivedfrom "object.item.audioItem"`, 0},
+		} {
+			resp, err := callCDS(t, cds, "Search", "<ContainerID>"+test.container+"</ContainerID><SearchCriteria>"+html.EscapeString(test.criteria)+"</SearchCriteria>")
+			require.NoError(t, err, test.criteria)
+			assert.Equal(t, fmt.Sprint(test.want), resp["TotalMatches"], test.criteria)
+		}
+		for _, criteria := range []string{
+			`dc:title`,
+			`dc:title contains`,
+			`dc:title contains "x`,
+			`dc:title contains x`,
+			`dc:title potato "x"`,
+			`(dc:title contains "x"`,
+			`dc:title exists maybe`,
+			`dc:title = "x" and`,
+		} {
+			_, err := callCDS(t, cds, "Search", "<ContainerID>0</ContainerID><SearchCriteria>"+html.EscapeString(criteria)+"</SearchCriteria>")
+			assert.Error(t, err, criteria)
+		}
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		updateID := s.index.updateID.Load()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "Music", "another.mp3"), []byte("mp3"), 0666))
+		require.NoError(t, os.RemoveAll(filepath.Join(dir, "Movies")))
+		root, err := s.vfs.Root()
+		require.NoError(t, err)
+		root.ForgetPath("", fs.EntryDirectory)
+		s.index.changeNotify("Music/another.mp3", fs.EntryObject)
+		s.index.changeNotify("Movies", fs.EntryDirectory)
+		s.index.scanPending()
+		assert.NotEqual(t, updateID, s.index.updateID.Load())
+
+		resp, err := callCDS(t, cds, "Search", `<ContainerID>0</ContainerID><SearchCriteria>*</SearchCriteria>`)
+		require.NoError(t, err)
+		assert.Equal(t, "3", resp["TotalMatches"])
+		assert.Contains(t, resp["Result"], "/r/Music/another.mp3")
+		resp, err = callCDS(t, cds, "GetSystemUpdateID", "")
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprint(s.index.updateID.Load()), resp["Id"])
+	})
+}
@@ -0,0 +1,437 @@
+package dlna
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// mediaInfo is the metadata read from the headers of a media file
+type mediaInfo struct {
+	Duration  time.Duration
+	Width     int
+	Height    int
+	Subtitles []string // languages of the embedded subtitle tracks
+}
+
+// The most of a file the probes will read
+const (
+	maxProbeHeader = 1 << 20
+	maxProbeMoov   = 32 << 20
+)
+
+var errProbeUnknown = errors.New("unknown media container")
+
+// probeMedia reads the duration, resolution and embedded subtitles
+// from the MP4/MOV or Matroska/WebM headers of the file in r which is
+// size bytes long.
+//
+// It doesn't decode any media.
+func probeMedia(r io.ReaderAt, size int64) (*mediaInfo, error) {
+	var magic [8]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	switch {
+	case bytes.Equal(magic[:4], []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return probeMatroska(r, size)
+	case isMP4Box(string(magic[4:])):
+		return probeMP4(r, size)
+	}
+	return nil, errProbeUnknown
+}
+
+// isMP4Box returns true if boxType is one which starts MP4/MOV files
+func isMP4Box(boxType string) bool {
+	switch boxType {
+	case "ftyp", "moov", "mdat", "free", "skip", "wide", "pnot":
+		return true
+	}
+	return false
+}
+
+// mp4Box is an MP4 box header
+type mp4Box struct {
+	Type       string
+	HeaderSize int64
+	Size       int64 // including the header
+}
+
+// readMP4Box reads the box header at off from r which ends at end
+func readMP4Box(r io.ReaderAt, off, end int64) (box mp4Box, err error) {
+	var hdr [16]byte
+	if _, err = r.ReadAt(hdr[:8], off); err != nil {
+		return box, err
+	}
+	box.Type = string(hdr[4:8])
+	box.HeaderSize = 8
+	box.Size = int64(binary.BigEndian.Uint32(hdr[:4]))
+	switch box.Size {
+	case 0:
+		box.Size = end - off
+	case 1:
+		if _, err = r.ReadAt(hdr[8:16], off+8); err != nil {
+			return box, err
+		}
+		box.HeaderSize = 16
+		box.Size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+	}
+	if box.Size < box.HeaderSize || off+box.Size > end {
+		return box, fmt.Errorf("corrupt %q box", box.Type)
+	}
+	return box, nil
+}
+
+// probeMP4 finds the moov box and reads the metadata from it
+func probeMP4(r io.ReaderAt, size int64) (*mediaInfo, error) {
+	for off := int64(0); off < size; {
+		box, err := readMP4Box(r, off, size)
+		if err != nil {
+			return nil, err
+		}
+		if box.Type == "moov" {
+			moovSize := box.Size - box.HeaderSize
+			if moovSize > maxProbeMoov {
+				return nil, fmt.Errorf("moov box too big: %d bytes", moovSize)
+			}
+			moov := make([]byte, moovSize)
+			if _, err := r.ReadAt(moov, off+box.HeaderSize); err != nil {
+				return nil, fmt.Errorf("failed to read moov box: %w", err)
+			}
+			info := new(mediaInfo)
+			err = parseMP4Boxes(moov, func(boxType string, data []byte) error {
+				switch boxType {
+				case "mvhd":
+					info.Duration = parseMP4Duration(data, 8, 16)
+				case "trak":
+					parseMP4Track(data, info)
+				}
+				return nil
+			})
+			return info, err
+		}
+		off += box.Size
+	}
+	return nil, errors.New("no moov box found")
+}
+
+// parseMP4Boxes calls fn with the type and contents of each box in data
+func parseMP4Boxes(data []byte, fn func(boxType string, data []byte) error) error {
+	r := bytes.NewReader(data)
+	end := int64(len(data))
+	for off := int64(0); off < end; {
+		box, err := readMP4Box(r, off, end)
+		if err != nil {
+			return err
+		}
+		if err := fn(box.Type, data[off+box.HeaderSize:off+box.Size]); err != nil {
+			return err
+		}
+		off += box.Size
+	}
+	return nil
+}
+
+// parseMP4Duration reads the timescale and duration from the full box
+// in data. The offsets of the timescale after the version and flags
+// are given for version 0 and version 1 boxes, the duration follows
+// it.
+func parseMP4Duration(data []byte, offV0, offV1 int) time.Duration {
+	if len(data) < 4 {
+		return 0
+	}
+	var timescale, duration uint64
+	if data[0] == 1 {
+		off := 4 + offV1
+		if len(data) < off+12 {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(data[off:]))
+		duration = binary.BigEndian.Uint64(data[off+4:])
+	} else {
+		off := 4 + offV0
+		if len(data) < off+8 {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(data[off:]))
+		duration = uint64(binary.BigEndian.Uint32(data[off+4:]))
+	}
+	if timescale == 0 || duration == math.MaxUint32 || duration == math.MaxUint64 {
+		return 0
+	}
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+}
+
+// parseMP4Track reads the resolution of video tracks and the language
+// of subtitle tracks in the trak box in data into info
+func parseMP4Track(data []byte, info *mediaInfo) {
+	var (
+		width, height int
+		handler       string
+		language      string
+	)
+	_ = parseMP4Boxes(data, func(boxType string, data []byte) error {
+		switch boxType {
+		case "tkhd":
+			// The width and height are 16.16 fixed point at the end
+			if len(data) >= 8 {
+				width = int(binary.BigEndian.Uint32(data[len(data)-8:]) >> 16)
+				height = int(binary.BigEndian.Uint32(data[len(data)-4:]) >> 16)
+			}
+		case "mdia":
+			return parseMP4Boxes(data, func(boxType string, data []byte) error {
+				switch boxType {
+				case "hdlr":
+					if len(data) >= 12 {
+						handler = string(data[8:12])
+					}
+				case "mdhd":
+					off := 20
+					if len(data) > 0 && data[0] == 1 {
+						off = 32
+					}
+					if len(data) >= off+2 {
+						language = mp4Language(binary.BigEndian.Uint16(data[off:]))
+					}
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	switch handler {
+	case "vide":
+		if info.Width == 0 && width > 0 && height > 0 {
+			info.Width, info.Height = width, height
+		}
+	case "sbtl", "subt", "text", "clcp":
+		info.Subtitles = append(info.Subtitles, language)
+	}
+}
+
+// mp4Language decodes the packed ISO-639-2/T language code from an
+// mdhd box
+func mp4Language(packed uint16) string {
+	if packed == 0 || packed == 0x7fff {
+		return "und"
+	}
+	lang := []byte{
+		byte(packed>>10&0x1f) + 0x60,
+		byte(packed>>5&0x1f) + 0x60,
+		byte(packed&0x1f) + 0x60,
+	}
+	return string(lang)
+}
+
+// Matroska element IDs used by probeMatroska
+const (
+	mkvSegment       = 0x18538067
+	mkvInfo          = 0x1549A966
+	mkvTimecodeScale = 0x2AD7B1
+	mkvDuration      = 0x4489
+	mkvTracks        = 0x1654AE6B
+	mkvTrackEntry    = 0xAE
+	mkvTrackType     = 0x83
+	mkvLanguage      = 0x22B59C
+	mkvLanguageBCP47 = 0x22B59D
+	mkvVideo         = 0xE0
+	mkvPixelWidth    = 0xB0
+	mkvPixelHeight   = 0xBA
+	mkvCluster       = 0x1F43B675
+)
+
+// Matroska track types
+const (
+	mkvTrackVideo    = 1
+	mkvTrackSubtitle = 17
+)
+
+// readEBMLVint reads a variable length integer from data returning
+// its value, its length and whether it was all ones (unknown size).
+// If keepMarker is set the length marker bit is kept which is used
+// for element IDs.
+func readEBMLVint(data []byte, keepMarker bool) (value uint64, n int, allOnes bool, err error) {
+	if len(data) == 0 {
+		return 0, 0, false, io.ErrUnexpectedEOF
+	}
+	first := data[0]
+	n = 1
+	for mask := byte(0x80); first&mask == 0; mask >>= 1 {
+		n++
+		if n > 8 {
+			return 0, 0, false, errors.New("invalid EBML integer")
+		}
+	}
+	if len(data) < n {
+		return 0, 0, false, io.ErrUnexpectedEOF
+	}
+	value = uint64(first)
+	if !keepMarker {
+		value &= uint64(0xff >> n)
+	}
+	for _, b := range data[1:n] {
+		value = value<<8 | uint64(b)
+	}
+	allOnes = value == 1<<(7*uint(n))-1
+	return value, n, allOnes, nil
+}
+
+// parseEBML calls fn with the ID and contents of each element in
+// data. Elements of unknown size run to the end of data. Parsing stops
+// without error if fn returns io.EOF or data is truncated.
+func parseEBML(data []byte, fn func(id uint64, data []byte) error) error {
+	for len(data) > 0 {
+		id, n, _, err := readEBMLVint(data, true)
+		if err != nil {
+			return nil
+		}
+		data = data[n:]
+		size, n, unknown, err := readEBMLVint(data, false)
+		if err != nil {
+			return nil
+		}
+		data = data[n:]
+		if unknown || size > uint64(len(data)) {
+			size = uint64(len(data))
+		}
+		err = fn(id, data[:size])
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// ebmlUint decodes a big endian unsigned integer element
+func ebmlUint(data []byte) (v uint64) {
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+// ebmlFloat decodes a 4 or 8 byte float element
+func ebmlFloat(data []byte) float64 {
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	}
+	return 0
+}
+
+// probeMatroska reads the Info and Tracks elements of a Matroska or
+// WebM file. These are nearly always at the start so only the first
+// maxProbeHeader bytes are read.
+func probeMatroska(r io.ReaderAt, size int64) (*mediaInfo, error) {
+	if size > maxProbeHeader {
+		size = maxProbeHeader
+	}
+	data := make([]byte, size)
+	n, err := r.ReadAt(data, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	data = data[:n]
+	info := new(mediaInfo)
+	found := false
+	err = parseEBML(data, func(id uint64, data []byte) error {
+		if id != mkvSegment {
+			return nil
+		}
+		found = true
+		return parseEBML(data, func(id uint64, data []byte) error {
+			switch id {
+			case mkvInfo:
+				parseMatroskaInfo(data, info)
+			case mkvTracks:
+				return parseEBML(data, func(id uint64, data []byte) error {
+					if id == mkvTrackEntry {
+						parseMatroskaTrack(data, info)
+					}
+					return nil
+				})
+			case mkvCluster:
+				return io.EOF
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("no Matroska segment found")
+	}
+	return info, nil
+}
+
+// parseMatroskaInfo reads the duration from the Info element in data
+func parseMatroskaInfo(data []byte, info *mediaInfo) {
+	timecodeScale := uint64(1000000)
+	var duration float64
+	_ = parseEBML(data, func(id uint64, data []byte) error {
+		switch id {
+		case mkvTimecodeScale:
+			timecodeScale = ebmlUint(data)
+		case mkvDuration:
+			duration = ebmlFloat(data)
+		}
+		return nil
+	})
+	if duration > 0 {
+		info.Duration = time.Duration(duration * float64(timecodeScale))
+	}
+}
+
+// parseMatroskaTrack reads the resolution of video tracks and the
+// language of subtitle tracks from the TrackEntry in data
+func parseMatroskaTrack(data []byte, info *mediaInfo) {
+	var (
+		trackType     uint64
+		width, height int
+		language      = "eng" // the default in the spec
+		bcp47         string
+	)
+	_ = parseEBML(data, func(id uint64, data []byte) error {
+		switch id {
+		case mkvTrackType:
+			trackType = ebmlUint(data)
+		case mkvLanguage:
+			language = strings.TrimRight(string(data), "\x00")
+		case mkvLanguageBCP47:
+			bcp47 = strings.TrimRight(string(data), "\x00")
+		case mkvVideo:
+			return parseEBML(data, func(id uint64, data []byte) error {
+				switch id {
+				case mkvPixelWidth:
+					width = int(ebmlUint(data))
+				case mkvPixelHeight:
+					height = int(ebmlUint(data))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if bcp47 != "" {
+		language = bcp47
+	}
+	switch trackType {
+	case mkvTrackVideo:
+		if info.Width == 0 && width > 0 && height > 0 {
+			info.Width, info.Height = width, height
+		}
+	case mkvTrackSubtitle:
+		info.Subtitles = append(info.Subtitles, language)
+	}
+}
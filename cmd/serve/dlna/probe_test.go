@@ -0,0 +1,157 @@
+package dlna
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeMP4Box makes an MP4 box of boxType containing payload
+func makeMP4Box(boxType string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(data)))
+	out = append(out, boxType...)
+	return append(out, data...)
+}
+
+// makeMP4Track makes a trak box with handler and language and a
+// resolution of width x height
+func makeMP4Track(handler, language string, width, height int) []byte {
+	tkhd := make([]byte, 4+20+52+8)
+	binary.BigEndian.PutUint32(tkhd[len(tkhd)-8:], uint32(width)<<16)
+	binary.BigEndian.PutUint32(tkhd[len(tkhd)-4:], uint32(height)<<16)
+	mdhd := make([]byte, 4+16+4)
+	packed := uint16(language[0]-0x60)<<10 | uint16(language[1]-0x60)<<5 | uint16(language[2]-0x60)
+	binary.BigEndian.PutUint16(mdhd[20:], packed)
+	hdlr := append(make([]byte, 8), handler...)
+	hdlr = append(hdlr, make([]byte, 13)...)
+	return makeMP4Box("trak",
+		makeMP4Box("tkhd", tkhd),
+		makeMP4Box("mdia", makeMP4Box("mdhd", mdhd), makeMP4Box("hdlr", hdlr)),
+	)
+}
+
+// makeMP4 makes an MP4 file lasting duration with a 1920x1080 video
+// track and French subtitles
+func makeMP4(duration time.Duration) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], uint32(duration.Milliseconds()))
+	return bytes.Join([][]byte{
+		makeMP4Box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2")),
+		makeMP4Box("mdat", make([]byte, 100)),
+		makeMP4Box("moov",
+			makeMP4Box("mvhd", mvhd),
+			makeMP4Track("vide", "und", 1920, 1080),
+			makeMP4Track("soun", "eng", 0, 0),
+			makeMP4Track("sbtl", "fre", 0, 0),
+		),
+	}, nil)
+}
+
+// makeEBML makes a Matroska element with id containing payload
+func makeEBML(id uint64, payload ...[]byte) []byte {
+	var out []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> uint(shift)); b != 0 || len(out) > 0 {
+			out = append(out, b)
+		}
+	}
+	data := bytes.Join(payload, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(data)))
+	size[0] = 0x01
+	out = append(out, size...)
+	return append(out, data...)
+}
+
+// makeMKV makes a Matroska file lasting duration with a 1280x720
+// video track and German and Japanese subtitles
+func makeMKV(duration time.Duration) []byte {
+	durationMs := binary.BigEndian.AppendUint64(nil, math.Float64bits(float64(duration.Milliseconds())))
+	tracks := makeEBML(mkvTracks,
+		makeEBML(mkvTrackEntry,
+			makeEBML(mkvTrackType, []byte{mkvTrackVideo}),
+			makeEBML(mkvVideo,
+				makeEBML(mkvPixelWidth, []byte{0x05, 0x00}),
+				makeEBML(mkvPixelHeight, []byte{0x02, 0xD0}),
+			),
+		),
+		makeEBML(mkvTrackEntry,
+			makeEBML(mkvTrackType, []byte{mkvTrackSubtitle}),
+			makeEBML(mkvLanguage, []byte("ger")),
+		),
+		makeEBML(mkvTrackEntry,
+			makeEBML(mkvTrackType, []byte{mkvTrackSubtitle}),
+			makeEBML(mkvLanguage, []byte("jpn")),
+			makeEBML(mkvLanguageBCP47, []byte("ja")),
+		),
+	)
+	segment := bytes.Join([][]byte{
+		makeEBML(mkvInfo,
+			makeEBML(mkvTimecodeScale, []byte{0x0F, 0x42, 0x40}),
+			makeEBML(mkvDuration, durationMs),
+		),
+		tracks,
+		makeEBML(mkvCluster, make([]byte, 100)),
+		// Tracks after the first Cluster aren't read
+		makeEBML(mkvTracks, makeEBML(mkvTrackEntry, makeEBML(mkvTrackType, []byte{mkvTrackSubtitle}))),
+	}, nil)
+	// The segment is of unknown size as written by live encoders
+	segment = append([]byte{0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, segment...)
+	return append(makeEBML(0x1A45DFA3, []byte{0x42, 0x86, 0x81, 0x01}), segment...)
+}
+
+func TestProbeMedia(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		data []byte
+		want mediaInfo
+	}{
+		{"MP4", makeMP4(83500 * time.Millisecond), mediaInfo{
+			Duration:  83500 * time.Millisecond,
+			Width:     1920,
+			Height:    1080,
+			Subtitles: []string{"fre"},
+		}},
+		{"MKV", makeMKV(time.Hour + 2*time.Minute + 3*time.Second), mediaInfo{
+			Duration:  time.Hour + 2*time.Minute + 3*time.Second,
+			Width:     1280,
+			Height:    720,
+			Subtitles: []string{"ger", "ja"},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := probeMedia(bytes.NewReader(test.data), int64(len(test.data)))
+			require.NoError(t, err)
+			assert.Equal(t, test.want, *info)
+		})
+	}
+
+	// The testdata video has a moov box with no tracks
+	data, err := os.ReadFile("testdata/files/video.mp4")
+	require.NoError(t, err)
+	info, err := probeMedia(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	assert.Equal(t, mediaInfo{}, *info)
+
+	_, err = probeMedia(bytes.NewReader([]byte("not a media file")), 16)
+	assert.Equal(t, errProbeUnknown, err)
+
+	// Truncated files are errors
+	data = makeMP4(time.Second)
+	_, err = probeMedia(bytes.NewReader(data[:len(data)-10]), int64(len(data)-10))
+	assert.Error(t, err)
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "0:00:00.000", formatDuration(0))
+	assert.Equal(t, "0:01:23.500", formatDuration(83500*time.Millisecond))
+	assert.Equal(t, "12:02:03.004", formatDuration(12*time.Hour+2*time.Minute+3*time.Second+4*time.Millisecond))
+}
@@ -0,0 +1,325 @@
+package dlna
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// UPnP ContentDirectory error codes
+const (
+	invalidSearchCriteriaErrorCode = 708
+	invalidSortCriteriaErrorCode   = 709
+)
+
+// The properties which can be searched and sorted on
+const (
+	searchCaps = "dc:title,upnp:class,dc:date"
+	sortCaps   = "dc:title,dc:date"
+)
+
+// Returns the value of the property prop for e and whether e has it.
+func (e *indexEntry) property(prop string) (string, bool) {
+	switch prop {
+	case "dc:title":
+		return e.Name, true
+	case "upnp:class":
+		return e.Class, true
+	case "dc:date":
+		if e.IsDir {
+			return "", false
+		}
+		return e.ModTime.Format("2006-01-02"), true
+	case "@id":
+		return object{e.Path}.ID(), true
+	case "@parentID":
+		return object{e.Path}.ParentID(), true
+	}
+	return "", false
+}
+
+// sortEntries sorts entries according to the SortCriteria, a comma
+// separated list of properties each prefixed with + for ascending or
+// - for descending.
+func sortEntries(entries []*indexEntry, criteria string) error {
+	type sortKey struct {
+		prop       string
+		descending bool
+	}
+	var keys []sortKey
+	for _, field := range strings.Split(criteria, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key := sortKey{prop: field}
+		switch field[0] {
+		case '+':
+			key.prop = field[1:]
+		case '-':
+			key.prop = field[1:]
+			key.descending = true
+		}
+		switch key.prop {
+		case "dc:title", "dc:date":
+		default:
+			return fmt.Errorf("can't sort by %q", key.prop)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		for _, key := range keys {
+			var cmp int
+			switch key.prop {
+			case "dc:title":
+				cmp = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+			case "dc:date":
+				cmp = a.ModTime.Compare(b.ModTime)
+			}
+			if key.descending {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// searchMatcher returns true if the entry matches the SearchCriteria
+type searchMatcher func(e *indexEntry) bool
+
+// searchParser parses a UPnP ContentDirectory SearchCriteria string
+//
+//	searchCrit := searchExp | "*"
+//	searchExp  := relExp | searchExp ("and"|"or") searchExp | "(" searchExp ")"
+//	relExp     := property binOp quotedVal | property "exists" ("true"|"false")
+//
+// "and" binds tighter than "or". Properties which aren't indexed
+// never match.
+type searchParser struct {
+	tokens []string
+	quoted []bool // whether each token was a quoted string
+	pos    int
+}
+
+var errSearchEnd = errors.New("unexpected end of search criteria")
+
+// parseSearchCriteria parses criteria into a searchMatcher
+func parseSearchCriteria(criteria string) (searchMatcher, error) {
+	criteria = strings.TrimSpace(criteria)
+	if criteria == "*" || criteria == "" {
+		return func(*indexEntry) bool { return true }, nil
+	}
+	p := &searchParser{}
+	if err := p.tokenize(criteria); err != nil {
+		return nil, err
+	}
+	match, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in search criteria", p.tokens[p.pos])
+	}
+	return match, nil
+}
+
+// tokenize splits criteria into words, quoted strings, parentheses
+// and relational operators
+func (p *searchParser) tokenize(criteria string) error {
+	s := []rune(criteria)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')':
+			p.add(string(c), false)
+			i++
+		case c == '"':
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(s) {
+					return errors.New("unterminated string in search criteria")
+				}
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				} else if s[i] == '"' {
+					i++
+					break
+				}
+				b.WriteRune(s[i])
+				i++
+			}
+			p.add(b.String(), true)
+		case strings.ContainsRune("=!<>", c):
+			op := string(c)
+			if i+1 < len(s) && s[i+1] == '=' {
+				op += "="
+				i++
+			}
+			if op == "!" {
+				return errors.New("bad operator ! in search criteria")
+			}
+			p.add(op, false)
+			i++
+		default:
+			start := i
+			for i < len(s) && !unicode.IsSpace(s[i]) && !strings.ContainsRune(`()"=!<>`, s[i]) {
+				i++
+			}
+			p.add(string(s[start:i]), false)
+		}
+	}
+	return nil
+}
+
+func (p *searchParser) add(token string, quoted bool) {
+	p.tokens = append(p.tokens, token)
+	p.quoted = append(p.quoted, quoted)
+}
+
+// next returns the next token and whether it was quoted
+func (p *searchParser) next() (string, bool, error) {
+	if p.pos >= len(p.tokens) {
+		return "", false, errSearchEnd
+	}
+	p.pos++
+	return p.tokens[p.pos-1], p.quoted[p.pos-1], nil
+}
+
+// peekWord returns true if the next token is the unquoted word
+func (p *searchParser) peekWord(word string) bool {
+	return p.pos < len(p.tokens) && !p.quoted[p.pos] && strings.EqualFold(p.tokens[p.pos], word)
+}
+
+func (p *searchParser) parseOr() (searchMatcher, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *indexEntry) bool { return l(e) || right(e) }
+	}
+	return left, nil
+}
+
+func (p *searchParser) parseAnd() (searchMatcher, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("and") {
+		p.pos++
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *indexEntry) bool { return l(e) && right(e) }
+	}
+	return left, nil
+}
+
+func (p *searchParser) parsePrimary() (searchMatcher, error) {
+	if p.peekWord("(") {
+		p.pos++
+		match, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peekWord(")") {
+			return nil, errors.New("missing ) in search criteria")
+		}
+		p.pos++
+		return match, nil
+	}
+	prop, quoted, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if quoted {
+		return nil, fmt.Errorf("expecting property but got %q in search criteria", prop)
+	}
+	op, _, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	val, quoted, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(op, "exists") {
+		var want bool
+		switch strings.ToLower(val) {
+		case "true":
+			want = true
+		case "false":
+		default:
+			return nil, fmt.Errorf("bad value %q for exists in search criteria", val)
+		}
+		return func(e *indexEntry) bool {
+			_, ok := e.property(prop)
+			return ok == want
+		}, nil
+	}
+	if !quoted {
+		return nil, fmt.Errorf("expecting quoted value but got %q in search criteria", val)
+	}
+	compare, err := searchOperator(op, val)
+	if err != nil {
+		return nil, err
+	}
+	return func(e *indexEntry) bool {
+		got, ok := e.property(prop)
+		return ok && compare(got)
+	}, nil
+}
+
+// searchOperator returns a function to compare a property value with
+// val using op. String comparisons are case insensitive.
+func searchOperator(op, val string) (func(string) bool, error) {
+	lowerVal := strings.ToLower(val)
+	switch strings.ToLower(op) {
+	case "=":
+		return func(s string) bool { return strings.EqualFold(s, val) }, nil
+	case "!=":
+		return func(s string) bool { return !strings.EqualFold(s, val) }, nil
+	case "<":
+		return func(s string) bool { return strings.ToLower(s) < lowerVal }, nil
+	case "<=":
+		return func(s string) bool { return strings.ToLower(s) <= lowerVal }, nil
+	case ">":
+		return func(s string) bool { return strings.ToLower(s) > lowerVal }, nil
+	case ">=":
+		return func(s string) bool { return strings.ToLower(s) >= lowerVal }, nil
+	case "contains":
+		return func(s string) bool { return strings.Contains(strings.ToLower(s), lowerVal) }, nil
+	case "doesnotcontain":
+		return func(s string) bool { return !strings.Contains(strings.ToLower(s), lowerVal) }, nil
+	case "startswith":
+		return func(s string) bool { return strings.HasPrefix(strings.ToLower(s), lowerVal) }, nil
+	case "derivedfrom":
+		return func(s string) bool {
+			s = strings.ToLower(s)
+			return s == lowerVal || strings.HasPrefix(s, lowerVal+".")
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown operator %q in search criteria", op)
+}
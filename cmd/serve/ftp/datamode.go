@@ -0,0 +1,134 @@
+//go:build !plan9
+
+package ftp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	ftp "goftp.io/server/v2"
+)
+
+// commands returns the FTP commands with the active and passive mode
+// commands wrapped to apply the data connection policy
+func (d *driver) commands() map[string]ftp.Command {
+	commands := make(map[string]ftp.Command)
+	for name, command := range ftp.DefaultCommands() {
+		switch name {
+		case "PORT", "EPRT", "LPRT":
+			command = activeCommand{Command: command, name: name, d: d}
+		case "PASV", "EPSV":
+			command = passiveCommand{Command: command, d: d}
+		}
+		commands[name] = command
+	}
+	return commands
+}
+
+// activeCommand applies --disable-active and --active-networks to an
+// active mode command
+type activeCommand struct {
+	ftp.Command
+	name string
+	d    *driver
+}
+
+// Execute the command if the policy allows it
+func (c activeCommand) Execute(sess *ftp.Session, param string) {
+	if c.d.opt.DisableActive {
+		sess.WriteMessage(502, "Active mode disabled, use PASV")
+		return
+	}
+	if err := c.d.checkActive(c.name, param); err != nil {
+		fs.Infof(sess.LoginUser(), "%s refused: %v", c.name, err)
+		sess.WriteMessage(500, fmt.Sprintf("Illegal %s command", c.name))
+		return
+	}
+	c.Command.Execute(sess, param)
+}
+
+// passiveCommand applies --disable-passive to a passive mode command
+type passiveCommand struct {
+	ftp.Command
+	d *driver
+}
+
+// Execute the command if the policy allows it
+func (c passiveCommand) Execute(sess *ftp.Session, param string) {
+	if c.d.opt.DisablePassive {
+		sess.WriteMessage(502, "Passive mode disabled, use PORT")
+		return
+	}
+	c.Command.Execute(sess, param)
+}
+
+// checkActive checks the address the client asked the server to
+// connect to is in one of the allowed networks
+func (d *driver) checkActive(command, param string) error {
+	if len(d.activeNets) == 0 {
+		return nil
+	}
+	ip, err := parseActiveHost(command, param)
+	if err != nil {
+		return err
+	}
+	for _, ipNet := range d.activeNets {
+		if ipNet.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("address %v not in --active-networks", ip)
+}
+
+// parseActiveHost returns the IP address from the parameter of a
+// PORT, EPRT or LPRT command
+func parseActiveHost(command, param string) (net.IP, error) {
+	var ip net.IP
+	switch command {
+	case "PORT":
+		// h1,h2,h3,h4,p1,p2
+		parts := strings.Split(param, ",")
+		if len(parts) != 6 {
+			return nil, errors.New("bad PORT parameter")
+		}
+		ip = net.ParseIP(strings.Join(parts[:4], "."))
+	case "EPRT":
+		// |af|address|port|
+		if len(param) < 1 {
+			return nil, errors.New("bad EPRT parameter")
+		}
+		parts := strings.Split(param, param[:1])
+		if len(parts) != 5 {
+			return nil, errors.New("bad EPRT parameter")
+		}
+		ip = net.ParseIP(parts[2])
+	case "LPRT":
+		// af,hal,h1,...,hN,pal,p1,...,pN
+		parts := strings.Split(param, ",")
+		if len(parts) < 2 {
+			return nil, errors.New("bad LPRT parameter")
+		}
+		hal, err := strconv.Atoi(parts[1])
+		if err != nil || (hal != net.IPv4len && hal != net.IPv6len) || len(parts) < 2+hal {
+			return nil, errors.New("bad LPRT parameter")
+		}
+		ip = make(net.IP, hal)
+		for i := range ip {
+			b, err := strconv.ParseUint(parts[2+i], 10, 8)
+			if err != nil {
+				return nil, errors.New("bad LPRT parameter")
+			}
+			ip[i] = byte(b)
+		}
+	default:
+		return nil, fmt.Errorf("unknown active command %q", command)
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("bad %s address", command)
+	}
+	return ip, nil
+}
@@ -0,0 +1,52 @@
+//go:build !plan9
+
+package ftp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseActiveHost(t *testing.T) {
+	for _, test := range []struct {
+		command string
+		param   string
+		want    string
+		wantErr bool
+	}{
+		{"PORT", "192,168,1,2,7,138", "192.168.1.2", false},
+		{"PORT", "192,168,1,7,138", "", true},
+		{"PORT", "999,168,1,2,7,138", "", true},
+		{"EPRT", "|1|132.235.1.2|6275|", "132.235.1.2", false},
+		{"EPRT", "|2|1080::8:800:200C:417A|5282|", "1080::8:800:200c:417a", false},
+		{"EPRT", "|1|132.235.1.2|", "", true},
+		{"EPRT", "", "", true},
+		{"LPRT", "4,4,10,0,0,1,2,7,138", "10.0.0.1", false},
+		{"LPRT", "4,4,10,0,0", "", true},
+		{"LPRT", "4,5,10,0,0,1,2,2,7,138", "", true},
+		{"NOPE", "", "", true},
+	} {
+		ip, err := parseActiveHost(test.command, test.param)
+		if test.wantErr {
+			assert.Error(t, err, test.command+" "+test.param)
+		} else {
+			require.NoError(t, err, test.command+" "+test.param)
+			assert.Equal(t, test.want, ip.String())
+		}
+	}
+}
+
+func TestCheckActive(t *testing.T) {
+	d := &driver{}
+	assert.NoError(t, d.checkActive("PORT", "8,8,8,8,7,138"))
+
+	_, ipNet, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	d.activeNets = []*net.IPNet{ipNet}
+	assert.NoError(t, d.checkActive("PORT", "10,1,2,3,7,138"))
+	assert.Error(t, d.checkActive("PORT", "8,8,8,8,7,138"))
+	assert.Error(t, d.checkActive("PORT", "garbage"))
+}
@@ -20,8 +20,11 @@ import (
 	"github.com/rclone/rclone/cmd"
 	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
+	"github.com/rclone/rclone/cmd/serve/servelib"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/rclone/rclone/fs/config/flags"
 	"github.com/rclone/rclone/fs/config/obscure"
 	"github.com/rclone/rclone/fs/log"
@@ -51,9 +54,10 @@ var OptionsInfo = fs.Options{{
 	Default: "anonymous",
 	Help:    "User name for authentication",
 }, {
-	Name:    "pass",
-	Default: "",
-	Help:    "Password for authentication (empty value allow every password)",
+	Name:      "pass",
+	Default:   "",
+	Help:      "Password for authentication (empty value allow every password)",
+	Sensitive: true,
 }, {
 	Name:    "cert",
 	Default: "",
@@ -62,18 +66,48 @@ var OptionsInfo = fs.Options{{
 	Name:    "key",
 	Default: "",
 	Help:    "TLS PEM Private key",
+}, {
+	Name:    "explicit_tls",
+	Default: false,
+	Help:    "Use explicit FTPS (AUTH TLS) on --addr instead of implicit TLS",
+}, {
+	Name:    "implicit_tls_addr",
+	Default: "",
+	Help:    "IPaddress:Port or :Port to bind an additional implicit FTPS server to, e.g. :990",
+}, {
+	Name:    "quota",
+	Default: fs.SizeSuffix(-1),
+	Help:    "Maximum storage each user may use, uploads over this are refused",
+}, {
+	Name:    "disable_active",
+	Default: false,
+	Help:    "Refuse active mode data connections (PORT, EPRT, LPRT)",
+}, {
+	Name:    "disable_passive",
+	Default: false,
+	Help:    "Refuse passive mode data connections (PASV, EPSV)",
+}, {
+	Name:    "active_networks",
+	Default: fs.CommaSepList{},
+	Help:    "Comma separated list of CIDRs that active mode data connections may be made to",
 }}
 
 // Options contains options for the http Server
 type Options struct {
 	//TODO add more options
-	ListenAddr   string `config:"addr"`         // Port to listen on
-	PublicIP     string `config:"public_ip"`    // Passive ports range
-	PassivePorts string `config:"passive_port"` // Passive ports range
-	BasicUser    string `config:"user"`         // single username for basic auth if not using Htpasswd
-	BasicPass    string `config:"pass"`         // password for BasicUser
-	TLSCert      string `config:"cert"`         // TLS PEM key (concatenation of certificate and CA certificate)
-	TLSKey       string `config:"key"`          // TLS PEM Private key
+	ListenAddr      string          `config:"addr"`              // Port to listen on
+	PublicIP        string          `config:"public_ip"`         // Passive ports range
+	PassivePorts    string          `config:"passive_port"`      // Passive ports range
+	BasicUser       string          `config:"user"`              // single username for basic auth if not using Htpasswd
+	BasicPass       string          `config:"pass"`              // password for BasicUser
+	TLSCert         string          `config:"cert"`              // TLS PEM key (concatenation of certificate and CA certificate)
+	TLSKey          string          `config:"key"`               // TLS PEM Private key
+	ExplicitTLS     bool            `config:"explicit_tls"`      // use AUTH TLS on ListenAddr rather than implicit TLS
+	ImplicitTLSAddr string          `config:"implicit_tls_addr"` // extra address to serve implicit FTPS on
+	Quota           fs.SizeSuffix   `config:"quota"`             // per user storage quota
+	DisableActive   bool            `config:"disable_active"`    // refuse PORT, EPRT and LPRT
+	DisablePassive  bool            `config:"disable_passive"`   // refuse PASV and EPSV
+	ActiveNetworks  fs.CommaSepList `config:"active_networks"`   // CIDRs active connections may be made to
 }
 
 // Opt is options set by command line flags
@@ -114,21 +148,58 @@ By default this will serve files without needing a login.
 
 You can set a single username and password with the --user and --pass flags.
 
-` + vfs.Help() + proxy.Help,
+#### TLS
+
+Use --cert and --key to enable FTPS. By default the server on --addr
+then speaks implicit FTPS, where the TLS handshake happens as soon as
+the client connects. Use --explicit-tls to accept plain connections on
+--addr instead and upgrade them with AUTH TLS (RFC 4217).
+
+Clients which only speak implicit FTPS usually expect to find it on
+port 990. Use --implicit-tls-addr, e.g. --implicit-tls-addr :990, to
+serve implicit FTPS on an additional address alongside --addr, using the
+same certificate, users and VFS.
+
+#### Quota
+
+Use --quota to limit the amount of storage each user may use, e.g.
+--quota 10G. The usage of each user is counted from the remote the
+first time they upload and then tracked as files are uploaded and
+deleted through the server. Uploads which would take the user over
+their quota are aborted. When using --auth-proxy each user is counted
+against the remote the proxy returns for them.
+
+#### Data connections
+
+By default clients may use either passive (PASV, EPSV) or active
+(PORT, EPRT, LPRT) data connections. Use --disable-passive or
+--disable-active to refuse one of them.
+
+In active mode the server connects out to an address the client
+chooses. Use --active-networks with a comma separated list of CIDRs,
+e.g. --active-networks 10.0.0.0/8,192.168.1.0/24, to only allow active
+connections to trusted networks.
+
+` + vfs.Help() + proxy.Help + proxy.AuthHelp,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.44",
 		"groups":            "Filter",
 	},
 	Run: func(command *cobra.Command, args []string) {
 		var f fs.Fs
-		if proxyflags.Opt.AuthProxy == "" {
+		if !proxyflags.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
 			cmd.CheckArgs(0, 0, command, args)
 		}
 		cmd.Run(false, false, command, func() error {
-			s, err := newServer(context.Background(), f, &Opt)
+			ctx := context.Background()
+			p, err := proxyflags.NewProxy(ctx)
+			if err != nil {
+				return err
+			}
+			s, err := newServer(ctx, f, &Opt, &vfscommon.Opt, p)
 			if err != nil {
 				return err
 			}
@@ -139,25 +210,38 @@ You can set a single username and password with the --user and --pass flags.
 
 // driver contains everything to run the driver for the FTP server
 type driver struct {
-	f          fs.Fs
-	srv        *ftp.Server
-	ctx        context.Context // for global config
-	opt        Options
-	globalVFS  *vfs.VFS     // the VFS if not using auth proxy
-	proxy      *proxy.Proxy // may be nil if not in use
-	useTLS     bool
-	userPassMu sync.Mutex        // to protect userPass
-	userPass   map[string]string // cache of username => password when using vfs proxy
+	f           fs.Fs
+	srv         *ftp.Server
+	implicitSrv *ftp.Server     // serving implicit FTPS if set
+	ctx         context.Context // for global config
+	opt         Options
+	globalVFS   *vfs.VFS     // the VFS if not using auth proxy
+	proxy       *proxy.Proxy // may be nil if not in use
+	useTLS      bool
+	userPassMu  sync.Mutex        // to protect userPass
+	userPass    map[string]string // cache of username => password when using vfs proxy
+	quota       *quota            // may be nil if not in use
+	activeNets  []*net.IPNet      // networks active connections may be made to, all if empty
 }
 
 func init() {
 	fs.RegisterGlobalOptions(fs.OptionsInfo{Name: "ftp", Opt: &Opt, Options: OptionsInfo})
+	servelib.Register("ftp", func(ctx context.Context, f fs.Fs, in configmap.Getter, vfsOpt *vfscommon.Options, p *proxy.Proxy) (servelib.Handle, error) {
+		opt := Opt
+		err := configstruct.Set(in, &opt)
+		if err != nil {
+			return nil, err
+		}
+		return newServer(ctx, f, &opt, vfsOpt, p)
+	}, OptionsInfo)
 }
 
 var passivePortsRe = regexp.MustCompile(`^\s*\d+\s*-\s*\d+\s*$`)
 
 // Make a new FTP to serve the remote
-func newServer(ctx context.Context, f fs.Fs, opt *Options) (*driver, error) {
+//
+// If p is set it is used to authenticate users, otherwise f is served
+func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Options, p *proxy.Proxy) (*driver, error) {
 	host, port, err := net.SplitHostPort(opt.ListenAddr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse host:port from %q", opt.ListenAddr)
@@ -172,13 +256,26 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options) (*driver, error) {
 		ctx: ctx,
 		opt: *opt,
 	}
-	if proxyflags.Opt.AuthProxy != "" {
-		d.proxy = proxy.New(ctx, &proxyflags.Opt)
+	if p != nil {
+		d.proxy = p
 		d.userPass = make(map[string]string, 16)
 	} else {
-		d.globalVFS = vfs.New(f, &vfscommon.Opt)
+		d.globalVFS = vfs.New(f, vfsOpt)
 	}
 	d.useTLS = d.opt.TLSKey != ""
+	if !d.useTLS && (d.opt.ExplicitTLS || d.opt.ImplicitTLSAddr != "") {
+		return nil, errors.New("--cert and --key must be set to use FTPS")
+	}
+	if d.opt.Quota >= 0 {
+		d.quota = newQuota(int64(d.opt.Quota))
+	}
+	for _, network := range d.opt.ActiveNetworks {
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid active network: %w", err)
+		}
+		d.activeNets = append(d.activeNets, ipNet)
+	}
 
 	// Check PassivePorts format since the server library doesn't!
 	if !passivePortsRe.MatchString(opt.PassivePorts) {
@@ -199,27 +296,91 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options) (*driver, error) {
 		TLS:            d.useTLS,
 		CertFile:       d.opt.TLSCert,
 		KeyFile:        d.opt.TLSKey,
+		ExplicitFTPS:   d.opt.ExplicitTLS,
+		Commands:       d.commands(),
 		//TODO implement a maximum of https://godoc.org/goftp.io/server#ServerOpts
 	}
 	d.srv, err = ftp.NewServer(ftpopt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new FTP server: %w", err)
 	}
+	if d.opt.ImplicitTLSAddr != "" {
+		host, port, err := net.SplitHostPort(d.opt.ImplicitTLSAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse host:port from %q", d.opt.ImplicitTLSAddr)
+		}
+		implicitOpt := *ftpopt
+		implicitOpt.Hostname = host
+		implicitOpt.Port, err = strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse port number from %q", port)
+		}
+		implicitOpt.ExplicitFTPS = false
+		d.implicitSrv, err = ftp.NewServer(&implicitOpt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new implicit FTPS server: %w", err)
+		}
+	}
 	return d, nil
 }
 
-// serve runs the ftp server
+// servers returns the ftp servers in use
+func (d *driver) servers() []*ftp.Server {
+	if d.implicitSrv == nil {
+		return []*ftp.Server{d.srv}
+	}
+	return []*ftp.Server{d.srv, d.implicitSrv}
+}
+
+// serve runs the ftp servers, returning when the first one stops
 func (d *driver) serve() error {
-	fs.Logf(d.f, "Serving FTP on %s", d.srv.Hostname+":"+strconv.Itoa(d.srv.Port))
-	return d.srv.ListenAndServe()
+	servers := d.servers()
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		fs.Logf(d.f, "Serving FTP on %s", srv.Hostname+":"+strconv.Itoa(srv.Port))
+		go func(srv *ftp.Server) {
+			errs <- srv.ListenAndServe()
+		}(srv)
+	}
+	err := <-errs
+	if err != ftp.ErrServerClosed {
+		for _, srv := range servers {
+			_ = srv.Shutdown()
+		}
+	}
+	return err
+}
+
+// Addr returns the address the ftp server is serving on
+func (d *driver) Addr() string {
+	return d.srv.Hostname + ":" + strconv.Itoa(d.srv.Port)
 }
 
-// close stops the ftp server
+// Serve runs the ftp servers until they are shut down
+func (d *driver) Serve() error {
+	err := d.serve()
+	if err == ftp.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops the ftp servers
+func (d *driver) Shutdown() error {
+	return d.close()
+}
+
+// close stops the ftp servers
 //
 //lint:ignore U1000 unused when not building linux
-func (d *driver) close() error {
-	fs.Logf(d.f, "Stopping FTP on %s", d.srv.Hostname+":"+strconv.Itoa(d.srv.Port))
-	return d.srv.Shutdown()
+func (d *driver) close() (err error) {
+	for _, srv := range d.servers() {
+		fs.Logf(d.f, "Stopping FTP on %s", srv.Hostname+":"+strconv.Itoa(srv.Port))
+		if shutdownErr := srv.Shutdown(); err == nil {
+			err = shutdownErr
+		}
+	}
+	return err
 }
 
 // Logger ftp logger output formatted message
@@ -406,10 +567,14 @@ func (d *driver) DeleteFile(sctx *ftp.Context, path string) (err error) {
 	if !node.IsFile() {
 		return errors.New("not a file")
 	}
+	size := node.Size()
 	err = node.Remove()
 	if err != nil {
 		return err
 	}
+	if d.quota != nil {
+		d.quota.add(sctx.Sess.LoginUser(), -size)
+	}
 	return nil
 }
 
@@ -499,6 +664,21 @@ func (d *driver) PutFile(sctx *ftp.Context, path string, data io.Reader, offset
 		offset = -1
 	}
 
+	// Charge the upload against the user's quota
+	if d.quota != nil {
+		user := sctx.Sess.LoginUser()
+		err = d.quota.init(d.ctx, user, VFS)
+		if err != nil {
+			return 0, err
+		}
+		// Bytes overwriting the existing file aren't charged
+		var free int64
+		if offset > -1 && offset < fi.Size() {
+			free = fi.Size() - offset
+		}
+		data = d.quota.reader(user, data, free)
+	}
+
 	var f vfs.Handle
 
 	if offset == -1 {
@@ -507,6 +687,9 @@ func (d *driver) PutFile(sctx *ftp.Context, path string, data io.Reader, offset
 			if err != nil {
 				return 0, err
 			}
+			if d.quota != nil {
+				d.quota.add(sctx.Sess.LoginUser(), -fi.Size())
+			}
 		}
 		f, err = VFS.Create(path)
 		if err != nil {
@@ -12,10 +12,12 @@ import (
 	"testing"
 
 	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/rclone/rclone/cmd/serve/servetest"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/stretchr/testify/assert"
 	ftp "goftp.io/server/v2"
 )
@@ -39,7 +41,10 @@ func TestFTP(t *testing.T) {
 		opt.BasicUser = testUSER
 		opt.BasicPass = testPASS
 
-		w, err := newServer(context.Background(), f, &opt)
+		ctx := context.Background()
+		p, err := proxyflags.NewProxy(ctx)
+		assert.NoError(t, err)
+		w, err := newServer(ctx, f, &opt, &vfscommon.Opt, p)
 		assert.NoError(t, err)
 
 		quit := make(chan struct{})
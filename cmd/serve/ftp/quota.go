@@ -0,0 +1,118 @@
+//go:build !plan9
+
+package ftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/vfs"
+)
+
+// errQuotaExceeded is returned when an upload would take a user over their quota
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// quota tracks the storage used by each user
+type quota struct {
+	limit int64
+	mu    sync.Mutex
+	used  map[string]int64 // user => bytes used
+}
+
+// newQuota makes a quota allowing limit bytes per user
+func newQuota(limit int64) *quota {
+	return &quota{
+		limit: limit,
+		used:  make(map[string]int64),
+	}
+}
+
+// init counts the usage for user from the remote behind VFS if it
+// isn't known yet
+func (q *quota) init(ctx context.Context, user string, VFS *vfs.VFS) error {
+	q.mu.Lock()
+	_, ok := q.used[user]
+	q.mu.Unlock()
+	if ok {
+		return nil
+	}
+	_, size, _, err := operations.Count(ctx, VFS.Fs())
+	if err != nil {
+		return fmt.Errorf("failed to count usage for quota: %w", err)
+	}
+	fs.Debugf(user, "Quota usage %v of %v", fs.SizeSuffix(size), fs.SizeSuffix(q.limit))
+	q.mu.Lock()
+	// Another upload may have counted it in the meantime
+	if _, ok := q.used[user]; !ok {
+		q.used[user] = size
+	}
+	q.mu.Unlock()
+	return nil
+}
+
+// add adjusts the usage for user by delta bytes
+func (q *quota) add(user string, delta int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if used, ok := q.used[user]; ok {
+		used += delta
+		if used < 0 {
+			used = 0
+		}
+		q.used[user] = used
+	}
+}
+
+// charge adds n bytes to the usage for user returning
+// errQuotaExceeded if that would take them over the limit
+func (q *quota) charge(user string, n int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.used[user]+n > q.limit {
+		return errQuotaExceeded
+	}
+	q.used[user] += n
+	return nil
+}
+
+// reader wraps in so that the bytes read are charged to user, apart
+// from the first free bytes which overwrite existing data
+func (q *quota) reader(user string, in io.Reader, free int64) io.Reader {
+	return &quotaReader{
+		q:    q,
+		user: user,
+		in:   in,
+		free: free,
+	}
+}
+
+// quotaReader charges the bytes read through it to a user's quota
+type quotaReader struct {
+	q    *quota
+	user string
+	in   io.Reader
+	free int64
+}
+
+// Read bytes, returning errQuotaExceeded if they go over the quota
+func (r *quotaReader) Read(p []byte) (n int, err error) {
+	n, err = r.in.Read(p)
+	charged := int64(n)
+	if r.free > 0 {
+		if charged <= r.free {
+			r.free -= charged
+			return n, err
+		}
+		charged -= r.free
+		r.free = 0
+	}
+	if chargeErr := r.q.charge(r.user, charged); chargeErr != nil {
+		return 0, chargeErr
+	}
+	return n, err
+}
@@ -0,0 +1,45 @@
+//go:build !plan9
+
+package ftp
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaReader(t *testing.T) {
+	q := newQuota(10)
+	q.used["user"] = 4
+
+	// Under quota
+	n, err := io.Copy(io.Discard, q.reader("user", strings.NewReader("12345"), 0))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	assert.Equal(t, int64(9), q.used["user"])
+
+	// Overwritten bytes are free
+	_, err = io.Copy(io.Discard, q.reader("user", strings.NewReader("123"), 2))
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), q.used["user"])
+
+	// Over quota
+	_, err = io.Copy(io.Discard, q.reader("user", bytes.NewReader([]byte{1}), 0))
+	assert.Equal(t, errQuotaExceeded, err)
+	assert.Equal(t, int64(10), q.used["user"])
+
+	// Deleting frees space
+	q.add("user", -6)
+	assert.Equal(t, int64(4), q.used["user"])
+	q.add("user", -100)
+	assert.Equal(t, int64(0), q.used["user"])
+
+	// Unknown users aren't tracked until initialised
+	q.add("other", 5)
+	_, ok := q.used["other"]
+	assert.False(t, ok)
+}
@@ -17,8 +17,12 @@ import (
 	"github.com/rclone/rclone/cmd"
 	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
+	"github.com/rclone/rclone/cmd/serve/servelib"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/config/flags"
 	libhttp "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/lib/http/serve"
 	"github.com/rclone/rclone/lib/systemd"
@@ -30,9 +34,10 @@ import (
 
 // Options required for http server
 type Options struct {
-	Auth     libhttp.AuthConfig
-	HTTP     libhttp.Config
-	Template libhttp.TemplateConfig
+	Auth       libhttp.AuthConfig
+	HTTP       libhttp.Config
+	Template   libhttp.TemplateConfig
+	AllowWrite bool `config:"allow_write"` // allow uploads and changes from the browser
 }
 
 // DefaultOpt is the default values used for Options
@@ -45,6 +50,13 @@ var DefaultOpt = Options{
 // Opt is options set by command line flags
 var Opt = DefaultOpt
 
+// OptionsInfo describes the Options by their config names
+var OptionsInfo = libhttp.ConfigInfo.Add(libhttp.AuthConfigInfo).Add(libhttp.TemplateConfigInfo).Add(fs.Options{{
+	Name:    "allow_write",
+	Default: false,
+	Help:    "Allow uploads, new folders, renames and deletes from the browser",
+}})
+
 // flagPrefix is the prefix used to uniquely identify command line flags.
 // It is intentionally empty for this package.
 const flagPrefix = ""
@@ -54,6 +66,7 @@ func init() {
 	libhttp.AddAuthFlagsPrefix(flagSet, flagPrefix, &Opt.Auth)
 	libhttp.AddHTTPFlagsPrefix(flagSet, flagPrefix, &Opt.HTTP)
 	libhttp.AddTemplateFlagsPrefix(flagSet, flagPrefix, &Opt.Template)
+	flags.BoolVarP(flagSet, &Opt.AllowWrite, "allow-write", "", Opt.AllowWrite, "Allow uploads, new folders, renames and deletes from the browser", "")
 	vfsflags.AddFlags(flagSet)
 	proxyflags.AddFlags(flagSet)
 }
@@ -74,14 +87,44 @@ The server will log errors.  Use ` + "`-v`" + ` to see access logs.
 ` + "`--bwlimit`" + ` will be respected for file transfers.  Use ` + "`--stats`" + ` to
 control the stats printing.
 
-` + libhttp.Help(flagPrefix) + libhttp.TemplateHelp(flagPrefix) + libhttp.AuthHelp(flagPrefix) + vfs.Help() + proxy.Help,
+Directory listings are returned as JSON instead of HTML to clients
+which send ` + "`Accept: application/json`" + `, e.g.
+
+    curl -H "Accept: application/json" http://localhost:8080/dir/
+
+### Writing from the browser
+
+By default the server is read only. Use ` + "`--allow-write`" + ` to add controls
+to the directory listings to upload files, create folders, rename and
+delete. These send POST requests to the directory URL with an
+` + "`action`" + ` query parameter which may also be used by scripts:
+
+- ` + "`?action=upload`" + ` - a multipart/form-data body with the files in ` + "`file`" + ` fields
+- ` + "`?action=mkdir`" + ` - create the folder in the ` + "`name`" + ` form field
+- ` + "`?action=rename`" + ` - rename the ` + "`from`" + ` entry to ` + "`to`" + `
+- ` + "`?action=delete`" + ` - delete the file or empty folder in ` + "`name`" + `
+
+For example
+
+    curl -F file=@report.pdf "http://localhost:8080/dir/?action=upload"
+
+Uploads are streamed into the VFS and overwrite existing files. Names
+must be in the directory posted to. Browsers are redirected back to the
+listing, clients sending ` + "`Accept: application/json`" + ` get a JSON
+reply. Requests with an ` + "`Origin`" + ` header from a different host are
+refused. ` + "`--read-only`" + ` overrides this flag.
+
+Use authentication with this flag unless everyone who can reach the
+server should be able to change the files.
+
+` + libhttp.Help(flagPrefix) + libhttp.TemplateHelp(flagPrefix) + libhttp.AuthHelp(flagPrefix) + vfs.Help() + proxy.Help + proxy.AuthHelp,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.39",
 		"groups":            "Filter",
 	},
 	Run: func(command *cobra.Command, args []string) {
 		var f fs.Fs
-		if proxyflags.Opt.AuthProxy == "" {
+		if !proxyflags.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
@@ -89,7 +132,12 @@ control the stats printing.
 		}
 
 		cmd.Run(false, true, command, func() error {
-			s, err := run(context.Background(), f, Opt)
+			ctx := context.Background()
+			p, err := proxyflags.NewProxy(ctx)
+			if err != nil {
+				fs.Fatal(nil, fmt.Sprint(err))
+			}
+			s, err := run(ctx, f, Opt, &vfscommon.Opt, p)
 			if err != nil {
 				fs.Fatal(nil, fmt.Sprint(err))
 			}
@@ -101,6 +149,42 @@ control the stats printing.
 	},
 }
 
+func init() {
+	servelib.Register("http", func(ctx context.Context, f fs.Fs, in configmap.Getter, vfsOpt *vfscommon.Options, p *proxy.Proxy) (servelib.Handle, error) {
+		opt := Opt
+		err := configstruct.Set(in, &opt)
+		if err != nil {
+			return nil, err
+		}
+		s, err := run(ctx, f, opt, vfsOpt, p)
+		if err != nil {
+			return nil, err
+		}
+		return handle{s}, nil
+	}, OptionsInfo)
+}
+
+// handle adapts a running HTTP to servelib.Handle
+type handle struct {
+	*HTTP
+}
+
+// Addr returns the URLs the server is serving on
+func (h handle) Addr() string {
+	return strings.Join(h.server.URLs(), ", ")
+}
+
+// Serve blocks until the server is shut down
+func (h handle) Serve() error {
+	h.server.Wait()
+	return nil
+}
+
+// Shutdown stops the server
+func (h handle) Shutdown() error {
+	return h.server.Shutdown()
+}
+
 // HTTP contains everything to run the server
 type HTTP struct {
 	f      fs.Fs
@@ -136,19 +220,21 @@ func (s *HTTP) auth(user, pass string) (value interface{}, err error) {
 	return VFS, err
 }
 
-func run(ctx context.Context, f fs.Fs, opt Options) (s *HTTP, err error) {
+// run starts serving f, or the users of p if set, in the background
+func run(ctx context.Context, f fs.Fs, opt Options, vfsOpt *vfscommon.Options, p *proxy.Proxy) (s *HTTP, err error) {
 	s = &HTTP{
 		f:   f,
 		ctx: ctx,
 		opt: opt,
 	}
 
-	if proxyflags.Opt.AuthProxy != "" {
-		s.proxy = proxy.New(ctx, &proxyflags.Opt)
+	if p != nil {
+		s.proxy = p
 		// override auth
 		s.opt.Auth.CustomAuthFn = s.auth
+		s.opt.Auth.CustomAuthHeaderFn = p.AuthHeaderFn()
 	} else {
-		s._vfs = vfs.New(f, &vfscommon.Opt)
+		s._vfs = vfs.New(f, vfsOpt)
 	}
 
 	s.server, err = libhttp.NewServer(ctx,
@@ -167,6 +253,9 @@ func run(ctx context.Context, f fs.Fs, opt Options) (s *HTTP, err error) {
 	)
 	router.Get("/*", s.handler)
 	router.Head("/*", s.handler)
+	if s.opt.AllowWrite {
+		router.Post("/*", s.postHandler)
+	}
 
 	s.server.Serve()
 
@@ -215,6 +304,7 @@ func (s *HTTP) serveDir(w http.ResponseWriter, r *http.Request, dirRemote string
 
 	// Make the entries for display
 	directory := serve.NewDirectory(dirRemote, s.server.HTMLTemplate())
+	directory.Writable = s.opt.AllowWrite && !VFS.Opt.ReadOnly
 	for _, node := range dirEntries {
 		if vfscommon.Opt.NoModTime {
 			directory.AddHTMLEntry(node.Path(), node.IsDir(), node.Size(), time.Time{})
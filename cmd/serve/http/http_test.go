@@ -1,10 +1,14 @@
 package http
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"flag"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,6 +20,7 @@ import (
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/filter"
 	libhttp "github.com/rclone/rclone/lib/http"
+	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -44,7 +49,9 @@ func start(ctx context.Context, t *testing.T, f fs.Fs) (s *HTTP, testURL string)
 		opts.Auth.BasicPass = testPass
 	}
 
-	s, err := run(ctx, f, opts)
+	p, err := proxyflags.NewProxy(ctx)
+	require.NoError(t, err)
+	s, err = run(ctx, f, opts, &vfscommon.Opt, p)
 	require.NoError(t, err, "failed to start server")
 
 	urls := s.server.URLs()
@@ -267,3 +274,151 @@ func TestGET(t *testing.T) {
 func TestAuthProxy(t *testing.T) {
 	testGET(t, true)
 }
+
+func TestWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "old.txt"), []byte("old"), 0666))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+
+	opt := DefaultOpt
+	opt.HTTP.ListenAddr = []string{testBindAddress}
+	opt.AllowWrite = true
+	s, err := run(ctx, f, opt, &vfscommon.Opt, nil)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, s.server.Shutdown())
+	}()
+	testURL := s.server.URLs()[0]
+
+	post := func(query string, contentType string, body io.Reader, origin string) (int, string) {
+		req, err := http.NewRequest("POST", testURL+query, body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", "application/json")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+	form := func(query string, values url.Values) (int, string) {
+		return post(query, "application/x-www-form-urlencoded", strings.NewReader(values.Encode()), "")
+	}
+	upload := func(query string, files map[string]string) (int, string) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for name, contents := range files {
+			w, err := mw.CreateFormFile("file", name)
+			require.NoError(t, err)
+			_, err = w.Write([]byte(contents))
+			require.NoError(t, err)
+		}
+		require.NoError(t, mw.Close())
+		return post(query, mw.FormDataContentType(), &buf, "")
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	// Upload
+	code, body := upload("?action=upload", map[string]string{"a.txt": "AAA", `C:\Users\me\b.txt`: "BB"})
+	assert.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, `"upload"`)
+	got, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "AAA", string(got))
+	assert.True(t, exists("b.txt"))
+
+	// Create folder then upload into it
+	code, body = form("?action=mkdir", url.Values{"name": {"sub"}})
+	assert.Equal(t, http.StatusOK, code, body)
+	assert.True(t, exists("sub"))
+	code, body = upload("sub/?action=upload", map[string]string{"c.txt": "C"})
+	assert.Equal(t, http.StatusOK, code, body)
+	assert.True(t, exists("sub/c.txt"))
+
+	// HTML listing has the controls
+	resp, err := http.Get(testURL)
+	require.NoError(t, err)
+	html, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Contains(t, string(html), `action="?action=upload"`)
+	assert.Contains(t, string(html), `<input type="hidden" name="name" value="sub">`)
+
+	// JSON listing
+	req, err := http.NewRequest("GET", testURL+"sub/", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	var listing struct {
+		Entries []struct {
+			Name string `json:"name"`
+			Size int64  `json:"size"`
+		} `json:"entries"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&listing))
+	_ = resp.Body.Close()
+	require.Len(t, listing.Entries, 1)
+	assert.Equal(t, "c.txt", listing.Entries[0].Name)
+	assert.Equal(t, int64(1), listing.Entries[0].Size)
+
+	// Rename and delete
+	code, body = form("?action=rename", url.Values{"from": {"a.txt"}, "to": {"renamed.txt"}})
+	assert.Equal(t, http.StatusOK, code, body)
+	assert.False(t, exists("a.txt"))
+	assert.True(t, exists("renamed.txt"))
+	code, body = form("?action=delete", url.Values{"name": {"old.txt"}})
+	assert.Equal(t, http.StatusOK, code, body)
+	assert.False(t, exists("old.txt"))
+
+	// Errors
+	for _, test := range []struct {
+		name   string
+		query  string
+		values url.Values
+		want   int
+	}{
+		{"UnknownAction", "?action=potato", nil, http.StatusBadRequest},
+		{"BadName", "?action=mkdir", url.Values{"name": {"../escape"}}, http.StatusBadRequest},
+		{"BadRename", "?action=rename", url.Values{"from": {"b.txt"}, "to": {"sub/b.txt"}}, http.StatusBadRequest},
+		{"DeleteNotFound", "?action=delete", url.Values{"name": {"notfound.txt"}}, http.StatusNotFound},
+		{"DeleteNotEmpty", "?action=delete", url.Values{"name": {"sub"}}, http.StatusConflict},
+		{"DirNotFound", "notfound/?action=mkdir", url.Values{"name": {"x"}}, http.StatusNotFound},
+		{"NotADir", "b.txt?action=delete", url.Values{"name": {"x"}}, http.StatusMethodNotAllowed},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			code, body := form(test.query, test.values)
+			assert.Equal(t, test.want, code, body)
+		})
+	}
+	assert.False(t, exists("../escape"))
+
+	code, _ = post("?action=delete", "application/x-www-form-urlencoded", strings.NewReader("name=b.txt"), "http://evil.example.com")
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.True(t, exists("b.txt"))
+
+	// Browsers are redirected back to the listing
+	req, err = http.NewRequest("POST", testURL+"?action=mkdir", strings.NewReader("name=sub2"))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	assert.Equal(t, "/", resp.Header.Get("Location"))
+	assert.True(t, exists("sub2"))
+}
@@ -0,0 +1,195 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/http/serve"
+	"github.com/rclone/rclone/vfs"
+)
+
+// errBadRequest is returned for requests which are malformed
+var errBadRequest = errors.New("bad request")
+
+// checkName checks name is a single path element
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return fmt.Errorf("%w: invalid name %q", errBadRequest, name)
+	}
+	return nil
+}
+
+// checkOrigin refuses cross site requests so that pages on other
+// sites can't use the browser's credentials to change files
+func checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != r.Host {
+		return fmt.Errorf("cross origin request from %q refused", origin)
+	}
+	return nil
+}
+
+// postHandler carries out the action in the query of a POST to a
+// directory when --allow-write is set
+func (s *HTTP) postHandler(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Error(w, "Can only POST to a directory", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := checkOrigin(r); err != nil {
+		fs.Infof(nil, "%s: %v", r.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	dirRemote := strings.Trim(r.URL.Path, "/")
+	VFS, err := s.getVFS(r.Context())
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to write to directory: %v", err)
+		return
+	}
+	node, err := VFS.Stat(dirRemote)
+	if err == nil && !node.IsDir() {
+		err = vfs.ENOENT
+	}
+	if err != nil {
+		s.writeError(w, r, dirRemote, err)
+		return
+	}
+
+	action := r.URL.Query().Get("action")
+	var names []string
+	switch action {
+	case "upload":
+		names, err = s.upload(VFS, dirRemote, r)
+	case "mkdir":
+		name := r.FormValue("name")
+		names = []string{name}
+		if err = checkName(name); err == nil {
+			err = VFS.Mkdir(path.Join(dirRemote, name), 0777)
+		}
+	case "rename":
+		from, to := r.FormValue("from"), r.FormValue("to")
+		names = []string{from, to}
+		if err = checkName(from); err == nil {
+			if err = checkName(to); err == nil {
+				err = VFS.Rename(path.Join(dirRemote, from), path.Join(dirRemote, to))
+			}
+		}
+	case "delete":
+		name := r.FormValue("name")
+		names = []string{name}
+		if err = checkName(name); err == nil {
+			err = VFS.Remove(path.Join(dirRemote, name))
+		}
+	default:
+		http.Error(w, fmt.Sprintf("Unknown action %q", action), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.writeError(w, r, dirRemote, err)
+		return
+	}
+	fs.Infof(dirRemote, "%s: %s %q", r.RemoteAddr, action, names)
+
+	if serve.AcceptsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(map[string]interface{}{
+			"action": action,
+			"names":  names,
+		})
+		if err != nil {
+			fs.Errorf(dirRemote, "Failed to write reply: %v", err)
+		}
+		return
+	}
+	// Send browsers back to the listing
+	http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+}
+
+// upload streams the files in the multipart form in r into dirRemote
+// returning their names
+func (s *HTTP) upload(VFS *vfs.VFS, dirRemote string, r *http.Request) (names []string, err error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return names, err
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			continue
+		}
+		// Some browsers send the full path of the file
+		name := path.Base(strings.ReplaceAll(part.FileName(), "\\", "/"))
+		if err := checkName(name); err != nil {
+			return names, err
+		}
+		remote := path.Join(dirRemote, name)
+		err = s.uploadFile(VFS, remote, part)
+		if err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: no files in upload", errBadRequest)
+	}
+	return names, nil
+}
+
+// uploadFile copies in to remote, removing it if the copy fails
+func (s *HTTP) uploadFile(VFS *vfs.VFS, remote string, in io.Reader) error {
+	fd, err := VFS.OpenFile(remote, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fd, in)
+	closeErr := fd.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fs.Errorf(remote, "Upload failed: %v", err)
+		if removeErr := VFS.Remove(remote); removeErr != nil && !errors.Is(removeErr, vfs.ENOENT) {
+			fs.Errorf(remote, "Failed to remove partial upload: %v", removeErr)
+		}
+	}
+	return err
+}
+
+// writeError sends the status code for err from a write
+func (s *HTTP) writeError(w http.ResponseWriter, r *http.Request, remote string, err error) {
+	var code int
+	switch {
+	case errors.Is(err, errBadRequest):
+		code = http.StatusBadRequest
+	case errors.Is(err, vfs.ENOENT):
+		code = http.StatusNotFound
+	case errors.Is(err, vfs.EEXIST), errors.Is(err, vfs.ENOTEMPTY):
+		code = http.StatusConflict
+	case errors.Is(err, vfs.EROFS), errors.Is(err, vfs.EPERM):
+		code = http.StatusForbidden
+	default:
+		serve.Error(r.Context(), remote, w, "Failed to write", err)
+		return
+	}
+	fs.Infof(remote, "%s: write failed: %v", r.RemoteAddr, err)
+	http.Error(w, err.Error(), code)
+}
@@ -0,0 +1,147 @@
+// Package multi implements "rclone serve multi" which runs several
+// servers sharing one VFS from a config file
+package multi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/cmd/serve/servelib"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/systemd"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfsflags"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	vfsflags.AddFlags(Command.Flags())
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "multi config.yaml",
+	Short: `Serve remotes over several protocols at once.`,
+	Long: `Run several servers, e.g. WebDAV, S3, SFTP and HTTP, in one rclone
+process as described by a YAML or JSON config file.
+
+Servers serving the same remote share a single VFS so they share its
+cache and the state of any files waiting to be written back. Instead
+of running one rclone serve process per protocol with one cache each,
+run:
+
+    rclone serve multi config.yaml
+
+The config file looks like this:
+
+    # Remote served by listeners which don't set their own
+    remote: "remote:path"
+    # VFS options shared by all listeners using the names of the
+    # --vfs-* and other VFS flags with _ instead of -
+    vfs:
+      vfs_cache_mode: full
+      dir_cache_time: 5m
+    listeners:
+      - type: webdav
+        options:
+          addr: ":8080"
+          user: me
+          pass: secret
+      - type: s3
+        options:
+          addr: ":8081"
+          auth_key: ACCESS_KEY_ID,SECRET_ACCESS_KEY
+      - type: sftp
+        options:
+          addr: ":2022"
+          user: me
+          pass: secret
+      - type: http
+        remote: "other:public"
+        options:
+          addr: ":8082"
+
+The type of each listener is the name of the rclone serve command,
+e.g. ` + "`webdav`, `s3`, `sftp`, `http`, `ftp`, `nfs` or `dlna`" + `. The options are
+those of the command using the flag name with _ instead of -, e.g.
+` + "`addr`" + ` for ` + "`--addr`" + `. Options not set in the file take
+their default values. The VFS options given on the command line are
+used as the defaults for the ` + "`vfs`" + ` section.
+
+Instead of the authentication options of each listener a single set
+of users may be shared by all of them:
+
+    users:
+      - user: alice
+        pass: secret1
+        remote: "remote:alice"
+      - user: bob
+        pass: secret2
+        # remote defaults to the top level remote
+
+Or an auth proxy program may be shared by all of them by setting
+` + "`auth_proxy: /path/to/program`" + `, see the Auth Proxy section of
+the help of the individual serve commands. Users logging in over any
+protocol then share the same VFS for their remote.
+
+Or users may be checked against an OpenID Connect provider or an LDAP
+server, using the names of the ` + "`--auth-*`" + ` flags with _ instead
+of -:
+
+    auth:
+      auth_ldap_url: ldaps://ldap.example.com
+      auth_ldap_bind_dn: uid={user},ou=people,dc=example,dc=com
+      auth_remote: "remote:home/{user}"
+
+The same config can be given to the ` + "`serve/start`" + ` remote
+control call as a JSON object in its ` + "`config`" + ` parameter.
+
+` + vfs.Help(),
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.69",
+		"groups":            "Filter",
+	},
+	RunE: func(command *cobra.Command, args []string) error {
+		cmd.CheckArgs(1, 1, command, args)
+		c, err := servelib.ReadConfig(args[0])
+		if err != nil {
+			return err
+		}
+		cmd.Run(false, true, command, func() error {
+			return run(context.Background(), c)
+		})
+		return nil
+	},
+}
+
+// run starts the servers in c and waits for any of them to stop
+func run(ctx context.Context, c *servelib.Config) error {
+	servers, err := c.Start(ctx)
+	if err != nil {
+		return err
+	}
+	defer systemd.Notify()()
+
+	// Wait for the first server to stop then stop the rest
+	stopped := make(chan *servelib.Server, len(servers))
+	for _, s := range servers {
+		go func(s *servelib.Server) {
+			<-s.Done()
+			stopped <- s
+		}(s)
+	}
+	first := <-stopped
+	err = first.Wait()
+	if err == nil {
+		err = errors.New(first.Type + " server on " + first.Addr + " stopped")
+	}
+	for _, s := range servers {
+		if s != first {
+			if shutdownErr := s.Shutdown(); shutdownErr != nil {
+				fs.Errorf(nil, "Failed to stop %s server on %s: %v", s.Type, s.Addr, shutdownErr)
+			}
+		}
+	}
+	return err
+}
@@ -11,10 +11,16 @@ package nfs
 
 import (
 	"context"
+	"errors"
 	"strings"
+	"sync/atomic"
 
 	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/cmd/serve/servelib"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/rclone/rclone/fs/config/flags"
 	"github.com/rclone/rclone/vfs"
 	"github.com/rclone/rclone/vfs/vfscommon"
@@ -44,6 +50,47 @@ var OptionsInfo = fs.Options{{
 
 func init() {
 	fs.RegisterGlobalOptions(fs.OptionsInfo{Name: "nfs", Opt: &Opt, Options: OptionsInfo})
+	servelib.Register("nfs", func(ctx context.Context, f fs.Fs, in configmap.Getter, vfsOpt *vfscommon.Options, p *proxy.Proxy) (servelib.Handle, error) {
+		if p != nil {
+			return nil, errors.New("auth proxy not supported by nfs")
+		}
+		opt := Opt
+		err := configstruct.Set(in, &opt)
+		if err != nil {
+			return nil, err
+		}
+		s, err := NewServer(ctx, vfs.New(f, vfsOpt), &opt)
+		if err != nil {
+			return nil, err
+		}
+		return &handle{Server: s}, nil
+	}, OptionsInfo)
+}
+
+// handle adapts a Server to servelib.Handle
+type handle struct {
+	*Server
+	stopped atomic.Bool // set when Shutdown is called
+}
+
+// Addr returns the address the server is serving on
+func (h *handle) Addr() string {
+	return h.Server.Addr().String()
+}
+
+// Serve runs the server until it is shut down
+func (h *handle) Serve() error {
+	err := h.Server.Serve()
+	if h.stopped.Load() {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops the server
+func (h *handle) Shutdown() error {
+	h.stopped.Store(true)
+	return h.Server.Shutdown()
 }
 
 type handleCache = fs.Enum[handleCacheChoices]
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// AuthHelp contains text describing the built in authenticators
+var AuthHelp = strings.ReplaceAll(`### OpenID Connect and LDAP authentication
+
+Instead of an auth proxy program rclone can check logins itself
+against an OpenID Connect provider or an LDAP server and choose the
+backend to serve each user from their name.
+
+Use |--auth-remote| to set the remote to serve the users with |{user}|
+replaced by the user name, for example |--auth-remote remote:home/{user}|.
+User names containing |/|, |\|, |:| or control characters or which
+are |.| or |..| are rejected.
+
+#### OpenID Connect
+
+Set |--auth-jwks| to a file or an |https://| URL containing the JSON
+Web Key Set of the provider, for example
+|https://example.com/.well-known/jwks.json|. Clients then log in with
+a JWT issued by the provider, either as an |Authorization: Bearer|
+header or as the password, in which case the user name is ignored.
+For |serve s3| use the token as the access key ID.
+
+The token must be signed by one of the keys in the set and must not
+have expired. The keys are read again if a token signed with an
+unknown key arrives, and every hour if they came from a URL.
+
+- |--auth-jwt-issuer| - the |iss| claim the tokens must have
+- |--auth-jwt-audience| - the |aud| claim the tokens must have
+- |--auth-jwt-user-claim| - the claim containing the user name (default |sub|)
+- |--auth-jwt-remote-claim| - if set, serve the remote in this claim instead of |--auth-remote|
+
+#### LDAP
+
+Set |--auth-ldap-url| to the server, e.g. |ldaps://ldap.example.com|,
+and |--auth-ldap-bind-dn| to the DN to bind as with |{user}| replaced
+by the escaped user name, for example
+|uid={user},ou=people,dc=example,dc=com|. A user is logged in if the
+bind with their password succeeds. Use |--auth-ldap-start-tls| to
+upgrade an |ldap://| connection with StartTLS.
+
+LDAP needs a password so it can't be used with |serve s3| or with
+SFTP public keys.
+
+As with the auth proxy, results are cached per user for 5 minutes.
+
+`, "|", "`")
+
+// NewFromOptions makes the proxy configured by opt, either running
+// the auth proxy program or using one of the built in
+// authenticators. It returns nil if opt doesn't configure a proxy.
+//
+// The VFSes made for users are created with vfsOpt.
+func NewFromOptions(ctx context.Context, opt *Options, vfsOpt *vfscommon.Options) (*Proxy, error) {
+	n := 0
+	for _, set := range []string{opt.AuthProxy, opt.JWKS, opt.LDAPURL} {
+		if set != "" {
+			n++
+		}
+	}
+	switch {
+	case n == 0:
+		return nil, nil
+	case n > 1:
+		return nil, errors.New("only one of --auth-proxy, --auth-jwks and --auth-ldap-url can be used")
+	case opt.AuthProxy != "":
+		return New(ctx, opt, vfsOpt), nil
+	case opt.JWKS != "":
+		return newJWT(ctx, opt, vfsOpt)
+	default:
+		return newLDAP(ctx, opt, vfsOpt)
+	}
+}
+
+// checkUser checks user is safe to use in a remote or DN template
+func checkUser(user string) error {
+	if user == "" || user == "." || user == ".." {
+		return fmt.Errorf("invalid user name %q", user)
+	}
+	for _, c := range user {
+		if c == '/' || c == '\\' || c == ':' || c < ' ' || c == 0x7f {
+			return fmt.Errorf("invalid user name %q", user)
+		}
+	}
+	return nil
+}
+
+// userRemote returns the Fs from the remote template for user
+func userRemote(ctx context.Context, template, user string) (fs.Fs, error) {
+	if err := checkUser(user); err != nil {
+		return nil, err
+	}
+	return cache.Get(ctx, strings.ReplaceAll(template, "{user}", user))
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFromOptions(t *testing.T) {
+	ctx := context.Background()
+
+	p, err := NewFromOptions(ctx, &DefaultOpt, &vfscommon.Opt)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	opt := DefaultOpt
+	opt.AuthProxy = "prog"
+	p, err = NewFromOptions(ctx, &opt, &vfscommon.Opt)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"prog"}, p.cmdLine)
+	// The auth proxy program is only given users and passwords
+	assert.Nil(t, p.AuthHeaderFn())
+
+	for _, test := range []struct {
+		name   string
+		opt    Options
+		errMsg string
+	}{
+		{"TwoAuths", Options{AuthProxy: "prog", LDAPURL: "ldap://localhost"}, "only one of"},
+		{"JWTNoRemote", Options{JWKS: "jwks.json"}, "need --auth-remote"},
+		{"JWTNoFile", Options{JWKS: "/notfound/jwks.json", AuthRemote: "remote:"}, "failed to read JWKS"},
+		{"LDAPNoRemote", Options{LDAPURL: "ldap://localhost"}, "need --auth-remote"},
+		{"LDAPNoUser", Options{LDAPURL: "ldap://localhost", AuthRemote: "remote:", LDAPBindDN: "cn=admin"}, "must contain {user}"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.True(t, test.opt.Enabled())
+			_, err := NewFromOptions(ctx, &test.opt, &vfscommon.Opt)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.errMsg)
+		})
+	}
+}
+
+func TestCheckUser(t *testing.T) {
+	for _, user := range []string{"alice", "alice.smith", "alice@example.com", "Álvaro"} {
+		assert.NoError(t, checkUser(user), user)
+	}
+	for _, user := range []string{"", ".", "..", "a/b", `a\b`, "a:b", "a\nb", "a\x00b"} {
+		assert.Error(t, checkUser(user), user)
+	}
+}
@@ -0,0 +1,338 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/fshttp"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+const (
+	jwksMaxAge      = time.Hour   // how long keys read from a URL are used for
+	jwksMinInterval = time.Minute // minimum time between reads for unknown keys
+)
+
+// jwtMethods are the signing methods accepted, all asymmetric
+var jwtMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// jwk is a single JSON Web Key as described in RFC 7517
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes the key into an *rsa.PublicKey,
+// *ecdsa.PublicKey or ed25519.PublicKey
+func (k *jwk) publicKey() (interface{}, error) {
+	decode := func(s string) ([]byte, error) {
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("bad n: %w", err)
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("bad e: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("exponent too large")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("bad x: %w", err)
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("bad y: %w", err)
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point not on curve")
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("bad x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("bad Ed25519 key length")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// keySet is a JSON Web Key Set read from a file or URL
+type keySet struct {
+	src    string
+	client *http.Client // set if src is a URL
+	mu     sync.Mutex
+	keys   map[string]interface{} // public keys by kid
+	read   time.Time              // when the keys were last read
+}
+
+// newKeySet reads the key set from src
+func newKeySet(ctx context.Context, src string) (*keySet, error) {
+	ks := &keySet{src: src}
+	if strings.HasPrefix(src, "https://") || strings.HasPrefix(src, "http://") {
+		ks.client = fshttp.NewClient(ctx)
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	err := ks.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// load reads the keys from the source - call with mu held
+func (ks *keySet) load(ctx context.Context) error {
+	var data []byte
+	var err error
+	if ks.client != nil {
+		data, err = ks.fetch(ctx)
+	} else {
+		data, err = os.ReadFile(ks.src)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS %q: %w", ks.src, err)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err = json.Unmarshal(data, &set)
+	if err != nil {
+		return fmt.Errorf("failed to parse JWKS %q: %w", ks.src, err)
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for i := range set.Keys {
+		k := &set.Keys[i]
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			fs.Errorf(nil, "JWKS %q: ignoring key %q: %v", ks.src, k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no usable keys found in JWKS %q", ks.src)
+	}
+	ks.keys = keys
+	ks.read = time.Now()
+	fs.Debugf(nil, "Read %d keys from JWKS %q", len(keys), ks.src)
+	return nil
+}
+
+// fetch reads the key set from the URL
+func (ks *keySet) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", ks.src, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP error: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// key returns the public key with kid, reading the key set again if
+// it isn't found or is too old
+func (ks *keySet) key(ctx context.Context, kid string) (interface{}, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	key, found := ks.lookup(kid)
+	age := time.Since(ks.read)
+	if (!found && age > jwksMinInterval) || (ks.client != nil && age > jwksMaxAge) {
+		err := ks.load(ctx)
+		if err != nil {
+			fs.Errorf(nil, "%v", err)
+		} else {
+			key, found = ks.lookup(kid)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// lookup finds the key with kid - if kid is empty then the only key
+// is used - call with mu held
+func (ks *keySet) lookup(kid string) (key interface{}, found bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key = range ks.keys {
+			return key, true
+		}
+	}
+	key, found = ks.keys[kid]
+	return key, found
+}
+
+// jwtAuth checks JWTs against a key set
+type jwtAuth struct {
+	opt    Options
+	keys   *keySet
+	parser *jwt.Parser
+}
+
+// newJWT makes a proxy which authenticates users with JWTs
+func newJWT(ctx context.Context, opt *Options, vfsOpt *vfscommon.Options) (*Proxy, error) {
+	if opt.AuthRemote == "" && opt.JWTRemoteClaim == "" {
+		return nil, errors.New("need --auth-remote or --auth-jwt-remote-claim with --auth-jwks")
+	}
+	keys, err := newKeySet(ctx, opt.JWKS)
+	if err != nil {
+		return nil, err
+	}
+	a := &jwtAuth{
+		opt:    *opt,
+		keys:   keys,
+		parser: jwt.NewParser(jwt.WithValidMethods(jwtMethods)),
+	}
+	if a.opt.JWTUserClaim == "" {
+		a.opt.JWTUserClaim = "sub"
+	}
+	p := NewFromCheckFn(ctx, a.check, a.auth, vfsOpt)
+	p.bearer = true
+	return p, nil
+}
+
+// parseBearer reads the token from an "Authorization: Bearer" header
+// returning it as auth with an empty user
+func parseBearer(header string) (user, auth string, ok bool) {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", "", false
+	}
+	return "", token, true
+}
+
+// AuthHeaderFn returns the function the HTTP servers should use to
+// read the auth from Authorization headers which aren't Basic auth,
+// or nil if the proxy only takes a user and password.
+//
+// Only JWT authentication takes "Authorization: Bearer" headers.
+func (p *Proxy) AuthHeaderFn() func(header string) (user, auth string, ok bool) {
+	if !p.bearer {
+		return nil
+	}
+	return parseBearer
+}
+
+// claims checks the token returning its claims
+func (a *jwtAuth) claims(ctx context.Context, token string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.keys.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("invalid token: no exp claim")
+	}
+	if a.opt.JWTIssuer != "" && !claims.VerifyIssuer(a.opt.JWTIssuer, true) {
+		return nil, errors.New("invalid token: wrong issuer")
+	}
+	if a.opt.JWTAudience != "" && !claims.VerifyAudience(a.opt.JWTAudience, true) {
+		return nil, errors.New("invalid token: wrong audience")
+	}
+	return claims, nil
+}
+
+// claim reads a string claim which must be present
+func claim(claims jwt.MapClaims, name string) (string, error) {
+	value, ok := claims[name].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("invalid token: no %q claim", name)
+	}
+	return value, nil
+}
+
+// check is a CheckFn which checks the token in auth, ignoring user,
+// and returns the user from its claims
+func (a *jwtAuth) check(ctx context.Context, user, auth string, isPublicKey bool) (string, error) {
+	if isPublicKey {
+		return "", errors.New("public keys can't be used with JWT authentication")
+	}
+	claims, err := a.claims(ctx, auth)
+	if err != nil {
+		return "", err
+	}
+	user, err = claim(claims, a.opt.JWTUserClaim)
+	if err != nil {
+		return "", err
+	}
+	return user, checkUser(user)
+}
+
+// auth is an AuthFn which returns the Fs for the user of the token
+func (a *jwtAuth) auth(ctx context.Context, user, auth string, isPublicKey bool) (fs.Fs, error) {
+	if a.opt.JWTRemoteClaim == "" {
+		return userRemote(ctx, a.opt.AuthRemote, user)
+	}
+	claims, err := a.claims(ctx, auth)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := claim(claims, a.opt.JWTRemoteClaim)
+	if err != nil {
+		return nil, err
+	}
+	return cache.Get(ctx, remote)
+}
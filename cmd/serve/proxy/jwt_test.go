@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeJWKS returns a JWKS containing the public key of key with kid
+func makeJWKS(t *testing.T, kid string, key *rsa.PrivateKey) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	require.NoError(t, err)
+	return data
+}
+
+// makeToken signs claims with key
+func makeToken(t *testing.T, kid string, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func TestJWT(t *testing.T) {
+	ctx := context.Background()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(jwksPath, makeJWKS(t, "key1", key), 0666))
+
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "alice"), 0777))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "bob"), 0777))
+
+	opt := DefaultOpt
+	opt.JWKS = jwksPath
+	opt.JWTIssuer = "https://issuer.example.com"
+	opt.JWTAudience = "rclone"
+	opt.AuthRemote = filepath.Join(root, "{user}")
+	p, err := NewFromOptions(ctx, &opt, &vfscommon.Opt)
+	require.NoError(t, err)
+
+	t.Run("Bearer", func(t *testing.T) {
+		parse := p.AuthHeaderFn()
+		require.NotNil(t, parse)
+		user, auth, ok := parse("Bearer token")
+		assert.True(t, ok)
+		assert.Equal(t, "", user)
+		assert.Equal(t, "token", auth)
+		_, _, ok = parse("Basic dXNlcjpwYXNz")
+		assert.False(t, ok)
+		_, _, ok = parse("Bearer ")
+		assert.False(t, ok)
+	})
+
+	claims := func(user string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub": user,
+			"iss": opt.JWTIssuer,
+			"aud": opt.JWTAudience,
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	t.Run("Good", func(t *testing.T) {
+		VFS, vfsKey, err := p.Call("ignored", makeToken(t, "key1", key, claims("alice")), false)
+		require.NoError(t, err)
+		assert.Equal(t, "alice", vfsKey)
+		assert.Equal(t, filepath.Join(root, "alice"), VFS.Fs().Root())
+		assert.Equal(t, VFS, p.Get("alice"))
+
+		// A new token for the same user gets the same VFS
+		c := claims("alice")
+		c["exp"] = time.Now().Add(2 * time.Hour).Unix()
+		VFS2, _, err := p.Call("", makeToken(t, "key1", key, c), false)
+		require.NoError(t, err)
+		assert.Equal(t, VFS, VFS2)
+
+		VFS, vfsKey, err = p.Call("", makeToken(t, "key1", key, claims("bob")), false)
+		require.NoError(t, err)
+		assert.Equal(t, "bob", vfsKey)
+		assert.Equal(t, filepath.Join(root, "bob"), VFS.Fs().Root())
+	})
+
+	for _, test := range []struct {
+		name   string
+		token  func() string
+		errMsg string
+	}{
+		{"Expired", func() string {
+			c := claims("alice")
+			c["exp"] = time.Now().Add(-time.Hour).Unix()
+			return makeToken(t, "key1", key, c)
+		}, "expired"},
+		{"NoExpiry", func() string {
+			c := claims("alice")
+			delete(c, "exp")
+			return makeToken(t, "key1", key, c)
+		}, "no exp claim"},
+		{"WrongIssuer", func() string {
+			c := claims("alice")
+			c["iss"] = "potato"
+			return makeToken(t, "key1", key, c)
+		}, "wrong issuer"},
+		{"WrongAudience", func() string {
+			c := claims("alice")
+			c["aud"] = "potato"
+			return makeToken(t, "key1", key, c)
+		}, "wrong audience"},
+		{"WrongKey", func() string {
+			return makeToken(t, "key1", otherKey, claims("alice"))
+		}, "verification error"},
+		{"UnknownKey", func() string {
+			return makeToken(t, "key2", key, claims("alice"))
+		}, "unknown key"},
+		{"HMAC", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims("alice"))
+			s, err := token.SignedString([]byte("secret"))
+			require.NoError(t, err)
+			return s
+		}, "signing method HS256 is invalid"},
+		{"NoUser", func() string {
+			c := claims("alice")
+			delete(c, "sub")
+			return makeToken(t, "key1", key, c)
+		}, `no "sub" claim`},
+		{"BadUser", func() string {
+			return makeToken(t, "key1", key, claims("../alice"))
+		}, "invalid user name"},
+		{"Garbage", func() string {
+			return "potato"
+		}, "invalid token"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := p.Call("alice", test.token(), false)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.errMsg)
+		})
+	}
+
+	t.Run("PublicKey", func(t *testing.T) {
+		_, _, err := p.Call("alice", "AAAA", true)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "public keys")
+	})
+
+	t.Run("RemoteClaim", func(t *testing.T) {
+		opt := opt
+		opt.AuthRemote = ""
+		opt.JWTRemoteClaim = "remote"
+		p, err := NewFromOptions(ctx, &opt, &vfscommon.Opt)
+		require.NoError(t, err)
+		c := claims("carol")
+		c["remote"] = filepath.Join(root, "bob")
+		VFS, vfsKey, err := p.Call("", makeToken(t, "key1", key, c), false)
+		require.NoError(t, err)
+		assert.Equal(t, "carol", vfsKey)
+		assert.Equal(t, filepath.Join(root, "bob"), VFS.Fs().Root())
+	})
+}
+
+func TestJWKSURL(t *testing.T) {
+	ctx := context.Background()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwks := makeJWKS(t, "key1", key)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(jwks)
+	}))
+	defer ts.Close()
+
+	ks, err := newKeySet(ctx, ts.URL)
+	require.NoError(t, err)
+	got, err := ks.key(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, &key.PublicKey, got)
+
+	// With only one key it is used if there is no kid
+	got, err = ks.key(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, &key.PublicKey, got)
+
+	_, err = ks.key(ctx, "key2")
+	assert.Error(t, err)
+
+	_, err = newKeySet(ctx, ts.URL+"/notfound\x00")
+	assert.Error(t, err)
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// ldapTimeout is the timeout for connecting to the LDAP server
+const ldapTimeout = 30 * time.Second
+
+// ldapConn is the part of *ldap.Conn used to check passwords
+type ldapConn interface {
+	StartTLS(config *tls.Config) error
+	Bind(username, password string) error
+	SetTimeout(timeout time.Duration)
+	Close() error
+}
+
+// dialLDAP connects to the LDAP server at addr - overridden in the tests
+var dialLDAP = func(addr string) (ldapConn, error) {
+	return ldap.DialURL(addr, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}))
+}
+
+// ldapAuth checks passwords by binding to an LDAP server
+type ldapAuth struct {
+	opt Options
+}
+
+// newLDAP makes a proxy which authenticates users with an LDAP bind
+func newLDAP(ctx context.Context, opt *Options, vfsOpt *vfscommon.Options) (*Proxy, error) {
+	if opt.AuthRemote == "" {
+		return nil, errors.New("need --auth-remote with --auth-ldap-url")
+	}
+	if !strings.Contains(opt.LDAPBindDN, "{user}") {
+		return nil, errors.New("--auth-ldap-bind-dn must contain {user}")
+	}
+	a := &ldapAuth{opt: *opt}
+	return NewFromFn(ctx, a.auth, vfsOpt), nil
+}
+
+// bind checks the user and password by binding as them
+func (a *ldapAuth) bind(user, pass string) error {
+	conn, err := dialLDAP(a.opt.LDAPURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	conn.SetTimeout(ldapTimeout)
+	if a.opt.LDAPStartTLS {
+		u, err := url.Parse(a.opt.LDAPURL)
+		if err != nil {
+			return err
+		}
+		err = conn.StartTLS(&tls.Config{ServerName: u.Hostname()})
+		if err != nil {
+			return fmt.Errorf("LDAP StartTLS failed: %w", err)
+		}
+	}
+	dn := strings.ReplaceAll(a.opt.LDAPBindDN, "{user}", ldap.EscapeDN(user))
+	err = conn.Bind(dn, pass)
+	if err != nil {
+		fs.Debugf(nil, "LDAP bind as %q failed: %v", dn, err)
+		return errors.New("bad user or password")
+	}
+	return nil
+}
+
+// auth is an AuthFn which binds to the LDAP server as user with the
+// password in auth
+func (a *ldapAuth) auth(ctx context.Context, user, auth string, isPublicKey bool) (fs.Fs, error) {
+	if isPublicKey {
+		return nil, errors.New("public keys can't be used with LDAP authentication")
+	}
+	if err := checkUser(user); err != nil {
+		return nil, err
+	}
+	// An empty password would make an unauthenticated bind which
+	// many servers allow
+	if auth == "" {
+		return nil, errors.New("bad user or password")
+	}
+	err := a.bind(user, auth)
+	if err != nil {
+		return nil, err
+	}
+	return userRemote(ctx, a.opt.AuthRemote, user)
+}
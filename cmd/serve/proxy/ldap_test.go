@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLDAP is an ldapConn which succeeds in binding only if the dn
+// and password match
+type fakeLDAP struct {
+	dn, pass string
+}
+
+func (c *fakeLDAP) StartTLS(config *tls.Config) error { return nil }
+func (c *fakeLDAP) SetTimeout(timeout time.Duration)  {}
+func (c *fakeLDAP) Close() error                      { return nil }
+
+func (c *fakeLDAP) Bind(dn, pass string) error {
+	if dn != c.dn || pass != c.pass {
+		return errors.New("invalid credentials")
+	}
+	return nil
+}
+
+// serveLDAP makes the LDAP server at the returned url a fakeLDAP
+// accepting dn and pass
+func serveLDAP(t *testing.T, dn, pass string) (url string) {
+	url = "ldap://ldap.example.com"
+	oldDialLDAP := dialLDAP
+	t.Cleanup(func() {
+		dialLDAP = oldDialLDAP
+	})
+	dialLDAP = func(addr string) (ldapConn, error) {
+		if addr != url {
+			return nil, fmt.Errorf("unknown server %q", addr)
+		}
+		return &fakeLDAP{dn: dn, pass: pass}, nil
+	}
+	return url
+}
+
+func TestLDAP(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "alice"), 0777))
+
+	opt := DefaultOpt
+	opt.LDAPURL = serveLDAP(t, "uid=alice,ou=people,dc=example,dc=com", "secret")
+	opt.LDAPBindDN = "uid={user},ou=people,dc=example,dc=com"
+	opt.AuthRemote = filepath.Join(root, "{user}")
+	p, err := NewFromOptions(ctx, &opt, &vfscommon.Opt)
+	require.NoError(t, err)
+
+	VFS, vfsKey, err := p.Call("alice", "secret", false)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", vfsKey)
+	assert.Equal(t, filepath.Join(root, "alice"), VFS.Fs().Root())
+
+	for _, test := range []struct {
+		name        string
+		user, pass  string
+		isPublicKey bool
+		errMsg      string
+	}{
+		{"WrongPassword", "bob", "secret", false, "bad user or password"},
+		{"EmptyPassword", "bob", "", false, "bad user or password"},
+		{"PublicKey", "bob", "AAAA", true, "public keys"},
+		{"BadUser", "../alice", "secret", false, "invalid user name"},
+		{"Injection", "alice,ou=people", "secret", false, "bad user or password"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := p.Call(test.user, test.pass, test.isPublicKey)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.errMsg)
+		})
+	}
+}
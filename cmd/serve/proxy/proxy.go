@@ -108,18 +108,54 @@ backend that rclone supports.
 
 // Options is options for creating the proxy
 type Options struct {
-	AuthProxy string
+	AuthProxy      string `config:"auth_proxy"`        // program to run to make the backend
+	AuthRemote     string `config:"auth_remote"`       // remote to serve users of the built in authenticators, {user} is replaced
+	JWKS           string `config:"auth_jwks"`         // JWKS file or URL to check JWTs with
+	JWTIssuer      string `config:"auth_jwt_issuer"`   // required iss claim if set
+	JWTAudience    string `config:"auth_jwt_audience"` // required aud claim if set
+	JWTUserClaim   string `config:"auth_jwt_user_claim"`
+	JWTRemoteClaim string `config:"auth_jwt_remote_claim"` // if set read the remote from this claim
+	LDAPURL        string `config:"auth_ldap_url"`         // LDAP server to bind to
+	LDAPBindDN     string `config:"auth_ldap_bind_dn"`     // DN to bind as, {user} is replaced
+	LDAPStartTLS   bool   `config:"auth_ldap_start_tls"`
 }
 
 // DefaultOpt is the default values uses for Opt
 var DefaultOpt = Options{
-	AuthProxy: "",
+	AuthProxy:    "",
+	JWTUserClaim: "sub",
 }
 
+// Enabled returns true if opt configures a way of authenticating
+// users, in which case the proxy chooses the backend for each user.
+func (opt *Options) Enabled() bool {
+	return opt.AuthProxy != "" || opt.JWKS != "" || opt.LDAPURL != ""
+}
+
+// AuthFn authenticates user with auth, which is a password or a
+// public key, returning the Fs to serve to them.
+//
+// It is used instead of running an external program by proxies made
+// with NewFromFn.
+type AuthFn func(ctx context.Context, user, auth string, isPublicKey bool) (fs.Fs, error)
+
+// CheckFn checks auth on every call, returning the name of the user
+// it belongs to which may be different from user, for example if it
+// was read from a token.
+//
+// Proxies with a CheckFn don't compare auth with the value used when
+// the user was cached so credentials which change, such as tokens,
+// can be used.
+type CheckFn func(ctx context.Context, user, auth string, isPublicKey bool) (string, error)
+
 // Proxy represents a proxy to turn auth requests into a VFS
 type Proxy struct {
 	cmdLine  []string // broken down command line
+	authFn   AuthFn   // if set, used instead of cmdLine
+	checkFn  CheckFn  // if set, used to check auth on every call
+	bearer   bool     // set if tokens may be sent in "Authorization: Bearer" headers
 	vfsCache *libcache.Cache
+	vfsOpt   vfscommon.Options
 	ctx      context.Context // for global config
 	Opt      Options
 }
@@ -131,15 +167,42 @@ type cacheEntry struct {
 }
 
 // New creates a new proxy with the Options passed in
-func New(ctx context.Context, opt *Options) *Proxy {
+//
+// The VFSes made for users are created with vfsOpt.
+func New(ctx context.Context, opt *Options, vfsOpt *vfscommon.Options) *Proxy {
 	return &Proxy{
 		ctx:      ctx,
 		Opt:      *opt,
 		cmdLine:  strings.Fields(opt.AuthProxy),
 		vfsCache: libcache.New(),
+		vfsOpt:   *vfsOpt,
+	}
+}
+
+// NewFromFn creates a new proxy which calls authFn to authenticate
+// users rather than running an external program.
+//
+// The VFSes made for users are created with vfsOpt.
+func NewFromFn(ctx context.Context, authFn AuthFn, vfsOpt *vfscommon.Options) *Proxy {
+	return &Proxy{
+		ctx:      ctx,
+		authFn:   authFn,
+		vfsCache: libcache.New(),
+		vfsOpt:   *vfsOpt,
 	}
 }
 
+// NewFromCheckFn creates a new proxy which calls checkFn to check
+// the auth on every call and authFn to make the Fs for users not in
+// the cache.
+//
+// The VFSes made for users are created with vfsOpt.
+func NewFromCheckFn(ctx context.Context, checkFn CheckFn, authFn AuthFn, vfsOpt *vfscommon.Options) *Proxy {
+	p := NewFromFn(ctx, authFn, vfsOpt)
+	p.checkFn = checkFn
+	return p
+}
+
 // run the proxy command returning a config map
 func (p *Proxy) run(in map[string]string) (config configmap.Simple, err error) {
 	cmd := exec.Command(p.cmdLine[0], p.cmdLine[1:]...)
@@ -181,8 +244,30 @@ func (p *Proxy) run(in map[string]string) (config configmap.Simple, err error) {
 	return config, nil
 }
 
+// callFn runs the auth function and returns a cacheEntry and an error
+func (p *Proxy) callFn(user, auth string, isPublicKey bool) (value interface{}, err error) {
+	value, err = p.vfsCache.Get(user, func(key string) (value interface{}, ok bool, err error) {
+		f, err := p.authFn(p.ctx, user, auth, isPublicKey)
+		if err != nil {
+			return nil, false, err
+		}
+		entry := cacheEntry{
+			vfs:    vfs.New(f, &p.vfsOpt),
+			pwHash: sha256.Sum256([]byte(auth)),
+		}
+		return entry, true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+	return value, nil
+}
+
 // call runs the auth proxy and returns a cacheEntry and an error
 func (p *Proxy) call(user, auth string, isPublicKey bool) (value interface{}, err error) {
+	if p.authFn != nil {
+		return p.callFn(user, auth, isPublicKey)
+	}
 	var config configmap.Simple
 	// Contact the proxy
 	if isPublicKey {
@@ -242,7 +327,7 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value interface{}, er
 		// need to in memory. An attacker would find it easier to go
 		// after the unencrypted password in memory most likely.
 		entry := cacheEntry{
-			vfs:    vfs.New(f, &vfscommon.Opt),
+			vfs:    vfs.New(f, &p.vfsOpt),
 			pwHash: sha256.Sum256([]byte(auth)),
 		}
 		return entry, true, nil
@@ -256,6 +341,10 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value interface{}, er
 // Call runs the auth proxy with the username and password/public key provided
 // returning a *vfs.VFS and the key used in the VFS cache.
 func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey string, err error) {
+	if p.checkFn != nil {
+		return p.callCheck(user, auth, isPublicKey)
+	}
+
 	// Look in the cache first
 	value, ok := p.vfsCache.GetMaybe(user)
 
@@ -289,6 +378,24 @@ func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey
 	return entry.vfs, user, nil
 }
 
+// callCheck checks the auth with checkFn then returns the VFS for the
+// user it belongs to
+func (p *Proxy) callCheck(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey string, err error) {
+	user, err = p.checkFn(p.ctx, user, auth, isPublicKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("proxy: %w", err)
+	}
+	value, err := p.callFn(user, auth, isPublicKey)
+	if err != nil {
+		return nil, "", err
+	}
+	entry, ok := value.(cacheEntry)
+	if !ok {
+		return nil, "", fmt.Errorf("proxy: value is not cache entry: %#v", value)
+	}
+	return entry.vfs, user, nil
+}
+
 // Get VFS from the cache using key - returns nil if not found
 func (p *Proxy) Get(key string) *vfs.VFS {
 	value, ok := p.vfsCache.GetMaybe(key)
@@ -6,6 +6,7 @@ import (
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"strings"
 	"testing"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/ssh"
@@ -22,7 +24,7 @@ func TestRun(t *testing.T) {
 	opt := DefaultOpt
 	cmd := "go run proxy_code.go"
 	opt.AuthProxy = cmd
-	p := New(context.Background(), &opt)
+	p := New(context.Background(), &opt, &vfscommon.Opt)
 
 	t.Run("Normal", func(t *testing.T) {
 		config, err := p.run(map[string]string{
@@ -233,3 +235,39 @@ func TestRun(t *testing.T) {
 		assert.Equal(t, 1, p.vfsCache.Entries())
 	})
 }
+
+func TestNewFromFn(t *testing.T) {
+	ctx := context.Background()
+	f, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+	calls := 0
+	p := NewFromFn(ctx, func(ctx context.Context, user, auth string, isPublicKey bool) (fs.Fs, error) {
+		calls++
+		if user != "user" || auth != "pass" || isPublicKey {
+			return nil, errors.New("bad credentials")
+		}
+		return f, nil
+	}, &vfscommon.Opt)
+
+	VFS, vfsKey, err := p.Call("user", "pass", false)
+	require.NoError(t, err)
+	assert.Equal(t, f, VFS.Fs())
+	assert.Equal(t, "user", vfsKey)
+	assert.Equal(t, 1, calls)
+
+	// Served from the cache
+	VFS2, _, err := p.Call("user", "pass", false)
+	require.NoError(t, err)
+	assert.Equal(t, VFS, VFS2)
+	assert.Equal(t, 1, calls)
+
+	// Wrong password for cached user
+	_, _, err = p.Call("user", "wrong", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "incorrect password")
+
+	// Unknown user
+	_, _, err = p.Call("other", "pass", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad credentials")
+}
@@ -2,8 +2,11 @@
 package proxyflags
 
 import (
+	"context"
+
 	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/spf13/pflag"
 )
 
@@ -15,4 +18,19 @@ var (
 // AddFlags adds the non filing system specific flags to the command
 func AddFlags(flagSet *pflag.FlagSet) {
 	flags.StringVarP(flagSet, &Opt.AuthProxy, "auth-proxy", "", Opt.AuthProxy, "A program to use to create the backend from the auth", "")
+	flags.StringVarP(flagSet, &Opt.AuthRemote, "auth-remote", "", Opt.AuthRemote, "Remote to serve users logged in with --auth-jwks or --auth-ldap-url, {user} is replaced with the user name", "")
+	flags.StringVarP(flagSet, &Opt.JWKS, "auth-jwks", "", Opt.JWKS, "JWKS file or URL to check OpenID Connect tokens with", "")
+	flags.StringVarP(flagSet, &Opt.JWTIssuer, "auth-jwt-issuer", "", Opt.JWTIssuer, "Issuer tokens must have if set", "")
+	flags.StringVarP(flagSet, &Opt.JWTAudience, "auth-jwt-audience", "", Opt.JWTAudience, "Audience tokens must have if set", "")
+	flags.StringVarP(flagSet, &Opt.JWTUserClaim, "auth-jwt-user-claim", "", Opt.JWTUserClaim, "Token claim containing the user name", "")
+	flags.StringVarP(flagSet, &Opt.JWTRemoteClaim, "auth-jwt-remote-claim", "", Opt.JWTRemoteClaim, "Token claim containing the remote to serve instead of --auth-remote", "")
+	flags.StringVarP(flagSet, &Opt.LDAPURL, "auth-ldap-url", "", Opt.LDAPURL, "LDAP server to check passwords with, e.g. ldaps://ldap.example.com", "")
+	flags.StringVarP(flagSet, &Opt.LDAPBindDN, "auth-ldap-bind-dn", "", Opt.LDAPBindDN, "DN to bind to the LDAP server as, {user} is replaced with the user name", "")
+	flags.BoolVarP(flagSet, &Opt.LDAPStartTLS, "auth-ldap-start-tls", "", Opt.LDAPStartTLS, "Use StartTLS to connect to the LDAP server", "")
+}
+
+// NewProxy makes a proxy from the command line flags, returning nil
+// if none of --auth-proxy, --auth-jwks or --auth-ldap-url are set
+func NewProxy(ctx context.Context) (*proxy.Proxy, error) {
+	return proxy.NewFromOptions(ctx, &Opt, &vfscommon.Opt)
 }
@@ -3,15 +3,23 @@ package s3
 import (
 	"context"
 	_ "embed"
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
+	"github.com/rclone/rclone/cmd/serve/servelib"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/rclone/rclone/fs/config/flags"
 	"github.com/rclone/rclone/fs/hash"
 	httplib "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/rclone/rclone/vfs/vfsflags"
 	"github.com/spf13/cobra"
 )
@@ -29,6 +37,26 @@ var DefaultOpt = Options{
 // Opt is options set by command line flags
 var Opt = DefaultOpt
 
+// OptionsInfo describes the Options by their config names
+var OptionsInfo = httplib.ConfigInfo.Add(httplib.AuthConfigInfo).Add(fs.Options{{
+	Name:    "force_path_style",
+	Default: true,
+	Help:    "If true use path style access if false use virtual hosted style",
+}, {
+	Name:    "etag_hash",
+	Default: "MD5",
+	Help:    "Which hash to use for the ETag, or auto or blank for off",
+}, {
+	Name:      "auth_key",
+	Default:   []string{},
+	Help:      "Set key pair for v4 authorization: access_key_id,secret_access_key",
+	Sensitive: true,
+}, {
+	Name:    "no_cleanup",
+	Default: false,
+	Help:    "Not to cleanup empty folder after object is deleted",
+}})
+
 const flagPrefix = ""
 
 func init() {
@@ -60,26 +88,27 @@ var Command = &cobra.Command{
 	},
 	Use:   "s3 remote:path",
 	Short: `Serve remote:path over s3.`,
-	Long:  help() + httplib.AuthHelp(flagPrefix) + httplib.Help(flagPrefix) + vfs.Help(),
+	Long:  help() + httplib.AuthHelp(flagPrefix) + httplib.Help(flagPrefix) + vfs.Help() + proxy.AuthHelp,
 	RunE: func(command *cobra.Command, args []string) error {
 		var f fs.Fs
-		if proxyflags.Opt.AuthProxy == "" {
+		if !proxyflags.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
 			cmd.CheckArgs(0, 0, command, args)
 		}
 
-		if Opt.hashName == "auto" {
-			Opt.hashType = f.Hashes().GetOne()
-		} else if Opt.hashName != "" {
-			err := Opt.hashType.Set(Opt.hashName)
+		err := Opt.setHashType(f)
+		if err != nil {
+			return err
+		}
+		cmd.Run(false, false, command, func() error {
+			ctx := context.Background()
+			p, err := proxyflags.NewProxy(ctx)
 			if err != nil {
 				return err
 			}
-		}
-		cmd.Run(false, false, command, func() error {
-			s, err := newServer(context.Background(), f, &Opt)
+			s, err := newServer(ctx, f, &Opt, &vfscommon.Opt, p)
 			if err != nil {
 				return err
 			}
@@ -95,3 +124,110 @@ var Command = &cobra.Command{
 		return nil
 	},
 }
+
+func init() {
+	servelib.Register("s3", func(ctx context.Context, f fs.Fs, in configmap.Getter, vfsOpt *vfscommon.Options, p *proxy.Proxy) (servelib.Handle, error) {
+		opt := Opt
+		err := opt.set(in)
+		if err != nil {
+			return nil, err
+		}
+		err = opt.setHashType(f)
+		if err != nil {
+			return nil, err
+		}
+		s, err := newServer(ctx, f, &opt, vfsOpt, p)
+		if err != nil {
+			return nil, err
+		}
+		s.Bind(s.server.Router())
+		return handle{s}, nil
+	}, OptionsInfo)
+}
+
+// set the options from the config names in the command line flags
+func (opt *Options) set(in configmap.Getter) (err error) {
+	err = configstruct.Set(in, &opt.Auth)
+	if err != nil {
+		return err
+	}
+	err = configstruct.Set(in, &opt.HTTP)
+	if err != nil {
+		return err
+	}
+	if value, ok := in.Get("force_path_style"); ok {
+		opt.pathBucketMode, err = strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("couldn't parse force_path_style: %w", err)
+		}
+	}
+	if value, ok := in.Get("etag_hash"); ok {
+		opt.hashName = value
+	}
+	if value, ok := in.Get("auth_key"); ok {
+		var keys fs.CommaSepList
+		err = keys.Set(value)
+		if err != nil {
+			return fmt.Errorf("couldn't parse auth_key: %w", err)
+		}
+		// Each key is an access_key_id,secret_access_key pair which
+		// may be quoted or may have been split by the list parsing
+		opt.authPair = nil
+		for i := 0; i < len(keys); i++ {
+			if strings.Contains(keys[i], ",") {
+				opt.authPair = append(opt.authPair, keys[i])
+				continue
+			}
+			if i+1 >= len(keys) {
+				return errors.New("auth_key must be access_key_id,secret_access_key pairs")
+			}
+			opt.authPair = append(opt.authPair, keys[i]+","+keys[i+1])
+			i++
+		}
+	}
+	if value, ok := in.Get("no_cleanup"); ok {
+		opt.noCleanup, err = strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("couldn't parse no_cleanup: %w", err)
+		}
+	}
+	return nil
+}
+
+// setHashType sets hashType from hashName for serving f
+func (opt *Options) setHashType(f fs.Fs) error {
+	if opt.hashName == "auto" {
+		opt.hashType = f.Hashes().GetOne()
+	} else if opt.hashName != "" {
+		err := opt.hashType.Set(opt.hashName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handle adapts a Server to servelib.Handle
+type handle struct {
+	*Server
+}
+
+// Addr returns the URLs the server is serving on
+func (h handle) Addr() string {
+	return strings.Join(h.server.URLs(), ", ")
+}
+
+// Serve runs the server until it is shut down
+func (h handle) Serve() error {
+	err := h.Server.Serve()
+	if err != nil {
+		return err
+	}
+	h.server.Wait()
+	return nil
+}
+
+// Shutdown stops the server
+func (h handle) Shutdown() error {
+	return h.server.Shutdown()
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/rclone/rclone/fstest"
 	httplib "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/lib/random"
+	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -48,7 +49,9 @@ func serveS3(f fs.Fs) (testURL string, keyid string, keysec string, w *Server) {
 	}
 
 	serveropt.HTTP.ListenAddr = []string{endpoint}
-	w, _ = newServer(context.Background(), f, serveropt)
+	ctx := context.Background()
+	p, _ := proxyflags.NewProxy(ctx)
+	w, _ = newServer(ctx, f, serveropt, &vfscommon.Opt, p)
 	router := w.server.Router()
 
 	w.Bind(router)
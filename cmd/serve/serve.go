@@ -9,6 +9,7 @@ import (
 	"github.com/rclone/rclone/cmd/serve/docker"
 	"github.com/rclone/rclone/cmd/serve/ftp"
 	"github.com/rclone/rclone/cmd/serve/http"
+	"github.com/rclone/rclone/cmd/serve/multi"
 	"github.com/rclone/rclone/cmd/serve/nfs"
 	"github.com/rclone/rclone/cmd/serve/restic"
 	"github.com/rclone/rclone/cmd/serve/s3"
@@ -43,6 +44,7 @@ func init() {
 	if s3.Command != nil {
 		Command.AddCommand(s3.Command)
 	}
+	Command.AddCommand(multi.Command)
 	cmd.Root.AddCommand(Command)
 }
 
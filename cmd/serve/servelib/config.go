@@ -0,0 +1,211 @@
+package servelib
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config describes several servers which share a VFS and an auth
+// proxy. It is read from a YAML or JSON file by "rclone serve multi".
+type Config struct {
+	// Remote served by listeners which don't set their own
+	Remote string `yaml:"remote" json:"remote"`
+	// VFS options by config name, e.g. vfs_cache_mode, shared by all listeners
+	VFS map[string]interface{} `yaml:"vfs" json:"vfs"`
+	// Program to run as the auth proxy for all listeners
+	AuthProxy string `yaml:"auth_proxy" json:"auth_proxy"`
+	// Options for the OpenID Connect or LDAP authentication of all
+	// listeners by config name, e.g. auth_jwks or auth_ldap_url
+	Auth map[string]interface{} `yaml:"auth" json:"auth"`
+	// Users authenticated by a built in proxy for all listeners
+	Users []User `yaml:"users" json:"users"`
+	// Servers to start
+	Listeners []Listener `yaml:"listeners" json:"listeners"`
+}
+
+// User is a user authenticated by the built in proxy
+type User struct {
+	User   string `yaml:"user" json:"user"`
+	Pass   string `yaml:"pass" json:"pass"`
+	Remote string `yaml:"remote" json:"remote"` // remote to serve this user, Config.Remote if empty
+}
+
+// Listener describes one server to start
+type Listener struct {
+	Type    string                 `yaml:"type" json:"type"`       // protocol, e.g. webdav
+	Remote  string                 `yaml:"remote" json:"remote"`   // remote to serve, Config.Remote if empty
+	Options map[string]interface{} `yaml:"options" json:"options"` // protocol options by config name, e.g. addr
+}
+
+// ReadConfig reads a Config from the YAML or JSON file at path
+func ReadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := new(Config)
+	err = yaml.UnmarshalStrict(data, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+	}
+	return c, nil
+}
+
+// Start starts all the listeners in the config, stopping any which
+// were started if one fails.
+func (c *Config) Start(ctx context.Context) (servers []*Server, err error) {
+	if len(c.Listeners) == 0 {
+		return nil, errors.New("no listeners configured")
+	}
+	vfsOptMap, err := optionMap(c.VFS)
+	if err != nil {
+		return nil, fmt.Errorf("bad vfs options: %w", err)
+	}
+	vfsOpt := vfscommon.Opt
+	err = configstruct.Set(vfsOptMap, &vfsOpt)
+	if err != nil {
+		return nil, fmt.Errorf("bad vfs options: %w", err)
+	}
+	p, err := c.newProxy(ctx, &vfsOpt)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			for _, s := range servers {
+				_ = s.Shutdown()
+			}
+			servers = nil
+		}
+	}()
+	for i, l := range c.Listeners {
+		opt, err := optionMap(l.Options)
+		if err != nil {
+			return servers, fmt.Errorf("listener %d (%s): bad options: %w", i+1, l.Type, err)
+		}
+		var f fs.Fs
+		if p == nil {
+			remote := l.Remote
+			if remote == "" {
+				remote = c.Remote
+			}
+			if remote == "" {
+				return servers, fmt.Errorf("listener %d (%s): no remote set", i+1, l.Type)
+			}
+			f, err = cache.Get(ctx, remote)
+			if err != nil {
+				return servers, fmt.Errorf("listener %d (%s): %w", i+1, l.Type, err)
+			}
+		}
+		s, err := Start(ctx, l.Type, f, opt, &vfsOpt, p)
+		if err != nil {
+			return servers, fmt.Errorf("listener %d: %w", i+1, err)
+		}
+		fs.Logf(nil, "Started %s server on %s", s.Type, s.Addr)
+		servers = append(servers, s)
+	}
+	return servers, nil
+}
+
+// newProxy makes the auth proxy shared by all the listeners or
+// returns nil if there isn't one
+func (c *Config) newProxy(ctx context.Context, vfsOpt *vfscommon.Options) (*proxy.Proxy, error) {
+	authOptMap, err := optionMap(c.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("bad auth options: %w", err)
+	}
+	authOpt := proxy.DefaultOpt
+	err = configstruct.Set(authOptMap, &authOpt)
+	if err != nil {
+		return nil, fmt.Errorf("bad auth options: %w", err)
+	}
+	if c.AuthProxy != "" {
+		authOpt.AuthProxy = c.AuthProxy
+	}
+	if authOpt.Enabled() {
+		if len(c.Users) > 0 {
+			return nil, errors.New("can't use auth_proxy or auth and users at the same time")
+		}
+		return proxy.NewFromOptions(ctx, &authOpt, vfsOpt)
+	}
+	if len(c.Users) == 0 {
+		return nil, nil
+	}
+	users := make(map[string]User, len(c.Users))
+	for _, u := range c.Users {
+		if u.User == "" {
+			return nil, errors.New("user with empty name")
+		}
+		if _, found := users[u.User]; found {
+			return nil, fmt.Errorf("duplicate user %q", u.User)
+		}
+		if u.Remote == "" {
+			if c.Remote == "" {
+				return nil, fmt.Errorf("no remote set for user %q", u.User)
+			}
+			u.Remote = c.Remote
+		}
+		users[u.User] = u
+	}
+	return proxy.NewFromFn(ctx, func(ctx context.Context, user, auth string, isPublicKey bool) (fs.Fs, error) {
+		u, found := users[user]
+		if !found || isPublicKey || subtle.ConstantTimeCompare([]byte(u.Pass), []byte(auth)) != 1 {
+			return nil, errors.New("bad user or password")
+		}
+		return cache.Get(ctx, u.Remote)
+	}, vfsOpt), nil
+}
+
+// optionMap converts options decoded from YAML or JSON into a
+// configmap, encoding lists as comma separated values.
+func optionMap(in map[string]interface{}) (configmap.Simple, error) {
+	out := make(configmap.Simple, len(in))
+	for key, value := range in {
+		s, err := optionString(value)
+		if err != nil {
+			return nil, fmt.Errorf("option %q: %w", key, err)
+		}
+		out[key] = s
+	}
+	return out, nil
+}
+
+// optionString converts a single option value into a string
+func optionString(value interface{}) (string, error) {
+	switch x := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return x, nil
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), nil
+	case []interface{}:
+		list := make(fs.CommaSepList, 0, len(x))
+		for _, item := range x {
+			s, err := optionString(item)
+			if err != nil {
+				return "", err
+			}
+			list = append(list, s)
+		}
+		return list.String(), nil
+	case []string:
+		return fs.CommaSepList(x).String(), nil
+	case map[string]interface{}, map[interface{}]interface{}:
+		return "", errors.New("nested objects are not supported")
+	default:
+		return fmt.Sprint(x), nil
+	}
+}
@@ -0,0 +1,266 @@
+package servelib
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "serve/start",
+		AuthRequired: true,
+		Fn:           startRc,
+		Title:        "Start one or more servers",
+		Params: []rc.Param{
+			{Name: "type", Type: rc.TypeString, Help: "the protocol to serve, see serve/types"},
+			{Name: "fs", Type: rc.TypeFs, Help: "the remote to serve"},
+			{Name: "opt", Type: rc.TypeObject, Help: "the protocol options by config name"},
+			{Name: "vfsOpt", Type: rc.TypeObject, Help: "the VFS options"},
+			{Name: "config", Type: rc.TypeObject, Help: `servers to start in the "rclone serve multi" config format`},
+		},
+		Result: []rc.Param{
+			{Name: "servers", Type: rc.TypeArray, Items: rc.TypeObject, Help: "the servers started"},
+		},
+		Help: `This starts servers in the background, like the rclone serve
+commands do.
+
+To start a single server pass these parameters:
+
+- type - the protocol to serve, e.g. "webdav", "s3", "sftp"
+- fs - the remote to serve (required)
+- opt - a JSON object with the protocol options in, using the
+  config names of the command line flags, e.g. {"addr": ":8080", "user": "me"}.
+  Options not given take the values set on the command line. See
+  serve/types for the options each protocol takes.
+- vfsOpt - a JSON object with VFS options in, as for mount/mount
+
+Or to start several servers which share a VFS and an auth proxy pass
+
+- config - a JSON object in the format of the "rclone serve multi" config file
+
+Servers serving the same remote with the same VFS options share a
+single VFS, and so its cache, whichever way they are started.
+
+Returns
+
+- servers - a list of objects describing each server started, as returned by serve/list
+
+Example:
+
+    rclone rc serve/start type=webdav fs=remote: opt='{"addr": ":8080"}'
+`,
+	})
+	rc.Add(rc.Call{
+		Path:         "serve/stop",
+		AuthRequired: true,
+		Fn:           stopRc,
+		Title:        "Stop a running server",
+		Params: []rc.Param{
+			{Name: "id", Type: rc.TypeString, Required: true, Help: "the id of the server as returned by serve/start or serve/list"},
+		},
+		Result: []rc.Param{},
+		Help: `This stops a server started with serve/start and waits for it to finish.
+
+This takes the following parameters:
+
+- id - the id of the server as returned by serve/start or serve/list
+
+Example:
+
+    rclone rc serve/stop id=webdav-1
+`,
+	})
+	rc.Add(rc.Call{
+		Path:         "serve/stopall",
+		AuthRequired: true,
+		Fn:           stopAllRc,
+		Title:        "Stop all the running servers",
+		Params:       []rc.Param{},
+		Result:       []rc.Param{},
+		Help: `This stops all the servers started with serve/start.
+
+Example:
+
+    rclone rc serve/stopall
+`,
+	})
+	rc.Add(rc.Call{
+		Path:         "serve/list",
+		AuthRequired: true,
+		Fn:           listRc,
+		Title:        "List the running servers",
+		Params:       []rc.Param{},
+		Result: []rc.Param{
+			{Name: "servers", Type: rc.TypeArray, Items: rc.TypeObject, Help: "the running servers"},
+		},
+		Help: `This lists the running servers in the order they were started.
+
+This takes no parameters and returns
+
+- servers - a list of objects, one for each server, with
+    - id - the id of the server to pass to serve/stop
+    - type - the protocol being served
+    - fs - the remote being served, empty if using an auth proxy
+    - addr - the address being served on
+    - opt - the protocol options it was started with, with passwords redacted
+
+Example:
+
+    rclone rc serve/list
+`,
+	})
+	rc.Add(rc.Call{
+		Path:         "serve/types",
+		AuthRequired: true,
+		Fn:           typesRc,
+		Title:        "Show the protocols which can be served",
+		Params:       []rc.Param{},
+		Result: []rc.Param{
+			{Name: "types", Type: rc.TypeArray, Items: rc.TypeString, Help: "the protocols which can be served"},
+			{Name: "options", Type: rc.TypeObject, Help: "the options of each protocol"},
+		},
+		Help: `This shows the protocols which can be passed as the type to serve/start.
+
+This takes no parameters and returns
+
+- types - a list of the protocols, e.g. "webdav", "s3", "sftp"
+- options - an object keyed by protocol with a list of the options it
+  takes, in the same format as options/info
+
+The options of ftp, sftp, nfs and dlna are also the option blocks of
+the same name in options/get, so their defaults can be changed with
+options/set.
+
+Example:
+
+    rclone rc serve/types
+`,
+	})
+}
+
+// startRc starts servers from the rc
+func startRc(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	var servers []*Server
+	if _, ok := in["config"]; ok {
+		var c Config
+		err = in.GetStruct("config", &c)
+		if err != nil {
+			return nil, err
+		}
+		servers, err = c.Start(serverContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		s, err := startOneRc(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, s)
+	}
+	var list []rc.Params
+	for _, s := range servers {
+		list = append(list, s.params())
+	}
+	return rc.Params{"servers": list}, nil
+}
+
+// startOneRc starts a single server from the parameters
+func startOneRc(ctx context.Context, in rc.Params) (*Server, error) {
+	name, err := in.GetString("type")
+	if err != nil {
+		return nil, err
+	}
+	f, err := rc.GetFs(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	vfsOpt := vfscommon.Opt
+	err = in.GetStructMissingOK("vfsOpt", &vfsOpt)
+	if err != nil {
+		return nil, err
+	}
+	var optIn map[string]interface{}
+	err = in.GetStructMissingOK("opt", &optIn)
+	if err != nil {
+		return nil, err
+	}
+	opt, err := optionMap(optIn)
+	if err != nil {
+		return nil, rc.NewErrParamInvalid(err)
+	}
+	return Start(serverContext(ctx), name, f, opt, &vfsOpt, nil)
+}
+
+// serverContext returns the context to start servers from the rc with.
+//
+// The servers outlive the call so mustn't be cancelled with it, nor
+// pick up the values of the rc request such as its routing, so only
+// the config and filters are copied from ctx.
+func serverContext(ctx context.Context) context.Context {
+	newCtx, ci := fs.AddConfig(context.Background())
+	*ci = *fs.GetConfig(ctx)
+	return filter.ReplaceConfig(newCtx, filter.GetConfig(ctx))
+}
+
+// stopRc stops a server from the rc
+func stopRc(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	id, err := in.GetString("id")
+	if err != nil {
+		return nil, err
+	}
+	s := Get(id)
+	if s == nil {
+		return nil, rc.NewErrParamInvalid(fmt.Errorf("server %q not found", id))
+	}
+	return nil, s.Shutdown()
+}
+
+// stopAllRc stops all the servers from the rc
+func stopAllRc(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	for _, s := range List() {
+		if stopErr := s.Shutdown(); stopErr != nil {
+			fs.Errorf(nil, "Failed to stop %s server %s: %v", s.Type, s.ID, stopErr)
+			err = stopErr
+		}
+	}
+	return nil, err
+}
+
+// listRc lists the servers for the rc
+func listRc(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	list := []rc.Params{}
+	for _, s := range List() {
+		list = append(list, s.params())
+	}
+	return rc.Params{"servers": list}, nil
+}
+
+// typesRc lists the protocols and their options for the rc
+func typesRc(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	types := Types()
+	options := rc.Params{}
+	for _, name := range types {
+		options[name] = Options(name)
+	}
+	return rc.Params{
+		"types":   types,
+		"options": options,
+	}, nil
+}
+
+// params describes the server for the rc
+func (s *Server) params() rc.Params {
+	return rc.Params{
+		"id":   s.ID,
+		"type": s.Type,
+		"fs":   s.Fs,
+		"addr": s.Addr,
+		"opt":  s.Opt,
+	}
+}
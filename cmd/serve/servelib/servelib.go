@@ -0,0 +1,240 @@
+// Package servelib keeps a registry of the serve protocols so that
+// servers can be created by name, for example by "rclone serve multi"
+// or the remote control.
+package servelib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/rc/events"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// Handle is a server which has been created and is ready to serve
+type Handle interface {
+	// Addr returns the address the server is serving on
+	Addr() string
+	// Serve runs the server, blocking until it is shut down
+	Serve() error
+	// Shutdown stops the server
+	Shutdown() error
+}
+
+// ServeFn creates a server for a protocol.
+//
+// If p is set then the server authenticates users with it and serves
+// each user the remote it returns, otherwise it serves f.
+//
+// opt contains protocol options keyed by their config names, e.g.
+// "addr" or "user", which override the values set on the command
+// line.
+type ServeFn func(ctx context.Context, f fs.Fs, opt configmap.Getter, vfsOpt *vfscommon.Options, p *proxy.Proxy) (Handle, error)
+
+// protocol is a registered serve protocol
+type protocol struct {
+	fn      ServeFn
+	options fs.Options
+}
+
+var (
+	// mutex to protect all the variables in this block
+	serveMu sync.Mutex
+	// Protocols available keyed by name
+	protocols = map[string]protocol{}
+	// Running servers keyed by ID
+	liveServers = map[string]*Server{}
+	// Number of servers started, used to make IDs
+	serverCount = 0
+)
+
+// Register makes a protocol available to be started by name.
+//
+// options describes the protocol options the ServeFn reads by their
+// config names. These are usually the options registered with
+// fs.RegisterGlobalOptions for the protocol.
+func Register(name string, fn ServeFn, options fs.Options) {
+	serveMu.Lock()
+	defer serveMu.Unlock()
+	protocols[name] = protocol{fn: fn, options: options}
+}
+
+// Resolve returns the ServeFn for the protocol name or nil if not found
+func Resolve(name string) ServeFn {
+	serveMu.Lock()
+	defer serveMu.Unlock()
+	return protocols[name].fn
+}
+
+// Options returns the options the protocol name takes or nil if not found
+func Options(name string) fs.Options {
+	serveMu.Lock()
+	defer serveMu.Unlock()
+	return protocols[name].options
+}
+
+// Types returns the sorted names of the registered protocols
+func Types() []string {
+	serveMu.Lock()
+	defer serveMu.Unlock()
+	types := make([]string, 0, len(protocols))
+	for name := range protocols {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// checkOptions returns an error if opt contains options which the
+// protocol name doesn't take
+func checkOptions(name string, opt configmap.Simple) error {
+	options := Options(name)
+	var unknown []string
+	for key := range opt {
+		if options.Get(key) == nil {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown %s options: %s", name, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// redact returns a copy of opt with the values of sensitive options
+// of the protocol name hidden
+func redact(name string, opt configmap.Simple) configmap.Simple {
+	options := Options(name)
+	out := make(configmap.Simple, len(opt))
+	for key, value := range opt {
+		if o := options.Get(key); o != nil && (o.Sensitive || o.IsPassword) && value != "" {
+			value = "XXX"
+		}
+		out[key] = value
+	}
+	return out
+}
+
+// Server is a running server started with Start
+type Server struct {
+	ID     string           // unique ID for the server
+	Type   string           // protocol name
+	Fs     string           // remote being served, or empty if using an auth proxy
+	Addr   string           // address being served on
+	Opt    configmap.Simple // options the server was started with, sensitive ones redacted
+	n      int              // sequence number of the server
+	handle Handle
+	done   chan struct{} // closed when Serve returns
+	err    error         // error from Serve
+}
+
+// Start creates a server for the protocol name and runs it in the
+// background.
+//
+// See ServeFn for the meaning of the parameters.
+func Start(ctx context.Context, name string, f fs.Fs, opt configmap.Simple, vfsOpt *vfscommon.Options, p *proxy.Proxy) (*Server, error) {
+	serveFn := Resolve(name)
+	if serveFn == nil {
+		return nil, fmt.Errorf("unknown serve protocol %q", name)
+	}
+	if f == nil && p == nil {
+		return nil, errors.New("need a remote or an auth proxy to serve")
+	}
+	err := checkOptions(name, opt)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := serveFn(ctx, f, opt, vfsOpt, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s server: %w", name, err)
+	}
+	s := &Server{
+		Type:   name,
+		Addr:   handle.Addr(),
+		Opt:    redact(name, opt),
+		handle: handle,
+		done:   make(chan struct{}),
+	}
+	if f != nil {
+		s.Fs = fs.ConfigString(f)
+	}
+
+	serveMu.Lock()
+	serverCount++
+	s.n = serverCount
+	s.ID = fmt.Sprintf("%s-%d", name, serverCount)
+	liveServers[s.ID] = s
+	serveMu.Unlock()
+	s.publish(events.ServeStart)
+
+	go func() {
+		s.err = s.handle.Serve()
+		if s.err != nil {
+			fs.Errorf(nil, "%s server on %s stopped: %v", s.Type, s.Addr, s.err)
+		}
+		serveMu.Lock()
+		delete(liveServers, s.ID)
+		serveMu.Unlock()
+		s.publish(events.ServeStop)
+		close(s.done)
+	}()
+	return s, nil
+}
+
+// Get returns the running server with id or nil if not found
+func Get(id string) *Server {
+	serveMu.Lock()
+	defer serveMu.Unlock()
+	return liveServers[id]
+}
+
+// List returns the running servers in the order they were started
+func List() []*Server {
+	serveMu.Lock()
+	defer serveMu.Unlock()
+	servers := make([]*Server, 0, len(liveServers))
+	for _, s := range liveServers {
+		servers = append(servers, s)
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].n < servers[j].n
+	})
+	return servers
+}
+
+// publish an event about the server
+func (s *Server) publish(eventType string) {
+	if !events.Active() {
+		return
+	}
+	events.Publish(&events.Event{
+		Type: eventType,
+		Data: s.params(),
+	})
+}
+
+// Shutdown stops the server and waits for it to finish
+func (s *Server) Shutdown() error {
+	err := s.handle.Shutdown()
+	<-s.done
+	return err
+}
+
+// Wait blocks until the server stops returning any error from it
+func (s *Server) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// Done returns a channel which is closed when the server stops
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
@@ -0,0 +1,302 @@
+package servelib_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	_ "github.com/rclone/rclone/cmd/serve/http"
+	"github.com/rclone/rclone/cmd/serve/servelib"
+	_ "github.com/rclone/rclone/cmd/serve/webdav"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configfile"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/rcserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// get fetches url with basic auth returning the body
+func get(t *testing.T, url, user, pass string) (int, string) {
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	if user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestTypes(t *testing.T) {
+	types := servelib.Types()
+	assert.Contains(t, types, "http")
+	assert.Contains(t, types, "webdav")
+	assert.Nil(t, servelib.Resolve("potato"))
+}
+
+func TestConfigStart(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0666))
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+remote: "`+dir+`"
+vfs:
+  dir_cache_time: 1m
+listeners:
+  - type: http
+    options:
+      addr: "localhost:0"
+  - type: webdav
+    options:
+      addr: ["localhost:0"]
+      user: me
+      pass: secret
+`), 0666))
+	c, err := servelib.ReadConfig(configPath)
+	require.NoError(t, err)
+
+	servers, err := c.Start(ctx)
+	require.NoError(t, err)
+	require.Len(t, servers, 2)
+	defer func() {
+		for _, s := range servers {
+			assert.NoError(t, s.Shutdown())
+		}
+	}()
+	assert.Equal(t, "http", servers[0].Type)
+	assert.Equal(t, "webdav", servers[1].Type)
+
+	code, body := get(t, servers[0].Addr+"file.txt", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "hello", body)
+
+	code, _ = get(t, servers[1].Addr+"file.txt", "", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, body = get(t, servers[1].Addr+"file.txt", "me", "secret")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "hello", body)
+}
+
+func TestConfigUsers(t *testing.T) {
+	ctx := context.Background()
+	dirA, dirB := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dirA, "a.txt"), []byte("A"), 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(dirB, "b.txt"), []byte("B"), 0666))
+
+	c := &servelib.Config{
+		Remote: dirA,
+		Users: []servelib.User{
+			{User: "alice", Pass: "pa"},
+			{User: "bob", Pass: "pb", Remote: dirB},
+		},
+		Listeners: []servelib.Listener{
+			{Type: "http", Options: map[string]interface{}{"addr": "localhost:0"}},
+			{Type: "webdav", Options: map[string]interface{}{"addr": "localhost:0"}},
+		},
+	}
+	servers, err := c.Start(ctx)
+	require.NoError(t, err)
+	defer func() {
+		for _, s := range servers {
+			assert.NoError(t, s.Shutdown())
+		}
+	}()
+
+	for _, s := range servers {
+		code, body := get(t, s.Addr+"a.txt", "alice", "pa")
+		assert.Equal(t, http.StatusOK, code, s.Type)
+		assert.Equal(t, "A", body)
+		code, body = get(t, s.Addr+"b.txt", "bob", "pb")
+		assert.Equal(t, http.StatusOK, code, s.Type)
+		assert.Equal(t, "B", body)
+		code, _ = get(t, s.Addr+"a.txt", "alice", "wrong")
+		assert.Equal(t, http.StatusUnauthorized, code, s.Type)
+		code, _ = get(t, s.Addr+"a.txt", "eve", "pa")
+		assert.Equal(t, http.StatusUnauthorized, code, s.Type)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		name   string
+		config servelib.Config
+		want   string
+	}{
+		{"NoListeners", servelib.Config{Remote: "/tmp"}, "no listeners"},
+		{"NoRemote", servelib.Config{Listeners: []servelib.Listener{{Type: "http"}}}, "no remote set"},
+		{"BadType", servelib.Config{Remote: "/tmp", Listeners: []servelib.Listener{{Type: "potato"}}}, "unknown serve protocol"},
+		{"ProxyAndUsers", servelib.Config{
+			AuthProxy: "prog",
+			Users:     []servelib.User{{User: "a", Pass: "b"}},
+			Listeners: []servelib.Listener{{Type: "http"}},
+		}, "at the same time"},
+		{"BadOption", servelib.Config{Remote: "/tmp", Listeners: []servelib.Listener{{
+			Type:    "http",
+			Options: map[string]interface{}{"server_read_timeout": "potato"},
+		}}}, "server_read_timeout"},
+		{"UnknownOption", servelib.Config{Remote: "/tmp", Listeners: []servelib.Listener{{
+			Type:    "http",
+			Options: map[string]interface{}{"adr": "localhost:0", "potato": true},
+		}}}, "unknown http options: adr, potato"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.config.Start(ctx)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.want)
+		})
+	}
+}
+
+func TestRcStart(t *testing.T) {
+	ctx := context.Background()
+	configfile.Install()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0666))
+
+	start := rc.Calls.Get("serve/start")
+	require.NotNil(t, start)
+
+	out, err := start.Fn(ctx, rc.Params{
+		"type": "http",
+		"fs":   dir,
+		"opt":  rc.Params{"addr": "localhost:0"},
+	})
+	require.NoError(t, err)
+	var servers []struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Addr string `json:"addr"`
+	}
+	require.NoError(t, out.GetStruct("servers", &servers))
+	require.Len(t, servers, 1)
+	assert.True(t, strings.HasPrefix(servers[0].ID, "http-"))
+
+	code, body := get(t, servers[0].Addr+"file.txt", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "hello", body)
+
+	_, err = start.Fn(ctx, rc.Params{"type": "potato", "fs": dir})
+	assert.Error(t, err)
+
+	stop := rc.Calls.Get("serve/stop")
+	require.NotNil(t, stop)
+	_, err = stop.Fn(ctx, rc.Params{"id": servers[0].ID})
+	require.NoError(t, err)
+	assert.Nil(t, servelib.Get(servers[0].ID))
+	_, err = stop.Fn(ctx, rc.Params{"id": servers[0].ID})
+	assert.ErrorContains(t, err, "not found")
+}
+
+// Test serve/start through the rc server as used by rclone rcd
+func TestRcStartRcd(t *testing.T) {
+	ctx := context.Background()
+	configfile.Install()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello"), 0666))
+
+	// Find a free port for the rc server
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	rcAddr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	opt := rc.Opt
+	opt.Enabled = true
+	opt.NoAuth = true
+	opt.HTTP.ListenAddr = []string{rcAddr}
+	rcServer, err := rcserver.Start(ctx, &opt)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, rcServer.Shutdown())
+	}()
+
+	body, err := json.Marshal(rc.Params{
+		"type": "http",
+		"fs":   dir,
+		"opt":  rc.Params{"addr": "localhost:0"},
+	})
+	require.NoError(t, err)
+	resp, err := http.Post("http://"+rcAddr+"/serve/start", "application/json", strings.NewReader(string(body)))
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var out struct {
+		Servers []struct {
+			ID   string `json:"id"`
+			Addr string `json:"addr"`
+		} `json:"servers"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+	require.Len(t, out.Servers, 1)
+	defer func() {
+		s := servelib.Get(out.Servers[0].ID)
+		require.NotNil(t, s)
+		require.NoError(t, s.Shutdown())
+	}()
+
+	code, got := get(t, out.Servers[0].Addr+"file.txt", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "hello", got)
+}
+
+func TestRcList(t *testing.T) {
+	ctx := context.Background()
+	configfile.Install()
+	dir := t.TempDir()
+
+	start := rc.Calls.Get("serve/start")
+	for _, typ := range []string{"webdav", "http"} {
+		_, err := start.Fn(ctx, rc.Params{
+			"type": typ,
+			"fs":   dir,
+			"opt":  rc.Params{"addr": "localhost:0", "user": "me", "pass": "secret"},
+		})
+		require.NoError(t, err)
+	}
+
+	out, err := rc.Calls.Get("serve/list").Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	var servers []struct {
+		ID   string            `json:"id"`
+		Type string            `json:"type"`
+		Fs   string            `json:"fs"`
+		Opt  map[string]string `json:"opt"`
+	}
+	require.NoError(t, out.GetStruct("servers", &servers))
+	require.Len(t, servers, 2)
+	assert.Equal(t, "webdav", servers[0].Type)
+	assert.Equal(t, "http", servers[1].Type)
+	assert.Equal(t, dir, servers[0].Fs)
+	assert.Equal(t, map[string]string{"addr": "localhost:0", "user": "me", "pass": "XXX"}, servers[0].Opt)
+
+	_, err = rc.Calls.Get("serve/stopall").Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	assert.Len(t, servelib.List(), 0)
+}
+
+func TestRcTypes(t *testing.T) {
+	out, err := rc.Calls.Get("serve/types").Fn(context.Background(), rc.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, servelib.Types(), out["types"])
+	options := out["options"].(rc.Params)
+	assert.NotNil(t, options["webdav"].(fs.Options).Get("etag_hash"))
+	assert.NotNil(t, options["http"].(fs.Options).Get("addr"))
+}
@@ -5,14 +5,19 @@ package sftp
 
 import (
 	"context"
+	"errors"
 
 	"github.com/rclone/rclone/cmd"
 	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
+	"github.com/rclone/rclone/cmd/serve/servelib"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/rclone/rclone/fs/config/flags"
 	"github.com/rclone/rclone/lib/systemd"
 	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/rclone/rclone/vfs/vfsflags"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -36,9 +41,10 @@ var OptionsInfo = fs.Options{{
 	Default: "",
 	Help:    "User name for authentication",
 }, {
-	Name:    "pass",
-	Default: "",
-	Help:    "Password for authentication",
+	Name:      "pass",
+	Default:   "",
+	Help:      "Password for authentication",
+	Sensitive: true,
 }, {
 	Name:    "no_auth",
 	Default: false,
@@ -62,6 +68,39 @@ type Options struct {
 
 func init() {
 	fs.RegisterGlobalOptions(fs.OptionsInfo{Name: "sftp", Opt: &Opt, Options: OptionsInfo})
+	servelib.Register("sftp", func(ctx context.Context, f fs.Fs, in configmap.Getter, vfsOpt *vfscommon.Options, p *proxy.Proxy) (servelib.Handle, error) {
+		opt := Opt
+		err := configstruct.Set(in, &opt)
+		if err != nil {
+			return nil, err
+		}
+		if opt.Stdio {
+			return nil, errors.New("stdio option not supported here")
+		}
+		s := newServer(ctx, f, &opt, vfsOpt, p)
+		err = s.serve()
+		if err != nil {
+			return nil, err
+		}
+		return handle{s}, nil
+	}, OptionsInfo)
+}
+
+// handle adapts a listening server to servelib.Handle
+type handle struct {
+	*server
+}
+
+// Serve blocks until the server is shut down
+func (h handle) Serve() error {
+	h.Wait()
+	return nil
+}
+
+// Shutdown stops the server
+func (h handle) Shutdown() error {
+	h.Close()
+	return nil
 }
 
 // Opt is options set by command line flags
@@ -145,14 +184,14 @@ used. Omitting "restrict" and using  ` + "`--sftp-path-override`" + ` to enable
 checksumming is possible but less secure and you could use the SFTP server
 provided by OpenSSH in this case.
 
-` + vfs.Help() + proxy.Help,
+` + vfs.Help() + proxy.Help + proxy.AuthHelp,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.48",
 		"groups":            "Filter",
 	},
 	Run: func(command *cobra.Command, args []string) {
 		var f fs.Fs
-		if proxyflags.Opt.AuthProxy == "" {
+		if !proxyflags.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
@@ -162,8 +201,13 @@ provided by OpenSSH in this case.
 			if Opt.Stdio {
 				return serveStdio(f)
 			}
-			s := newServer(context.Background(), f, &Opt)
-			err := s.Serve()
+			ctx := context.Background()
+			p, err := proxyflags.NewProxy(ctx)
+			if err != nil {
+				return err
+			}
+			s := newServer(ctx, f, &Opt, &vfscommon.Opt, p)
+			err = s.Serve()
 			if err != nil {
 				return err
 			}
@@ -14,10 +14,12 @@ import (
 
 	"github.com/pkg/sftp"
 	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/rclone/rclone/cmd/serve/servetest"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/stretchr/testify/require"
 )
 
@@ -45,7 +47,10 @@ func TestSftp(t *testing.T) {
 		opt.User = testUser
 		opt.Pass = testPass
 
-		w := newServer(context.Background(), f, &opt)
+		ctx := context.Background()
+		p, err := proxyflags.NewProxy(ctx)
+		require.NoError(t, err)
+		w := newServer(ctx, f, &opt, &vfscommon.Opt, p)
 		require.NoError(t, w.serve())
 
 		// Read the host and port we started on
@@ -19,7 +19,10 @@ import (
 	"github.com/rclone/rclone/cmd"
 	"github.com/rclone/rclone/cmd/serve/proxy"
 	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
+	"github.com/rclone/rclone/cmd/serve/servelib"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/rclone/rclone/fs/config/flags"
 	"github.com/rclone/rclone/fs/hash"
 	libhttp "github.com/rclone/rclone/lib/http"
@@ -37,9 +40,9 @@ type Options struct {
 	Auth          libhttp.AuthConfig
 	HTTP          libhttp.Config
 	Template      libhttp.TemplateConfig
-	HashName      string
-	HashType      hash.Type
-	DisableGETDir bool
+	HashName      string    `config:"etag_hash"`
+	HashType      hash.Type `config:"-"`
+	DisableGETDir bool      `config:"disable_dir_list"`
 }
 
 // DefaultOpt is the default values used for Options
@@ -54,6 +57,17 @@ var DefaultOpt = Options{
 // Opt is options set by command line flags
 var Opt = DefaultOpt
 
+// OptionsInfo describes the Options by their config names
+var OptionsInfo = libhttp.ConfigInfo.Add(libhttp.AuthConfigInfo).Add(libhttp.TemplateConfigInfo).Add(fs.Options{{
+	Name:    "etag_hash",
+	Default: "",
+	Help:    "Which hash to use for the ETag, or auto or blank for off",
+}, {
+	Name:    "disable_dir_list",
+	Default: false,
+	Help:    "Disable HTML directory list on GET request for a directory",
+}})
+
 // flagPrefix is the prefix used to uniquely identify command line flags.
 // It is intentionally empty for this package.
 const flagPrefix = ""
@@ -128,33 +142,30 @@ and connect to it like this using rclone and the webdav backend:
 Note that there is no authentication on http protocol - this is expected to be
 done by the permissions on the socket.
 
-` + libhttp.Help(flagPrefix) + libhttp.TemplateHelp(flagPrefix) + libhttp.AuthHelp(flagPrefix) + vfs.Help() + proxy.Help,
+` + libhttp.Help(flagPrefix) + libhttp.TemplateHelp(flagPrefix) + libhttp.AuthHelp(flagPrefix) + vfs.Help() + proxy.Help + proxy.AuthHelp,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.39",
 		"groups":            "Filter",
 	},
 	RunE: func(command *cobra.Command, args []string) error {
 		var f fs.Fs
-		if proxyflags.Opt.AuthProxy == "" {
+		if !proxyflags.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
 			cmd.CheckArgs(0, 0, command, args)
 		}
-		Opt.HashType = hash.None
-		if Opt.HashName == "auto" {
-			Opt.HashType = f.Hashes().GetOne()
-		} else if Opt.HashName != "" {
-			err := Opt.HashType.Set(Opt.HashName)
+		err := Opt.setHashType(f)
+		if err != nil {
+			return err
+		}
+		cmd.Run(false, false, command, func() error {
+			ctx := context.Background()
+			p, err := proxyflags.NewProxy(ctx)
 			if err != nil {
 				return err
 			}
-		}
-		if Opt.HashType != hash.None {
-			fs.Debugf(f, "Using hash %v for ETag", Opt.HashType)
-		}
-		cmd.Run(false, false, command, func() error {
-			s, err := newWebDAV(context.Background(), f, &Opt)
+			s, err := newWebDAV(ctx, f, &Opt, &vfscommon.Opt, p)
 			if err != nil {
 				return err
 			}
@@ -170,6 +181,62 @@ done by the permissions on the socket.
 	},
 }
 
+func init() {
+	servelib.Register("webdav", func(ctx context.Context, f fs.Fs, in configmap.Getter, vfsOpt *vfscommon.Options, p *proxy.Proxy) (servelib.Handle, error) {
+		opt := Opt
+		err := configstruct.Set(in, &opt)
+		if err != nil {
+			return nil, err
+		}
+		err = opt.setHashType(f)
+		if err != nil {
+			return nil, err
+		}
+		w, err := newWebDAV(ctx, f, &opt, vfsOpt, p)
+		if err != nil {
+			return nil, err
+		}
+		return handle{w}, nil
+	}, OptionsInfo)
+}
+
+// setHashType sets HashType from HashName for serving f
+func (opt *Options) setHashType(f fs.Fs) error {
+	opt.HashType = hash.None
+	if opt.HashName == "auto" {
+		opt.HashType = f.Hashes().GetOne()
+	} else if opt.HashName != "" {
+		err := opt.HashType.Set(opt.HashName)
+		if err != nil {
+			return err
+		}
+	}
+	if opt.HashType != hash.None {
+		fs.Debugf(f, "Using hash %v for ETag", opt.HashType)
+	}
+	return nil
+}
+
+// handle adapts a WebDAV to servelib.Handle
+type handle struct {
+	*WebDAV
+}
+
+// Addr returns the URLs the server is serving on
+func (h handle) Addr() string {
+	return strings.Join(h.URLs(), ", ")
+}
+
+// Serve runs the server until it is shut down
+func (h handle) Serve() error {
+	err := h.serve()
+	if err != nil {
+		return err
+	}
+	h.Wait()
+	return nil
+}
+
 // WebDAV is a webdav.FileSystem interface
 //
 // A FileSystem implements access to a collection of named files. The elements
@@ -196,18 +263,21 @@ type WebDAV struct {
 var _ webdav.FileSystem = (*WebDAV)(nil)
 
 // Make a new WebDAV to serve the remote
-func newWebDAV(ctx context.Context, f fs.Fs, opt *Options) (w *WebDAV, err error) {
+//
+// If p is set it is used to authenticate users, otherwise f is served
+func newWebDAV(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Options, p *proxy.Proxy) (w *WebDAV, err error) {
 	w = &WebDAV{
 		f:   f,
 		ctx: ctx,
 		opt: *opt,
 	}
-	if proxyflags.Opt.AuthProxy != "" {
-		w.proxy = proxy.New(ctx, &proxyflags.Opt)
+	if p != nil {
+		w.proxy = p
 		// override auth
 		w.opt.Auth.CustomAuthFn = w.auth
+		w.opt.Auth.CustomAuthHeaderFn = p.AuthHeaderFn()
 	} else {
-		w._vfs = vfs.New(f, &vfscommon.Opt)
+		w._vfs = vfs.New(f, vfsOpt)
 	}
 
 	w.Server, err = libhttp.NewServer(ctx,
@@ -18,12 +18,14 @@ import (
 	"time"
 
 	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/rclone/rclone/cmd/serve/servetest"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/obscure"
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/webdav"
@@ -57,7 +59,10 @@ func TestWebDav(t *testing.T) {
 		opt.HashType = hash.MD5
 
 		// Start the server
-		w, err := newWebDAV(context.Background(), f, &opt)
+		ctx := context.Background()
+		p, err := proxyflags.NewProxy(ctx)
+		require.NoError(t, err)
+		w, err := newWebDAV(ctx, f, &opt, &vfscommon.Opt, p)
 		require.NoError(t, err)
 		require.NoError(t, w.serve())
 
@@ -103,7 +108,7 @@ func TestHTTPFunction(t *testing.T) {
 	opt.Template.Path = testTemplate
 
 	// Start the server
-	w, err := newWebDAV(context.Background(), f, &opt)
+	w, err := newWebDAV(context.Background(), f, &opt, &vfscommon.Opt, nil)
 	assert.NoError(t, err)
 	require.NoError(t, w.serve())
 	defer func() {
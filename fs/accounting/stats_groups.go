@@ -286,6 +286,12 @@ func StatsGroup(ctx context.Context, group string) *StatsInfo {
 	return stats
 }
 
+// LookupStatsGroup gets stats by group name or nil if the group
+// doesn't exist.
+func LookupStatsGroup(group string) *StatsInfo {
+	return groups.get(group)
+}
+
 // GlobalStats returns special stats used for global accounting.
 func GlobalStats() *StatsInfo {
 	return StatsGroup(context.Background(), globalStats)
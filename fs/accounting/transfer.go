@@ -9,6 +9,7 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/events"
 )
 
 // TransferSnapshot represents state of an account at point in time.
@@ -89,6 +90,13 @@ func newTransferRemoteSize(stats *StatsInfo, remote string, size int64, checking
 		dstFs:     dstFs,
 	}
 	stats.AddTransfer(tr)
+	if !checking && events.Active() {
+		events.Publish(&events.Event{
+			Type:  events.TransferStart,
+			Group: stats.group,
+			Data:  tr.Snapshot(),
+		})
+	}
 	return tr
 }
 
@@ -123,6 +131,18 @@ func (tr *Transfer) Done(ctx context.Context, err error) {
 	tr.completedAt = time.Now()
 	tr.mu.Unlock()
 
+	if !tr.checking && events.Active() {
+		eventType := events.TransferComplete
+		if err != nil {
+			eventType = events.TransferFail
+		}
+		events.Publish(&events.Event{
+			Type:  eventType,
+			Group: tr.stats.group,
+			Data:  tr.Snapshot(),
+		})
+	}
+
 	if tr.checking {
 		tr.stats.DoneChecking(tr.remote)
 	} else {
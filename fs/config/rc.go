@@ -14,6 +14,7 @@ func init() {
 		Path:         "config/dump",
 		Fn:           rcDump,
 		Title:        "Dumps the config file.",
+		Params:       []rc.Param{},
 		AuthRequired: true,
 		Help: `
 Returns a JSON object:
@@ -33,9 +34,12 @@ func rcDump(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 
 func init() {
 	rc.Add(rc.Call{
-		Path:         "config/get",
-		Fn:           rcGet,
-		Title:        "Get a remote in the config file.",
+		Path:  "config/get",
+		Fn:    rcGet,
+		Title: "Get a remote in the config file.",
+		Params: []rc.Param{
+			{Name: "name", Type: rc.TypeString, Required: true, Help: "name of remote to get"},
+		},
 		AuthRequired: true,
 		Help: `
 Parameters:
@@ -58,9 +62,13 @@ func rcGet(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 
 func init() {
 	rc.Add(rc.Call{
-		Path:         "config/listremotes",
-		Fn:           rcListRemotes,
-		Title:        "Lists the remotes in the config file and defined in environment variables.",
+		Path:   "config/listremotes",
+		Fn:     rcListRemotes,
+		Title:  "Lists the remotes in the config file and defined in environment variables.",
+		Params: []rc.Param{},
+		Result: []rc.Param{
+			{Name: "remotes", Type: rc.TypeArray, Items: rc.TypeString, Help: "the remote names"},
+		},
 		AuthRequired: true,
 		Help: `
 Returns
@@ -83,9 +91,13 @@ func rcListRemotes(ctx context.Context, in rc.Params) (out rc.Params, err error)
 
 func init() {
 	rc.Add(rc.Call{
-		Path:         "config/providers",
-		Fn:           rcProviders,
-		Title:        "Shows how providers are configured in the config file.",
+		Path:   "config/providers",
+		Fn:     rcProviders,
+		Title:  "Shows how providers are configured in the config file.",
+		Params: []rc.Param{},
+		Result: []rc.Param{
+			{Name: "providers", Type: rc.TypeArray, Items: rc.TypeObject, Help: "the backends with their options"},
+		},
 		AuthRequired: true,
 		Help: `
 Returns a JSON object:
@@ -113,8 +125,13 @@ func init() {
 	for _, name := range []string{"create", "update", "password"} {
 		name := name
 		extraHelp := ""
+		params := []rc.Param{
+			{Name: "name", Type: rc.TypeString, Required: true, Help: "name of remote"},
+			{Name: "parameters", Type: rc.TypeObject, Required: true, Help: `a map of { "key": "value" } pairs`},
+		}
 		if name == "create" {
 			extraHelp = "- type - type of the new remote\n"
+			params = append(params, rc.Param{Name: "type", Type: rc.TypeString, Required: true, Help: "type of the new remote"})
 		}
 		if name == "create" || name == "update" {
 			extraHelp += `- opt - a dictionary of options to control the configuration
@@ -126,6 +143,11 @@ func init() {
     - state - state to restart with - used with continue
     - result - result to restart with - used with continue
 `
+			params = append(params,
+				rc.Param{Name: "opt", Type: rc.TypeObject, Help: "a dictionary of options to control the configuration"},
+				rc.Param{Name: "obscure", Type: rc.TypeBoolean, Help: "deprecated - use opt"},
+				rc.Param{Name: "noObscure", Type: rc.TypeBoolean, Help: "deprecated - use opt"},
+			)
 		}
 		rc.Add(rc.Call{
 			Path:         "config/" + name,
@@ -133,7 +155,8 @@ func init() {
 			Fn: func(ctx context.Context, in rc.Params) (rc.Params, error) {
 				return rcConfig(ctx, in, name)
 			},
-			Title: name + " the config for a remote.",
+			Title:  name + " the config for a remote.",
+			Params: params,
 			Help: `This takes the following parameters:
 
 - name - name of remote
@@ -201,9 +224,13 @@ func rcConfig(ctx context.Context, in rc.Params, what string) (out rc.Params, er
 
 func init() {
 	rc.Add(rc.Call{
-		Path:         "config/delete",
-		Fn:           rcDelete,
-		Title:        "Delete a remote in the config file.",
+		Path:  "config/delete",
+		Fn:    rcDelete,
+		Title: "Delete a remote in the config file.",
+		Params: []rc.Param{
+			{Name: "name", Type: rc.TypeString, Required: true, Help: "name of remote to delete"},
+		},
+		Result:       []rc.Param{},
 		AuthRequired: true,
 		Help: `
 Parameters:
@@ -227,9 +254,13 @@ func rcDelete(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 
 func init() {
 	rc.Add(rc.Call{
-		Path:         "config/setpath",
-		Fn:           rcSetPath,
-		Title:        "Set the path of the config file",
+		Path:  "config/setpath",
+		Fn:    rcSetPath,
+		Title: "Set the path of the config file",
+		Params: []rc.Param{
+			{Name: "path", Type: rc.TypeString, Required: true, Help: "path to the config file to use"},
+		},
+		Result:       []rc.Param{},
 		AuthRequired: true,
 		Help: `
 Parameters:
@@ -251,9 +282,15 @@ func rcSetPath(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 
 func init() {
 	rc.Add(rc.Call{
-		Path:         "config/paths",
-		Fn:           rcPaths,
-		Title:        "Reads the config file path and other important paths.",
+		Path:   "config/paths",
+		Fn:     rcPaths,
+		Title:  "Reads the config file path and other important paths.",
+		Params: []rc.Param{},
+		Result: []rc.Param{
+			{Name: "config", Type: rc.TypeString, Help: "path to config file"},
+			{Name: "cache", Type: rc.TypeString, Help: "path to root of cache directory"},
+			{Name: "temp", Type: rc.TypeString, Help: "path to root of temporary directory"},
+		},
 		AuthRequired: true,
 		Help: `
 Returns a JSON object with the following keys:
@@ -60,6 +60,10 @@ var LogPrintPid = false
 // InstallJSONLogger is a hook that --use-json-log calls
 var InstallJSONLogger = func(logLevel LogLevel) {}
 
+// LogHook is called with each message logged if set. The args are nil
+// if text isn't a format string.
+var LogHook func(level LogLevel, o interface{}, text string, args []interface{})
+
 // LogOutput sends the text to the logger of level
 var LogOutput = func(level LogLevel, text string) {
 	text = fmt.Sprintf("%-6s: %s", level, text)
@@ -169,6 +173,9 @@ func LogPrint(level LogLevel, o interface{}, text string) {
 	} else {
 		logPlain(level, o, text)
 	}
+	if LogHook != nil {
+		LogHook(level, o, text, nil)
+	}
 }
 
 // LogPrintf produces a log string from the arguments passed in
@@ -178,6 +185,12 @@ func LogPrintf(level LogLevel, o interface{}, text string, args ...interface{})
 	} else {
 		logPlainf(level, o, text, args...)
 	}
+	if LogHook != nil {
+		if args == nil {
+			args = []interface{}{}
+		}
+		LogHook(level, o, text, args)
+	}
 }
 
 // LogLevelPrint writes logs at the given level
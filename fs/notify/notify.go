@@ -0,0 +1,198 @@
+// Package notify sends notifications when commands and rc jobs start
+// and finish to HTTP webhooks and local commands.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fshttp"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// Events which can be notified
+const (
+	Start   = "start"   // the command or job started
+	Success = "success" // the command or job finished successfully
+	Failure = "failure" // the command or job finished with an error
+)
+
+// OptionsInfo describes the Options in use
+var OptionsInfo = fs.Options{{
+	Name:    "notify_webhook",
+	Default: []string{},
+	Help:    "URL to POST JSON notifications about the command or jobs to",
+	Groups:  "Notify",
+}, {
+	Name:    "notify_command",
+	Default: fs.SpaceSepList{},
+	Help:    "Command to run with each JSON notification on stdin",
+	Groups:  "Notify",
+}, {
+	Name:    "notify_on",
+	Default: fs.CommaSepList{Success, Failure},
+	Help:    "Comma separated list of events to notify: start, success, failure",
+	Groups:  "Notify",
+}, {
+	Name:    "notify_timeout",
+	Default: fs.Duration(30 * time.Second),
+	Help:    "Max time to wait for each webhook or command",
+	Groups:  "Notify",
+}}
+
+func init() {
+	fs.RegisterGlobalOptions(fs.OptionsInfo{Name: "notify", Opt: &Opt, Options: OptionsInfo})
+}
+
+// Options contains the options for the notifications
+type Options struct {
+	Webhook []string        `config:"notify_webhook"` // URLs to POST the notifications to
+	Command fs.SpaceSepList `config:"notify_command"` // command and args to run for each notification
+	On      fs.CommaSepList `config:"notify_on"`      // which events to notify
+	Timeout fs.Duration     `config:"notify_timeout"` // max time for each webhook or command
+}
+
+// Opt is the default options for the notifications
+var Opt Options
+
+// Enabled returns whether there is anything to notify
+func (opt *Options) Enabled() bool {
+	return opt != nil && (len(opt.Webhook) > 0 || len(opt.Command) > 0)
+}
+
+// Wants returns whether event should be notified
+func (opt *Options) Wants(event string) bool {
+	if !opt.Enabled() {
+		return false
+	}
+	for _, on := range opt.On {
+		if strings.EqualFold(strings.TrimSpace(on), event) {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload is the notification sent to the webhooks as JSON and to
+// the commands on stdin
+type Payload struct {
+	Event     string    `json:"event"`              // one of Start, Success or Failure
+	Source    string    `json:"source"`             // "command" for rclone commands or "job" for rc jobs
+	Command   string    `json:"command"`            // the rclone command or rc call, e.g. "sync" or "sync/sync"
+	JobID     int64     `json:"jobid,omitempty"`    // the id of the rc job
+	Group     string    `json:"group,omitempty"`    // the stats group of the rc job
+	Hostname  string    `json:"hostname"`           // the host rclone is running on
+	StartTime time.Time `json:"startTime"`          // when the command or job started
+	EndTime   time.Time `json:"endTime"`            // when the command or job finished
+	Duration  float64   `json:"duration"`           // how long it took in seconds
+	Error     string    `json:"error,omitempty"`    // the error if it failed
+	ExitCode  *int      `json:"exitCode,omitempty"` // the exit code of rclone commands
+	Stats     rc.Params `json:"stats,omitempty"`    // the stats as returned by core/stats
+}
+
+// env returns environment variables describing the payload for commands
+func (p *Payload) env() []string {
+	env := []string{
+		"RCLONE_NOTIFY_EVENT=" + p.Event,
+		"RCLONE_NOTIFY_SOURCE=" + p.Source,
+		"RCLONE_NOTIFY_COMMAND=" + p.Command,
+		"RCLONE_NOTIFY_ERROR=" + p.Error,
+		"RCLONE_NOTIFY_DURATION=" + strconv.FormatFloat(p.Duration, 'f', -1, 64),
+	}
+	if p.JobID != 0 {
+		env = append(env, "RCLONE_NOTIFY_JOBID="+strconv.FormatInt(p.JobID, 10))
+	}
+	if p.Group != "" {
+		env = append(env, "RCLONE_NOTIFY_GROUP="+p.Group)
+	}
+	if p.ExitCode != nil {
+		env = append(env, "RCLONE_NOTIFY_EXIT_CODE="+strconv.Itoa(*p.ExitCode))
+	}
+	return env
+}
+
+// Send p to the webhooks and commands in opt if opt wants its event.
+//
+// It waits for them all to finish, returning the errors joined.
+func Send(ctx context.Context, opt *Options, p *Payload) error {
+	if !opt.Wants(p.Event) {
+		return nil
+	}
+	if p.Hostname == "" {
+		p.Hostname, _ = os.Hostname()
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("notify: failed to make payload: %w", err)
+	}
+	var errs []error
+	for _, url := range opt.Webhook {
+		err := webhook(ctx, opt, url, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("notify: webhook %q: %w", url, err))
+		}
+	}
+	if len(opt.Command) > 0 {
+		err := command(ctx, opt, p, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("notify: command %q: %w", opt.Command[0], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// withTimeout returns ctx limited to the timeout in opt if set
+func withTimeout(ctx context.Context, opt *Options) (context.Context, context.CancelFunc) {
+	if opt.Timeout > 0 {
+		return context.WithTimeout(ctx, time.Duration(opt.Timeout))
+	}
+	return context.WithCancel(ctx)
+}
+
+// webhook POSTs data to url
+func webhook(ctx context.Context, opt *Options, url string, data []byte) (err error) {
+	ctx, cancel := withTimeout(ctx, opt)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := fshttp.NewClient(ctx).Do(req)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP error: %s", resp.Status)
+	}
+	return nil
+}
+
+// command runs the notify command with data on stdin and the payload
+// described in the environment
+func command(ctx context.Context, opt *Options, p *Payload, data []byte) error {
+	ctx, cancel := withTimeout(ctx, opt)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, opt.Command[0], opt.Command[1:]...)
+	cmd.Env = append(os.Environ(), p.env()...)
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if len(out) > 0 {
+			return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+		}
+		return err
+	}
+	return nil
+}
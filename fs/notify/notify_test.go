@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWants(t *testing.T) {
+	var nilOpt *Options
+	assert.False(t, nilOpt.Wants(Failure))
+	opt := &Options{On: fs.CommaSepList{Success, " Failure"}}
+	assert.False(t, opt.Enabled())
+	assert.False(t, opt.Wants(Failure))
+	opt.Webhook = []string{"http://localhost/"}
+	assert.True(t, opt.Enabled())
+	assert.True(t, opt.Wants(Failure))
+	assert.True(t, opt.Wants(Success))
+	assert.False(t, opt.Wants(Start))
+}
+
+func TestSendWebhook(t *testing.T) {
+	ctx := context.Background()
+	var got []Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var p Payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		got = append(got, p)
+		if p.Event == Success {
+			http.Error(w, "potato", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	opt := &Options{
+		Webhook: []string{server.URL},
+		On:      fs.CommaSepList{Start, Failure, Success},
+		Timeout: fs.Duration(10 * time.Second),
+	}
+	exitCode := 3
+	err := Send(ctx, opt, &Payload{
+		Event:    Failure,
+		Source:   "command",
+		Command:  "sync",
+		Error:    "directory not found",
+		ExitCode: &exitCode,
+		Stats:    map[string]interface{}{"errors": 1},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(got))
+	assert.Equal(t, Failure, got[0].Event)
+	assert.Equal(t, "sync", got[0].Command)
+	assert.Equal(t, "directory not found", got[0].Error)
+	assert.Equal(t, 3, *got[0].ExitCode)
+	assert.Equal(t, float64(1), got[0].Stats["errors"])
+	assert.NotEqual(t, "", got[0].Hostname)
+
+	err = Send(ctx, opt, &Payload{Event: Success})
+	assert.ErrorContains(t, err, "500 Internal Server Error")
+
+	// events not wanted aren't sent
+	opt.On = fs.CommaSepList{Failure}
+	require.NoError(t, Send(ctx, opt, &Payload{Event: Start}))
+	assert.Equal(t, 2, len(got))
+}
+
+func TestSendCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a unix shell")
+	}
+	ctx := context.Background()
+	out := filepath.Join(t.TempDir(), "out")
+	opt := &Options{
+		Command: fs.SpaceSepList{"sh", "-c", `cat > "$0"; echo "$RCLONE_NOTIFY_EVENT $RCLONE_NOTIFY_JOBID $RCLONE_NOTIFY_ERROR" >> "$0.env"`, out},
+		On:      fs.CommaSepList{Failure},
+	}
+	err := Send(ctx, opt, &Payload{
+		Event:  Failure,
+		Source: "job",
+		JobID:  42,
+		Error:  "boom",
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	var p Payload
+	require.NoError(t, json.Unmarshal(data, &p))
+	assert.Equal(t, int64(42), p.JobID)
+	assert.Equal(t, "job", p.Source)
+	env, err := os.ReadFile(out + ".env")
+	require.NoError(t, err)
+	assert.Equal(t, "failure 42 boom\n", string(env))
+
+	opt.Command = fs.SpaceSepList{"sh", "-c", "echo oops; exit 3"}
+	err = Send(ctx, opt, &Payload{Event: Failure})
+	assert.ErrorContains(t, err, "oops")
+}
@@ -19,12 +19,23 @@ import (
 	"github.com/rclone/rclone/lib/diskusage"
 )
 
+// Parameters used by many of the calls
+var (
+	fsParam      = rc.Param{Name: "fs", Type: rc.TypeFs, Required: true, Help: `a remote name string e.g. "drive:"`}
+	remoteParam  = rc.Param{Name: "remote", Type: rc.TypeString, Required: true, Help: `a path within that remote e.g. "dir"`}
+	listOptParam = rc.Param{Name: "opt", Type: rc.TypeObject, Help: "a dictionary of options to control the listing"}
+)
+
 func init() {
 	rc.Add(rc.Call{
 		Path:         "operations/list",
 		AuthRequired: true,
 		Fn:           rcList,
 		Title:        "List the given remote and path in JSON format",
+		Params:       []rc.Param{fsParam, remoteParam, listOptParam},
+		Result: []rc.Param{
+			{Name: "list", Type: rc.TypeArray, Items: rc.TypeObject, Help: "the items as described in the lsjson command"},
+		},
 		Help: `This takes the following parameters:
 
 - fs - a remote name string e.g. "drive:"
@@ -81,6 +92,10 @@ func init() {
 		AuthRequired: true,
 		Fn:           rcStat,
 		Title:        "Give information about the supplied file or directory",
+		Params:       []rc.Param{fsParam, remoteParam, listOptParam},
+		Result: []rc.Param{
+			{Name: "item", Type: rc.TypeObject, Help: "the item as described in the lsjson command or null if not found"},
+		},
 		Help: `This takes the following parameters
 
 - fs - a remote name string eg "drive:"
@@ -126,6 +141,15 @@ func init() {
 		AuthRequired: true,
 		Fn:           rcAbout,
 		Title:        "Return the space used on the remote",
+		Params:       []rc.Param{fsParam},
+		Result: []rc.Param{
+			{Name: "total", Type: rc.TypeInteger, Help: "quota of bytes that can be used"},
+			{Name: "used", Type: rc.TypeInteger, Help: "bytes in use"},
+			{Name: "trashed", Type: rc.TypeInteger, Help: "bytes in trash"},
+			{Name: "other", Type: rc.TypeInteger, Help: "other usage e.g. gmail in drive"},
+			{Name: "free", Type: rc.TypeInteger, Help: "bytes which can be uploaded before reaching the quota"},
+			{Name: "objects", Type: rc.TypeInteger, Help: "objects in the storage system"},
+		},
 		Help: `This takes the following parameters:
 
 - fs - a remote name string e.g. "drive:"
@@ -172,6 +196,13 @@ func init() {
 				return rcMoveOrCopyFile(ctx, in, copy)
 			},
 			Title: name + " a file from source remote to destination remote",
+			Params: []rc.Param{
+				{Name: "srcFs", Type: rc.TypeFs, Required: true, Help: "the source remote"},
+				{Name: "srcRemote", Type: rc.TypeString, Required: true, Help: "a path within the source remote"},
+				{Name: "dstFs", Type: rc.TypeFs, Required: true, Help: "the destination remote"},
+				{Name: "dstRemote", Type: rc.TypeString, Required: true, Help: "a path within the destination remote"},
+			},
+			Result: []rc.Param{},
 			Help: `This takes the following parameters:
 
 - srcFs - a remote name string e.g. "drive:" for the source, "/" for local filesystem
@@ -203,24 +234,39 @@ func init() {
 		help         string
 		noRemote     bool
 		needsRequest bool
+		params       []rc.Param
 	}{
 		{name: "mkdir", title: "Make a destination directory or container"},
 		{name: "rmdir", title: "Remove an empty directory or container"},
 		{name: "purge", title: "Remove a directory or container and all of its contents"},
-		{name: "rmdirs", title: "Remove all the empty directories in the path", help: "- leaveRoot - boolean, set to true not to delete the root\n"},
+		{name: "rmdirs", title: "Remove all the empty directories in the path", help: "- leaveRoot - boolean, set to true not to delete the root\n", params: []rc.Param{
+			{Name: "leaveRoot", Type: rc.TypeBoolean, Help: "set to true not to delete the root"},
+		}},
 		{name: "delete", title: "Remove files in the path", noRemote: true},
 		{name: "deletefile", title: "Remove the single file pointed to"},
-		{name: "copyurl", title: "Copy the URL to the object", help: "- url - string, URL to read from\n - autoFilename - boolean, set to true to retrieve destination file name from url\n"},
+		{name: "copyurl", title: "Copy the URL to the object", help: "- url - string, URL to read from\n - autoFilename - boolean, set to true to retrieve destination file name from url\n", params: []rc.Param{
+			{Name: "url", Type: rc.TypeString, Required: true, Help: "URL to read from"},
+			{Name: "autoFilename", Type: rc.TypeBoolean, Help: "set to true to retrieve destination file name from url"},
+			{Name: "headerFilename", Type: rc.TypeBoolean, Help: "set to true to get the file name from the Content-Disposition header"},
+			{Name: "noClobber", Type: rc.TypeBoolean, Help: "set to true not to overwrite an existing file"},
+		}},
 		{name: "uploadfile", title: "Upload file using multiform/form-data", help: "- each part in body represents a file to be uploaded\n", needsRequest: true},
 		{name: "cleanup", title: "Remove trashed files in the remote or path", noRemote: true},
-		{name: "settier", title: "Changes storage tier or class on all files in the path", noRemote: true},
-		{name: "settierfile", title: "Changes storage tier or class on the single file pointed to"},
+		{name: "settier", title: "Changes storage tier or class on all files in the path", noRemote: true, params: []rc.Param{
+			{Name: "tier", Type: rc.TypeString, Required: true, Help: "the storage tier or class to set"},
+		}},
+		{name: "settierfile", title: "Changes storage tier or class on the single file pointed to", params: []rc.Param{
+			{Name: "tier", Type: rc.TypeString, Required: true, Help: "the storage tier or class to set"},
+		}},
 	} {
 		op := op
 		remote := "- remote - a path within that remote e.g. \"dir\"\n"
+		params := []rc.Param{fsParam, remoteParam}
 		if op.noRemote {
 			remote = ""
+			params = params[:1]
 		}
+		params = append(params, op.params...)
 		rc.Add(rc.Call{
 			Path:         "operations/" + op.name,
 			AuthRequired: true,
@@ -228,7 +274,9 @@ func init() {
 			Fn: func(ctx context.Context, in rc.Params) (rc.Params, error) {
 				return rcSingleCommand(ctx, in, op.name, op.noRemote)
 			},
-			Title: op.title,
+			Title:  op.title,
+			Params: params,
+			Result: []rc.Param{},
 			Help: `This takes the following parameters:
 
 - fs - a remote name string e.g. "drive:"
@@ -354,6 +402,12 @@ func init() {
 		AuthRequired: true,
 		Fn:           rcSize,
 		Title:        "Count the number of bytes and files in remote",
+		Params:       []rc.Param{fsParam},
+		Result: []rc.Param{
+			{Name: "count", Type: rc.TypeInteger, Help: "number of files"},
+			{Name: "bytes", Type: rc.TypeInteger, Help: "number of bytes in those files"},
+			{Name: "sizeless", Type: rc.TypeInteger, Help: "number of files with unknown size"},
+		},
 		Help: `This takes the following parameters:
 
 - fs - a remote name string e.g. "drive:path/to/dir"
@@ -391,6 +445,15 @@ func init() {
 		AuthRequired: true,
 		Fn:           rcPublicLink,
 		Title:        "Create or retrieve a public link to the given file or folder.",
+		Params: []rc.Param{
+			fsParam,
+			remoteParam,
+			{Name: "unlink", Type: rc.TypeBoolean, Help: "if set removes the link rather than adding it"},
+			{Name: "expire", Type: rc.TypeDuration, Help: `the expiry time of the link e.g. "1d"`},
+		},
+		Result: []rc.Param{
+			{Name: "url", Type: rc.TypeString, Help: "URL of the resource"},
+		},
 		Help: `This takes the following parameters:
 
 - fs - a remote name string e.g. "drive:"
@@ -431,9 +494,19 @@ func rcPublicLink(ctx context.Context, in rc.Params) (out rc.Params, err error)
 
 func init() {
 	rc.Add(rc.Call{
-		Path:  "operations/fsinfo",
-		Fn:    rcFsInfo,
-		Title: "Return information about the remote",
+		Path:   "operations/fsinfo",
+		Fn:     rcFsInfo,
+		Title:  "Return information about the remote",
+		Params: []rc.Param{fsParam},
+		Result: []rc.Param{
+			{Name: "Features", Type: rc.TypeObject, Help: "optional features and whether they are available or not"},
+			{Name: "Hashes", Type: rc.TypeArray, Items: rc.TypeString, Help: "names of the hashes available"},
+			{Name: "Name", Type: rc.TypeString, Help: "name as created"},
+			{Name: "Precision", Type: rc.TypeInteger, Help: "precision of timestamps in ns"},
+			{Name: "Root", Type: rc.TypeString, Help: "path as created"},
+			{Name: "String", Type: rc.TypeString, Help: "how the remote will appear in logs"},
+			{Name: "MetadataInfo", Type: rc.TypeObject, Help: "information about the metadata of the remote"},
+		},
 		Help: `This takes the following parameters:
 
 - fs - a remote name string e.g. "drive:"
@@ -570,6 +643,15 @@ func init() {
 		AuthRequired: true,
 		Fn:           rcBackend,
 		Title:        "Runs a backend command.",
+		Params: []rc.Param{
+			{Name: "command", Type: rc.TypeString, Required: true, Help: "the command name"},
+			fsParam,
+			{Name: "arg", Type: rc.TypeArray, Items: rc.TypeString, Help: "a list of arguments for the backend command"},
+			{Name: "opt", Type: rc.TypeObject, Help: "a map of string to string of options"},
+		},
+		Result: []rc.Param{
+			{Name: "result", Help: "result from the backend command"},
+		},
 		Help: `This takes the following parameters:
 
 - command - a string with the command name
@@ -656,6 +738,13 @@ func init() {
 		Path:  "core/du",
 		Fn:    rcDu,
 		Title: "Returns disk usage of a locally attached disk.",
+		Params: []rc.Param{
+			{Name: "dir", Type: rc.TypeString, Help: "the local directory, default the cache dir"},
+		},
+		Result: []rc.Param{
+			{Name: "dir", Type: rc.TypeString, Help: "the directory"},
+			{Name: "info", Type: rc.TypeObject, Help: "the Available, Free and Total bytes"},
+		},
 		Help: `
 This returns the disk usage for the local directory passed in as dir.
 
@@ -706,6 +795,32 @@ func init() {
 		AuthRequired: true,
 		Fn:           rcCheck,
 		Title:        "check the source and destination are the same",
+		Params: []rc.Param{
+			{Name: "srcFs", Type: rc.TypeFs, Help: "the source remote - not used with checkFileHash"},
+			{Name: "dstFs", Type: rc.TypeFs, Required: true, Help: "the destination remote"},
+			{Name: "download", Type: rc.TypeBoolean, Help: "check by downloading rather than with hash"},
+			{Name: "checkFileHash", Type: rc.TypeString, Help: "treat checkFileFs:checkFileRemote as a SUM file with hashes of given type"},
+			{Name: "checkFileFs", Type: rc.TypeFs, Help: "remote with the SUM file"},
+			{Name: "checkFileRemote", Type: rc.TypeString, Help: "path of the SUM file within checkFileFs"},
+			{Name: "oneway", Type: rc.TypeBoolean, Help: "check one way only, source files must exist on remote"},
+			{Name: "combined", Type: rc.TypeBoolean, Help: "make a combined report of changes (default false)"},
+			{Name: "missingOnSrc", Type: rc.TypeBoolean, Help: "report all files missing from the source (default true)"},
+			{Name: "missingOnDst", Type: rc.TypeBoolean, Help: "report all files missing from the destination (default true)"},
+			{Name: "match", Type: rc.TypeBoolean, Help: "report all matching files (default false)"},
+			{Name: "differ", Type: rc.TypeBoolean, Help: "report all non-matching files (default true)"},
+			{Name: "error", Type: rc.TypeBoolean, Help: "report all files with errors (hashing or reading) (default true)"},
+		},
+		Result: []rc.Param{
+			{Name: "success", Type: rc.TypeBoolean, Help: "true if no error, false otherwise"},
+			{Name: "status", Type: rc.TypeString, Help: "textual summary of check, OK or text string"},
+			{Name: "hashType", Type: rc.TypeString, Help: "hash used in check, may be missing"},
+			{Name: "combined", Type: rc.TypeArray, Items: rc.TypeString, Help: "combined report of changes"},
+			{Name: "missingOnSrc", Type: rc.TypeArray, Items: rc.TypeString, Help: "all files missing from the source"},
+			{Name: "missingOnDst", Type: rc.TypeArray, Items: rc.TypeString, Help: "all files missing from the destination"},
+			{Name: "match", Type: rc.TypeArray, Items: rc.TypeString, Help: "all matching files"},
+			{Name: "differ", Type: rc.TypeArray, Items: rc.TypeString, Help: "all non-matching files"},
+			{Name: "error", Type: rc.TypeArray, Items: rc.TypeString, Help: "all files with errors (hashing or reading)"},
+		},
 		Help: `Checks the files in the source and destination match.  It compares
 sizes and hashes and logs a report of files that don't
 match.  It doesn't alter the source or destination.
@@ -718,7 +833,7 @@ This takes the following parameters:
 - checkFileHash - treat checkFileFs:checkFileRemote as a SUM file with hashes of given type
 - checkFileFs - treat checkFileFs:checkFileRemote as a SUM file with hashes of given type
 - checkFileRemote - treat checkFileFs:checkFileRemote as a SUM file with hashes of given type
-- oneWay -  check one way only, source files must exist on remote
+- oneway -  check one way only, source files must exist on remote
 - combined - make a combined report of changes (default false)
 - missingOnSrc - report all files missing from the source (default true)
 - missingOnDst - report all files missing from the destination (default true)
@@ -881,6 +996,16 @@ func init() {
 		AuthRequired: true,
 		Fn:           rcHashsum,
 		Title:        "Produces a hashsum file for all the objects in the path.",
+		Params: []rc.Param{
+			{Name: "fs", Type: rc.TypeFs, Required: true, Help: "the remote to hash - this can point to a file"},
+			{Name: "hashType", Type: rc.TypeString, Required: true, Help: "type of hash to be used"},
+			{Name: "download", Type: rc.TypeBoolean, Help: "check by downloading rather than with hash"},
+			{Name: "base64", Type: rc.TypeBoolean, Help: "output the hashes in base64 rather than hex"},
+		},
+		Result: []rc.Param{
+			{Name: "hashsum", Type: rc.TypeArray, Items: rc.TypeString, Help: "the hashes"},
+			{Name: "hashType", Type: rc.TypeString, Help: "type of hash used"},
+		},
 		Help: `Produces a hash file for all the objects in the path using the hash
 named.  The output is in the same format as the standard
 md5sum/sha1sum tool.
@@ -0,0 +1,160 @@
+// Package events passes events from around rclone to subscribers,
+// such as the clients of the rc event stream.
+package events
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// Types of event
+const (
+	JobStart         = "job/start"         // a background job started
+	JobFinish        = "job/finish"        // a background job finished
+	TransferStart    = "transfer/start"    // a file transfer started
+	TransferComplete = "transfer/complete" // a file transfer completed
+	TransferFail     = "transfer/fail"     // a file transfer failed
+	Log              = "log"               // a line was logged
+	VFSUpload        = "vfs/upload"        // the VFS upload queue changed
+	Mount            = "mount/mount"       // a remote was mounted
+	Unmount          = "mount/unmount"     // a remote was unmounted
+	ServeStart       = "serve/start"       // a server was started
+	ServeStop        = "serve/stop"        // a server stopped
+	Lost             = "lost"              // events were lost as the subscriber didn't keep up
+)
+
+// Event is something that happened in rclone
+type Event struct {
+	ID    uint64      `json:"id"`              // increasing sequence number
+	Type  string      `json:"type"`            // one of the types above
+	Time  time.Time   `json:"time"`            // when the event happened
+	JobID int64       `json:"jobid,omitempty"` // the job the event belongs to, if known
+	Group string      `json:"group,omitempty"` // the stats group the event belongs to, if known
+	Data  interface{} `json:"data,omitempty"`  // details of the event depending on its type
+}
+
+// MatchType returns whether eventType is one of types or starts with
+// one of them followed by "/", so "job" matches "job/start".
+func MatchType(eventType string, types []string) bool {
+	for _, t := range types {
+		if eventType == t || strings.HasPrefix(eventType, t+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscriber receives the events passing its filter
+type Subscriber struct {
+	c      chan *Event
+	filter func(*Event) bool
+	lost   atomic.Int64
+}
+
+var (
+	mu          sync.Mutex
+	subscribers = map[*Subscriber]struct{}{}
+	active      atomic.Int32 // number of subscribers
+	seq         atomic.Uint64
+)
+
+// Active returns whether there are any subscribers
+//
+// Use this to avoid making events nobody will receive.
+func Active() bool {
+	return active.Load() > 0
+}
+
+// Publish e to the subscribers, filling in its ID and Time
+//
+// This never blocks. Subscribers which don't keep up lose events.
+// The subscribers share e so it mustn't be changed afterwards.
+func Publish(e *Event) {
+	if !Active() {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	e.ID = seq.Add(1)
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for s := range subscribers {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			s.lost.Add(1)
+		}
+	}
+}
+
+// Subscribe returns a Subscriber receiving the events for which filter
+// returns true, or all events if filter is nil. Up to buffer events
+// are kept for it to read.
+//
+// Close must be called on it when done.
+func Subscribe(buffer int, filter func(*Event) bool) *Subscriber {
+	s := &Subscriber{
+		c:      make(chan *Event, buffer),
+		filter: filter,
+	}
+	mu.Lock()
+	subscribers[s] = struct{}{}
+	active.Add(1)
+	mu.Unlock()
+	return s
+}
+
+// Events returns the channel to read the events from
+func (s *Subscriber) Events() <-chan *Event {
+	return s.c
+}
+
+// Lost returns the number of events lost since it was last called
+// because the subscriber wasn't reading them quickly enough.
+func (s *Subscriber) Lost() int64 {
+	return s.lost.Swap(0)
+}
+
+// Close stops the subscription
+func (s *Subscriber) Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := subscribers[s]; ok {
+		delete(subscribers, s)
+		active.Add(-1)
+	}
+}
+
+// publish log lines as events
+func logHook(level fs.LogLevel, o interface{}, text string, args []interface{}) {
+	if !Active() {
+		return
+	}
+	if args != nil {
+		text = fmt.Sprintf(text, args...)
+	}
+	data := map[string]interface{}{
+		"level": level.String(),
+		"msg":   text,
+	}
+	if o != nil {
+		data["object"] = fmt.Sprintf("%v", o)
+	}
+	Publish(&Event{
+		Type: Log,
+		Data: data,
+	})
+}
+
+func init() {
+	fs.LogHook = logHook
+}
@@ -0,0 +1,70 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	assert.False(t, Active())
+	Publish(&Event{Type: JobStart}) // nobody listening
+
+	all := Subscribe(10, nil)
+	jobs := Subscribe(10, func(e *Event) bool { return e.Type == JobStart })
+	assert.True(t, Active())
+
+	Publish(&Event{Type: JobStart, JobID: 1})
+	Publish(&Event{Type: TransferStart, Group: "job/1"})
+
+	e := <-all.Events()
+	assert.Equal(t, JobStart, e.Type)
+	assert.Equal(t, int64(1), e.JobID)
+	assert.False(t, e.Time.IsZero())
+	first := e.ID
+	e = <-all.Events()
+	assert.Equal(t, TransferStart, e.Type)
+	assert.Equal(t, first+1, e.ID)
+
+	e = <-jobs.Events()
+	assert.Equal(t, JobStart, e.Type)
+	assert.Equal(t, 0, len(jobs.Events()))
+
+	all.Close()
+	all.Close() // closing twice is OK
+	jobs.Close()
+	assert.False(t, Active())
+}
+
+func TestLost(t *testing.T) {
+	s := Subscribe(1, nil)
+	defer s.Close()
+	for i := 0; i < 3; i++ {
+		Publish(&Event{Type: Log})
+	}
+	assert.Equal(t, 1, len(s.Events()))
+	assert.Equal(t, int64(2), s.Lost())
+	assert.Equal(t, int64(0), s.Lost())
+}
+
+func TestLogHook(t *testing.T) {
+	s := Subscribe(10, func(e *Event) bool { return e.Type == Log })
+	defer s.Close()
+	fs.Logf("potato", "hello %d", 42)
+	e := <-s.Events()
+	require.Equal(t, Log, e.Type)
+	data := e.Data.(map[string]interface{})
+	assert.Equal(t, "NOTICE", data["level"])
+	assert.Equal(t, "hello 42", data["msg"])
+	assert.Equal(t, "potato", data["object"])
+}
+
+func TestMatchType(t *testing.T) {
+	assert.True(t, MatchType(JobStart, []string{"job"}))
+	assert.True(t, MatchType(JobStart, []string{"log", "job/start"}))
+	assert.False(t, MatchType(JobStart, []string{"jo"}))
+	assert.False(t, MatchType(Log, []string{"job"}))
+	assert.False(t, MatchType(Log, nil))
+}
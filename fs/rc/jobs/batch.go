@@ -0,0 +1,141 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"golang.org/x/sync/errgroup"
+)
+
+// BatchCall is one of the calls made by rc/batch
+type BatchCall struct {
+	Path   string    `json:"path"`
+	Params rc.Params `json:"params"`
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "rc/batch",
+		AuthRequired: true,
+		Fn:           rcBatch,
+		Title:        "Run many rc calls in one request",
+		Params: []rc.Param{
+			{Name: "calls", Type: rc.TypeArray, Items: rc.TypeObject, Required: true, Help: "the calls to make, each an object with a path and params"},
+			{Name: "concurrency", Type: rc.TypeInteger, Help: "how many calls to run at once - default --checkers"},
+		},
+		Result: []rc.Param{
+			{Name: "results", Type: rc.TypeArray, Items: rc.TypeObject, Help: "the result of each call in the order given"},
+			{Name: "errors", Type: rc.TypeInteger, Help: "the number of calls which failed"},
+		},
+		Help: `This runs many rc calls in one request to save the round trips of
+making them one at a time.
+
+This takes the following parameters:
+
+- calls - a list of the calls to make, each an object with
+    - path - the rc call to make, e.g. "operations/stat"
+    - params - an object with the parameters of the call
+- concurrency - how many calls to run at once (optional, default --checkers)
+
+Returns
+
+- results - a list with an object for each call in the order given
+    - path - the rc call made
+    - status - the HTTP status the call would have returned on its own
+    - output - the output of the call if it succeeded
+    - error - the error if it failed, with input being its parameters
+- errors - the number of calls which failed
+
+A call failing doesn't stop the others, so check the status of each
+result. The calls are checked against their parameters and any API
+token as if they were made on their own. The calls may use the
+special parameters _config, _filter and _group but _async is ignored
+and rc/batch can't be nested.
+
+To run the whole batch in the background pass _async=true to
+rc/batch. It then runs as a single job whose output is the results.
+
+Example:
+
+    rclone rc rc/batch --json '{"calls": [
+        {"path": "operations/stat", "params": {"fs": "remote:", "remote": "file1.txt"}},
+        {"path": "operations/hashsum", "params": {"fs": "remote:dir", "hashType": "md5"}}
+    ]}'
+`,
+	})
+}
+
+// rcBatch runs the calls in the batch
+func rcBatch(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	var calls []BatchCall
+	err = in.GetStruct("calls", &calls)
+	if err != nil {
+		return nil, err
+	}
+	concurrency, err := in.GetInt64("concurrency")
+	if rc.IsErrParamNotFound(err) {
+		concurrency = int64(fs.GetConfig(ctx).Checkers)
+	} else if err != nil {
+		return nil, err
+	}
+	if concurrency < 1 {
+		return nil, rc.NewErrParamInvalid(fmt.Errorf("concurrency must be at least 1, not %d", concurrency))
+	}
+	results := make([]rc.Params, len(calls))
+	var g errgroup.Group
+	g.SetLimit(int(concurrency))
+	for i := range calls {
+		i := i
+		g.Go(func() error {
+			results[i] = runBatchCall(ctx, &calls[i])
+			return nil
+		})
+	}
+	_ = g.Wait()
+	failed := 0
+	for _, result := range results {
+		if _, isError := result["error"]; isError {
+			failed++
+		}
+	}
+	return rc.Params{
+		"results": results,
+		"errors":  failed,
+	}, nil
+}
+
+// runBatchCall runs a single call from the batch returning its result
+func runBatchCall(ctx context.Context, bc *BatchCall) rc.Params {
+	params := bc.Params.Copy()
+	fail := func(err error, status int) rc.Params {
+		fs.Debugf(nil, "rc: batch: %q: error: %v", bc.Path, err)
+		result, _ := rc.Error(bc.Path, bc.Params, err, status)
+		return result
+	}
+	call := rc.Calls.Get(bc.Path)
+	if call == nil {
+		return fail(fmt.Errorf("couldn't find method %q", bc.Path), http.StatusNotFound)
+	}
+	if call.NeedsRequest || call.NeedsResponse || call.Path == "rc/batch" {
+		return fail(fmt.Errorf("method %q can't be used in a batch", bc.Path), http.StatusBadRequest)
+	}
+	if err := call.Validate(params); err != nil {
+		return fail(err, http.StatusBadRequest)
+	}
+	delete(params, "_async")
+	_, out, err := NewJob(WithCommand(ctx, bc.Path), call.Fn, params)
+	if err != nil {
+		return fail(err, http.StatusInternalServerError)
+	}
+	if out == nil {
+		out = rc.Params{}
+	}
+	return rc.Params{
+		"path":   bc.Path,
+		"status": http.StatusOK,
+		"output": out,
+	}
+}
@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRcBatch(t *testing.T) {
+	ctx := context.Background()
+	// Don't leave the jobs the calls make in the global jobs
+	oldRunning := running
+	running = newJobs()
+	defer func() { running = oldRunning }()
+	call := rc.Calls.Get("rc/batch")
+	require.NotNil(t, call)
+
+	out, err := call.Fn(ctx, rc.Params{
+		"concurrency": 2,
+		"calls": []rc.Params{
+			{"path": "rc/noop", "params": rc.Params{"a": 1, "_async": true, "_config": rc.Params{"Checkers": 3}}},
+			{"path": "rc/error", "params": rc.Params{"b": 2}},
+			{"path": "job/status", "params": rc.Params{"jobid": "potato"}},
+			{"path": "potato/potato"},
+			{"path": "rc/batch", "params": rc.Params{"calls": []rc.Params{}}},
+			{"path": "rc/noop"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4, out["errors"])
+	results := out["results"].([]rc.Params)
+	require.Len(t, results, 6)
+
+	assert.Equal(t, rc.Params{"path": "rc/noop", "status": http.StatusOK, "output": rc.Params{"a": 1.0}}, results[0])
+	assert.Equal(t, http.StatusInternalServerError, results[1]["status"])
+	assert.Contains(t, results[1]["error"], "arbitrary error")
+	assert.Equal(t, rc.Params{"b": 2.0}, results[1]["input"])
+	assert.Equal(t, http.StatusBadRequest, results[2]["status"])
+	assert.Contains(t, results[2]["error"], `parameter "jobid" should be an integer`)
+	assert.Equal(t, http.StatusNotFound, results[3]["status"])
+	assert.Equal(t, http.StatusBadRequest, results[4]["status"])
+	assert.Contains(t, results[4]["error"], "can't be used in a batch")
+	assert.Equal(t, rc.Params{"path": "rc/noop", "status": http.StatusOK, "output": rc.Params{}}, results[5])
+
+	_, err = call.Fn(ctx, rc.Params{"calls": []rc.Params{}, "concurrency": 0})
+	assert.True(t, rc.IsErrParamInvalid(err))
+	_, err = call.Fn(ctx, rc.Params{})
+	assert.True(t, rc.IsErrParamNotFound(err))
+}
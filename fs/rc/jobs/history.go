@@ -0,0 +1,721 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// Statuses of the jobs in the history
+const (
+	StatusQueued      = "queued"
+	StatusRunning     = "running"
+	StatusSuccess     = "success"
+	StatusError       = "error"
+	StatusInterrupted = "interrupted"
+)
+
+// HistoryRecord is the record of a background job in the job history
+type HistoryRecord struct {
+	ID        int64     `json:"id"`
+	ExecuteID string    `json:"executeId"`
+	Command   string    `json:"command"`
+	Params    rc.Params `json:"params"`
+	Group     string    `json:"group"`
+	Status    string    `json:"status"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Error     string    `json:"error"`
+	Finished  bool      `json:"finished"`
+	Success   bool      `json:"success"`
+	Duration  float64   `json:"duration"`
+	Output    rc.Params `json:"output"`
+	Stats     rc.Params `json:"stats"`            // the stats group when the job finished
+	Resume    rc.Params `json:"resume,omitempty"` // params to queue the job again with if rclone restarts before it starts
+}
+
+// History keeps the records of background jobs in memory and in a
+// file so they survive restarts.
+//
+// The file has a JSON record on each line. Each change to a record
+// appends it to the file and the file is rewritten with only the
+// latest records when it gets too long.
+type History struct {
+	mu      sync.Mutex
+	path    string                  // file to persist the history in
+	max     int                     // max number of records to keep
+	records []*HistoryRecord        // records oldest first
+	jobs    map[*Job]*HistoryRecord // records of the jobs not finished
+	out     *os.File                // file being appended to
+	lines   int                     // number of lines in out
+}
+
+var (
+	historyMu sync.Mutex
+	history   *History
+)
+
+// historyPath returns the file to persist the history in
+func historyPath() string {
+	if running.opt.JobHistoryFile != "" {
+		return running.opt.JobHistoryFile
+	}
+	return filepath.Join(config.GetCacheDir(), "rc", "history.jsonl")
+}
+
+// StartHistory loads the job history and starts recording background
+// jobs in it if not already started and --rc-job-history-max isn't 0.
+//
+// If no jobs have been run the job IDs carry on from those in the
+// history. Jobs started with _async which were still queued when
+// rclone stopped are queued again.
+func StartHistory() error {
+	h, err := startHistory()
+	if h == nil || err != nil {
+		return err
+	}
+	h.requeue()
+	return nil
+}
+
+// startHistory loads the job history returning it if it was started
+func startHistory() (*History, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if history != nil || running.opt.JobHistoryMax <= 0 {
+		return nil, nil
+	}
+	h, err := newHistory(historyPath(), running.opt.JobHistoryMax)
+	if err != nil {
+		return nil, err
+	}
+	var lastID int64
+	for _, record := range h.records {
+		if record.ID > lastID {
+			lastID = record.ID
+		}
+	}
+	jobID.CompareAndSwap(0, lastID)
+	history = h
+	return h, nil
+}
+
+// requeue starts the jobs which were queued when rclone stopped again
+func (h *History) requeue() {
+	h.mu.Lock()
+	var records []*HistoryRecord
+	for _, record := range h.records {
+		if record.Resume != nil {
+			records = append(records, record)
+		}
+	}
+	h.mu.Unlock()
+	for _, record := range records {
+		var message string
+		call := rc.Calls.Get(record.Command)
+		if call == nil {
+			message = fmt.Sprintf("rclone stopped before the job started and it couldn't be queued again: command %q not found", record.Command)
+		} else {
+			job, _, err := running.NewJob(WithCommand(context.Background(), record.Command), call.Fn, record.Resume)
+			if err != nil {
+				message = fmt.Sprintf("rclone stopped before the job started and it couldn't be queued again: %v", err)
+			} else {
+				message = fmt.Sprintf("rclone stopped before the job started so it was queued again as job %d", job.ID)
+			}
+		}
+		fs.Infof(nil, "rc: job %d: %s", record.ID, message)
+		h.mu.Lock()
+		record.Error = message
+		record.Resume = nil
+		h.save(record)
+		h.mu.Unlock()
+	}
+	if len(records) > 0 {
+		// Rewrite the file so the unredacted params aren't kept
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if err := h.compact(); err != nil {
+			fs.Errorf(nil, "rc: %v", err)
+		}
+	}
+}
+
+// getHistory returns the History or nil if it isn't being kept
+func getHistory() *History {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	return history
+}
+
+// stopHistory stops recording the history - used in tests
+func stopHistory() {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if history != nil {
+		history.close()
+		history = nil
+	}
+}
+
+// newHistory loads the history from path
+func newHistory(path string, max int) (*History, error) {
+	h := &History{
+		path: path,
+		max:  max,
+		jobs: map[*Job]*HistoryRecord{},
+	}
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	h.trim()
+	if err := h.compact(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// load the records from disk
+func (h *History) load() (err error) {
+	in, err := os.Open(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read job history: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+	type key struct {
+		executeID string
+		id        int64
+	}
+	index := map[key]int{}
+	dec := json.NewDecoder(in)
+	for {
+		var record HistoryRecord
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Keep what has been read, e.g. if the last line was
+			// only partially written
+			fs.Errorf(nil, "rc: ignoring the rest of job history %q: %v", h.path, err)
+			break
+		}
+		record.Params = redactParams(record.Params)
+		k := key{record.ExecuteID, record.ID}
+		if i, ok := index[k]; ok {
+			h.records[i] = &record
+		} else {
+			index[k] = len(h.records)
+			h.records = append(h.records, &record)
+		}
+	}
+	for _, record := range h.records {
+		if !record.Finished {
+			if record.Status != StatusQueued {
+				record.Resume = nil
+			}
+			record.Status = StatusInterrupted
+			record.Finished = true
+			record.Error = "rclone stopped before the job finished"
+		}
+	}
+	fs.Debugf(nil, "rc: loaded %d jobs from history %q", len(h.records), h.path)
+	return nil
+}
+
+// trim removes the oldest finished records over the max - call with
+// the lock held
+func (h *History) trim() {
+	excess := len(h.records) - h.max
+	if excess <= 0 {
+		return
+	}
+	kept := h.records[:0]
+	for _, record := range h.records {
+		if excess > 0 && record.Finished && record.Resume == nil {
+			excess--
+			continue
+		}
+		kept = append(kept, record)
+	}
+	h.records = kept
+}
+
+// compact rewrites the file with the current records and opens it
+// for appending - call with the lock held
+func (h *History) compact() error {
+	if h.out != nil {
+		_ = h.out.Close()
+		h.out = nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return fmt.Errorf("failed to save job history: %w", err)
+	}
+	tmp := h.path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to save job history: %w", err)
+	}
+	enc := json.NewEncoder(out)
+	for _, record := range h.records {
+		if err = enc.Encode(record); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = out.Close()
+	} else {
+		_ = out.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp, h.path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save job history: %w", err)
+	}
+	h.out, err = os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open job history: %w", err)
+	}
+	h.lines = len(h.records)
+	return nil
+}
+
+// save record to disk - call with the lock held
+func (h *History) save(record *HistoryRecord) {
+	if h.lines >= 2*h.max+100 {
+		if err := h.compact(); err != nil {
+			fs.Errorf(nil, "rc: %v", err)
+		}
+	}
+	if h.out == nil {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err == nil {
+		_, err = h.out.Write(append(data, '\n'))
+	}
+	if err != nil {
+		fs.Errorf(nil, "rc: failed to save job %d to history: %v", record.ID, err)
+		return
+	}
+	h.lines++
+}
+
+// close the history file
+func (h *History) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.out != nil {
+		_ = h.out.Close()
+		h.out = nil
+	}
+}
+
+// redactedParams are the parameters whose values are never saved in
+// the history
+var redactedParams = []string{"_config", "_notify"}
+
+// redactParams returns a copy of params with the values of the
+// parameters in redactedParams and the sensitive options in any
+// connection strings hidden
+func redactParams(params rc.Params) rc.Params {
+	if params == nil {
+		return nil
+	}
+	out := make(rc.Params, len(params))
+	for key, value := range params {
+		out[key] = redactValue(value)
+	}
+	for _, key := range redactedParams {
+		if _, ok := out[key]; ok {
+			out[key] = "XXX"
+		}
+	}
+	return out
+}
+
+// redactValue returns value with the sensitive options in any
+// connection strings in it hidden
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return redactRemote(v)
+	case rc.Params:
+		return redactParams(v)
+	case map[string]interface{}:
+		return map[string]interface{}(redactParams(v))
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i := range v {
+			out[i] = redactValue(v[i])
+		}
+		return out
+	}
+	return value
+}
+
+// redactRemote returns remote with the values of the sensitive
+// options in its connection string hidden. If the backend can't be
+// found all the values are hidden.
+func redactRemote(remote string) string {
+	parsed, err := fspath.Parse(remote)
+	if err != nil || len(parsed.Config) == 0 {
+		return remote
+	}
+	fsInfo, _, _, _, err := fs.ParseRemote(remote)
+	config := make(configmap.Simple, len(parsed.Config))
+	for key, value := range parsed.Config {
+		if err != nil || fsInfo == nil {
+			value = "XXX"
+		} else if o := fsInfo.Options.Get(key); o != nil && (o.Sensitive || o.IsPassword) && value != "" {
+			value = "XXX"
+		}
+		config[key] = value
+	}
+	return parsed.Name + "," + config.String() + ":" + parsed.Path
+}
+
+// add a record for job
+//
+// If resume is set the job can be queued again with it if rclone
+// restarts before the job starts. It is saved without being redacted.
+func (h *History) add(job *Job, command string, params rc.Params, resume rc.Params) {
+	// These can't be saved, nor can the calls which need them be
+	// queued again
+	for _, key := range []string{"_request", "_response"} {
+		if _, found := params[key]; found {
+			delete(params, key)
+			resume = nil
+		}
+	}
+	if resume != nil {
+		resume = resume.Copy()
+		resume["_async"] = true
+	}
+	job.mu.Lock()
+	record := &HistoryRecord{
+		ID:        job.ID,
+		ExecuteID: executeID,
+		Command:   command,
+		Params:    redactParams(params),
+		Group:     job.Group,
+		Status:    StatusRunning,
+		StartTime: job.StartTime,
+	}
+	if job.Queued {
+		record.Status = StatusQueued
+		record.Resume = resume
+	}
+	job.recorded = true
+	job.mu.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, record)
+	h.jobs[job] = record
+	h.trim()
+	h.save(record)
+}
+
+// started updates the record of job when it starts after being queued
+func (h *History) started(job *Job) {
+	job.mu.Lock()
+	startTime := job.StartTime
+	job.mu.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	record := h.jobs[job]
+	if record == nil {
+		return
+	}
+	record.Status = StatusRunning
+	record.StartTime = startTime
+	record.Resume = nil
+	h.save(record)
+}
+
+// finished updates the record of job when it has finished
+func (h *History) finished(job *Job) {
+	var stats rc.Params
+	if s := accounting.LookupStatsGroup(job.Group); s != nil {
+		var err error
+		stats, err = s.RemoteStats()
+		if err != nil {
+			fs.Errorf(nil, "rc: failed to read stats of job %d: %v", job.ID, err)
+		}
+	}
+	job.mu.Lock()
+	update := HistoryRecord{
+		StartTime: job.StartTime,
+		EndTime:   job.EndTime,
+		Error:     job.Error,
+		Finished:  true,
+		Success:   job.Success,
+		Duration:  job.Duration,
+		Output:    job.Output,
+		Stats:     stats,
+	}
+	job.mu.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	record := h.jobs[job]
+	if record == nil {
+		return
+	}
+	delete(h.jobs, job)
+	record.StartTime = update.StartTime
+	record.EndTime = update.EndTime
+	record.Error = update.Error
+	record.Finished = true
+	record.Success = update.Success
+	record.Duration = update.Duration
+	record.Output = update.Output
+	record.Stats = update.Stats
+	record.Resume = nil
+	if record.Success {
+		record.Status = StatusSuccess
+	} else {
+		record.Status = StatusError
+	}
+	h.save(record)
+	h.trim()
+}
+
+// recordJob adds job to the history if it is being kept
+func recordJob(job *Job, command string, params rc.Params, resume rc.Params) {
+	if h := getHistory(); h != nil {
+		h.add(job, command, params, resume)
+	}
+}
+
+// recordStarted notes job has started in the history
+func recordStarted(job *Job) {
+	if h := getHistory(); h != nil {
+		h.started(job)
+	}
+}
+
+// recordFinished notes job has finished in the history
+func recordFinished(job *Job) {
+	if h := getHistory(); h != nil {
+		h.finished(job)
+	}
+}
+
+// reshape returns record as rc.Params - call with the lock held
+func (record *HistoryRecord) reshape() (rc.Params, error) {
+	var out rc.Params
+	err := rc.Reshape(&out, record)
+	if err != nil {
+		return nil, fmt.Errorf("reshape failed in job history: %w", err)
+	}
+	delete(out, "resume")
+	return out, nil
+}
+
+// historyStatus returns the latest record of the job with the given
+// ID without its params or nil if not found
+func historyStatus(id int64) rc.Params {
+	h := getHistory()
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := len(h.records) - 1; i >= 0; i-- {
+		if record := h.records[i]; record.ID == id {
+			out, err := record.reshape()
+			if err != nil {
+				fs.Errorf(nil, "rc: %v", err)
+				return nil
+			}
+			delete(out, "params")
+			return out
+		}
+	}
+	return nil
+}
+
+// HistoryFilter selects records from the History
+type HistoryFilter struct {
+	Command   string    // glob to match the command with
+	Group     string    // stats group
+	Status    string    // one of the Status constants
+	ExecuteID string    // id of the rclone run
+	Since     time.Time // started at or after this
+	Until     time.Time // started before this
+}
+
+// match returns whether record passes the filter
+func (hf *HistoryFilter) match(record *HistoryRecord) bool {
+	if hf.Command != "" {
+		if ok, _ := path.Match(hf.Command, record.Command); !ok {
+			return false
+		}
+	}
+	switch {
+	case hf.Group != "" && record.Group != hf.Group:
+		return false
+	case hf.Status != "" && record.Status != hf.Status:
+		return false
+	case hf.ExecuteID != "" && record.ExecuteID != hf.ExecuteID:
+		return false
+	case !hf.Since.IsZero() && record.StartTime.Before(hf.Since):
+		return false
+	case !hf.Until.IsZero() && !record.StartTime.Before(hf.Until):
+		return false
+	}
+	return true
+}
+
+// List returns up to limit records passing the filter, newest first,
+// after skipping offset of them along with the total number passing.
+func (h *History) List(filter *HistoryFilter, offset, limit int) (records []rc.Params, total int, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	records = []rc.Params{}
+	for i := len(h.records) - 1; i >= 0; i-- {
+		record := h.records[i]
+		if !filter.match(record) {
+			continue
+		}
+		total++
+		if total <= offset || len(records) >= limit {
+			continue
+		}
+		out, err := record.reshape()
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, out)
+	}
+	return records, total, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "job/history",
+		AuthRequired: true,
+		Fn:           rcJobHistory,
+		Title:        "Lists the background jobs in the job history",
+		Params: []rc.Param{
+			{Name: "command", Type: rc.TypeString, Help: `only jobs running commands matching this, may use wildcards, e.g. "sync/*"`},
+			{Name: "group", Type: rc.TypeString, Help: "only jobs in this stats group"},
+			{Name: "status", Type: rc.TypeString, Help: "only jobs with this status: queued, running, success, error or interrupted"},
+			{Name: "executeId", Type: rc.TypeString, Help: "only jobs started by this run of rclone as returned by job/list"},
+			{Name: "since", Type: rc.TypeString, Help: `only jobs started at or after this time, e.g. "2024-01-10T12:00:00Z"`},
+			{Name: "until", Type: rc.TypeString, Help: "only jobs started before this time"},
+			{Name: "offset", Type: rc.TypeInteger, Help: "number of matching jobs to skip"},
+			{Name: "limit", Type: rc.TypeInteger, Help: "max number of jobs to return (default 100)"},
+		},
+		Result: []rc.Param{
+			{Name: "jobs", Type: rc.TypeArray, Items: rc.TypeObject, Help: "the jobs, newest first"},
+			{Name: "total", Type: rc.TypeInteger, Help: "number of jobs matching"},
+		},
+		Help: `This lists the jobs started with _async=true or by job/schedule,
+including those run before rclone restarted, newest first.
+
+The history is kept by "rclone rcd" in the file given by
+--rc-job-history-file and holds the last --rc-job-history-max jobs.
+
+Parameters (all optional):
+
+- command - only jobs running commands matching this, may use wildcards, e.g. "sync/*" (string)
+- group - only jobs in this stats group (string)
+- status - only jobs with this status: queued, running, success, error or interrupted (string)
+- executeId - only jobs started by this run of rclone as returned by job/list (string)
+- since - only jobs started at or after this time, e.g. "2024-01-10T12:00:00Z" (string)
+- until - only jobs started before this time (string)
+- offset - number of matching jobs to skip (integer, default 0)
+- limit - max number of jobs to return (integer, default 100)
+
+Results:
+
+- jobs - array of jobs each with
+    - id, group, startTime, endTime, error, finished, success, duration and output as returned by job/status
+    - executeId - id of the rclone run which started the job
+    - command - the rc command run
+    - params - the parameters passed to the command with the values of _config, _notify and any sensitive options in connection strings replaced with XXX
+    - status - one of queued, running, success, error or interrupted if rclone stopped while the job was running
+    - stats - the stats of the job's group when it finished as returned by core/stats
+- total - number of jobs matching
+
+Eg
+
+    rclone rc job/history command="sync/*" status=error limit=10
+`,
+	})
+}
+
+// Returns the job history
+func rcJobHistory(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	h := getHistory()
+	if h == nil {
+		return nil, errors.New("the job history isn't being kept: it is kept by rclone rcd if --rc-job-history-max isn't 0")
+	}
+	var filter HistoryFilter
+	for key, value := range map[string]*string{
+		"command":   &filter.Command,
+		"group":     &filter.Group,
+		"status":    &filter.Status,
+		"executeId": &filter.ExecuteID,
+	} {
+		if *value, err = in.GetString(key); rc.NotErrParamNotFound(err) {
+			return nil, err
+		}
+	}
+	if _, err = path.Match(filter.Command, ""); err != nil {
+		return nil, rc.NewErrParamInvalid(fmt.Errorf("bad command pattern: %w", err))
+	}
+	for key, value := range map[string]*time.Time{
+		"since": &filter.Since,
+		"until": &filter.Until,
+	} {
+		s, err := in.GetString(key)
+		if rc.IsErrParamNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if *value, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			return nil, rc.NewErrParamInvalid(fmt.Errorf("bad %s: %w", key, err))
+		}
+	}
+	offset, err := in.GetInt64("offset")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	limit, err := in.GetInt64("limit")
+	if rc.IsErrParamNotFound(err) {
+		limit = 100
+	} else if err != nil {
+		return nil, err
+	}
+	if offset < 0 || limit < 0 {
+		return nil, rc.NewErrParamInvalid(errors.New("offset and limit must not be negative"))
+	}
+	records, total, err := h.List(&filter, int(offset), int(limit))
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{
+		"jobs":  records,
+		"total": total,
+	}, nil
+}
@@ -0,0 +1,285 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestHistory starts recording the history in a temporary file
+func startTestHistory(t *testing.T, max int) (*History, string) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := newHistory(path, max)
+	require.NoError(t, err)
+	historyMu.Lock()
+	history = h
+	historyMu.Unlock()
+	t.Cleanup(stopHistory)
+	return h, path
+}
+
+// waitFinished waits for job to finish
+func waitFinished(t *testing.T, job *Job) {
+	assert.Eventually(t, func() bool {
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		return job.Finished
+	}, 10*time.Second, time.Millisecond)
+}
+
+func TestHistory(t *testing.T) {
+	h, path := startTestHistory(t, 3)
+	ctx := context.Background()
+	jobs := newJobs()
+
+	errFn := func(ctx context.Context, in rc.Params) (rc.Params, error) {
+		return nil, errors.New("potato")
+	}
+	release := make(chan struct{})
+	blockFn := func(ctx context.Context, in rc.Params) (rc.Params, error) {
+		<-release
+		return rc.Params{"done": true}, nil
+	}
+
+	// Jobs which aren't in the background aren't recorded
+	_, _, err := jobs.NewJob(WithCommand(ctx, "test/sync"), noopFn, rc.Params{})
+	require.NoError(t, err)
+	assert.Len(t, h.records, 0)
+
+	job1, _, err := jobs.NewJob(WithCommand(ctx, "sync/copy"), errFn, rc.Params{"_async": true, "srcFs": "a:"})
+	require.NoError(t, err)
+	waitFinished(t, job1)
+	job2, _, err := jobs.NewJob(WithCommand(ctx, "sync/sync"), blockFn, rc.Params{"_async": true, "_group": "mygroup"})
+	require.NoError(t, err)
+	job3, _, err := jobs.NewJob(WithCommand(ctx, "operations/purge"), noopFn, rc.Params{"_async": true})
+	require.NoError(t, err)
+	waitFinished(t, job3)
+
+	list := func(in rc.Params) (ids []float64, total int) {
+		out, err := rcJobHistory(ctx, in)
+		require.NoError(t, err)
+		for _, record := range out["jobs"].([]rc.Params) {
+			ids = append(ids, record["id"].(float64))
+		}
+		return ids, out["total"].(int)
+	}
+	ids, total := list(rc.Params{})
+	assert.Equal(t, []float64{float64(job3.ID), float64(job2.ID), float64(job1.ID)}, ids)
+	assert.Equal(t, 3, total)
+
+	out, err := rcJobHistory(ctx, rc.Params{"command": "sync/copy"})
+	require.NoError(t, err)
+	records := out["jobs"].([]rc.Params)
+	require.Len(t, records, 1)
+	record := records[0]
+	assert.Equal(t, "sync/copy", record["command"])
+	assert.Equal(t, map[string]interface{}{"srcFs": "a:"}, record["params"])
+	assert.Equal(t, StatusError, record["status"])
+	assert.Equal(t, "potato", record["error"])
+	assert.Equal(t, executeID, record["executeId"])
+	assert.Equal(t, true, record["finished"])
+
+	ids, total = list(rc.Params{"command": "sync/*"})
+	assert.Equal(t, []float64{float64(job2.ID), float64(job1.ID)}, ids)
+	assert.Equal(t, 2, total)
+	ids, _ = list(rc.Params{"status": StatusRunning})
+	assert.Equal(t, []float64{float64(job2.ID)}, ids)
+	ids, _ = list(rc.Params{"group": "mygroup"})
+	assert.Equal(t, []float64{float64(job2.ID)}, ids)
+	ids, _ = list(rc.Params{"since": time.Now().Add(time.Hour).Format(time.RFC3339)})
+	assert.Len(t, ids, 0)
+	ids, _ = list(rc.Params{"until": time.Now().Add(time.Hour).Format(time.RFC3339)})
+	assert.Len(t, ids, 3)
+
+	// Pagination
+	ids, total = list(rc.Params{"offset": 1, "limit": 1})
+	assert.Equal(t, []float64{float64(job2.ID)}, ids)
+	assert.Equal(t, 3, total)
+	ids, _ = list(rc.Params{"offset": 5})
+	assert.Len(t, ids, 0)
+
+	_, err = rcJobHistory(ctx, rc.Params{"since": "yesterday"})
+	assert.True(t, rc.IsErrParamInvalid(err))
+	_, err = rcJobHistory(ctx, rc.Params{"command": "["})
+	assert.True(t, rc.IsErrParamInvalid(err))
+
+	// job/status finds expired jobs in the history
+	jobs.mu.Lock()
+	delete(jobs.jobs, job1.ID)
+	jobs.mu.Unlock()
+	status := historyStatus(job1.ID)
+	require.NotNil(t, status)
+	assert.Equal(t, "potato", status["error"])
+	assert.NotContains(t, status, "params")
+
+	// Only the latest records are kept
+	job4, _, err := jobs.NewJob(WithCommand(ctx, "core/noop"), noopFn, rc.Params{"_async": true})
+	require.NoError(t, err)
+	waitFinished(t, job4)
+	ids, _ = list(rc.Params{})
+	assert.Equal(t, []float64{float64(job4.ID), float64(job3.ID), float64(job2.ID)}, ids)
+
+	// A restart marks the running job as interrupted
+	h2, err := newHistory(path, 3)
+	require.NoError(t, err)
+	defer h2.close()
+	require.Len(t, h2.records, 3)
+	interrupted := h2.records[0]
+	assert.Equal(t, job2.ID, interrupted.ID)
+	assert.Equal(t, StatusInterrupted, interrupted.Status)
+	assert.True(t, interrupted.Finished)
+	assert.Equal(t, "rclone stopped before the job finished", interrupted.Error)
+	assert.Equal(t, job4.ID, h2.records[2].ID)
+	assert.Equal(t, StatusSuccess, h2.records[2].Status)
+
+	// The file was compacted on loading
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(data), "\n"))
+
+	close(release)
+	waitFinished(t, job2)
+	ids, _ = list(rc.Params{"status": StatusSuccess})
+	assert.Equal(t, []float64{float64(job4.ID), float64(job3.ID), float64(job2.ID)}, ids)
+}
+
+func TestHistoryRequeue(t *testing.T) {
+	ctx := context.Background()
+	opt := rc.Opt
+	opt.JobMaxRunning = 1
+	opt.JobHistoryMax = 10
+	opt.JobHistoryFile = filepath.Join(t.TempDir(), "history.jsonl")
+	oldRunning := running
+	defer func() { running = oldRunning }()
+	running = newJobs()
+	running.opt = &opt
+	stopHistory()
+	require.NoError(t, StartHistory())
+	t.Cleanup(stopHistory)
+
+	release := make(chan struct{})
+	defer close(release)
+	blockFn := func(ctx context.Context, in rc.Params) (rc.Params, error) {
+		<-release
+		return rc.Params{}, nil
+	}
+	_, _, err := running.NewJob(WithCommand(ctx, "test/block"), blockFn, rc.Params{"_async": true})
+	require.NoError(t, err)
+	queued, _, err := running.NewJob(WithCommand(ctx, "rc/noop"), noopFn, rc.Params{
+		"_async":  true,
+		"_config": rc.Params{"Checkers": 3},
+		"fs":      ":nosuchbackend,pass=secret:",
+	})
+	require.NoError(t, err)
+	assert.True(t, queued.Queued)
+	missing, _, err := running.NewJob(WithCommand(ctx, "test/missing"), noopFn, rc.Params{"_async": true})
+	require.NoError(t, err)
+
+	// The parameters to queue the job again aren't returned
+	records, _, err := getHistory().List(&HistoryFilter{}, 0, 10)
+	require.NoError(t, err)
+	for _, record := range records {
+		assert.NotContains(t, record, "resume")
+	}
+
+	// Restart with none of the jobs running
+	stopHistory()
+	running = newJobs()
+	running.opt = &opt
+	require.NoError(t, StartHistory())
+	h := getHistory()
+	require.NotNil(t, h)
+
+	h.mu.Lock()
+	var requeued *HistoryRecord
+	for _, record := range h.records {
+		assert.Nil(t, record.Resume)
+		if record.ID > missing.ID {
+			requeued = record
+		}
+	}
+	h.mu.Unlock()
+	require.NotNil(t, requeued)
+	job := running.Get(requeued.ID)
+	require.NotNil(t, job)
+	waitFinished(t, job)
+	assert.True(t, job.Success)
+	assert.Equal(t, ":nosuchbackend,pass=secret:", job.Output["fs"])
+	status := historyStatus(job.ID)
+	require.NotNil(t, status)
+	assert.Equal(t, "rc/noop", status["command"])
+
+	status = historyStatus(queued.ID)
+	require.NotNil(t, status)
+	assert.Equal(t, StatusInterrupted, status["status"])
+	assert.Equal(t, fmt.Sprintf("rclone stopped before the job started so it was queued again as job %d", job.ID), status["error"])
+	status = historyStatus(missing.ID)
+	require.NotNil(t, status)
+	assert.Contains(t, status["error"], `command "test/missing" not found`)
+
+	// The unredacted params aren't left in the file
+	data, err := os.ReadFile(opt.JobHistoryFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"resume"`)
+}
+
+func TestHistoryNotKept(t *testing.T) {
+	stopHistory()
+	_, err := rcJobHistory(context.Background(), rc.Params{})
+	assert.ErrorContains(t, err, "isn't being kept")
+}
+
+func TestRedactParams(t *testing.T) {
+	// Fake a backend with sensitive options
+	const backendName = "jobs_history_test"
+	if regInfo, _ := fs.Find(backendName); regInfo == nil {
+		fs.Register(&fs.RegInfo{
+			Name: backendName,
+			Options: []fs.Option{
+				{Name: "user"},
+				{Name: "pass", IsPassword: true},
+				{Name: "token", Sensitive: true},
+			},
+		})
+	}
+
+	assert.Nil(t, redactParams(nil))
+	in := rc.Params{
+		"_config": map[string]interface{}{"BwLimit": "1M"},
+		"_notify": map[string]interface{}{"Webhook": "https://example.com/?token=secret"},
+		"srcFs":   "remote:path",
+		"dstFs":   ":nosuchbackend,pass=secret,user=bob:path",
+		"fs":      ":jobs_history_test,user=bob,pass=secret,token=secret:dir",
+		"inputs": []interface{}{
+			map[string]interface{}{"fs": ":nosuchbackend,pass=secret:"},
+		},
+		"opt": rc.Params{"fs": "/tmp,dir"},
+		"n":   3,
+	}
+	out := redactParams(in)
+	assert.Equal(t, rc.Params{
+		"_config": "XXX",
+		"_notify": "XXX",
+		"srcFs":   "remote:path",
+		"dstFs":   ":nosuchbackend,pass='XXX',user='XXX':path",
+		"fs":      ":jobs_history_test,pass='XXX',token='XXX',user='bob':dir",
+		"inputs": []interface{}{
+			map[string]interface{}{"fs": ":nosuchbackend,pass='XXX':"},
+		},
+		"opt": rc.Params{"fs": "/tmp,dir"},
+		"n":   3,
+	}, out)
+
+	// The input isn't changed
+	assert.Equal(t, ":nosuchbackend,pass=secret,user=bob:path", in["dstFs"])
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -15,7 +16,10 @@ import (
 	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/notify"
 	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/events"
+	"golang.org/x/sync/semaphore"
 )
 
 // Fill in these to avoid circular dependencies
@@ -34,11 +38,18 @@ type Job struct {
 	Error     string    `json:"error"`
 	Finished  bool      `json:"finished"`
 	Success   bool      `json:"success"`
+	Queued    bool      `json:"queued"`
 	Duration  float64   `json:"duration"`
 	Output    rc.Params `json:"output"`
 	Stop      func()    `json:"-"`
 	listeners []*func()
 
+	background bool                // set if this is a background job
+	command    string              // rc command the job is running if known
+	slot       *semaphore.Weighted // limit the background job holds or waits for a slot of, if any
+	recorded   bool                // set if the job is kept in the history
+	notify     *notify.Options     // where to send notifications about the job, if anywhere
+
 	// realErr is the Error before printing it as a string, it's used to return
 	// the real error to the upper application layers while still printing the
 	// string error message.
@@ -70,8 +81,92 @@ func (job *Job) finish(out rc.Params, err error) {
 		go (*job.listeners[i])()
 	}
 
+	recorded := job.recorded
+	payload := job.payload(notify.Success)
+	if !job.Success {
+		payload.Event = notify.Failure
+	}
+	var event *events.Event
+	if job.background && events.Active() {
+		event = &events.Event{
+			Type:  events.JobFinish,
+			JobID: job.ID,
+			Group: job.Group,
+			Data: rc.Params{
+				"command":  job.command,
+				"success":  job.Success,
+				"error":    job.Error,
+				"duration": job.Duration,
+			},
+		}
+	}
 	job.mu.Unlock()
 	running.kickExpire() // make sure this job gets expired
+	if recorded {
+		recordFinished(job)
+	}
+	if event != nil {
+		events.Publish(event)
+	}
+	job.sendNotification(payload)
+}
+
+// payload makes a notification about the job for event
+//
+// Call with the lock held.
+func (job *Job) payload(event string) *notify.Payload {
+	p := &notify.Payload{
+		Event:     event,
+		Source:    "job",
+		Command:   job.command,
+		JobID:     job.ID,
+		Group:     job.Group,
+		StartTime: job.StartTime,
+	}
+	if job.Finished {
+		p.EndTime = job.EndTime
+		p.Duration = job.Duration
+		p.Error = job.Error
+	}
+	return p
+}
+
+// sendNotification sends p in the background if the job wants it
+func (job *Job) sendNotification(p *notify.Payload) {
+	if !job.notify.Wants(p.Event) {
+		return
+	}
+	if p.Event != notify.Start {
+		if s := accounting.LookupStatsGroup(job.Group); s != nil {
+			p.Stats, _ = s.RemoteStats()
+		}
+	}
+	go func() {
+		err := notify.Send(context.Background(), job.notify, p)
+		if err != nil {
+			fs.Errorf(nil, "job %d: %v", job.ID, err)
+		}
+	}()
+}
+
+// started publishes an event and sends a notification to say the job
+// has started
+func (job *Job) started() {
+	job.mu.Lock()
+	payload := job.payload(notify.Start)
+	job.mu.Unlock()
+	job.sendNotification(payload)
+	if !job.background || !events.Active() {
+		return
+	}
+	events.Publish(&events.Event{
+		Type:  events.JobStart,
+		JobID: job.ID,
+		Group: job.Group,
+		Data: rc.Params{
+			"command": job.command,
+		},
+	})
 }
 
 func (job *Job) addListener(fn *func()) {
@@ -118,6 +213,8 @@ type Jobs struct {
 	jobs          map[int64]*Job
 	opt           *rc.Options
 	expireRunning bool
+	limit         *semaphore.Weighted // limits the background jobs running if set
+	queued        atomic.Int64        // number of background jobs waiting to run
 }
 
 var (
@@ -176,6 +273,70 @@ func (jobs *Jobs) Expire() {
 	}
 }
 
+// getLimit returns the semaphore limiting the number of background
+// jobs running or nil if there is no limit.
+func (jobs *Jobs) getLimit() *semaphore.Weighted {
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+	if jobs.limit == nil && jobs.opt.JobMaxRunning > 0 {
+		jobs.limit = semaphore.NewWeighted(int64(jobs.opt.JobMaxRunning))
+	}
+	return jobs.limit
+}
+
+// reserve a slot to run a background job in
+//
+// It returns the limit the slot is from, or nil if there is no limit,
+// and whether the job must be queued to wait for the slot.
+func (jobs *Jobs) reserve() (limit *semaphore.Weighted, queued bool, err error) {
+	limit = jobs.getLimit()
+	if limit == nil || limit.TryAcquire(1) {
+		return limit, false, nil
+	}
+	n := jobs.queued.Add(1)
+	if max := jobs.opt.JobMaxQueued; max > 0 && n > int64(max) {
+		jobs.queued.Add(-1)
+		return nil, false, fmt.Errorf("job queue full: %d jobs already waiting to run", max)
+	}
+	return limit, true, nil
+}
+
+// run the job to completion, waiting for a slot to run it in first if
+// it is queued
+func (jobs *Jobs) run(ctx context.Context, job *Job, fn rc.Func, in rc.Params) {
+	if !job.Queued {
+		job.started()
+	}
+	if job.slot == nil {
+		job.run(ctx, fn, in)
+		return
+	}
+	if job.Queued {
+		err := job.slot.Acquire(ctx, 1)
+		jobs.queued.Add(-1)
+		if err != nil {
+			job.finish(nil, fmt.Errorf("job stopped while queued: %w", err))
+			return
+		}
+		job.mu.Lock()
+		job.Queued = false
+		job.StartTime = time.Now()
+		recorded := job.recorded
+		job.mu.Unlock()
+		if recorded {
+			recordStarted(job)
+		}
+		job.started()
+	}
+	defer job.slot.Release(1)
+	job.run(ctx, fn, in)
+}
+
+// Queued returns the number of background jobs waiting to run
+func (jobs *Jobs) Queued() int64 {
+	return jobs.queued.Load()
+}
+
 // IDs returns the IDs of the running jobs
 func (jobs *Jobs) IDs() (IDs []int64) {
 	jobs.mu.RLock()
@@ -222,6 +383,60 @@ func getAsync(ctx context.Context, in rc.Params) (context.Context, bool, error)
 	return ctx, isAsync, nil
 }
 
+// notifyParams are the settings which may be passed in _notify.
+//
+// Commands to run can only be set with --notify-command so callers of
+// the rc can't run them.
+var notifyParams = []string{"Webhook", "On", "Timeout"}
+
+// See if _notify is set and work out where to send the notifications
+// about the job if anywhere.
+//
+// Background jobs notify as set by the --notify flags unless _notify
+// overrides them.
+func getNotify(in rc.Params, background bool) (*notify.Options, error) {
+	// Copy the lists so decoding _notify doesn't overwrite the globals
+	opt := notify.Opt
+	opt.Webhook = append([]string(nil), opt.Webhook...)
+	opt.Command = append(fs.SpaceSepList(nil), opt.Command...)
+	opt.On = append(fs.CommaSepList(nil), opt.On...)
+	if _, ok := in["_notify"]; !ok {
+		if background && opt.Enabled() {
+			return &opt, nil
+		}
+		return nil, nil
+	}
+	var settings rc.Params
+	err := in.GetStruct("_notify", &settings)
+	if err != nil {
+		return nil, err
+	}
+	for key := range settings {
+		found := false
+		for _, name := range notifyParams {
+			if strings.EqualFold(key, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, rc.NewErrParamInvalid(fmt.Errorf("can't set %q in _notify: only %s may be set", key, strings.Join(notifyParams, ", ")))
+		}
+	}
+	update := struct {
+		Webhook []string
+		On      fs.CommaSepList
+		Timeout fs.Duration
+	}{opt.Webhook, opt.On, opt.Timeout}
+	err = in.GetStruct("_notify", &update)
+	if err != nil {
+		return nil, err
+	}
+	opt.Webhook, opt.On, opt.Timeout = update.Webhook, update.On, update.Timeout
+	delete(in, "_notify") // remove the parameter
+	return &opt, nil
+}
+
 // See if _config is set and if so adjust ctx to include it
 func getConfig(ctx context.Context, in rc.Params) (context.Context, error) {
 	if _, ok := in["_config"]; !ok {
@@ -262,15 +477,40 @@ type jobKeyType struct{}
 // Key for adding jobs to ctx
 var jobKey = jobKeyType{}
 
+type commandKeyType struct{}
+
+// Key for adding the rc command to ctx
+var commandKey = commandKeyType{}
+
+// WithCommand returns a copy of ctx noting that the jobs started with
+// it run the rc command given, e.g. "sync/sync".
+//
+// This is used to describe the jobs in the job history.
+func WithCommand(ctx context.Context, command string) context.Context {
+	return context.WithValue(ctx, commandKey, command)
+}
+
 // NewJob creates a Job and executes it, possibly in the background if _async is set
 func (jobs *Jobs) NewJob(ctx context.Context, fn rc.Func, in rc.Params) (job *Job, out rc.Params, err error) {
+	return jobs.newJob(ctx, fn, in, false)
+}
+
+// newJob creates a Job and executes it
+//
+// Jobs with _async set and those with background set are background
+// jobs. These may be queued to limit the number running and are kept
+// in the history. Jobs with background set still run synchronously.
+func (jobs *Jobs) newJob(ctx context.Context, fn rc.Func, in rc.Params, background bool) (job *Job, out rc.Params, err error) {
 	id := jobID.Add(1)
 	in = in.Copy() // copy input so we can change it
+	command, _ := ctx.Value(commandKey).(string)
 
 	ctx, isAsync, err := getAsync(ctx, in)
 	if err != nil {
 		return nil, nil, err
 	}
+	background = background || isAsync
+	params := in.Copy() // parameters for the history
 
 	ctx, err = getConfig(ctx, in)
 	if err != nil {
@@ -287,6 +527,11 @@ func (jobs *Jobs) NewJob(ctx context.Context, fn rc.Func, in rc.Params) (job *Jo
 		return nil, nil, err
 	}
 
+	notifyOpt, err := getNotify(in, background)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	stop := func() {
 		cancel()
@@ -294,26 +539,46 @@ func (jobs *Jobs) NewJob(ctx context.Context, fn rc.Func, in rc.Params) (job *Jo
 		<-ctx.Done()
 	}
 	job = &Job{
-		ID:        id,
-		Group:     group,
-		StartTime: time.Now(),
-		Stop:      stop,
+		ID:         id,
+		Group:      group,
+		StartTime:  time.Now(),
+		Stop:       stop,
+		background: background,
+		command:    command,
+		notify:     notifyOpt,
+	}
+	if background {
+		job.slot, job.Queued, err = jobs.reserve()
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
 	}
 
 	jobs.mu.Lock()
 	jobs.jobs[job.ID] = job
 	jobs.mu.Unlock()
 
+	if background {
+		// Jobs started with _async which are queued can be
+		// queued again if rclone restarts before they start
+		var resume rc.Params
+		if isAsync && job.Queued {
+			resume = params
+		}
+		recordJob(job, command, params, resume)
+	}
+
 	// Add the job to the context
 	ctx = context.WithValue(ctx, jobKey, job)
 
 	if isAsync {
-		go job.run(ctx, fn, in)
+		go jobs.run(ctx, job, fn, in)
 		out = make(rc.Params)
 		out["jobid"] = job.ID
 		err = nil
 	} else {
-		job.run(ctx, fn, in)
+		jobs.run(ctx, job, fn, in)
 		out = job.Output
 		err = job.realErr
 	}
@@ -356,6 +621,21 @@ func init() {
 		Path:  "job/status",
 		Fn:    rcJobStatus,
 		Title: "Reads the status of the job ID",
+		Params: []rc.Param{
+			{Name: "jobid", Type: rc.TypeInteger, Required: true, Help: "id of the job"},
+		},
+		Result: []rc.Param{
+			{Name: "id", Type: rc.TypeInteger, Help: "id of the job"},
+			{Name: "group", Type: rc.TypeString, Help: "stats group of the job"},
+			{Name: "startTime", Type: rc.TypeString, Help: "time the job started"},
+			{Name: "endTime", Type: rc.TypeString, Help: "time the job finished"},
+			{Name: "duration", Type: rc.TypeNumber, Help: "time in seconds that the job ran for"},
+			{Name: "finished", Type: rc.TypeBoolean, Help: "whether the job has finished"},
+			{Name: "success", Type: rc.TypeBoolean, Help: "true for success false otherwise"},
+			{Name: "queued", Type: rc.TypeBoolean, Help: "whether the job is waiting to run"},
+			{Name: "error", Type: rc.TypeString, Help: "error from the job or empty string for no error"},
+			{Name: "output", Type: rc.TypeObject, Help: "output of the job as would have been returned if called synchronously"},
+		},
 		Help: `Parameters:
 
 - jobid - id of the job (integer).
@@ -370,8 +650,13 @@ Results:
 - id - as passed in above
 - startTime - time the job started (e.g. "2018-10-26T18:50:20.528336039+01:00")
 - success - boolean - true for success false otherwise
+- queued - boolean whether the job is waiting to run
 - output - output of the job as would have been returned if called synchronously
 - progress - output of the progress related to the underlying job
+
+Jobs which have expired are looked up in the job history if it is
+being kept, in which case the result is as returned by job/history
+without the params.
 `,
 	})
 }
@@ -384,6 +669,10 @@ func rcJobStatus(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 	}
 	job := running.Get(jobID)
 	if job == nil {
+		// Look for it in the history if it has expired
+		if out = historyStatus(jobID); out != nil {
+			return out, nil
+		}
 		return nil, errors.New("job not found")
 	}
 	job.mu.Lock()
@@ -398,15 +687,27 @@ func rcJobStatus(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 
 func init() {
 	rc.Add(rc.Call{
-		Path:  "job/list",
-		Fn:    rcJobList,
-		Title: "Lists the IDs of the running jobs",
+		Path:   "job/list",
+		Fn:     rcJobList,
+		Title:  "Lists the IDs of the running jobs",
+		Params: []rc.Param{},
+		Result: []rc.Param{
+			{Name: "executeId", Type: rc.TypeString, Help: "id of rclone executing (changes after restart)"},
+			{Name: "jobids", Type: rc.TypeArray, Items: rc.TypeInteger, Help: "the job ids"},
+			{Name: "queued", Type: rc.TypeInteger, Help: "number of background jobs waiting to run"},
+			{Name: "schedules", Type: rc.TypeArray, Items: rc.TypeObject, Help: "the status of each schedule if any"},
+		},
 		Help: `Parameters: None.
 
 Results:
 
 - executeId - string id of rclone executing (change after restart)
-- jobids - array of integer job ids (starting at 1 on each restart)
+- jobids - array of integer job ids (starting at 1 on each restart
+  unless the job history is kept)
+- queued - number of background jobs waiting to run
+- schedules - array with the status of each schedule made with
+  job/schedule if any: id, name, command, nextRun, running and lastRun
+  as returned by job/schedules
 `,
 	})
 }
@@ -416,6 +717,10 @@ func rcJobList(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 	out = make(rc.Params)
 	out["jobids"] = running.IDs()
 	out["executeId"] = executeID
+	out["queued"] = running.Queued()
+	if s := runningScheduler(); s != nil {
+		out["schedules"] = s.Summary()
+	}
 	return out, nil
 }
 
@@ -424,6 +729,10 @@ func init() {
 		Path:  "job/stop",
 		Fn:    rcJobStop,
 		Title: "Stop the running job",
+		Params: []rc.Param{
+			{Name: "jobid", Type: rc.TypeInteger, Required: true, Help: "id of the job"},
+		},
+		Result: []rc.Param{},
 		Help: `Parameters:
 
 - jobid - id of the job (integer).
@@ -453,6 +762,10 @@ func init() {
 		Path:  "job/stopgroup",
 		Fn:    rcGroupStop,
 		Title: "Stop all running jobs in a group",
+		Params: []rc.Param{
+			{Name: "group", Type: rc.TypeString, Required: true, Help: "name of the group"},
+		},
+		Result: []rc.Param{},
 		Help: `Parameters:
 
 - group - name of the group (string).
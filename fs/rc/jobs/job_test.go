@@ -2,7 +2,10 @@ package jobs
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"runtime"
 	"testing"
 	"time"
@@ -10,6 +13,7 @@ import (
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/notify"
 	"github.com/rclone/rclone/fs/rc"
 	"github.com/rclone/rclone/fstest/testy"
 	"github.com/stretchr/testify/assert"
@@ -324,6 +328,84 @@ func TestExecuteJobWithGroup(t *testing.T) {
 	assert.Equal(t, true, called)
 }
 
+func TestExecuteJobWithNotify(t *testing.T) {
+	ctx := context.Background()
+	jobID.Store(0)
+	payloads := make(chan notify.Payload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p notify.Payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		payloads <- p
+	}))
+	defer server.Close()
+
+	testErr := errors.New("test error")
+	errorFn := func(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+		_, found := in["_notify"]
+		assert.False(t, found)
+		return nil, testErr
+	}
+	job, _, err := NewJob(WithCommand(ctx, "test/fail"), errorFn, rc.Params{
+		"_notify": rc.Params{
+			"Webhook": []string{server.URL},
+			"On":      []string{"start", "failure"},
+		},
+	})
+	assert.Equal(t, testErr, err)
+
+	var got []notify.Payload
+	for len(got) < 2 {
+		select {
+		case p := <-payloads:
+			got = append(got, p)
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for notifications")
+		}
+	}
+	// the notifications are sent in the background so may arrive in any order
+	if got[0].Event != notify.Start {
+		got[0], got[1] = got[1], got[0]
+	}
+	assert.Equal(t, notify.Start, got[0].Event)
+	assert.Equal(t, notify.Failure, got[1].Event)
+	for _, p := range got {
+		assert.Equal(t, "job", p.Source)
+		assert.Equal(t, "test/fail", p.Command)
+		assert.Equal(t, job.ID, p.JobID)
+		assert.Equal(t, job.Group, p.Group)
+	}
+	assert.Equal(t, "test error", got[1].Error)
+}
+
+func TestExecuteJobNotifyCommand(t *testing.T) {
+	ctx := context.Background()
+	called := false
+	fn := func(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+		called = true
+		return nil, nil
+	}
+	for _, key := range []string{"Command", "command", "notify_command"} {
+		_, _, err := NewJob(ctx, fn, rc.Params{
+			"_notify": rc.Params{
+				key: []string{"echo", "hello"},
+			},
+		})
+		assert.True(t, rc.IsErrParamInvalid(err), key)
+		assert.ErrorContains(t, err, "only Webhook, On, Timeout may be set")
+	}
+	assert.False(t, called)
+
+	// The commands set by --notify-command are kept
+	oldOpt := notify.Opt
+	defer func() { notify.Opt = oldOpt }()
+	notify.Opt.Command = fs.SpaceSepList{"notify-me"}
+	opt, err := getNotify(rc.Params{"_notify": rc.Params{"On": []string{"start"}, "Timeout": "5s"}}, false)
+	require.NoError(t, err)
+	assert.Equal(t, fs.SpaceSepList{"notify-me"}, opt.Command)
+	assert.Equal(t, fs.CommaSepList{"start"}, opt.On)
+	assert.Equal(t, fs.Duration(5*time.Second), opt.Timeout)
+}
+
 func TestExecuteJobErrorPropagation(t *testing.T) {
 	ctx := context.Background()
 	jobID.Store(0)
@@ -336,6 +418,63 @@ func TestExecuteJobErrorPropagation(t *testing.T) {
 	assert.Equal(t, testErr, err)
 }
 
+func TestJobsQueue(t *testing.T) {
+	ctx := context.Background()
+	opt := rc.Opt
+	opt.JobMaxRunning = 1
+	opt.JobMaxQueued = 1
+	jobs := newJobs()
+	jobs.opt = &opt
+	release := make(chan struct{})
+	blockFn := func(ctx context.Context, in rc.Params) (rc.Params, error) {
+		<-release
+		return rc.Params{}, nil
+	}
+
+	job1, _, err := jobs.NewJob(ctx, blockFn, rc.Params{"_async": true})
+	require.NoError(t, err)
+	job2, _, err := jobs.NewJob(ctx, noopFn, rc.Params{"_async": true})
+	require.NoError(t, err)
+	assert.True(t, job2.Queued)
+	assert.Equal(t, int64(1), jobs.Queued())
+
+	// The queue is full
+	_, _, err = jobs.NewJob(ctx, noopFn, rc.Params{"_async": true})
+	assert.ErrorContains(t, err, "job queue full")
+
+	// Jobs which aren't in the background aren't limited
+	_, _, err = jobs.NewJob(ctx, noopFn, rc.Params{})
+	require.NoError(t, err)
+
+	// Stop the queued job
+	job2.Stop()
+	assert.Eventually(t, func() bool {
+		job2.mu.Lock()
+		defer job2.mu.Unlock()
+		return job2.Finished
+	}, 10*time.Second, time.Millisecond)
+	assert.Contains(t, job2.Error, "job stopped while queued")
+	assert.Equal(t, int64(0), jobs.Queued())
+
+	// The next job runs once the first finishes
+	job3, _, err := jobs.NewJob(ctx, noopFn, rc.Params{"_async": true})
+	require.NoError(t, err)
+	job3.mu.Lock()
+	assert.True(t, job3.Queued)
+	job3.mu.Unlock()
+	close(release)
+	for _, job := range []*Job{job1, job3} {
+		job := job
+		assert.Eventually(t, func() bool {
+			job.mu.Lock()
+			defer job.mu.Unlock()
+			return job.Finished
+		}, 10*time.Second, time.Millisecond)
+		assert.True(t, job.Success)
+		assert.False(t, job.Queued)
+	}
+}
+
 func TestRcJobStatus(t *testing.T) {
 	ctx := context.Background()
 	jobID.Store(0)
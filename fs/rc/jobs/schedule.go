@@ -0,0 +1,615 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// Schedule is an rc call run repeatedly as a job
+type Schedule struct {
+	ID           int64        `json:"id"`
+	Name         string       `json:"name,omitempty"`
+	Command      string       `json:"command"`
+	Params       rc.Params    `json:"params"`
+	Cron         string       `json:"cron,omitempty"`
+	Interval     string       `json:"interval,omitempty"`
+	AllowOverlap bool         `json:"allowOverlap"`
+	Created      time.Time    `json:"created"`
+	NextRun      time.Time    `json:"nextRun"`
+	Runs         int          `json:"runs"`    // number of jobs started
+	Skipped      int          `json:"skipped"` // runs skipped as the last was still going
+	LastRun      *ScheduleRun `json:"lastRun,omitempty"`
+
+	cron     *cronSpec
+	interval time.Duration
+	running  int // number of jobs running
+}
+
+// ScheduleRun is the outcome of the last job started by a Schedule
+type ScheduleRun struct {
+	JobID     int64     `json:"jobid"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Finished  bool      `json:"finished"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error"`
+	Duration  float64   `json:"duration"`
+}
+
+// parse checks the timing of the schedule
+func (s *Schedule) parse() (err error) {
+	switch {
+	case s.Cron != "" && s.Interval != "":
+		return errors.New("only one of cron and interval may be set")
+	case s.Cron != "":
+		s.cron, err = parseCron(s.Cron)
+		return err
+	case s.Interval != "":
+		s.interval, err = fs.ParseDuration(s.Interval)
+		if err != nil {
+			return fmt.Errorf("bad interval: %w", err)
+		}
+		if s.interval < time.Second {
+			return errors.New("interval must be at least 1s")
+		}
+		return nil
+	}
+	return errors.New("one of cron or interval must be set")
+}
+
+// next returns the time of the first run after t
+//
+// Interval runs are aligned to the creation time so they stay the
+// same across restarts.
+func (s *Schedule) next(t time.Time) time.Time {
+	if s.cron != nil {
+		return s.cron.next(t)
+	}
+	n := t.Sub(s.Created)/s.interval + 1
+	return s.Created.Add(n * s.interval)
+}
+
+// Scheduler runs Schedules
+type Scheduler struct {
+	mu        sync.Mutex
+	path      string // file to persist the schedules in
+	lastID    int64
+	schedules map[int64]*Schedule
+	kick      chan struct{}
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// schedulerFile is the persisted form of the Scheduler
+type schedulerFile struct {
+	LastID    int64       `json:"lastId"`
+	Schedules []*Schedule `json:"schedules"`
+}
+
+var (
+	schedulerMu sync.Mutex
+	scheduler   *Scheduler
+)
+
+// schedulePath returns the file to persist the schedules in
+func schedulePath() string {
+	if running.opt.JobScheduleFile != "" {
+		return running.opt.JobScheduleFile
+	}
+	return filepath.Join(config.GetCacheDir(), "rc", "schedules.json")
+}
+
+// StartScheduler loads the persisted schedules and starts running
+// them if not already started.
+func StartScheduler() error {
+	_, err := getScheduler()
+	return err
+}
+
+// getScheduler returns the running Scheduler starting it if necessary
+func getScheduler() (*Scheduler, error) {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	if scheduler != nil {
+		return scheduler, nil
+	}
+	s, err := newScheduler(schedulePath())
+	if err != nil {
+		return nil, err
+	}
+	scheduler = s
+	return s, nil
+}
+
+// stopScheduler stops the running Scheduler - used in tests
+func stopScheduler() {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	if scheduler != nil {
+		scheduler.stop()
+		scheduler = nil
+	}
+}
+
+// newScheduler loads the schedules from path and starts running them
+func newScheduler(path string) (*Scheduler, error) {
+	s := &Scheduler{
+		path:      path,
+		schedules: map[int64]*Schedule{},
+		kick:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.run(ctx)
+	return s, nil
+}
+
+// load the schedules from disk
+func (s *Scheduler) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read schedules: %w", err)
+	}
+	var file schedulerFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse schedules %q: %w", s.path, err)
+	}
+	now := time.Now()
+	s.lastID = file.LastID
+	for _, sched := range file.Schedules {
+		if err := sched.parse(); err != nil {
+			fs.Errorf(nil, "rc schedule %d: ignoring: %v", sched.ID, err)
+			continue
+		}
+		if sched.LastRun != nil && !sched.LastRun.Finished {
+			sched.LastRun.Finished = true
+			sched.LastRun.Error = "rclone stopped before the job finished"
+		}
+		// Runs missed while stopped are skipped
+		sched.NextRun = sched.next(now)
+		s.schedules[sched.ID] = sched
+	}
+	fs.Debugf(nil, "rc: loaded %d schedules from %q", len(s.schedules), s.path)
+	return nil
+}
+
+// save the schedules to disk - call with the lock held
+func (s *Scheduler) save() error {
+	file := schedulerFile{
+		LastID:    s.lastID,
+		Schedules: s.list(),
+	}
+	data, err := json.MarshalIndent(file, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to save schedules: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save schedules: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to save schedules: %w", err)
+	}
+	return nil
+}
+
+// list the schedules in ID order - call with the lock held
+func (s *Scheduler) list() []*Schedule {
+	out := make([]*Schedule, 0, len(s.schedules))
+	for _, sched := range s.schedules {
+		out = append(out, sched)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Add sched returning the ID given to it
+func (s *Scheduler) Add(sched *Schedule) (int64, error) {
+	if err := sched.parse(); err != nil {
+		return 0, err
+	}
+	call := rc.Calls.Get(sched.Command)
+	if call == nil {
+		return 0, fmt.Errorf("couldn't find command %q", sched.Command)
+	}
+	if call.NeedsRequest || call.NeedsResponse {
+		return 0, fmt.Errorf("command %q can't be scheduled", sched.Command)
+	}
+	if sched.Params == nil {
+		sched.Params = rc.Params{}
+	}
+	if err := call.Validate(sched.Params); err != nil {
+		return 0, err
+	}
+	delete(sched.Params, "_async")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	sched.ID = s.lastID
+	sched.Created = time.Now()
+	sched.NextRun = sched.next(sched.Created)
+	s.schedules[sched.ID] = sched
+	if err := s.save(); err != nil {
+		delete(s.schedules, sched.ID)
+		return 0, err
+	}
+	s.wakeup()
+	return sched.ID, nil
+}
+
+// Remove the schedule with the given ID
+func (s *Scheduler) Remove(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sched := s.schedules[id]
+	if sched == nil {
+		return errors.New("schedule not found")
+	}
+	delete(s.schedules, id)
+	if err := s.save(); err != nil {
+		s.schedules[id] = sched
+		return err
+	}
+	s.wakeup()
+	return nil
+}
+
+// Schedules returns the schedules as rc.Params in ID order
+func (s *Scheduler) Schedules() ([]rc.Params, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []rc.Params{}
+	for _, sched := range s.list() {
+		var p rc.Params
+		if err := rc.Reshape(&p, sched); err != nil {
+			return nil, err
+		}
+		p["running"] = sched.running > 0
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// Summary returns the status of the schedules without their
+// parameters for job/list
+func (s *Scheduler) Summary() []rc.Params {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []rc.Params{}
+	for _, sched := range s.list() {
+		out = append(out, rc.Params{
+			"id":      sched.ID,
+			"name":    sched.Name,
+			"command": sched.Command,
+			"nextRun": sched.NextRun,
+			"running": sched.running > 0,
+			"lastRun": sched.LastRun,
+		})
+	}
+	return out
+}
+
+// runningScheduler returns the Scheduler if it has been started
+func runningScheduler() *Scheduler {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	return scheduler
+}
+
+// wakeup the run loop to recalculate the next run
+func (s *Scheduler) wakeup() {
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// stop the run loop
+func (s *Scheduler) stop() {
+	s.cancel()
+	<-s.done
+}
+
+// run starts the schedules when they are due
+func (s *Scheduler) run(ctx context.Context) {
+	defer close(s.done)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		wait := s.startDue(time.Now())
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.kick:
+		case <-timer.C:
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+}
+
+// startDue starts the schedules due at now returning how long until
+// the next one is due.
+func (s *Scheduler) startDue(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wait := time.Hour
+	for _, sched := range s.list() {
+		if sched.NextRun.IsZero() {
+			continue
+		}
+		if !now.Before(sched.NextRun) {
+			s.start(sched)
+			sched.NextRun = sched.next(now)
+			if sched.NextRun.IsZero() {
+				continue
+			}
+		}
+		if d := sched.NextRun.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// start a job for sched - call with the lock held
+func (s *Scheduler) start(sched *Schedule) {
+	if sched.running > 0 && !sched.AllowOverlap {
+		sched.Skipped++
+		fs.Logf(nil, "rc schedule %d: skipping run of %q as the last is still running", sched.ID, sched.Command)
+		return
+	}
+	call := rc.Calls.Get(sched.Command)
+	if call == nil {
+		fs.Errorf(nil, "rc schedule %d: couldn't find command %q", sched.ID, sched.Command)
+		return
+	}
+	sched.running++
+	sched.Runs++
+	params := sched.Params.Copy()
+	started := make(chan struct{})
+	fn := func(ctx context.Context, in rc.Params) (rc.Params, error) {
+		job, _ := GetJob(ctx)
+		s.mu.Lock()
+		sched.LastRun = &ScheduleRun{
+			JobID:     job.ID,
+			StartTime: job.StartTime,
+		}
+		s.mu.Unlock()
+		close(started)
+		return call.Fn(ctx, in)
+	}
+	go func() {
+		job, _, err := running.newJob(WithCommand(context.Background(), sched.Command), fn, params, true)
+		s.finished(sched, job, started, err)
+	}()
+}
+
+// finished records the outcome of a job started by sched
+func (s *Scheduler) finished(sched *Schedule, job *Job, started chan struct{}, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sched.running--
+	select {
+	case <-started:
+	default:
+		// The job failed before running, e.g. bad parameters
+		sched.LastRun = &ScheduleRun{StartTime: time.Now()}
+	}
+	run := sched.LastRun
+	if job != nil {
+		job.mu.Lock()
+		run.EndTime = job.EndTime
+		run.Duration = job.Duration
+		job.mu.Unlock()
+	} else {
+		run.EndTime = time.Now()
+	}
+	run.Finished = true
+	run.Success = err == nil
+	if err != nil {
+		run.Error = err.Error()
+		fs.Errorf(nil, "rc schedule %d: %q failed: %v", sched.ID, sched.Command, err)
+	}
+	if s.schedules[sched.ID] != sched {
+		return // removed while running
+	}
+	if err := s.save(); err != nil {
+		fs.Errorf(nil, "rc: %v", err)
+	}
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "job/schedule",
+		AuthRequired: true,
+		Fn:           rcJobSchedule,
+		Title:        "Run an rc command on a schedule",
+		Params: []rc.Param{
+			{Name: "command", Type: rc.TypeString, Required: true, Help: `the rc command to run, e.g. "sync/sync"`},
+			{Name: "params", Type: rc.TypeObject, Help: "parameters to pass to the command"},
+			{Name: "cron", Type: rc.TypeString, Help: `a 5 field cron expression, e.g. "30 2 * * *"`},
+			{Name: "interval", Type: rc.TypeDuration, Help: `time between runs, e.g. "6h"`},
+			{Name: "name", Type: rc.TypeString, Help: "a description of the schedule"},
+			{Name: "allowOverlap", Type: rc.TypeBoolean, Help: "start the command even if the last run is still going"},
+		},
+		Result: []rc.Param{
+			{Name: "id", Type: rc.TypeInteger, Help: "id of the schedule"},
+			{Name: "nextRun", Type: rc.TypeString, Help: "time of the first run"},
+		},
+		Help: `This stores an rc command with its parameters to be run as a job
+on a schedule given as a cron expression or an interval.
+
+Parameters:
+
+- command - the rc command to run, e.g. "sync/sync" (string).
+- params - parameters to pass to the command (object, optional).
+- cron - a 5 field cron expression, e.g. "30 2 * * *" (string).
+- interval - time between runs, e.g. "6h" (string).
+- name - a description of the schedule (string, optional).
+- allowOverlap - start the command even if the last run is still going (boolean, default false).
+
+One of cron or interval must be given. The params may include the
+special parameters _config, _filter and _group.
+
+Cron expressions have the fields minute, hour, day of month, month and
+day of week in local time. They may use *, ranges "1-5", lists "1,3",
+steps "*/15" and names "mon", "jan", or be one of @hourly, @daily,
+@weekly, @monthly and @yearly. Intervals are counted from when the
+schedule was made.
+
+Unless allowOverlap is set a run is skipped if the job started by the
+last one is still running. Schedules are saved to the file given by
+--rc-job-schedule-file so they survive restarts, but runs missed while
+rclone wasn't running are not made up.
+
+Results:
+
+- id - id of the schedule (integer).
+- nextRun - time of the first run.
+
+Eg
+
+    rclone rc job/schedule command=sync/sync cron="0 3 * * *" params='{"srcFs":"/home","dstFs":"remote:backup"}'
+`,
+	})
+}
+
+// Add a schedule
+func rcJobSchedule(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	sched := &Schedule{}
+	if sched.Command, err = in.GetString("command"); err != nil {
+		return nil, err
+	}
+	if _, ok := in["params"]; ok {
+		if err = in.GetStruct("params", &sched.Params); err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range map[string]*string{
+		"cron":     &sched.Cron,
+		"interval": &sched.Interval,
+		"name":     &sched.Name,
+	} {
+		if *value, err = in.GetString(key); rc.NotErrParamNotFound(err) {
+			return nil, err
+		}
+	}
+	if sched.AllowOverlap, err = in.GetBool("allowOverlap"); rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	s, err := getScheduler()
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.Add(sched)
+	if err != nil {
+		return nil, rc.NewErrParamInvalid(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return rc.Params{
+		"id":      id,
+		"nextRun": sched.NextRun,
+	}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "job/unschedule",
+		AuthRequired: true,
+		Fn:           rcJobUnschedule,
+		Title:        "Remove a schedule made with job/schedule",
+		Params: []rc.Param{
+			{Name: "id", Type: rc.TypeInteger, Required: true, Help: "id of the schedule"},
+		},
+		Result: []rc.Param{},
+		Help: `Parameters:
+
+- id - id of the schedule (integer).
+
+This doesn't stop a job already started by the schedule.
+`,
+	})
+}
+
+// Remove a schedule
+func rcJobUnschedule(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	id, err := in.GetInt64("id")
+	if err != nil {
+		return nil, err
+	}
+	s, err := getScheduler()
+	if err != nil {
+		return nil, err
+	}
+	if err = s.Remove(id); err != nil {
+		return nil, err
+	}
+	return rc.Params{}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "job/schedules",
+		AuthRequired: true,
+		Fn:           rcJobSchedules,
+		Title:        "List the schedules made with job/schedule",
+		Params:       []rc.Param{},
+		Result: []rc.Param{
+			{Name: "schedules", Type: rc.TypeArray, Items: rc.TypeObject, Help: "the schedules"},
+		},
+		Help: `Parameters: None.
+
+Results:
+
+- schedules - array of schedules, each with
+    - id, name, command, params, cron, interval, allowOverlap - as given to job/schedule
+    - created - time the schedule was made
+    - nextRun - time of the next run
+    - runs - number of jobs started
+    - skipped - number of runs skipped as the last job was still running
+    - running - boolean whether a job started by the schedule is running
+    - lastRun - the job last started with jobid, startTime, endTime, finished, success, error and duration
+`,
+	})
+}
+
+// List the schedules
+func rcJobSchedules(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	s, err := getScheduler()
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := s.Schedules()
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{"schedules": schedules}, nil
+}
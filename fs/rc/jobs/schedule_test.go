@@ -0,0 +1,215 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testScheduled is run by the schedule tests
+var testScheduled = struct {
+	mu      sync.Mutex
+	calls   []rc.Params
+	release chan struct{}
+}{}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "test/scheduled",
+		Title: "Used by the schedule tests",
+		Fn: func(ctx context.Context, in rc.Params) (rc.Params, error) {
+			testScheduled.mu.Lock()
+			testScheduled.calls = append(testScheduled.calls, in)
+			release := testScheduled.release
+			testScheduled.mu.Unlock()
+			if release != nil {
+				<-release
+			}
+			if _, ok := in["fail"]; ok {
+				return nil, errors.New("failed as asked")
+			}
+			return rc.Params{}, nil
+		},
+	})
+}
+
+func TestScheduleNext(t *testing.T) {
+	created := time.Date(2024, 1, 10, 10, 0, 0, 0, time.UTC)
+	s := &Schedule{Interval: "1h", Created: created}
+	require.NoError(t, s.parse())
+	assert.Equal(t, created.Add(time.Hour), s.next(created))
+	assert.Equal(t, created.Add(3*time.Hour), s.next(created.Add(2*time.Hour)))
+	assert.Equal(t, created.Add(3*time.Hour), s.next(created.Add(150*time.Minute)))
+
+	for _, bad := range []Schedule{
+		{},
+		{Cron: "@daily", Interval: "1h"},
+		{Interval: "potato"},
+		{Interval: "10ms"},
+		{Cron: "* *"},
+	} {
+		assert.Error(t, bad.parse(), "%+v", bad)
+	}
+}
+
+// waitIdle waits for the jobs started by sched to finish
+func waitIdle(t *testing.T, s *Scheduler, sched *Schedule) {
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return sched.running == 0
+	}, 10*time.Second, time.Millisecond)
+}
+
+func TestScheduler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	s, err := newScheduler(path)
+	require.NoError(t, err)
+	defer s.stop()
+
+	_, err = s.Add(&Schedule{Command: "test/potato", Interval: "1h"})
+	assert.ErrorContains(t, err, "couldn't find command")
+	_, err = s.Add(&Schedule{Command: "test/scheduled"})
+	assert.Error(t, err)
+
+	sched := &Schedule{
+		Name:     "test",
+		Command:  "test/scheduled",
+		Params:   rc.Params{"a": "b", "_async": true},
+		Interval: "1h",
+	}
+	id, err := s.Add(sched)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), id)
+	assert.NotContains(t, sched.Params, "_async")
+
+	// Hold the first run so the second overlaps it
+	release := make(chan struct{})
+	testScheduled.mu.Lock()
+	testScheduled.calls = nil
+	testScheduled.release = release
+	testScheduled.mu.Unlock()
+
+	due := sched.NextRun
+	s.startDue(due)
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return sched.LastRun != nil
+	}, 10*time.Second, time.Millisecond)
+	s.startDue(sched.NextRun)
+	close(release)
+	waitIdle(t, s, sched)
+
+	s.mu.Lock()
+	assert.Equal(t, 1, sched.Runs)
+	assert.Equal(t, 1, sched.Skipped)
+	assert.Equal(t, due.Add(2*time.Hour), sched.NextRun)
+	require.NotNil(t, sched.LastRun)
+	assert.True(t, sched.LastRun.Finished)
+	assert.True(t, sched.LastRun.Success)
+	assert.NotZero(t, sched.LastRun.JobID)
+	s.mu.Unlock()
+	testScheduled.mu.Lock()
+	assert.Equal(t, []rc.Params{{"a": "b"}}, testScheduled.calls)
+	testScheduled.release = nil
+	testScheduled.mu.Unlock()
+
+	// A failing run is recorded
+	failing := &Schedule{
+		Command:      "test/scheduled",
+		Params:       rc.Params{"fail": true},
+		Interval:     "1h",
+		AllowOverlap: true,
+	}
+	_, err = s.Add(failing)
+	require.NoError(t, err)
+	// this is due before the first schedule's next run
+	s.startDue(failing.NextRun)
+	waitIdle(t, s, failing)
+	s.mu.Lock()
+	require.NotNil(t, failing.LastRun)
+	assert.False(t, failing.LastRun.Success)
+	assert.Equal(t, "failed as asked", failing.LastRun.Error)
+	s.mu.Unlock()
+
+	// The schedules and their last runs survive a restart
+	s.stop()
+	s, err = newScheduler(path)
+	require.NoError(t, err)
+	schedules, err := s.Schedules()
+	require.NoError(t, err)
+	require.Len(t, schedules, 2)
+	assert.Equal(t, 1.0, schedules[0]["id"])
+	assert.Equal(t, "test", schedules[0]["name"])
+	assert.Equal(t, 1.0, schedules[0]["runs"])
+	assert.Equal(t, false, schedules[0]["running"])
+	assert.Equal(t, true, schedules[0]["lastRun"].(map[string]interface{})["success"])
+	assert.Equal(t, true, schedules[1]["allowOverlap"])
+
+	require.NoError(t, s.Remove(1))
+	assert.Error(t, s.Remove(1))
+	id, err = s.Add(&Schedule{Command: "test/scheduled", Interval: "1h"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), id, "ids are not reused")
+	assert.Len(t, s.Summary(), 2)
+}
+
+func TestRcSchedule(t *testing.T) {
+	s, err := newScheduler(filepath.Join(t.TempDir(), "schedules.json"))
+	require.NoError(t, err)
+	schedulerMu.Lock()
+	scheduler = s
+	schedulerMu.Unlock()
+	defer stopScheduler()
+	ctx := context.Background()
+
+	call := rc.Calls.Get("job/schedule")
+	require.NotNil(t, call)
+	out, err := call.Fn(ctx, rc.Params{
+		"command":  "test/scheduled",
+		"cron":     "0 3 * * *",
+		"name":     "nightly",
+		"params":   rc.Params{"x": 1},
+		"potato":   "ignored",
+		"interval": "",
+	})
+	require.NoError(t, err)
+	id := out["id"].(int64)
+	assert.True(t, out["nextRun"].(time.Time).After(time.Now()))
+
+	_, err = call.Fn(ctx, rc.Params{"command": "test/scheduled", "cron": "bad"})
+	assert.True(t, rc.IsErrParamInvalid(err))
+
+	call = rc.Calls.Get("job/schedules")
+	require.NotNil(t, call)
+	out, err = call.Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	schedules := out["schedules"].([]rc.Params)
+	require.Len(t, schedules, 1)
+	assert.Equal(t, "nightly", schedules[0]["name"])
+	assert.Equal(t, map[string]interface{}{"x": 1.0}, schedules[0]["params"])
+
+	call = rc.Calls.Get("job/list")
+	require.NotNil(t, call)
+	out, err = call.Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	summary := out["schedules"].([]rc.Params)
+	require.Len(t, summary, 1)
+	assert.Equal(t, id, summary[0]["id"])
+	assert.NotContains(t, summary[0], "params")
+
+	call = rc.Calls.Get("job/unschedule")
+	require.NotNil(t, call)
+	_, err = call.Fn(ctx, rc.Params{"id": id})
+	require.NoError(t, err)
+	_, err = call.Fn(ctx, rc.Params{"id": id})
+	assert.Error(t, err)
+}
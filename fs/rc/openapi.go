@@ -0,0 +1,210 @@
+// Make an OpenAPI document describing the rc calls
+
+package rc
+
+import (
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// specialParams are the parameters which can be passed to any call,
+// see "Special parameters" in the rc docs
+var specialParams = []Param{
+	{Name: "_async", Type: TypeBoolean, Help: "run the call in the background returning a jobid"},
+	{Name: "_group", Type: TypeString, Help: "stats group to put the call in"},
+	{Name: "_config", Type: TypeObject, Help: "global config options to override for this call"},
+	{Name: "_filter", Type: TypeObject, Help: "filter options to use for this call"},
+	{Name: "_notify", Type: TypeObject, Help: "webhooks to send notifications about the job to"},
+}
+
+// operationIDReplacer makes the operationId from the path
+var operationIDReplacer = strings.NewReplacer("/", "_", "-", "_")
+
+// typeSchema returns the JSON schema for a value of type t with items
+// of type items if it is an array
+func typeSchema(t string, items string) Params {
+	switch t {
+	case TypeString, TypeNumber, TypeBoolean:
+		return Params{"type": t}
+	case TypeInteger:
+		return Params{"type": t, "format": "int64"}
+	case TypeObject:
+		return Params{"type": t, "additionalProperties": true}
+	case TypeArray:
+		return Params{"type": t, "items": typeSchema(items, "")}
+	case TypeDuration:
+		return Params{"$ref": "#/components/schemas/Duration"}
+	case TypeFs:
+		return Params{"$ref": "#/components/schemas/Fs"}
+	}
+	return Params{}
+}
+
+// paramsSchema returns the JSON schema for an object with params in.
+//
+// If params is nil then the object may have any properties.
+func paramsSchema(params []Param, extra []Param, additionalProperties bool) Params {
+	schema := Params{
+		"type": "object",
+	}
+	if params == nil {
+		schema["additionalProperties"] = true
+		params = []Param{}
+	} else {
+		schema["additionalProperties"] = additionalProperties
+	}
+	properties := Params{}
+	patterns := Params{}
+	required := []string{}
+	all := make([]Param, 0, len(params)+len(extra))
+	all = append(all, params...)
+	all = append(all, extra...)
+	for _, p := range all {
+		propSchema := typeSchema(p.Type, p.Items)
+		if p.Help != "" {
+			propSchema["description"] = p.Help
+		}
+		if prefix, isPattern := p.prefix(); isPattern {
+			patterns["^"+prefix] = propSchema
+			continue
+		}
+		properties[p.Name] = propSchema
+		if p.Required {
+			required = append(required, p.Name)
+		}
+	}
+	schema["properties"] = properties
+	if len(patterns) > 0 {
+		schema["patternProperties"] = patterns
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// operation returns the OpenAPI operation for call
+func (call *Call) operation() Params {
+	tag, _, _ := strings.Cut(call.Path, "/")
+	op := Params{
+		"operationId": operationIDReplacer.Replace(call.Path),
+		"summary":     call.Title,
+		"description": call.Help,
+		"tags":        []string{tag},
+		"responses": Params{
+			"200": Params{
+				"description": "The result of the call, or the jobid if _async was set",
+				"content": Params{
+					"application/json": Params{
+						"schema": paramsSchema(call.Result, nil, true),
+					},
+				},
+			},
+			"default": Params{
+				"$ref": "#/components/responses/Error",
+			},
+		},
+	}
+	if call.AuthRequired {
+		op["security"] = []Params{{"basicAuth": []string{}}, {"bearerAuth": []string{}}}
+	}
+	if call.NeedsRequest {
+		// The parameters are passed in the URL and the body is the files
+		var parameters []Params
+		for _, p := range call.Params {
+			parameters = append(parameters, Params{
+				"name":        p.Name,
+				"in":          "query",
+				"required":    p.Required,
+				"description": p.Help,
+				"schema":      typeSchema(p.Type, p.Items),
+			})
+		}
+		op["parameters"] = parameters
+		op["requestBody"] = Params{
+			"content": Params{
+				"multipart/form-data": Params{
+					"schema": Params{
+						"type":                 "object",
+						"additionalProperties": Params{"type": "string", "format": "binary"},
+					},
+				},
+			},
+		}
+		return op
+	}
+	schema := paramsSchema(call.Params, specialParams, false)
+	op["requestBody"] = Params{
+		"content": Params{
+			"application/json":                  Params{"schema": schema},
+			"application/x-www-form-urlencoded": Params{"schema": schema},
+		},
+	}
+	return op
+}
+
+// OpenAPI returns an OpenAPI 3.1 document describing all the calls
+// in the registry.
+func (r *Registry) OpenAPI() Params {
+	paths := Params{}
+	for _, call := range r.List() {
+		paths["/"+call.Path] = Params{
+			"post": call.operation(),
+		}
+	}
+	return Params{
+		"openapi": "3.1.0",
+		"info": Params{
+			"title":       "rclone remote control",
+			"description": "The API of the rclone remote control. See https://rclone.org/rc/ for more info.",
+			"version":     fs.Version,
+		},
+		"paths": paths,
+		"components": Params{
+			"schemas": Params{
+				"Fs": Params{
+					"description": `A remote as a string e.g. "drive:path" or "/local/path", or as an object with the config parameters and "type", or "_name" to base it on a configured remote, and "_root" for the path`,
+					"oneOf": []Params{
+						{"type": "string"},
+						{"type": "object", "additionalProperties": true},
+					},
+				},
+				"Duration": Params{
+					"description": `A duration as a string e.g. "1h30m" or "10s", or "off"`,
+					"type":        "string",
+				},
+				"Error": Params{
+					"type": "object",
+					"properties": Params{
+						"error":  Params{"type": "string", "description": "the error message"},
+						"input":  Params{"type": "object", "description": "the parameters of the call"},
+						"path":   Params{"type": "string", "description": "the path of the call"},
+						"status": Params{"type": "integer", "description": "the HTTP status code"},
+					},
+				},
+			},
+			"responses": Params{
+				"Error": Params{
+					"description": "The call failed",
+					"content": Params{
+						"application/json": Params{
+							"schema": Params{"$ref": "#/components/schemas/Error"},
+						},
+					},
+				},
+			},
+			"securitySchemes": Params{
+				"basicAuth": Params{
+					"type":   "http",
+					"scheme": "basic",
+				},
+				"bearerAuth": Params{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "A token from the --rc-tokens-file",
+				},
+			},
+		},
+	}
+}
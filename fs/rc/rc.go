@@ -43,6 +43,11 @@ var OptionsInfo = fs.Options{{
 	Default: false,
 	Help:    "Don't require auth for certain methods",
 	Groups:  "RC",
+}, {
+	Name:    "rc_tokens_file",
+	Default: "",
+	Help:    "JSON file of named API tokens with the calls and remotes they may use",
+	Groups:  "RC",
 }, {
 	Name:    "rc_web_gui",
 	Default: false,
@@ -63,6 +68,11 @@ var OptionsInfo = fs.Options{{
 	Default: false,
 	Help:    "Don't open the browser automatically",
 	Groups:  "RC",
+}, {
+	Name:    "rc_web_gui_builtin",
+	Default: false,
+	Help:    "Launch the dashboard built into rclone instead of downloading the WebGUI",
+	Groups:  "RC",
 }, {
 	Name:    "rc_web_fetch_url",
 	Default: "https://api.github.com/repos/rclone/rclone-webui-react/releases/latest",
@@ -83,6 +93,31 @@ var OptionsInfo = fs.Options{{
 	Default: 10 * time.Second,
 	Help:    "Interval to check for expired async jobs",
 	Groups:  "RC",
+}, {
+	Name:    "rc_job_schedule_file",
+	Default: "",
+	Help:    "File to keep job schedules in (default in the cache dir)",
+	Groups:  "RC",
+}, {
+	Name:    "rc_job_history_file",
+	Default: "",
+	Help:    "File to keep the history of background jobs in (default in the cache dir)",
+	Groups:  "RC",
+}, {
+	Name:    "rc_job_history_max",
+	Default: 1000,
+	Help:    "Max number of background jobs to keep in the job history (0 to disable)",
+	Groups:  "RC",
+}, {
+	Name:    "rc_job_max_running",
+	Default: 0,
+	Help:    "Max number of background jobs to run at once (0 for no limit)",
+	Groups:  "RC",
+}, {
+	Name:    "rc_job_max_queued",
+	Default: 0,
+	Help:    "Max number of background jobs waiting to run (0 for no limit)",
+	Groups:  "RC",
 }, {
 	Name:    "metrics_addr",
 	Default: []string{},
@@ -111,10 +146,12 @@ type Options struct {
 	Serve               bool                   `config:"rc_serve"`                   // set to serve files from remotes
 	ServeNoModTime      bool                   `config:"rc_serve_no_modtime"`        // don't read the modification time
 	NoAuth              bool                   `config:"rc_no_auth"`                 // set to disable auth checks on AuthRequired methods
+	TokensFile          string                 `config:"rc_tokens_file"`             // file of API tokens with scoped permissions
 	WebUI               bool                   `config:"rc_web_gui"`                 // set to launch the web ui
 	WebGUIUpdate        bool                   `config:"rc_web_gui_update"`          // set to check new update
 	WebGUIForceUpdate   bool                   `config:"rc_web_gui_force_update"`    // set to force download new update
 	WebGUINoOpenBrowser bool                   `config:"rc_web_gui_no_open_browser"` // set to disable auto opening browser
+	WebGUIBuiltin       bool                   `config:"rc_web_gui_builtin"`         // set to launch the built in dashboard
 	WebGUIFetchURL      string                 `config:"rc_web_fetch_url"`           // set the default url for fetching webgui
 	EnableMetrics       bool                   `config:"rc_enable_metrics"`          // set to disable prometheus metrics on /metrics
 	MetricsHTTP         libhttp.Config         `config:"metrics"`
@@ -122,6 +159,11 @@ type Options struct {
 	MetricsTemplate     libhttp.TemplateConfig `config:"metrics"`
 	JobExpireDuration   time.Duration          `config:"rc_job_expire_duration"`
 	JobExpireInterval   time.Duration          `config:"rc_job_expire_interval"`
+	JobScheduleFile     string                 `config:"rc_job_schedule_file"`
+	JobHistoryFile      string                 `config:"rc_job_history_file"`
+	JobHistoryMax       int                    `config:"rc_job_history_max"`
+	JobMaxRunning       int                    `config:"rc_job_max_running"`
+	JobMaxQueued        int                    `config:"rc_job_max_queued"`
 }
 
 // Opt is the default values used for Options
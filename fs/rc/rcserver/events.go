@@ -0,0 +1,173 @@
+package rcserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc/events"
+)
+
+const (
+	eventsBuffer    = 1024             // number of events buffered per client
+	eventsKeepAlive = 30 * time.Second // how often to send a comment to keep the stream open
+)
+
+// parse a comma separated list from the query values
+func queryList(values []string) (out []string) {
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+// eventsFilter makes a filter for the events from the URL parameters
+//
+//   - jobid - only events for these job ids
+//   - group - only events for these stats groups
+//   - type - only events of these types, or types starting with these followed by "/"
+//
+// Each parameter may be repeated or be a comma separated list.
+// Transfers done by a job are matched by its jobid as they are in
+// its stats group.
+func eventsFilter(r *http.Request) (filter func(*events.Event) bool, err error) {
+	query := r.URL.Query()
+	groups := map[string]struct{}{}
+	for _, group := range queryList(query["group"]) {
+		groups[group] = struct{}{}
+	}
+	jobIDs := map[int64]struct{}{}
+	for _, jobID := range queryList(query["jobid"]) {
+		id, err := strconv.ParseInt(jobID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad jobid %q: %w", jobID, err)
+		}
+		jobIDs[id] = struct{}{}
+	}
+	types := queryList(query["type"])
+	if len(groups) == 0 && len(jobIDs) == 0 && len(types) == 0 {
+		return nil, nil
+	}
+	return func(e *events.Event) bool {
+		if len(types) > 0 && !events.MatchType(e.Type, types) {
+			return false
+		}
+		if len(groups) == 0 && len(jobIDs) == 0 {
+			return true
+		}
+		if _, found := groups[e.Group]; found && e.Group != "" {
+			return true
+		}
+		if e.JobID != 0 {
+			if _, found := jobIDs[e.JobID]; found {
+				return true
+			}
+		}
+		if id, ok := strings.CutPrefix(e.Group, "job/"); ok {
+			if jobID, err := strconv.ParseInt(id, 10, 64); err == nil {
+				if _, found := jobIDs[jobID]; found {
+					return true
+				}
+			}
+		}
+		return false
+	}, nil
+}
+
+// writeEvent writes e to w in Server-Sent Events format
+func writeEvent(w http.ResponseWriter, e *events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if e.ID != 0 {
+		_, err = fmt.Fprintf(w, "id: %d\n", e.ID)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	return err
+}
+
+// serveEvents streams the events to the client as Server-Sent Events
+// until it disconnects or the server is shut down.
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	// The event stream contains log lines so protect it like the calls which need auth
+	if !s.opt.NoAuth && !s.server.UsingAuth() {
+		writeError("events", nil, w, fmt.Errorf("authentication must be set up on the rc server to use the event stream or the --rc-no-auth flag must be in use"), http.StatusForbidden)
+		return
+	}
+	if !s.checkAccess(w, r, "events", nil) {
+		return
+	}
+	filter, err := eventsFilter(r)
+	if err != nil {
+		writeError("events", nil, w, err, http.StatusBadRequest)
+		return
+	}
+	ctl := http.NewResponseController(w)
+	// The stream lasts longer than the server write timeout
+	if err := ctl.SetWriteDeadline(time.Time{}); err != nil {
+		fs.Debugf(nil, "rc: events: couldn't clear write deadline: %v", err)
+	}
+
+	sub := events.Subscribe(eventsBuffer, filter)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == "HEAD" {
+		return
+	}
+	_, err = fmt.Fprintf(w, ": rclone event stream\n\n")
+	if err == nil {
+		err = ctl.Flush()
+	}
+	if err != nil {
+		fs.Debugf(nil, "rc: events: failed to start stream: %v", err)
+		return
+	}
+	fs.Debugf(nil, "rc: events: client %s subscribed", r.RemoteAddr)
+	defer fs.Debugf(nil, "rc: events: client %s unsubscribed", r.RemoteAddr)
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case e := <-sub.Events():
+			err = writeEvent(w, e)
+			if lost := sub.Lost(); lost > 0 && err == nil {
+				err = writeEvent(w, &events.Event{
+					Type: events.Lost,
+					Time: time.Now(),
+					Data: map[string]int64{"lost": lost},
+				})
+			}
+		case <-keepAlive.C:
+			_, err = fmt.Fprintf(w, ": keepalive\n\n")
+		}
+		if err == nil {
+			err = ctl.Flush()
+		}
+		if err != nil {
+			fs.Debugf(nil, "rc: events: failed to write to client %s: %v", r.RemoteAddr, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package rcserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsFilter(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		event events.Event
+		want  bool
+	}{
+		{"", events.Event{Type: events.Log}, true},
+		{"type=job", events.Event{Type: events.JobStart}, true},
+		{"type=job", events.Event{Type: events.Log}, false},
+		{"type=jo", events.Event{Type: events.JobStart}, false},
+		{"type=log,transfer/fail", events.Event{Type: events.TransferFail}, true},
+		{"type=log&type=transfer/fail", events.Event{Type: events.TransferComplete}, false},
+		{"jobid=3", events.Event{Type: events.JobStart, JobID: 3}, true},
+		{"jobid=3", events.Event{Type: events.JobStart, JobID: 4}, false},
+		{"jobid=3", events.Event{Type: events.TransferStart, Group: "job/3"}, true},
+		{"jobid=3", events.Event{Type: events.TransferStart, Group: "job/33"}, false},
+		{"jobid=3", events.Event{Type: events.Log}, false},
+		{"group=mygroup", events.Event{Type: events.TransferStart, Group: "mygroup"}, true},
+		{"group=mygroup", events.Event{Type: events.TransferStart, Group: "other"}, false},
+		{"group=mygroup&jobid=3", events.Event{Type: events.JobFinish, JobID: 3}, true},
+		{"group=mygroup&type=job", events.Event{Type: events.TransferStart, Group: "mygroup"}, false},
+	} {
+		r := httptest.NewRequest("GET", "/events?"+test.query, nil)
+		filter, err := eventsFilter(r)
+		require.NoError(t, err, test.query)
+		got := filter == nil || filter(&test.event)
+		assert.Equal(t, test.want, got, "%s: %+v", test.query, test.event)
+	}
+
+	r := httptest.NewRequest("GET", "/events?jobid=potato", nil)
+	_, err := eventsFilter(r)
+	assert.ErrorContains(t, err, "bad jobid")
+}
+
+func TestEventsAuthRequired(t *testing.T) {
+	tests := []testRun{{
+		Name:     "events",
+		URL:      "events",
+		Method:   "GET",
+		Status:   http.StatusForbidden,
+		Contains: regexp.MustCompile(`authentication must be set up on the rc server to use the event stream`),
+	}}
+	opt := newTestOpt()
+	opt.Serve = false
+	opt.Files = ""
+	opt.NoAuth = false
+	testServer(t, tests, &opt)
+}
+
+func TestEventsStream(t *testing.T) {
+	opt := newTestOpt()
+	opt.HTTP.ListenAddr = []string{testBindAddress}
+	opt.Serve = false
+	opt.Files = ""
+	opt.NoAuth = true
+	rcServer, err := newServer(context.Background(), &opt, http.NewServeMux())
+	require.NoError(t, err)
+	require.NoError(t, rcServer.Serve())
+	defer func() {
+		assert.NoError(t, rcServer.Shutdown())
+		rcServer.Wait()
+	}()
+	testURL := rcServer.server.URLs()[0]
+
+	resp, err := http.Get(testURL + "events?type=job")
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// wait for the subscription to be set up
+	for i := 0; i < 100 && !events.Active(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.True(t, events.Active())
+
+	post, err := http.Post(testURL+"rc/noop", "application/json", strings.NewReader(`{"_async":true}`))
+	require.NoError(t, err)
+	var out rc.Params
+	require.NoError(t, json.NewDecoder(post.Body).Decode(&out))
+	require.NoError(t, post.Body.Close())
+	jobID, err := out.GetInt64("jobid")
+	require.NoError(t, err)
+
+	// read the events until the job has finished
+	var types []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && len(types) < 2 {
+		line := scanner.Text()
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var e events.Event
+		require.NoError(t, json.Unmarshal([]byte(data), &e))
+		if e.JobID != jobID {
+			continue
+		}
+		types = append(types, e.Type)
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, []string{events.JobStart, events.JobFinish}, types)
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"mime"
@@ -53,6 +54,8 @@ type Server struct {
 	files          http.Handler
 	pluginsHandler http.Handler
 	opt            *rc.Options
+	tokens         *tokens       // API tokens if --rc-tokens-file is in use
+	done           chan struct{} // closed when the server is shutting down
 }
 
 func newServer(ctx context.Context, opt *rc.Options, mux *http.ServeMux) (*Server, error) {
@@ -69,28 +72,23 @@ func newServer(ctx context.Context, opt *rc.Options, mux *http.ServeMux) (*Serve
 		if opt.WebUI {
 			fs.Logf(nil, "--rc-files overrides --rc-web-gui command\n")
 		}
+		if opt.WebGUIBuiltin {
+			fs.Logf(nil, "--rc-files overrides --rc-web-gui-builtin command\n")
+		}
 		fs.Logf(nil, "Serving files from %q", opt.Files)
 		fileHandler = http.FileServer(http.Dir(opt.Files))
+	} else if opt.WebGUIBuiltin {
+		if opt.WebUI {
+			fs.Logf(nil, "--rc-web-gui-builtin overrides --rc-web-gui command\n")
+		}
+		setWebGUIAuth(opt)
+		fs.Logf(nil, "Serving built in dashboard")
+		fileHandler = webgui.BuiltinHandler()
 	} else if opt.WebUI {
 		if err := webgui.CheckAndDownloadWebGUIRelease(opt.WebGUIUpdate, opt.WebGUIForceUpdate, opt.WebGUIFetchURL, config.GetCacheDir()); err != nil {
 			fs.Errorf(nil, "Error while fetching the latest release of Web GUI: %v", err)
 		}
-		if opt.NoAuth {
-			fs.Logf(nil, "It is recommended to use web gui with auth.")
-		} else {
-			if opt.Auth.BasicUser == "" && opt.Auth.HtPasswd == "" {
-				opt.Auth.BasicUser = "gui"
-				fs.Infof(nil, "No username specified. Using default username: %s \n", rc.Opt.Auth.BasicUser)
-			}
-			if opt.Auth.BasicPass == "" && opt.Auth.HtPasswd == "" {
-				randomPass, err := random.Password(128)
-				if err != nil {
-					fs.Fatalf(nil, "Failed to make password: %v", err)
-				}
-				opt.Auth.BasicPass = randomPass
-				fs.Infof(nil, "No password specified. Using random password: %s \n", randomPass)
-			}
-		}
+		setWebGUIAuth(opt)
 		opt.Serve = true
 
 		fs.Logf(nil, "Serving Web GUI")
@@ -104,12 +102,24 @@ func newServer(ctx context.Context, opt *rc.Options, mux *http.ServeMux) (*Serve
 		opt:            opt,
 		files:          fileHandler,
 		pluginsHandler: pluginsHandler,
+		done:           make(chan struct{}),
+	}
+
+	auth := opt.Auth
+	if opt.TokensFile != "" {
+		var err error
+		s.tokens, err = loadTokens(opt.TokensFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.CustomAuthFn = s.tokens.authFn(opt.Auth, opt.HTTP.ClientCA)
+		auth.CustomAuthHeaderFn = parseBearer
 	}
 
 	var err error
 	s.server, err = libhttp.NewServer(ctx,
 		libhttp.WithConfig(opt.HTTP),
-		libhttp.WithAuth(opt.Auth),
+		libhttp.WithAuth(auth),
 		libhttp.WithTemplate(opt.Template),
 	)
 	if err != nil {
@@ -134,6 +144,27 @@ func newServer(ctx context.Context, opt *rc.Options, mux *http.ServeMux) (*Serve
 	return s, nil
 }
 
+// setWebGUIAuth makes sure the GUI is served with some authentication
+// making up a user and password if necessary.
+func setWebGUIAuth(opt *rc.Options) {
+	if opt.NoAuth {
+		fs.Logf(nil, "It is recommended to use web gui with auth.")
+		return
+	}
+	if opt.Auth.BasicUser == "" && opt.Auth.HtPasswd == "" {
+		opt.Auth.BasicUser = "gui"
+		fs.Infof(nil, "No username specified. Using default username: %s \n", rc.Opt.Auth.BasicUser)
+	}
+	if opt.Auth.BasicPass == "" && opt.Auth.HtPasswd == "" {
+		randomPass, err := random.Password(128)
+		if err != nil {
+			fs.Fatalf(nil, "Failed to make password: %v", err)
+		}
+		opt.Auth.BasicPass = randomPass
+		fs.Infof(nil, "No password specified. Using random password: %s \n", randomPass)
+	}
+}
+
 // Serve runs the http server in the background.
 //
 // Use s.Close() and s.Wait() to shutdown server
@@ -160,7 +191,9 @@ func (s *Server) Serve() error {
 				fs.Debugf(nil, "login_token %q", encodedToken)
 				parameters.Add("login_token", encodedToken)
 				openURL.RawQuery = parameters.Encode()
-				openURL.RawPath = "/#/login"
+				if !s.opt.WebGUIBuiltin {
+					openURL.RawPath = "/#/login"
+				}
 			}
 			// Don't open browser if serving in testing environment or required not to do so.
 			if flag.Lookup("test.v") == nil && !s.opt.WebGUINoOpenBrowser {
@@ -249,6 +282,24 @@ func (s *Server) handlePost(w http.ResponseWriter, r *http.Request, path string)
 		return
 	}
 
+	// Sending notifications needs authorisation as the webhooks can
+	// be any URL
+	if _, found := in["_notify"]; found && !s.opt.NoAuth && !s.server.UsingAuth() {
+		writeError(path, in, w, errors.New("authentication must be set up on the rc server to use _notify or the --rc-no-auth flag must be in use"), http.StatusForbidden)
+		return
+	}
+
+	// Check the token is allowed to make the call
+	if !s.checkAccess(w, r, path, in) {
+		return
+	}
+
+	// Check the parameters match the schema of the call if it has one
+	if err := call.Validate(in); err != nil {
+		writeError(path, in, w, err, http.StatusBadRequest)
+		return
+	}
+
 	inOrig := in.Copy()
 
 	if call.NeedsRequest {
@@ -261,7 +312,7 @@ func (s *Server) handlePost(w http.ResponseWriter, r *http.Request, path string)
 	}
 
 	fs.Debugf(nil, "rc: %q: with parameters %+v", path, in)
-	job, out, err := jobs.NewJob(ctx, call.Fn, in)
+	job, out, err := jobs.NewJob(jobs.WithCommand(ctx, path), call.Fn, in)
 	if job != nil {
 		w.Header().Add("x-rclone-jobid", fmt.Sprintf("%d", job.ID))
 	}
@@ -353,17 +404,32 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, path string)
 	switch {
 	case fsMatchResult != nil && s.opt.Serve:
 		// Serve /[fs]/remote files
+		if !s.checkAccess(w, r, "serve", rc.Params{"fs": fsMatchResult[1]}) {
+			return
+		}
 		s.serveRemote(w, r, fsMatchResult[2], fsMatchResult[1])
 		return
+	case path == "events":
+		s.serveEvents(w, r)
+		return
+	case path == "openapi.json":
+		s.serveOpenAPI(w, r)
+		return
 	case path == "metrics" && s.opt.EnableMetrics:
+		if !s.checkAccess(w, r, "metrics", nil) {
+			return
+		}
 		promHandlerFunc(w, r)
 		return
 	case path == "*" && s.opt.Serve:
 		// Serve /* as the remote listing
+		if !s.checkAccess(w, r, "serve", nil) {
+			return
+		}
 		s.serveRoot(w, r)
 		return
 	case s.files != nil:
-		if s.opt.WebUI {
+		if s.pluginsHandler != nil {
 			pluginsMatchResult := webgui.PluginsMatch.FindStringSubmatch(path)
 
 			if len(pluginsMatchResult) > 2 {
@@ -384,12 +450,29 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, path string)
 		return
 	case path == "" && s.opt.Serve:
 		// Serve the root as a remote listing
+		if !s.checkAccess(w, r, "serve", nil) {
+			return
+		}
 		s.serveRoot(w, r)
 		return
 	}
 	http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 }
 
+// serveOpenAPI serves the OpenAPI document describing the rc calls
+func (s *Server) serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc := rc.Calls.OpenAPI()
+	// Point the document at this server
+	if publicURL := libhttp.PublicURL(r); publicURL != "" {
+		doc["servers"] = []rc.Params{{"url": strings.TrimRight(publicURL, "/")}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err := rc.WriteJSON(w, doc)
+	if err != nil {
+		fs.Errorf(nil, "rc: openapi: failed to write JSON output: %v", err)
+	}
+}
+
 // Wait blocks while the server is serving requests
 func (s *Server) Wait() {
 	s.server.Wait()
@@ -397,5 +480,6 @@ func (s *Server) Wait() {
 
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown() error {
+	close(s.done) // stop the event streams
 	return s.server.Shutdown()
 }
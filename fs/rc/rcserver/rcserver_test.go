@@ -20,6 +20,7 @@ import (
 	_ "github.com/rclone/rclone/backend/local"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configfile"
+	_ "github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fs/rc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -93,6 +94,7 @@ type testRun struct {
 	URL         string
 	User        string
 	Pass        string
+	Token       string
 	Status      int
 	Method      string
 	Range       string
@@ -144,6 +146,9 @@ func emulateCalls(t *testing.T, tests []testRun, mux chi.Router, testURL string)
 			if test.User != "" && test.Pass != "" {
 				req.SetBasicAuth(test.User, test.Pass)
 			}
+			if test.Token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.Token)
+			}
 
 			w := httptest.NewRecorder()
 			mux.ServeHTTP(w, req)
@@ -660,6 +665,35 @@ func TestAuthRequired(t *testing.T) {
 	testServer(t, tests, &opt)
 }
 
+func TestNotifyAuthRequired(t *testing.T) {
+	tests := []testRun{{
+		Name:        "notify",
+		URL:         "rc/noop",
+		Method:      "POST",
+		Body:        `{"_notify":{"Webhook":["http://127.0.0.1:1/"]}}`,
+		ContentType: "application/json",
+		Status:      http.StatusForbidden,
+		Expected: `{
+	"error": "authentication must be set up on the rc server to use _notify or the --rc-no-auth flag must be in use",
+	"input": {
+		"_notify": {
+			"Webhook": [
+				"http://127.0.0.1:1/"
+			]
+		}
+	},
+	"path": "rc/noop",
+	"status": 403
+}
+`,
+	}}
+	opt := newTestOpt()
+	opt.Serve = false
+	opt.Files = ""
+	opt.NoAuth = false
+	testServer(t, tests, &opt)
+}
+
 func TestNoAuth(t *testing.T) {
 	tests := []testRun{{
 		Name:        "auth",
@@ -850,3 +884,72 @@ func normalizeJSON(t *testing.T, jsonStr string) string {
 	require.NoError(t, err, "JSON marshalling failed")
 	return string(normalizedJSON)
 }
+
+func TestOpenAPI(t *testing.T) {
+	tests := []testRun{{
+		Name:     "openapi",
+		URL:      "openapi.json",
+		Status:   http.StatusOK,
+		Contains: regexp.MustCompile(`(?s)"openapi": "3\.1\.0".*"/operations/list": \{`),
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+	}, {
+		Name:        "validation",
+		URL:         "operations/list",
+		Method:      "POST",
+		Body:        `{"fs":"remote:","remote":"","opt":{},"recursiv":true}`,
+		ContentType: "application/json",
+		Status:      http.StatusBadRequest,
+		Contains:    regexp.MustCompile(`unknown parameter \\"recursiv\\"`),
+	}, {
+		Name:        "validationMissing",
+		URL:         "operations/list",
+		Method:      "POST",
+		Body:        `{}`,
+		ContentType: "application/json",
+		Status:      http.StatusBadRequest,
+		Contains:    regexp.MustCompile(`missing required parameter \\"fs\\"`),
+	}}
+	opt := newTestOpt()
+	opt.Serve = false
+	opt.Files = ""
+	opt.NoAuth = true
+	testServer(t, tests, &opt)
+}
+
+func TestWebGUIBuiltin(t *testing.T) {
+	tests := []testRun{{
+		Name:     "index",
+		URL:      "",
+		Status:   http.StatusOK,
+		Contains: regexp.MustCompile(`<title>rclone dashboard</title>`),
+	}, {
+		Name:     "script",
+		URL:      "dashboard.js",
+		Status:   http.StatusOK,
+		Contains: regexp.MustCompile(`rc\("core/stats"\)`),
+		Headers: map[string]string{
+			"Content-Type": "application/javascript",
+		},
+	}, {
+		Name:     "notfound",
+		URL:      "potato.html",
+		Status:   http.StatusNotFound,
+		Expected: "404 page not found\n",
+	}, {
+		Name:        "rc",
+		URL:         "rc/noop",
+		Method:      "POST",
+		Body:        `{"a":1}`,
+		ContentType: "application/json",
+		Status:      http.StatusOK,
+		Expected:    "{\n\t\"a\": 1\n}\n",
+	}}
+	opt := newTestOpt()
+	opt.Serve = false
+	opt.Files = ""
+	opt.NoAuth = true
+	opt.WebGUIBuiltin = true
+	testServer(t, tests, &opt)
+}
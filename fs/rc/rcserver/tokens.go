@@ -0,0 +1,307 @@
+package rcserver
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	goauth "github.com/abbot/go-http-auth"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
+	libhttp "github.com/rclone/rclone/lib/http"
+)
+
+// fsParams are the parameters of rc calls which name remotes
+var fsParams = []string{"fs", "srcFs", "dstFs", "checkFileFs", "path1", "path2"}
+
+// localName is the name local paths are matched as in the remotes of a token
+const localName = ":local"
+
+// apiToken is a named API token read from the --rc-tokens-file or a
+// user authenticated in some other way.
+type apiToken struct {
+	Name        string   `json:"name"`         // name of the token used in the audit log
+	Token       string   `json:"token"`        // the token, or
+	TokenSHA256 string   `json:"token_sha256"` // the hex encoded SHA-256 of the token
+	Calls       []string `json:"calls"`        // globs of the rc paths the token may call
+	Remotes     []string `json:"remotes"`      // globs of the remote names the token may use
+	Notify      bool     `json:"notify"`       // set if the token may pass _notify to send notifications
+
+	hash    []byte           // SHA-256 of the token
+	calls   []*regexp.Regexp // compiled Calls
+	remotes []*regexp.Regexp // compiled Remotes
+	all     bool             // set if this may do anything
+}
+
+// tokens are the API tokens in use
+type tokens struct {
+	items []*apiToken
+}
+
+// compileGlobs compiles globs in rclone's filter glob syntax
+func compileGlobs(globs []string) (res []*regexp.Regexp, err error) {
+	for _, glob := range globs {
+		re, err := filter.GlobStringToRegexp(glob, true, false)
+		if err != nil {
+			return nil, fmt.Errorf("bad glob %q: %w", glob, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// matchGlobs returns true if s matches any of res
+func matchGlobs(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// hashToken returns the SHA-256 of token
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+// loadTokens reads the API tokens from the JSON file at path
+func loadTokens(path string) (*tokens, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rc tokens file: %w", err)
+	}
+	var items []*apiToken
+	err = json.Unmarshal(data, &items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rc tokens file %q: %w", path, err)
+	}
+	names := map[string]struct{}{}
+	for i, t := range items {
+		if t.Name == "" {
+			return nil, fmt.Errorf("rc tokens file %q: token %d has no name", path, i+1)
+		}
+		if _, found := names[t.Name]; found {
+			return nil, fmt.Errorf("rc tokens file %q: duplicate token name %q", path, t.Name)
+		}
+		names[t.Name] = struct{}{}
+		switch {
+		case t.Token != "" && t.TokenSHA256 != "":
+			return nil, fmt.Errorf("rc tokens file %q: token %q must have only one of token and token_sha256", path, t.Name)
+		case t.Token != "":
+			t.hash = hashToken(t.Token)
+		case t.TokenSHA256 != "":
+			t.hash, err = hex.DecodeString(t.TokenSHA256)
+			if err != nil || len(t.hash) != sha256.Size {
+				return nil, fmt.Errorf("rc tokens file %q: token %q has an invalid token_sha256", path, t.Name)
+			}
+		default:
+			return nil, fmt.Errorf("rc tokens file %q: token %q needs a token or token_sha256", path, t.Name)
+		}
+		t.calls, err = compileGlobs(t.Calls)
+		if err != nil {
+			return nil, fmt.Errorf("rc tokens file %q: token %q: calls: %w", path, t.Name, err)
+		}
+		t.remotes, err = compileGlobs(t.Remotes)
+		if err != nil {
+			return nil, fmt.Errorf("rc tokens file %q: token %q: remotes: %w", path, t.Name, err)
+		}
+	}
+	fs.Infof(nil, "rc: loaded %d API tokens from %q", len(items), path)
+	return &tokens{items: items}, nil
+}
+
+// find the token matching the secret passed in or nil
+//
+// All the tokens are compared in constant time.
+func (ts *tokens) find(secret string) (found *apiToken) {
+	hash := hashToken(secret)
+	for _, t := range ts.items {
+		if subtle.ConstantTimeCompare(hash, t.hash) == 1 {
+			found = t
+		}
+	}
+	return found
+}
+
+// parseBearer reads the token from an "Authorization: Bearer" header
+// returning it as pass with an empty user
+func parseBearer(header string) (user, pass string, ok bool) {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", "", false
+	}
+	return "", token, true
+}
+
+// authFn returns the function used to authenticate requests to the
+// rc server when tokens are in use.
+//
+// A bearer token is looked up in the tokens. Otherwise the user and
+// password are checked against --rc-user/--rc-pass or --rc-htpasswd,
+// and a successful login may do anything, as may users authenticated
+// by client certificate.
+func (ts *tokens) authFn(auth libhttp.AuthConfig, clientCA string) libhttp.CustomAuthFn {
+	var basic *goauth.BasicAuth
+	if auth.HtPasswd != "" {
+		basic = goauth.NewBasicAuthenticator(auth.Realm, goauth.HtpasswdFileProvider(auth.HtPasswd))
+	}
+	return func(user, pass string) (value interface{}, err error) {
+		switch {
+		case user == "":
+			if t := ts.find(pass); t != nil {
+				return t, nil
+			}
+			return nil, errors.New("unknown token")
+		case basic != nil:
+			r := &http.Request{Header: http.Header{}}
+			r.SetBasicAuth(user, pass)
+			if basic.CheckAuth(r) != "" {
+				return &apiToken{Name: user, all: true}, nil
+			}
+		case auth.BasicUser != "":
+			userOK := subtle.ConstantTimeCompare([]byte(user), []byte(auth.BasicUser)) == 1
+			passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(auth.BasicPass)) == 1
+			if userOK && passOK {
+				return &apiToken{Name: user, all: true}, nil
+			}
+		case clientCA != "" && pass == "":
+			// user is the common name of the client certificate
+			return &apiToken{Name: user, all: true}, nil
+		}
+		return nil, errors.New("bad user or password")
+	}
+}
+
+// remoteNames returns the names of the remotes used in the parameters of
+// the call to path
+func remoteNames(path string, in rc.Params) (names []string) {
+	for _, key := range fsParams {
+		value, found := in[key]
+		if !found {
+			continue
+		}
+		name := ""
+		switch v := value.(type) {
+		case string:
+			parsed, err := fspath.Parse(v)
+			if err != nil {
+				name = v
+			} else {
+				name = parsed.Name
+			}
+		default:
+			// A remote defined as a JSON object
+			var m map[string]string
+			if err := in.GetStruct(key, &m); err == nil {
+				if m["_name"] != "" {
+					name = m["_name"]
+				} else {
+					name = ":" + m["type"]
+				}
+			}
+		}
+		if name == "" {
+			name = localName
+		}
+		names = append(names, name)
+	}
+	// The config calls name the remote they operate on
+	if strings.HasPrefix(path, "config/") {
+		if name, err := in.GetString("name"); err == nil && name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// check returns an error if t may not call path with the parameters in
+func (t *apiToken) check(path string, in rc.Params) error {
+	if t.all {
+		return nil
+	}
+	if !matchGlobs(t.calls, path) {
+		return fmt.Errorf("token %q is not allowed to call %q", t.Name, path)
+	}
+	for _, remote := range remoteNames(path, in) {
+		if !matchGlobs(t.remotes, remote) {
+			return fmt.Errorf("token %q is not allowed to use remote %q", t.Name, remote)
+		}
+	}
+	if _, found := in["_notify"]; found && !t.Notify {
+		return fmt.Errorf("token %q is not allowed to use _notify", t.Name)
+	}
+	// The token must be allowed to make each of the calls in a batch
+	if path == "rc/batch" {
+		var calls []jobs.BatchCall
+		err := in.GetStruct("calls", &calls)
+		if err != nil {
+			return err
+		}
+		for _, call := range calls {
+			err = t.check(call.Path, call.Params)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// The token must be allowed to make the call being scheduled too
+	if path == "job/schedule" {
+		command, err := in.GetString("command")
+		if err != nil {
+			return err
+		}
+		params := rc.Params{}
+		if _, found := in["params"]; found {
+			err = in.GetStruct("params", &params)
+			if err != nil {
+				return err
+			}
+		}
+		return t.check(command, params)
+	}
+	return nil
+}
+
+// checkAccess checks whether the token which authenticated r may call
+// path with the parameters in, writing an entry to the audit log.
+//
+// If it may not then it writes an error to w and returns false.
+//
+// It does nothing if the tokens file is not in use.
+func (s *Server) checkAccess(w http.ResponseWriter, r *http.Request, path string, in rc.Params) bool {
+	if s.tokens == nil {
+		return true
+	}
+	who := "unauthenticated"
+	var err error
+	t, _ := libhttp.CtxGetAuth(r.Context()).(*apiToken)
+	if t != nil {
+		who = fmt.Sprintf("%q", t.Name)
+		err = t.check(path, in)
+	} else if libhttp.IsUnixSocket(r) {
+		who = "unix socket"
+	} else {
+		err = errors.New("no token")
+	}
+	remotes := remoteNames(path, in)
+	if err != nil {
+		fs.Logf(nil, "rc: audit: %s from %s denied %q remotes %q: %v", who, r.RemoteAddr, path, remotes, err)
+		writeError(path, in, w, fmt.Errorf("forbidden: %w", err), http.StatusForbidden)
+		return false
+	}
+	fs.Infof(nil, "rc: audit: %s from %s called %q remotes %q", who, r.RemoteAddr, path, remotes)
+	return true
+}
@@ -0,0 +1,198 @@
+package rcserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// write a tokens file returning its path
+func writeTokens(t *testing.T, data string) string {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	return path
+}
+
+func TestLoadTokens(t *testing.T) {
+	hash := sha256.Sum256([]byte("secret2"))
+	path := writeTokens(t, `[
+	{"name": "one", "token": "secret1", "calls": ["core/stats"]},
+	{"name": "two", "token_sha256": "`+hex.EncodeToString(hash[:])+`", "calls": ["operations/*"], "remotes": ["s3*"]}
+]`)
+	ts, err := loadTokens(path)
+	require.NoError(t, err)
+	require.Len(t, ts.items, 2)
+	assert.Equal(t, "one", ts.find("secret1").Name)
+	assert.Equal(t, "two", ts.find("secret2").Name)
+	assert.Nil(t, ts.find("secret3"))
+	assert.Nil(t, ts.find(""))
+
+	for _, test := range []struct {
+		data string
+		err  string
+	}{
+		{`{}`, "failed to parse"},
+		{`[{"token": "x"}]`, "has no name"},
+		{`[{"name": "a", "token": "x"}, {"name": "a", "token": "y"}]`, "duplicate token name"},
+		{`[{"name": "a"}]`, "needs a token"},
+		{`[{"name": "a", "token": "x", "token_sha256": "00"}]`, "only one of"},
+		{`[{"name": "a", "token_sha256": "00"}]`, "invalid token_sha256"},
+		{`[{"name": "a", "token": "x", "calls": ["{"]}]`, "calls: bad glob"},
+	} {
+		_, err := loadTokens(writeTokens(t, test.data))
+		assert.ErrorContains(t, err, test.err, test.data)
+	}
+
+	_, err = loadTokens(filepath.Join(t.TempDir(), "notfound"))
+	assert.ErrorContains(t, err, "failed to read")
+}
+
+func TestRemoteNames(t *testing.T) {
+	for _, test := range []struct {
+		path string
+		in   rc.Params
+		want []string
+	}{
+		{"core/stats", rc.Params{}, nil},
+		{"operations/list", rc.Params{"fs": "remote:path", "remote": "dir"}, []string{"remote"}},
+		{"sync/copy", rc.Params{"srcFs": "/tmp/files", "dstFs": "s3,provider=AWS:bucket"}, []string{":local", "s3"}},
+		{"sync/copy", rc.Params{"srcFs": ":s3:bucket", "dstFs": map[string]any{"type": "drive"}}, []string{":s3", ":drive"}},
+		{"sync/bisync", rc.Params{"path1": "one:", "path2": map[string]any{"_name": "two", "_root": "x"}}, []string{"one", "two"}},
+		{"config/delete", rc.Params{"name": "remote"}, []string{"remote"}},
+		{"core/noop", rc.Params{"name": "remote"}, nil},
+	} {
+		assert.Equal(t, test.want, remoteNames(test.path, test.in), test.path)
+	}
+}
+
+func TestTokenCheck(t *testing.T) {
+	path := writeTokens(t, `[
+	{"name": "monitor", "token": "m", "calls": ["core/stats", "job/status"]},
+	{"name": "backup", "token": "b", "calls": ["sync/*", "job/schedule", "operations/*", "rc/batch"], "remotes": ["backup*", ":local"]},
+	{"name": "notify", "token": "n", "calls": ["sync/*"], "remotes": ["backup*"], "notify": true}
+]`)
+	ts, err := loadTokens(path)
+	require.NoError(t, err)
+	monitor, backup := ts.find("m"), ts.find("b")
+
+	assert.NoError(t, monitor.check("core/stats", rc.Params{}))
+	assert.ErrorContains(t, monitor.check("config/delete", rc.Params{"name": "remote"}), `not allowed to call "config/delete"`)
+	assert.ErrorContains(t, monitor.check("core/command", rc.Params{}), `not allowed to call "core/command"`)
+	assert.Error(t, monitor.check("core/stats/extra", rc.Params{}))
+	assert.NoError(t, backup.check("operations/list", rc.Params{"fs": "backup:"}))
+
+	assert.NoError(t, backup.check("sync/copy", rc.Params{"srcFs": "/home", "dstFs": "backup1:dir"}))
+	assert.ErrorContains(t, backup.check("sync/copy", rc.Params{"srcFs": "/home", "dstFs": "other:dir"}), `not allowed to use remote "other"`)
+	assert.NoError(t, backup.check("job/schedule", rc.Params{"command": "sync/sync", "params": rc.Params{"srcFs": "/home", "dstFs": "backup:"}}))
+	assert.ErrorContains(t, backup.check("job/schedule", rc.Params{"command": "core/command"}), `not allowed to call "core/command"`)
+	assert.ErrorContains(t, backup.check("job/schedule", rc.Params{"command": "sync/sync", "params": rc.Params{"dstFs": "other:"}}), `not allowed to use remote "other"`)
+
+	assert.NoError(t, backup.check("rc/batch", rc.Params{"calls": []rc.Params{{"path": "operations/stat", "params": rc.Params{"fs": "backup:"}}}}))
+	assert.ErrorContains(t, backup.check("rc/batch", rc.Params{"calls": []rc.Params{
+		{"path": "operations/stat", "params": rc.Params{"fs": "backup:"}},
+		{"path": "config/delete", "params": rc.Params{"name": "backup"}},
+	}}), `not allowed to call "config/delete"`)
+	assert.ErrorContains(t, backup.check("rc/batch", rc.Params{"calls": []rc.Params{{"path": "operations/stat", "params": rc.Params{"fs": "other:"}}}}), `not allowed to use remote "other"`)
+	assert.ErrorContains(t, monitor.check("rc/batch", rc.Params{"calls": []rc.Params{{"path": "core/stats"}}}), `not allowed to call "rc/batch"`)
+
+	// Only tokens with notify may send notifications
+	notify := ts.find("n")
+	require.NotNil(t, notify)
+	assert.NoError(t, notify.check("sync/sync", rc.Params{"dstFs": "backup:", "_notify": rc.Params{}}))
+	assert.ErrorContains(t, backup.check("sync/sync", rc.Params{"dstFs": "backup:", "_notify": rc.Params{}}), `not allowed to use _notify`)
+	assert.ErrorContains(t, backup.check("job/schedule", rc.Params{"command": "sync/sync", "params": rc.Params{"dstFs": "backup:", "_notify": rc.Params{}}}), `not allowed to use _notify`)
+	assert.ErrorContains(t, backup.check("rc/batch", rc.Params{"calls": []rc.Params{{"path": "operations/stat", "params": rc.Params{"fs": "backup:", "_notify": rc.Params{}}}}}), `not allowed to use _notify`)
+
+	all := &apiToken{Name: "user", all: true}
+	assert.NoError(t, all.check("core/command", rc.Params{"fs": "anything:"}))
+}
+
+func TestWithTokens(t *testing.T) {
+	tests := []testRun{{
+		Name:        "noToken",
+		URL:         "rc/noop",
+		Method:      "POST",
+		Body:        `{}`,
+		ContentType: "application/javascript",
+		Status:      http.StatusUnauthorized,
+		Expected:    "Unauthorized\n",
+	}, {
+		Name:        "badToken",
+		URL:         "rc/noop",
+		Method:      "POST",
+		Body:        `{}`,
+		ContentType: "application/javascript",
+		Status:      http.StatusUnauthorized,
+		Expected:    "401 Unauthorized\n",
+		Token:       "wrong",
+	}, {
+		Name:        "tokenAllowed",
+		URL:         "rc/noopauth",
+		Method:      "POST",
+		Body:        `{"fs":"remote:"}`,
+		ContentType: "application/json",
+		Status:      http.StatusOK,
+		Expected:    "{\n\t\"fs\": \"remote:\"\n}\n",
+		Token:       "secret",
+	}, {
+		Name:        "tokenCallDenied",
+		URL:         "rc/noop",
+		Method:      "POST",
+		Body:        `{}`,
+		ContentType: "application/javascript",
+		Status:      http.StatusForbidden,
+		Contains:    regexp.MustCompile(`token \\"limited\\" is not allowed to call \\"rc/noop\\"`),
+		Token:       "secret",
+	}, {
+		Name:        "tokenRemoteDenied",
+		URL:         "rc/noopauth",
+		Method:      "POST",
+		Body:        `{"fs":"other:"}`,
+		ContentType: "application/json",
+		Status:      http.StatusForbidden,
+		Contains:    regexp.MustCompile(`token \\"limited\\" is not allowed to use remote \\"other\\"`),
+		Token:       "secret",
+	}, {
+		Name:     "tokenEventsDenied",
+		URL:      "events",
+		Status:   http.StatusForbidden,
+		Contains: regexp.MustCompile(`not allowed to call \\"events\\"`),
+		Token:    "secret",
+	}, {
+		Name:        "userPass",
+		URL:         "rc/noop",
+		Method:      "POST",
+		Body:        `{"fs":"other:"}`,
+		ContentType: "application/json",
+		Status:      http.StatusOK,
+		Expected:    "{\n\t\"fs\": \"other:\"\n}\n",
+		User:        "user",
+		Pass:        "pass",
+	}, {
+		Name:        "userWrongPass",
+		URL:         "rc/noop",
+		Method:      "POST",
+		Body:        `{}`,
+		ContentType: "application/javascript",
+		Status:      http.StatusUnauthorized,
+		Expected:    "401 Unauthorized\n",
+		User:        "user",
+		Pass:        "wrong",
+	}}
+	opt := newTestOpt()
+	opt.Serve = false
+	opt.Files = ""
+	opt.NoAuth = false
+	opt.Auth.BasicUser = "user"
+	opt.Auth.BasicPass = "pass"
+	opt.TokensFile = writeTokens(t, `[{"name": "limited", "token": "secret", "calls": ["rc/noopauth"], "remotes": ["remote"]}]`)
+	testServer(t, tests, &opt)
+}
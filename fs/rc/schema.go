@@ -0,0 +1,198 @@
+// Describe and validate the parameters of the rc calls
+
+package rc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Types of the parameters and results of a Call
+const (
+	TypeAny      = ""         // any JSON value
+	TypeString   = "string"   // a string
+	TypeInteger  = "integer"  // an integer, or a string containing one
+	TypeNumber   = "number"   // a floating point number, or a string containing one
+	TypeBoolean  = "boolean"  // a boolean, or a string like "true"
+	TypeObject   = "object"   // a JSON object, or a string containing one
+	TypeArray    = "array"    // a JSON array, or a string containing one
+	TypeDuration = "duration" // a duration string, e.g. "1h30m"
+	TypeFs       = "fs"       // a remote as a string e.g. "drive:path" or as an object
+)
+
+// Param describes a parameter of a Call or a value in its result
+type Param struct {
+	Name     string // name of the parameter - if it ends in * then it matches any name starting with the rest
+	Type     string // one of the Type* constants
+	Items    string // the Type of the items if Type is TypeArray
+	Required bool   // set if the parameter must be supplied
+	Help     string // short description of the parameter
+}
+
+// prefix returns the prefix to match names with if p.Name is a
+// pattern and whether it is a pattern
+func (p *Param) prefix() (string, bool) {
+	return strings.CutSuffix(p.Name, "*")
+}
+
+// match returns true if name is described by p
+func (p *Param) match(name string) bool {
+	if prefix, ok := p.prefix(); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	return name == p.Name
+}
+
+// check the value of key in in is the right type for p
+func (p *Param) check(in Params, key string) (err error) {
+	switch p.Type {
+	case TypeString:
+		_, err = in.GetString(key)
+	case TypeInteger:
+		_, err = in.GetInt64(key)
+	case TypeNumber:
+		_, err = in.GetFloat64(key)
+	case TypeBoolean:
+		_, err = in.GetBool(key)
+	case TypeDuration:
+		_, err = in.GetDuration(key)
+	case TypeFs:
+		_, err = getFsName(in, key)
+	case TypeObject:
+		var out map[string]any
+		err = in.GetStruct(key, &out)
+	case TypeArray:
+		var out []any
+		err = in.GetStruct(key, &out)
+	}
+	return err
+}
+
+// param finds the Param describing the parameter name or returns nil
+func (c *Call) param(name string) *Param {
+	for i := range c.Params {
+		if c.Params[i].match(name) {
+			return &c.Params[i]
+		}
+	}
+	return nil
+}
+
+// suggest returns the name of the parameter which name is most likely
+// to be a misspelling of or "" if there isn't one
+func (c *Call) suggest(name string) (best string) {
+	bestDistance := 3
+	for _, p := range c.Params {
+		candidate, _ := p.prefix()
+		d := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if d < bestDistance {
+			best, bestDistance = p.Name, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// Validate checks the parameters in against the Params of the call.
+//
+// It checks that the required parameters are present, that the
+// parameters have the right types and that there are no unknown
+// parameters. Parameters starting with _ are the special parameters
+// and aren't checked.
+//
+// If the call doesn't describe its Params then nothing is checked.
+//
+// The error returned is of type ErrParamInvalid.
+func (c *Call) Validate(in Params) error {
+	if c.Params == nil {
+		return nil
+	}
+	var errs []error
+	for i := range c.Params {
+		p := &c.Params[i]
+		if _, isPattern := p.prefix(); isPattern {
+			continue
+		}
+		if _, found := in[p.Name]; !found && p.Required {
+			errs = append(errs, fmt.Errorf("missing required parameter %q", p.Name))
+		}
+	}
+	var keys []string
+	for key := range in {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.HasPrefix(key, "_") {
+			continue
+		}
+		p := c.param(key)
+		if p == nil {
+			err := fmt.Errorf("unknown parameter %q", key)
+			if suggestion := c.suggest(key); suggestion != "" {
+				err = fmt.Errorf("%w - did you mean %q?", err, suggestion)
+			}
+			errs = append(errs, err)
+			continue
+		}
+		if err := p.check(in, key); err != nil {
+			var invalid ErrParamInvalid
+			if errors.As(err, &invalid) {
+				err = invalid.error
+			}
+			errs = append(errs, fmt.Errorf("parameter %q should be %s: %w", key, p.describeType(), err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return NewErrParamInvalid(fmt.Errorf("%s: %s", c.Path, strings.Join(msgs, "; ")))
+}
+
+// describeType returns a readable description of the type of p
+func (p *Param) describeType() string {
+	switch p.Type {
+	case TypeAny:
+		return "any value"
+	case TypeInteger:
+		return "an integer"
+	case TypeArray:
+		if p.Items != "" {
+			return "an array of " + p.Items
+		}
+		return "an array"
+	case TypeObject:
+		return "an object"
+	case TypeDuration:
+		return `a duration e.g. "1h30m"`
+	case TypeFs:
+		return `a remote e.g. "drive:path" or a config object`
+	}
+	return "a " + p.Type
+}
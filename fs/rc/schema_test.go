@@ -0,0 +1,95 @@
+package rc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSchemaCall = &Call{
+	Path: "test/schema",
+	Params: []Param{
+		{Name: "fs", Type: TypeFs, Required: true},
+		{Name: "remote", Type: TypeString},
+		{Name: "recursive", Type: TypeBoolean},
+		{Name: "count", Type: TypeInteger},
+		{Name: "ratio", Type: TypeNumber},
+		{Name: "timeout", Type: TypeDuration},
+		{Name: "opt", Type: TypeObject},
+		{Name: "names", Type: TypeArray, Items: TypeString},
+		{Name: "dir*", Type: TypeString},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		in  Params
+		err string
+	}{
+		{Params{"fs": "remote:"}, ""},
+		{Params{"fs": Params{"type": "local"}, "remote": "x", "recursive": "true", "count": "3", "ratio": 1.5, "timeout": "10s", "opt": `{"a":1}`, "names": []string{"a"}, "dir": "a", "dir2": "b", "_async": true}, ""},
+		{Params{}, `test/schema: missing required parameter "fs"`},
+		{Params{"fs": "remote:", "recursiv": true}, `unknown parameter "recursiv" - did you mean "recursive"?`},
+		{Params{"fs": "remote:", "potato": true}, `unknown parameter "potato"`},
+		{Params{"fs": "remote:", "count": "many"}, `parameter "count" should be an integer`},
+		{Params{"fs": "remote:", "recursive": "maybe"}, `parameter "recursive" should be a boolean`},
+		{Params{"fs": "remote:", "timeout": "forever"}, `parameter "timeout" should be a duration`},
+		{Params{"fs": 3}, `parameter "fs" should be a remote`},
+		{Params{"fs": "remote:", "names": "x"}, `parameter "names" should be an array of string`},
+	} {
+		err := testSchemaCall.Validate(test.in)
+		if test.err == "" {
+			assert.NoError(t, err, test.in)
+			continue
+		}
+		require.Error(t, err, test.in)
+		assert.Contains(t, err.Error(), test.err)
+		assert.True(t, IsErrParamInvalid(err))
+	}
+
+	// No schema means no checking
+	assert.NoError(t, (&Call{}).Validate(Params{"anything": 1}))
+	// An empty schema means no parameters
+	assert.Error(t, (&Call{Params: []Param{}}).Validate(Params{"anything": 1}))
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("", ""))
+	assert.Equal(t, 3, editDistance("abc", ""))
+	assert.Equal(t, 1, editDistance("dstfs", "dstf"))
+	assert.Equal(t, 3, editDistance("kitten", "sitting"))
+}
+
+func TestOpenAPI(t *testing.T) {
+	r := NewRegistry()
+	r.Add(*testSchemaCall)
+	r.Add(Call{Path: "test/upload", NeedsRequest: true, AuthRequired: true, Params: []Param{{Name: "fs", Type: TypeFs}}})
+	doc := r.OpenAPI()
+
+	// Check it round trips through JSON
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	var out map[string]any
+	require.NoError(t, json.Unmarshal(data, &out))
+	assert.Equal(t, "3.1.0", out["openapi"])
+
+	paths := out["paths"].(map[string]any)
+	op := paths["/test/schema"].(map[string]any)["post"].(map[string]any)
+	assert.Equal(t, "test_schema", op["operationId"])
+	assert.Nil(t, op["security"])
+	schema := op["requestBody"].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)["schema"].(map[string]any)
+	assert.Equal(t, []any{"fs"}, schema["required"])
+	assert.Equal(t, false, schema["additionalProperties"])
+	properties := schema["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"$ref": "#/components/schemas/Fs"}, properties["fs"])
+	assert.Equal(t, map[string]any{"type": "integer", "format": "int64"}, properties["count"])
+	assert.Contains(t, properties, "_async")
+	assert.Contains(t, schema["patternProperties"], "^dir")
+
+	op = paths["/test/upload"].(map[string]any)["post"].(map[string]any)
+	assert.NotNil(t, op["security"])
+	assert.Len(t, op["parameters"], 1)
+	assert.Contains(t, op["requestBody"].(map[string]any)["content"], "multipart/form-data")
+}
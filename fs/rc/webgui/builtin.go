@@ -0,0 +1,25 @@
+package webgui
+
+import (
+	"embed"
+	iofs "io/fs"
+	"net/http"
+)
+
+// Builtin holds the embedded files of the built in dashboard
+//
+//go:embed builtin
+var Builtin embed.FS
+
+// BuiltinHandler returns a handler serving the built in dashboard.
+//
+// Unlike the Web GUI this needs nothing downloading so works offline.
+// The dashboard uses only the rc calls served alongside it.
+func BuiltinHandler() http.Handler {
+	sub, err := iofs.Sub(Builtin, "builtin")
+	if err != nil {
+		// Can only happen if the embed directive is wrong
+		panic(err)
+	}
+	return http.FileServer(http.FS(sub))
+}
@@ -0,0 +1,361 @@
+// The rclone built in dashboard
+//
+// This only uses the rc calls served alongside it so needs nothing
+// from the internet to work.
+"use strict";
+
+(function () {
+  var pollInterval = 2000;
+  var graphSamples = 150;
+  var maxJobs = 20;
+  var speeds = [];
+  var auth = null;
+
+  // If we were opened with a login_token then use it for the rc calls
+  // and remove it from the address bar.
+  var params = new URLSearchParams(window.location.search);
+  var token = params.get("login_token");
+  if (token) {
+    sessionStorage.setItem("login_token", token.replace(/-/g, "+").replace(/_/g, "/"));
+    params.delete("login_token");
+    var query = params.toString();
+    history.replaceState(null, "", window.location.pathname + (query ? "?" + query : ""));
+  }
+  if (sessionStorage.getItem("login_token")) {
+    auth = "Basic " + sessionStorage.getItem("login_token");
+  }
+
+  // rc makes an rc call returning a promise of its output
+  function rc(path, input) {
+    var headers = { "Content-Type": "application/json" };
+    if (auth) {
+      headers.Authorization = auth;
+    }
+    return fetch(path, {
+      method: "POST",
+      headers: headers,
+      body: JSON.stringify(input || {}),
+    }).then(function (resp) {
+      return resp.json().then(function (out) {
+        if (!resp.ok) {
+          throw new Error(out.error || resp.statusText);
+        }
+        return out;
+      });
+    });
+  }
+
+  // batch makes the calls with rc/batch returning a promise of the results
+  function batch(calls) {
+    if (calls.length === 0) {
+      return Promise.resolve([]);
+    }
+    return rc("rc/batch", { calls: calls }).then(function (out) {
+      return out.results;
+    });
+  }
+
+  function formatBytes(n) {
+    if (n === undefined || n === null || n < 0) {
+      return "-";
+    }
+    var units = ["B", "KiB", "MiB", "GiB", "TiB", "PiB"];
+    var i = 0;
+    while (n >= 1024 && i < units.length - 1) {
+      n /= 1024;
+      i++;
+    }
+    return (i === 0 ? n : n.toFixed(2)) + " " + units[i];
+  }
+
+  function formatDuration(seconds) {
+    if (seconds === undefined || seconds === null) {
+      return "-";
+    }
+    seconds = Math.round(seconds);
+    var h = Math.floor(seconds / 3600);
+    var m = Math.floor((seconds % 3600) / 60);
+    var s = seconds % 60;
+    return (h ? h + "h" : "") + (h || m ? m + "m" : "") + s + "s";
+  }
+
+  function cell(text) {
+    var td = document.createElement("td");
+    td.textContent = text;
+    return td;
+  }
+
+  function button(text, onClick) {
+    var td = document.createElement("td");
+    var b = document.createElement("button");
+    b.textContent = text;
+    b.addEventListener("click", onClick);
+    td.appendChild(b);
+    return td;
+  }
+
+  // fillTable replaces the rows of the table with those made by makeRow
+  function fillTable(id, items, makeRow, emptyText) {
+    var tbody = document.querySelector("#" + id + " tbody");
+    var columns = document.querySelectorAll("#" + id + " thead th").length;
+    tbody.textContent = "";
+    if (items.length === 0) {
+      var td = cell(emptyText);
+      td.colSpan = columns;
+      td.className = "empty";
+      tbody.appendChild(document.createElement("tr")).appendChild(td);
+      return;
+    }
+    items.forEach(function (item) {
+      var tr = document.createElement("tr");
+      makeRow(item).forEach(function (td) {
+        tr.appendChild(td);
+      });
+      tbody.appendChild(tr);
+    });
+  }
+
+  function showError(id, err) {
+    var tbody = document.querySelector("#" + id + " tbody");
+    var columns = document.querySelectorAll("#" + id + " thead th").length;
+    var td = cell(err.message);
+    td.colSpan = columns;
+    td.className = "error";
+    tbody.textContent = "";
+    tbody.appendChild(document.createElement("tr")).appendChild(td);
+  }
+
+  function setStatus(text, isError) {
+    var status = document.getElementById("status");
+    status.textContent = text;
+    status.className = isError ? "status error" : "status";
+  }
+
+  function showStats(stats) {
+    var items = [
+      ["Speed", formatBytes(stats.speed) + "/s"],
+      ["Transferred", formatBytes(stats.bytes) + " / " + formatBytes(stats.totalBytes)],
+      ["Files", stats.transfers + " / " + stats.totalTransfers],
+      ["Checks", stats.checks + " / " + stats.totalChecks],
+      ["Errors", stats.errors],
+      ["ETA", formatDuration(stats.eta)],
+      ["Elapsed", formatDuration(stats.elapsedTime)],
+    ];
+    var div = document.getElementById("stats");
+    div.textContent = "";
+    items.forEach(function (item) {
+      var d = document.createElement("div");
+      var label = document.createElement("span");
+      label.textContent = item[0];
+      d.appendChild(label);
+      d.appendChild(document.createTextNode(item[1]));
+      div.appendChild(d);
+    });
+    if (stats.lastError) {
+      var e = document.createElement("div");
+      e.className = "error";
+      e.textContent = stats.lastError;
+      div.appendChild(e);
+    }
+    fillTable("transferring", stats.transferring || [], function (t) {
+      return [
+        cell(t.name),
+        cell(formatBytes(t.size)),
+        cell(t.percentage + "%"),
+        cell(formatBytes(t.speedAvg) + "/s"),
+        cell(formatDuration(t.eta)),
+      ];
+    }, "Nothing transferring");
+
+    speeds.push(stats.transferring ? stats.transferring.reduce(function (total, t) {
+      return total + (t.speedAvg || 0);
+    }, 0) : 0);
+    if (speeds.length > graphSamples) {
+      speeds.shift();
+    }
+    drawGraph();
+  }
+
+  // drawGraph draws the recent transfer speeds
+  function drawGraph() {
+    var canvas = document.getElementById("graph");
+    var width = canvas.clientWidth;
+    var height = canvas.clientHeight;
+    canvas.width = width;
+    canvas.height = height;
+    var ctx = canvas.getContext("2d");
+    var max = Math.max.apply(null, speeds.concat([1024]));
+    var step = width / (graphSamples - 1);
+    var x0 = width - (speeds.length - 1) * step;
+    ctx.clearRect(0, 0, width, height);
+    ctx.beginPath();
+    ctx.moveTo(x0, height);
+    speeds.forEach(function (speed, i) {
+      ctx.lineTo(x0 + i * step, height - (speed / max) * (height - 20));
+    });
+    ctx.lineTo(width, height);
+    ctx.closePath();
+    ctx.fillStyle = "rgba(63, 121, 173, 0.3)";
+    ctx.fill();
+    ctx.strokeStyle = "#3f79ad";
+    ctx.stroke();
+    ctx.fillStyle = "#666";
+    ctx.fillText(formatBytes(max) + "/s", 4, 12);
+  }
+
+  function refreshStats() {
+    return Promise.all([rc("core/stats"), rc("core/bwlimit")]).then(function (outs) {
+      showStats(outs[0]);
+      var input = document.getElementById("bwlimit");
+      if (document.activeElement !== input) {
+        input.value = outs[1].rate;
+      }
+    });
+  }
+
+  // Every rc call runs as a job, including the ones made by this
+  // dashboard, so show the background jobs from the job history. If
+  // that isn't being kept fall back to the jobs still running.
+  function listJobs() {
+    return rc("job/list").then(function (list) {
+      return rc("job/history", { executeId: list.executeId, limit: maxJobs }).then(function (out) {
+        return out.jobs;
+      }, function () {
+        var ids = (list.jobids || []).slice().reverse();
+        return batch(ids.map(function (id) {
+          return { path: "job/status", params: { jobid: id } };
+        })).then(function (results) {
+          return results.filter(function (r) {
+            return r.output && !r.output.finished;
+          }).map(function (r) {
+            return r.output;
+          });
+        });
+      });
+    });
+  }
+
+  function refreshJobs() {
+    return listJobs().then(function (jobs) {
+      fillTable("jobs", jobs, function (job) {
+        var status = job.finished ? (job.success ? "Succeeded" : "Failed: " + job.error) : "Running";
+        var row = [
+          cell(job.id),
+          cell(job.command || ""),
+          cell(job.group),
+          cell(new Date(job.startTime).toLocaleString()),
+          cell(formatDuration(job.duration)),
+          cell(status),
+        ];
+        if (job.finished) {
+          row.push(cell(""));
+        } else {
+          row.push(button("Stop", function () {
+            rc("job/stop", { jobid: job.id }).then(refresh, alertError);
+          }));
+        }
+        return row;
+      }, "No jobs");
+    }).catch(function (err) {
+      showError("jobs", err);
+    });
+  }
+
+  function refreshMounts() {
+    return rc("mount/listmounts").then(function (out) {
+      fillTable("mounts", out.mountPoints || [], function (m) {
+        return [
+          cell(m.Fs),
+          cell(m.MountPoint),
+          cell(new Date(m.MountedOn).toLocaleString()),
+          button("Unmount", function () {
+            if (confirm("Unmount " + m.MountPoint + "?")) {
+              rc("mount/unmount", { mountPoint: m.MountPoint }).then(refresh, alertError);
+            }
+          }),
+        ];
+      }, "No mounts");
+    }).catch(function (err) {
+      showError("mounts", err);
+    });
+  }
+
+  function refreshVFS() {
+    return rc("vfs/list").then(function (list) {
+      var vfses = list.vfses || [];
+      return batch(vfses.map(function (name) {
+        return { path: "vfs/queue", params: { fs: name } };
+      })).then(function (results) {
+        var items = [];
+        results.forEach(function (r, i) {
+          var queued = r.output ? r.output.queued || [] : [];
+          queued.forEach(function (q) {
+            items.push([vfses[i], q]);
+          });
+        });
+        fillTable("vfs", items, function (item) {
+          var q = item[1];
+          return [
+            cell(item[0]),
+            cell(q.name),
+            cell(formatBytes(q.size)),
+            cell(q.tries),
+            cell(q.uploading ? "Uploading" : "Waiting " + formatDuration(q.expiry > 0 ? q.expiry : 0)),
+          ];
+        }, vfses.length ? "Nothing queued" : "No VFS in use");
+      });
+    }).catch(function (err) {
+      showError("vfs", err);
+    });
+  }
+
+  // refreshRemotes shows the configured remotes. Only the name and
+  // type are shown so no secrets from the config are displayed.
+  function refreshRemotes() {
+    return rc("config/dump").then(function (remotes) {
+      var names = Object.keys(remotes).sort();
+      fillTable("remotes", names, function (name) {
+        return [cell(name), cell(remotes[name].type)];
+      }, "No remotes configured");
+    }).catch(function (err) {
+      showError("remotes", err);
+    });
+  }
+
+  function alertError(err) {
+    alert(err.message);
+  }
+
+  function refresh() {
+    return refreshStats().then(function () {
+      setStatus("Connected", false);
+    }, function (err) {
+      setStatus("Disconnected: " + err.message, true);
+    }).then(function () {
+      return Promise.all([refreshJobs(), refreshMounts(), refreshVFS()]);
+    });
+  }
+
+  document.getElementById("bwlimit-form").addEventListener("submit", function (e) {
+    e.preventDefault();
+    var rate = document.getElementById("bwlimit").value || "off";
+    rc("core/bwlimit", { rate: rate }).then(function () {
+      document.getElementById("bwlimit").blur();
+      return refresh();
+    }, alertError);
+  });
+
+  rc("core/version").then(function (out) {
+    document.getElementById("version").textContent = out.version;
+  }, function () {});
+  refreshRemotes();
+  setInterval(refreshRemotes, 10 * pollInterval);
+
+  // Poll again once each refresh is done so slow calls don't pile up
+  function poll() {
+    refresh().then(function () {
+      setTimeout(poll, pollInterval);
+    });
+  }
+  poll();
+})();
@@ -10,8 +10,14 @@ func init() {
 	for _, name := range []string{"sync", "copy", "move"} {
 		name := name
 		moveHelp := ""
+		params := []rc.Param{
+			{Name: "srcFs", Type: rc.TypeFs, Required: true, Help: "the source remote"},
+			{Name: "dstFs", Type: rc.TypeFs, Required: true, Help: "the destination remote"},
+			{Name: "createEmptySrcDirs", Type: rc.TypeBoolean, Help: "create empty src directories on destination if set"},
+		}
 		if name == "move" {
 			moveHelp = "- deleteEmptySrcDirs - delete empty src directories if set\n"
+			params = append(params, rc.Param{Name: "deleteEmptySrcDirs", Type: rc.TypeBoolean, Help: "delete empty src directories if set"})
 		}
 		rc.Add(rc.Call{
 			Path:         "sync/" + name,
@@ -19,7 +25,9 @@ func init() {
 			Fn: func(ctx context.Context, in rc.Params) (rc.Params, error) {
 				return rcSyncCopyMove(ctx, in, name)
 			},
-			Title: name + " a directory from source remote to destination remote",
+			Title:  name + " a directory from source remote to destination remote",
+			Params: params,
+			Result: []rc.Param{},
 			Help: `This takes the following parameters:
 
 - srcFs - a remote name string e.g. "drive:src" for the source
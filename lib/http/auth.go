@@ -64,6 +64,12 @@ Use ` + "`--{{ .Prefix }}salt`" + ` to change the password hashing salt from the
 // If a non nil value is returned then it is added to the context under the key
 type CustomAuthFn func(user, pass string) (value interface{}, err error)
 
+// CustomAuthHeaderFn if used is called with Authorization headers
+// which aren't Basic auth, e.g. "Bearer <token>", to read the user and
+// pass to give to CustomAuthFn. It returns ok false if it doesn't
+// accept the header.
+type CustomAuthHeaderFn func(header string) (user, pass string, ok bool)
+
 // AuthConfigInfo descripts the Options in use
 var AuthConfigInfo = fs.Options{{
 	Name:    "htpasswd",
@@ -78,9 +84,10 @@ var AuthConfigInfo = fs.Options{{
 	Default: "",
 	Help:    "User name for authentication",
 }, {
-	Name:    "pass",
-	Default: "",
-	Help:    "Password for authentication",
+	Name:      "pass",
+	Default:   "",
+	Help:      "Password for authentication",
+	Sensitive: true,
 }, {
 	Name:    "salt",
 	Default: "dlPL2MqE",
@@ -95,6 +102,8 @@ type AuthConfig struct {
 	BasicPass    string       `config:"pass"`       // password for BasicUser
 	Salt         string       `config:"salt"`       // password hashing salt
 	CustomAuthFn CustomAuthFn `json:"-" config:"-"` // custom Auth (not set by command line flags)
+
+	CustomAuthHeaderFn CustomAuthHeaderFn `json:"-" config:"-"` // read other Authorization headers for CustomAuthFn (not set by command line flags)
 }
 
 // AddFlagsPrefix adds flags to the flag set for AuthConfig
@@ -121,6 +121,13 @@ func MiddlewareAuthBasic(user, pass, realm, salt string) Middleware {
 
 // MiddlewareAuthCustom instantiates middleware that authenticates using a custom function
 func MiddlewareAuthCustom(fn CustomAuthFn, realm string, userFromContext bool) Middleware {
+	return MiddlewareAuthCustomHeader(fn, nil, realm, userFromContext)
+}
+
+// MiddlewareAuthCustomHeader instantiates middleware that authenticates
+// using a custom function, calling headerFn if set to read the user
+// and pass from Authorization headers which aren't Basic auth
+func MiddlewareAuthCustomHeader(fn CustomAuthFn, headerFn CustomAuthHeaderFn, realm string, userFromContext bool) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// skip auth for unix socket
@@ -135,6 +142,9 @@ func MiddlewareAuthCustom(fn CustomAuthFn, realm string, userFromContext bool) M
 			}
 
 			user, pass, ok := parseAuthorization(r)
+			if !ok && headerFn != nil {
+				user, pass, ok = headerFn(r.Header.Get("Authorization"))
+			}
 			if !ok && userFromContext {
 				user, ok = CtxGetUser(r.Context())
 			}
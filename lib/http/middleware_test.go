@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -536,3 +537,58 @@ func TestMiddlewareCORSWithAuth(t *testing.T) {
 		})
 	}
 }
+
+func TestParseAuthorization(t *testing.T) {
+	for _, test := range []struct {
+		header string
+		user   string
+		pass   string
+		ok     bool
+	}{
+		{"", "", "", false},
+		{"Basic dXNlcjpwYXNz", "user", "pass", true},
+		{"Basic dXNlcg==", "user", "", false},
+		{"Bearer token", "", "", false},
+		{"Potato token", "", "", false},
+	} {
+		req, err := http.NewRequest("GET", "http://example.com/", nil)
+		require.NoError(t, err)
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		user, pass, ok := parseAuthorization(req)
+		require.Equal(t, test.user, user, test.header)
+		require.Equal(t, test.pass, pass, test.header)
+		require.Equal(t, test.ok, ok, test.header)
+	}
+}
+
+func TestMiddlewareAuthCustomHeader(t *testing.T) {
+	authFn := func(user, pass string) (value interface{}, err error) {
+		if user == "" && pass == "token" {
+			return true, nil
+		}
+		return nil, errors.New("invalid credentials")
+	}
+	headerFn := func(header string) (user, pass string, ok bool) {
+		token, found := strings.CutPrefix(header, "Bearer ")
+		return "", token, found
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, test := range []struct {
+		headerFn CustomAuthHeaderFn
+		header   string
+		status   int
+	}{
+		{nil, "Bearer token", http.StatusUnauthorized},
+		{headerFn, "Bearer token", http.StatusOK},
+		{headerFn, "Bearer potato", http.StatusUnauthorized},
+		{headerFn, "Potato token", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		req.Header.Set("Authorization", test.header)
+		w := httptest.NewRecorder()
+		MiddlewareAuthCustomHeader(authFn, test.headerFn, "test", false)(handler).ServeHTTP(w, req)
+		require.Equal(t, test.status, w.Code, test.header)
+	}
+}
@@ -3,8 +3,10 @@ package serve
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"html/template"
+	"mime"
 	"net/http"
 	"net/url"
 	"path"
@@ -22,6 +24,7 @@ type DirEntry struct {
 	remote  string
 	URL     string
 	Leaf    string
+	Name    string // Leaf without the trailing / of directories
 	IsDir   bool
 	Size    int64
 	ModTime time.Time
@@ -38,6 +41,7 @@ type Directory struct {
 	Breadcrumb   []Crumb
 	Sort         string
 	Order        string
+	Writable     bool // show the controls to upload, create folders, rename and delete
 }
 
 // Crumb is a breadcrumb entry
@@ -100,6 +104,7 @@ func (d *Directory) AddHTMLEntry(remote string, isDir bool, size int64, modTime
 		remote:  remote,
 		URL:     rest.URLPathEscape(urlRemote) + d.Query,
 		Leaf:    leaf,
+		Name:    strings.TrimSuffix(leaf, "/"),
 		IsDir:   isDir,
 		Size:    size,
 		ModTime: modTime,
@@ -121,6 +126,7 @@ func (d *Directory) AddEntry(remote string, isDir bool) {
 		remote: remote,
 		URL:    rest.URLPathEscape(urlRemote) + d.Query,
 		Leaf:   leaf,
+		Name:   strings.TrimSuffix(leaf, "/"),
 	})
 }
 
@@ -232,7 +238,13 @@ func (d *Directory) Serve(w http.ResponseWriter, r *http.Request) {
 	fs.Infof(d.DirRemote, "%s: Serving directory", r.RemoteAddr)
 
 	buf := &bytes.Buffer{}
-	err := d.HTMLTemplate.Execute(buf, d)
+	var err error
+	if AcceptsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(buf).Encode(d.jsonListing())
+	} else {
+		err = d.HTMLTemplate.Execute(buf, d)
+	}
 	if err != nil {
 		Error(ctx, d.DirRemote, w, "Failed to render template", err)
 		return
@@ -243,3 +255,56 @@ func (d *Directory) Serve(w http.ResponseWriter, r *http.Request) {
 		Error(ctx, d.DirRemote, nil, "Failed to drain template buffer", err)
 	}
 }
+
+// jsonEntry is a directory entry in a JSON listing
+type jsonEntry struct {
+	Name    string     `json:"name"`
+	URL     string     `json:"url"`
+	IsDir   bool       `json:"isDir"`
+	Size    int64      `json:"size"`
+	ModTime *time.Time `json:"modTime,omitempty"`
+}
+
+// jsonListing returns the directory as served for JSON requests
+func (d *Directory) jsonListing() interface{} {
+	entries := make([]jsonEntry, 0, len(d.Entries))
+	for _, e := range d.Entries {
+		entry := jsonEntry{
+			Name:  e.Name,
+			URL:   e.URL,
+			IsDir: e.IsDir,
+			Size:  e.Size,
+		}
+		if !e.ModTime.IsZero() {
+			modTime := e.ModTime
+			entry.ModTime = &modTime
+		}
+		entries = append(entries, entry)
+	}
+	return struct {
+		Name    string      `json:"name"`
+		Entries []jsonEntry `json:"entries"`
+	}{
+		Name:    d.Name,
+		Entries: entries,
+	}
+}
+
+// AcceptsJSON returns true if the Accept header of r prefers JSON to
+// HTML, for example "application/json" but not the "text/html,...,*/*"
+// sent by browsers.
+func AcceptsJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json":
+			return true
+		case "text/html":
+			return false
+		}
+	}
+	return false
+}
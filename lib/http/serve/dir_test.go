@@ -46,11 +46,11 @@ func TestAddHTMLEntry(t *testing.T) {
 	d.AddHTMLEntry("a/b/c/colon:colon.txt", false, 64, modtime)
 	d.AddHTMLEntry("\"quotes\".txt", false, 64, modtime)
 	assert.Equal(t, []DirEntry{
-		{remote: "", URL: "/", Leaf: "/", IsDir: true, Size: 0, ModTime: modtime},
-		{remote: "dir", URL: "dir/", Leaf: "dir/", IsDir: true, Size: 0, ModTime: modtime},
-		{remote: "a/b/c/d.txt", URL: "d.txt", Leaf: "d.txt", IsDir: false, Size: 64, ModTime: modtime},
-		{remote: "a/b/c/colon:colon.txt", URL: "./colon:colon.txt", Leaf: "colon:colon.txt", IsDir: false, Size: 64, ModTime: modtime},
-		{remote: "\"quotes\".txt", URL: "%22quotes%22.txt", Leaf: "\"quotes\".txt", Size: 64, IsDir: false, ModTime: modtime},
+		{remote: "", URL: "/", Leaf: "/", Name: "", IsDir: true, Size: 0, ModTime: modtime},
+		{remote: "dir", URL: "dir/", Leaf: "dir/", Name: "dir", IsDir: true, Size: 0, ModTime: modtime},
+		{remote: "a/b/c/d.txt", URL: "d.txt", Leaf: "d.txt", Name: "d.txt", IsDir: false, Size: 64, ModTime: modtime},
+		{remote: "a/b/c/colon:colon.txt", URL: "./colon:colon.txt", Leaf: "colon:colon.txt", Name: "colon:colon.txt", IsDir: false, Size: 64, ModTime: modtime},
+		{remote: "\"quotes\".txt", URL: "%22quotes%22.txt", Leaf: "\"quotes\".txt", Name: "\"quotes\".txt", Size: 64, IsDir: false, ModTime: modtime},
 	}, d.Entries)
 
 	// Now test with a query parameter
@@ -58,8 +58,8 @@ func TestAddHTMLEntry(t *testing.T) {
 	d.AddHTMLEntry("file", false, 64, modtime)
 	d.AddHTMLEntry("dir", true, 0, modtime)
 	assert.Equal(t, []DirEntry{
-		{remote: "file", URL: "file?potato=42", Leaf: "file", IsDir: false, Size: 64, ModTime: modtime},
-		{remote: "dir", URL: "dir/?potato=42", Leaf: "dir/", IsDir: true, Size: 0, ModTime: modtime},
+		{remote: "file", URL: "file?potato=42", Leaf: "file", Name: "file", IsDir: false, Size: 64, ModTime: modtime},
+		{remote: "dir", URL: "dir/?potato=42", Leaf: "dir/", Name: "dir", IsDir: true, Size: 0, ModTime: modtime},
 	}, d.Entries)
 }
 
@@ -71,11 +71,11 @@ func TestAddEntry(t *testing.T) {
 	d.AddEntry("a/b/c/colon:colon.txt", false)
 	d.AddEntry("\"quotes\".txt", false)
 	assert.Equal(t, []DirEntry{
-		{remote: "", URL: "/", Leaf: "/"},
-		{remote: "dir", URL: "dir/", Leaf: "dir/"},
-		{remote: "a/b/c/d.txt", URL: "d.txt", Leaf: "d.txt"},
-		{remote: "a/b/c/colon:colon.txt", URL: "./colon:colon.txt", Leaf: "colon:colon.txt"},
-		{remote: "\"quotes\".txt", URL: "%22quotes%22.txt", Leaf: "\"quotes\".txt"},
+		{remote: "", URL: "/", Leaf: "/", Name: ""},
+		{remote: "dir", URL: "dir/", Leaf: "dir/", Name: "dir"},
+		{remote: "a/b/c/d.txt", URL: "d.txt", Leaf: "d.txt", Name: "d.txt"},
+		{remote: "a/b/c/colon:colon.txt", URL: "./colon:colon.txt", Leaf: "colon:colon.txt", Name: "colon:colon.txt"},
+		{remote: "\"quotes\".txt", URL: "%22quotes%22.txt", Leaf: "\"quotes\".txt", Name: "\"quotes\".txt"},
 	}, d.Entries)
 
 	// Now test with a query parameter
@@ -83,8 +83,8 @@ func TestAddEntry(t *testing.T) {
 	d.AddEntry("file", false)
 	d.AddEntry("dir", true)
 	assert.Equal(t, []DirEntry{
-		{remote: "file", URL: "file?potato=42", Leaf: "file"},
-		{remote: "dir", URL: "dir/?potato=42", Leaf: "dir/"},
+		{remote: "file", URL: "file?potato=42", Leaf: "file", Name: "file"},
+		{remote: "dir", URL: "dir/?potato=42", Leaf: "dir/", Name: "dir"},
 	}, d.Entries)
 }
 
@@ -124,3 +124,45 @@ func TestServe(t *testing.T) {
 </html>
 `, string(body))
 }
+
+func TestServeJSON(t *testing.T) {
+	modTime := time.Date(2000, 1, 2, 3, 4, 5, 0, time.UTC)
+	d := NewDirectory("aDirectory", GetTemplate(t))
+	d.AddHTMLEntry("aDirectory/file", false, 64, modTime)
+	d.AddHTMLEntry("aDirectory/dir", true, -1, time.Time{})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://example.com/aDirectory/", nil)
+	r.Header.Set("Accept", "application/json")
+	d.Serve(w, r)
+	resp := w.Result()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.JSONEq(t, `{
+	"name": "/aDirectory",
+	"entries": [
+		{"name": "file", "url": "file", "isDir": false, "size": 64, "modTime": "2000-01-02T03:04:05Z"},
+		{"name": "dir", "url": "dir/", "isDir": true, "size": -1}
+	]
+}`, string(body))
+}
+
+func TestAcceptsJSON(t *testing.T) {
+	for _, test := range []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"application/json", true},
+		{"application/json; charset=utf-8", true},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+		{"*/*", false},
+		{"application/json, text/html", true},
+		{"potato", false},
+	} {
+		r := httptest.NewRequest("GET", "http://example.com/", nil)
+		r.Header.Set("Accept", test.accept)
+		assert.Equal(t, test.want, AcceptsJSON(r), test.accept)
+	}
+}
@@ -401,7 +401,7 @@ func (s *Server) initAuth() {
 
 	if s.auth.CustomAuthFn != nil {
 		s.usingAuth = true
-		s.mux.Use(MiddlewareAuthCustom(s.auth.CustomAuthFn, s.auth.Realm, authCertificateUserEnabled))
+		s.mux.Use(MiddlewareAuthCustomHeader(s.auth.CustomAuthFn, s.auth.CustomAuthHeaderFn, s.auth.Realm, authCertificateUserEnabled))
 		return
 	}
 
@@ -5,6 +5,7 @@ This is a very simple test/demo program for librclone's C interface
 #include <stdlib.h>
 #include <string.h>
 #include <dlfcn.h>
+#include <unistd.h>
 #include "librclone.h"
 
 void testRPC(char *method, char *in) {
@@ -98,6 +99,53 @@ void testCopyFile() {
             "}");
 }
 
+// write a file then read it back with the streaming API
+void testStream() {
+    printf("test RcloneOpen/RcloneRead/RcloneWrite\n");
+    const char *data = "hello from librclone";
+    struct RcloneHandleResult h = RcloneOpen("/tmp", "librclone-ctest.txt", "w");
+    if (h.Error != NULL) {
+        fprintf(stderr, "Open for write failed: %s\n", h.Error);
+        exit(EXIT_FAILURE);
+    }
+    struct RcloneIOResult w = RcloneWrite(h.Handle, (void*)data, strlen(data));
+    if (w.Error != NULL || w.N != (int64_t)strlen(data)) {
+        fprintf(stderr, "Write failed: %s\n", w.Error);
+        exit(EXIT_FAILURE);
+    }
+    char *err = RcloneClose(h.Handle);
+    if (err != NULL) {
+        fprintf(stderr, "Close after write failed: %s\n", err);
+        exit(EXIT_FAILURE);
+    }
+
+    h = RcloneOpen("/tmp", "librclone-ctest.txt", "r");
+    if (h.Error != NULL) {
+        fprintf(stderr, "Open for read failed: %s\n", h.Error);
+        exit(EXIT_FAILURE);
+    }
+    char buf[64];
+    int64_t total = 0;
+    for (;;) {
+        struct RcloneIOResult r = RcloneRead(h.Handle, buf + total, sizeof(buf) - 1 - total);
+        if (r.Error != NULL) {
+            fprintf(stderr, "Read failed: %s\n", r.Error);
+            exit(EXIT_FAILURE);
+        }
+        if (r.N == 0) {
+            break;
+        }
+        total += r.N;
+    }
+    buf[total] = 0;
+    free(RcloneClose(h.Handle));
+    if (strcmp(data, buf) != 0) {
+        fprintf(stderr, "Wrong data read.\nWant: %s\nGot: %s\n", data, buf);
+        exit(EXIT_FAILURE);
+    }
+    unlink("/tmp/librclone-ctest.txt");
+}
+
 // list the remotes
 void testListRemotes() {
     printf("test operations/listremotes\n");
@@ -110,6 +158,7 @@ int main(int argc, char** argv) {
 
     testNoOp();
     testError();
+    testStream();
     /* testCopyFile(); */
     /* testListRemotes(); */
 
@@ -2,6 +2,8 @@
 package gomobile
 
 import (
+	"io"
+
 	"github.com/rclone/rclone/librclone/librclone"
 
 	_ "github.com/rclone/rclone/backend/all" // import all backends
@@ -40,3 +42,75 @@ func RcloneRPC(method string, input string) (result *RcloneRPCResult) { //nolint
 		Status: status,
 	}
 }
+
+// RcloneOpen opens a file on a remote for reading with mode "r" or
+// writing with mode "w" returning a handle to stream it with
+// RcloneRead or RcloneWrite.
+//
+// The upload of files opened for writing finishes when the handle is
+// closed with RcloneClose.
+func RcloneOpen(fs string, remote string, mode string) (int64, error) {
+	return librclone.Open(fs, remote, mode)
+}
+
+// RcloneRead reads up to size bytes from the file handle, returning
+// an empty result at the end of the file.
+func RcloneRead(handle int64, size int) ([]byte, error) {
+	buf := make([]byte, size)
+	n, err := librclone.Read(handle, buf)
+	if err == io.EOF {
+		err = nil
+	}
+	return buf[:n], err
+}
+
+// RcloneWrite writes data to the file handle
+func RcloneWrite(handle int64, data []byte) (int, error) {
+	return librclone.Write(handle, data)
+}
+
+// RcloneSeek sets the offset for the next RcloneRead on the file
+// handle, with whence 0 for the start of the file, 1 for the current
+// offset and 2 for the end, returning the new offset.
+func RcloneSeek(handle int64, offset int64, whence int) (int64, error) {
+	return librclone.Seek(handle, offset, whence)
+}
+
+// RcloneClose closes a handle from RcloneOpen or RcloneListOpen
+func RcloneClose(handle int64) error {
+	return librclone.Close(handle)
+}
+
+// RcloneListOpen starts listing dir on the remote returning a handle
+// to read the entries with RcloneListNext.
+//
+// opt is a JSON object with the options of operations/list or "".
+func RcloneListOpen(fs string, dir string, opt string) (int64, error) {
+	return librclone.ListOpen(fs, dir, opt)
+}
+
+// RcloneListNext returns up to maxEntries entries from the listing
+// handle as a JSON array, returning an empty array when the listing
+// is finished.
+func RcloneListNext(handle int64, maxEntries int) (string, error) {
+	return librclone.ListNext(handle, maxEntries)
+}
+
+// RcloneEventCallback is implemented to receive events from RcloneSubscribe
+type RcloneEventCallback interface {
+	OnEvent(event string)
+}
+
+// RcloneSubscribe calls callback with each event as a JSON object,
+// returning an id to pass to RcloneUnsubscribe.
+//
+// types is a comma separated list of event types to receive, e.g.
+// "log,transfer", or "" for all.
+func RcloneSubscribe(types string, callback RcloneEventCallback) int64 {
+	return librclone.Subscribe(types, callback.OnEvent)
+}
+
+// RcloneUnsubscribe stops the callbacks registered by RcloneSubscribe
+func RcloneUnsubscribe(id int64) error {
+	return librclone.Unsubscribe(id)
+}
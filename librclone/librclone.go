@@ -21,15 +21,34 @@ package main
 
 /*
 #include <stdlib.h>
+#include <stdint.h>
 
 struct RcloneRPCResult {
 	char*	Output;
 	int	Status;
 };
+
+struct RcloneHandleResult {
+	int64_t	Handle;
+	char*	Error;
+};
+
+struct RcloneIOResult {
+	int64_t	N;
+	char*	Error;
+};
+
+typedef void (*RcloneEventCallback)(void* userData, char* event);
+
+static inline void rcloneCallEventCallback(RcloneEventCallback callback, void* userData, char* event) {
+	callback(userData, event);
+}
 */
 import "C"
 
 import (
+	"errors"
+	"io"
 	"unsafe"
 
 	"github.com/rclone/rclone/librclone/librclone"
@@ -100,5 +119,184 @@ func RcloneFreeString(str *C.char) {
 	C.free(unsafe.Pointer(str))
 }
 
+// cError returns err as a C string to be freed by the caller or nil
+// if err is nil
+func cError(err error) *C.char {
+	if err == nil {
+		return nil
+	}
+	return C.CString(err.Error())
+}
+
+// RcloneHandleResult is returned from RcloneOpen and RcloneListOpen
+//
+//	Handle is the handle to pass to the other calls if Error is NULL
+//	Error is an error message or NULL if there was no error
+type RcloneHandleResult struct { //nolint:deadcode
+	Handle C.int64_t
+	Error  *C.char
+}
+
+// RcloneIOResult is returned from RcloneRead, RcloneWrite and RcloneSeek
+//
+//	N is the number of bytes read or written or the new offset
+//	Error is an error message or NULL if there was no error
+type RcloneIOResult struct { //nolint:deadcode
+	N     C.int64_t
+	Error *C.char
+}
+
+// RcloneOpen opens a file on a remote returning a handle to stream
+// it with RcloneRead or RcloneWrite.
+//
+//	fs is the remote, e.g. "drive:" or "/tmp"
+//	remote is the path of the file within it
+//	mode is "r" to read the file or "w" to write it
+//
+// Files opened for writing are uploaded as they are written so must
+// be written sequentially. The upload finishes when the handle is
+// closed with RcloneClose which returns its error.
+//
+// Caller is responsible for freeing result.Error if set.
+//
+//export RcloneOpen
+func RcloneOpen(fs *C.char, remote *C.char, mode *C.char) (result C.struct_RcloneHandleResult) {
+	handle, err := librclone.Open(C.GoString(fs), C.GoString(remote), C.GoString(mode))
+	result.Handle = C.int64_t(handle)
+	result.Error = cError(err)
+	return result
+}
+
+// RcloneRead reads up to size bytes into buf from the file handle
+//
+// result.N is the number of bytes read which is 0 at the end of the
+// file. Caller is responsible for freeing result.Error if set.
+//
+//export RcloneRead
+func RcloneRead(handle C.int64_t, buf unsafe.Pointer, size C.int64_t) (result C.struct_RcloneIOResult) {
+	if size <= 0 {
+		return result
+	}
+	n, err := librclone.Read(int64(handle), unsafe.Slice((*byte)(buf), int(size)))
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	result.N = C.int64_t(n)
+	result.Error = cError(err)
+	return result
+}
+
+// RcloneWrite writes size bytes from buf to the file handle
+//
+// result.N is the number of bytes written. Caller is responsible for
+// freeing result.Error if set.
+//
+//export RcloneWrite
+func RcloneWrite(handle C.int64_t, buf unsafe.Pointer, size C.int64_t) (result C.struct_RcloneIOResult) {
+	if size <= 0 {
+		return result
+	}
+	n, err := librclone.Write(int64(handle), unsafe.Slice((*byte)(buf), int(size)))
+	result.N = C.int64_t(n)
+	result.Error = cError(err)
+	return result
+}
+
+// RcloneSeek sets the offset for the next RcloneRead on the file
+// handle like lseek, with whence 0 for the start of the file, 1 for
+// the current offset and 2 for the end.
+//
+// result.N is the new offset. Files opened for writing can only
+// report their offset. Caller is responsible for freeing
+// result.Error if set.
+//
+//export RcloneSeek
+func RcloneSeek(handle C.int64_t, offset C.int64_t, whence C.int) (result C.struct_RcloneIOResult) {
+	n, err := librclone.Seek(int64(handle), int64(offset), int(whence))
+	result.N = C.int64_t(n)
+	result.Error = cError(err)
+	return result
+}
+
+// RcloneClose closes a handle from RcloneOpen or RcloneListOpen
+//
+// It returns an error message or NULL if there was no error. Caller
+// is responsible for freeing the error.
+//
+//export RcloneClose
+func RcloneClose(handle C.int64_t) *C.char {
+	return cError(librclone.Close(int64(handle)))
+}
+
+// RcloneListOpen starts listing a directory returning a handle to
+// read the entries with RcloneListNext.
+//
+//	fs is the remote, e.g. "drive:" or "/tmp"
+//	dir is the directory within it to list
+//	opt is a JSON object with the options of operations/list, e.g. {"recurse": true}, or ""
+//
+// The handle must be closed with RcloneClose. Caller is responsible
+// for freeing result.Error if set.
+//
+//export RcloneListOpen
+func RcloneListOpen(fs *C.char, dir *C.char, opt *C.char) (result C.struct_RcloneHandleResult) {
+	handle, err := librclone.ListOpen(C.GoString(fs), C.GoString(dir), C.GoString(opt))
+	result.Handle = C.int64_t(handle)
+	result.Error = cError(err)
+	return result
+}
+
+// RcloneListNext returns up to maxEntries entries from the listing handle
+//
+//	result.Output is a JSON array of entries as returned by operations/list
+//	result.Status is a HTTP status return (200=OK anything else fail)
+//
+// This waits for at least one entry, returning an empty array when
+// the listing is finished. On failure result.Output is a JSON object
+// with the error as returned by RcloneRPC.
+//
+// Caller is responsible for freeing the memory for result.Output.
+//
+//export RcloneListNext
+func RcloneListNext(handle C.int64_t, maxEntries C.int) (result C.struct_RcloneRPCResult) {
+	output, status := librclone.ListNextRPC(int64(handle), int(maxEntries))
+	result.Output = C.CString(output)
+	result.Status = C.int(status)
+	return result
+}
+
+// RcloneSubscribe registers callback to be called with each event
+// with userData and the event as a JSON object in the format of the
+// rc event stream, as described in https://rclone.org/rc/#events
+//
+//	types is a comma separated list of event types to receive, e.g. "log,transfer", or "" for all
+//
+// The callback is called from a thread of its own, one event at a
+// time. The event string is freed when the callback returns so it
+// must be copied to be kept.
+//
+// It returns an id to pass to RcloneUnsubscribe to stop the callbacks.
+//
+//export RcloneSubscribe
+func RcloneSubscribe(callback C.RcloneEventCallback, userData unsafe.Pointer, types *C.char) C.int64_t {
+	id := librclone.Subscribe(C.GoString(types), func(event string) {
+		cEvent := C.CString(event)
+		C.rcloneCallEventCallback(callback, userData, cEvent)
+		C.free(unsafe.Pointer(cEvent))
+	})
+	return C.int64_t(id)
+}
+
+// RcloneUnsubscribe stops the callbacks registered by RcloneSubscribe
+//
+// When it returns the callback won't be called again, so it mustn't
+// be called from the callback. It returns an error message or NULL
+// if there was no error. Caller is responsible for freeing the error.
+//
+//export RcloneUnsubscribe
+func RcloneUnsubscribe(id C.int64_t) *C.char {
+	return cError(librclone.Unsubscribe(int64(id)))
+}
+
 // do nothing here - necessary for building into a C library
 func main() {}
@@ -0,0 +1,91 @@
+package librclone
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc/events"
+)
+
+// number of events buffered for each callback
+const callbackBuffer = 1024
+
+// callbacks holds the functions to stop the subscriptions by their id
+var callbacks = struct {
+	mu    sync.Mutex
+	next  int64
+	items map[int64]func()
+}{
+	items: map[int64]func(){},
+}
+
+// Subscribe calls fn with each event as a JSON object, in the format
+// of the rc event stream, until Unsubscribe is called with the id
+// returned.
+//
+// types is a comma separated list of the event types to receive, e.g.
+// "log,transfer", or empty for all of them.
+//
+// fn is called from a goroutine of its own, one event at a time. If it
+// doesn't keep up events will be lost.
+func Subscribe(types string, fn func(event string)) int64 {
+	var filter func(*events.Event) bool
+	var typeList []string
+	for _, t := range strings.Split(types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			typeList = append(typeList, t)
+		}
+	}
+	if len(typeList) > 0 {
+		filter = func(e *events.Event) bool {
+			return events.MatchType(e.Type, typeList)
+		}
+	}
+	sub := events.Subscribe(callbackBuffer, filter)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for {
+			select {
+			case <-done:
+				return
+			case e := <-sub.Events():
+				data, err := json.Marshal(e)
+				if err != nil {
+					fs.Debugf(nil, "librclone: failed to encode event: %v", err)
+					continue
+				}
+				fn(string(data))
+			}
+		}
+	}()
+	callbacks.mu.Lock()
+	defer callbacks.mu.Unlock()
+	callbacks.next++
+	callbacks.items[callbacks.next] = func() {
+		sub.Close()
+		close(done)
+		<-finished
+	}
+	return callbacks.next
+}
+
+// Unsubscribe stops the callbacks started by Subscribe with id
+//
+// When it returns the callback won't be called again, so it mustn't
+// be called from the callback itself.
+func Unsubscribe(id int64) error {
+	callbacks.mu.Lock()
+	stop, ok := callbacks.items[id]
+	delete(callbacks.items, id)
+	callbacks.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("invalid subscription %d", id)
+	}
+	stop()
+	return nil
+}
@@ -112,9 +112,13 @@ func RPC(method string, input string) (output string, status int) {
 		//in["_response"] = w
 	}
 
+	if err := call.Validate(in); err != nil {
+		return writeError(method, in, err, http.StatusBadRequest)
+	}
+
 	fs.Debugf(nil, "rc: %q: with parameters %+v", method, in)
 
-	_, out, err := jobs.NewJob(context.Background(), call.Fn, in)
+	_, out, err := jobs.NewJob(jobs.WithCommand(context.Background(), method), call.Fn, in)
 	if err != nil {
 		return writeError(method, in, err, http.StatusInternalServerError)
 	}
@@ -0,0 +1,384 @@
+package librclone
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+// handle is an open file or listing
+type handle interface {
+	Close() error
+}
+
+// handles holds the open handles by their id
+var handles = struct {
+	mu    sync.Mutex
+	next  int64
+	items map[int64]handle
+}{
+	items: map[int64]handle{},
+}
+
+// addHandle stores h returning its id
+func addHandle(h handle) int64 {
+	handles.mu.Lock()
+	defer handles.mu.Unlock()
+	handles.next++
+	handles.items[handles.next] = h
+	return handles.next
+}
+
+// getHandle finds the handle with id
+func getHandle(id int64) (handle, error) {
+	handles.mu.Lock()
+	defer handles.mu.Unlock()
+	h, ok := handles.items[id]
+	if !ok {
+		return nil, fmt.Errorf("invalid handle %d", id)
+	}
+	return h, nil
+}
+
+// removeHandle removes the handle with id returning it
+func removeHandle(id int64) (handle, error) {
+	handles.mu.Lock()
+	defer handles.mu.Unlock()
+	h, ok := handles.items[id]
+	if !ok {
+		return nil, fmt.Errorf("invalid handle %d", id)
+	}
+	delete(handles.items, id)
+	return h, nil
+}
+
+// reader reads an object, reopening it when it is seeked
+type reader struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	o      fs.Object
+	tr     *accounting.Transfer
+	in     io.ReadCloser // open stream at offset or nil
+	offset int64
+	err    error // first read error for the transfer
+}
+
+// writer uploads what is written to it as an object
+type writer struct {
+	mu     sync.Mutex
+	pw     *io.PipeWriter
+	done   chan struct{} // closed when the upload has finished
+	err    error         // upload error, read after done is closed
+	offset int64
+}
+
+// Open opens remote on the fsString remote for reading if mode is "r"
+// or writing if mode is "w", returning a handle to use with Read,
+// Write, Seek and Close.
+//
+// Files open for writing are uploaded as they are written, so they
+// can only be written sequentially and the upload is finished by
+// Close.
+func Open(fsString string, remote string, mode string) (int64, error) {
+	ctx := context.Background()
+	f, err := cache.Get(ctx, fsString)
+	if err != nil && !errors.Is(err, fs.ErrorIsFile) {
+		return 0, err
+	}
+	switch mode {
+	case "r":
+		o, err := f.NewObject(ctx, remote)
+		if err != nil {
+			return 0, err
+		}
+		r := &reader{
+			ctx: ctx,
+			o:   o,
+			tr:  accounting.Stats(ctx).NewTransfer(o, nil),
+		}
+		return addHandle(r), nil
+	case "w":
+		pr, pw := io.Pipe()
+		w := &writer{
+			pw:   pw,
+			done: make(chan struct{}),
+		}
+		go func() {
+			_, err := operations.Rcat(ctx, f, remote, pr, time.Now(), nil)
+			w.err = err
+			_ = pr.CloseWithError(err)
+			close(w.done)
+		}()
+		return addHandle(w), nil
+	}
+	return 0, fmt.Errorf("unknown open mode %q - must be r or w", mode)
+}
+
+// Read reads up to len(p) bytes into p from the file handle id
+//
+// It returns io.EOF at the end of the file.
+func Read(id int64, p []byte) (n int, err error) {
+	h, err := getHandle(id)
+	if err != nil {
+		return 0, err
+	}
+	r, ok := h.(*reader)
+	if !ok {
+		return 0, fmt.Errorf("handle %d is not open for reading", id)
+	}
+	return r.Read(p)
+}
+
+// Write writes p to the file handle id
+func Write(id int64, p []byte) (n int, err error) {
+	h, err := getHandle(id)
+	if err != nil {
+		return 0, err
+	}
+	w, ok := h.(*writer)
+	if !ok {
+		return 0, fmt.Errorf("handle %d is not open for writing", id)
+	}
+	return w.Write(p)
+}
+
+// Seek sets the offset of the file handle id for the next Read as in
+// io.Seeker, returning the new offset.
+//
+// Files open for writing can only report their offset.
+func Seek(id int64, offset int64, whence int) (int64, error) {
+	h, err := getHandle(id)
+	if err != nil {
+		return 0, err
+	}
+	s, ok := h.(io.Seeker)
+	if !ok {
+		return 0, fmt.Errorf("handle %d can't be seeked", id)
+	}
+	return s.Seek(offset, whence)
+}
+
+// Close closes the file or listing handle id
+//
+// For files open for writing this waits for the upload to finish
+// and returns its error.
+func Close(id int64) error {
+	h, err := removeHandle(id)
+	if err != nil {
+		return err
+	}
+	return h.Close()
+}
+
+// Read implements io.Reader
+func (r *reader) Read(p []byte) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.in == nil {
+		if r.offset >= r.o.Size() && r.o.Size() >= 0 {
+			return 0, io.EOF
+		}
+		var options []fs.OpenOption
+		if r.offset > 0 {
+			options = append(options, &fs.SeekOption{Offset: r.offset})
+		}
+		in, err := operations.Open(r.ctx, r.o, options...)
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		r.in = r.tr.Account(r.ctx, in)
+	}
+	n, err = r.in.Read(p)
+	r.offset += int64(n)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker
+func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.o.Size()
+	default:
+		return r.offset, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return r.offset, errors.New("can't seek before the start of the file")
+	}
+	if offset != r.offset && r.in != nil {
+		_ = r.in.Close()
+		r.in = nil
+	}
+	r.offset = offset
+	return r.offset, nil
+}
+
+// Close implements io.Closer
+func (r *reader) Close() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.in != nil {
+		err = r.in.Close()
+		r.in = nil
+	}
+	r.tr.Done(r.ctx, r.err)
+	return err
+}
+
+// Write implements io.Writer
+func (w *writer) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err = w.pw.Write(p)
+	w.offset += int64(n)
+	if err != nil {
+		// Return the upload error if there was one
+		<-w.done
+		if w.err != nil {
+			err = w.err
+		}
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker but can only be used to read the offset
+func (w *writer) Seek(offset int64, whence int) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if (whence == io.SeekCurrent && offset == 0) || (whence == io.SeekStart && offset == w.offset) {
+		return w.offset, nil
+	}
+	return w.offset, errors.New("files open for writing can't be seeked")
+}
+
+// Close implements io.Closer finishing the upload
+func (w *writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_ = w.pw.Close()
+	<-w.done
+	return w.err
+}
+
+// lister lists a directory in the background
+type lister struct {
+	cancel context.CancelFunc
+	items  chan *operations.ListJSONItem // closed when the listing is done
+	err    error                         // listing error, read after items is closed
+}
+
+// ListOpen starts listing dir on the fsString remote returning a
+// handle to read the items with ListNext. This must be closed with
+// Close.
+//
+// opt is a JSON object with the options for operations/list, e.g.
+// {"recurse": true}, or may be empty.
+func ListOpen(fsString string, dir string, opt string) (int64, error) {
+	var listOpt operations.ListJSONOpt
+	if opt != "" {
+		err := json.Unmarshal([]byte(opt), &listOpt)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read list options: %w", err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f, err := cache.Get(ctx, fsString)
+	if err != nil {
+		cancel()
+		return 0, err
+	}
+	l := &lister{
+		cancel: cancel,
+		items:  make(chan *operations.ListJSONItem, 64),
+	}
+	go func() {
+		l.err = operations.ListJSON(ctx, f, dir, &listOpt, func(item *operations.ListJSONItem) error {
+			select {
+			case l.items <- item:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		close(l.items)
+	}()
+	return addHandle(l), nil
+}
+
+// ListNext returns up to maxItems items from the listing handle id as a
+// JSON array in the format of operations/list.
+//
+// It waits for at least one item, returning an empty array when the
+// listing is finished.
+func ListNext(id int64, maxItems int) (string, error) {
+	h, err := getHandle(id)
+	if err != nil {
+		return "", err
+	}
+	l, ok := h.(*lister)
+	if !ok {
+		return "", fmt.Errorf("handle %d is not a listing", id)
+	}
+	if maxItems <= 0 {
+		maxItems = 1
+	}
+	items := []*operations.ListJSONItem{}
+	item, ok := <-l.items
+	if !ok {
+		if l.err != nil {
+			return "", l.err
+		}
+		return "[]", nil
+	}
+	items = append(items, item)
+loop:
+	for len(items) < maxItems {
+		select {
+		case item, ok := <-l.items:
+			if !ok {
+				break loop
+			}
+			items = append(items, item)
+		default:
+			break loop
+		}
+	}
+	out, err := json.Marshal(items)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// ListNextRPC calls ListNext returning the output and status like RPC
+func ListNextRPC(id int64, maxItems int) (output string, status int) {
+	output, err := ListNext(id, maxItems)
+	if err != nil {
+		return writeError("librclone/listnext", nil, err, http.StatusInternalServerError)
+	}
+	return output, http.StatusOK
+}
+
+// Close implements io.Closer stopping the listing
+func (l *lister) Close() error {
+	l.cancel()
+	return nil
+}
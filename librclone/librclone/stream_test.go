@@ -0,0 +1,156 @@
+package librclone
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenReadSeek(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hello world"), 0666))
+
+	h, err := Open(dir, "file.txt", "r")
+	require.NoError(t, err)
+
+	buf := make([]byte, 5)
+	n, err := Read(h, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+
+	offset, err := Seek(h, -5, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), offset)
+	n, err = io.ReadFull(readerFunc(func(p []byte) (int, error) { return Read(h, p) }), buf)
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(buf[:n]))
+	_, err = Read(h, buf)
+	assert.Equal(t, io.EOF, err)
+
+	offset, err = Seek(h, 0, io.SeekStart)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), offset)
+	n, err = Read(h, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+
+	_, err = Write(h, buf)
+	assert.ErrorContains(t, err, "not open for writing")
+
+	require.NoError(t, Close(h))
+	_, err = Read(h, buf)
+	assert.ErrorContains(t, err, "invalid handle")
+	assert.ErrorContains(t, Close(h), "invalid handle")
+
+	_, err = Open(dir, "notfound.txt", "r")
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+	_, err = Open(dir, "file.txt", "x")
+	assert.ErrorContains(t, err, "unknown open mode")
+}
+
+// readerFunc turns a function into an io.Reader
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestOpenWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	h, err := Open(dir, "sub/file.txt", "w")
+	require.NoError(t, err)
+	for _, s := range []string{"one ", "two ", "three"} {
+		n, err := Write(h, []byte(s))
+		require.NoError(t, err)
+		assert.Equal(t, len(s), n)
+	}
+	offset, err := Seek(h, 0, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.Equal(t, int64(13), offset)
+	_, err = Seek(h, 0, io.SeekStart)
+	assert.ErrorContains(t, err, "can't be seeked")
+	_, err = Read(h, make([]byte, 1))
+	assert.ErrorContains(t, err, "not open for reading")
+	require.NoError(t, Close(h))
+
+	data, err := os.ReadFile(filepath.Join(dir, "sub", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "one two three", string(data))
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c/d.txt"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0777))
+		require.NoError(t, os.WriteFile(path, []byte(name), 0666))
+	}
+
+	list := func(opt string, maxItems int) (names []string) {
+		h, err := ListOpen(dir, "", opt)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, Close(h))
+		}()
+		for {
+			out, err := ListNext(h, maxItems)
+			require.NoError(t, err)
+			var items []struct{ Path string }
+			require.NoError(t, json.Unmarshal([]byte(out), &items))
+			if len(items) == 0 {
+				return names
+			}
+			assert.LessOrEqual(t, len(items), maxItems)
+			for _, item := range items {
+				names = append(names, item.Path)
+			}
+		}
+	}
+	assert.ElementsMatch(t, []string{"a.txt", "b.txt", "c"}, list("", 1))
+	assert.ElementsMatch(t, []string{"a.txt", "b.txt", "c", "c/d.txt"}, list(`{"recurse":true}`, 100))
+
+	_, err := ListOpen(dir, "", "potato")
+	assert.ErrorContains(t, err, "failed to read list options")
+
+	// closing a listing before the end stops it
+	h, err := ListOpen(dir, "", "")
+	require.NoError(t, err)
+	require.NoError(t, Close(h))
+	output, status := ListNextRPC(h, 1)
+	assert.Equal(t, 500, status)
+	assert.Contains(t, output, "invalid handle")
+}
+
+func TestSubscribe(t *testing.T) {
+	got := make(chan string, 10)
+	id := Subscribe("job, transfer", func(event string) {
+		got <- event
+	})
+	events.Publish(&events.Event{Type: events.Log})
+	events.Publish(&events.Event{Type: events.JobStart, JobID: 42})
+
+	select {
+	case event := <-got:
+		var e events.Event
+		require.NoError(t, json.Unmarshal([]byte(event), &e))
+		assert.Equal(t, events.JobStart, e.Type)
+		assert.Equal(t, int64(42), e.JobID)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	require.NoError(t, Unsubscribe(id))
+	assert.ErrorContains(t, Unsubscribe(id), "invalid subscription")
+	events.Publish(&events.Event{Type: events.JobFinish})
+	assert.Equal(t, 0, len(got))
+}
@@ -9,13 +9,32 @@ Then call rpc calls on it
 
     rclone.rpc("rc/noop", a=42, b="string", c=[1234])
 
+Stream files in and out of remotes
+
+    with rclone.open("remote:path", "file.txt", "w") as f:
+        f.write(b"hello")
+    with rclone.open("remote:path", "file.txt") as f:
+        data = f.read()
+
+List directories incrementally
+
+    for entry in rclone.list("remote:path", recurse=True):
+        print(entry["Path"])
+
+Receive log lines and accounting events as they happen
+
+    sub = rclone.subscribe(lambda event: print(event["type"]), types="log,transfer")
+    ...
+    rclone.unsubscribe(sub)
+
 When finished, close it
 
     rclone.close()
 """
 
-__all__ = ('Rclone', 'RcloneException')
+__all__ = ('Rclone', 'RcloneException', 'RcloneFile')
 
+import io
 import os
 import json
 import subprocess
@@ -39,6 +58,22 @@ class RcloneRPCResult(Structure):
     _fields_ = [("Output", RcloneRPCString),
                 ("Status", c_int)]
 
+class RcloneHandleResult(Structure):
+    """
+    This is returned from the C API when calling RcloneOpen and RcloneListOpen
+    """
+    _fields_ = [("Handle", c_int64),
+                ("Error", RcloneRPCString)]
+
+class RcloneIOResult(Structure):
+    """
+    This is returned from the C API when calling RcloneRead, RcloneWrite and RcloneSeek
+    """
+    _fields_ = [("N", c_int64),
+                ("Error", RcloneRPCString)]
+
+RcloneEventCallback = CFUNCTYPE(None, c_void_p, c_char_p)
+
 class RcloneException(Exception):
     """
     Exception raised from rclone
@@ -70,6 +105,25 @@ class Rclone():
         self.rclone.RcloneInitialize.argtypes = ()
         self.rclone.RcloneFinalize.restype = None
         self.rclone.RcloneFinalize.argtypes = ()
+        self.rclone.RcloneOpen.restype = RcloneHandleResult
+        self.rclone.RcloneOpen.argtypes = (c_char_p, c_char_p, c_char_p)
+        self.rclone.RcloneRead.restype = RcloneIOResult
+        self.rclone.RcloneRead.argtypes = (c_int64, c_void_p, c_int64)
+        self.rclone.RcloneWrite.restype = RcloneIOResult
+        self.rclone.RcloneWrite.argtypes = (c_int64, c_void_p, c_int64)
+        self.rclone.RcloneSeek.restype = RcloneIOResult
+        self.rclone.RcloneSeek.argtypes = (c_int64, c_int64, c_int)
+        self.rclone.RcloneClose.restype = RcloneRPCString
+        self.rclone.RcloneClose.argtypes = (c_int64,)
+        self.rclone.RcloneListOpen.restype = RcloneHandleResult
+        self.rclone.RcloneListOpen.argtypes = (c_char_p, c_char_p, c_char_p)
+        self.rclone.RcloneListNext.restype = RcloneRPCResult
+        self.rclone.RcloneListNext.argtypes = (c_int64, c_int)
+        self.rclone.RcloneSubscribe.restype = c_int64
+        self.rclone.RcloneSubscribe.argtypes = (RcloneEventCallback, c_void_p, c_char_p)
+        self.rclone.RcloneUnsubscribe.restype = RcloneRPCString
+        self.rclone.RcloneUnsubscribe.argtypes = (c_int64,)
+        self.callbacks = {}
         self.rclone.RcloneInitialize()
     def rpc(self, method, **kwargs):
         """
@@ -89,10 +143,81 @@ class Rclone():
         if status != 200:
             raise RcloneException(output, status)
         return output
+    def _check(self, error):
+        """
+        Raise an RcloneException if error from the C API is set, freeing it
+        """
+        if not error or error.value is None:
+            return
+        message = error.value.decode("utf-8")
+        self.rclone.RcloneFreeString(error)
+        raise RcloneException(dict(error=message), 500)
+    def open(self, fs, remote, mode="r"):
+        """
+        Open the file remote on the remote fs returning an RcloneFile
+
+        mode is "r" to read it or "w" to write it. Files opened for
+        writing are uploaded as they are written and the upload
+        finishes when the file is closed.
+        """
+        resp = self.rclone.RcloneOpen(fs.encode("utf-8"), remote.encode("utf-8"), mode.encode("utf-8"))
+        self._check(resp.Error)
+        return RcloneFile(self, resp.Handle, mode)
+    def list(self, fs, dir="", batch=100, **kwargs):
+        """
+        List dir on the remote fs yielding the entries as they are read
+
+        The kwargs are the options of operations/list, e.g. recurse=True.
+        Each entry is a dictionary as returned by operations/list.
+        """
+        opt = json.dumps(kwargs).encode("utf-8")
+        resp = self.rclone.RcloneListOpen(fs.encode("utf-8"), dir.encode("utf-8"), opt)
+        self._check(resp.Error)
+        handle = resp.Handle
+        try:
+            while True:
+                resp = self.rclone.RcloneListNext(handle, batch)
+                output = json.loads(resp.Output.value.decode("utf-8"))
+                self.rclone.RcloneFreeString(resp.Output)
+                if resp.Status != 200:
+                    raise RcloneException(output, resp.Status)
+                if not output:
+                    return
+                yield from output
+        finally:
+            # Errors closing the listing are ignored but must be freed
+            error = self.rclone.RcloneClose(handle)
+            if error and error.value is not None:
+                self.rclone.RcloneFreeString(error)
+    def subscribe(self, callback, types=""):
+        """
+        Call callback with each event as a dictionary, returning an id
+        to pass to unsubscribe.
+
+        types is a comma separated list of event types to receive,
+        e.g. "log,transfer", or "" for all. The callback is called
+        from a thread of rclone's.
+        """
+        def c_callback(user_data, event):
+            callback(json.loads(event.decode("utf-8")))
+        c_callback = RcloneEventCallback(c_callback)
+        subscription = self.rclone.RcloneSubscribe(c_callback, None, types.encode("utf-8"))
+        # keep a reference to the callback so it isn't garbage collected
+        self.callbacks[subscription] = c_callback
+        return subscription
+    def unsubscribe(self, subscription):
+        """
+        Stop the callbacks started by subscribe
+        """
+        error = self.rclone.RcloneUnsubscribe(subscription)
+        self.callbacks.pop(subscription, None)
+        self._check(error)
     def close(self):
         """
         Call to finish with the rclone connection
         """
+        for subscription in list(self.callbacks):
+            self.unsubscribe(subscription)
         self.rclone.RcloneFinalize()
         self.rclone = None
     @classmethod
@@ -106,3 +231,49 @@ class Rclone():
             return
         print("Building "+shared_object)
         subprocess.check_call(["go", "build", "--buildmode=c-shared", "-o", shared_object, "github.com/rclone/rclone/librclone"])
+
+class RcloneFile(io.RawIOBase):
+    """
+    A file on a remote opened with Rclone.open
+
+    This can be used like a binary file opened without buffering.
+    """
+    def __init__(self, rclone, handle, mode):
+        super().__init__()
+        self._rclone = rclone
+        self._handle = handle
+        self._mode = mode
+    def readable(self):
+        return self._mode == "r"
+    def writable(self):
+        return self._mode == "w"
+    def seekable(self):
+        return self._mode == "r"
+    def readinto(self, buffer):
+        view = memoryview(buffer).cast("B")
+        if len(view) == 0:
+            return 0
+        buf = (c_char * len(view)).from_buffer(view)
+        resp = self._rclone.rclone.RcloneRead(self._handle, buf, len(view))
+        self._rclone._check(resp.Error)
+        return resp.N
+    def write(self, data):
+        data = bytes(data)
+        resp = self._rclone.rclone.RcloneWrite(self._handle, data, len(data))
+        self._rclone._check(resp.Error)
+        return resp.N
+    def seek(self, offset, whence=io.SEEK_SET):
+        resp = self._rclone.rclone.RcloneSeek(self._handle, offset, whence)
+        self._rclone._check(resp.Error)
+        return resp.N
+    def tell(self):
+        return self.seek(0, io.SEEK_CUR)
+    def close(self):
+        """
+        Close the file, finishing the upload if it was opened for writing
+        """
+        if self.closed:
+            return
+        super().close()
+        error = self._rclone.rclone.RcloneClose(self._handle)
+        self._rclone._check(error)
@@ -5,6 +5,8 @@ Test program for librclone
 
 import os
 import subprocess
+import tempfile
+import threading
 import unittest
 from rclone import *
 
@@ -38,5 +40,52 @@ class TestRclone(unittest.TestCase):
         else:
             raise ValueError("Expecting exception")
 
+    def test_open_write_read(self):
+        with tempfile.TemporaryDirectory() as tmp:
+            with self.rclone.open(tmp, "file.txt", "w") as f:
+                self.assertEqual(f.write(b"hello "), 6)
+                self.assertEqual(f.write(b"world"), 5)
+                self.assertEqual(f.tell(), 11)
+            with open(os.path.join(tmp, "file.txt"), "rb") as f:
+                self.assertEqual(f.read(), b"hello world")
+            with self.rclone.open(tmp, "file.txt") as f:
+                self.assertEqual(f.read(5), b"hello")
+                self.assertEqual(f.seek(-5, os.SEEK_END), 6)
+                self.assertEqual(f.read(), b"world")
+                self.assertEqual(f.read(), b"")
+                f.seek(0)
+                self.assertEqual(f.readall(), b"hello world")
+
+    def test_open_error(self):
+        with tempfile.TemporaryDirectory() as tmp:
+            with self.assertRaises(RcloneException) as cm:
+                self.rclone.open(tmp, "notfound.txt")
+            self.assertIn("not found", str(cm.exception))
+
+    def test_list(self):
+        with tempfile.TemporaryDirectory() as tmp:
+            os.mkdir(os.path.join(tmp, "dir"))
+            for name in ["a.txt", "b.txt", os.path.join("dir", "c.txt")]:
+                with open(os.path.join(tmp, name), "w") as f:
+                    f.write(name)
+            paths = sorted(entry["Path"] for entry in self.rclone.list(tmp, batch=1))
+            self.assertEqual(paths, ["a.txt", "b.txt", "dir"])
+            paths = sorted(entry["Path"] for entry in self.rclone.list(tmp, recurse=True))
+            self.assertEqual(paths, ["a.txt", "b.txt", "dir", "dir/c.txt"])
+
+    def test_subscribe(self):
+        got = threading.Event()
+        events = []
+        def callback(event):
+            events.append(event)
+            got.set()
+        subscription = self.rclone.subscribe(callback, types="job")
+        try:
+            self.rclone.rpc("rc/noop", _async=True)
+            self.assertTrue(got.wait(10))
+        finally:
+            self.rclone.unsubscribe(subscription)
+        self.assertEqual(events[0]["type"], "job/start")
+
 if __name__ == '__main__':
     unittest.main()
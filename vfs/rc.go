@@ -14,6 +14,9 @@ import (
 	"github.com/rclone/rclone/vfs/vfscache/writeback"
 )
 
+// vfsParam is the parameter to select the VFS in use
+var vfsParam = rc.Param{Name: "fs", Type: rc.TypeString, Help: "the VFS to use - may be left out if only one is in use"}
+
 const getVFSHelp = ` 
 This command takes an "fs" parameter. If this parameter is not
 supplied and if there is only one VFS in use then that VFS will be
@@ -58,6 +61,14 @@ func init() {
 		Path:  "vfs/refresh",
 		Fn:    rcRefresh,
 		Title: "Refresh the directory cache.",
+		Params: []rc.Param{
+			vfsParam,
+			{Name: "recursive", Type: rc.TypeBoolean, Help: "refresh the whole directory tree"},
+			{Name: "dir*", Type: rc.TypeString, Help: "directories to refresh"},
+		},
+		Result: []rc.Param{
+			{Name: "result", Type: rc.TypeObject, Help: `map of the directories refreshed to "OK" or an error`},
+		},
 		Help: `
 This reads the directories for the specified paths and freshens the
 directory cache.
@@ -173,6 +184,14 @@ func init() {
 		Path:  "vfs/forget",
 		Fn:    rcForget,
 		Title: "Forget files or directories in the directory cache.",
+		Params: []rc.Param{
+			vfsParam,
+			{Name: "file*", Type: rc.TypeString, Help: "files to forget"},
+			{Name: "dir*", Type: rc.TypeString, Help: "directories to forget"},
+		},
+		Result: []rc.Param{
+			{Name: "forgotten", Type: rc.TypeArray, Items: rc.TypeString, Help: "the paths forgotten"},
+		},
 		Help: `
 This forgets the paths in the directory cache causing them to be
 re-read from the remote when needed.
@@ -291,6 +310,17 @@ func init() {
 		Path:  "vfs/poll-interval",
 		Fn:    rcPollInterval,
 		Title: "Get the status or update the value of the poll-interval option.",
+		Params: []rc.Param{
+			vfsParam,
+			{Name: "interval", Type: rc.TypeDuration, Help: "the new poll-interval, 0 to disable"},
+			{Name: "timeout", Type: rc.TypeDuration, Help: "time to wait for the poll function to apply the new value"},
+		},
+		Result: []rc.Param{
+			{Name: "enabled", Type: rc.TypeBoolean, Help: "whether polling is enabled"},
+			{Name: "supported", Type: rc.TypeBoolean, Help: "whether the remote supports polling"},
+			{Name: "interval", Type: rc.TypeObject, Help: "the poll-interval as raw, seconds and string"},
+			{Name: "timeout", Type: rc.TypeBoolean, Help: "set if the timeout was reached"},
+		},
 		Help: `
 Without any parameter given this returns the current status of the
 poll-interval setting.
@@ -361,8 +391,12 @@ func rcPollInterval(ctx context.Context, in rc.Params) (out rc.Params, err error
 
 func init() {
 	rc.Add(rc.Call{
-		Path:  "vfs/list",
-		Title: "List active VFSes.",
+		Path:   "vfs/list",
+		Title:  "List active VFSes.",
+		Params: []rc.Param{},
+		Result: []rc.Param{
+			{Name: "vfses", Type: rc.TypeArray, Items: rc.TypeString, Help: "names of the active VFSes"},
+		},
 		Help: `
 This lists the active VFSes.
 
@@ -393,8 +427,16 @@ func rcList(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 
 func init() {
 	rc.Add(rc.Call{
-		Path:  "vfs/stats",
-		Title: "Stats for a VFS.",
+		Path:   "vfs/stats",
+		Title:  "Stats for a VFS.",
+		Params: []rc.Param{vfsParam},
+		Result: []rc.Param{
+			{Name: "diskCache", Type: rc.TypeObject, Help: "status of the disk cache - only present if --vfs-cache-mode > off"},
+			{Name: "fs", Type: rc.TypeString, Help: "the remote the VFS is for"},
+			{Name: "inUse", Type: rc.TypeInteger, Help: "number of users of the VFS"},
+			{Name: "metadataCache", Type: rc.TypeObject, Help: "status of the in memory metadata cache"},
+			{Name: "opt", Type: rc.TypeObject, Help: "the VFS options"},
+		},
 		Help: `
 This returns stats for the selected VFS.
 
@@ -441,8 +483,12 @@ func rcStats(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 
 func init() {
 	rc.Add(rc.Call{
-		Path:  "vfs/queue",
-		Title: "Queue info for a VFS.",
+		Path:   "vfs/queue",
+		Title:  "Queue info for a VFS.",
+		Params: []rc.Param{vfsParam},
+		Result: []rc.Param{
+			{Name: "queued", Type: rc.TypeArray, Items: rc.TypeObject, Help: "the files queued for upload"},
+		},
 		Help: strings.ReplaceAll(`
 This returns info about the upload queue for the selected VFS.
 
@@ -491,6 +537,12 @@ func init() {
 	rc.Add(rc.Call{
 		Path:  "vfs/queue-set-expiry",
 		Title: "Set the expiry time for an item queued for upload.",
+		Params: []rc.Param{
+			vfsParam,
+			{Name: "id", Type: rc.TypeInteger, Required: true, Help: "a numeric ID as returned from vfs/queue"},
+			{Name: "expiry", Type: rc.TypeNumber, Required: true, Help: "a new expiry time as floating point seconds"},
+		},
+		Result: []rc.Param{},
 		Help: strings.ReplaceAll(`
 
 Use this to adjust the |expiry| time for an item in the upload queue.
@@ -185,6 +185,9 @@ type VFS struct {
 	usage       *fs.Usage
 	pollChan    chan time.Duration
 	inUse       atomic.Int32 // count of number of opens
+	notifyMu    sync.Mutex   // protects the following
+	notifyID    int
+	notifyFns   map[int]func(relativePath string, entryType fs.EntryType)
 }
 
 // Keep track of active VFS keyed on fs.ConfigString(f)
@@ -233,7 +236,7 @@ func New(f fs.Fs, opt *vfscommon.Options) *VFS {
 	features := vfs.f.Features()
 	if do := features.ChangeNotify; do != nil {
 		vfs.pollChan = make(chan time.Duration)
-		do(context.TODO(), vfs.root.changeNotify, vfs.pollChan)
+		do(context.TODO(), vfs.changeNotify, vfs.pollChan)
 		vfs.pollChan <- time.Duration(vfs.Opt.PollInterval)
 	} else if vfs.Opt.PollInterval > 0 {
 		fs.Infof(f, "poll-interval is not supported by this remote")
@@ -412,6 +415,45 @@ func (vfs *VFS) WaitForWriters(timeout time.Duration) {
 	}
 }
 
+// changeNotify invalidates the directory cache for relativePath then
+// calls the functions registered with AddChangeNotify
+func (vfs *VFS) changeNotify(relativePath string, entryType fs.EntryType) {
+	vfs.root.changeNotify(relativePath, entryType)
+	vfs.notifyMu.Lock()
+	fns := make([]func(string, fs.EntryType), 0, len(vfs.notifyFns))
+	for _, fn := range vfs.notifyFns {
+		fns = append(fns, fn)
+	}
+	vfs.notifyMu.Unlock()
+	for _, fn := range fns {
+		fn(relativePath, entryType)
+	}
+}
+
+// AddChangeNotify registers fn to be called with each change the
+// remote reports after the directory cache has been invalidated.
+//
+// It returns a function to unregister fn, or nil if the remote can't
+// report changes or polling is disabled.
+func (vfs *VFS) AddChangeNotify(fn func(relativePath string, entryType fs.EntryType)) (remove func()) {
+	if vfs.pollChan == nil || vfs.Opt.PollInterval <= 0 {
+		return nil
+	}
+	vfs.notifyMu.Lock()
+	defer vfs.notifyMu.Unlock()
+	if vfs.notifyFns == nil {
+		vfs.notifyFns = make(map[int]func(string, fs.EntryType))
+	}
+	vfs.notifyID++
+	id := vfs.notifyID
+	vfs.notifyFns[id] = fn
+	return func() {
+		vfs.notifyMu.Lock()
+		delete(vfs.notifyFns, id)
+		vfs.notifyMu.Unlock()
+	}
+}
+
 // Root returns the root node
 func (vfs *VFS) Root() (*Dir, error) {
 	// fs.Debugf(vfs.f, "Root()")
@@ -130,6 +130,8 @@ func New(ctx context.Context, fremote fs.Fs, opt *vfscommon.Options, avFn AddVir
 		avFn:       avFn,
 	}
 
+	c.writeback.SetName(fs.ConfigString(fremote))
+
 	// load in the cache and metadata off disk
 	err = c.reload(ctx)
 	if err != nil {
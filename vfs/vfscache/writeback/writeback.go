@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/events"
 	"github.com/rclone/rclone/vfs/vfscommon"
 )
 
@@ -38,6 +40,7 @@ type WriteBack struct {
 	timer   *time.Timer               // next scheduled time for the uploader
 	expiry  time.Time                 // time the next item expires or IsZero
 	uploads int                       // number of uploads in progress
+	name    string                    // name of the remote for events
 }
 
 // New make a new WriteBack
@@ -54,6 +57,38 @@ func New(ctx context.Context, opt *vfscommon.Options) *WriteBack {
 	return wb
 }
 
+// SetName sets the name of the remote being written back to which is
+// used in the events published.
+func (wb *WriteBack) SetName(name string) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	wb.name = name
+}
+
+// publish an event about the upload of wbItem
+//
+// call with the lock held
+func (wb *WriteBack) _publish(wbItem *writeBackItem, action string, err error) {
+	if !events.Active() {
+		return
+	}
+	data := rc.Params{
+		"fs":                wb.name,
+		"name":              wbItem.name,
+		"size":              wbItem.size,
+		"action":            action,
+		"uploadsInProgress": wb.uploads,
+		"uploadsQueued":     len(wb.items),
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	events.Publish(&events.Event{
+		Type: events.VFSUpload,
+		Data: data,
+	})
+}
+
 // writeBackItem stores an Item awaiting writeback
 //
 // These are stored on the items heap when awaiting transfer but
@@ -148,6 +183,7 @@ func (wb *WriteBack) _newItem(id Handle, name string, size int64) *writeBackItem
 	}
 	wb._addItem(wbItem)
 	wb._pushItem(wbItem)
+	wb._publish(wbItem, "queued", nil)
 	return wbItem
 }
 
@@ -297,6 +333,7 @@ func (wb *WriteBack) _remove(id Handle) (found bool) {
 		wb._removeItem(wbItem)
 		// Remove the item from the lookup map
 		wb._delItem(wbItem)
+		wb._publish(wbItem, "removed", nil)
 	}
 	wb._resetTimer()
 	return found
@@ -379,10 +416,12 @@ func (wb *WriteBack) upload(ctx context.Context, wbItem *writeBackItem) {
 		// push the item back on the queue for retry
 		wb._pushItem(wbItem)
 		wb.items._update(wbItem, time.Now().Add(wbItem.delay))
+		wb._publish(wbItem, "failed", err)
 	} else {
 		fs.Infof(wbItem.name, "vfs cache: upload succeeded try #%d", wbItem.tries)
 		// show that we are done with the item
 		wb._delItem(wbItem)
+		wb._publish(wbItem, "uploaded", nil)
 	}
 	wb._resetTimer()
 	close(wbItem.done)
@@ -451,6 +490,7 @@ func (wb *WriteBack) processItems(ctx context.Context) {
 		newCtx, cancel := context.WithCancel(ctx)
 		wbItem.cancel = cancel
 		wbItem.done = make(chan struct{})
+		wb._publish(wbItem, "uploading", nil)
 		go wb.upload(newCtx, wbItem)
 	}
 